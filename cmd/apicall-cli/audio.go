@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func runAudioList(cmd *cobra.Command, args []string) {
+	path := "/api/v1/audios"
+	if tag := getString(cmd, "tag"); tag != "" {
+		path += "?tag=" + url.QueryEscape(tag)
+	}
+	data, err := callAPI(http.MethodGet, path, nil)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
+		return
+	}
+
+	var audios []struct {
+		Name     string   `json:"name"`
+		Title    string   `json:"title"`
+		Duration float64  `json:"duration"`
+		Size     int64    `json:"size"`
+		Tags     []string `json:"tags"`
+		UsedBy   []struct {
+			Tipo string `json:"tipo"`
+			ID   int    `json:"id"`
+		} `json:"used_by"`
+	}
+	json.Unmarshal(data, &audios)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NOMBRE\tTITULO\tDURACION\tTAMAÑO\tTAGS\tUSADO POR")
+	fmt.Fprintln(w, "------\t------\t--------\t------\t----\t---------")
+	for _, a := range audios {
+		var usedBy []string
+		for _, ref := range a.UsedBy {
+			usedBy = append(usedBy, fmt.Sprintf("%s %d", ref.Tipo, ref.ID))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1fs\t%d KB\t%s\t%s\n", a.Name, a.Title, a.Duration, a.Size/1024,
+			strings.Join(a.Tags, ","), strings.Join(usedBy, ", "))
+	}
+	w.Flush()
+}
+
+func runAudioUpload(cmd *cobra.Command, args []string) {
+	data, err := uploadAPI("/api/v1/audios/upload", map[string]string{
+		"name":  getString(cmd, "name"),
+		"title": getString(cmd, "title"),
+		"tags":  getString(cmd, "tags"),
+	}, "audio", args[0])
+	if err != nil {
+		fail(err)
+	}
+
+	var out struct {
+		Filename string `json:"filename"`
+	}
+	json.Unmarshal(data, &out)
+	printResult(data, fmt.Sprintf("Audio subido y convertido: %s", out.Filename))
+}
+
+func runAudioDelete(cmd *cobra.Command, args []string) {
+	data, err := callAPI(http.MethodDelete, "/api/v1/audios/delete?name="+url.QueryEscape(args[0]), nil)
+	if err != nil {
+		fail(err)
+	}
+	printResult(data, fmt.Sprintf("Audio %s eliminado.", args[0]))
+}
+
+// runAudioPlayURL muestra la URL de reproducción del audio. La API la sirve con el token en el header
+// Authorization; con --save se descarga con la sesión del perfil para escucharlo localmente.
+func runAudioPlayURL(cmd *cobra.Command, args []string) {
+	path := "/api/v1/audios/stream?name=" + url.QueryEscape(args[0])
+	save := getString(cmd, "save")
+	if save != "" {
+		resp, err := doRequest(http.MethodGet, path, nil, "")
+		if err != nil {
+			fail(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_, err := readResponse(resp)
+			fail(err)
+		}
+		f, err := os.Create(save)
+		if err != nil {
+			resp.Body.Close()
+			usageError("%v", err)
+		}
+		_, err = io.Copy(f, resp.Body)
+		resp.Body.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fail(newError(exitConnection, "error descargando el audio: %v", err))
+		}
+	}
+
+	if outputFormat == "json" {
+		out := map[string]string{"name": args[0], "url": apiHost + path}
+		if save != "" {
+			out["saved_to"] = save
+		}
+		printJSON(out)
+		return
+	}
+	fmt.Println(apiHost + path)
+	if save != "" {
+		fmt.Fprintf(os.Stderr, "Audio guardado en %s\n", save)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func runBlacklistList(cmd *cobra.Command, args []string) {
+	project := getInt(cmd, "project")
+	if project == 0 {
+		usageError("--project es requerido")
+	}
+	data, err := callAPI(http.MethodGet, fmt.Sprintf("/api/v1/blacklist?proyecto_id=%d&limit=%d", project, getInt(cmd, "limit")), nil)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
+		return
+	}
+
+	var out struct {
+		Entries []struct {
+			ID        int64     `json:"id"`
+			Telefono  string    `json:"telefono"`
+			Razon     *string   `json:"razon"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"entries"`
+		Total int `json:"total"`
+	}
+	json.Unmarshal(data, &out)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tTELEFONO\tRAZON\tFECHA")
+	fmt.Fprintln(w, "--\t--------\t-----\t-----")
+	for _, e := range out.Entries {
+		razon := ""
+		if e.Razon != nil {
+			razon = *e.Razon
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", e.ID, e.Telefono, razon, e.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+	fmt.Printf("\nMostrando %d de %d números.\n", len(out.Entries), out.Total)
+}
+
+func runBlacklistAdd(cmd *cobra.Command, args []string) {
+	project := getInt(cmd, "project")
+	number := getString(cmd, "number")
+	if project == 0 || number == "" {
+		usageError("--project y --number son requeridos")
+	}
+	data, err := callAPI(http.MethodPost, "/api/v1/blacklist", map[string]interface{}{
+		"proyecto_id": project,
+		"telefono":    number,
+		"razon":       getString(cmd, "reason"),
+	})
+	if err != nil {
+		fail(err)
+	}
+	printResult(data, fmt.Sprintf("Número %s agregado a la blacklist del proyecto %d.", number, project))
+}
+
+func runBlacklistImport(cmd *cobra.Command, args []string) {
+	project := getInt(cmd, "project")
+	file := getString(cmd, "file")
+	if project == 0 || file == "" {
+		usageError("--project y --file son requeridos")
+	}
+	data, err := uploadAPI("/api/v1/blacklist/upload", map[string]string{"proyecto_id": strconv.Itoa(project)}, "file", file)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
+		return
+	}
+
+	var out struct {
+		Imported int      `json:"imported"`
+		Total    int      `json:"total"`
+		Invalid  []string `json:"invalid"`
+	}
+	json.Unmarshal(data, &out)
+	fmt.Printf("Importados: %d de %d (los demás ya estaban en la blacklist).\n", out.Imported, out.Total)
+	if len(out.Invalid) > 0 {
+		fmt.Printf("Inválidos (%d): %s\n", len(out.Invalid), strings.Join(out.Invalid, ", "))
+	}
+}
+
+func runBlacklistClear(cmd *cobra.Command, args []string) {
+	project := getInt(cmd, "project")
+	if project == 0 {
+		usageError("--project es requerido")
+	}
+	// Borra toda la blacklist del proyecto: se confirma salvo con --yes (scripts)
+	if !getBool(cmd, "yes") {
+		answer := prompt(bufio.NewReader(os.Stdin), fmt.Sprintf("¿Eliminar toda la blacklist del proyecto %d? (s/N): ", project))
+		if a := strings.ToLower(answer); a != "s" && a != "si" && a != "sí" && a != "y" && a != "yes" {
+			usageError("operación cancelada (use --yes para no confirmar)")
+		}
+	}
+	data, err := callAPI(http.MethodDelete, fmt.Sprintf("/api/v1/blacklist/clear?proyecto_id=%d", project), nil)
+	if err != nil {
+		fail(err)
+	}
+	printResult(data, fmt.Sprintf("Blacklist del proyecto %d eliminada.", project))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func runLogsSearch(cmd *cobra.Command, args []string) {
+	q := url.Values{}
+	if v := getString(cmd, "number"); v != "" {
+		q.Set("telefono", v)
+	}
+	if v := getString(cmd, "uniqueid"); v != "" {
+		q.Set("uniqueid", v)
+	}
+	if q.Get("telefono") == "" && q.Get("uniqueid") == "" {
+		usageError("--number o --uniqueid es requerido")
+	}
+	if v := getInt(cmd, "project"); v != 0 {
+		q.Set("proyecto_id", strconv.Itoa(v))
+	}
+	if v := getInt(cmd, "campaign"); v != 0 {
+		if q.Get("proyecto_id") == "" {
+			usageError("--campaign requiere --project")
+		}
+		q.Set("campaign_id", strconv.Itoa(v))
+	}
+	if v := getString(cmd, "disposition"); v != "" {
+		q.Set("disposition", v)
+	}
+	if v := getString(cmd, "from"); v != "" {
+		q.Set("from_date", v)
+	}
+	if v := getString(cmd, "to"); v != "" {
+		q.Set("to_date", v)
+	}
+	q.Set("limit", strconv.Itoa(getInt(cmd, "limit")))
+
+	data, err := callAPI(http.MethodGet, "/api/v1/logs?"+q.Encode(), nil)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
+		return
+	}
+
+	var logs []struct {
+		ID          int64     `json:"id"`
+		ProyectoID  int       `json:"proyecto_id"`
+		Telefono    string    `json:"telefono"`
+		Status      string    `json:"status"`
+		Disposition string    `json:"disposition"`
+		Duracion    int       `json:"duracion"`
+		Timbrado    *int      `json:"segundos_timbrado"`
+		Conversa    *int      `json:"segundos_conversacion"`
+		Uniqueid    string    `json:"uniqueid"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+	json.Unmarshal(data, &logs)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tFECHA\tPROYECTO\tTELEFONO\tSTATUS\tDISPOSITION\tDURACION\tTIMBRADO\tCONVERSACION\tUNIQUEID")
+	fmt.Fprintln(w, "--\t-----\t--------\t--------\t------\t-----------\t--------\t--------\t------------\t--------")
+	for _, l := range logs {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%ds\t%s\t%s\t%s\n", l.ID, l.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			l.ProyectoID, l.Telefono, l.Status, l.Disposition, l.Duracion, secondsOrDash(l.Timbrado), secondsOrDash(l.Conversa), l.Uniqueid)
+	}
+	w.Flush()
+	fmt.Printf("\n%d llamadas.\n", len(logs))
+}
+
+// secondsOrDash muestra segundos medidos o "-" si la llamada no tiene el dato
+func secondsOrDash(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%ds", *v)
+}
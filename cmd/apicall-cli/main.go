@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"text/tabwriter"
 	"time"
 
@@ -19,12 +19,49 @@ var (
 
 func main() {
 	var rootCmd = &cobra.Command{
-		Use:   "apicall-cli",
-		Short: "CLI para administrar Apicall",
-		Long:  `Una herramienta de línea de comandos para gestionar el microservicio Apicall de forma remota.`,
+		Use:               "apicall-cli",
+		Short:             "CLI para administrar Apicall",
+		Long:              `Una herramienta de línea de comandos para gestionar el microservicio Apicall de forma remota.`,
+		PersistentPreRunE: resolveProfile,
 	}
 
-	rootCmd.PersistentFlags().StringVar(&apiHost, "host", "http://localhost:8080", "URL base de la API (ej: http://209.38.233.46:8080)")
+	rootCmd.PersistentFlags().StringVar(&apiHost, "host", defaultHost, "URL base de la API (ej: http://209.38.233.46:8080); por defecto la del perfil")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Perfil de ~/.apicall/config (por defecto APICALL_PROFILE o el último usado)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Formato de salida: table o json")
+
+	// === SESIÓN ===
+	var loginCmd = &cobra.Command{
+		Use:   "login",
+		Short: "Iniciar sesión y guardar el token en el perfil",
+		Run:   runLogin,
+	}
+	loginCmd.Flags().StringP("username", "u", "", "Usuario (si se omite se pregunta)")
+
+	var logoutCmd = &cobra.Command{
+		Use:   "logout",
+		Short: "Cerrar la sesión del perfil",
+		Run:   runLogout,
+	}
+
+	var profileCmd = &cobra.Command{
+		Use:   "profile",
+		Short: "Gestionar perfiles (host y sesión por servidor)",
+	}
+	profileCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Listar perfiles",
+		Run:   runProfileList,
+	}, &cobra.Command{
+		Use:   "use [nombre]",
+		Short: "Elegir el perfil por defecto",
+		Args:  cobra.ExactArgs(1),
+		Run:   runProfileUse,
+	}, &cobra.Command{
+		Use:   "delete [nombre]",
+		Short: "Eliminar un perfil",
+		Args:  cobra.ExactArgs(1),
+		Run:   runProfileDelete,
+	})
 
 	// === PROYECTOS ===
 	var projectCmd = &cobra.Command{
@@ -94,7 +131,149 @@ func main() {
 		Run:   runTrunkDelete,
 	}
 
-	trunkCmd.AddCommand(trunkListCmd, trunkAddCmd, trunkDeleteCmd)
+	var trunkTestCmd = &cobra.Command{
+		Use:   "test",
+		Short: "Llamada de prueba por una troncal (tono o eco, sin proyecto)",
+		Run:   runTrunkTest,
+	}
+	trunkTestCmd.Flags().Int("id", 0, "ID de la troncal (requerido)")
+	trunkTestCmd.Flags().String("number", "", "Número a marcar (requerido)")
+	trunkTestCmd.Flags().String("prefix", "", "Prefijo tecnológico")
+	trunkTestCmd.Flags().String("cid", "", "Caller ID (por defecto el de la troncal)")
+	trunkTestCmd.Flags().Bool("echo", false, "Eco en lugar de tono al contestar")
+	trunkTestCmd.Flags().Int("duration", 10, "Segundos de la llamada contestada")
+
+	trunkCmd.AddCommand(trunkListCmd, trunkAddCmd, trunkDeleteCmd, trunkTestCmd)
+
+	// === CAMPAÑAS ===
+	var campaignCmd = &cobra.Command{
+		Use:   "campaign",
+		Short: "Gestionar campañas",
+	}
+
+	var campaignListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Listar campañas",
+		Run:   runCampaignList,
+	}
+	campaignListCmd.Flags().Int("project", 0, "Filtrar por proyecto")
+
+	campaignCmd.AddCommand(campaignListCmd)
+	for _, action := range []struct{ name, short string }{
+		{"start", "Iniciar o reanudar una campaña"},
+		{"pause", "Pausar una campaña"},
+		{"stop", "Detener una campaña"},
+	} {
+		campaignCmd.AddCommand(&cobra.Command{
+			Use:   action.name + " [id]",
+			Short: action.short,
+			Args:  cobra.ExactArgs(1),
+			Run:   runCampaignAction,
+		})
+	}
+
+	// === BLACKLIST ===
+	var blacklistCmd = &cobra.Command{
+		Use:   "blacklist",
+		Short: "Gestionar la blacklist de un proyecto",
+	}
+
+	var blacklistListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Listar números bloqueados",
+		Run:   runBlacklistList,
+	}
+	blacklistListCmd.Flags().Int("project", 0, "ID del proyecto (requerido)")
+	blacklistListCmd.Flags().Int("limit", 100, "Cantidad máxima de números")
+
+	var blacklistAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Agregar un número",
+		Run:   runBlacklistAdd,
+	}
+	blacklistAddCmd.Flags().Int("project", 0, "ID del proyecto (requerido)")
+	blacklistAddCmd.Flags().String("number", "", "Teléfono (requerido)")
+	blacklistAddCmd.Flags().String("reason", "", "Razón del bloqueo")
+
+	var blacklistImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Importar números desde un CSV (primera columna, separado por ;)",
+		Run:   runBlacklistImport,
+	}
+	blacklistImportCmd.Flags().Int("project", 0, "ID del proyecto (requerido)")
+	blacklistImportCmd.Flags().String("file", "", "Archivo CSV (requerido)")
+
+	var blacklistClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Eliminar toda la blacklist del proyecto",
+		Run:   runBlacklistClear,
+	}
+	blacklistClearCmd.Flags().Int("project", 0, "ID del proyecto (requerido)")
+	blacklistClearCmd.Flags().Bool("yes", false, "No pedir confirmación")
+
+	blacklistCmd.AddCommand(blacklistListCmd, blacklistAddCmd, blacklistImportCmd, blacklistClearCmd)
+
+	// === AUDIOS ===
+	var audioCmd = &cobra.Command{
+		Use:   "audio",
+		Short: "Gestionar audios",
+	}
+
+	var audioListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Listar audios",
+		Run:   runAudioList,
+	}
+	audioListCmd.Flags().String("tag", "", "Filtrar por etiqueta")
+
+	var audioUploadCmd = &cobra.Command{
+		Use:   "upload [archivo]",
+		Short: "Subir un audio (se convierte al formato de Asterisk)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runAudioUpload,
+	}
+	audioUploadCmd.Flags().String("name", "", "Nombre del audio (por defecto el del archivo)")
+	audioUploadCmd.Flags().String("title", "", "Nombre descriptivo")
+	audioUploadCmd.Flags().String("tags", "", "Etiquetas separadas por coma")
+
+	var audioDeleteCmd = &cobra.Command{
+		Use:   "delete [nombre]",
+		Short: "Eliminar un audio (falla si un proyecto o encuesta lo usa)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runAudioDelete,
+	}
+
+	var audioPlayURLCmd = &cobra.Command{
+		Use:   "play-url [nombre]",
+		Short: "URL de reproducción del audio (requiere el token; --save lo descarga)",
+		Args:  cobra.ExactArgs(1),
+		Run:   runAudioPlayURL,
+	}
+	audioPlayURLCmd.Flags().String("save", "", "Descargar el audio a este archivo")
+
+	audioCmd.AddCommand(audioListCmd, audioUploadCmd, audioDeleteCmd, audioPlayURLCmd)
+
+	// === LOGS ===
+	var logsCmd = &cobra.Command{
+		Use:   "logs",
+		Short: "Consultar el historial de llamadas",
+	}
+
+	var logsSearchCmd = &cobra.Command{
+		Use:   "search",
+		Short: "Buscar llamadas por teléfono o uniqueid",
+		Run:   runLogsSearch,
+	}
+	logsSearchCmd.Flags().String("number", "", "Teléfono (se normaliza con el país del proyecto)")
+	logsSearchCmd.Flags().String("uniqueid", "", "Uniqueid de Asterisk")
+	logsSearchCmd.Flags().Int("project", 0, "Filtrar por proyecto")
+	logsSearchCmd.Flags().Int("campaign", 0, "Filtrar por campaña (requiere --project)")
+	logsSearchCmd.Flags().String("disposition", "", "Disposiciones separadas por coma (ej: ANSWER,BUSY)")
+	logsSearchCmd.Flags().String("from", "", "Desde (YYYY-MM-DD)")
+	logsSearchCmd.Flags().String("to", "", "Hasta, inclusive (YYYY-MM-DD)")
+	logsSearchCmd.Flags().Int("limit", 100, "Cantidad máxima de llamadas")
+
+	logsCmd.AddCommand(logsSearchCmd)
 
 	// === LLAMADAS ===
 	var callCmd = &cobra.Command{
@@ -106,32 +285,33 @@ func main() {
 	callCmd.Flags().String("number", "", "Número a marcar")
 
 	// === ROOT ===
-	rootCmd.AddCommand(projectCmd, trunkCmd, callCmd)
+	rootCmd.AddCommand(loginCmd, logoutCmd, profileCmd, projectCmd, trunkCmd, campaignCmd, blacklistCmd, audioCmd, logsCmd, callCmd)
 
+	// Errores de cobra (comando, flag o argumentos inválidos) y de configuración: cobra ya los informó
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		code := exitUsage
+		var ce *cliError
+		if errors.As(err, &ce) {
+			code = ce.code
+		}
+		os.Exit(code)
 	}
 }
 
 // --- HANDLERS ---
 
 func runProjectList(cmd *cobra.Command, args []string) {
-	url := fmt.Sprintf("%s/api/v1/proyectos", apiHost)
-	resp, err := http.Get(url)
+	data, err := callAPI(http.MethodGet, "/api/v1/proyectos", nil)
 	if err != nil {
-		fmt.Printf("Error conectando a API: %v\n", err)
-		return
+		fail(err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		fmt.Printf("Error API: %s\n", resp.Status)
+	if outputFormat == "json" {
+		printRaw(data)
 		return
 	}
 
 	var proyectos []map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&proyectos)
+	json.Unmarshal(data, &proyectos)
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 	fmt.Fprintln(w, "ID\tNOMBRE\tCID\tTRONCAL\tAMD")
@@ -145,10 +325,9 @@ func runProjectList(cmd *cobra.Command, args []string) {
 func runProjectAdd(cmd *cobra.Command, args []string) {
 	id, _ := cmd.Flags().GetInt("id")
 	nombre, _ := cmd.Flags().GetString("nombre")
-	
+
 	if id == 0 || nombre == "" {
-		fmt.Println("Error: --id y --nombre son requeridos")
-		return
+		usageError("--id y --nombre son requeridos")
 	}
 
 	body := map[string]interface{}{
@@ -163,41 +342,30 @@ func runProjectAdd(cmd *cobra.Command, args []string) {
 		"smart_active":   getBool(cmd, "smart-cid"),
 	}
 
-	sendPost(fmt.Sprintf("%s/api/v1/proyectos", apiHost), body)
+	sendPost("/api/v1/proyectos", body)
 }
 
 func runProjectDelete(cmd *cobra.Command, args []string) {
 	id := args[0]
-	url := fmt.Sprintf("%s/api/v1/proyectos/delete?id=%s", apiHost, id)
-	
-	req, _ := http.NewRequest("DELETE", url, nil)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	
+	data, err := callAPI(http.MethodDelete, "/api/v1/proyectos/delete?id="+id, nil)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode == 200 {
-		fmt.Printf("Proyecto %s eliminado.\n", id)
-	} else {
-		fmt.Printf("Error API: %s\n", resp.Status)
+		fail(err)
 	}
+	printResult(data, fmt.Sprintf("Proyecto %s eliminado.", id))
 }
 
 func runTrunkList(cmd *cobra.Command, args []string) {
-	url := fmt.Sprintf("%s/api/v1/troncales", apiHost)
-	resp, err := http.Get(url)
+	data, err := callAPI(http.MethodGet, "/api/v1/troncales", nil)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
 		return
 	}
-	defer resp.Body.Close()
 
 	var troncales []map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&troncales)
+	json.Unmarshal(data, &troncales)
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 	fmt.Fprintln(w, "ID\tNOMBRE\tHOST\tUSER")
@@ -218,25 +386,114 @@ func runTrunkAdd(cmd *cobra.Command, args []string) {
 		"contexto": getString(cmd, "context"),
 		"activo":   true,
 	}
-	sendPost(fmt.Sprintf("%s/api/v1/troncales", apiHost), body)
+	sendPost("/api/v1/troncales", body)
 }
 
 func runTrunkDelete(cmd *cobra.Command, args []string) {
 	id := args[0]
-	url := fmt.Sprintf("%s/api/v1/troncales/delete?id=%s", apiHost, id)
-	req, _ := http.NewRequest("DELETE", url, nil)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	data, err := callAPI(http.MethodDelete, "/api/v1/troncales/delete?id="+id, nil)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fail(err)
+	}
+	printResult(data, fmt.Sprintf("Troncal %s eliminada.", id))
+}
+
+func runTrunkTest(cmd *cobra.Command, args []string) {
+	id := getInt(cmd, "id")
+	number := getString(cmd, "number")
+	if id == 0 || number == "" {
+		usageError("--id y --number son requeridos")
+	}
+
+	mode := "tone"
+	if getBool(cmd, "echo") {
+		mode = "echo"
+	}
+	body := map[string]interface{}{
+		"troncal_id": id,
+		"numero":     number,
+		"prefijo":    getString(cmd, "prefix"),
+		"caller_id":  getString(cmd, "cid"),
+		"mode":       mode,
+		"duration":   getInt(cmd, "duration"),
+	}
+
+	fmt.Fprintf(os.Stderr, "Llamando a %s por la troncal %d (%s)...\n", number, id, mode)
+	data, err := callAPI(http.MethodPost, "/api/v1/troncales/test", body)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
 		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 200 {
-		fmt.Printf("Troncal %s eliminada.\n", id)
-	} else {
-		fmt.Printf("Error: %s\n", resp.Status)
+
+	var out struct {
+		Result struct {
+			Channel       string  `json:"channel"`
+			Result        string  `json:"result"`
+			Ringing       bool    `json:"ringing"`
+			Answered      bool    `json:"answered"`
+			RingSeconds   float64 `json:"ring_seconds"`
+			AnswerSeconds float64 `json:"answer_seconds"`
+			Duration      float64 `json:"duration"`
+			Cause         int     `json:"cause"`
+			CauseTxt      string  `json:"cause_txt"`
+		} `json:"result"`
 	}
+	json.Unmarshal(data, &out)
+	res := out.Result
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Resultado:\t%s\n", res.Result)
+	fmt.Fprintf(w, "Canal:\t%s\n", res.Channel)
+	fmt.Fprintf(w, "Timbró:\t%v (%.1fs)\n", res.Ringing, res.RingSeconds)
+	fmt.Fprintf(w, "Contestó:\t%v (%.1fs)\n", res.Answered, res.AnswerSeconds)
+	fmt.Fprintf(w, "Duración:\t%.1fs\n", res.Duration)
+	fmt.Fprintf(w, "Causa:\t%d %s\n", res.Cause, res.CauseTxt)
+	w.Flush()
+}
+
+func runCampaignList(cmd *cobra.Command, args []string) {
+	path := "/api/v1/campaigns"
+	if project := getInt(cmd, "project"); project != 0 {
+		path += fmt.Sprintf("?proyecto_id=%d", project)
+	}
+	data, err := callAPI(http.MethodGet, path, nil)
+	if err != nil {
+		fail(err)
+	}
+	if outputFormat == "json" {
+		printRaw(data)
+		return
+	}
+
+	var campaigns []map[string]interface{}
+	json.Unmarshal(data, &campaigns)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tNOMBRE\tPROYECTO\tESTADO\tPROCESADOS")
+	fmt.Fprintln(w, "--\t------\t--------\t------\t----------")
+	for _, c := range campaigns {
+		fmt.Fprintf(w, "%.0f\t%s\t%.0f\t%s\t%.0f/%.0f\n", c["id"], c["nombre"], c["proyecto_id"], c["estado"], c["contactos_procesados"], c["total_contactos"])
+	}
+	w.Flush()
+}
+
+// runCampaignAction ejecuta start, pause o stop (el nombre del comando es la acción)
+func runCampaignAction(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id <= 0 {
+		usageError("ID de campaña inválido: %s", args[0])
+	}
+	data, err := callAPI(http.MethodPost, "/api/v1/campaigns/action", map[string]interface{}{
+		"campaign_id": id,
+		"action":      cmd.Name(),
+	})
+	if err != nil {
+		fail(err)
+	}
+	printResult(data, fmt.Sprintf("Campaña %d: %s OK.", id, cmd.Name()))
 }
 
 func runCall(cmd *cobra.Command, args []string) {
@@ -244,18 +501,19 @@ func runCall(cmd *cobra.Command, args []string) {
 	number, _ := cmd.Flags().GetString("number")
 
 	if project == 0 || number == "" {
-		fmt.Println("Error: --project y --number son requeridos")
-		return
+		usageError("--project y --number son requeridos")
 	}
 
 	body := map[string]interface{}{
 		"proyecto_id": project,
 		"telefono":    number,
 	}
-	
+
 	start := time.Now()
-	sendPost(fmt.Sprintf("%s/api/v1/call", apiHost), body)
-	fmt.Printf("Tiempo: %v\n", time.Since(start))
+	sendPost("/api/v1/call", body)
+	if outputFormat != "json" {
+		fmt.Printf("Tiempo: %v\n", time.Since(start))
+	}
 }
 
 // Helpers
@@ -272,20 +530,16 @@ func getBool(cmd *cobra.Command, name string) bool {
 	return v
 }
 
-func sendPost(url string, data interface{}) {
-	payload, _ := json.Marshal(data)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+// sendPost envía el POST y muestra la respuesta (termina con el código de salida si falla)
+func sendPost(path string, data interface{}) {
+	body, err := callAPI(http.MethodPost, path, data)
 	if err != nil {
-		fmt.Printf("Error de conexión: %v\n", err)
-		return
+		fail(err)
 	}
-	defer resp.Body.Close()
-	
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		fmt.Println("Éxito!")
-		fmt.Println(string(body))
-	} else {
-		fmt.Printf("Error (%s): %s\n", resp.Status, string(body))
+	if outputFormat == "json" {
+		printRaw(body)
+		return
 	}
+	fmt.Println("Éxito!")
+	fmt.Println(string(body))
 }
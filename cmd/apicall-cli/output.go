@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Códigos de salida: permiten usar la CLI en scripts, cron y pipelines de CI
+const (
+	exitAPIError   = 1 // La API respondió con error
+	exitUsage      = 2 // Comando, flags o argumentos inválidos
+	exitConnection = 3 // No se pudo conectar con la API
+	exitAuth       = 4 // Sin sesión válida o sin permisos
+	exitNotFound   = 5 // El recurso no existe
+)
+
+// outputFormat es el formato de salida de los comandos: table (default) o json
+var outputFormat string
+
+// cliError es un error con el código de salida que le corresponde
+type cliError struct {
+	code int
+	msg  string
+}
+
+func (e *cliError) Error() string {
+	return e.msg
+}
+
+func newError(code int, format string, args ...interface{}) error {
+	return &cliError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// exitCodeForStatus traduce el código HTTP de una respuesta con error
+func exitCodeForStatus(status int) int {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return exitAuth
+	case http.StatusNotFound:
+		return exitNotFound
+	}
+	return exitAPIError
+}
+
+// fail informa el error en stderr (como JSON con --output json) y termina con su código de salida
+func fail(err error) {
+	code := exitAPIError
+	var ce *cliError
+	if errors.As(err, &ce) {
+		code = ce.code
+	}
+	if outputFormat == "json" {
+		json.NewEncoder(os.Stderr).Encode(map[string]interface{}{"error": err.Error(), "exit_code": code})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// usageError termina con exitUsage (flags requeridos que faltan o valores inválidos)
+func usageError(format string, args ...interface{}) {
+	fail(newError(exitUsage, format, args...))
+}
+
+// callAPI hace el request y devuelve el cuerpo si la respuesta es 2xx; si no, un error con su código de salida
+func callAPI(method, path string, body interface{}) ([]byte, error) {
+	resp, err := apiRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(resp)
+}
+
+// uploadAPI envía un archivo como multipart/form-data (campo fileField) junto con los campos de texto
+func uploadAPI(path string, fields map[string]string, fileField, filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, newError(exitUsage, "%v", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if v != "" {
+			mw.WriteField(k, v)
+		}
+	}
+	part, err := mw.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, newError(exitUsage, "error leyendo %s: %v", filePath, err)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := doRequest(http.MethodPost, path, &buf, mw.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	return readResponse(resp)
+}
+
+// readResponse lee la respuesta; las que no son 2xx se devuelven como error con su código de salida
+func readResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newError(exitConnection, "error leyendo la respuesta: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newError(exitCodeForStatus(resp.StatusCode), "%s: %s", resp.Status, apiMessage(data))
+	}
+	return data, nil
+}
+
+// apiMessage extrae el mensaje de una respuesta con error ({"error": "..."} o texto plano). Si la API
+// indica qué recursos impiden la operación (used_by), se agregan al mensaje.
+func apiMessage(data []byte) string {
+	var e struct {
+		Error  string `json:"error"`
+		UsedBy []struct {
+			Tipo   string `json:"tipo"`
+			ID     int    `json:"id"`
+			Nombre string `json:"nombre"`
+		} `json:"used_by"`
+	}
+	if json.Unmarshal(data, &e) == nil && e.Error != "" {
+		var refs []string
+		for _, ref := range e.UsedBy {
+			refs = append(refs, fmt.Sprintf("%s %d (%s)", ref.Tipo, ref.ID, ref.Nombre))
+		}
+		if len(refs) > 0 {
+			return e.Error + ": " + strings.Join(refs, ", ")
+		}
+		return e.Error
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// printRaw muestra la respuesta JSON de la API indentada
+func printRaw(data []byte) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(data), "", "  "); err != nil {
+		buf.Reset()
+		buf.Write(bytes.TrimSpace(data))
+	}
+	buf.WriteByte('\n')
+	os.Stdout.Write(buf.Bytes())
+}
+
+// printJSON muestra un valor como JSON indentado
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// printResult muestra el resultado de una acción: la respuesta de la API con --output json o el mensaje
+func printResult(data []byte, msg string) {
+	if outputFormat == "json" {
+		if len(bytes.TrimSpace(data)) == 0 {
+			printJSON(map[string]bool{"success": true})
+		} else {
+			printRaw(data)
+		}
+		return
+	}
+	fmt.Println(msg)
+}
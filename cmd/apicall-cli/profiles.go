@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultHost = "http://localhost:8080"
+	// refreshBefore renueva el token cuando le queda menos que esto (duran 24h)
+	refreshBefore = time.Hour
+)
+
+// cliConfig es ~/.apicall/config: perfiles con el host y el token de cada servidor
+type cliConfig struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*profile `yaml:"profiles"`
+}
+
+type profile struct {
+	Host     string `yaml:"host"`
+	Username string `yaml:"username,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+}
+
+var (
+	profileName string
+	cliCfg      *cliConfig
+	active      *profile
+	httpClient  = &http.Client{Timeout: 2 * time.Minute} // trunk test espera la llamada completa
+)
+
+func configPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".apicall", "config"), nil
+}
+
+func loadConfig() (*cliConfig, error) {
+	cfg := &cliConfig{Profiles: map[string]*profile{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*profile{}
+	}
+	return cfg, nil
+}
+
+// saveConfig guarda la configuración solo legible por el usuario (contiene tokens)
+func saveConfig() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(cliCfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// resolveProfile carga el perfil activo: --profile, APICALL_PROFILE, el último usado o "default".
+// --host tiene prioridad sobre el host del perfil.
+func resolveProfile(cmd *cobra.Command, args []string) error {
+	if outputFormat != "table" && outputFormat != "json" {
+		return newError(exitUsage, "--output debe ser table o json")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	cliCfg = cfg
+	if profileName == "" {
+		profileName = os.Getenv("APICALL_PROFILE")
+	}
+	if profileName == "" {
+		profileName = cfg.Current
+	}
+	if profileName == "" {
+		profileName = "default"
+	}
+	active = cfg.Profiles[profileName]
+	if active == nil {
+		active = &profile{Host: defaultHost}
+	}
+	if cmd.Flags().Changed("host") {
+		// Otro servidor: el token del perfil no sirve
+		if strings.TrimSuffix(apiHost, "/") != active.Host {
+			active = &profile{}
+		}
+	} else if active.Host != "" {
+		apiHost = active.Host
+	}
+	apiHost = strings.TrimSuffix(apiHost, "/")
+	return nil
+}
+
+// tokenExpiry lee el vencimiento del JWT (sin verificarlo: lo valida el servidor)
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// ensureToken renueva el token del perfil si está por vencer
+func ensureToken() error {
+	if active.Token == "" {
+		return nil
+	}
+	exp := tokenExpiry(active.Token)
+	if exp.IsZero() || time.Until(exp) > refreshBefore {
+		return nil
+	}
+	if time.Now().After(exp) {
+		return newError(exitAuth, "la sesión del perfil %s venció, ejecute: apicall-cli login --profile %s", profileName, profileName)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, apiHost+"/api/v1/sessions/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+active.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil // Sin conexión: el request original informa el error
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&out) != nil || out.Token == "" {
+		return nil // El token actual sigue valiendo hasta su vencimiento
+	}
+	active.Token = out.Token
+	if cliCfg.Profiles[profileName] == active {
+		if err := saveConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: no se pudo guardar el token renovado: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// apiRequest hace un request a la API con el token del perfil activo (body se envía como JSON)
+func apiRequest(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader, contentType = bytes.NewReader(payload), "application/json"
+	}
+	return doRequest(method, path, reader, contentType)
+}
+
+// doRequest envía el request con el token del perfil activo (renovándolo si está por vencer)
+func doRequest(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	if err := ensureToken(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, apiHost+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if active.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+active.Token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, newError(exitConnection, "error de conexión: %v", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && !strings.HasPrefix(path, "/api/v1/login") {
+		resp.Body.Close()
+		return nil, newError(exitAuth, "no hay una sesión válida en el perfil %s, ejecute: apicall-cli login", profileName)
+	}
+	return resp, nil
+}
+
+// --- LOGIN / PERFILES ---
+
+func runLogin(cmd *cobra.Command, args []string) {
+	in := bufio.NewReader(os.Stdin)
+	username := getString(cmd, "username")
+	if username == "" {
+		username = prompt(in, "Usuario: ")
+	}
+	password := os.Getenv("APICALL_PASSWORD")
+	if password == "" {
+		password = promptSecret(in, "Contraseña: ")
+	}
+
+	// El login no usa el token anterior del perfil
+	active = &profile{Host: apiHost}
+	var out struct {
+		Token              string `json:"token"`
+		MustChangePassword bool   `json:"must_change_password"`
+		MFARequired        bool   `json:"mfa_required"`
+		MFAToken           string `json:"mfa_token"`
+	}
+	postLogin("/api/v1/login", map[string]string{"username": username, "password": password}, &out)
+	if out.MFARequired {
+		code := prompt(in, "Código de verificación (o de recuperación): ")
+		postLogin("/api/v1/login/2fa", map[string]string{"mfa_token": out.MFAToken, "code": code}, &out)
+	}
+
+	cliCfg.Profiles[profileName] = &profile{Host: apiHost, Username: username, Token: out.Token}
+	cliCfg.Current = profileName
+	if err := saveConfig(); err != nil {
+		fail(fmt.Errorf("error guardando la sesión: %w", err))
+	}
+	if outputFormat == "json" {
+		printJSON(map[string]interface{}{
+			"profile": profileName, "host": apiHost, "username": username,
+			"expires_at": tokenExpiry(out.Token), "must_change_password": out.MustChangePassword,
+		})
+		return
+	}
+	fmt.Printf("Sesión iniciada en %s como %s (perfil %s).\n", apiHost, username, profileName)
+	if out.MustChangePassword {
+		fmt.Println("Debe cambiar la contraseña antes de continuar (desde la interfaz web).")
+	}
+}
+
+// postLogin envía un paso del login y decodifica la respuesta en out (termina si falla)
+func postLogin(path string, body, out interface{}) {
+	data, err := callAPI(http.MethodPost, path, body)
+	if err != nil {
+		fail(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		fail(fmt.Errorf("respuesta inválida: %w", err))
+	}
+}
+
+func runLogout(cmd *cobra.Command, args []string) {
+	if active.Token == "" {
+		printResult(nil, fmt.Sprintf("No hay sesión iniciada en el perfil %s.", profileName))
+		return
+	}
+	if _, err := callAPI(http.MethodPost, "/api/v1/logout", nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no se pudo cerrar la sesión en el servidor: %v\n", err)
+	}
+	active.Token = ""
+	if err := saveConfig(); err != nil {
+		fail(fmt.Errorf("error guardando configuración: %w", err))
+	}
+	printResult(nil, fmt.Sprintf("Sesión cerrada (perfil %s).", profileName))
+}
+
+func runProfileList(cmd *cobra.Command, args []string) {
+	names := make([]string, 0, len(cliCfg.Profiles))
+	for name := range cliCfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if outputFormat == "json" {
+		list := []map[string]interface{}{}
+		for _, name := range names {
+			p := cliCfg.Profiles[name]
+			item := map[string]interface{}{"name": name, "host": p.Host, "username": p.Username, "current": name == cliCfg.Current}
+			if p.Token != "" {
+				item["expires_at"] = tokenExpiry(p.Token)
+			}
+			list = append(list, item)
+		}
+		printJSON(list)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tPERFIL\tHOST\tUSUARIO\tSESIÓN")
+	fmt.Fprintln(w, "\t------\t----\t-------\t------")
+	for _, name := range names {
+		p := cliCfg.Profiles[name]
+		current := ""
+		if name == cliCfg.Current {
+			current = "*"
+		}
+		session := "-"
+		if p.Token != "" {
+			if exp := tokenExpiry(p.Token); exp.After(time.Now()) {
+				session = "vence " + exp.Format("2006-01-02 15:04")
+			} else {
+				session = "vencida"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", current, name, p.Host, p.Username, session)
+	}
+	w.Flush()
+}
+
+func runProfileUse(cmd *cobra.Command, args []string) {
+	if _, ok := cliCfg.Profiles[args[0]]; !ok {
+		fail(newError(exitNotFound, "el perfil %s no existe (se crea con: apicall-cli login --profile %s --host URL)", args[0], args[0]))
+	}
+	cliCfg.Current = args[0]
+	if err := saveConfig(); err != nil {
+		fail(fmt.Errorf("error guardando configuración: %w", err))
+	}
+	printResult(nil, fmt.Sprintf("Perfil activo: %s", args[0]))
+}
+
+func runProfileDelete(cmd *cobra.Command, args []string) {
+	if _, ok := cliCfg.Profiles[args[0]]; !ok {
+		fail(newError(exitNotFound, "el perfil %s no existe", args[0]))
+	}
+	delete(cliCfg.Profiles, args[0])
+	if cliCfg.Current == args[0] {
+		cliCfg.Current = ""
+	}
+	if err := saveConfig(); err != nil {
+		fail(fmt.Errorf("error guardando configuración: %w", err))
+	}
+	printResult(nil, fmt.Sprintf("Perfil %s eliminado.", args[0]))
+}
+
+// prompt pregunta en stderr, así la salida (--output json) queda limpia
+func prompt(in *bufio.Reader, label string) string {
+	fmt.Fprint(os.Stderr, label)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// promptSecret lee la contraseña sin mostrarla en la terminal (stty; si no está disponible se ve al escribir)
+func promptSecret(in *bufio.Reader, label string) string {
+	stty := func(arg string) error {
+		c := exec.Command("stty", arg)
+		c.Stdin = os.Stdin
+		return c.Run()
+	}
+	hidden := stty("-echo") == nil
+	value := prompt(in, label)
+	if hidden {
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+	}
+	return value
+}
@@ -6,19 +6,36 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"text/tabwriter"
 
+	"apicall/internal/alerts"
 	"apicall/internal/ami"
 	"apicall/internal/api"
+	"apicall/internal/ari"
 	"apicall/internal/asterisk"
+	"apicall/internal/blacklist"
+	"apicall/internal/callback"
 	"apicall/internal/campaign"
 	"apicall/internal/config"
 	"apicall/internal/database"
 	"apicall/internal/dialer"
+	"apicall/internal/eventbus"
 	"apicall/internal/fastagi"
+	"apicall/internal/importer"
+	"apicall/internal/leader"
+	"apicall/internal/logging"
+	"apicall/internal/mailer"
+	"apicall/internal/notify"
 	"apicall/internal/provisioning"
+	"apicall/internal/reports"
+	"apicall/internal/reputation"
+	"apicall/internal/retention"
+	"apicall/internal/secrets"
 	"apicall/internal/smartcid"
+	"apicall/internal/webhook"
+	ws "apicall/internal/websocket"
 )
 
 const defaultConfigPath = "/etc/apicall/apicall.yaml"
@@ -40,6 +57,8 @@ func main() {
 		cmdStatus()
 	case "troncal":
 		cmdTroncal()
+	case "provision":
+		cmdProvision()
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -60,6 +79,7 @@ func printUsage() {
 	fmt.Println("  apicall troncal add <args>       Crea una nueva troncal SIP")
 	fmt.Println("  apicall troncal list             Lista las troncales SIP")
 	fmt.Println("  apicall troncal delete <id>      Elimina una troncal")
+	fmt.Println("  apicall provision plan           Muestra los cambios del auto-aprovisionamiento sin aplicarlos")
 	fmt.Println("  apicall status                   Muestra estado del servicio")
 	fmt.Println()
 }
@@ -79,6 +99,13 @@ func cmdStart() {
 	if err != nil {
 		log.Fatalf("[Main] Error cargando configuración: %v", err)
 	}
+	logging.SetLevel(cfg.Log.Level)
+	if err := secrets.Configure(cfg.Security); err != nil {
+		log.Fatalf("[Main] Error cargando clave de cifrado: %v", err)
+	}
+	if cfg.IsContainer() {
+		log.Printf("[Main] Modo container: Asterisk y BD remotos, sin aprovisionamiento (spool: %s)", cfg.Asterisk.SpoolTransport())
+	}
 
 	// Auto-provisioning (Ensure DB and Asterisk exist)
 	provisioning.EnsureInfrastructure(cfg)
@@ -93,58 +120,107 @@ func cmdStart() {
 	repo := database.NewRepository(dbConn)
 	log.Println("[Main] ✓ Base de datos conectada")
 
-	// Iniciar cliente AMI
-	amiClient := ami.NewClient(&cfg.AMI)
-	if err := amiClient.Connect(); err != nil {
-		log.Fatalf("[Main] Error conectando AMI: %v", err)
+	// Journal del batcher de logs: sin él, las actualizaciones que no entran en el buffer se pierden
+	if path := cfg.Database.JournalPath(); path != "" {
+		if err := repo.EnableLogJournal(path); err != nil {
+			log.Printf("[Main] WARNING: No se pudo abrir el journal del batcher (%s): %v", path, err)
+		}
+	}
+
+	// Secretos SIP de las troncales cifrados en reposo
+	if !secrets.Enabled() {
+		log.Println("[Main] WARNING: security.secrets_key no configurada, los secretos SIP de las troncales se guardan en texto plano")
+	} else if n, err := repo.EncryptTroncalSecrets(); err != nil {
+		log.Printf("[Main] WARNING: No se pudieron cifrar los secretos de troncales: %v", err)
+	} else if n > 0 {
+		log.Printf("[Main] ✓ %d secretos de troncales cifrados", n)
+	}
+
+	// Prompts de sistema del IVR (opcion_invalida, en_breve) para los idiomas en uso
+	if missing, err := provisioning.VerifyPrompts(repo, cfg.Asterisk.SoundPath); err != nil {
+		log.Printf("[Main] WARNING: No se pudieron verificar los prompts de sistema: %v", err)
+	} else if len(missing) > 0 {
+		log.Printf("[Main] WARNING: Faltan prompts de sistema del IVR en %s: %s", cfg.Asterisk.SoundPath, strings.Join(missing, ", "))
+	}
+
+	// Elección de líder: con varias instancias sobre la misma BD solo una corre los workers exclusivos
+	if cfg.HA.Enabled {
+		elector := leader.NewElector(repo, cfg.HA)
+		elector.Start()
+		defer elector.Stop()
+		log.Println("[Main] ✓ Elección de líder iniciada")
+	}
+
+	// Iniciar clientes AMI: nodo principal (ami) + asterisk_nodes.
+	// Los nodos caídos al arrancar se reconectan en segundo plano; sin ninguno no se puede marcar.
+	var nodes []*dialer.Node
+	connected := 0
+	for _, nodeCfg := range cfg.AsteriskNodes() {
+		client := ami.NewClient(&nodeCfg)
+		if err := client.Connect(); err != nil {
+			log.Printf("[Main] WARNING: Nodo Asterisk %s (%s) no disponible: %v", nodeCfg.Name, nodeCfg.Address(), err)
+			client.ConnectInBackground()
+		} else {
+			connected++
+		}
+		defer client.Close()
+		nodes = append(nodes, &dialer.Node{
+			Name:        nodeCfg.Name,
+			Client:      client,
+			AGIURL:      nodeCfg.AGIURL,
+			MaxChannels: nodeCfg.MaxChannels,
+		})
+	}
+	if connected == 0 {
+		if !cfg.Simulation.Enabled || !cfg.Simulation.All {
+			log.Fatalf("[Main] Error conectando AMI: ningún nodo Asterisk disponible")
+		}
+		log.Println("[Main] WARNING: Sin nodos Asterisk conectados; todas las llamadas se simulan (simulation.all)")
 	}
-	defer amiClient.Close()
-	log.Println("[Main] ✓ Cliente AMI conectado")
+	amiClient := nodes[0].Client
+	log.Printf("[Main] ✓ Cliente AMI conectado (%d/%d nodos)", connected, len(nodes))
 
 	// Inicializar Core Dialer Components
 	// ----------------------------------
 	
 	// 1. Channel Pool (Límites)
-	maxChannels := 50
-	maxPerTrunk := 20
-	if val, err := repo.GetConfig("max_channels"); err == nil && val != "" {
-		if v, err := strconv.Atoi(val); err == nil && v > 0 {
-			maxChannels = v
-		}
-	}
-	if val, err := repo.GetConfig("max_per_trunk"); err == nil && val != "" {
-		if v, err := strconv.Atoi(val); err == nil && v > 0 {
-			maxPerTrunk = v
-		}
-	}
+	maxChannels, maxPerTrunk := resolvePoolLimits(cfg, repo)
 	pool := dialer.NewChannelPool(maxChannels, maxPerTrunk)
 	log.Printf("[Main] Channel Pool initialized (Global: %d, Trunk: %d)", maxChannels, maxPerTrunk)
 
 	// 2. Active Call Tracker (Memoria)
 	tracker := dialer.NewActiveCallTracker()
 
-	// 3. Call Manager (Adapter for AMI Handler)
-	callManager := dialer.NewCallManager(pool, tracker)
-
-	// 4. AMI Dialer (Synchronous Originate)
-	amiDialer := dialer.NewAMIDialer(amiClient, pool, tracker, repo)
-	
-	// Configure Smart Caller ID Generator
+	// 3. Pipeline de pre-marcación compartido por AMIDialer y spooler
+	// (blacklist, audio, troncal, Caller ID, límites, log y tracking)
+	preDial := dialer.NewPreDial(repo, pool, tracker)
+	preDial.SetSoundPath(cfg.Asterisk.SoundPath)
+	// Call Manager: único camino de liberación de slots (AMI handlers, motores y Reconciler)
+	callManager := preDial.Calls()
 	if dbConn.DB != nil {
-		scidGen := smartcid.NewGenerator(dbConn.DB)
-		amiDialer.SetSmartCIDGenerator(scidGen)
+		preDial.SetSmartCIDGenerator(smartcid.NewGenerator(dbConn.DB))
 	}
+
+	// 4. AMI Dialer (Synchronous Originate), repartido entre los nodos Asterisk
+	nodeSet := dialer.NewNodeSet(tracker, nodes...)
+	amiDialer := dialer.NewAMIDialer(nodeSet, preDial)
 	
 	amiDialer.Start() // Inicia listener de eventos
 	defer amiDialer.Stop()
 
-	// Iniciar AMI Call Status Handler (Tracking & Release)
+	// Iniciar AMI Call Status Handler (Tracking & Release), uno por nodo
 	// Usamos callManager que implementa la interfaz requerida
-	amiHandler := ami.NewCallStatusHandler(amiClient, repo, callManager)
-	amiHandler.Start()
-	defer amiHandler.Stop()
+	for _, node := range nodes {
+		amiHandler := ami.NewCallStatusHandler(node.Client, repo, callManager)
+		amiHandler.Start()
+		defer amiHandler.Stop()
+	}
 	log.Println("[Main] ✓ AMI Call Status Handler iniciado")
 
+	// Llamadas que siguieron en curso durante el reinicio: vuelven al tracker y al pool antes de
+	// que el spooler y el Sweeper marquen (con los handlers ya escuchando sus Hangup)
+	dialer.RecoverCalls(repo, callManager, nodes)
+
 	// Iniciar servidor FastAGI
 	agiServer := fastagi.NewServer(cfg, repo)
 	if err := agiServer.Start(); err != nil {
@@ -152,12 +228,129 @@ func cmdStart() {
 	}
 	log.Println("[Main] ✓ Servidor FastAGI iniciado")
 
+	// Motor ARI (dial_engine=ari): originate e IVR desde la aplicación Stasis
+	var ariEngine *ari.Engine
+	if cfg.ARI.Enabled {
+		ariEngine = ari.NewEngine(cfg, repo, preDial)
+		ariEngine.Start()
+		defer ariEngine.Stop()
+		asterisk.SetARIDialer(ariEngine)
+		log.Println("[Main] ✓ Motor ARI iniciado")
+	}
+
+	// Motor de simulación (dial_engine=sim o simulation.all): pruebas de carga sin Asterisk
+	var simulator *dialer.Simulator
+	if cfg.Simulation.Enabled {
+		simulator = dialer.NewSimulator(cfg.Simulation, repo, preDial)
+		defer simulator.Stop()
+		asterisk.SetSimDialer(simulator, cfg.Simulation.All)
+		if cfg.Simulation.All {
+			log.Println("[Main] WARNING: Motor de simulación activo para TODAS las llamadas (simulation.all)")
+		} else {
+			log.Println("[Main] ✓ Motor de simulación iniciado (dial_engine=sim)")
+		}
+	}
+
 	// Iniciar Worker de Spool (Legacy/Manual Calls)
-	asterisk.StartWorker(cfg.Asterisk.MaxCPS, repo, pool, tracker)
+	// Entrega de .call files: local, SFTP a un Asterisk remoto, o sin spool (la cola y el CPS se
+	// mantienen, pero se origina por AMI)
+	switch cfg.Asterisk.SpoolTransport() {
+	case config.SpoolAMI:
+		asterisk.DisableCallFiles()
+	case config.SpoolSFTP:
+		sftpTransport, err := asterisk.NewSFTPTransport(cfg.Asterisk.Spool)
+		if err != nil {
+			log.Fatalf("[Main] Error configurando spool SFTP: %v", err)
+		}
+		if err := sftpTransport.Ping(); err != nil {
+			log.Printf("[Main] WARNING: Spool SFTP no disponible (se reintenta en cada llamada): %v", err)
+		}
+		defer sftpTransport.Close()
+		asterisk.SetSpoolTransport(sftpTransport)
+	}
+	asterisk.StartWorker(cfg.Asterisk.MaxCPS, repo, preDial, amiDialer)
 	log.Println("[Main] ✓ Worker de Asterisk iniciado")
 
+	// Topes de campañas activas simultáneas (API al iniciar, Sweeper al marcar)
+	activeLimiter := campaign.NewActiveLimiter(activeLimits(cfg))
+
+	// Canales de chat por proyecto (Slack, Telegram) para eventos de campaña y alertas
+	notifier := notify.NewDispatcher(repo)
+
+	// Broker de eventos (Redis Streams, NATS o RabbitMQ) para sistemas que consumen llamadas y campañas
+	eventBus, err := eventbus.New(repo, cfg.EventBus)
+	if err != nil {
+		log.Fatalf("[Main] %v", err)
+	}
+	if eventBus != nil {
+		eventBus.Start()
+		defer eventBus.Stop()
+	}
+
+	// Monitor de alertas operativas (troncales, BD, ASR de campañas, cola del spool)
+	smtpMailer := mailer.New(cfg.SMTP)
+	alertMonitor := alerts.NewMonitor(repo, cfg.Alerts)
+	alertMonitor.SetMailer(smtpMailer)
+	alertMonitor.SetNotifier(notifier)
+	alertMonitor.SetPeersFunc(nodeSet.Peers)
+	alertMonitor.Start()
+	defer alertMonitor.Stop()
+
 	// Iniciar API REST
 	apiServer := api.NewServer(cfg, repo, amiClient)
+	apiServer.SetActiveLimiter(activeLimiter)
+	apiServer.SetNotifier(notifier)
+	apiServer.SetEventBus(eventBus)
+
+	// Recarga de configuración en caliente (SIGHUP o POST /api/v1/config/reload)
+	// Solo aplica valores seguros: CPS, límites del pool, AMD y nivel de log.
+	// Las llamadas activas no se tocan.
+	reloadConfig := func() error {
+		newCfg, err := config.Load(configPath)
+		if err != nil {
+			return err
+		}
+
+		logging.SetLevel(newCfg.Log.Level)
+		asterisk.SetMaxCPS(newCfg.Asterisk.MaxCPS)
+
+		maxChannels, maxPerTrunk := resolvePoolLimits(newCfg, repo)
+		pool.SetMaxGlobal(maxChannels)
+		pool.SetMaxPerTrunk(maxPerTrunk)
+
+		agiServer.SetConfig(newCfg)
+		activeLimiter.Set(activeLimits(newCfg))
+		alertMonitor.SetConfig(newCfg.Alerts)
+
+		log.Printf("[Main] Configuración recargada desde %s (log=%s, max_cps=%d, canales=%d/%d)",
+			configPath, logging.Level(), newCfg.Asterisk.MaxCPS, maxChannels, maxPerTrunk)
+		return nil
+	}
+	apiServer.SetReloadFunc(reloadConfig)
+	apiServer.SetAGIStatsFunc(agiServer.Stats)
+	apiServer.SetNodeStatsFunc(nodeSet.Stats)
+	apiServer.SetPoolStatsFunc(pool.Stats)
+	apiServer.SetPeersFunc(nodeSet.Peers)
+	apiServer.SetSpyFunc(nodeSet.Spy)
+	if ariEngine != nil {
+		apiServer.AddReadinessCheck("ari", func() error {
+			if !ariEngine.Connected() {
+				return ari.ErrNotConnected
+			}
+			return nil
+		})
+	}
+	apiServer.AddReadinessWarning("prompts", func() error {
+		missing, err := provisioning.VerifyPrompts(repo, cfg.Asterisk.SoundPath)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("faltan %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.Fatalf("[Main] Error iniciando API: %v", err)
@@ -166,18 +359,92 @@ func cmdStart() {
 
 	log.Println("[Main] ✓ Servidor API REST iniciado")
 
+	// Iniciar broadcast de llamadas activas por campaña y troncal (gauges del dashboard)
+	activeCalls := ws.NewActiveCallsBroadcaster(tracker)
+	activeCalls.Start()
+	defer activeCalls.Stop()
+	log.Println("[Main] ✓ Active Calls Broadcast iniciado")
+
+	// Iniciar Evaluador de reglas de blacklist (bloqueo automático según el resultado de las llamadas)
+	blacklistRules := blacklist.NewEvaluator(repo)
+	blacklistRules.Start()
+	defer blacklistRules.Stop()
+	log.Println("[Main] ✓ Blacklist Rules Evaluator iniciado")
+
+	// Blacklists cargadas antes de configurar el país del proyecto: al formato con el que se marca
+	go blacklist.NormalizeAll(repo)
+
 	// Iniciar Campaign Sweeper Worker
 	// Ahora usa AMIDialer directamente
 	sweeper := campaign.NewSweeper(repo, amiDialer)
+	sweeper.SetActiveLimiter(activeLimiter)
+	sweeper.SetNotifier(notifier)
+	sweeper.SetEventBus(eventBus)
+	if ariEngine != nil {
+		sweeper.SetARIDialer(ariEngine)
+	}
+	if simulator != nil {
+		sweeper.SetSimDialer(simulator, cfg.Simulation.All)
+	}
+	if smtpMailer != nil {
+		sweeper.SetMailer(smtpMailer)
+		log.Printf("[Main] ✓ Resumen de campañas por email vía %s", cfg.SMTP.Addr())
+	}
 	sweeper.Start()
 	defer sweeper.Stop()
 	log.Println("[Main] ✓ Campaign Sweeper iniciado")
 
-	// Iniciar Orphan Call Cleaner (limpia llamadas huérfanas en DIALING)
-	orphanCleaner := database.NewOrphanCallCleaner(repo)
-	orphanCleaner.Start()
-	defer orphanCleaner.Stop()
-	log.Println("[Main] ✓ Orphan Call Cleaner iniciado")
+	// Iniciar Worker de Importación (uploads de contactos en segundo plano)
+	importWorker := importer.NewWorker(repo)
+	importWorker.Start()
+	defer importWorker.Stop()
+	log.Println("[Main] ✓ Import Worker iniciado")
+
+	// Orígenes HTTP de contactos (CRM) con consulta periódica
+	sourceScheduler := importer.NewSourceScheduler(repo)
+	sourceScheduler.Start()
+	defer sourceScheduler.Stop()
+
+	// Iniciar Notificador de resultados (result_url por campaña)
+	resultNotifier := webhook.NewNotifier(repo)
+	resultNotifier.Start()
+	defer resultNotifier.Stop()
+	log.Println("[Main] ✓ Result Notifier iniciado")
+
+	// Iniciar Scheduler de rellamadas (solicitadas desde el IVR)
+	callbackScheduler := callback.NewScheduler(repo)
+	callbackScheduler.Start()
+	defer callbackScheduler.Stop()
+	log.Println("[Main] ✓ Callback Scheduler iniciado")
+
+	// Iniciar Agregador de reportes (rollups horarios del log de llamadas)
+	reportAggregator := reports.NewAggregator(repo)
+	reportAggregator.Start()
+	defer reportAggregator.Stop()
+	log.Println("[Main] ✓ Report Aggregator iniciado")
+
+	// Iniciar Worker de retención (purga/archivado según retention_days de cada proyecto)
+	retentionWorker := retention.NewWorker(repo, cfg.Retention)
+	retentionWorker.Start()
+	defer retentionWorker.Stop()
+	log.Println("[Main] ✓ Retention Worker iniciado")
+
+	// Iniciar consultas de reputación de Caller IDs (reputation.provider vacío = desactivadas)
+	reputationChecker, err := reputation.New(repo, cfg.Reputation)
+	if err != nil {
+		log.Fatalf("[Main] %v", err)
+	}
+	if reputationChecker != nil {
+		reputationChecker.Start()
+		defer reputationChecker.Stop()
+		log.Println("[Main] ✓ Reputation Checker iniciado")
+	}
+
+	// Iniciar Reconciler (llamadas sin resultado final: tracker, logs DIALING y contactos en dialing)
+	reconciler := dialer.NewReconciler(repo, callManager)
+	reconciler.Start()
+	defer reconciler.Stop()
+	log.Println("[Main] ✓ Reconciler iniciado")
 
 	log.Println("[Main] ========================================")
 	log.Printf("[Main] FastAGI escuchando en %s", cfg.FastAGI.Address())
@@ -186,15 +453,56 @@ func cmdStart() {
 	log.Println("[Main] Presiona Ctrl+C para detener")
 	log.Println("[Main] ========================================")
 
-	// Esperar señal de terminación
+	// Esperar señal de terminación (SIGHUP recarga configuración)
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			log.Println("[Main] SIGHUP recibido, recargando configuración...")
+			if err := reloadConfig(); err != nil {
+				log.Printf("[Main] Error recargando configuración: %v", err)
+			}
+			continue
+		}
+		break
+	}
 
 	log.Println("[Main] Deteniendo servicio...")
 	repo.Close()
 }
 
+// activeLimits toma de la configuración los topes de campañas activas simultáneas
+func activeLimits(cfg *config.Config) campaign.ActiveLimits {
+	return campaign.ActiveLimits{
+		Global:      cfg.Campaigns.MaxActive,
+		PerProyecto: cfg.Campaigns.MaxActivePerProyecto,
+	}
+}
+
+// resolvePoolLimits determina los límites del Channel Pool.
+// Prioridad: apicall_config (DB) > YAML > valores por defecto.
+func resolvePoolLimits(cfg *config.Config, repo *database.Repository) (int, int) {
+	maxChannels := 50
+	maxPerTrunk := 20
+	if cfg.Asterisk.MaxChannels > 0 {
+		maxChannels = cfg.Asterisk.MaxChannels
+	}
+	if cfg.Asterisk.MaxPerTrunk > 0 {
+		maxPerTrunk = cfg.Asterisk.MaxPerTrunk
+	}
+	if val, err := repo.GetConfig("max_channels"); err == nil && val != "" {
+		if v, err := strconv.Atoi(val); err == nil && v > 0 {
+			maxChannels = v
+		}
+	}
+	if val, err := repo.GetConfig("max_per_trunk"); err == nil && val != "" {
+		if v, err := strconv.Atoi(val); err == nil && v > 0 {
+			maxPerTrunk = v
+		}
+	}
+	return maxChannels, maxPerTrunk
+}
+
 // cmdProyecto gestiona proyectos
 func cmdProyecto() {
 	if len(os.Args) < 3 {
@@ -354,6 +662,32 @@ func cmdStatus() {
 	fmt.Println("  curl http://localhost:8080/health")
 }
 
+// cmdProvision muestra el plan de auto-aprovisionamiento sin tocar el servidor
+func cmdProvision() {
+	if len(os.Args) < 3 || os.Args[2] != "plan" {
+		fmt.Println("Uso:")
+		fmt.Println("  apicall provision plan")
+		os.Exit(1)
+	}
+
+	configPath := os.Getenv("APICALL_CONFIG")
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Error config: %v", err)
+	}
+
+	if !cfg.Provisioning.IsEnabled() {
+		fmt.Println("Aprovisionamiento deshabilitado (provisioning.enabled=false): no se aplicaría ningún cambio.")
+		return
+	}
+	fmt.Printf("Plan de aprovisionamiento (manage_asterisk=%v, manage_db=%v, dry_run=%v):\n",
+		cfg.Provisioning.AsteriskManaged(), cfg.Provisioning.DBManaged(), cfg.Provisioning.DryRun)
+	fmt.Print(provisioning.BuildPlan(cfg).String())
+}
+
 // cmdTroncal gestiona troncales
 func cmdTroncal() {
 	if len(os.Args) < 3 {
@@ -375,12 +709,16 @@ func cmdTroncal() {
 	if err != nil {
 		log.Fatalf("Error config: %v", err)
 	}
+	if err := secrets.Configure(cfg.Security); err != nil {
+		log.Fatalf("Error clave de cifrado: %v", err)
+	}
 	dbConn, err := database.NewConnection(cfg.Database)
 	if err != nil {
 		log.Fatalf("Error DB: %v", err)
 	}
 	defer dbConn.Close()
 	repo := database.NewRepository(dbConn)
+	provisioning.Configure(cfg.Provisioning)
 
 	switch subcommand {
 	case "add":
@@ -0,0 +1,549 @@
+// Package alerts evalúa periódicamente reglas operativas (troncal caída, BD inaccesible, ASR bajo
+// en una campaña, cola del spool saturada, Caller ID en cuarentena). Cada alerta se registra en apicall_alerts al abrirse,
+// se resuelve cuando la condición deja de cumplirse y se notifica por email en ambos casos.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/asterisk"
+	"apicall/internal/config"
+	"apicall/internal/database"
+	"apicall/internal/dialer"
+	"apicall/internal/leader"
+	"apicall/internal/mailer"
+	"apicall/internal/notify"
+)
+
+const (
+	// DefaultInterval es cada cuánto se evalúan las reglas si alerts.interval no se define
+	DefaultInterval = 60 * time.Second
+	// DefaultAnswerRateWindow son las llamadas evaluadas si alerts.answer_rate_window no se define
+	DefaultAnswerRateWindow = 200
+	// DefaultCIDWindow son los minutos evaluados por Caller ID si alerts.cid_window no se define
+	DefaultCIDWindow = 60
+	// DefaultCIDMinCalls son las llamadas mínimas para evaluar un Caller ID si alerts.cid_min_calls no se define
+	DefaultCIDMinCalls = 50
+
+	dbTimeout    = 3 * time.Second
+	peersTimeout = 5 * time.Second
+)
+
+// condition es una regla que se cumple para un objeto (troncal, campaña, cola)
+type condition struct {
+	tenantID int
+	mensaje  string
+}
+
+// Monitor evalúa las reglas de alerta. La BD se verifica en cada instancia (en HA sin BD no hay
+// líder); el resto de las reglas solo en la líder.
+type Monitor struct {
+	repo     *database.Repository
+	mailer   *mailer.Mailer                                 // nil = las alertas solo se registran
+	peers    func(timeout time.Duration) []dialer.NodePeers // Peers SIP de cada nodo (troncal caída)
+	notifier *notify.Dispatcher                             // Canales de chat de los proyectos afectados
+	cfg      config.AlertsConfig
+	dbDown   *database.Alert // Caída de la BD en curso: se registra al volver la conexión
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewMonitor crea el monitor de alertas
+func NewMonitor(repo *database.Repository, cfg config.AlertsConfig) *Monitor {
+	return &Monitor{
+		repo:     repo,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// SetMailer registra el servidor SMTP por el que se notifican las alertas
+func (m *Monitor) SetMailer(ml *mailer.Mailer) {
+	m.mailer = ml
+}
+
+// SetPeersFunc registra la fuente del estado de las troncales en los nodos Asterisk
+func (m *Monitor) SetPeersFunc(fn func(timeout time.Duration) []dialer.NodePeers) {
+	m.peers = fn
+}
+
+// SetNotifier registra los canales de chat a los que se envían las alertas de troncales y campañas
+func (m *Monitor) SetNotifier(d *notify.Dispatcher) {
+	m.notifier = d
+}
+
+// SetConfig reemplaza las reglas (recarga de configuración)
+func (m *Monitor) SetConfig(cfg config.AlertsConfig) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.mu.Unlock()
+}
+
+func (m *Monitor) config() config.AlertsConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg
+}
+
+// Start inicia el monitor
+func (m *Monitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return
+	}
+	m.running = true
+	m.wg.Add(1)
+	go m.run()
+	log.Println("[Alerts] Monitor de alertas iniciado")
+}
+
+// Stop detiene el monitor
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	m.mu.Unlock()
+
+	close(m.stopChan)
+	m.wg.Wait()
+	log.Println("[Alerts] Monitor de alertas detenido")
+}
+
+func (m *Monitor) run() {
+	defer m.wg.Done()
+
+	// El intervalo se relee en cada pasada para aplicar la recarga de configuración
+	timer := time.NewTimer(interval(m.config()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-timer.C:
+			m.evaluate()
+			timer.Reset(interval(m.config()))
+		}
+	}
+}
+
+func interval(cfg config.AlertsConfig) time.Duration {
+	if cfg.Interval <= 0 {
+		return DefaultInterval
+	}
+	return time.Duration(cfg.Interval) * time.Second
+}
+
+// evaluate aplica las reglas habilitadas y abre o resuelve las alertas correspondientes
+func (m *Monitor) evaluate() {
+	cfg := m.config()
+	if !cfg.Enabled {
+		return
+	}
+	if !m.checkDB(cfg) || !leader.IsLeader() {
+		return
+	}
+
+	active, err := m.repo.GetActiveAlerts()
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return
+	}
+	open := make(map[string]database.Alert, len(active))
+	for _, a := range active {
+		open[a.Tipo+"|"+a.Clave] = a
+	}
+
+	if cfg.TrunkDown && m.peers != nil {
+		if firing, ok := m.trunksDown(); ok {
+			m.apply(cfg, database.AlertTrunkDown, firing, open)
+		}
+	}
+	if cfg.MinAnswerRate > 0 {
+		if firing, ok := m.lowAnswerRate(cfg); ok {
+			m.apply(cfg, database.AlertLowAnswerRate, firing, open)
+		}
+	}
+	if cfg.SpoolSaturation > 0 {
+		m.apply(cfg, database.AlertSpoolSaturation, spoolSaturated(cfg), open)
+	}
+	if cfg.CIDMinAnswerRate > 0 || cfg.CIDAnswerDrop > 0 {
+		m.quarantineCIDs(cfg)
+	}
+	// La alerta sigue abierta mientras el Caller ID no se libere (aunque la regla se desactive)
+	if firing, ok := m.quarantinedCIDs(); ok {
+		m.apply(cfg, database.AlertCIDQuarantined, firing, open)
+	}
+}
+
+// apply abre las alertas de tipo que empiezan a cumplirse y resuelve las abiertas que ya no se cumplen
+func (m *Monitor) apply(cfg config.AlertsConfig, tipo string, firing map[string]condition, open map[string]database.Alert) {
+	now := time.Now()
+	for clave, cond := range firing {
+		if _, exists := open[tipo+"|"+clave]; exists {
+			continue
+		}
+		a := &database.Alert{
+			TenantID:  cond.tenantID,
+			Tipo:      tipo,
+			Clave:     clave,
+			Mensaje:   cond.mensaje,
+			Estado:    "active",
+			CreatedAt: now,
+		}
+		log.Printf("[Alerts] ALERTA %s: %s", tipo, a.Mensaje)
+		a.Notificada = m.notify(cfg, a)
+		if err := m.repo.CreateAlert(a); err != nil {
+			log.Printf("[Alerts] %v", err)
+		}
+		m.notifyProyectos(a)
+	}
+
+	for _, a := range open {
+		if a.Tipo != tipo {
+			continue
+		}
+		if _, still := firing[a.Clave]; still {
+			continue
+		}
+		if err := m.repo.ResolveAlert(a.ID, now); err != nil {
+			log.Printf("[Alerts] %v", err)
+			continue
+		}
+		a.Estado, a.ResolvedAt = "resolved", &now
+		log.Printf("[Alerts] Resuelta %s: %s", tipo, a.Mensaje)
+		m.notify(cfg, &a)
+		m.notifyProyectos(&a)
+	}
+}
+
+// notifyProyectos envía la alerta a los canales de chat de los proyectos que usan la troncal o de
+// la campaña afectada. Las alertas del sistema (BD, spool) solo van por email.
+func (m *Monitor) notifyProyectos(a *database.Alert) {
+	if m.notifier == nil {
+		return
+	}
+	text := "ALERTA: " + a.Mensaje
+	if a.Estado == "resolved" {
+		text = "Resuelta: " + a.Mensaje
+	}
+
+	switch a.Tipo {
+	case database.AlertTrunkDown:
+		troncales, err := m.repo.ListTroncales()
+		if err != nil {
+			log.Printf("[Alerts] %v", err)
+			return
+		}
+		for _, t := range troncales {
+			if t.Nombre != a.Clave {
+				continue
+			}
+			proyectos, err := m.repo.ListProyectosByTroncal(t.ID)
+			if err != nil {
+				log.Printf("[Alerts] %v", err)
+				return
+			}
+			for _, p := range proyectos {
+				m.notifier.Notify(p.ID, notify.EventAlert, text)
+			}
+		}
+	case database.AlertLowAnswerRate:
+		id, _ := strconv.Atoi(a.Clave)
+		if c, err := m.repo.GetCampaign(id); err == nil {
+			m.notifier.Notify(c.ProyectoID, notify.EventAlert, text)
+		}
+	case database.AlertCIDQuarantined:
+		// Clave: proyecto/caller_id
+		if p, _, ok := strings.Cut(a.Clave, "/"); ok {
+			if id, err := strconv.Atoi(p); err == nil {
+				m.notifier.Notify(id, notify.EventAlert, text)
+			}
+		}
+	}
+}
+
+// checkDB verifica la conexión a la BD. La caída se notifica al detectarse y se registra (ya
+// resuelta) cuando la conexión vuelve. Devuelve false mientras la BD no responda.
+func (m *Monitor) checkDB(cfg config.AlertsConfig) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	err := m.repo.GetDB().PingContext(ctx)
+	cancel()
+
+	now := time.Now()
+	if err != nil {
+		if m.dbDown == nil {
+			m.dbDown = &database.Alert{
+				Tipo:      database.AlertDBUnreachable,
+				Clave:     leader.ID(),
+				Mensaje:   fmt.Sprintf("La base de datos no responde desde %s: %v", leader.ID(), err),
+				Estado:    "active",
+				CreatedAt: now,
+			}
+			log.Printf("[Alerts] ALERTA %s: %s", database.AlertDBUnreachable, m.dbDown.Mensaje)
+			if cfg.DBUnreachable {
+				m.dbDown.Notificada = m.notify(cfg, m.dbDown)
+			}
+		}
+		return false
+	}
+
+	if a := m.dbDown; a != nil {
+		m.dbDown = nil
+		a.Estado, a.ResolvedAt = "resolved", &now
+		log.Printf("[Alerts] Resuelta %s: conexión recuperada tras %s", a.Tipo, now.Sub(a.CreatedAt).Round(time.Second))
+		if cfg.DBUnreachable {
+			if err := m.repo.CreateAlert(a); err != nil {
+				log.Printf("[Alerts] %v", err)
+			}
+			m.notify(cfg, a)
+		}
+	}
+	return true
+}
+
+// trunksDown devuelve las troncales activas que ningún nodo alcanza. Una troncal que no figura
+// en ningún nodo (config no cargada) no cuenta; sin nodos que respondan no se evalúa.
+func (m *Monitor) trunksDown() (map[string]condition, bool) {
+	troncales, err := m.repo.ListTroncales()
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return nil, false
+	}
+	nodes := m.peers(peersTimeout)
+
+	answered := false
+	for _, n := range nodes {
+		if n.Err == nil {
+			answered = true
+			break
+		}
+	}
+	if !answered {
+		return nil, false
+	}
+
+	firing := make(map[string]condition)
+	for _, t := range troncales {
+		if !t.Activo {
+			continue
+		}
+		found, reachable := false, false
+		var states []string
+		for _, n := range nodes {
+			if n.Err != nil {
+				continue
+			}
+			for _, p := range n.Peers {
+				if p.Name != t.Nombre {
+					continue
+				}
+				found = true
+				if p.Reachable {
+					reachable = true
+				} else {
+					states = append(states, n.Node+": "+p.Status)
+				}
+				break
+			}
+		}
+		if found && !reachable {
+			firing[t.Nombre] = condition{
+				tenantID: t.TenantID,
+				mensaje:  fmt.Sprintf("Troncal %s inalcanzable (%s)", t.Nombre, strings.Join(states, ", ")),
+			}
+		}
+	}
+	return firing, true
+}
+
+// lowAnswerRate devuelve las campañas activas cuyo % de contestadas en las últimas llamadas está
+// por debajo del mínimo (solo con la ventana completa, como la regla de salida exit_min_asr)
+func (m *Monitor) lowAnswerRate(cfg config.AlertsConfig) (map[string]condition, bool) {
+	window := cfg.AnswerRateWindow
+	if window <= 0 {
+		window = DefaultAnswerRateWindow
+	}
+	campaigns, err := m.repo.GetActiveCampaigns()
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return nil, false
+	}
+
+	firing := make(map[string]condition)
+	for _, c := range campaigns {
+		calls, answered, err := m.repo.GetCampaignWindowASR(c.ID, window)
+		if err != nil {
+			log.Printf("[Alerts] %v", err)
+			return nil, false
+		}
+		if calls < window {
+			continue
+		}
+		rate := float64(answered) * 100 / float64(calls)
+		if rate < cfg.MinAnswerRate {
+			firing[strconv.Itoa(c.ID)] = condition{
+				tenantID: c.TenantID,
+				mensaje: fmt.Sprintf("Campaña %s (ID %d): %.1f%% contestadas en las últimas %d llamadas (mínimo %.1f%%)",
+					c.Nombre, c.ID, rate, calls, cfg.MinAnswerRate),
+			}
+		}
+	}
+	return firing, true
+}
+
+// quarantineCIDs pone en cuarentena los Caller IDs con suficientes llamadas en la ventana cuyo % de
+// contestadas cae bajo el mínimo absoluto o muy por debajo del resto de Caller IDs del proyecto
+func (m *Monitor) quarantineCIDs(cfg config.AlertsConfig) {
+	window := cfg.CIDWindow
+	if window <= 0 {
+		window = DefaultCIDWindow
+	}
+	minCalls := cfg.CIDMinCalls
+	if minCalls <= 0 {
+		minCalls = DefaultCIDMinCalls
+	}
+	rates, err := m.repo.GetCIDAnswerRates(time.Now().Add(-time.Duration(window) * time.Minute))
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return
+	}
+
+	// Totales por proyecto para comparar cada Caller ID con el resto
+	type totals struct{ llamadas, contestadas int }
+	byProyecto := make(map[int]totals)
+	for _, r := range rates {
+		t := byProyecto[r.ProyectoID]
+		t.llamadas += r.Llamadas
+		t.contestadas += r.Contestadas
+		byProyecto[r.ProyectoID] = t
+	}
+
+	tenants := make(map[int]int)
+	for _, r := range rates {
+		if r.Llamadas < minCalls {
+			continue
+		}
+		rate := float64(r.Contestadas) * 100 / float64(r.Llamadas)
+
+		var motivo string
+		if cfg.CIDMinAnswerRate > 0 && rate < cfg.CIDMinAnswerRate {
+			motivo = fmt.Sprintf("%.1f%% contestadas en %d llamadas (mínimo %.1f%%)", rate, r.Llamadas, cfg.CIDMinAnswerRate)
+		} else if cfg.CIDAnswerDrop > 0 {
+			t := byProyecto[r.ProyectoID]
+			peers := t.llamadas - r.Llamadas
+			if peers < minCalls {
+				continue
+			}
+			peerRate := float64(t.contestadas-r.Contestadas) * 100 / float64(peers)
+			if rate >= peerRate*(1-cfg.CIDAnswerDrop/100) {
+				continue
+			}
+			motivo = fmt.Sprintf("%.1f%% contestadas en %d llamadas frente a %.1f%% del resto del proyecto (caída máxima %.0f%%)",
+				rate, r.Llamadas, peerRate, cfg.CIDAnswerDrop)
+		}
+		if motivo == "" {
+			continue
+		}
+
+		tenantID, ok := tenants[r.ProyectoID]
+		if !ok {
+			p, err := m.repo.GetProyecto(r.ProyectoID)
+			if err != nil {
+				log.Printf("[Alerts] %v", err)
+				continue
+			}
+			tenantID = p.TenantID
+			tenants[r.ProyectoID] = tenantID
+		}
+		added, err := m.repo.QuarantineCID(&database.CIDQuarantine{
+			CallerID:   r.CallerID,
+			TenantID:   tenantID,
+			ProyectoID: r.ProyectoID,
+			Llamadas:   r.Llamadas,
+			AnswerRate: rate,
+			Motivo:     motivo,
+		})
+		if err != nil {
+			log.Printf("[Alerts] %v", err)
+			continue
+		}
+		if added {
+			log.Printf("[Alerts] Caller ID %s en cuarentena (proyecto %d): %s", r.CallerID, r.ProyectoID, motivo)
+		}
+	}
+}
+
+// quarantinedCIDs devuelve una condición por Caller ID en cuarentena (se resuelve al liberarlo)
+func (m *Monitor) quarantinedCIDs() (map[string]condition, bool) {
+	list, err := m.repo.ListCIDQuarantine()
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return nil, false
+	}
+	firing := make(map[string]condition, len(list))
+	for _, q := range list {
+		firing[fmt.Sprintf("%d/%s", q.ProyectoID, q.CallerID)] = condition{
+			tenantID: q.TenantID,
+			mensaje:  fmt.Sprintf("Caller ID %s en cuarentena (proyecto %d): %s", q.CallerID, q.ProyectoID, q.Motivo),
+		}
+	}
+	return firing, true
+}
+
+// spoolSaturated indica si la cola persistente del spool supera el % configurado de su capacidad
+func spoolSaturated(cfg config.AlertsConfig) map[string]condition {
+	backlog := asterisk.QueueBacklog()
+	pct := backlog * 100 / asterisk.MaxBacklog
+	if pct < cfg.SpoolSaturation {
+		return nil
+	}
+	return map[string]condition{
+		"spool": {mensaje: fmt.Sprintf("Cola del spool al %d%% (%d de %d llamadas)", pct, backlog, asterisk.MaxBacklog)},
+	}
+}
+
+// notify envía la alerta (o su resolución) a alerts.emails; devuelve true si se envió
+func (m *Monitor) notify(cfg config.AlertsConfig, a *database.Alert) bool {
+	if m.mailer == nil || cfg.Emails == "" {
+		return false
+	}
+	to, err := mailer.ParseAddresses(cfg.Emails)
+	if err != nil {
+		log.Printf("[Alerts] alerts.emails: %v", err)
+		return false
+	}
+
+	subject := "[apicall] ALERTA: " + a.Mensaje
+	if a.Estado == "resolved" {
+		subject = "[apicall] Resuelta: " + a.Mensaje
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tipo: %s\n", a.Tipo)
+	fmt.Fprintf(&b, "Objeto: %s\n", a.Clave)
+	fmt.Fprintf(&b, "Detalle: %s\n", a.Mensaje)
+	fmt.Fprintf(&b, "Desde: %s\n", a.CreatedAt.Format(time.DateTime))
+	if a.ResolvedAt != nil {
+		fmt.Fprintf(&b, "Resuelta: %s (duración %s)\n", a.ResolvedAt.Format(time.DateTime), a.ResolvedAt.Sub(a.CreatedAt).Round(time.Second))
+	}
+	fmt.Fprintf(&b, "Instancia: %s\n", leader.ID())
+
+	if err := m.mailer.Send(to, subject, b.String()); err != nil {
+		log.Printf("[Alerts] Error enviando alerta %s por email: %v", a.Tipo, err)
+		return false
+	}
+	return true
+}
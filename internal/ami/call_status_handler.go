@@ -1,9 +1,11 @@
 package ami
 
 import (
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"apicall/internal/database"
 )
@@ -11,6 +13,7 @@ import (
 // CallTracker defines the interface for tracking and releasing calls
 type CallTracker interface {
 	GetContactID(uniqueID string) (int64, bool)
+	GetLogID(uniqueID string) (int64, bool)
 	Release(uniqueID string)
 	AddAlias(alias, uniqueID string)
 }
@@ -20,6 +23,7 @@ type CallStatusHandler struct {
 	client  *Client
 	repo    *database.Repository
 	tracker CallTracker
+	timings *channelTimings
 	done    chan struct{}
 }
 
@@ -29,6 +33,7 @@ func NewCallStatusHandler(client *Client, repo *database.Repository, tracker Cal
 		client:  client,
 		repo:    repo,
 		tracker: tracker,
+		timings: newChannelTimings(),
 		done:    make(chan struct{}),
 	}
 }
@@ -46,11 +51,13 @@ func (h *CallStatusHandler) Stop() {
 }
 
 func (h *CallStatusHandler) processEvents() {
+	// Una sola suscripción: Events() crea un canal nuevo en cada llamada
+	events := h.client.Subscribe()
 	for {
 		select {
 		case <-h.done:
 			return
-		case event, ok := <-h.client.Events():
+		case event, ok := <-events:
 			if !ok {
 				return
 			}
@@ -70,6 +77,23 @@ func (h *CallStatusHandler) handleEvent(event Event) {
 		h.handleOriginateResponse(event)
 	case "VarSet":
 		h.handleVarSet(event)
+	case "Newchannel":
+		if uniqueid := event.Fields["Uniqueid"]; uniqueid != "" && strings.HasPrefix(event.Fields["Channel"], "SIP/") {
+			h.timings.started(uniqueid, time.Now())
+		}
+	case "Newstate":
+		if event.Fields["ChannelState"] == "6" { // Up
+			h.timings.answered(event.Fields["Uniqueid"], time.Now())
+		}
+	case "DialBegin":
+		// Originate y Dial() informan el canal destino; si ya se vio su Newchannel se conserva ese inicio
+		if uniqueid := event.Fields["DestUniqueid"]; uniqueid != "" && strings.HasPrefix(event.Fields["DestChannel"], "SIP/") {
+			h.timings.dialed(uniqueid, time.Now())
+		}
+	case "DialEnd":
+		if event.Fields["DialStatus"] == "ANSWER" {
+			h.timings.answered(event.Fields["DestUniqueid"], time.Now())
+		}
 	}
 }
 
@@ -130,14 +154,25 @@ func (h *CallStatusHandler) handleHangup(event Event) {
 		disposition = "NA" // No Answer
 	}
 	
-	// Find and update any DIALING call with this uniqueid
-	// We need to search by uniqueid pattern (the .call file includes it in channel name)
-	updated, err := h.repo.UpdateDialingCallByUniqueid(uniqueid, status, disposition)
+	// Find and update the call if it's still DIALING
+	updated, err := h.updateDialingCall(uniqueid, status, disposition)
 	if err != nil {
 		log.Printf("[AMI-Handler] Error updating call: %v", err)
 		return
 	}
 	
+	// Causa de cuelgue (también en llamadas que cerró el AGI) y timeline. Fuera del tracker la
+	// causa se guarda por el uniqueid de Asterisk; el timeline solo para llamadas trackeadas.
+	if logID, ok := h.trackedLogID(uniqueid); ok {
+		if err := h.repo.SetCallHangupCause(logID, causeInt, causeText); err != nil {
+			log.Printf("[AMI-Handler] %v", err)
+		}
+		h.repo.AddCallEvent(logID, database.CallEventHangup, fmt.Sprintf("causa %s (%s)", cause, causeText))
+	} else if err := h.repo.SetCallHangupCauseByUniqueid(uniqueid, causeInt, causeText); err != nil {
+		log.Printf("[AMI-Handler] %v", err)
+	}
+	h.saveTiming(uniqueid)
+
 	// Release channel slot and update contact if this was a tracked call
 	if h.tracker != nil {
 		contactID, exists := h.tracker.GetContactID(uniqueid)
@@ -160,6 +195,23 @@ func (h *CallStatusHandler) handleHangup(event Event) {
 	}
 }
 
+// saveTiming guarda timbrado y conversación del canal que colgó (si se vio su Newchannel)
+func (h *CallStatusHandler) saveTiming(uniqueid string) {
+	ring, talk, ok := h.timings.hungUp(uniqueid, time.Now())
+	if !ok {
+		return
+	}
+	var err error
+	if logID, tracked := h.trackedLogID(uniqueid); tracked {
+		err = h.repo.SetCallTiming(logID, ring, talk)
+	} else {
+		err = h.repo.SetCallTimingByUniqueid(uniqueid, ring, talk)
+	}
+	if err != nil {
+		log.Printf("[AMI-Handler] %v", err)
+	}
+}
+
 // handleOriginateResponse processes failed originations
 func (h *CallStatusHandler) handleOriginateResponse(event Event) {
 	response := event.Fields["Response"]
@@ -194,7 +246,7 @@ func (h *CallStatusHandler) handleOriginateResponse(event Event) {
 	}
 	
 	if uniqueid != "" {
-		updated, _ := h.repo.UpdateDialingCallByUniqueid(uniqueid, status, disposition)
+		updated, _ := h.updateDialingCall(uniqueid, status, disposition)
 		if updated {
 			log.Printf("[AMI-Handler] Originate failed %s: %s (disposition: %s)", uniqueid, status, disposition)
 		}
@@ -208,6 +260,10 @@ func (h *CallStatusHandler) handleOriginateResponse(event Event) {
 func (h *CallStatusHandler) handleVarSet(event Event) {
 	// We are listening for APICALL_UNIQUEID being set on the channel
 	variable := event.Fields["Variable"]
+	if strings.HasPrefix(variable, sipCauseVar) {
+		h.handleSIPCause(event)
+		return
+	}
 	if variable != "APICALL_UNIQUEID" {
 		return
 	}
@@ -220,5 +276,67 @@ func (h *CallStatusHandler) handleVarSet(event Event) {
 	if asteriskID != "" && internalUUID != "" && h.tracker != nil {
 		log.Printf("[AMI-Handler] DEBUG: VarSet detected. Linking AsteriskID=%s -> UUID=%s", asteriskID, internalUUID)
 		h.tracker.AddAlias(asteriskID, internalUUID)
+		// Guardar el uniqueid de Asterisk en el log: tras un reinicio (sin tracker) los eventos
+		// siguen encontrando la llamada por coincidencia exacta
+		if logID, ok := h.tracker.GetLogID(internalUUID); ok {
+			if err := h.repo.SetDialingCallUniqueid(logID, asteriskID); err != nil {
+				log.Printf("[AMI-Handler] Error saving uniqueid %s for log %d: %v", asteriskID, logID, err)
+			}
+		}
+	}
+}
+
+// sipCauseVar es el prefijo del VarSet de HASH(SIP_CAUSE,<canal>) que chan_sip emite en cada
+// respuesta de la troncal (requiere storesipcause=yes en sip.conf)
+const sipCauseVar = "~HASH~SIP_CAUSE~"
+
+// handleSIPCause guarda la respuesta SIP final (>= 200) en el log de la llamada
+func (h *CallStatusHandler) handleSIPCause(event Event) {
+	code, reason, ok := parseSIPCause(event.Fields["Value"])
+	if !ok || code < 200 {
+		return
+	}
+	uniqueid := event.Fields["Uniqueid"]
+	if uniqueid == "" {
+		return
+	}
+	var err error
+	if logID, tracked := h.trackedLogID(uniqueid); tracked {
+		err = h.repo.SetCallSIPResponse(logID, code, reason)
+	} else {
+		err = h.repo.SetCallSIPResponseByUniqueid(uniqueid, code, reason)
+	}
+	if err != nil {
+		log.Printf("[AMI-Handler] %v", err)
+	}
+}
+
+// parseSIPCause interpreta el valor de SIP_CAUSE, ej: "SIP 486 Busy Here"
+func parseSIPCause(value string) (int, string, bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[0] != "SIP" {
+		return 0, "", false
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", false
+	}
+	return code, strings.Join(fields[2:], " "), true
+}
+
+// trackedLogID devuelve el log de una llamada del tracker
+func (h *CallStatusHandler) trackedLogID(uniqueid string) (int64, bool) {
+	if h.tracker == nil {
+		return 0, false
+	}
+	return h.tracker.GetLogID(uniqueid)
+}
+
+// updateDialingCall resuelve el log de la llamada por el tracker (id del log) y, si no está
+// trackeada, por el uniqueid de Asterisk guardado en handleVarSet (índice, sin LIKE)
+func (h *CallStatusHandler) updateDialingCall(uniqueid, status, disposition string) (bool, error) {
+	if logID, ok := h.trackedLogID(uniqueid); ok {
+		return h.repo.UpdateDialingCallByID(logID, status, disposition)
 	}
+	return h.repo.UpdateDialingCallByUniqueid(uniqueid, status, disposition)
 }
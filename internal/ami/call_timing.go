@@ -0,0 +1,77 @@
+package ami
+
+import (
+	"time"
+)
+
+// maxChannelAge es la antigüedad a partir de la cual se descarta un canal sin Hangup (evento perdido)
+const maxChannelAge = 6 * time.Hour
+
+// channelTiming son los instantes de un canal saliente, tomados al recibir sus eventos
+type channelTiming struct {
+	start  time.Time // Newchannel o DialBegin (originate)
+	answer time.Time // Newstate Up o DialEnd ANSWER
+}
+
+// channelTimings calcula timbrado y conversación por canal. Solo la usa processEvents (sin lock).
+type channelTimings struct {
+	channels  map[string]*channelTiming
+	lastPrune time.Time
+}
+
+func newChannelTimings() *channelTimings {
+	return &channelTimings{channels: make(map[string]*channelTiming), lastPrune: time.Now()}
+}
+
+// started registra la creación del canal
+func (t *channelTimings) started(uniqueid string, at time.Time) {
+	t.channels[uniqueid] = &channelTiming{start: at}
+	if at.Sub(t.lastPrune) > time.Hour {
+		t.prune(at)
+	}
+}
+
+// dialed registra el inicio del marcado (DialBegin) si no se vio la creación del canal
+func (t *channelTimings) dialed(uniqueid string, at time.Time) {
+	if _, ok := t.channels[uniqueid]; !ok {
+		t.started(uniqueid, at)
+	}
+}
+
+// answered registra la respuesta (solo la primera: un canal puede volver a Up tras un hold)
+func (t *channelTimings) answered(uniqueid string, at time.Time) {
+	if c, ok := t.channels[uniqueid]; ok && c.answer.IsZero() {
+		c.answer = at
+	}
+}
+
+// hungUp devuelve los segundos de timbrado y conversación del canal y lo olvida; ok = false si
+// no se vio su creación (ej: el proceso arrancó con la llamada en curso)
+func (t *channelTimings) hungUp(uniqueid string, at time.Time) (ring, talk int, ok bool) {
+	c, ok := t.channels[uniqueid]
+	if !ok {
+		return 0, 0, false
+	}
+	delete(t.channels, uniqueid)
+	if c.answer.IsZero() {
+		return seconds(at.Sub(c.start)), 0, true
+	}
+	return seconds(c.answer.Sub(c.start)), seconds(at.Sub(c.answer)), true
+}
+
+func (t *channelTimings) prune(now time.Time) {
+	for id, c := range t.channels {
+		if now.Sub(c.start) > maxChannelAge {
+			delete(t.channels, id)
+		}
+	}
+	t.lastPrune = now
+}
+
+// seconds redondea al segundo más cercano
+func seconds(d time.Duration) int {
+	if d < 0 {
+		return 0
+	}
+	return int(d.Round(time.Second) / time.Second)
+}
@@ -0,0 +1,95 @@
+package ami
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LiveChannel es un canal SIP activo en Asterisk con las variables de tracking de apicall
+type LiveChannel struct {
+	Channel    string
+	UniqueID   string // Uniqueid de Asterisk
+	TrackingID string // APICALL_UNIQUEID (vacío = no lo originó apicall)
+	LogID      int64  // APICALL_LOG_ID
+}
+
+// ShowChannels lista los canales SIP activos (CoreShowChannels) y lee de cada uno las variables
+// APICALL_UNIQUEID y APICALL_LOG_ID (Getvar). Se usa al arrancar para recuperar las llamadas en curso.
+func (c *Client) ShowChannels(timeout time.Duration) ([]LiveChannel, error) {
+	events := c.Subscribe()
+	defer c.unsubscribe(events)
+	deadline := time.After(timeout)
+
+	listID := fmt.Sprintf("showchannels-%d", time.Now().UnixNano())
+	if err := c.sendAction(fmt.Sprintf("Action: CoreShowChannels\r\nActionID: %s\r\n\r\n", listID)); err != nil {
+		return nil, err
+	}
+
+	var channels []LiveChannel
+collect:
+	for {
+		select {
+		case event := <-events:
+			if event.Fields["ActionID"] != listID {
+				continue
+			}
+			switch {
+			case event.Fields["Response"] == "Error":
+				return nil, fmt.Errorf("CoreShowChannels: %s", event.Fields["Message"])
+			case event.Type == "CoreShowChannel" && strings.HasPrefix(event.Fields["Channel"], "SIP/"):
+				channels = append(channels, LiveChannel{Channel: event.Fields["Channel"], UniqueID: event.Fields["Uniqueid"]})
+			case event.Type == "CoreShowChannelsComplete":
+				break collect
+			}
+		case <-deadline:
+			return nil, fmt.Errorf("timeout esperando CoreShowChannels")
+		}
+	}
+
+	// Getvar por canal y variable; el ActionID identifica a cuál corresponde la respuesta.
+	// Se envían en segundo plano para ir leyendo las respuestas sin llenar la suscripción.
+	pending := make(map[string]func(value string))
+	var actions []string
+	for i := range channels {
+		ch := &channels[i]
+		vars := map[string]func(string){
+			"APICALL_UNIQUEID": func(v string) { ch.TrackingID = v },
+			"APICALL_LOG_ID":   func(v string) { ch.LogID, _ = strconv.ParseInt(v, 10, 64) },
+		}
+		for variable, set := range vars {
+			actionID := fmt.Sprintf("%s-%d-%s", listID, i, variable)
+			pending[actionID] = set
+			actions = append(actions, fmt.Sprintf("Action: Getvar\r\nActionID: %s\r\nChannel: %s\r\nVariable: %s\r\n\r\n", actionID, ch.Channel, variable))
+		}
+	}
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, action := range actions {
+			if err := c.sendAction(action); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+	}()
+	for len(pending) > 0 {
+		select {
+		case event := <-events:
+			set, ok := pending[event.Fields["ActionID"]]
+			if !ok || event.Fields["Response"] == "" {
+				continue
+			}
+			// Error = el canal colgó entre el listado y el Getvar
+			if event.Fields["Response"] == "Success" {
+				set(event.Fields["Value"])
+			}
+			delete(pending, event.Fields["ActionID"])
+		case err := <-sendErr:
+			return nil, err
+		case <-deadline:
+			return nil, fmt.Errorf("timeout esperando Getvar (%d pendientes)", len(pending))
+		}
+	}
+	return channels, nil
+}
@@ -2,9 +2,13 @@ package ami
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -39,14 +43,33 @@ func NewClient(cfg *config.AMIConfig) *Client {
 	}
 }
 
-// Connect establece conexión con el AMI
+// dialTimeout limita el establecimiento de la conexión TCP/TLS con el AMI
+const dialTimeout = 10 * time.Second
+
+// Connect establece conexión con el AMI (TLS con url amis://)
 func (c *Client) Connect() error {
-	addr := c.config.Address()
+	addr, useTLS, err := c.config.Endpoint()
+	if err != nil {
+		return err
+	}
 	log.Printf("[AMI] Conectando a %s", addr)
 
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("error conectando: %w", err)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	if useTLS {
+		tlsConfig, err := c.tlsConfig(addr)
+		if err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("error conectando por TLS: %w", err)
+		}
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("error conectando: %w", err)
+		}
 	}
 
 	c.conn = conn
@@ -55,6 +78,7 @@ func (c *Client) Connect() error {
 
 	// Leer banner inicial
 	if _, err := c.reader.ReadString('\n'); err != nil {
+		conn.Close()
 		return fmt.Errorf("error leyendo banner: %w", err)
 	}
 
@@ -73,10 +97,37 @@ func (c *Client) Connect() error {
 	return nil
 }
 
-// login autentica con el servidor AMI
+// tlsConfig arma la configuración TLS: valida el certificado contra tls_ca_file (o las CA del sistema)
+func (c *Client) tlsConfig(addr string) (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	cfg := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.config.TLSInsecureSkipVerify,
+	}
+	if c.config.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo tls_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca_file sin certificados válidos: %s", c.config.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// login autentica con el servidor AMI. Con events se piden solo esas clases de eventos
+// (ej: call), para no recibir el tráfico de log, dialplan, etc.
 func (c *Client) login() error {
-	action := fmt.Sprintf("Action: Login\r\nUsername: %s\r\nSecret: %s\r\n\r\n",
+	action := fmt.Sprintf("Action: Login\r\nUsername: %s\r\nSecret: %s\r\n",
 		c.config.Username, c.config.Secret)
+	if c.config.Events != "" {
+		action += fmt.Sprintf("Events: %s\r\n", c.config.Events)
+	}
+	action += "\r\n"
 
 	if _, err := c.writer.WriteString(action); err != nil {
 		return err
@@ -169,7 +220,27 @@ func (c *Client) Subscribe() <-chan Event {
 	return ch
 }
 
-// reconnect intenta reconectar al AMI
+// unsubscribe quita una suscripción temporal creada con Subscribe
+func (c *Client) unsubscribe(ch <-chan Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, sub := range c.subscribers {
+		if sub == ch {
+			c.subscribers = append(c.subscribers[:i], c.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// ConnectInBackground reintenta la conexión cada reconnect_interval hasta lograrla
+// (nodos que no estaban disponibles al arrancar)
+func (c *Client) ConnectInBackground() {
+	go c.reconnect()
+}
+
+// reconnect intenta reconectar al AMI con backoff exponencial y jitter: la espera arranca en
+// reconnect_interval, se duplica en cada intento hasta reconnect_max, y se sortea entre la mitad
+// y el total para que varias instancias no reconecten al unísono tras un reinicio de Asterisk
 func (c *Client) reconnect() {
 	c.mu.Lock()
 	c.connected = false
@@ -178,16 +249,17 @@ func (c *Client) reconnect() {
 	}
 	c.mu.Unlock()
 
+	base, maxWait := c.config.ReconnectBackoff()
+	wait := base
 	for {
-		// Verificar si debemos detenernos
+		delay := wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		log.Printf("[AMI] Reconectando en %v...", delay.Round(time.Millisecond))
 		select {
 		case <-c.done:
 			return
-		default:
+		case <-time.After(delay):
 		}
-
-		log.Printf("[AMI] Reconectando en %d segundos...", c.config.ReconnectInterval)
-		time.Sleep(time.Duration(c.config.ReconnectInterval) * time.Second)
+		wait = min(wait*2, maxWait)
 
 		if err := c.Connect(); err != nil {
 			log.Printf("[AMI] Error reconectando: %v", err)
@@ -218,6 +290,13 @@ func (c *Client) SendAction(action string) error {
 	return c.sendAction(action)
 }
 
+// IsConnected indica si hay una sesión AMI activa
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
 // Close cierra la conexión AMI
 func (c *Client) Close() error {
 	close(c.done)
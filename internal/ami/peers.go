@@ -0,0 +1,144 @@
+package ami
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerStatus es el estado de un peer/endpoint SIP según Asterisk
+type PeerStatus struct {
+	Name         string `json:"name"`
+	Driver       string `json:"driver"` // SIP o PJSIP
+	Address      string `json:"address"`
+	Status       string `json:"status"` // Texto de Asterisk, ej: "OK (12 ms)", "UNREACHABLE"
+	Reachable    bool   `json:"reachable"`
+	LatencyMs    int    `json:"latency_ms"`   // 0 = sin medir (qualify desactivado o PJSIP)
+	Registration string `json:"registration"` // Estado del registro saliente (vacío = no registra)
+}
+
+// Registration es un registro saliente de chan_sip (register => usuario@host)
+type Registration struct {
+	Host     string
+	Username string
+	State    string // ej: Registered, Rejected, Request Sent
+}
+
+// ShowPeers lista los peers SIP (SIPpeers) o, si chan_sip no está cargado, los endpoints PJSIP
+// (PJSIPShowEndpoints). En PJSIP el registro saliente viene en cada endpoint; en chan_sip los
+// registros no se asocian a un peer y se devuelven aparte (SIPshowregistry).
+func (c *Client) ShowPeers(timeout time.Duration) ([]PeerStatus, []Registration, error) {
+	peers, sipErr := c.sipPeers(timeout)
+	if sipErr == nil {
+		var registry []Registration
+		// No es crítico: sin registry los peers igual sirven
+		if regs, err := c.listAction("SIPshowregistry", "RegistryEntry", "RegistrationsComplete", timeout); err == nil {
+			for _, reg := range regs {
+				registry = append(registry, Registration{Host: reg["Host"], Username: reg["Username"], State: reg["State"]})
+			}
+		}
+		return peers, registry, nil
+	}
+	peers, err := c.pjsipEndpoints(timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v; %v", sipErr, err)
+	}
+	return peers, nil, nil
+}
+
+func (c *Client) sipPeers(timeout time.Duration) ([]PeerStatus, error) {
+	entries, err := c.listAction("SIPpeers", "PeerEntry", "PeerlistComplete", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]PeerStatus, 0, len(entries))
+	for _, e := range entries {
+		p := PeerStatus{Name: e["ObjectName"], Driver: "SIP", Status: e["Status"]}
+		if ip := e["IPaddress"]; ip != "" && ip != "-none-" {
+			p.Address = ip + ":" + e["IPport"]
+		}
+		// "OK (12 ms)" con qualify; "Unmonitored" sin qualify: no se sabe, se asume alcanzable
+		switch {
+		case strings.HasPrefix(p.Status, "OK"):
+			p.Reachable = true
+			p.LatencyMs = parseLatency(p.Status)
+		case strings.HasPrefix(p.Status, "Unmonitored"):
+			p.Reachable = p.Address != ""
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+func (c *Client) pjsipEndpoints(timeout time.Duration) ([]PeerStatus, error) {
+	entries, err := c.listAction("PJSIPShowEndpoints", "EndpointList", "EndpointListComplete", timeout)
+	if err != nil {
+		return nil, err
+	}
+	registry := make(map[string]string)
+	if regs, err := c.listAction("PJSIPShowRegistrationsOutbound", "OutboundRegistrationDetail", "OutboundRegistrationDetailComplete", timeout); err == nil {
+		for _, reg := range regs {
+			registry[reg["ObjectName"]] = reg["Status"]
+			if ep := reg["Endpoint"]; ep != "" {
+				registry[ep] = reg["Status"]
+			}
+		}
+	}
+
+	peers := make([]PeerStatus, 0, len(entries))
+	for _, e := range entries {
+		p := PeerStatus{Name: e["ObjectName"], Driver: "PJSIP", Status: e["DeviceState"], Address: e["Contacts"]}
+		p.Reachable = p.Status != "" && p.Status != "Unavailable" && p.Status != "Invalid"
+		p.Registration = registry[e["ObjectName"]]
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// parseLatency extrae los ms de un estado "OK (12 ms)"
+func parseLatency(status string) int {
+	open := strings.Index(status, "(")
+	if open < 0 {
+		return 0
+	}
+	fields := strings.Fields(status[open+1:])
+	if len(fields) == 0 {
+		return 0
+	}
+	ms, _ := strconv.Atoi(fields[0])
+	return ms
+}
+
+// listAction envía una acción de lista y junta los campos de cada evento item hasta el evento complete
+func (c *Client) listAction(action, item, complete string, timeout time.Duration) ([]map[string]string, error) {
+	events := c.Subscribe()
+	defer c.unsubscribe(events)
+	deadline := time.After(timeout)
+
+	actionID := fmt.Sprintf("%s-%d", strings.ToLower(action), time.Now().UnixNano())
+	if err := c.sendAction(fmt.Sprintf("Action: %s\r\nActionID: %s\r\n\r\n", action, actionID)); err != nil {
+		return nil, err
+	}
+
+	var items []map[string]string
+	for {
+		select {
+		case event := <-events:
+			if event.Fields["ActionID"] != actionID {
+				continue
+			}
+			switch {
+			case event.Fields["Response"] == "Error":
+				return nil, fmt.Errorf("%s: %s", action, event.Fields["Message"])
+			case event.Type == item:
+				items = append(items, event.Fields)
+			case event.Type == complete:
+				return items, nil
+			}
+		case <-deadline:
+			return nil, fmt.Errorf("timeout esperando %s", action)
+		}
+	}
+}
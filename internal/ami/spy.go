@@ -0,0 +1,143 @@
+package ami
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Modos de supervisión (ChanSpy) sobre el agente de una llamada transferida
+const (
+	SpyListen  = "listen"  // El supervisor solo escucha
+	SpyWhisper = "whisper" // Habla al agente sin que lo escuche el destino
+	SpyBarge   = "barge"   // Habla con el agente y el destino
+)
+
+// spyOptions son las opciones de ChanSpy de cada modo: q sin beep, s sin anunciar el canal,
+// E termina cuando cuelga el canal espiado
+var spyOptions = map[string]string{
+	SpyListen:  "qsE",
+	SpyWhisper: "qsEw",
+	SpyBarge:   "qsEB",
+}
+
+var (
+	// ErrChannelNotFound: la llamada no tiene canal activo en el nodo
+	ErrChannelNotFound = errors.New("la llamada no está en curso")
+	// ErrNotTransferred: el canal de la llamada no está en un bridge con un agente
+	ErrNotTransferred = errors.New("la llamada no fue transferida a un agente")
+)
+
+// IsSpyMode indica si mode es un modo de supervisión válido
+func IsSpyMode(mode string) bool {
+	_, ok := spyOptions[mode]
+	return ok
+}
+
+// FindTransferLeg devuelve el canal del agente que está en un bridge con el canal uniqueID.
+// Si el agente se alcanzó por un canal Local (miembros de cola Local/...) se sigue hasta el canal real.
+func (c *Client) FindTransferLeg(uniqueID string, timeout time.Duration) (string, error) {
+	entries, err := c.listAction("CoreShowChannels", "CoreShowChannel", "CoreShowChannelsComplete", timeout)
+	if err != nil {
+		return "", err
+	}
+	var own map[string]string
+	for _, e := range entries {
+		if e["Uniqueid"] == uniqueID {
+			own = e
+			break
+		}
+	}
+	if own == nil {
+		return "", ErrChannelNotFound
+	}
+
+	current := own
+	for hops := 0; hops < 4; hops++ {
+		peer := bridgePeer(entries, current)
+		if peer == nil {
+			break
+		}
+		name := peer["Channel"]
+		if !strings.HasPrefix(name, "Local/") {
+			return name, nil
+		}
+		// Local/x;1 <-> Local/x;2: el agente está en el bridge de la otra mitad
+		other := strings.TrimSuffix(strings.TrimSuffix(name, ";1"), ";2")
+		if strings.HasSuffix(name, ";1") {
+			other += ";2"
+		} else {
+			other += ";1"
+		}
+		current = nil
+		for _, e := range entries {
+			if e["Channel"] == other {
+				current = e
+				break
+			}
+		}
+		if current == nil {
+			break
+		}
+	}
+	return "", ErrNotTransferred
+}
+
+// bridgePeer devuelve otro canal del mismo bridge que ch (nil si no está en un bridge)
+func bridgePeer(entries []map[string]string, ch map[string]string) map[string]string {
+	bridge := ch["BridgeId"]
+	if bridge == "" {
+		return nil
+	}
+	for _, e := range entries {
+		if e["BridgeId"] == bridge && e["Uniqueid"] != ch["Uniqueid"] {
+			return e
+		}
+	}
+	return nil
+}
+
+// Spy origina una llamada a supervisor (ej: SIP/101) que al contestar ejecuta ChanSpy sobre target
+// en el modo indicado. Devuelve cuando Asterisk acepta el Originate, sin esperar la contestación.
+func (c *Client) Spy(supervisor, target, mode, callerID string, ringTimeout time.Duration) error {
+	options, ok := spyOptions[mode]
+	if !ok {
+		return fmt.Errorf("modo de supervisión inválido: %s", mode)
+	}
+
+	events := c.Subscribe()
+	defer c.unsubscribe(events)
+
+	actionID := fmt.Sprintf("spy-%d", time.Now().UnixNano())
+	action := "Action: Originate\r\n" +
+		fmt.Sprintf("ActionID: %s\r\n", actionID) +
+		fmt.Sprintf("Channel: %s\r\n", supervisor) +
+		"Application: ChanSpy\r\n" +
+		fmt.Sprintf("Data: %s,%s\r\n", target, options) +
+		fmt.Sprintf("CallerID: %s\r\n", callerID) +
+		fmt.Sprintf("Timeout: %d\r\n", ringTimeout.Milliseconds()) +
+		"Async: true\r\n" +
+		"\r\n"
+	log.Printf("[AMI] Supervisión %s de %s desde %s", mode, target, supervisor)
+	if err := c.sendAction(action); err != nil {
+		return err
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Fields["ActionID"] != actionID || event.Fields["Response"] == "" {
+				continue
+			}
+			if event.Fields["Response"] == "Error" {
+				return fmt.Errorf("Originate: %s", event.Fields["Message"])
+			}
+			return nil
+		case <-deadline:
+			return fmt.Errorf("timeout esperando respuesta del Originate")
+		}
+	}
+}
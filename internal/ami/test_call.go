@@ -0,0 +1,135 @@
+package ami
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Aplicaciones que puede ejecutar una llamada de prueba al contestar
+const (
+	TestTone = "tone" // Playback de un tono de prueba
+	TestEcho = "echo" // Echo: el destino se escucha a sí mismo (audio en ambos sentidos)
+)
+
+// TestCallResult es el resultado de una llamada de prueba
+type TestCallResult struct {
+	Channel       string  `json:"channel"`
+	Result        string  `json:"result"` // ANSWER, NOANSWER, BUSY, CONGESTION, FAILED o TIMEOUT
+	Ringing       bool    `json:"ringing"`
+	Answered      bool    `json:"answered"`
+	RingSeconds   float64 `json:"ring_seconds"`   // Hasta el 180/183 (0 si no timbró)
+	AnswerSeconds float64 `json:"answer_seconds"` // Hasta la contestación (0 si no contestó)
+	Duration      float64 `json:"duration"`       // Hasta el cuelgue
+	Cause         int     `json:"cause"`          // Hangup cause Q.850
+	CauseTxt      string  `json:"cause_txt"`
+}
+
+// originateResults traduce el Reason de OriginateResponse
+var originateResults = map[string]string{
+	"0": "FAILED",
+	"1": "FAILED",
+	"3": "NOANSWER",
+	"4": "ANSWER",
+	"5": "BUSY",
+	"8": "CONGESTION",
+}
+
+// TestCall origina una llamada que al contestar ejecuta mode (TestTone o TestEcho) sin pasar por el
+// dialplan de apicall, y espera a que termine. ringTimeout limita el timbrado y maxDuration la
+// llamada contestada (TIMEOUT(absolute)).
+func (c *Client) TestCall(channel, callerID, mode string, ringTimeout, maxDuration time.Duration) (*TestCallResult, error) {
+	app, data := "Playback", "tt-monkeys&tt-weasels"
+	if mode == TestEcho {
+		app, data = "Echo", ""
+	}
+
+	events := c.Subscribe()
+	defer c.unsubscribe(events)
+
+	testID := fmt.Sprintf("trunktest-%d", time.Now().UnixNano())
+	action := "Action: Originate\r\n" +
+		fmt.Sprintf("ActionID: %s\r\n", testID) +
+		fmt.Sprintf("Channel: %s\r\n", channel) +
+		fmt.Sprintf("Application: %s\r\n", app) +
+		fmt.Sprintf("Data: %s\r\n", data) +
+		fmt.Sprintf("CallerID: %s\r\n", callerID) +
+		fmt.Sprintf("Timeout: %d\r\n", ringTimeout.Milliseconds()) +
+		"Async: true\r\n" +
+		fmt.Sprintf("Variable: APICALL_TEST_ID=%s\r\n", testID) +
+		fmt.Sprintf("Variable: TIMEOUT(absolute)=%d\r\n", int((ringTimeout+maxDuration).Seconds())) +
+		"\r\n"
+	log.Printf("[AMI] Llamada de prueba a %s (%s)", channel, mode)
+
+	start := time.Now()
+	if err := c.sendAction(action); err != nil {
+		return nil, err
+	}
+
+	result := &TestCallResult{}
+	deadline := time.After(ringTimeout + maxDuration + 10*time.Second)
+	var grace <-chan time.Time // Tras un OriginateResponse fallido, breve espera por el Hangup con la causa
+	responded, hungUp := false, false
+	for !(responded && hungUp) {
+		select {
+		case event := <-events:
+			if event.Type == "" && event.Fields["ActionID"] == testID && event.Fields["Response"] == "Error" {
+				return nil, fmt.Errorf("Originate: %s", event.Fields["Message"])
+			}
+			switch event.Type {
+			case "VarSet":
+				if event.Fields["Variable"] == "APICALL_TEST_ID" && event.Fields["Value"] == testID {
+					result.Channel = event.Fields["Channel"]
+				}
+			case "Newstate":
+				if result.Channel == "" || event.Fields["Channel"] != result.Channel {
+					continue
+				}
+				switch event.Fields["ChannelStateDesc"] {
+				case "Ringing":
+					if !result.Ringing {
+						result.Ringing = true
+						result.RingSeconds = time.Since(start).Seconds()
+					}
+				case "Up":
+					if !result.Answered {
+						result.Answered = true
+						result.AnswerSeconds = time.Since(start).Seconds()
+					}
+				}
+			case "Hangup":
+				if result.Channel == "" || event.Fields["Channel"] != result.Channel {
+					continue
+				}
+				hungUp = true
+				result.Duration = time.Since(start).Seconds()
+				result.Cause, _ = strconv.Atoi(event.Fields["Cause"])
+				result.CauseTxt = event.Fields["Cause-txt"]
+			case "OriginateResponse":
+				if event.Fields["ActionID"] != testID {
+					continue
+				}
+				responded = true
+				result.Result = originateResults[event.Fields["Reason"]]
+				if result.Result == "" {
+					result.Result = "FAILED"
+				}
+				if result.Result != "ANSWER" && !hungUp {
+					grace = time.After(2 * time.Second)
+				}
+			}
+		case <-grace:
+			hungUp = true
+		case <-deadline:
+			if result.Result == "" {
+				result.Result = "TIMEOUT"
+			}
+			return result, nil
+		}
+	}
+	if result.Duration == 0 {
+		result.Duration = time.Since(start).Seconds()
+	}
+	return result, nil
+}
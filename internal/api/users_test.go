@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"apicall/internal/auth"
+	"apicall/internal/database"
+)
+
+func TestCheckUserTarget(t *testing.T) {
+	tenantAdmin := &auth.Claims{UserID: 5, TenantID: 1, Username: "admin1", Role: "admin"}
+	superAdmin := &auth.Claims{UserID: 1, TenantID: 1, Username: "root", Role: auth.RoleSuperAdmin}
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		target database.User
+		want   int
+	}{
+		{"admin sobre superadmin", tenantAdmin, database.User{ID: 1, TenantID: 1, Role: auth.RoleSuperAdmin}, http.StatusForbidden},
+		{"admin sobre otro admin", tenantAdmin, database.User{ID: 7, TenantID: 1, Role: "admin"}, http.StatusForbidden},
+		{"admin sobre sí mismo", tenantAdmin, database.User{ID: 5, TenantID: 1, Role: "admin"}, 0},
+		{"admin sobre usuario", tenantAdmin, database.User{ID: 8, TenantID: 1, Role: "user"}, 0},
+		{"superadmin sobre admin", superAdmin, database.User{ID: 7, TenantID: 1, Role: "admin"}, 0},
+		{"superadmin sobre superadmin", superAdmin, database.User{ID: 2, TenantID: 0, Role: auth.RoleSuperAdmin}, 0},
+	}
+	for _, tt := range tests {
+		if got, msg := checkUserTarget(tt.claims, &tt.target); got != tt.want {
+			t.Errorf("%s: status %d (%s), se esperaba %d", tt.name, got, msg, tt.want)
+		}
+	}
+}
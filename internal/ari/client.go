@@ -0,0 +1,173 @@
+package ari
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"apicall/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client es un cliente mínimo de la API REST de Asterisk (ARI)
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	app      string
+	http     *http.Client
+}
+
+// NewClient crea un cliente ARI
+func NewClient(cfg config.ARIConfig) *Client {
+	return &Client{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/") + "/ari",
+		username: cfg.Username,
+		password: cfg.Password,
+		app:      cfg.AppName(),
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// OriginateParams describe un canal a crear y enviar a la aplicación Stasis
+type OriginateParams struct {
+	ChannelID string
+	Endpoint  string // ej: SIP/troncal/5551234
+	AppArgs   []string
+	CallerID  string
+	Timeout   time.Duration
+	Variables map[string]string
+}
+
+// Originate crea el canal; al contestar entra en Stasis con AppArgs
+func (c *Client) Originate(p OriginateParams) error {
+	q := url.Values{}
+	q.Set("endpoint", p.Endpoint)
+	q.Set("app", c.app)
+	q.Set("appArgs", strings.Join(p.AppArgs, ","))
+	if p.CallerID != "" {
+		q.Set("callerId", p.CallerID)
+	}
+	if p.Timeout > 0 {
+		q.Set("timeout", fmt.Sprintf("%d", int(p.Timeout.Seconds())))
+	}
+	body := map[string]interface{}{"variables": p.Variables}
+	return c.do(http.MethodPost, "/channels/"+url.PathEscape(p.ChannelID), q, body)
+}
+
+// Answer contesta el canal
+func (c *Client) Answer(channelID string) error {
+	return c.do(http.MethodPost, "/channels/"+url.PathEscape(channelID)+"/answer", nil, nil)
+}
+
+// Hangup cuelga el canal
+func (c *Client) Hangup(channelID string) error {
+	q := url.Values{}
+	q.Set("reason", "normal")
+	return c.do(http.MethodDelete, "/channels/"+url.PathEscape(channelID), q, nil)
+}
+
+// Play reproduce media (ej: sound:/var/lib/asterisk/sounds/apicall/bienvenida) en el canal
+func (c *Client) Play(channelID, playbackID, media string) error {
+	q := url.Values{}
+	q.Set("media", media)
+	return c.do(http.MethodPost, "/channels/"+url.PathEscape(channelID)+"/play/"+url.PathEscape(playbackID), q, nil)
+}
+
+// StopPlayback detiene una reproducción en curso
+func (c *Client) StopPlayback(playbackID string) error {
+	return c.do(http.MethodDelete, "/playbacks/"+url.PathEscape(playbackID), nil, nil)
+}
+
+// CreateBridge crea un bridge de mezcla
+func (c *Client) CreateBridge(bridgeID string) error {
+	q := url.Values{}
+	q.Set("type", "mixing")
+	return c.do(http.MethodPost, "/bridges/"+url.PathEscape(bridgeID), q, nil)
+}
+
+// AddToBridge agrega canales al bridge
+func (c *Client) AddToBridge(bridgeID string, channelIDs ...string) error {
+	q := url.Values{}
+	q.Set("channel", strings.Join(channelIDs, ","))
+	return c.do(http.MethodPost, "/bridges/"+url.PathEscape(bridgeID)+"/addChannel", q, nil)
+}
+
+// DestroyBridge elimina el bridge
+func (c *Client) DestroyBridge(bridgeID string) error {
+	return c.do(http.MethodDelete, "/bridges/"+url.PathEscape(bridgeID), nil, nil)
+}
+
+// Connect abre el WebSocket de eventos de la aplicación Stasis
+func (c *Client) Connect() (*websocket.Conn, error) {
+	u, err := url.Parse(c.baseURL + "/events")
+	if err != nil {
+		return nil, fmt.Errorf("URL de ARI inválida: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	q := url.Values{}
+	q.Set("app", c.app)
+	u.RawQuery = q.Encode()
+
+	header := http.Header{}
+	header.Set("Authorization", basicAuth(c.username, c.password))
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, fmt.Errorf("error conectando WebSocket ARI: %w", err)
+	}
+	return conn, nil
+}
+
+func (c *Client) do(method, path string, query url.Values, body interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("ARI %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("ARI %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func basicAuth(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
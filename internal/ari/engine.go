@@ -0,0 +1,333 @@
+package ari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/database"
+	"apicall/internal/dialer"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrNotConnected se devuelve al marcar sin el WebSocket de eventos conectado:
+// la llamada entraría en Stasis sin nadie que la atienda
+var ErrNotConnected = errors.New("ARI no conectado")
+
+// Event es un evento de la aplicación Stasis (solo los campos que usa el motor)
+type Event struct {
+	Type     string    `json:"type"`
+	Args     []string  `json:"args"`
+	Digit    string    `json:"digit"`
+	Cause    int       `json:"cause"`
+	CauseTxt string    `json:"cause_txt"`
+	Channel  *Channel  `json:"channel"`
+	Playback *Playback `json:"playback"`
+}
+
+// Channel es el canal al que se refiere un evento
+type Channel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// Playback es la reproducción a la que se refiere un evento
+type Playback struct {
+	ID        string `json:"id"`
+	TargetURI string `json:"target_uri"`
+}
+
+// channelID devuelve el canal afectado por el evento
+func (ev Event) channelID() string {
+	if ev.Channel != nil {
+		return ev.Channel.ID
+	}
+	if ev.Playback != nil {
+		return strings.TrimPrefix(ev.Playback.TargetURI, "channel:")
+	}
+	return ""
+}
+
+// Engine es el motor de marcación ARI (dial_engine=ari): origina las llamadas con
+// el pipeline común de pre-marcación y ejecuta el IVR desde la aplicación Stasis,
+// sin contextos de dialplan ni archivos .call.
+type Engine struct {
+	client *Client
+	repo   *database.Repository
+	pre    *dialer.PreDial
+	cfg    *config.Config
+
+	callsMu sync.Mutex
+	calls   map[string]*call // channel id (incluye la pierna de transferencia) -> llamada
+
+	connMu sync.Mutex
+	conn   *websocket.Conn
+
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewEngine crea el motor ARI compartiendo el pipeline de pre-marcación
+func NewEngine(cfg *config.Config, repo *database.Repository, pre *dialer.PreDial) *Engine {
+	return &Engine{
+		client:   NewClient(cfg.ARI),
+		repo:     repo,
+		pre:      pre,
+		cfg:      cfg,
+		calls:    make(map[string]*call),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start conecta el WebSocket de eventos (con reconexión automática)
+func (e *Engine) Start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running {
+		return
+	}
+	e.running = true
+	e.wg.Add(1)
+	go e.run()
+	log.Printf("[ARI] Motor ARI iniciado (app=%s)", e.cfg.ARI.AppName())
+}
+
+// Stop cierra el WebSocket y detiene el motor
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = false
+	e.mu.Unlock()
+
+	close(e.stopChan)
+	e.connMu.Lock()
+	if e.conn != nil {
+		e.conn.Close()
+	}
+	e.connMu.Unlock()
+	e.wg.Wait()
+	log.Println("[ARI] Motor ARI detenido")
+}
+
+func (e *Engine) run() {
+	defer e.wg.Done()
+
+	reconnect := time.Duration(e.cfg.ARI.ReconnectInterval) * time.Second
+	if reconnect <= 0 {
+		reconnect = 5 * time.Second
+	}
+
+	for {
+		conn, err := e.client.Connect()
+		if err != nil {
+			log.Printf("[ARI] %v", err)
+		} else {
+			log.Println("[ARI] Conectado al WebSocket de eventos")
+			e.setConn(conn)
+			e.readEvents(conn)
+			e.setConn(nil)
+			conn.Close()
+		}
+
+		select {
+		case <-e.stopChan:
+			return
+		case <-time.After(reconnect):
+			log.Println("[ARI] Reconectando...")
+		}
+	}
+}
+
+func (e *Engine) setConn(conn *websocket.Conn) {
+	e.connMu.Lock()
+	e.conn = conn
+	e.connMu.Unlock()
+}
+
+// Connected indica si el WebSocket de eventos está conectado
+func (e *Engine) Connected() bool {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	return e.conn != nil
+}
+
+func (e *Engine) readEvents(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-e.stopChan:
+			default:
+				log.Printf("[ARI] WebSocket cerrado: %v", err)
+			}
+			return
+		}
+
+		var ev Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			log.Printf("[ARI] Evento inválido: %v", err)
+			continue
+		}
+		e.dispatch(ev)
+	}
+}
+
+// dispatch enruta el evento a la llamada dueña del canal
+func (e *Engine) dispatch(ev Event) {
+	id := ev.channelID()
+	if id == "" {
+		return
+	}
+	c := e.lookup(id)
+
+	switch ev.Type {
+	case "StasisStart":
+		if c == nil {
+			// Canal sin llamada registrada (ej: originado antes de un reinicio)
+			log.Printf("[ARI] StasisStart de canal desconocido %s, colgando", id)
+			go e.client.Hangup(id)
+			return
+		}
+		if id == c.id && len(ev.Args) > 0 && ev.Args[0] == "ivr" && c.start() {
+			go e.runIVR(c)
+			return
+		}
+	case "ChannelDestroyed":
+		if c == nil {
+			return
+		}
+		if id == c.id {
+			defer e.finish(c, ev.Cause, ev.CauseTxt)
+		} else {
+			defer e.unregister(id)
+		}
+	}
+
+	if c != nil {
+		c.deliver(ev)
+	}
+}
+
+// finish cierra la llamada cuando se destruye el canal principal: si nunca llegó a
+// Stasis (no contestó, ocupado, congestión) registra el resultado según la causa
+func (e *Engine) finish(c *call, cause int, causeTxt string) {
+	if err := e.repo.SetCallHangupCause(c.logID, cause, causeTxt); err != nil {
+		log.Printf("[ARI] %v", err)
+	}
+	e.repo.AddCallEvent(c.logID, database.CallEventHangup, fmt.Sprintf("causa %d (%s)", cause, causeTxt))
+	ring, talk := c.timing()
+	if err := e.repo.SetCallTiming(c.logID, ring, talk); err != nil {
+		log.Printf("[ARI] %v", err)
+	}
+	if !c.started() {
+		status, disposition := hangupDisposition(cause)
+		e.updateLog(c, status, disposition, false, "", 0, nil)
+		log.Printf("[ARI] Llamada %s no contestada: %s (causa %d)", c.id, disposition, cause)
+	}
+	e.unregister(c.id)
+	e.pre.Finish(c.id)
+}
+
+func (e *Engine) register(id string, c *call) {
+	e.callsMu.Lock()
+	e.calls[id] = c
+	e.callsMu.Unlock()
+}
+
+func (e *Engine) unregister(id string) {
+	e.callsMu.Lock()
+	delete(e.calls, id)
+	e.callsMu.Unlock()
+}
+
+func (e *Engine) lookup(id string) *call {
+	e.callsMu.Lock()
+	defer e.callsMu.Unlock()
+	return e.calls[id]
+}
+
+// Dial origina la llamada por ARI; al contestar entra en la aplicación Stasis
+func (e *Engine) Dial(req dialer.DialRequest) error {
+	if !e.Connected() {
+		return ErrNotConnected
+	}
+
+	pc, err := e.pre.Prepare(dialer.CallSpec{
+		Proyecto:    req.Project,
+		Telefono:    req.Destination,
+		ContactID:   req.ContactID,
+		CampaignID:  req.CampaignID,
+		Variables:   req.Variables,
+		CallerID:    req.CallerID,
+		ExternalRef: req.ExternalRef,
+		CallbackOf:  req.CallbackOf,
+		Troncales:   req.Troncales,
+		QueuedAt:    req.QueuedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	c := newCall(pc, req)
+	e.register(pc.UniqueID, c)
+
+	vars := make(map[string]string, len(req.Variables)+6)
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+	vars["APICALL_UNIQUEID"] = pc.UniqueID
+	vars["APICALL_PROJECT_ID"] = fmt.Sprintf("%d", req.Project.ID)
+	vars["APICALL_CAMPAIGN_ID"] = fmt.Sprintf("%d", req.CampaignID)
+	vars["APICALL_CONTACT_ID"] = fmt.Sprintf("%d", req.ContactID)
+	vars["APICALL_LOG_ID"] = fmt.Sprintf("%d", pc.LogID)
+	vars["APICALL_TELEFONO"] = req.Destination
+	for k, v := range pc.SIPHeaders {
+		vars[k] = v
+	}
+
+	err = e.client.Originate(OriginateParams{
+		ChannelID: pc.UniqueID,
+		Endpoint:  fmt.Sprintf("SIP/%s/%s", pc.Trunk, pc.DialNumber),
+		AppArgs:   []string{"ivr"},
+		CallerID:  pc.CallerID,
+		Timeout:   req.Timeout,
+		Variables: vars,
+	})
+	if err != nil {
+		e.unregister(pc.UniqueID)
+		e.pre.Abort(pc, "FAILED")
+		return fmt.Errorf("failed to originate via ARI: %w", err)
+	}
+
+	log.Printf("[ARI] Originate %s -> %s (log=%d)", pc.UniqueID, req.Destination, pc.LogID)
+	return nil
+}
+
+// hangupDisposition mapea la causa Q.850 de un canal que no llegó a contestar (misma tabla que el handler AMI)
+func hangupDisposition(cause int) (string, string) {
+	switch cause {
+	case 17:
+		return "COMPLETED", "B"
+	case 18, 19, 21:
+		return "COMPLETED", "NA"
+	case 1, 27:
+		return "FAILED", "NI"
+	case 34, 38:
+		return "FAILED", "CONG"
+	default:
+		return "COMPLETED", "NA"
+	}
+}
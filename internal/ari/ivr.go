@@ -0,0 +1,354 @@
+package ari
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/dialer"
+	"apicall/internal/i18n"
+
+	"github.com/google/uuid"
+)
+
+// errHangup indica que el destino colgó durante el IVR
+var errHangup = errors.New("canal colgado")
+
+// errTimeout indica que no llegó el evento esperado a tiempo
+var errTimeout = errors.New("timeout")
+
+// call es una llamada originada por el motor ARI
+type call struct {
+	id         string // channel id = UniqueID interno del tracker
+	logID      int64
+	contactID  int64
+	campaignID int
+	trunk      string
+	proyecto   *database.Proyecto
+	events     chan Event
+
+	mu      sync.Mutex
+	stasis  bool
+	step    string
+	audio   string
+	stepAt  time.Time
+	startAt time.Time
+	dialAt  time.Time
+}
+
+func newCall(pc *dialer.PreparedCall, req dialer.DialRequest) *call {
+	return &call{
+		id:         pc.UniqueID,
+		logID:      pc.LogID,
+		contactID:  req.ContactID,
+		campaignID: req.CampaignID,
+		trunk:      pc.Trunk,
+		proyecto:   req.Project,
+		events:     make(chan Event, 64),
+		dialAt:     time.Now(),
+	}
+}
+
+// start marca que el canal entró en Stasis; devuelve false si ya había entrado
+func (c *call) start() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stasis {
+		return false
+	}
+	c.stasis = true
+	c.startAt = time.Now()
+	return true
+}
+
+func (c *call) started() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stasis
+}
+
+func (c *call) deliver(ev Event) {
+	select {
+	case c.events <- ev:
+	default:
+		log.Printf("[ARI] Cola de eventos llena para %s, descartando %s", c.id, ev.Type)
+	}
+}
+
+func (c *call) setStep(step, audio string) {
+	c.step, c.audio, c.stepAt = step, audio, time.Now()
+}
+
+func (c *call) seconds() int {
+	return int(time.Since(c.startAt).Seconds())
+}
+
+// timing devuelve los segundos de timbrado (originate a respuesta o al cuelgue) y de conversación
+func (c *call) timing() (ring, talk int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stasis {
+		return int(time.Since(c.dialAt).Seconds()), 0
+	}
+	return int(c.startAt.Sub(c.dialAt).Seconds()), int(time.Since(c.startAt).Seconds())
+}
+
+// isHangup indica si el evento termina el canal indicado
+func isHangup(ev Event, channelID string) bool {
+	if ev.channelID() != channelID {
+		return false
+	}
+	switch ev.Type {
+	case "StasisEnd", "ChannelDestroyed", "ChannelHangupRequest":
+		return true
+	}
+	return false
+}
+
+// next espera el próximo evento de la llamada; el colgado del canal principal es errHangup
+func (c *call) next(timeout time.Duration) (Event, error) {
+	select {
+	case ev := <-c.events:
+		if isHangup(ev, c.id) {
+			return ev, errHangup
+		}
+		return ev, nil
+	case <-time.After(timeout):
+		return Event{}, errTimeout
+	}
+}
+
+// runIVR ejecuta el flujo del proyecto: audio, DTMF y transferencia
+func (e *Engine) runIVR(c *call) {
+	defer e.client.Hangup(c.id)
+
+	if err := e.ivr(c); errors.Is(err, errHangup) {
+		e.abandon(c, "")
+	} else if err != nil {
+		log.Printf("[ARI] IVR %s: %v", c.id, err)
+	}
+}
+
+func (e *Engine) ivr(c *call) error {
+	p := c.proyecto
+	uniqueid := c.id
+
+	c.setStep("answer", "")
+	if err := e.client.Answer(c.id); err != nil {
+		e.updateLog(c, "COMPLETED", "NA", false, "", 0, nil)
+		return err
+	}
+	e.updateLog(c, "CONNECTED", "A", false, "", 0, &uniqueid)
+	e.repo.AddCallEvent(c.logID, database.CallEventAnswered, c.id)
+
+	c.setStep("audio", p.Audio)
+	digit, err := e.play(c, p.Audio)
+	if err != nil {
+		if !errors.Is(err, errHangup) {
+			e.updateLog(c, "COMPLETED", "FAIL", true, "", c.seconds(), nil)
+		}
+		return err
+	}
+
+	maxAttempts := 2
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if digit == "" {
+			c.setStep("dtmf", "")
+			digit, err = e.waitDigit(c, 10*time.Second)
+			if errors.Is(err, errHangup) {
+				return err
+			}
+		}
+
+		if digit == p.DTMFEsperado {
+			c.setStep("confirm", i18n.PromptConfirm)
+			if _, err := e.play(c, i18n.Prompt(p.Locale, i18n.PromptConfirm)); errors.Is(err, errHangup) {
+				return e.abandonWith(c, digit)
+			}
+			return e.transfer(c, digit)
+		}
+
+		if attempt == maxAttempts {
+			e.updateLog(c, "COMPLETED", "N", true, digit, c.seconds(), nil)
+			return nil
+		}
+		c.setStep("invalid_audio", i18n.PromptInvalid)
+		if digit, err = e.play(c, i18n.Prompt(p.Locale, i18n.PromptInvalid)); errors.Is(err, errHangup) {
+			return err
+		}
+	}
+	return nil
+}
+
+// play reproduce un audio del proyecto; si el destino marca un dígito se corta y se devuelve
+func (e *Engine) play(c *call, audio string) (string, error) {
+	playbackID := uuid.New().String()
+	media := fmt.Sprintf("sound:%s/%s", e.cfg.Asterisk.SoundPath, audio)
+	if err := e.client.Play(c.id, playbackID, media); err != nil {
+		return "", err
+	}
+	e.repo.AddCallEvent(c.logID, database.CallEventAudio, audio)
+
+	deadline := time.Now().Add(e.cfg.FastAGI.MediaDeadline())
+	for {
+		ev, err := c.next(time.Until(deadline))
+		if err != nil {
+			if errors.Is(err, errTimeout) {
+				e.client.StopPlayback(playbackID)
+			}
+			return "", err
+		}
+		switch ev.Type {
+		case "ChannelDtmfReceived":
+			e.client.StopPlayback(playbackID)
+			e.repo.AddCallEvent(c.logID, database.CallEventDTMF, ev.Digit)
+			return ev.Digit, nil
+		case "PlaybackFinished":
+			if ev.Playback != nil && ev.Playback.ID == playbackID {
+				return "", nil
+			}
+		}
+	}
+}
+
+// waitDigit espera un DTMF; "" si vence el timeout
+func (e *Engine) waitDigit(c *call, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		ev, err := c.next(time.Until(deadline))
+		if errors.Is(err, errTimeout) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if ev.Type == "ChannelDtmfReceived" {
+			e.repo.AddCallEvent(c.logID, database.CallEventDTMF, ev.Digit)
+			return ev.Digit, nil
+		}
+	}
+}
+
+// transfer origina la pierna hacia numero_desborde por la misma troncal y la une
+// al canal del destino en un bridge de mezcla
+func (e *Engine) transfer(c *call, dtmf string) error {
+	p := c.proyecto
+	xferID := uuid.New().String()
+	bridgeID := uuid.New().String()
+
+	c.setStep("transfer", "")
+	if err := e.client.CreateBridge(bridgeID); err != nil {
+		e.updateLog(c, "FAILED", "FAIL", true, dtmf, c.seconds(), nil)
+		return err
+	}
+	defer e.client.DestroyBridge(bridgeID)
+
+	e.register(xferID, c)
+	defer e.unregister(xferID)
+
+	err := e.client.Originate(OriginateParams{
+		ChannelID: xferID,
+		Endpoint:  fmt.Sprintf("SIP/%s/%s%s", c.trunk, p.PrefijoSalida, p.NumeroDesborde),
+		AppArgs:   []string{"xfer", c.id},
+		CallerID:  p.CallerID,
+		Timeout:   time.Duration(p.TransferTimeout) * time.Second,
+	})
+	if err != nil {
+		e.updateLog(c, "FAILED", "FAIL", true, dtmf, c.seconds(), nil)
+		return err
+	}
+	log.Printf("[ARI] Transfiriendo %s a %s", c.id, p.NumeroDesborde)
+	e.repo.AddCallEvent(c.logID, database.CallEventTransfer, fmt.Sprintf("desborde %s vía %s", p.NumeroDesborde, c.trunk))
+
+	bridged := false
+	deadline := time.Now().Add(e.cfg.FastAGI.BridgeDeadline())
+	for {
+		ev, err := c.next(time.Until(deadline))
+		if err != nil {
+			e.client.Hangup(xferID)
+			if errors.Is(err, errHangup) {
+				if bridged {
+					return nil // Conversación terminada por el destino
+				}
+				return e.abandonWith(c, dtmf)
+			}
+			return err
+		}
+
+		switch {
+		case ev.Type == "StasisStart" && ev.channelID() == xferID:
+			if err := e.client.AddToBridge(bridgeID, c.id, xferID); err != nil {
+				e.client.Hangup(xferID)
+				e.updateLog(c, "FAILED", "FAIL", true, dtmf, c.seconds(), nil)
+				return err
+			}
+			bridged = true
+			e.updateLog(c, "COMPLETED", "XFER", true, dtmf, c.seconds(), nil)
+			e.repo.AddCallEvent(c.logID, database.CallEventTransfer, "conectada")
+		case isHangup(ev, xferID):
+			if bridged {
+				return nil // El agente cortó: se cuelga al destino
+			}
+			if ev.Type != "ChannelDestroyed" {
+				continue
+			}
+			// El número de desborde no contestó
+			log.Printf("[ARI] Transferencia %s fallida (causa %d)", c.id, ev.Cause)
+			e.repo.AddCallEvent(c.logID, database.CallEventTransfer, fmt.Sprintf("fallida (causa %d)", ev.Cause))
+			if p.TransferFailAudio != "" {
+				c.setStep("transfer_fail", p.TransferFailAudio)
+				if _, err := e.play(c, p.TransferFailAudio); errors.Is(err, errHangup) {
+					return e.abandonWith(c, dtmf)
+				}
+			}
+			e.updateLog(c, "COMPLETED", "XFERFAIL", true, dtmf, c.seconds(), nil)
+			return nil
+		}
+	}
+}
+
+// abandonWith registra el abandono conservando el DTMF ya marcado
+func (e *Engine) abandonWith(c *call, dtmf string) error {
+	e.abandon(c, dtmf)
+	return nil
+}
+
+// abandon registra que el destino colgó y en qué paso del IVR (disposition AB)
+func (e *Engine) abandon(c *call, dtmf string) {
+	e.updateLog(c, "COMPLETED", "AB", c.step != "answer", dtmf, c.seconds(), nil)
+	if c.logID == 0 {
+		return
+	}
+	if err := e.repo.MarkCallAbandoned(c.logID, c.step, c.audio, int(time.Since(c.stepAt).Seconds())); err != nil {
+		log.Printf("[ARI] %v", err)
+	}
+}
+
+// updateLog actualiza el log y el estado del contacto de campaña
+func (e *Engine) updateLog(c *call, status, disposition string, interacciono bool, dtmf string, duracion int, uniqueid *string) {
+	if c.logID == 0 {
+		return
+	}
+
+	var dtmfPtr *string
+	if dtmf != "" {
+		dtmfPtr = &dtmf
+	}
+	if err := e.repo.UpdateCallLog(c.logID, dtmfPtr, &disposition, uniqueid, interacciono, status, duracion); err != nil {
+		log.Printf("[ARI] Error actualizando log: %v", err)
+	}
+
+	if c.contactID > 0 && status != "CONNECTED" {
+		contactStatus := "failed"
+		switch disposition {
+		case "A", "XFER", "CB":
+			contactStatus = "completed"
+		}
+		if err := e.repo.UpdateContactStatus(c.contactID, contactStatus, &disposition); err != nil {
+			log.Printf("[ARI] Error actualizando contacto %d: %v", c.contactID, err)
+		}
+	}
+}
@@ -1,34 +1,88 @@
 package asterisk
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
-	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"apicall/internal/database"
 	"apicall/internal/dialer"
-	"apicall/internal/smartcid"
-
-	"github.com/google/uuid"
+	"apicall/internal/leader"
 )
 
 const (
 	SpoolDir  = "/var/spool/asterisk/outgoing"
 	TmpDir    = "/var/spool/asterisk/outgoing/.staging"
-	QueueSize = 10000
+	QueueSize = 10000 // Buffer en memoria; el resto espera en apicall_spool_queue
+	// MaxBacklog es el máximo de llamadas en cola persistente antes de rechazar nuevas (backpressure)
+	MaxBacklog = 200000
 )
 
+var (
+	ErrWorkerStopped = errors.New("spooler no iniciado")
+	ErrQueueFull     = errors.New("cola de llamadas llena")
+)
+
+// QueueTicket informa la posición de una llamada recién encolada
+type QueueTicket struct {
+	ID       int64         // ID en apicall_spool_queue
+	Position int           // Posición en la cola (1 = siguiente)
+	ETA      time.Duration // Estimado hasta generar el .call según el CPS actual
+}
+
 // CallJob represents a call request
 type CallJob struct {
 	Proyecto   *database.Proyecto
 	Telefono   string
 	ContactID  int64  // ID del contacto de campaña (0 si no aplica)
 	CampaignID int    // ID de la campaña (0 si no aplica)
+	Variables  map[string]string // Variables de canal adicionales (Set: K=V)
+	CallerID   string            // Override de Caller ID (vacío = usar el del proyecto / Smart CID)
+	ExternalRef string           // Idempotency-Key / referencia del integrador
+	CallbackOf  int64            // Log de la llamada original si es una rellamada (0 si no aplica)
+	QueueID     int64            // ID en apicall_spool_queue
+	RingTimeout int              // Override del timbrado en segundos (0 = el del proyecto)
+	Troncales   string           // Override de troncales de la campaña "nombre[:peso],..." (vacío = las del proyecto)
+	QueuedAt    time.Time        // Entrada en apicall_spool_queue (evento queued del timeline)
+}
+
+// variableNameRe valida nombres de variables de canal definidos por el integrador
+var variableNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// callerIDRe valida un Caller ID numérico (override por llamada)
+var callerIDRe = regexp.MustCompile(`^\+?[0-9]{3,20}$`)
+
+// ValidateCallerID verifica el formato de un Caller ID de override
+func ValidateCallerID(cid string) error {
+	if !callerIDRe.MatchString(cid) {
+		return fmt.Errorf("caller_id inválido: %q", cid)
+	}
+	return nil
+}
+
+// ValidateVariables verifica que las variables sean seguras para un .call file.
+// El prefijo APICALL_ está reservado para variables internas.
+func ValidateVariables(vars map[string]string) error {
+	for k, v := range vars {
+		if !variableNameRe.MatchString(k) {
+			return fmt.Errorf("nombre de variable inválido: %q", k)
+		}
+		if strings.HasPrefix(strings.ToUpper(k), "APICALL_") {
+			return fmt.Errorf("variable reservada: %s", k)
+		}
+		if strings.ContainsAny(v, "\r\n") || len(v) > 255 {
+			return fmt.Errorf("valor inválido para variable %s", k)
+		}
+	}
+	return nil
 }
 
 var (
@@ -36,21 +90,39 @@ var (
 	workerRunning bool
 	workerLimit   int
 	workerRepo    *database.Repository
-	scidGen       *smartcid.Generator
+	preDial       *dialer.PreDial           // Pipeline común con el AMIDialer (blacklist, CID, límites, log)
+	amiDialer     *dialer.AMIDialer         // Motor para proyectos con dial_engine=ami
+	ariDialer     dialer.Dialer             // Motor para proyectos con dial_engine=ari (nil = ARI deshabilitado)
+	simDialer     dialer.Dialer             // Motor para proyectos con dial_engine=sim (nil = simulación deshabilitada)
+	simAll        bool                      // Todas las llamadas van al simulador (simulation.all)
 	channelPool   *dialer.ChannelPool       // Controls concurrent call limits
 	callTracker   *dialer.ActiveCallTracker // Tracks active calls for correlation
-	orphanCleaner *dialer.OrphanCallCleaner // Cleans up orphaned calls
+	noCallFiles   bool                      // Sin acceso al spool de Asterisk (transport=ami): todo se origina por AMI
+
+	transport SpoolTransport = localTransport{} // Entrega de los .call files (local o SFTP)
+
+	baseCPS   atomic.Int32             // max_cps del YAML (fallback si no hay valor en DB)
+	cpsReload = make(chan struct{}, 1) // Despierta el loop para re-evaluar el CPS
+
+	backlog    atomic.Int64             // Llamadas en apicall_spool_queue (incluye el buffer en memoria)
+	currentCPS atomic.Int32             // CPS efectivo del loop, para el ETA
+	feedWake   = make(chan struct{}, 1) // Despierta al feeder cuando se encola una llamada
 )
 
-// StartWorker initiates the spool worker
-func StartWorker(maxCPS int, repo *database.Repository, pool *dialer.ChannelPool, tracker *dialer.ActiveCallTracker) {
+// StartWorker initiates the spool worker.
+// Las llamadas de proyectos con dial_engine=ami se originan con amiDialer en lugar de un .call.
+func StartWorker(maxCPS int, repo *database.Repository, pre *dialer.PreDial, ami *dialer.AMIDialer) {
 	if workerRunning {
 		return
 	}
 
 	// Ensure staging dir exists (essential for atomic moves on same filesystem)
-	if err := os.MkdirAll(TmpDir, 0777); err != nil {
-		log.Printf("[Spooler] ERROR CRITICO: No se pudo crear directorio de staging %s: %v", TmpDir, err)
+	if noCallFiles {
+		log.Println("[Spooler] Spool de .call files deshabilitado: dial_engine=spool se origina por AMI")
+	} else if _, local := transport.(localTransport); local {
+		if err := os.MkdirAll(TmpDir, 0777); err != nil {
+			log.Printf("[Spooler] ERROR CRITICO: No se pudo crear directorio de staging %s: %v", TmpDir, err)
+		}
 	}
 
 
@@ -71,29 +143,28 @@ func StartWorker(maxCPS int, repo *database.Repository, pool *dialer.ChannelPool
 	}
 
 	workerLimit = cps
+	if maxCPS > 0 {
+		baseCPS.Store(int32(maxCPS))
+	}
 	workerRepo = repo
 	jobQueue = make(chan CallJob, QueueSize)
 
-	// Use injected ChannelPool and Tracker
-	channelPool = pool
-	callTracker = tracker
-	log.Printf("[Spooler] ChannelPool and CallTracker injected")
-
-	// Start orphan cleaner
-	orphanCleaner = dialer.NewOrphanCallCleaner(repo, channelPool, callTracker)
-	orphanCleaner.Start()
-
-	// Init SmartCID
-	if repo.GetDB() != nil {
-		scidGen = smartcid.NewGenerator(repo.GetDB())
-		log.Printf("[Spooler] Smart CID Generator inicializado")
-	} else {
-		log.Printf("[Spooler] WARNING: No se pudo inicializar Smart CID Generator (DB es nil)")
+	// Retomar llamadas que quedaron en cola antes del reinicio (en HA lo hace la líder en feedQueue)
+	if leader.IsLeader() {
+		resetQueue()
 	}
 
+	// Use injected pre-dial pipeline (ChannelPool, Tracker, Smart CID)
+	preDial = pre
+	amiDialer = ami
+	channelPool = pre.Pool()
+	callTracker = pre.Tracker()
+	log.Printf("[Spooler] PreDial pipeline injected")
+
 	workerRunning = true
 	log.Printf("[Spooler] Worker iniciado (MaxCPS: %d)", cps)
 
+	go feedQueue()
 	go processQueue()
 }
 
@@ -105,18 +176,197 @@ func QueueCall(proyecto *database.Proyecto, telefono string) {
 // QueueCampaignCall queues a call with campaign tracking
 // Returns true if queued successfully, false if rejected (queue full or worker stopped)
 func QueueCampaignCall(proyecto *database.Proyecto, telefono string, contactID int64, campaignID int) bool {
+	_, err := QueueJob(CallJob{Proyecto: proyecto, Telefono: telefono, ContactID: contactID, CampaignID: campaignID})
+	return err == nil
+}
+
+// QueueJob persiste un CallJob en apicall_spool_queue y devuelve su posición en la cola.
+// Rechaza con ErrQueueFull cuando la cola supera MaxBacklog.
+func QueueJob(job CallJob) (*QueueTicket, error) {
 	if !workerRunning {
-		log.Printf("[Spooler] Worker no iniciado, rechazando llamada a %s", telefono)
-		return false
+		log.Printf("[Spooler] Worker no iniciado, rechazando llamada a %s", job.Telefono)
+		return nil, ErrWorkerStopped
+	}
+	if backlog.Load() >= MaxBacklog {
+		log.Printf("[Spooler] Cola llena (%d), rechazando llamada a %s", MaxBacklog, job.Telefono)
+		return nil, ErrQueueFull
 	}
 
+	entry := &database.SpoolJob{
+		ProyectoID:  job.Proyecto.ID,
+		Telefono:    job.Telefono,
+		ContactID:   job.ContactID,
+		CampaignID:  job.CampaignID,
+		CallerID:    job.CallerID,
+		ExternalRef: job.ExternalRef,
+		CallbackOf:  job.CallbackOf,
+		RingTimeout: job.RingTimeout,
+		Troncales:   job.Troncales,
+	}
+	if len(job.Variables) > 0 {
+		if data, err := json.Marshal(job.Variables); err == nil {
+			vars := string(data)
+			entry.Variables = &vars
+		}
+	}
+
+	id, err := workerRepo.EnqueueSpoolJob(entry)
+	if err != nil {
+		return nil, err
+	}
+	position := backlog.Add(1)
+
 	select {
-	case jobQueue <- CallJob{Proyecto: proyecto, Telefono: telefono, ContactID: contactID, CampaignID: campaignID}:
-		return true
+	case feedWake <- struct{}{}:
 	default:
-		log.Printf("[Spooler] Cola llena, rechazando llamada a %s", telefono)
-		return false
 	}
+
+	return &QueueTicket{ID: id, Position: int(position), ETA: QueueETA(int(position))}, nil
+}
+
+// QueueBacklog devuelve la cantidad de llamadas pendientes de generar su .call
+func QueueBacklog() int {
+	return int(backlog.Load())
+}
+
+// QueueETA estima el tiempo hasta procesar la posición indicada al CPS actual
+func QueueETA(position int) time.Duration {
+	cps := int(currentCPS.Load())
+	if cps <= 0 {
+		cps = 1
+	}
+	return time.Duration((position+cps-1)/cps) * time.Second
+}
+
+// feedQueue mueve llamadas de apicall_spool_queue al buffer en memoria en orden de llegada.
+// Es el único productor de jobQueue, así que los lugares libres calculados no cambian al encolar.
+func feedQueue() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	wasLeader := leader.IsLeader()
+	for {
+		// Solo la instancia líder carga la cola; al asumir retoma lo que cargó la anterior
+		isLeader := leader.IsLeader()
+		if isLeader && !wasLeader {
+			resetQueue()
+		}
+		wasLeader = isLeader
+
+		// En una instancia no líder el backlog lo consume otra: tomarlo de la BD
+		if !isLeader {
+			if n, err := workerRepo.CountSpoolJobs(); err == nil {
+				backlog.Store(int64(n))
+			}
+		}
+
+		if free := QueueSize - len(jobQueue); free > 0 && isLeader {
+			jobs, err := workerRepo.ClaimSpoolJobs(free, leader.ID())
+			if err != nil {
+				log.Printf("[Spooler] %v", err)
+			}
+
+			proyectos := make(map[int]*database.Proyecto)
+			for _, entry := range jobs {
+				job, err := restoreJob(entry, proyectos)
+				if err != nil {
+					log.Printf("[Spooler] Descartando llamada %d de la cola: %v", entry.ID, err)
+					dequeue(entry.ID)
+					continue
+				}
+				jobQueue <- job
+			}
+			// Lote completo: probablemente quedan más, seguir sin esperar
+			if len(jobs) == free {
+				continue
+			}
+		}
+
+		select {
+		case <-feedWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// resetQueue libera las llamadas cargadas por otro proceso y actualiza el backlog
+func resetQueue() {
+	pending, err := workerRepo.ResetSpoolJobs(leader.ID())
+	if err != nil {
+		log.Printf("[Spooler] ERROR leyendo cola persistente: %v", err)
+		return
+	}
+	if pending > 0 {
+		log.Printf("[Spooler] Retomando %d llamadas pendientes de la cola persistente", pending)
+	}
+	backlog.Store(int64(pending))
+}
+
+// restoreJob reconstruye el CallJob de una entrada de la cola persistente
+func restoreJob(entry database.SpoolJob, proyectos map[int]*database.Proyecto) (CallJob, error) {
+	proyecto, ok := proyectos[entry.ProyectoID]
+	if !ok {
+		p, err := workerRepo.GetProyecto(entry.ProyectoID)
+		if err != nil {
+			return CallJob{}, err
+		}
+		proyecto = p
+		proyectos[entry.ProyectoID] = p
+	}
+
+	job := CallJob{
+		Proyecto:    proyecto,
+		Telefono:    entry.Telefono,
+		ContactID:   entry.ContactID,
+		CampaignID:  entry.CampaignID,
+		CallerID:    entry.CallerID,
+		ExternalRef: entry.ExternalRef,
+		CallbackOf:  entry.CallbackOf,
+		QueueID:     entry.ID,
+		RingTimeout: entry.RingTimeout,
+		Troncales:   entry.Troncales,
+		QueuedAt:    entry.CreatedAt,
+	}
+	if entry.Variables != nil {
+		if err := json.Unmarshal([]byte(*entry.Variables), &job.Variables); err != nil {
+			return CallJob{}, fmt.Errorf("variables inválidas: %w", err)
+		}
+	}
+	return job, nil
+}
+
+// dequeue quita una llamada de la cola persistente
+func dequeue(id int64) {
+	if err := workerRepo.DeleteSpoolJob(id); err != nil {
+		log.Printf("[Spooler] %v", err)
+	}
+	backlog.Add(-1)
+}
+
+// SetMaxCPS actualiza el CPS base (YAML) en caliente.
+// Si apicall_config.max_cps tiene valor, ese sigue teniendo prioridad.
+func SetMaxCPS(cps int) {
+	if cps <= 0 {
+		return
+	}
+	baseCPS.Store(int32(cps))
+	select {
+	case cpsReload <- struct{}{}:
+	default:
+	}
+}
+
+// desiredCPS resuelve el CPS objetivo: DB primero, luego YAML
+func desiredCPS() int {
+	if workerRepo != nil {
+		val, err := workerRepo.GetConfig("max_cps")
+		if err == nil && val != "" {
+			if v, err := strconv.Atoi(val); err == nil && v > 0 {
+				return v
+			}
+		}
+	}
+	return int(baseCPS.Load())
 }
 
 func processQueue() {
@@ -134,6 +384,18 @@ func processQueue() {
 	defer configTicker.Stop()
 
 	log.Printf("[Spooler] Processing loop started at %d CPS", currentTPS)
+	currentCPS.Store(int32(currentTPS))
+
+	applyCPS := func(newCPS int) {
+		if newCPS > 0 && newCPS != currentTPS {
+			log.Printf("[Spooler] Updating CPS from %d to %d", currentTPS, newCPS)
+			currentTPS = newCPS
+			currentCPS.Store(int32(currentTPS))
+			ticker.Stop()
+			interval = time.Second / time.Duration(currentTPS)
+			ticker = time.NewTicker(interval)
+		}
+	}
 
 	for {
 		select {
@@ -143,116 +405,131 @@ func processQueue() {
 				return
 			}
 			<-ticker.C
-			generateCallFile(job)
+			// Se quita de la cola antes de marcar: un reinicio a mitad no duplica la llamada
+			dequeue(job.QueueID)
+			dispatchJob(job)
 		case <-configTicker.C:
-			if workerRepo != nil {
-				val, err := workerRepo.GetConfig("max_cps")
-				if err == nil && val != "" {
-					newCPS, err := strconv.Atoi(val)
-					if err == nil && newCPS > 0 && newCPS != currentTPS {
-						log.Printf("[Spooler] Updating CPS from %d to %d", currentTPS, newCPS)
-						currentTPS = newCPS
-						ticker.Stop()
-						interval = time.Second / time.Duration(currentTPS)
-						ticker = time.NewTicker(interval)
-					}
-				}
-			}
+			applyCPS(desiredCPS())
+		case <-cpsReload:
+			applyCPS(desiredCPS())
 		}
 	}
 }
 
-func generateCallFile(job CallJob) {
-	uniqueID := uuid.New().String()
-	fileName := fmt.Sprintf("apicall_%d_%s_%s.call", job.Proyecto.ID, job.Telefono, uniqueID)
-	tmpPath := filepath.Join(TmpDir, fileName)
-	destPath := filepath.Join(SpoolDir, fileName)
-
-	// Smart Caller ID Determination
-	cid := job.Proyecto.CallerID
-	if scidGen != nil && job.Proyecto.SmartCIDActive {
-		generatedCID := scidGen.GetCallerID(job.Telefono, cid, job.Proyecto.SmartCIDActive)
-		log.Printf("[Spooler] Smart CID: Proyecto=%d, Destino=%s, Original=%s, Generado=%s",
-			job.Proyecto.ID, job.Telefono, cid, generatedCID)
-		cid = generatedCID
-	} else {
-		log.Printf("[Spooler] Usando CID estático: Proyecto=%d, CID=%s (SmartGen=%v, SmartActive=%v)",
-			job.Proyecto.ID, cid, scidGen != nil, job.Proyecto.SmartCIDActive)
-	}
-
-	// Create DB Log
-	var campaignID *int
-	if job.CampaignID > 0 {
-		cid := job.CampaignID
-		campaignID = &cid
-	}
-
-	callLog := &database.CallLog{
-		ProyectoID:   job.Proyecto.ID,
-		Telefono:     job.Telefono,
-		Status:       "DIALING",
-		Interacciono: false,
-		CallerIDUsed: cid,
-		CampaignID:   campaignID,
-	}
-
-	logID, err := workerRepo.CreateCallLog(callLog)
-	if err != nil {
-		log.Printf("[Spooler] Error creando log DB: %v", err)
-		return
+// dispatchJob marca un job con el motor del proyecto (dial_engine)
+func dispatchJob(job CallJob) {
+	// Originate es síncrono (espera la respuesta de Asterisk): no bloquear el loop de CPS
+	switch {
+	case simDialer != nil && (simAll || job.Proyecto.DialEngine == dialer.EngineSim):
+		go originateJob(simDialer, job)
+	case job.Proyecto.DialEngine == dialer.EngineAMI && amiDialer != nil:
+		go originateJob(amiDialer, job)
+	case job.Proyecto.DialEngine == dialer.EngineARI && ariDialer != nil:
+		go originateJob(ariDialer, job)
+	case noCallFiles && amiDialer != nil:
+		go originateJob(amiDialer, job)
+	default:
+		if _, local := transport.(localTransport); !local {
+			go generateCallFile(job) // Entrega remota: la latencia de red no frena el CPS
+			return
+		}
+		generateCallFile(job)
 	}
+}
 
-	// Create .call content
-	// Use SIP/<trunk>/<number> format instead of Local
-	// Add prefix if configured
-	dialNumber := job.Telefono
-	if job.Proyecto.PrefijoSalida != "" {
-		dialNumber = job.Proyecto.PrefijoSalida + job.Telefono
-		log.Printf("[Spooler] Agregando prefijo: %s + %s = %s",
-			job.Proyecto.PrefijoSalida, job.Telefono, dialNumber)
-	}
+// SetSpoolTransport cambia la entrega de los .call files (ej: SFTP a un Asterisk remoto).
+// Debe llamarse antes de StartWorker.
+func SetSpoolTransport(t SpoolTransport) {
+	transport = t
+}
 
-	// LOAD BALANCING LOGIC
-	var selectedTrunk string
+// DisableCallFiles evita los .call files (asterisk.spool.transport=ami o modo container).
+// Debe llamarse antes de StartWorker.
+func DisableCallFiles() {
+	noCallFiles = true
+}
 
-	// 1. Try relational table
-	if workerRepo != nil {
-		names, err := workerRepo.GetTroncalesNamesByProyecto(job.Proyecto.ID)
-		if err == nil && len(names) > 0 {
-			selectedTrunk = names[rand.Intn(len(names))]
-			if len(names) > 1 {
-				log.Printf("[Spooler] Load Balancing (Table): Selected trunk '%s' from list %v", selectedTrunk, names)
-			}
-		}
+// SetARIDialer registra el motor ARI para los proyectos con dial_engine=ari
+func SetARIDialer(d dialer.Dialer) {
+	ariDialer = d
+}
+
+// SetSimDialer registra el motor de simulación para dial_engine=sim (all = para todas las llamadas).
+// Debe llamarse antes de StartWorker.
+func SetSimDialer(d dialer.Dialer, all bool) {
+	simDialer, simAll = d, all
+}
+
+// originateJob marca un job con un motor de Originate (AMI, ARI o simulación)
+func originateJob(d dialer.Dialer, job CallJob) {
+	err := d.Dial(dialer.DialRequest{
+		CampaignID:  job.CampaignID,
+		ContactID:   job.ContactID,
+		Project:     job.Proyecto,
+		Destination: job.Telefono,
+		Variables:   job.Variables,
+		Timeout:     dialer.RingTimeout(job.Proyecto, job.RingTimeout),
+		CallerID:    job.CallerID,
+		ExternalRef: job.ExternalRef,
+		CallbackOf:  job.CallbackOf,
+		Troncales:   job.Troncales,
+		QueuedAt:    job.QueuedAt,
+	})
+	if err != nil {
+		log.Printf("[Spooler] Originate %s falló para %s: %v", job.Proyecto.DialEngine, job.Telefono, err)
+		rejectJob(job, err)
 	}
+}
 
-	// 2. Fallback to comma-separated string
-	if selectedTrunk == "" {
-		trunks := strings.Split(job.Proyecto.TroncalSalida, ",")
-		selectedTrunk = strings.TrimSpace(trunks[0])
-		if len(trunks) > 1 {
-			selectedTrunk = strings.TrimSpace(trunks[rand.Intn(len(trunks))])
-			log.Printf("[Spooler] Load Balancing (Legacy): Selected trunk '%s' from '%s'", selectedTrunk, job.Proyecto.TroncalSalida)
-		}
+// rejectJob devuelve a pendiente el contacto de campaña cuyo job no se pudo marcar
+func rejectJob(job CallJob, err error) {
+	if job.ContactID == 0 {
+		return
 	}
+	if errors.Is(err, dialer.ErrBlacklisted) {
+		skipped := "BLACKLISTED"
+		workerRepo.UpdateContactStatus(job.ContactID, "skipped", &skipped)
+		return
+	}
+	if errors.Is(err, dialer.ErrDestinationDenied) {
+		skipped := "PREFIX_DENIED"
+		workerRepo.UpdateContactStatus(job.ContactID, "skipped", &skipped)
+		return
+	}
+	if errors.Is(err, dialer.ErrAttemptCap) {
+		skipped := "ATTEMPT_CAP"
+		workerRepo.UpdateContactStatus(job.ContactID, "skipped", &skipped)
+		return
+	}
+	workerRepo.UpdateContactStatus(job.ContactID, "pending", nil)
+}
 
-	// CHECK CHANNEL LIMITS before proceeding
-	if channelPool != nil && !channelPool.Acquire(selectedTrunk) {
-		log.Printf("[Spooler] Channel limit reached, rejecting call to %s (trunk: %s)", job.Telefono, selectedTrunk)
-		workerRepo.UpdateCallLog(logID, nil, nil, nil, false, "CHANNEL_LIMIT", 0)
-		// Update contact status if applicable
-		if job.ContactID > 0 {
-			pending := "pending" // Return to pending so it can be retried
-			workerRepo.UpdateContactStatus(job.ContactID, pending, nil)
-		}
+func generateCallFile(job CallJob) {
+	pc, err := preDial.Prepare(dialer.CallSpec{
+		Proyecto:    job.Proyecto,
+		Telefono:    job.Telefono,
+		ContactID:   job.ContactID,
+		CampaignID:  job.CampaignID,
+		Variables:   job.Variables,
+		CallerID:    job.CallerID,
+		ExternalRef: job.ExternalRef,
+		CallbackOf:  job.CallbackOf,
+		Troncales:   job.Troncales,
+		QueuedAt:    job.QueuedAt,
+	})
+	if err != nil {
+		log.Printf("[Spooler] Llamada a %s no marcada: %v", job.Telefono, err)
+		rejectJob(job, err)
 		return
 	}
 
+	fileName := fmt.Sprintf("apicall_%d_%s_%s.call", job.Proyecto.ID, job.Telefono, pc.UniqueID)
+
 	content := fmt.Sprintf(`Channel: SIP/%s/%s
 CallerID: "%s" <%s>
 MaxRetries: %d
 RetryTime: %d
-WaitTime: 45
+WaitTime: %d
 Context: apicall_context
 Extension: s
 Priority: 1
@@ -262,77 +539,46 @@ Set: APICALL_TELEFONO=%s
 Set: APICALL_UNIQUEID=%s
 Set: APICALL_CONTACT_ID=%d
 Set: APICALL_CAMPAIGN_ID=%d
-Archive: yes
-`, selectedTrunk, dialNumber,
-		job.Proyecto.Nombre, cid,
+%sArchive: yes
+`, pc.Trunk, pc.DialNumber,
+		job.Proyecto.Nombre, pc.CallerID,
 		job.Proyecto.MaxRetries,
 		job.Proyecto.RetryTime,
-		logID,
+		int(dialer.RingTimeout(job.Proyecto, job.RingTimeout).Seconds()),
+		pc.LogID,
 		job.Proyecto.ID,
 		job.Telefono,
-		uniqueID,
+		pc.UniqueID,
 		job.ContactID,
 		job.CampaignID,
+		formatExtraVariables(job.Variables)+formatExtraVariables(pc.SIPHeaders),
 	)
 
-	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
-		log.Printf("[Spooler] Error escribiendo archivo tmp: %v", err)
-		workerRepo.UpdateCallLog(logID, nil, nil, nil, false, "SPOOL_ERROR", 0)
-		return
-	}
-
-	// Register active call for tracking BEFORE moving file
-	// This prevents race condition where Asterisk executes and sends event
-	// before we track it
-	if callTracker != nil {
-		callTracker.Add(&dialer.ActiveCall{
-			UniqueID:   uniqueID,
-			LogID:      logID,
-			ContactID:  job.ContactID,
-			CampaignID: job.CampaignID,
-			ProyectoID: job.Proyecto.ID,
-			Trunk:      selectedTrunk,
-			Telefono:   job.Telefono,
-			StartTime:  time.Now(),
-		})
-	}
-
-	// Atomic Move
-	if err := os.Rename(tmpPath, destPath); err != nil {
-		log.Printf("[Spooler] Error moviendo archivo a spool: %v", err)
-		os.Remove(tmpPath)
-		workerRepo.UpdateCallLog(logID, nil, nil, nil, false, "SPOOL_ERROR", 0)
-		
-		// Rollback tracking and limits
-		if callTracker != nil {
-			callTracker.Remove(uniqueID)
-		}
-		if channelPool != nil {
-			channelPool.Release(selectedTrunk)
-		}
+	// Staging + atomic move (el tracking ya quedó registrado en Prepare, antes de que Asterisk lo ejecute)
+	if err := transport.Deliver(fileName, []byte(content)); err != nil {
+		log.Printf("[Spooler] Error entregando %s: %v", fileName, err)
+		preDial.Abort(pc, "SPOOL_ERROR")
 		return
 	}
 }
 
-// ReleaseChannel releases a channel slot when a call ends
-// Called by AMI event handler when a call completes
-func ReleaseChannel(uniqueID string) {
-	if callTracker == nil {
-		return
+// formatExtraVariables genera las líneas "Set:" para variables del integrador
+// (orden estable para facilitar el diagnóstico de los .call)
+func formatExtraVariables(vars map[string]string) string {
+	if len(vars) == 0 {
+		return ""
 	}
-	
-	call := callTracker.Remove(uniqueID)
-	if call != nil && channelPool != nil {
-		channelPool.Release(call.Trunk)
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
 	}
-}
+	sort.Strings(keys)
 
-// GetActiveCall retrieves an active call by uniqueID
-func GetActiveCall(uniqueID string) *dialer.ActiveCall {
-	if callTracker == nil {
-		return nil
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("Set: %s=%s\n", k, vars[k]))
 	}
-	return callTracker.Get(uniqueID)
+	return sb.String()
 }
 
 // GetChannelStats returns current channel pool statistics
@@ -344,6 +590,35 @@ func GetChannelStats() *dialer.PoolStats {
 	return &stats
 }
 
+// GetQuotaStatus devuelve el consumo de las cuotas (diaria y simultáneas) de un proyecto
+func GetQuotaStatus(proyecto *database.Proyecto) (*dialer.QuotaStatus, error) {
+	if preDial == nil {
+		return nil, ErrWorkerStopped
+	}
+	return preDial.Quotas().Status(proyecto)
+}
+
+// GetAttemptStatus devuelve los intentos de hoy del número (todos los proyectos) y el límite que aplica
+func GetAttemptStatus(proyecto *database.Proyecto, telefono string) (*dialer.AttemptStatus, error) {
+	if preDial == nil {
+		return nil, ErrWorkerStopped
+	}
+	return preDial.Attempts().Status(proyecto, telefono)
+}
+
+// GetAttemptCounts devuelve el límite de intentos del proyecto y los intentos de hoy de cada número
+func GetAttemptCounts(proyecto *database.Proyecto, telefonos []string) (int, map[string]int, error) {
+	if preDial == nil {
+		return 0, nil, ErrWorkerStopped
+	}
+	return preDial.Attempts().Counts(proyecto, telefonos)
+}
+
+// AudioMissing indica si el audio principal del proyecto no existe (el Spooler no lo marcaría)
+func AudioMissing(proyecto *database.Proyecto) bool {
+	return preDial != nil && preDial.AudioMissing(proyecto)
+}
+
 // GetActiveCallCount returns the number of active calls
 func GetActiveCallCount() int {
 	if callTracker == nil {
@@ -0,0 +1,186 @@
+package asterisk
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/sftp"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SpoolTransport entrega un .call file al directorio outgoing de Asterisk.
+// El archivo se escribe primero en un staging del mismo filesystem y se mueve con un rename
+// atómico, para que Asterisk nunca lea un archivo a medias.
+type SpoolTransport interface {
+	Deliver(fileName string, content []byte) error
+}
+
+// localTransport escribe en el spool del mismo host (SpoolDir)
+type localTransport struct{}
+
+func (localTransport) Deliver(fileName string, content []byte) error {
+	tmpPath := filepath.Join(TmpDir, fileName)
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("error escribiendo archivo tmp: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(SpoolDir, fileName)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error moviendo archivo a spool: %w", err)
+	}
+	return nil
+}
+
+// SFTPTransport entrega los .call files a un Asterisk remoto por SFTP.
+// La conexión se abre en el primer envío y se rehace si se cae.
+type SFTPTransport struct {
+	cfg       config.SpoolConfig
+	sshConfig *ssh.ClientConfig
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// NewSFTPTransport valida credenciales y known_hosts; no conecta hasta el primer envío
+func NewSFTPTransport(cfg config.SpoolConfig) (*SFTPTransport, error) {
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo key_file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("key_file inválida: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("asterisk.spool: se requiere key_file o password")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case cfg.KnownHosts != "":
+		cb, err := knownhosts.New(cfg.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo known_hosts: %w", err)
+		}
+		hostKey = cb
+	case cfg.InsecureIgnoreHostKey:
+		log.Println("[Spooler] WARNING: SFTP sin verificación de clave de host (insecure_ignore_host_key)")
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("asterisk.spool: se requiere known_hosts (o insecure_ignore_host_key)")
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &SFTPTransport{
+		cfg: cfg,
+		sshConfig: &ssh.ClientConfig{
+			User:            cfg.Username,
+			Auth:            auth,
+			HostKeyCallback: hostKey,
+			Timeout:         timeout,
+		},
+	}, nil
+}
+
+// Deliver escribe el archivo en <remote_dir>/.staging y lo mueve a <remote_dir>.
+// Si la sesión estaba caída reconecta y reintenta una vez.
+func (t *SFTPTransport) Deliver(fileName string, content []byte) error {
+	client, err := t.session()
+	if err != nil {
+		return err
+	}
+	err = t.deliver(client, fileName, content)
+	if err != nil && client.Err() != nil {
+		// La sesión se cayó (ej: reinicio de sshd): reconectar y reintentar una vez
+		if client, err = t.session(); err != nil {
+			return err
+		}
+		err = t.deliver(client, fileName, content)
+	}
+	return err
+}
+
+func (t *SFTPTransport) deliver(client *sftp.Client, fileName string, content []byte) error {
+	dir := t.cfg.Dir()
+	tmpPath := path.Join(dir, ".staging", fileName)
+	if err := client.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", tmpPath, err)
+	}
+	if err := client.Rename(tmpPath, path.Join(dir, fileName)); err != nil {
+		client.Remove(tmpPath)
+		return fmt.Errorf("error moviendo archivo a spool remoto: %w", err)
+	}
+	return nil
+}
+
+// session devuelve la sesión SFTP activa, conectando si hace falta
+func (t *SFTPTransport) session() (*sftp.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil && t.client.Err() == nil {
+		return t.client, nil
+	}
+	t.closeLocked()
+
+	addr := t.cfg.Address()
+	conn, err := ssh.Dial("tcp", addr, t.sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error conectando SFTP a %s: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// El staging debe existir en el mismo filesystem que outgoing (si ya existe el MKDIR falla y se ignora)
+	client.Mkdir(path.Join(t.cfg.Dir(), ".staging"), 0775)
+
+	t.conn, t.client = conn, client
+	log.Printf("[Spooler] ✓ Spool remoto conectado por SFTP (%s:%s)", addr, t.cfg.Dir())
+	return client, nil
+}
+
+func (t *SFTPTransport) closeLocked() {
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// Close cierra la conexión SFTP
+func (t *SFTPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeLocked()
+	return nil
+}
+
+// Ping conecta (o verifica la sesión) con el Asterisk remoto
+func (t *SFTPTransport) Ping() error {
+	_, err := t.session()
+	return err
+}
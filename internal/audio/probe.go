@@ -0,0 +1,114 @@
+// Package audio reúne utilidades sobre los archivos de la biblioteca de audios del IVR
+package audio
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Dir es el directorio de audios de apicall dentro de los sounds de Asterisk
+const Dir = "/var/lib/asterisk/sounds/apicall"
+
+// Duration devuelve la duración en segundos usando soxi (incluido con sox) o, si no está, ffprobe
+func Duration(path string) (float64, error) {
+	probes := [][]string{
+		{"soxi", "-D", path},
+		{"ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", path},
+	}
+	var lastErr error
+	for _, probe := range probes {
+		out, err := exec.Command(probe[0], probe[1:]...).Output()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return seconds, nil
+	}
+	return 0, fmt.Errorf("no se pudo obtener la duración de %s: %w", filepath.Base(path), lastErr)
+}
+
+// Convert convierte src al formato que reproduce Asterisk (WAV 8000 Hz, mono, 16 bits) con sox.
+// sox no lee contenedores WebM (grabaciones del navegador): esos se decodifican antes con ffmpeg.
+func Convert(src, dst string) error {
+	if strings.EqualFold(filepath.Ext(src), ".webm") {
+		decoded := strings.TrimSuffix(src, filepath.Ext(src)) + ".decoded.wav"
+		defer os.Remove(decoded)
+		if out, err := exec.Command("ffmpeg", "-y", "-v", "error", "-i", src, decoded).CombinedOutput(); err != nil {
+			return fmt.Errorf("error decodificando webm con ffmpeg: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+		src = decoded
+	}
+	if out, err := exec.Command("sox", src, "-r", "8000", "-c", "1", "-b", "16", dst).CombinedOutput(); err != nil {
+		return fmt.Errorf("error convirtiendo audio con sox: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SanitizeName deja solo minúsculas, dígitos, '-' y '_' (nombre de archivo sin extensión)
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			sb.WriteRune(c)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+// RefNames devuelve las formas en que un proyecto o encuesta puede referenciar el archivo
+// name: con o sin extensión y con o sin el prefijo apicall/
+func RefNames(name string) []string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	names := []string{name, base, "apicall/" + name, "apicall/" + base}
+	if name == base {
+		names = append(names, base+".wav", "apicall/"+base+".wav")
+	}
+	return names
+}
+
+// Missing indica si ref (relativa a soundPath, con o sin extensión) no tiene ningún archivo de audio.
+// Si soundPath no es accesible desde este nodo (Asterisk remoto sin volumen compartido) no se puede
+// comprobar y devuelve false.
+func Missing(soundPath, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	if _, err := os.Stat(soundPath); err != nil {
+		return false
+	}
+	path := filepath.Join(soundPath, ref)
+	if filepath.Ext(ref) != "" {
+		if _, err := os.Stat(path); err == nil {
+			return false
+		}
+	}
+	// Sin extensión Asterisk elige el formato: basta cualquier archivo base.*
+	matches, _ := filepath.Glob(path + ".*")
+	return len(matches) == 0
+}
+
+// ParseTags normaliza una lista de etiquetas separadas por coma (minúsculas, sin repetidas)
+func ParseTags(raw string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy define los requisitos de complejidad de contraseñas
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Validate verifica que la contraseña cumpla la política
+func (p PasswordPolicy) Validate(password string) error {
+	var missing []string
+	if len([]rune(password)) < p.MinLength {
+		missing = append(missing, fmt.Sprintf("mínimo %d caracteres", p.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		missing = append(missing, "una mayúscula")
+	}
+	if p.RequireLower && !lower {
+		missing = append(missing, "una minúscula")
+	}
+	if p.RequireDigit && !digit {
+		missing = append(missing, "un número")
+	}
+	if p.RequireSymbol && !symbol {
+		missing = append(missing, "un símbolo")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("la contraseña debe tener: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// RevocationTTL es cada cuánto se recarga la lista de sesiones revocadas (revocaciones hechas en otra instancia)
+	RevocationTTL = 5 * time.Second
+	// seenInterval es cada cuánto se registra la última actividad de las sesiones usadas
+	seenInterval = time.Minute
+)
+
+// SessionStore es la persistencia de las sesiones (database.Repository)
+type SessionStore interface {
+	// RevokedSessions devuelve las sesiones revocadas cuyo token todavía no vence (sesión -> vencimiento)
+	RevokedSessions() (map[string]time.Time, error)
+	// TouchUserSessions registra actividad en las sesiones indicadas
+	TouchUserSessions(ids []string) error
+}
+
+// Sessions mantiene en memoria la lista de sesiones revocadas: el middleware la consulta sin ir a la
+// base en cada solicitud. Se recarga en segundo plano como mucho cada RevocationTTL; las revocaciones
+// de esta instancia se aplican al instante.
+type Sessions struct {
+	store SessionStore
+
+	mu       sync.RWMutex
+	revoked  map[string]time.Time // Cargadas de la base: sesión -> vencimiento
+	recent   map[string]time.Time // Revocadas en esta instancia: sesión -> momento de la revocación
+	seen     map[string]struct{}
+	loadedAt time.Time
+	seenAt   time.Time
+	loading  bool
+}
+
+// NewSessions crea la lista de revocaciones y hace la primera carga
+func NewSessions(store SessionStore) *Sessions {
+	s := &Sessions{
+		store:   store,
+		revoked: make(map[string]time.Time),
+		recent:  make(map[string]time.Time),
+		seen:    make(map[string]struct{}),
+		seenAt:  time.Now(),
+	}
+	s.reload()
+	return s
+}
+
+// IsRevoked indica si la sesión fue revocada (cerrada, cambio de contraseña o forzada por un admin)
+func (s *Sessions) IsRevoked(id string) bool {
+	s.mu.RLock()
+	_, revoked := s.revoked[id]
+	if !revoked {
+		_, revoked = s.recent[id]
+	}
+	stale := !s.loading && time.Since(s.loadedAt) >= RevocationTTL
+	s.mu.RUnlock()
+	if stale {
+		s.mu.Lock()
+		if !s.loading && time.Since(s.loadedAt) >= RevocationTTL {
+			s.loading = true
+			go s.reload()
+		}
+		s.mu.Unlock()
+	}
+	return revoked
+}
+
+// Revoke marca sesiones como revocadas en esta instancia (la base ya las tiene revocadas)
+func (s *Sessions) Revoke(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		s.recent[id] = now
+	}
+}
+
+// Seen registra actividad de la sesión (se guarda en la base con la siguiente recarga)
+func (s *Sessions) Seen(id string) {
+	s.mu.RLock()
+	_, ok := s.seen[id]
+	s.mu.RUnlock()
+	if ok {
+		return
+	}
+	s.mu.Lock()
+	s.seen[id] = struct{}{}
+	s.mu.Unlock()
+}
+
+// reload recarga las revocaciones; si la consulta falla se mantiene la lista anterior
+func (s *Sessions) reload() {
+	start := time.Now()
+	revoked, err := s.store.RevokedSessions()
+
+	s.mu.Lock()
+	s.loading = false
+	s.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("[Auth] Error cargando sesiones revocadas: %v", err)
+	} else {
+		s.revoked = revoked
+		// Las revocaciones locales anteriores a la consulta ya vienen de la base
+		for id, at := range s.recent {
+			if at.Before(start) {
+				delete(s.recent, id)
+			}
+		}
+	}
+	var seen []string
+	if time.Since(s.seenAt) >= seenInterval && len(s.seen) > 0 {
+		for id := range s.seen {
+			seen = append(seen, id)
+		}
+		s.seen = make(map[string]struct{})
+		s.seenAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if len(seen) > 0 {
+		if err := s.store.TouchUserSessions(seen); err != nil {
+			log.Printf("[Auth] Error registrando actividad de sesiones: %v", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPIssuer es el nombre con el que la app autenticadora muestra la cuenta
+	TOTPIssuer = "APICall"
+	// RecoveryCodes es la cantidad de códigos de recuperación que se generan
+	RecoveryCodes = 10
+
+	totpPeriod = 30 // Segundos por código
+	totpDigits = 6
+	totpSkew   = 1 // Códigos aceptados antes y después del actual (desfase de reloj)
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret genera un secreto TOTP aleatorio (160 bits en base32)
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURL arma la URL otpauth:// que se muestra como QR para dar de alta el secreto en la app autenticadora
+func TOTPURL(account, secret string) string {
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", TOTPIssuer)
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ValidateTOTP verifica un código contra el secreto, tolerando un período de desfase. Solo acepta códigos
+// posteriores a lastStep (un código ya usado no se acepta de nuevo) y devuelve el período que validó.
+func ValidateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode calcula el código de un período (RFC 6238, HMAC-SHA1)
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0F
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes genera códigos de recuperación de un solo uso (xxxxx-xxxxx) y sus hashes
+func GenerateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodes; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode normaliza un código de recuperación (sin guiones ni espacios, en minúsculas) y lo hashea
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package blacklist
+
+import (
+	"log"
+
+	"apicall/internal/database"
+	"apicall/internal/phone"
+)
+
+// NormalizeNumbers lleva los números bloqueados del proyecto al formato E.164 de su país, el mismo con
+// el que se marcan. Los cargados antes de configurar pais quedaron en formato nacional y de otro modo
+// no coincidirían con los números marcados. Sin país no hay nada que hacer.
+func NormalizeNumbers(repo *database.Repository, p *database.Proyecto) {
+	if p.Pais == "" {
+		return
+	}
+	n, err := repo.NormalizeBlacklist(p.ID, func(tel string) (string, error) {
+		return phone.Normalize(tel, p.Pais)
+	})
+	if err != nil {
+		log.Printf("[Blacklist] Error normalizando la blacklist del proyecto %d: %v", p.ID, err)
+	}
+	if n > 0 {
+		log.Printf("[Blacklist] Proyecto %d: %d números de la blacklist normalizados a %s", p.ID, n, p.Pais)
+	}
+}
+
+// NormalizeAll normaliza la blacklist de todos los proyectos con país (al arrancar)
+func NormalizeAll(repo *database.Repository) {
+	proyectos, err := repo.ListProyectos()
+	if err != nil {
+		log.Printf("[Blacklist] %v", err)
+		return
+	}
+	for i := range proyectos {
+		NormalizeNumbers(repo, &proyectos[i])
+	}
+}
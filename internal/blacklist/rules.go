@@ -0,0 +1,197 @@
+package blacklist
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+const (
+	// rulesTTL es cada cuánto se recargan las reglas activas
+	rulesTTL = 30 * time.Second
+	// queueSize es cuántos lotes de llamadas finalizadas pueden esperar evaluación
+	queueSize = 1000
+	// MaxConsecutivos limita las llamadas que una regla puede exigir
+	MaxConsecutivos = 20
+)
+
+// Evaluator aplica las reglas de blacklist automática de cada proyecto a las llamadas que
+// acaban de finalizar (Repository.OnCallFinished). Cada instancia evalúa las llamadas que
+// ella misma cerró, por lo que no depende del líder en HA.
+type Evaluator struct {
+	repo     *database.Repository
+	queue    chan []int64
+	rules    map[int][]database.BlacklistRule // proyecto -> reglas activas
+	loadedAt time.Time
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewEvaluator crea el evaluador de reglas de blacklist
+func NewEvaluator(repo *database.Repository) *Evaluator {
+	return &Evaluator{
+		repo:     repo,
+		queue:    make(chan []int64, queueSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el evaluador y lo engancha al cierre de llamadas del repositorio
+func (e *Evaluator) Start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running {
+		return
+	}
+	e.running = true
+	e.wg.Add(1)
+	go e.run()
+	e.repo.OnCallFinished("blacklist", e.Notify)
+	log.Println("[Blacklist] Evaluador de reglas iniciado")
+}
+
+// Stop detiene el evaluador
+func (e *Evaluator) Stop() {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = false
+	e.mu.Unlock()
+
+	e.repo.OnCallFinished("blacklist", nil)
+	close(e.stopChan)
+	e.wg.Wait()
+	log.Println("[Blacklist] Evaluador de reglas detenido")
+}
+
+// Notify encola llamadas finalizadas para evaluar; no bloquea (se llama desde el batcher)
+func (e *Evaluator) Notify(ids []int64) {
+	select {
+	case e.queue <- ids:
+	default:
+		log.Printf("[Blacklist] WARNING: Cola llena, %d llamadas sin evaluar", len(ids))
+	}
+}
+
+func (e *Evaluator) run() {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-e.stopChan:
+			return
+		case ids := <-e.queue:
+			e.evaluate(ids)
+		}
+	}
+}
+
+// evaluate aplica las reglas del proyecto a cada llamada; la primera regla cumplida bloquea el número
+func (e *Evaluator) evaluate(ids []int64) {
+	e.loadRules()
+	if len(e.rules) == 0 {
+		return
+	}
+
+	calls, err := e.repo.GetCallLogsByIDs(ids)
+	if err != nil {
+		log.Printf("[Blacklist] Error leyendo llamadas finalizadas: %v", err)
+		return
+	}
+	for _, call := range calls {
+		for _, rule := range e.rules[call.ProyectoID] {
+			if e.fulfilled(rule, call) {
+				e.block(rule, call)
+				break
+			}
+		}
+	}
+}
+
+// loadRules recarga las reglas activas como mucho cada rulesTTL
+func (e *Evaluator) loadRules() {
+	if time.Since(e.loadedAt) < rulesTTL {
+		return
+	}
+	rules, err := e.repo.GetActiveBlacklistRules()
+	if err != nil {
+		log.Printf("[Blacklist] Error cargando reglas: %v", err)
+		return
+	}
+	e.loadedAt = time.Now()
+	e.rules = make(map[int][]database.BlacklistRule)
+	for _, rule := range rules {
+		e.rules[rule.ProyectoID] = append(e.rules[rule.ProyectoID], rule)
+	}
+}
+
+// fulfilled indica si la llamada y, según consecutivos, las anteriores del número cumplen la regla
+func (e *Evaluator) fulfilled(rule database.BlacklistRule, call database.CallLog) bool {
+	if !matches(rule, call) {
+		return false
+	}
+	if rule.Consecutivos <= 1 {
+		return true
+	}
+	last, err := e.repo.GetLastFinishedCalls(call.ProyectoID, call.Telefono, rule.Consecutivos)
+	if err != nil {
+		log.Printf("[Blacklist] Error leyendo historial de %s: %v", call.Telefono, err)
+		return false
+	}
+	if len(last) < rule.Consecutivos {
+		return false
+	}
+	for _, prev := range last {
+		if !matches(rule, prev) {
+			return false
+		}
+	}
+	return true
+}
+
+func matches(rule database.BlacklistRule, call database.CallLog) bool {
+	switch rule.Tipo {
+	case database.RuleDisposition:
+		return call.Disposition == rule.Valor
+	case database.RuleDTMF:
+		return call.DTMFMarcado == rule.Valor
+	}
+	return false
+}
+
+// block agrega el número a la blacklist del proyecto y, si la regla es de baja, lo descarta
+// en las campañas que aún no lo marcaron
+func (e *Evaluator) block(rule database.BlacklistRule, call database.CallLog) {
+	if blocked, err := e.repo.IsBlacklisted(call.ProyectoID, call.Telefono); err == nil && blocked {
+		return
+	}
+	razon := fmt.Sprintf("Regla %d: %s %s", rule.ID, rule.Tipo, rule.Valor)
+	if rule.Consecutivos > 1 {
+		razon += fmt.Sprintf(" x%d", rule.Consecutivos)
+	}
+	if rule.DNC {
+		razon = "DNC - " + razon
+	}
+	entry := &database.BlacklistEntry{ProyectoID: call.ProyectoID, Telefono: call.Telefono, Razon: &razon}
+	if err := e.repo.AddToBlacklist(entry); err != nil {
+		log.Printf("[Blacklist] Error bloqueando %s (proyecto %d): %v", call.Telefono, call.ProyectoID, err)
+		return
+	}
+	log.Printf("[Blacklist] %s bloqueado en proyecto %d (%s, log %d)", call.Telefono, call.ProyectoID, razon, call.ID)
+
+	if rule.DNC {
+		skipped, err := e.repo.SkipPendingContactsByPhone(call.ProyectoID, call.Telefono, "DNC")
+		if err != nil {
+			log.Printf("[Blacklist] Error descartando contactos de %s: %v", call.Telefono, err)
+		} else if skipped > 0 {
+			log.Printf("[Blacklist] %d contactos pendientes de %s descartados (DNC)", skipped, call.Telefono)
+		}
+	}
+}
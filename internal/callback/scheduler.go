@@ -0,0 +1,135 @@
+package callback
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/asterisk"
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+const (
+	// SchedulerInterval es cada cuánto se buscan rellamadas con la ventana abierta
+	SchedulerInterval = 30 * time.Second
+
+	batchSize = 50
+)
+
+// Scheduler vuelve a marcar los números que pidieron rellamada desde el IVR,
+// dentro de la ventana solicitada. El log resultante queda enlazado a la
+// llamada original mediante callback_of.
+type Scheduler struct {
+	repo     *database.Repository
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewScheduler crea un nuevo scheduler de rellamadas
+func NewScheduler(repo *database.Repository) *Scheduler {
+	return &Scheduler{
+		repo:     repo,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el scheduler
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+	s.wg.Add(1)
+	go s.run()
+	log.Println("[Callback] Scheduler de rellamadas iniciado")
+}
+
+// Stop detiene el scheduler
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	s.mu.Unlock()
+
+	close(s.stopChan)
+	s.wg.Wait()
+	log.Println("[Callback] Scheduler de rellamadas detenido")
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.dispatch()
+		}
+	}
+}
+
+// dispatch encola las rellamadas cuya ventana está abierta y vence las que ya cerraron
+func (s *Scheduler) dispatch() {
+	if !leader.IsLeader() {
+		return
+	}
+	now := time.Now()
+
+	if n, err := s.repo.ExpireCallbacks(now); err != nil {
+		log.Printf("[Callback] %v", err)
+	} else if n > 0 {
+		log.Printf("[Callback] %d rellamadas vencidas sin marcar", n)
+	}
+
+	callbacks, err := s.repo.GetDueCallbacks(now, batchSize)
+	if err != nil {
+		log.Printf("[Callback] %v", err)
+		return
+	}
+
+	for _, cb := range callbacks {
+		proyecto, err := s.repo.GetProyecto(cb.ProyectoID)
+		if err != nil {
+			log.Printf("[Callback] Rellamada %d: %v", cb.ID, err)
+			continue
+		}
+
+		// El número pudo entrar a la blacklist después de pedir la rellamada
+		if blocked, err := s.repo.IsBlacklisted(cb.ProyectoID, cb.Telefono); err == nil && blocked {
+			log.Printf("[Callback] Rellamada %d descartada: %s en blacklist", cb.ID, cb.Telefono)
+			s.repo.UpdateCallbackEstado(cb.ID, "skipped")
+			continue
+		}
+
+		job := asterisk.CallJob{Proyecto: proyecto, Telefono: cb.Telefono, CallbackOf: cb.OriginalLogID}
+		if cb.CampaignID != nil {
+			job.CampaignID = *cb.CampaignID
+		}
+		if cb.ContactID != nil {
+			job.ContactID = *cb.ContactID
+		}
+
+		// Cola llena: se reintenta en el próximo ciclo mientras la ventana siga abierta
+		if _, err := asterisk.QueueJob(job); err != nil {
+			log.Printf("[Callback] Rellamada %d no encolada: %v", cb.ID, err)
+			return
+		}
+		if err := s.repo.UpdateCallbackEstado(cb.ID, "dialed"); err != nil {
+			log.Printf("[Callback] %v", err)
+		}
+		log.Printf("[Callback] Rellamada %d encolada: %s (original log %d)", cb.ID, cb.Telefono, cb.OriginalLogID)
+	}
+}
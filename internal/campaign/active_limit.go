@@ -0,0 +1,121 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"apicall/internal/database"
+)
+
+// ErrActiveLimit se devuelve al iniciar una campaña cuando ya hay tantas activas como permite la configuración
+var ErrActiveLimit = errors.New("límite de campañas activas alcanzado")
+
+// ActiveLimits son los topes de campañas activas simultáneas (0 = sin límite)
+type ActiveLimits struct {
+	Global      int // campaigns.max_active
+	PerProyecto int // campaigns.max_active_per_proyecto
+}
+
+// ActiveLimiter aplica los topes de campañas activas; se comparte entre la API (al iniciar) y el
+// Sweeper (al marcar) y se actualiza al recargar la configuración. nil = sin límites.
+type ActiveLimiter struct {
+	mu     sync.RWMutex
+	limits ActiveLimits
+}
+
+// NewActiveLimiter crea el limitador con los topes indicados
+func NewActiveLimiter(limits ActiveLimits) *ActiveLimiter {
+	return &ActiveLimiter{limits: limits}
+}
+
+// Set reemplaza los topes (recarga de configuración)
+func (a *ActiveLimiter) Set(limits ActiveLimits) {
+	a.mu.Lock()
+	a.limits = limits
+	a.mu.Unlock()
+}
+
+// Limits devuelve los topes vigentes
+func (a *ActiveLimiter) Limits() ActiveLimits {
+	if a == nil {
+		return ActiveLimits{}
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.limits
+}
+
+// CheckStart verifica si c puede pasar a activa dadas las campañas ya activas (de todas las organizaciones).
+// Una campaña que ya está activa siempre pasa.
+func (a *ActiveLimiter) CheckStart(active []database.Campaign, c *database.Campaign) error {
+	limits := a.Limits()
+	global, proyecto := 0, 0
+	for _, other := range active {
+		if other.ID == c.ID {
+			return nil
+		}
+		global++
+		if other.ProyectoID == c.ProyectoID {
+			proyecto++
+		}
+	}
+	if limits.Global > 0 && global >= limits.Global {
+		return fmt.Errorf("%w: hay %d campañas activas en el sistema (máximo %d); pause o detenga otra antes de iniciar esta", ErrActiveLimit, global, limits.Global)
+	}
+	if limits.PerProyecto > 0 && proyecto >= limits.PerProyecto {
+		return fmt.Errorf("%w: el proyecto ya tiene %d campañas activas (máximo %d); pause o detenga otra antes de iniciar esta", ErrActiveLimit, proyecto, limits.PerProyecto)
+	}
+	return nil
+}
+
+// Admit reparte los topes entre las campañas activas: gana la que se inició primero (fecha_inicio, luego id).
+// Devuelve las que pueden marcar y las que exceden el tope, ambas en el orden recibido.
+// Cubre los inicios simultáneos que pasaron CheckStart y los topes reducidos en caliente.
+func (a *ActiveLimiter) Admit(campaigns []database.Campaign) ([]database.Campaign, []database.Campaign) {
+	limits := a.Limits()
+	if limits.Global <= 0 && limits.PerProyecto <= 0 {
+		return campaigns, nil
+	}
+
+	byAge := make([]*database.Campaign, len(campaigns))
+	for i := range campaigns {
+		byAge[i] = &campaigns[i]
+	}
+	sort.SliceStable(byAge, func(i, j int) bool {
+		ti, tj := byAge[i].FechaInicio, byAge[j].FechaInicio
+		switch {
+		case ti == nil && tj == nil:
+			return byAge[i].ID < byAge[j].ID
+		case ti == nil || tj == nil:
+			return tj == nil // Sin fecha de inicio al final
+		case !ti.Equal(*tj):
+			return ti.Before(*tj)
+		}
+		return byAge[i].ID < byAge[j].ID
+	})
+
+	admitted := make(map[int]bool, len(campaigns))
+	perProyecto := make(map[int]int)
+	for _, c := range byAge {
+		if limits.Global > 0 && len(admitted) >= limits.Global {
+			break
+		}
+		if limits.PerProyecto > 0 && perProyecto[c.ProyectoID] >= limits.PerProyecto {
+			continue
+		}
+		admitted[c.ID] = true
+		perProyecto[c.ProyectoID]++
+	}
+
+	var in, out []database.Campaign
+	for _, c := range campaigns {
+		if admitted[c.ID] {
+			in = append(in, c)
+		} else {
+			out = append(out, c)
+		}
+	}
+	return in, out
+}
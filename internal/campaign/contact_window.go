@@ -0,0 +1,81 @@
+package campaign
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+)
+
+const (
+	// ContactZonesInterval es cada cuánto se recargan las zonas horarias de los contactos de una campaña
+	ContactZonesInterval = time.Minute
+	// zoneAssignBatch es el máximo de contactos a los que se asigna la zona del prefijo por recarga
+	zoneAssignBatch = 10000
+)
+
+// zoneCache son las zonas de las franjas y prefijos de los contactos pendientes de una campaña
+type zoneCache struct {
+	zones    []string
+	loadedAt time.Time
+}
+
+// claimFilter arma el filtro de hora local de los contactos a reclamar: la hora actual de cada zona
+// de las franjas y prefijos ("" = la del proyecto) y, si el proyecto tiene horario_local, las zonas
+// dentro de ese horario. Los contactos cuya zona no figura (o no carga) esperan a la próxima recarga.
+func (s *Sweeper) claimFilter(c *database.Campaign, p *database.Proyecto, now time.Time) database.ClaimFilter {
+	cached := s.zones[c.ID]
+	if cached == nil || now.Sub(cached.loadedAt) >= ContactZonesInterval {
+		full := false
+		if p.HorarioLocal != "" {
+			n, err := s.repo.AssignContactZones(c.ID, zoneAssignBatch)
+			if err != nil {
+				log.Printf("[Sweeper] Error assigning contact zones for campaign %d: %v", c.ID, err)
+			}
+			full = n == zoneAssignBatch
+		}
+		zones, err := s.repo.GetContactZones(c.ID)
+		if err != nil {
+			log.Printf("[Sweeper] Error loading contact zones for campaign %d: %v", c.ID, err)
+		}
+		if cached == nil || err == nil {
+			cached = &zoneCache{zones: zones, loadedAt: now}
+			if full {
+				cached.loadedAt = time.Time{} // Quedan contactos sin zona: se sigue en el próximo ciclo
+			}
+			s.zones[c.ID] = cached
+		}
+	}
+
+	f := database.ClaimFilter{LocalTimes: map[string]string{"": now.In(s.location(c)).Format("15:04:05")}}
+	for _, zone := range cached.zones {
+		if zone == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			continue
+		}
+		f.LocalTimes[zone] = now.In(loc).Format("15:04:05")
+	}
+
+	if inicio, fin, ok := strings.Cut(p.HorarioLocal, "-"); ok {
+		f.LocalHours = true
+		for zone, t := range f.LocalTimes {
+			if withinHours(t, inicio, fin) {
+				f.OpenZones = append(f.OpenZones, zone)
+			}
+		}
+	}
+	return f
+}
+
+// withinHours indica si la hora t ("HH:MM:SS") está en [inicio, fin); con fin menor que inicio el
+// horario cruza la medianoche
+func withinHours(t, inicio, fin string) bool {
+	if inicio <= fin {
+		return t >= inicio && t < fin
+	}
+	return t >= inicio || t < fin
+}
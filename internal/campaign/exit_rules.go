@@ -0,0 +1,153 @@
+package campaign
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/eventbus"
+	"apicall/internal/notify"
+	"apicall/internal/webhook"
+	ws "apicall/internal/websocket"
+)
+
+const (
+	// ExitRulesInterval es cada cuánto se evalúan las reglas de salida de cada campaña activa
+	ExitRulesInterval = 30 * time.Second
+	// DefaultASRWindow son las llamadas evaluadas si la campaña no define exit_asr_window
+	DefaultASRWindow = 500
+	// DefaultAbandonHours es la ventana del abandono si la campaña no define exit_abandon_hours
+	DefaultAbandonHours = 24
+	// MinAbandonSample son las contestadas por humano necesarias para evaluar exit_max_abandon
+	MinAbandonSample = 100
+)
+
+// AbandonHours es la ventana deslizante en horas de la tasa de abandono de la campaña
+func AbandonHours(c *database.Campaign) int {
+	if c.ExitAbandonHours > 0 {
+		return c.ExitAbandonHours
+	}
+	return DefaultAbandonHours
+}
+
+// hasExitRules indica si la campaña define alguna regla de salida
+func hasExitRules(c *database.Campaign) bool {
+	return c.ExitMinASR > 0 || c.ExitDailyMinutes > 0 || c.ExitMaxConnects > 0 || c.ExitMaxAbandon > 0
+}
+
+// exitRule devuelve la primera regla que se cumple (vacío = ninguna) y su descripción.
+// abandon es nil si la campaña no limita el abandono.
+func exitRule(c *database.Campaign, m *database.CampaignExitMetrics, window int, abandon *database.CampaignAbandonStats) (string, string) {
+	if c.ExitMaxConnects > 0 && m.Connects >= c.ExitMaxConnects {
+		return "max_connects", fmt.Sprintf("%d conexiones (límite %d)", m.Connects, c.ExitMaxConnects)
+	}
+	if c.ExitDailyMinutes > 0 && m.DailySeconds >= c.ExitDailyMinutes*60 {
+		return "daily_minutes", fmt.Sprintf("%d minutos hablados hoy (presupuesto %d)", m.DailySeconds/60, c.ExitDailyMinutes)
+	}
+	// El ASR solo se evalúa con la ventana completa, para no cortar por las primeras llamadas
+	if c.ExitMinASR > 0 && m.WindowCalls >= window {
+		asr := float64(m.WindowAnswered) * 100 / float64(m.WindowCalls)
+		if asr < c.ExitMinASR {
+			return "min_asr", fmt.Sprintf("ASR %.1f%% en las últimas %d llamadas (mínimo %.1f%%)", asr, m.WindowCalls, c.ExitMinASR)
+		}
+	}
+	// El abandono se evalúa con una muestra mínima de contestadas por humano en la ventana
+	if abandon != nil && abandon.Human >= MinAbandonSample {
+		if rate := abandon.AbandonRate * 100; rate > c.ExitMaxAbandon {
+			return "max_abandon", fmt.Sprintf("abandono %.2f%% (%d de %d contestadas por humano) en las últimas %dh (máximo %.2f%%)",
+				rate, abandon.Abandoned, abandon.Human, abandon.WindowHours, c.ExitMaxAbandon)
+		}
+	}
+	return "", ""
+}
+
+// checkExitRules evalúa las reglas de salida de la campaña (como máximo cada ExitRulesInterval).
+// Si alguna se cumple pausa la campaña, avisa por WebSocket y al result_url, y devuelve true.
+func (s *Sweeper) checkExitRules(c *database.Campaign) bool {
+	if !hasExitRules(c) {
+		return false
+	}
+	now := time.Now()
+	if last, ok := s.exitChecks[c.ID]; ok && now.Sub(last) < ExitRulesInterval {
+		return false
+	}
+	s.exitChecks[c.ID] = now
+
+	window := c.ExitASRWindow
+	if window <= 0 {
+		window = DefaultASRWindow
+	}
+	var dispositions []string
+	for _, d := range strings.Split(c.ExitDispositions, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			dispositions = append(dispositions, d)
+		}
+	}
+
+	metrics, err := s.repo.GetCampaignExitMetrics(c.ID, window, s.dayStart(c, now), dispositions)
+	if err != nil {
+		log.Printf("[Sweeper] Error evaluando reglas de salida de campaña %d: %v", c.ID, err)
+		return false
+	}
+	var abandon *database.CampaignAbandonStats
+	if c.ExitMaxAbandon > 0 {
+		hours := AbandonHours(c)
+		if abandon, err = s.repo.GetCampaignAbandonStats(c.ID, now.Add(-time.Duration(hours)*time.Hour)); err != nil {
+			log.Printf("[Sweeper] Error calculando abandono de campaña %d: %v", c.ID, err)
+			return false
+		}
+		abandon.WindowHours = hours
+	}
+	rule, reason := exitRule(c, metrics, window, abandon)
+	if rule == "" {
+		return false
+	}
+
+	exited, err := s.repo.ExitCampaign(c.ID, reason)
+	if err != nil {
+		log.Printf("[Sweeper] %v", err)
+		return false
+	}
+	if !exited {
+		return true
+	}
+	log.Printf("[Sweeper] Campaña %d pausada por regla de salida %s: %s", c.ID, rule, reason)
+
+	payload := &webhook.CampaignExitPayload{
+		Event:      "campaign.exit",
+		CampaignID: c.ID,
+		ProyectoID: c.ProyectoID,
+		Nombre:     c.Nombre,
+		Rule:       rule,
+		Reason:     reason,
+		Estado:     "paused",
+		Timestamp:  now,
+	}
+	ws.BroadcastCampaignExit(payload)
+	s.events.PublishCampaign(eventbus.EventCampaignExit, c, payload)
+	s.notifier.Notify(c.ProyectoID, notify.EventCampaignExit,
+		fmt.Sprintf("Campaña %s (ID %d) pausada por la regla de salida %s: %s", c.Nombre, c.ID, rule, reason))
+	if c.ResultURL != "" {
+		go webhook.SendCampaignExit(c.ResultURL, payload)
+	}
+	return true
+}
+
+// dayStart es la medianoche de hoy en la zona horaria del proyecto
+func (s *Sweeper) dayStart(c *database.Campaign, now time.Time) time.Time {
+	loc := s.location(c)
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// location es la zona horaria del proyecto de la campaña (la del servidor si no tiene)
+func (s *Sweeper) location(c *database.Campaign) *time.Location {
+	if p, err := s.repo.GetProyecto(c.ProyectoID); err == nil && p.Timezone != "" {
+		if l, err := time.LoadLocation(p.Timezone); err == nil {
+			return l
+		}
+	}
+	return time.Local
+}
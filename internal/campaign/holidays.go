@@ -0,0 +1,158 @@
+package campaign
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// maxHolidayDays limita los días que genera un evento ICS de varios días
+const maxHolidayDays = 31
+
+// ParseHolidays lee un calendario de feriados en CSV ("fecha;nombre[;anual]", fecha YYYY-MM-DD o
+// DD/MM/YYYY) o ICS (eventos VEVENT; RRULE FREQ=YEARLY = anual). Devuelve los feriados y las líneas
+// o eventos inválidos.
+func ParseHolidays(data []byte) ([]database.Holiday, []string) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("BEGIN:VCALENDAR")) {
+		return parseICS(string(data))
+	}
+	return parseHolidayCSV(string(data))
+}
+
+func parseHolidayCSV(content string) ([]database.Holiday, []string) {
+	var holidays []database.Holiday
+	var invalid []string
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sep := ";"
+		if !strings.Contains(line, sep) {
+			sep = ","
+		}
+		parts := strings.Split(line, sep)
+		fecha, err := parseHolidayDate(strings.TrimSpace(parts[0]))
+		if err != nil {
+			// Encabezado opcional
+			if i == 0 && strings.EqualFold(strings.TrimSpace(parts[0]), "fecha") {
+				continue
+			}
+			invalid = append(invalid, line)
+			continue
+		}
+		h := database.Holiday{Fecha: fecha}
+		if len(parts) > 1 {
+			h.Nombre = truncateHolidayName(parts[1])
+		}
+		if len(parts) > 2 {
+			switch strings.ToLower(strings.TrimSpace(parts[2])) {
+			case "1", "si", "sí", "true", "anual", "yes":
+				h.Anual = true
+			}
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, invalid
+}
+
+func parseHolidayDate(s string) (string, error) {
+	for _, layout := range []string{"2006-01-02", "02/01/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("fecha inválida: %s", s)
+}
+
+// parseICS extrae los eventos de un iCalendar (RFC 5545). Los eventos de varios días (DTEND
+// exclusivo) generan un feriado por día.
+func parseICS(content string) ([]database.Holiday, []string) {
+	// Las líneas que empiezan con espacio o tab continúan la anterior
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\n ", "")
+	content = strings.ReplaceAll(content, "\n\t", "")
+
+	var holidays []database.Holiday
+	var invalid []string
+	var inEvent bool
+	var start, end, summary, rrule string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "BEGIN:VEVENT":
+			inEvent = true
+			start, end, summary, rrule = "", "", "", ""
+			continue
+		case line == "END:VEVENT":
+			inEvent = false
+			days, err := icsDays(start, end)
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("%s (%v)", summary, err))
+				continue
+			}
+			for _, day := range days {
+				holidays = append(holidays, database.Holiday{
+					Fecha:  day,
+					Nombre: truncateHolidayName(summary),
+					Anual:  strings.Contains(rrule, "FREQ=YEARLY"),
+				})
+			}
+			continue
+		case !inEvent:
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(name, ";") // Parámetros (VALUE=DATE, TZID=...)
+		switch strings.ToUpper(name) {
+		case "DTSTART":
+			start = value
+		case "DTEND":
+			end = value
+		case "SUMMARY":
+			summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+		case "RRULE":
+			rrule = strings.ToUpper(value)
+		}
+	}
+	return holidays, invalid
+}
+
+// icsDays devuelve los días YYYY-MM-DD entre DTSTART y DTEND (exclusivo; sin DTEND, solo DTSTART)
+func icsDays(start, end string) ([]string, error) {
+	if len(start) < 8 {
+		return nil, fmt.Errorf("DTSTART inválido: %q", start)
+	}
+	from, err := time.Parse("20060102", start[:8])
+	if err != nil {
+		return nil, fmt.Errorf("DTSTART inválido: %q", start)
+	}
+	to := from.AddDate(0, 0, 1)
+	if len(end) >= 8 {
+		if t, err := time.Parse("20060102", end[:8]); err == nil && t.After(from) {
+			to = t
+		}
+	}
+
+	var days []string
+	for d := from; d.Before(to) && len(days) < maxHolidayDays; d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format("2006-01-02"))
+	}
+	return days, nil
+}
+
+func truncateHolidayName(s string) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > 100 {
+		return string(r[:100])
+	}
+	return s
+}
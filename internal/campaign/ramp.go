@@ -0,0 +1,139 @@
+package campaign
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// MaxCampaignCPS limita max_cps y ramp_start_cps de una campaña
+const MaxCampaignCPS = 1000
+
+// MaxRampMinutes limita la duración de la rampa de arranque
+const MaxRampMinutes = 1440
+
+// RampStatus es el estado de la rampa de CPS (warm-up) de una campaña, expuesto en /campaigns/stats
+type RampStatus struct {
+	Active     bool       `json:"active"`      // La rampa está en curso
+	CurrentCPS int        `json:"current_cps"` // CPS permitido ahora (al iniciar, si la campaña no está marcando)
+	TargetCPS  int        `json:"target_cps"`  // max_cps, o contacts_per_cycle si la campaña no tiene tope propio
+	Step       int        `json:"step"`        // Minuto de la rampa (0..ramp_minutes)
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+}
+
+// Ramp calcula el CPS de la campaña en now. La rampa sube por escalones de un minuto desde
+// ramp_start_cps hasta el objetivo en ramp_minutes; fallback es el objetivo sin max_cps.
+func Ramp(c *database.Campaign, fallback int, now time.Time) RampStatus {
+	target := c.MaxCPS
+	if target <= 0 {
+		target = fallback
+	}
+	status := RampStatus{CurrentCPS: target, TargetCPS: target}
+	if c.RampMinutes <= 0 {
+		return status
+	}
+
+	start := c.RampStartCPS
+	if start <= 0 {
+		start = 1
+	}
+	if start > target {
+		start = target
+	}
+	if c.RampStartedAt == nil {
+		status.CurrentCPS = start // Arranca desde el inicio de la rampa
+		return status
+	}
+
+	ends := c.RampStartedAt.Add(time.Duration(c.RampMinutes) * time.Minute)
+	status.StartedAt = c.RampStartedAt
+	status.EndsAt = &ends
+	step := int(now.Sub(*c.RampStartedAt) / time.Minute)
+	if step < 0 {
+		step = 0
+	}
+	if step >= c.RampMinutes {
+		status.Step = c.RampMinutes
+		return status
+	}
+	status.Active = true
+	status.Step = step
+	status.CurrentCPS = start + (target-start)*step/c.RampMinutes
+	return status
+}
+
+// ContactsPerCycle lee contacts_per_cycle de apicall_config (contactos por segundo entre todas las campañas)
+func ContactsPerCycle(repo *database.Repository) int {
+	val, err := repo.GetConfig("contacts_per_cycle")
+	if err != nil || val == "" {
+		return DefaultContactsPerCycle
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		return DefaultContactsPerCycle
+	}
+	return n
+}
+
+// rampCaps devuelve cuántos contactos puede tomar en este ciclo cada campaña con max_cps o rampa
+// (las demás no tienen tope propio). Las campañas que vuelven a marcar (inicio, reanudación, entrada
+// al horario o al tope de activas) reinician su rampa; las que dejan de marcar la cierran. En el primer
+// ciclo (arranque o cambio de líder) se respeta la rampa guardada.
+func (s *Sweeper) rampCaps(eligible []database.Campaign, now time.Time) map[int]int {
+	dialing := make(map[int]bool, len(eligible))
+	caps := make(map[int]int)
+	fallback := -1
+	for i := range eligible {
+		c := &eligible[i]
+		dialing[c.ID] = true
+		if c.MaxCPS <= 0 && c.RampMinutes <= 0 {
+			continue
+		}
+
+		if c.RampMinutes > 0 && (c.RampStartedAt == nil || (s.ramping != nil && !s.ramping[c.ID])) {
+			c.RampStartedAt = &now
+			if err := s.repo.SetCampaignRampStart(c.ID, &now); err != nil {
+				log.Printf("[Sweeper] %v", err)
+			}
+			log.Printf("[Sweeper] Campaign %d warm-up: %d minutes up to its target CPS", c.ID, c.RampMinutes)
+		}
+		if fallback < 0 && c.MaxCPS <= 0 {
+			fallback = ContactsPerCycle(s.repo)
+		}
+		caps[c.ID] = Ramp(c, fallback, now).CurrentCPS
+	}
+
+	for id := range s.ramping {
+		if !dialing[id] {
+			if err := s.repo.SetCampaignRampStart(id, nil); err != nil {
+				log.Printf("[Sweeper] %v", err)
+			}
+		}
+	}
+	ramping := make(map[int]bool)
+	for i := range eligible {
+		if eligible[i].RampMinutes > 0 {
+			ramping[eligible[i].ID] = true
+		}
+	}
+	s.ramping = ramping
+	return caps
+}
+
+// capShare limita n al CPS que le queda a la campaña en este ciclo
+func capShare(caps map[int]int, id, n int) int {
+	if c, ok := caps[id]; ok && c < n {
+		return c
+	}
+	return n
+}
+
+// consume descuenta del tope de la campaña los contactos tomados
+func consume(caps map[int]int, id, n int) {
+	if _, ok := caps[id]; ok {
+		caps[id] -= n
+	}
+}
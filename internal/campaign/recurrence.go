@@ -0,0 +1,247 @@
+package campaign
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/eventbus"
+	"apicall/internal/notify"
+)
+
+// Modos de recurrencia
+const (
+	RecurReset = "reset" // Reencola los contactos en la misma campaña
+	RecurClone = "clone" // Crea una campaña nueva con los contactos y le pasa la recurrencia
+)
+
+// DefaultRecurEstados son los estados de contacto que se vuelven a marcar si la campaña no define recur_estados
+const DefaultRecurEstados = "pending,failed"
+
+// RecurEstados son los estados de contacto que una recurrencia puede volver a marcar
+var RecurEstados = []string{"pending", "failed", "skipped", "completed"}
+
+// ParseRecurDays interpreta los días de una recurrencia ("1,4": 0=Domingo..6=Sábado)
+func ParseRecurDays(spec string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 0 || n > 6 {
+			return nil, fmt.Errorf("día de recurrencia inválido '%s' (0=Domingo..6=Sábado)", item)
+		}
+		days = append(days, time.Weekday(n))
+	}
+	return days, nil
+}
+
+// ParseRecurTime interpreta la hora HH:MM de una recurrencia
+func ParseRecurTime(spec string) (int, int, error) {
+	t, err := time.Parse("15:04", spec)
+	if err != nil {
+		return 0, 0, fmt.Errorf("recur_time inválido '%s' (formato HH:MM)", spec)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// lastOccurrence devuelve la última recurrencia programada hasta now (cero si no hay días válidos)
+func lastOccurrence(c *database.Campaign, loc *time.Location, now time.Time) time.Time {
+	days, err := ParseRecurDays(c.RecurDays)
+	if err != nil || len(days) == 0 {
+		return time.Time{}
+	}
+	hour, minute, err := ParseRecurTime(c.RecurTime)
+	if err != nil {
+		return time.Time{}
+	}
+	local := now.In(loc)
+	for back := 0; back <= 7; back++ {
+		d := local.AddDate(0, 0, -back)
+		for _, day := range days {
+			if d.Weekday() != day {
+				continue
+			}
+			if at := time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, loc); !at.After(now) {
+				return at
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// recurFilter arma el filtro de contactos que vuelve a marcar la recurrencia
+func recurFilter(c *database.Campaign) database.ContactFilter {
+	estados := c.RecurEstados
+	if estados == "" {
+		estados = DefaultRecurEstados
+	}
+	var f database.ContactFilter
+	for _, e := range strings.Split(estados, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			f.Estados = append(f.Estados, e)
+		}
+	}
+	for _, d := range strings.Split(c.RecurDispositions, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			f.Resultados = append(f.Resultados, d)
+		}
+	}
+	return f
+}
+
+// applyRecurrences aplica las recurrencias vencidas de las campañas activas o completadas. Al configurar
+// una recurrencia solo se registra el alta: la primera se aplica en el siguiente día y hora programados.
+func (s *Sweeper) applyRecurrences(now time.Time) {
+	campaigns, err := s.repo.GetRecurringCampaigns()
+	if err != nil {
+		log.Printf("[Sweeper] %v", err)
+		return
+	}
+	for i := range campaigns {
+		c := &campaigns[i]
+		if c.RecurLastAt == nil {
+			if err := s.repo.SetCampaignRecurrence(c.ID, c.RecurCount, now); err != nil {
+				log.Printf("[Sweeper] %v", err)
+			}
+			continue
+		}
+		at := lastOccurrence(c, s.location(c), now)
+		if at.IsZero() || !at.After(*c.RecurLastAt) {
+			continue
+		}
+		if c.RecurMode == RecurClone {
+			s.recurClone(c, now)
+		} else {
+			s.recurReset(c, now)
+		}
+	}
+}
+
+// recurReset vuelve a pending los contactos del filtro y, si hay algo que marcar, activa la campaña
+func (s *Sweeper) recurReset(c *database.Campaign, now time.Time) {
+	f := recurFilter(c)
+	moved, err := s.repo.MoveContacts(c.ID, f.Estados, "pending", database.ContactFilter{Resultados: f.Resultados})
+	if err != nil {
+		log.Printf("[Sweeper] Error applying recurrence of campaign %d: %v", c.ID, err)
+		return
+	}
+	count := c.RecurCount + 1
+	if err := s.repo.SetCampaignRecurrence(c.ID, count, now); err != nil {
+		log.Printf("[Sweeper] %v", err)
+		return
+	}
+	counts, err := s.repo.CountContactsByStatus(c.ID)
+	if err != nil {
+		log.Printf("[Sweeper] Error counting contacts for campaign %d: %v", c.ID, err)
+		return
+	}
+	if counts["pending"] == 0 {
+		log.Printf("[Sweeper] Campaign %d recurrence %d: no contacts to dial", c.ID, count)
+		return
+	}
+	if c.Estado != "active" {
+		if err := s.repo.UpdateCampaignStatus(c.ID, "active"); err != nil {
+			log.Printf("[Sweeper] Error activating campaign %d: %v", c.ID, err)
+			return
+		}
+	}
+	log.Printf("[Sweeper] Campaign %d recurrence %d: %d contacts requeued, %d pending", c.ID, count, moved, counts["pending"])
+	s.announceRecurrence(c, c, count, counts["pending"])
+}
+
+// cloneSuffix es la fecha que se agrega al nombre de cada copia (se reemplaza en las siguientes)
+var cloneSuffix = regexp.MustCompile(` \(\d{4}-\d{2}-\d{2}\)$`)
+
+// recurClone completa la campaña y crea una nueva con su configuración, horarios y los contactos del
+// filtro. La recurrencia pasa a la copia, así la siguiente parte de sus contactos.
+func (s *Sweeper) recurClone(c *database.Campaign, now time.Time) {
+	count := c.RecurCount + 1
+	f := recurFilter(c)
+	if _, total, err := s.repo.ListCampaignContacts(c.ID, f, 1, 0, 0); err != nil {
+		log.Printf("[Sweeper] Error applying recurrence of campaign %d: %v", c.ID, err)
+		return
+	} else if total == 0 {
+		// Sin contactos que copiar no se crea la copia: la recurrencia sigue en esta campaña
+		log.Printf("[Sweeper] Campaign %d recurrence %d: no contacts to dial", c.ID, count)
+		if err := s.repo.SetCampaignRecurrence(c.ID, count, now); err != nil {
+			log.Printf("[Sweeper] %v", err)
+		}
+		return
+	}
+
+	clone := *c
+	clone.ID = 0
+	clone.Estado = "draft"
+	clone.Nombre = cloneSuffix.ReplaceAllString(c.Nombre, "") + now.In(s.location(c)).Format(" (2006-01-02)")
+	clone.TotalContactos = 0
+	clone.StartAt, clone.EndAt = nil, nil
+	clone.RecurCount = count
+	if err := s.repo.CreateCampaign(&clone); err != nil {
+		log.Printf("[Sweeper] Error cloning campaign %d: %v", c.ID, err)
+		return
+	}
+
+	copied, err := s.repo.CopyCampaignContacts(c.ID, clone.ID, f)
+	if err == nil {
+		var schedules []database.CampaignSchedule
+		if schedules, err = s.repo.GetCampaignSchedules(c.ID); err == nil {
+			err = s.repo.UpdateCampaignSchedules(clone.ID, schedules)
+		}
+	}
+	if err != nil {
+		log.Printf("[Sweeper] Error cloning campaign %d: %v", c.ID, err)
+		s.repo.DeleteCampaign(clone.ID)
+		return
+	}
+
+	// La recurrencia pasa a la copia (si fallara, la próxima revisión la volvería a clonar)
+	if err := s.repo.SetCampaignRecurrence(clone.ID, count, now); err != nil {
+		log.Printf("[Sweeper] %v", err)
+	}
+	if err := s.repo.ClearCampaignRecurrence(c.ID); err != nil {
+		log.Printf("[Sweeper] %v", err)
+	}
+	if c.Estado == "active" {
+		s.cancelDials(c.ID)
+		s.stats.flush(c.ID, true)
+		if err := s.repo.UpdateCampaignStatus(c.ID, "completed"); err != nil {
+			log.Printf("[Sweeper] Error completing campaign %d: %v", c.ID, err)
+		} else {
+			go s.summarize(c.ID)
+		}
+	}
+
+	if err := s.repo.UpdateCampaignStatus(clone.ID, "active"); err != nil {
+		log.Printf("[Sweeper] Error activating campaign %d: %v", clone.ID, err)
+		return
+	}
+	log.Printf("[Sweeper] Campaign %d recurrence %d: clone %d with %d contacts", c.ID, count, clone.ID, copied)
+	s.announceRecurrence(c, &clone, count, copied)
+}
+
+// announceRecurrence avisa el inicio de la recurrencia a los canales del proyecto y al broker
+func (s *Sweeper) announceRecurrence(source, c *database.Campaign, count, pending int) {
+	text := fmt.Sprintf("Campaña %s (ID %d): recurrencia %d, %d contactos por marcar", c.Nombre, c.ID, count, pending)
+	if source.ID != c.ID {
+		text += fmt.Sprintf(" (copia de la campaña %d)", source.ID)
+	}
+	s.notifier.Notify(c.ProyectoID, notify.EventCampaignStarted, text)
+	data := map[string]interface{}{
+		"nombre":          c.Nombre,
+		"estado_anterior": c.Estado,
+		"estado":          "active",
+		"recurrencia":     count,
+		"pendientes":      pending,
+	}
+	if source.ID != c.ID {
+		data["origen_id"] = source.ID
+	}
+	s.events.PublishCampaign(eventbus.EventCampaignStarted, c, data)
+}
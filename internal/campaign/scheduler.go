@@ -0,0 +1,68 @@
+package campaign
+
+// DefaultPrioridad es el peso de una campaña sin prioridad configurada
+const DefaultPrioridad = 1
+
+// fairScheduler reparte los slots libres del pool entre las campañas activas
+// proporcionalmente a su prioridad (smooth weighted round-robin). El crédito de
+// cada campaña se conserva entre ciclos, así que con pocos slots por ciclo
+// ninguna campaña acapara el pool y todas reciben turno en proporción a su peso.
+type fairScheduler struct {
+	credits map[int]int // campaign_id -> crédito acumulado
+}
+
+func newFairScheduler() *fairScheduler {
+	return &fairScheduler{credits: make(map[int]int)}
+}
+
+// allocate devuelve cuántos contactos puede marcar cada campaña en este ciclo
+func (f *fairScheduler) allocate(budget int, campaigns []schedulable) map[int]int {
+	shares := make(map[int]int, len(campaigns))
+
+	// Olvidar campañas que ya no están activas
+	active := make(map[int]bool, len(campaigns))
+	for _, c := range campaigns {
+		active[c.id] = true
+	}
+	for id := range f.credits {
+		if !active[id] {
+			delete(f.credits, id)
+		}
+	}
+
+	if budget <= 0 || len(campaigns) == 0 {
+		return shares
+	}
+
+	total := 0
+	for _, c := range campaigns {
+		total += c.weight()
+	}
+
+	for slot := 0; slot < budget; slot++ {
+		best := -1
+		for i, c := range campaigns {
+			f.credits[c.id] += c.weight()
+			if best < 0 || f.credits[c.id] > f.credits[campaigns[best].id] {
+				best = i
+			}
+		}
+		f.credits[campaigns[best].id] -= total
+		shares[campaigns[best].id]++
+	}
+
+	return shares
+}
+
+// schedulable es una campaña candidata a recibir slots en el ciclo
+type schedulable struct {
+	id        int
+	prioridad int
+}
+
+func (s schedulable) weight() int {
+	if s.prioridad <= 0 {
+		return DefaultPrioridad
+	}
+	return s.prioridad
+}
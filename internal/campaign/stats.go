@@ -0,0 +1,111 @@
+package campaign
+
+import (
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+const (
+	// StatsReconcileInterval es cada cuánto se recuentan los contactos de una campaña en la BD.
+	// Las transiciones que no hace el Sweeper (batcher, FastAGI, ARI, API) se ven al reconciliar.
+	StatsReconcileInterval = 30 * time.Second
+	// StatsFlushInterval es el mínimo entre escrituras de contactos_procesados/exitosos/fallidos
+	StatsFlushInterval = 15 * time.Second
+	// completionCheckInterval es el recuento mínimo mientras una campaña sin pendientes espera
+	// que terminen sus llamadas en curso
+	completionCheckInterval = 5 * time.Second
+)
+
+type contactCounts struct {
+	counts    map[string]int // estado -> contactos
+	loadedAt  time.Time      // Último recuento en la BD
+	flushedAt time.Time      // Última escritura de las estadísticas
+	dirty     bool           // Cambió desde la última escritura
+}
+
+// contactStats mantiene en memoria los contactos por estado de cada campaña activa: se
+// actualiza con las transiciones del Sweeper y se reconcilia con un COUNT periódico, en lugar
+// de agrupar la tabla de contactos en cada ciclo.
+type contactStats struct {
+	repo *database.Repository
+
+	mu         sync.Mutex
+	byCampaign map[int]*contactCounts
+}
+
+func newContactStats(repo *database.Repository) *contactStats {
+	return &contactStats{repo: repo, byCampaign: make(map[int]*contactCounts)}
+}
+
+// counts devuelve los contactos por estado, recontando en la BD si el dato tiene más de maxAge
+func (cs *contactStats) counts(campaignID int, maxAge time.Duration) (map[string]int, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c := cs.byCampaign[campaignID]
+	if c == nil || time.Since(c.loadedAt) >= maxAge {
+		fresh, err := cs.repo.CountContactsByStatus(campaignID)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			c = &contactCounts{dirty: true}
+			cs.byCampaign[campaignID] = c
+		} else if !maps.Equal(c.counts, fresh) {
+			c.dirty = true
+		}
+		c.counts, c.loadedAt = fresh, time.Now()
+	}
+	return maps.Clone(c.counts), nil
+}
+
+// transition registra que un contacto pasó de from a to. Sin datos cargados se ignora:
+// el próximo recuento ya lo incluye.
+func (cs *contactStats) transition(campaignID int, from, to string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c := cs.byCampaign[campaignID]
+	if c == nil || from == to {
+		return
+	}
+	if c.counts[from] > 0 {
+		c.counts[from]--
+	}
+	c.counts[to]++
+	c.dirty = true
+}
+
+// flush escribe las estadísticas de la campaña si cambiaron y pasó StatsFlushInterval
+// desde la última escritura (force la escribe de inmediato, ej: al completarse)
+func (cs *contactStats) flush(campaignID int, force bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c := cs.byCampaign[campaignID]
+	if c == nil || !c.dirty || (!force && time.Since(c.flushedAt) < StatsFlushInterval) {
+		return
+	}
+	completed, failed := c.counts["completed"], c.counts["failed"]
+	processed := completed + failed + c.counts["skipped"]
+	if err := cs.repo.UpdateCampaignStats(campaignID, processed, completed, failed); err != nil {
+		log.Printf("[Sweeper] Error updating stats for campaign %d: %v", campaignID, err)
+		return
+	}
+	c.dirty, c.flushedAt = false, time.Now()
+}
+
+// retain olvida las campañas que ya no están activas
+func (cs *contactStats) retain(active map[int]bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for id := range cs.byCampaign {
+		if !active[id] {
+			delete(cs.byCampaign, id)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package campaign
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/eventbus"
+	"apicall/internal/mailer"
+	"apicall/internal/notify"
+	"apicall/internal/webhook"
+)
+
+// SetMailer registra el servidor SMTP usado para enviar el resumen final (nil = sin email)
+func (s *Sweeper) SetMailer(m *mailer.Mailer) {
+	s.mailer = m
+}
+
+// summarize genera y guarda el resumen final de una campaña completada y lo entrega
+// por webhook (result_url) y email (summary_emails). Se llama en una goroutine.
+func (s *Sweeper) summarize(campaignID int) {
+	c, err := s.repo.GetCampaign(campaignID)
+	if err != nil {
+		log.Printf("[Sweeper] Error leyendo campaña %d para el resumen: %v", campaignID, err)
+		return
+	}
+	summary, err := s.repo.BuildCampaignSummary(c)
+	if err != nil {
+		log.Printf("[Sweeper] Error generando resumen de campaña %d: %v", campaignID, err)
+		return
+	}
+	if err := s.repo.SaveCampaignSummary(summary); err != nil {
+		log.Printf("[Sweeper] %v", err)
+		return
+	}
+	log.Printf("[Sweeper] Resumen de campaña %d: %d llamadas, connect rate %.2f%%, costo %.4f",
+		c.ID, summary.Llamadas, summary.ConnectRate*100, summary.Costo)
+
+	s.notifier.Notify(c.ProyectoID, notify.EventCampaignCompleted, "Campaña finalizada\n\n"+summaryText(summary))
+	s.events.PublishCampaign(eventbus.EventCampaignCompleted, c, summary)
+	if c.ResultURL != "" {
+		go webhook.SendCampaignSummary(c.ResultURL, &webhook.CampaignSummaryPayload{
+			Event:      "campaign.summary",
+			CampaignID: c.ID,
+			ProyectoID: c.ProyectoID,
+			Nombre:     c.Nombre,
+			Summary:    summary,
+			Timestamp:  summary.GeneratedAt,
+		})
+	}
+
+	if c.SummaryEmails == "" {
+		return
+	}
+	if s.mailer == nil {
+		log.Printf("[Sweeper] WARN campaña %d tiene summary_emails pero no hay servidor SMTP configurado", c.ID)
+		return
+	}
+	to, err := mailer.ParseAddresses(c.SummaryEmails)
+	if err != nil {
+		log.Printf("[Sweeper] WARN summary_emails de campaña %d: %v", c.ID, err)
+		return
+	}
+	subject := fmt.Sprintf("Campaña %s finalizada - resumen", c.Nombre)
+	if err := s.mailer.Send(to, subject, summaryText(summary)); err != nil {
+		log.Printf("[Sweeper] Error enviando resumen de campaña %d por email: %v", c.ID, err)
+		return
+	}
+	log.Printf("[Sweeper] Resumen de campaña %d enviado a %s", c.ID, strings.Join(to, ", "))
+}
+
+// summaryText es el cuerpo en texto plano del email de resumen
+func summaryText(sum *database.CampaignSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Campaña: %s (ID %d, proyecto %d)\n", sum.Nombre, sum.CampaignID, sum.ProyectoID)
+	if sum.FechaInicio != nil {
+		fmt.Fprintf(&b, "Inicio: %s\n", sum.FechaInicio.Format(time.DateTime))
+	}
+	if sum.FechaFin != nil {
+		fmt.Fprintf(&b, "Fin: %s\n", sum.FechaFin.Format(time.DateTime))
+	}
+
+	b.WriteString("\nContactos:\n")
+	for _, k := range sortedKeys(sum.Contactos) {
+		fmt.Fprintf(&b, "  %-12s %d\n", k, sum.Contactos[k])
+	}
+
+	fmt.Fprintf(&b, "\nLlamadas: %d\n", sum.Llamadas)
+	for _, k := range sortedKeys(sum.Dispositions) {
+		fmt.Fprintf(&b, "  %-12s %d\n", k, sum.Dispositions[k])
+	}
+
+	fmt.Fprintf(&b, "\nContestadas: %d\n", sum.Answered)
+	fmt.Fprintf(&b, "Contactadas (humano): %d\n", sum.Contacted)
+	fmt.Fprintf(&b, "Connect rate: %.2f%%\n", sum.ConnectRate*100)
+	fmt.Fprintf(&b, "Conversiones DTMF: %d (%.2f%%)\n", sum.Converted, sum.DTMFConversion*100)
+	fmt.Fprintf(&b, "Duración promedio: %.1f s\n", sum.AvgDuration)
+	fmt.Fprintf(&b, "Minutos facturados: %.2f\n", sum.Minutos)
+	fmt.Fprintf(&b, "Costo estimado: %.4f\n", sum.Costo)
+	fmt.Fprintf(&b, "\nGenerado: %s\n", sum.GeneratedAt.Format(time.DateTime))
+	return b.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,14 +1,21 @@
 package campaign
 
 import (
+	"context"
+	"errors"
 	"log"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"apicall/internal/asterisk"
 	"apicall/internal/database"
 	"apicall/internal/dialer"
+	"apicall/internal/eventbus"
+	"apicall/internal/leader"
+	"apicall/internal/mailer"
+	"apicall/internal/notify"
+	"apicall/internal/phone"
 )
 
 const (
@@ -20,23 +27,83 @@ const (
 
 // Sweeper processes active campaigns
 type Sweeper struct {
-	repo      *database.Repository
-	dialer    *dialer.AMIDialer
-	running   bool
-	stopChan  chan struct{}
-	wg        sync.WaitGroup
-	mu        sync.Mutex
+	repo       *database.Repository
+	dialer     *dialer.AMIDialer
+	ari        dialer.Dialer // Motor para proyectos con dial_engine=ari (nil = deshabilitado)
+	sim        dialer.Dialer // Motor para proyectos con dial_engine=sim (nil = deshabilitado)
+	simAll     bool          // Todas las campañas usan el simulador
+	scheduler  *fairScheduler
+	stats      *contactStats
+	exitChecks map[int]time.Time  // Última evaluación de reglas de salida por campaña
+	zones      map[int]*zoneCache // Zonas de las franjas de contacto por campaña
+	limiter    *ActiveLimiter     // Topes de campañas activas (nil = sin límite)
+	overLimit  map[int]bool       // Campañas activas que esperan por el tope, para loguear solo los cambios
+	mailer     *mailer.Mailer     // Envío del resumen final por email (nil = sin SMTP)
+	notifier   *notify.Dispatcher // Canales de chat de cada proyecto (nil = sin canales)
+	events     *eventbus.Bus      // Broker de eventos (nil = desactivado)
+	ramping    map[int]bool       // Campañas con rampa que marcaron en el ciclo anterior (nil = primer ciclo)
+	windowsAt  time.Time          // Última revisión de inicios y fines programados
+	waitStart  map[int]bool       // Inicios programados que esperan por el tope de activas, para loguear solo los cambios
+	ctx        context.Context    // Se cancela en Stop: aborta los originates pendientes
+	cancel     context.CancelFunc
+	dialCtx    map[int]*dialScope // Originates pendientes por campaña, cancelados al pausarla o detenerla
+	running    bool
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	dials      sync.WaitGroup // Goroutines de Dial en curso
+	mu         sync.Mutex
+}
+
+// dialScope is the context shared by the in-flight dials of one campaign
+type dialScope struct {
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewSweeper creates a new campaign sweeper
 func NewSweeper(repo *database.Repository, d *dialer.AMIDialer) *Sweeper {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Sweeper{
-		repo:     repo,
-		dialer:   d,
-		stopChan: make(chan struct{}),
+		repo:       repo,
+		dialer:     d,
+		scheduler:  newFairScheduler(),
+		stats:      newContactStats(repo),
+		exitChecks: make(map[int]time.Time),
+		zones:      make(map[int]*zoneCache),
+		overLimit:  make(map[int]bool),
+		ctx:        ctx,
+		cancel:     cancel,
+		dialCtx:    make(map[int]*dialScope),
+		stopChan:   make(chan struct{}),
 	}
 }
 
+// SetActiveLimiter registers the concurrent active campaign limits
+func (s *Sweeper) SetActiveLimiter(l *ActiveLimiter) {
+	s.limiter = l
+}
+
+// SetNotifier registers the chat channels dispatcher for campaign events
+func (s *Sweeper) SetNotifier(d *notify.Dispatcher) {
+	s.notifier = d
+}
+
+// SetEventBus registers the message broker that receives campaign events
+func (s *Sweeper) SetEventBus(b *eventbus.Bus) {
+	s.events = b
+}
+
+// SetARIDialer registers the ARI engine used by projects with dial_engine=ari
+func (s *Sweeper) SetARIDialer(d dialer.Dialer) {
+	s.ari = d
+}
+
+// SetSimDialer registers the simulation engine used by projects with dial_engine=sim,
+// or by every project when all is set (load tests)
+func (s *Sweeper) SetSimDialer(d dialer.Dialer, all bool) {
+	s.sim, s.simAll = d, all
+}
+
 // Start begins the sweeper worker
 func (s *Sweeper) Start() {
 	s.mu.Lock()
@@ -64,6 +131,10 @@ func (s *Sweeper) Stop() {
 
 	close(s.stopChan)
 	s.wg.Wait()
+
+	// Pending originates are hung up and their contacts go back to pending
+	s.cancel()
+	s.dials.Wait()
 	log.Println("[Sweeper] Campaign sweeper stopped")
 }
 
@@ -84,6 +155,14 @@ func (s *Sweeper) run() {
 }
 
 func (s *Sweeper) processCampaigns() {
+	// Con ha.enabled solo la instancia líder barre campañas (la otra duplicaría las marcaciones)
+	if !leader.IsLeader() {
+		return
+	}
+
+	// Scheduled starts and ends (start_at / end_at) before reading the active campaigns
+	s.applyWindows(time.Now())
+
 	// Get all active campaigns
 	campaigns, err := s.repo.GetActiveCampaigns()
 	if err != nil {
@@ -91,84 +170,311 @@ func (s *Sweeper) processCampaigns() {
 		return
 	}
 
+	active := make(map[int]bool, len(campaigns))
+	for _, campaign := range campaigns {
+		active[campaign.ID] = true
+	}
+	s.stats.retain(active)
+
+	// Paused or stopped campaigns: cancel their originates still ringing
+	for id := range s.dialCtx {
+		if !active[id] {
+			s.cancelDials(id)
+		}
+	}
+
 	if len(campaigns) == 0 {
+		s.rampCaps(nil, time.Now())
 		return // Nothing to process
 	}
 
+	// Over the active campaign limit: the oldest active campaigns dial, the rest wait
+	campaigns, waiting := s.limiter.Admit(campaigns)
+	s.logOverLimit(waiting, active)
+
+	// Only campaigns within schedule compete for slots
+	var eligible []database.Campaign
+	var candidates []schedulable
 	for _, campaign := range campaigns {
-		s.processCampaign(&campaign)
+		if s.checkExitRules(&campaign) {
+			s.cancelDials(campaign.ID)
+			continue
+		}
+		inSchedule, err := s.repo.IsWithinSchedule(campaign.ID)
+		if err != nil {
+			log.Printf("[Sweeper] Error checking schedule for campaign %d: %v", campaign.ID, err)
+			continue
+		}
+		if !inSchedule {
+			continue
+		}
+		eligible = append(eligible, campaign)
+		candidates = append(candidates, schedulable{id: campaign.ID, prioridad: campaign.Prioridad})
+	}
+
+	budget := s.cycleBudget()
+	shares := s.scheduler.allocate(budget, candidates)
+
+	// Campaigns with max_cps or a warm-up ramp never dial more than their own CPS
+	caps := s.rampCaps(eligible, time.Now())
+
+	// Slots left unused by campaigns without enough pending contacts go to the rest
+	leftover := 0
+	var hungry []schedulable
+	for i := range eligible {
+		id := eligible[i].ID
+		share := shares[id]
+		limit := capShare(caps, id, share)
+		dialed := s.processCampaign(&eligible[i], limit)
+		consume(caps, id, dialed)
+		leftover += share - dialed
+		if limit > 0 && dialed == limit && capShare(caps, id, 1) > 0 {
+			hungry = append(hungry, candidates[i])
+		}
+	}
+	if leftover == 0 || len(hungry) == 0 {
+		return
+	}
+	extra := s.scheduler.allocate(leftover, hungry)
+	for i := range eligible {
+		if n := capShare(caps, eligible[i].ID, extra[eligible[i].ID]); n > 0 {
+			s.processCampaign(&eligible[i], n)
+		}
 	}
 }
 
-func (s *Sweeper) processCampaign(campaign *database.Campaign) {
-	// Check if within schedule
-	inSchedule, err := s.repo.IsWithinSchedule(campaign.ID)
+// logOverLimit logs the campaigns that start or stop waiting for the active campaign limit
+func (s *Sweeper) logOverLimit(waiting []database.Campaign, active map[int]bool) {
+	now := make(map[int]bool, len(waiting))
+	for _, c := range waiting {
+		now[c.ID] = true
+		if !s.overLimit[c.ID] {
+			limits := s.limiter.Limits()
+			log.Printf("[Sweeper] Campaign %d waiting: active campaign limit reached (global %d, per proyecto %d)", c.ID, limits.Global, limits.PerProyecto)
+		}
+	}
+	for id := range s.overLimit {
+		if !now[id] && active[id] {
+			log.Printf("[Sweeper] Campaign %d resumes dialing (within active campaign limit)", id)
+		}
+	}
+	s.overLimit = now
+}
+
+// campaignContext returns the context for the dials of a campaign, created on first use
+func (s *Sweeper) campaignContext(campaignID int) context.Context {
+	scope, ok := s.dialCtx[campaignID]
+	if !ok {
+		ctx, cancel := context.WithCancel(s.ctx)
+		scope = &dialScope{ctx: ctx, cancel: cancel}
+		s.dialCtx[campaignID] = scope
+	}
+	return scope.ctx
+}
+
+// cancelDials aborts the in-flight dials of a campaign that is no longer active
+func (s *Sweeper) cancelDials(campaignID int) {
+	if scope, ok := s.dialCtx[campaignID]; ok {
+		scope.cancel()
+		delete(s.dialCtx, campaignID)
+	}
+}
+
+// cycleBudget is how many contacts may be dialed this cycle across all campaigns:
+// contacts_per_cycle, capped by the free slots of the channel pool
+func (s *Sweeper) cycleBudget() int {
+	budget := s.getContactsPerCycle()
+	if pool := s.dialer.Pool(); pool != nil {
+		if available := pool.Available(); available < budget {
+			budget = available
+		}
+	}
+	return budget
+}
+
+// processCampaign dials up to limit pending contacts and returns how many it took
+func (s *Sweeper) processCampaign(campaign *database.Campaign, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+
+	// Get the project for this campaign
+	proyecto, err := s.repo.GetProyecto(campaign.ProyectoID)
 	if err != nil {
-		log.Printf("[Sweeper] Error checking schedule for campaign %d: %v", campaign.ID, err)
-		return
+		log.Printf("[Sweeper] Error fetching project %d for campaign %d: %v", 
+			campaign.ProyectoID, campaign.ID, err)
+		return 0
 	}
 
-	if !inSchedule {
-		// Not within schedule, skip
-		return
+	// Without the main audio every call would end as FAIL: the campaign waits until it is uploaded
+	if s.dialer.AudioMissing(proyecto) {
+		return 0
+	}
+
+	// Project quotas (max_calls_day / max_concurrent) cap how many contacts are taken
+	if proyecto.MaxCallsDay > 0 || proyecto.MaxConcurrent > 0 {
+		status, err := s.dialer.Quotas().Status(proyecto)
+		if err != nil {
+			log.Printf("[Sweeper] Error reading quotas of project %d: %v", proyecto.ID, err)
+		} else if remaining := status.Remaining(); remaining >= 0 && remaining < limit {
+			limit = remaining
+		}
+		if limit <= 0 {
+			return 0
+		}
+	}
+
+	// Load counters before the transitions below (reconciled every StatsReconcileInterval)
+	if _, err := s.stats.counts(campaign.ID, StatsReconcileInterval); err != nil {
+		log.Printf("[Sweeper] Error counting contacts for campaign %d: %v", campaign.ID, err)
 	}
 
-	// Get pending contacts (read config dynamically from DB)
-	contactsPerCycle := s.getContactsPerCycle()
-	contacts, err := s.repo.GetPendingContacts(campaign.ID, contactsPerCycle)
+	// Claim contacts atomically (pending -> dialing, SKIP LOCKED); contacts with a preferred
+	// window are only taken inside it, and with local hours only those whose zone is open
+	contacts, err := s.repo.ClaimPendingContacts(campaign.ID, limit, s.claimFilter(campaign, proyecto, time.Now()))
 	if err != nil {
 		log.Printf("[Sweeper] Error fetching contacts for campaign %d: %v", campaign.ID, err)
-		return
+		return 0
 	}
 
 	if len(contacts) == 0 {
-		// Check if campaign is complete
-		counts, _ := s.repo.CountContactsByStatus(campaign.ID)
-		pending := counts["pending"]
-		dialing := counts["dialing"]
-		
-		if pending == 0 && dialing == 0 {
+		// Check if campaign is complete (recounted at most every completionCheckInterval
+		// while the last calls finish)
+		counts, err := s.stats.counts(campaign.ID, completionCheckInterval)
+		if err != nil {
+			log.Printf("[Sweeper] Error counting contacts for campaign %d: %v", campaign.ID, err)
+			return 0
+		}
+		if counts["pending"] == 0 && counts["dialing"] == 0 {
 			// All contacts processed, mark campaign as completed
 			log.Printf("[Sweeper] Campaign %d completed - all contacts processed", campaign.ID)
-			s.repo.UpdateCampaignStatus(campaign.ID, "completed")
+			s.stats.flush(campaign.ID, true)
+			if err := s.repo.UpdateCampaignStatus(campaign.ID, "completed"); err != nil {
+				log.Printf("[Sweeper] Error completing campaign %d: %v", campaign.ID, err)
+				return 0
+			}
+			go s.summarize(campaign.ID)
+			return 0
 		}
-		return
+		s.stats.flush(campaign.ID, false)
+		return 0
 	}
 
-	// Get the project for this campaign
-	proyecto, err := s.repo.GetProyecto(campaign.ProyectoID)
+	// Normalize numbers (legacy contacts may not be normalized)
+	valid := contacts[:0]
+	telefonos := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		if proyecto.Pais != "" {
+			normalized, err := phone.Normalize(contact.Telefono, proyecto.Pais)
+			if err != nil {
+				log.Printf("[Sweeper] Skipping invalid number %s in campaign %d: %v", contact.Telefono, campaign.ID, err)
+				invalid := "INVALID"
+				s.repo.UpdateContactStatus(contact.ID, "skipped", &invalid)
+				s.stats.transition(campaign.ID, "pending", "skipped")
+				continue
+			}
+			contact.Telefono = normalized
+		}
+		valid = append(valid, contact)
+		telefonos = append(telefonos, contact.Telefono)
+	}
+
+	// Blacklist check for the whole batch in one query (the pre-dial pipeline checks
+	// again per call, for numbers blocked while queued)
+	blacklisted, err := s.repo.GetBlacklistedSet(proyecto.ID, telefonos)
 	if err != nil {
-		log.Printf("[Sweeper] Error fetching project %d for campaign %d: %v", 
-			campaign.ProyectoID, campaign.ID, err)
-		return
+		log.Printf("[Sweeper] Error checking blacklist for campaign %d: %v", campaign.ID, err)
+	}
+
+	// Daily attempts per number across all projects (the pipeline checks again per call)
+	attemptLimit, attempts, err := s.dialer.Attempts().Counts(proyecto, telefonos)
+	if err != nil {
+		log.Printf("[Sweeper] Error counting attempts for campaign %d: %v", campaign.ID, err)
 	}
 
 	// Process contacts
-	for _, contact := range contacts {
-		// Check blacklist
-		blacklisted, _ := s.repo.IsBlacklisted(campaign.ProyectoID, contact.Telefono)
-		if blacklisted {
+	ctx := s.campaignContext(campaign.ID)
+	for _, contact := range valid {
+		if blacklisted[contact.Telefono] {
 			log.Printf("[Sweeper] Skipping blacklisted number %s in campaign %d", contact.Telefono, campaign.ID)
 			skipped := "BLACKLISTED"
 			s.repo.UpdateContactStatus(contact.ID, "skipped", &skipped)
+			s.stats.transition(campaign.ID, "pending", "skipped")
+			continue
+		}
+		if err := dialer.CheckDestination(proyecto, contact.Telefono); err != nil {
+			log.Printf("[Sweeper] Skipping number %s in campaign %d: %v", contact.Telefono, campaign.ID, err)
+			skipped := "PREFIX_DENIED"
+			s.repo.UpdateContactStatus(contact.ID, "skipped", &skipped)
+			s.stats.transition(campaign.ID, "pending", "skipped")
 			continue
 		}
+		if attemptLimit > 0 && attempts[contact.Telefono] >= attemptLimit {
+			log.Printf("[Sweeper] Skipping number %s in campaign %d: %d/%d attempts today",
+				contact.Telefono, campaign.ID, attempts[contact.Telefono], attemptLimit)
+			skipped := "ATTEMPT_CAP"
+			s.repo.UpdateContactStatus(contact.ID, "skipped", &skipped)
+			s.stats.transition(campaign.ID, "pending", "skipped")
+			continue
+		}
+		s.stats.transition(campaign.ID, "pending", "dialing")
 
-		// Mark as dialing
-		s.repo.MarkContactDialing(contact.ID)
+		// dial_engine=spool: encolar en el spooler (respeta CPS); el pipeline común
+		// de pre-marcación descarta la blacklist y marca el contacto
+		if proyecto.DialEngine == dialer.EngineSpool {
+			job := asterisk.CallJob{Proyecto: proyecto, Telefono: contact.Telefono, ContactID: contact.ID,
+				CampaignID: campaign.ID, RingTimeout: campaign.RingTimeout, Troncales: campaign.Troncales}
+			if _, err := asterisk.QueueJob(job); err != nil {
+				s.repo.UpdateContactStatus(contact.ID, "pending", nil)
+				s.stats.transition(campaign.ID, "dialing", "pending")
+			}
+			continue
+		}
 
 		// Execute dial in goroutine to not block sweeper
-		go func(c database.CampaignContact, p *database.Proyecto, campID int) {
+		s.dials.Add(1)
+		go func(c database.CampaignContact, p *database.Proyecto, campID int, ringTimeout int, troncales string) {
+			defer s.dials.Done()
 			req := dialer.DialRequest{
+				Ctx:         ctx,
 				CampaignID:  campID,
 				ContactID:   c.ID,
 				Project:     p,
 				Destination: c.Telefono,
 				Variables:   make(map[string]string),
-				Timeout:     45 * time.Second, // Standard dial timeout
+				Timeout:     dialer.RingTimeout(p, ringTimeout),
+				Troncales:   troncales,
+			}
+
+			var d dialer.Dialer = s.dialer
+			switch {
+			case s.sim != nil && (s.simAll || p.DialEngine == dialer.EngineSim):
+				d = s.sim
+			case p.DialEngine == dialer.EngineARI && s.ari != nil:
+				d = s.ari
 			}
 
-			if err := s.dialer.Dial(req); err != nil {
+			if err := d.Dial(req); errors.Is(err, dialer.ErrBlacklisted) {
+				log.Printf("[Sweeper] Skipping blacklisted number %s in campaign %d", c.Telefono, campID)
+				skipped := "BLACKLISTED"
+				s.repo.UpdateContactStatus(c.ID, "skipped", &skipped)
+				s.stats.transition(campID, "dialing", "skipped")
+			} else if errors.Is(err, dialer.ErrDestinationDenied) {
+				log.Printf("[Sweeper] Skipping number %s in campaign %d: %v", c.Telefono, campID, err)
+				skipped := "PREFIX_DENIED"
+				s.repo.UpdateContactStatus(c.ID, "skipped", &skipped)
+				s.stats.transition(campID, "dialing", "skipped")
+			} else if errors.Is(err, dialer.ErrAttemptCap) {
+				log.Printf("[Sweeper] Skipping number %s in campaign %d: %v", c.Telefono, campID, err)
+				skipped := "ATTEMPT_CAP"
+				s.repo.UpdateContactStatus(c.ID, "skipped", &skipped)
+				s.stats.transition(campID, "dialing", "skipped")
+			} else if errors.Is(err, context.Canceled) {
+				// Campaign paused or service stopping: the contact is dialed again on resume
+				log.Printf("[Sweeper] Dial cancelled for %s in campaign %d", c.Telefono, campID)
+				s.repo.UpdateContactStatus(c.ID, "pending", nil)
+				s.stats.transition(campID, "dialing", "pending")
+			} else if err != nil {
 				// Failed to initiate
 				log.Printf("[Sweeper] Dial failed for %s: %v", c.Telefono, err)
 				
@@ -190,6 +496,14 @@ func (s *Sweeper) processCampaign(campaign *database.Campaign) {
 					// Pool full, keep pending for retry
 					newStatus = "pending"
 					reason = "LIMIT"
+				} else if errors.Is(err, dialer.ErrQuotaExceeded) {
+					// Project quota reached, keep pending until it frees up
+					newStatus = "pending"
+					reason = "QUOTA"
+				} else if errors.Is(err, dialer.ErrNoAudio) {
+					// Audio removed while dialing, keep pending until it is uploaded again
+					newStatus = "pending"
+					reason = "NO_AUDIO"
 				}
 				
 				// Update status
@@ -198,31 +512,22 @@ func (s *Sweeper) processCampaign(campaign *database.Campaign) {
 					reasonPtr = &reason
 				}
 				s.repo.UpdateContactStatus(c.ID, newStatus, reasonPtr)
+				s.stats.transition(campID, "dialing", newStatus)
 
 			} else {
 				log.Printf("[Sweeper] Call initiated for campaign %d: %s (contact_id=%d)", campID, c.Telefono, c.ID)
 			}
-		}(contact, proyecto, campaign.ID)
+		}(contact, proyecto, campaign.ID, campaign.RingTimeout, campaign.Troncales)
 	}
 
-	// Update campaign stats (roughly)
-	counts, _ := s.repo.CountContactsByStatus(campaign.ID)
-	processed := counts["completed"] + counts["failed"] + counts["skipped"]
-	s.repo.UpdateCampaignStats(campaign.ID, processed, counts["completed"], counts["failed"])
+	// Campaign stats are written at most every StatsFlushInterval
+	s.stats.flush(campaign.ID, false)
+
+	return len(contacts)
 }
 
 // getContactsPerCycle reads the contacts_per_cycle config from database
 // This allows dynamic configuration changes without service restart
 func (s *Sweeper) getContactsPerCycle() int {
-	val, err := s.repo.GetConfig("contacts_per_cycle")
-	if err != nil || val == "" {
-		return DefaultContactsPerCycle
-	}
-	
-	n, err := strconv.Atoi(val)
-	if err != nil || n <= 0 {
-		return DefaultContactsPerCycle
-	}
-	
-	return n
+	return ContactsPerCycle(s.repo)
 }
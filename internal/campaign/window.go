@@ -0,0 +1,85 @@
+package campaign
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"apicall/internal/eventbus"
+	"apicall/internal/notify"
+)
+
+// WindowInterval es cada cuánto se revisan los inicios (start_at), fines (end_at) y recurrencias programados
+const WindowInterval = 15 * time.Second
+
+// applyWindows activa las campañas cuyo start_at llegó, completa las que pasaron su end_at y aplica
+// las recurrencias vencidas (como máximo cada WindowInterval). Un inicio programado respeta los topes de campañas activas:
+// si no hay lugar se reintenta en la próxima revisión.
+func (s *Sweeper) applyWindows(now time.Time) {
+	if now.Sub(s.windowsAt) < WindowInterval {
+		return
+	}
+	s.windowsAt = now
+
+	ends, err := s.repo.GetDueCampaignEnds(now)
+	if err != nil {
+		log.Printf("[Sweeper] %v", err)
+	}
+	for i := range ends {
+		c := &ends[i]
+		ended, err := s.repo.AutoEndCampaign(c.ID)
+		if err != nil {
+			log.Printf("[Sweeper] %v", err)
+			continue
+		}
+		if !ended {
+			continue
+		}
+		log.Printf("[Sweeper] Campaign %d completed by its scheduled end (%s)", c.ID, c.EndAt.Format(time.RFC3339))
+		s.cancelDials(c.ID)
+		s.stats.flush(c.ID, true)
+		go s.summarize(c.ID) // Notifica campaign.completed con el resumen final
+	}
+
+	s.applyRecurrences(now)
+
+	starts, err := s.repo.GetDueCampaignStarts(now)
+	if err != nil {
+		log.Printf("[Sweeper] %v", err)
+		return
+	}
+	waiting := make(map[int]bool)
+	for i := range starts {
+		c := &starts[i]
+		active, err := s.repo.GetActiveCampaigns()
+		if err != nil {
+			log.Printf("[Sweeper] Error fetching active campaigns: %v", err)
+			return
+		}
+		if err := s.limiter.CheckStart(active, c); err != nil {
+			if !s.waitStart[c.ID] {
+				log.Printf("[Sweeper] Scheduled start of campaign %d waiting: %v", c.ID, err)
+			}
+			waiting[c.ID] = true
+			continue
+		}
+		started, err := s.repo.AutoStartCampaign(c.ID, now)
+		if err != nil {
+			log.Printf("[Sweeper] %v", err)
+			continue
+		}
+		if !started {
+			continue
+		}
+		log.Printf("[Sweeper] Campaign %d started by its scheduled start (%s)", c.ID, c.StartAt.Format(time.RFC3339))
+		s.notifier.Notify(c.ProyectoID, notify.EventCampaignStarted,
+			fmt.Sprintf("Campaña %s (ID %d): inicio programado, %s -> active", c.Nombre, c.ID, c.Estado))
+		s.events.PublishCampaign(eventbus.EventCampaignStarted, c, map[string]interface{}{
+			"nombre":          c.Nombre,
+			"estado_anterior": c.Estado,
+			"estado":          "active",
+			"programado":      true,
+		})
+	}
+	s.waitStart = waiting
+}
@@ -2,38 +2,89 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Modos de despliegue (mode)
+const (
+	ModeStandalone = "standalone" // Default: Asterisk local, spool de .call files y auto-aprovisionamiento
+	ModeContainer  = "container"  // Docker/Kubernetes: Asterisk y MySQL remotos, sin tocar el filesystem ni requerir root
+)
+
 // Config estructura principal de configuración
 type Config struct {
-	FastAGI  FastAGIConfig  `yaml:"fastagi"`
-	AMI      AMIConfig      `yaml:"ami"`
-	API      APIConfig      `yaml:"api"`
-	Database DatabaseConfig `yaml:"database"`
-	Asterisk AsteriskConfig `yaml:"asterisk"`
-	Log      LogConfig      `yaml:"log"`
+	Mode         string             `yaml:"mode"` // standalone (vacío) o container
+	FastAGI      FastAGIConfig      `yaml:"fastagi"`
+	AMI          AMIConfig          `yaml:"ami"`
+	Nodes        []AMIConfig        `yaml:"asterisk_nodes"` // Nodos Asterisk adicionales (el de ami es el principal)
+	ARI          ARIConfig          `yaml:"ari"`
+	API          APIConfig          `yaml:"api"`
+	Database     DatabaseConfig     `yaml:"database"`
+	Asterisk     AsteriskConfig     `yaml:"asterisk"`
+	Log          LogConfig          `yaml:"log"`
+	Security     SecurityConfig     `yaml:"security"`
+	Auth         AuthConfig         `yaml:"auth"`
+	Retention    RetentionConfig    `yaml:"retention"`
+	Provisioning ProvisioningConfig `yaml:"provisioning"`
+	HA           HAConfig           `yaml:"ha"`
+	Simulation   SimulationConfig   `yaml:"simulation"`
+	Campaigns    CampaignsConfig    `yaml:"campaigns"`
+	SMTP         SMTPConfig         `yaml:"smtp"`
+	Alerts       AlertsConfig       `yaml:"alerts"`
+	EventBus     EventBusConfig     `yaml:"event_bus"`
+	Reputation   ReputationConfig   `yaml:"reputation"`
 }
 
 type FastAGIConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	MaxSessions    int    `yaml:"max_sessions"`    // Sesiones concurrentes (0 = 500)
+	IdleTimeout    int    `yaml:"idle_timeout"`    // Segundos de espera en el handshake AGI (0 = 30)
+	CommandTimeout int    `yaml:"command_timeout"` // Segundos por comando AGI (0 = 30)
+	MediaTimeout   int    `yaml:"media_timeout"`   // Segundos para STREAM FILE / EXEC (0 = 600)
+	BridgeTimeout  int    `yaml:"bridge_timeout"`  // Segundos máximos de una transferencia a agente (0 = 7200)
 }
 
 type AMIConfig struct {
-	Host              string `yaml:"host"`
-	Port              int    `yaml:"port"`
+	Name                  string `yaml:"name"` // Nombre del nodo Asterisk (vacío = default en ami, nodo-N en asterisk_nodes)
+	Host                  string `yaml:"host"`
+	Port                  int    `yaml:"port"`
+	URL                   string `yaml:"url"` // ami://host:puerto o amis://host:puerto (TLS); reemplaza host y port
+	Username              string `yaml:"username"`
+	Secret                string `yaml:"secret"`
+	Events                string `yaml:"events"`             // Clases de eventos pedidas en el Login (ej: call; vacío = todas)
+	ReconnectInterval     int    `yaml:"reconnect_interval"` // Espera inicial entre reconexiones (se duplica en cada intento)
+	ReconnectMax          int    `yaml:"reconnect_max"`      // Tope de la espera entre reconexiones en segundos (0 = 60)
+	TLSCAFile             string `yaml:"tls_ca_file"`        // CA para validar el certificado de Asterisk (vacío = las del sistema)
+	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify"`
+	AGIURL                string `yaml:"agi_url"`      // FastAGI de apicall visto desde este nodo (vacío = el del dialplan)
+	MaxChannels           int    `yaml:"max_channels"` // Canales simultáneos en este nodo (0 = sin límite propio)
+}
+
+// ARIConfig habilita el backend ARI (dial_engine=ari): originate e IVR desde una aplicación Stasis
+type ARIConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	URL               string `yaml:"url"` // ej: http://127.0.0.1:8088
 	Username          string `yaml:"username"`
-	Secret            string `yaml:"secret"`
-	ReconnectInterval int    `yaml:"reconnect_interval"`
+	Password          string `yaml:"password"`
+	App               string `yaml:"app"`                // Aplicación Stasis (vacío = apicall)
+	ReconnectInterval int    `yaml:"reconnect_interval"` // Segundos entre reconexiones del WebSocket (0 = 5)
 }
 
 type APIConfig struct {
-	Host       string `yaml:"host"`
-	Port       int    `yaml:"port"`
-	EnableCORS bool   `yaml:"enable_cors"`
+	Host          string `yaml:"host"`
+	Port          int    `yaml:"port"`
+	EnableCORS    bool   `yaml:"enable_cors"`
+	EnableGraphQL bool   `yaml:"enable_graphql"` // Endpoint /api/graphql de solo lectura para dashboards
+	Locale        string `yaml:"locale"`         // Idioma de los mensajes de error si la solicitud no envía Accept-Language (es, en; vacío = es)
 }
 
 type DatabaseConfig struct {
@@ -44,13 +95,267 @@ type DatabaseConfig struct {
 	Database     string `yaml:"database"`
 	MaxOpenConns int    `yaml:"max_open_conns"`
 	MaxIdleConns int    `yaml:"max_idle_conns"`
+	// Archivo donde el batcher de logs guarda las actualizaciones que no entran en el buffer
+	// o no se pudieron escribir al detenerse ("-" = sin journal, se descartan)
+	BatcherJournal string `yaml:"batcher_journal"`
 }
 
 type AsteriskConfig struct {
-	SoundPath       string `yaml:"sound_path"`
-	DefaultContext  string `yaml:"default_context"`
-	OutboundContext string `yaml:"outbound_context"`
-	MaxCPS          int    `yaml:"max_cps"` // Límite de llamadas por segundo
+	SoundPath       string      `yaml:"sound_path"`
+	DefaultContext  string      `yaml:"default_context"`
+	OutboundContext string      `yaml:"outbound_context"`
+	MaxCPS          int         `yaml:"max_cps"`       // Límite de llamadas por segundo
+	MaxChannels     int         `yaml:"max_channels"`  // Límite global de canales (0 = default/DB)
+	MaxPerTrunk     int         `yaml:"max_per_trunk"` // Límite de canales por troncal (0 = default/DB)
+	AMDParams       string      `yaml:"amd_params"`    // Parámetros por defecto de AMD() (vacío = valores internos)
+	Spool           SpoolConfig `yaml:"spool"`
+}
+
+// Transportes del spooler (asterisk.spool.transport)
+const (
+	SpoolLocal = "local" // .call files en el spool del mismo host (default)
+	SpoolSFTP  = "sftp"  // .call files entregados por SFTP a un Asterisk remoto
+	SpoolAMI   = "ami"   // Sin .call files: las llamadas del spooler se originan por AMI
+)
+
+// SpoolConfig define cómo llegan los .call files al directorio outgoing de Asterisk
+type SpoolConfig struct {
+	Transport             string `yaml:"transport"` // local (vacío), sftp o ami
+	Host                  string `yaml:"host"`      // Asterisk remoto (sftp)
+	Port                  int    `yaml:"port"`      // 0 = 22
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	KeyFile               string `yaml:"key_file"`                 // Clave privada sin passphrase (alternativa a password)
+	KnownHosts            string `yaml:"known_hosts"`              // known_hosts para verificar la clave del host
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key"` // Solo para pruebas
+	RemoteDir             string `yaml:"remote_dir"`               // Vacío = /var/spool/asterisk/outgoing
+	Timeout               int    `yaml:"timeout"`                  // Segundos para conectar (0 = 10)
+}
+
+// SecurityConfig define la política de contraseñas y el bloqueo de cuentas
+type SecurityConfig struct {
+	PasswordMinLength     int  `yaml:"password_min_length"` // Default 8
+	PasswordRequireUpper  bool `yaml:"password_require_upper"`
+	PasswordRequireLower  bool `yaml:"password_require_lower"`
+	PasswordRequireDigit  bool `yaml:"password_require_digit"`
+	PasswordRequireSymbol bool `yaml:"password_require_symbol"`
+	MaxFailedLogins       int  `yaml:"max_failed_logins"` // Intentos antes de bloquear (default 5, -1 = sin bloqueo)
+	LockoutMinutes        int  `yaml:"lockout_minutes"`   // Duración del bloqueo (default 15, -1 = hasta desbloqueo manual)
+	// Clave AES-256 para cifrar los secretos SIP de las troncales en la BD (32 bytes en base64 o hex).
+	// secrets_key_file la lee de un archivo (secreto montado por Vault, Kubernetes o el KMS).
+	SecretsKey     string `yaml:"secrets_key"`
+	SecretsKeyFile string `yaml:"secrets_key_file"`
+}
+
+// AuthConfig define los proveedores de identidad externos que conviven con los usuarios locales
+type AuthConfig struct {
+	LDAP LDAPConfig `yaml:"ldap"`
+	OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// RoleMapping asigna el rol de apicall según los grupos del proveedor de identidad
+type RoleMapping struct {
+	Roles       map[string]string `yaml:"roles"`        // Grupo -> rol (viewer, supervisor, admin o superadmin); gana el de más privilegios
+	DefaultRole string            `yaml:"default_role"` // Rol si ningún grupo coincide (vacío = acceso denegado)
+	TenantID    int               `yaml:"tenant_id"`    // Organización de los usuarios que se crean (0 = 1)
+}
+
+// LDAPConfig valida las contraseñas contra un directorio LDAP o Active Directory (url vacía = desactivado)
+type LDAPConfig struct {
+	URL                string `yaml:"url"`                  // ldap://host:389 o ldaps://host:636
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // ldaps con certificado autofirmado
+	BindDN             string `yaml:"bind_dn"`              // Cuenta de servicio para buscar al usuario (vacío = anónimo)
+	BindPassword       string `yaml:"bind_password"`
+	BaseDN             string `yaml:"base_dn"`         // Ej: ou=people,dc=empresa,dc=com
+	UserAttribute      string `yaml:"user_attribute"`  // Default uid (Active Directory: sAMAccountName)
+	ObjectClass        string `yaml:"object_class"`    // Filtro opcional, ej: person
+	GroupAttribute     string `yaml:"group_attribute"` // Default memberOf
+	NameAttribute      string `yaml:"name_attribute"`  // Default cn
+	RoleMapping        `yaml:",inline"`
+}
+
+// Enabled indica si hay un directorio LDAP configurado
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// OIDCConfig habilita el login con OpenID Connect (Keycloak, Google, Azure AD...); issuer vacío = desactivado
+type OIDCConfig struct {
+	Issuer        string `yaml:"issuer"` // Ej: https://sso.empresa.com/realms/apicall o https://accounts.google.com
+	ClientID      string `yaml:"client_id"`
+	ClientSecret  string `yaml:"client_secret"`
+	RedirectURL   string `yaml:"redirect_url"`   // https://apicall.empresa.com/api/v1/auth/oidc/callback
+	Scopes        string `yaml:"scopes"`         // Default "openid profile email"
+	UsernameClaim string `yaml:"username_claim"` // Default preferred_username (Google: email)
+	GroupsClaim   string `yaml:"groups_claim"`   // Default groups
+	FrontendURL   string `yaml:"frontend_url"`   // Adónde vuelve el navegador con el token (default /)
+	RoleMapping   `yaml:",inline"`
+}
+
+// Enabled indica si hay un proveedor OIDC configurado
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// validate comprueba los proveedores de identidad configurados y sus roles
+func (c AuthConfig) validate() error {
+	if c.LDAP.Enabled() {
+		u, err := url.Parse(c.LDAP.URL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("auth.ldap.url debe ser ldap://host:puerto o ldaps://host:puerto")
+		}
+		if c.LDAP.BaseDN == "" {
+			return fmt.Errorf("auth.ldap.base_dn es requerido con url")
+		}
+	}
+	if c.OIDC.Enabled() && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		return fmt.Errorf("auth.oidc.client_id y redirect_url son requeridos con issuer")
+	}
+	for name, m := range map[string]RoleMapping{"ldap": c.LDAP.RoleMapping, "oidc": c.OIDC.RoleMapping} {
+		roles := []string{m.DefaultRole}
+		for _, role := range m.Roles {
+			roles = append(roles, role)
+		}
+		for _, role := range roles {
+			switch role {
+			case "", "viewer", "supervisor", "admin", "superadmin":
+			default:
+				return fmt.Errorf("auth.%s: rol inválido %s (viewer, supervisor, admin o superadmin)", name, role)
+			}
+		}
+	}
+	return nil
+}
+
+// RetentionConfig define cómo se purgan los datos vencidos (los días se configuran por proyecto en retention_days)
+type RetentionConfig struct {
+	DryRun         bool   `yaml:"dry_run"`         // Solo reporta lo que se eliminaría
+	ArchiveDir     string `yaml:"archive_dir"`     // CSV comprimidos antes de purgar (vacío = purgar sin archivar)
+	S3URI          string `yaml:"s3_uri"`          // Destino s3://bucket/prefijo de los archivos (requiere aws CLI)
+	RecordingsPath string `yaml:"recordings_path"` // Grabaciones en <path>/<proyecto_id>/ (vacío = no aplica)
+	Interval       int    `yaml:"interval"`        // Minutos entre pasadas (0 = 60)
+}
+
+// HAConfig habilita la elección de líder entre instancias que comparten la BD: todas sirven
+// la API, pero solo la líder barre campañas, carga la cola del spooler y corre las limpiezas.
+type HAConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	InstanceID   string `yaml:"instance_id"`   // Nombre de la instancia en los logs (vacío = hostname)
+	LeaseSeconds int    `yaml:"lease_seconds"` // Vigencia del lease de líder (0 = 15); se renueva cada tercio
+}
+
+// SimulationConfig habilita el motor de simulación (dial_engine=sim): finge los originates y sus
+// resultados sin tocar Asterisk, para pruebas de carga del Sweeper, el batcher, los límites y los reportes.
+// Las tasas son probabilidades entre 0 y 1.
+type SimulationConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	All         bool    `yaml:"all"`          // Todas las llamadas usan el simulador, sea cual sea el dial_engine (no requiere AMI)
+	AnswerRate  float64 `yaml:"answer_rate"`  // Llamadas contestadas (0 = 0.6)
+	BusyRate    float64 `yaml:"busy_rate"`    // Ocupado
+	FailRate    float64 `yaml:"fail_rate"`    // Congestión / fallo de red
+	MachineRate float64 `yaml:"machine_rate"` // De las contestadas, contestador automático
+	DTMFRate    float64 `yaml:"dtmf_rate"`    // De las contestadas por humanos, marcan el DTMF esperado
+	RingMin     int     `yaml:"ring_min"`     // Segundos de timbrado mínimo (0 = 2)
+	RingMax     int     `yaml:"ring_max"`     // Segundos de timbrado máximo (0 = 15)
+	TalkMean    int     `yaml:"talk_mean"`    // Media de la duración de la conversación en segundos, exponencial (0 = 30)
+}
+
+// CampaignsConfig limita las campañas activas a la vez para proteger la capacidad de las troncales.
+// Al superar el tope no se puede iniciar otra campaña y, si ya hay más activas, marcan las más antiguas.
+type CampaignsConfig struct {
+	MaxActive            int `yaml:"max_active"`              // Campañas activas en todo el sistema (0 = sin límite)
+	MaxActivePerProyecto int `yaml:"max_active_per_proyecto"` // Campañas activas por proyecto (0 = sin límite)
+}
+
+// SMTPConfig es el servidor de correo para los resúmenes de campaña y las alertas (vacío = no se envían emails)
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 0 = 587 (STARTTLS si el servidor lo ofrece) o 465 con tls
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"` // Remitente, ej: "Apicall <apicall@empresa.com>"
+	TLS      bool   `yaml:"tls"`  // TLS implícito (puerto 465) en lugar de STARTTLS
+}
+
+// Enabled indica si hay un servidor SMTP configurado
+func (c SMTPConfig) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// AlertsConfig define las reglas de alerta operativa. Cada alerta queda en apicall_alerts
+// (GET /api/v1/alerts) y se envía por email al abrirse y al resolverse.
+type AlertsConfig struct {
+	Enabled          bool    `yaml:"enabled"`
+	Emails           string  `yaml:"emails"`              // Destinatarios separados por coma (vacío = solo se registran)
+	Interval         int     `yaml:"interval"`            // Segundos entre evaluaciones (0 = 60)
+	TrunkDown        bool    `yaml:"trunk_down"`          // Troncal activa inalcanzable desde todos los nodos que la tienen
+	DBUnreachable    bool    `yaml:"db_unreachable"`      // La base de datos no responde
+	MinAnswerRate    float64 `yaml:"min_answer_rate"`     // % mínimo de contestadas por campaña activa (0 = desactivada)
+	AnswerRateWindow int     `yaml:"answer_rate_window"`  // Últimas llamadas finalizadas evaluadas (0 = 200)
+	SpoolSaturation  int     `yaml:"spool_saturation"`    // % de la cola persistente del spool ocupado (0 = desactivada)
+	CIDMinAnswerRate float64 `yaml:"cid_min_answer_rate"` // % mínimo de contestadas por Caller ID: debajo pasa a cuarentena (0 = desactivada)
+	CIDAnswerDrop    float64 `yaml:"cid_answer_drop"`     // % de caída frente a los demás Caller IDs del proyecto que lo pone en cuarentena (0 = desactivada)
+	CIDWindow        int     `yaml:"cid_window"`          // Minutos evaluados por Caller ID (0 = 60)
+	CIDMinCalls      int     `yaml:"cid_min_calls"`       // Llamadas finalizadas mínimas en la ventana para evaluar un Caller ID (0 = 50)
+}
+
+// EventBusConfig publica los eventos de llamadas y campañas en un broker para que otros sistemas
+// los consuman sin webhooks por evento (driver vacío = desactivado)
+type EventBusConfig struct {
+	Driver string `yaml:"driver"`  // redis (Streams), nats o rabbitmq
+	URL    string `yaml:"url"`     // redis://, nats:// o amqp:// (rediss://, tls:// y amqps:// con TLS)
+	Topic  string `yaml:"topic"`   // Stream (redis), prefijo del subject (nats) o exchange topic (rabbitmq). Default apicall.events
+	Events string `yaml:"events"`  // Eventos publicados separados por coma (vacío = todos)
+	MaxLen int    `yaml:"max_len"` // redis: largo máximo aproximado del stream (0 = 100000)
+	Buffer int    `yaml:"buffer"`  // Eventos retenidos en memoria mientras el broker no responde (0 = 10000)
+}
+
+// ReputationConfig consulta cada semana en una API de reputación cómo se etiquetan los Caller IDs
+// presentados (provider vacío = desactivado; requiere reinicio)
+type ReputationConfig struct {
+	Provider   string `yaml:"provider"`    // http (API JSON genérica)
+	URL        string `yaml:"url"`         // Consulta con {number}, ej: https://api.proveedor.com/v1/lookup?phone={number}
+	APIKey     string `yaml:"api_key"`     // Se envía como Authorization: Bearer (vacío = sin autenticación)
+	LabelField string `yaml:"label_field"` // Campo JSON con la etiqueta; admite rutas con punto (vacío = label)
+	ScoreField string `yaml:"score_field"` // Campo JSON con el puntaje de riesgo (vacío = score)
+	Days       int    `yaml:"days"`        // Días entre consultas de un mismo Caller ID (0 = 7)
+	MaxLookups int    `yaml:"max_lookups"` // Consultas por pasada horaria (0 = 200)
+}
+
+// Addr devuelve host:puerto del servidor SMTP
+func (c SMTPConfig) Addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 587
+		if c.TLS {
+			port = 465
+		}
+	}
+	return fmt.Sprintf("%s:%d", c.Host, port)
+}
+
+// ProvisioningConfig controla el auto-aprovisionamiento al arrancar (paquetes, /etc/asterisk, bootstrap de BD).
+// Sin la sección se mantiene el comportamiento histórico: todo habilitado.
+type ProvisioningConfig struct {
+	Enabled        *bool `yaml:"enabled"`         // Default true (false = no toca nada, ni migraciones)
+	ManageAsterisk *bool `yaml:"manage_asterisk"` // Instala Asterisk y escribe sus archivos de configuración (default true)
+	ManageDB       *bool `yaml:"manage_db"`       // Instala MariaDB y crea BD/usuario si no conecta (default true)
+	DryRun         bool  `yaml:"dry_run"`         // Solo muestra el plan de cambios
+}
+
+// IsEnabled indica si el aprovisionamiento está habilitado
+func (p ProvisioningConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// AsteriskManaged indica si se gestiona la instalación y configuración de Asterisk
+func (p ProvisioningConfig) AsteriskManaged() bool {
+	return p.IsEnabled() && (p.ManageAsterisk == nil || *p.ManageAsterisk)
+}
+
+// DBManaged indica si se gestiona la instalación y el bootstrap de MariaDB
+func (p ProvisioningConfig) DBManaged() bool {
+	return p.IsEnabled() && (p.ManageDB == nil || *p.ManageDB)
 }
 
 type LogConfig struct {
@@ -58,32 +363,87 @@ type LogConfig struct {
 	Format string `yaml:"format"`
 }
 
-// Load carga la configuración desde archivo YAML
+// Load carga la configuración desde archivo YAML.
+// En modo container (APICALL_MODE=container) el archivo es opcional: todo puede venir de variables de entorno.
 func Load(path string) (*Config, error) {
+	var cfg Config
+
 	// Intentar leer el archivo
 	data, err := os.ReadFile(path)
-	if err != nil {
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("error parseando YAML: %w", err)
+		}
+	case os.IsNotExist(err) && os.Getenv("APICALL_MODE") == ModeContainer:
+		// Sin archivo: solo variables de entorno
+	default:
 		return nil, fmt.Errorf("error leyendo archivo de configuración: %w", err)
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("error parseando YAML: %w", err)
-	}
-
 	// Permitir sobrescribir con variables de entorno
-	overrideWithEnv(&cfg)
+	if err := overrideWithEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Mode != "" && cfg.Mode != ModeStandalone && cfg.Mode != ModeContainer {
+		return nil, fmt.Errorf("mode inválido: %s (standalone o container)", cfg.Mode)
+	}
+	switch cfg.Asterisk.Spool.Transport {
+	case "", SpoolLocal, SpoolAMI:
+	case SpoolSFTP:
+		if cfg.Asterisk.Spool.Host == "" || cfg.Asterisk.Spool.Username == "" {
+			return nil, fmt.Errorf("asterisk.spool: host y username son requeridos con transport=sftp")
+		}
+	default:
+		return nil, fmt.Errorf("asterisk.spool.transport inválido: %s (local, sftp o ami)", cfg.Asterisk.Spool.Transport)
+	}
+	for _, n := range append([]AMIConfig{cfg.AMI}, cfg.Nodes...) {
+		if _, _, err := n.Endpoint(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Simulation.validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.EventBus.Driver {
+	case "", "redis", "nats", "rabbitmq":
+	default:
+		return nil, fmt.Errorf("event_bus.driver inválido: %s (redis, nats o rabbitmq)", cfg.EventBus.Driver)
+	}
+	if cfg.EventBus.Driver != "" && cfg.EventBus.URL == "" {
+		return nil, fmt.Errorf("event_bus.url es requerido con driver=%s", cfg.EventBus.Driver)
+	}
+	switch cfg.Reputation.Provider {
+	case "":
+	case "http":
+		if !strings.Contains(cfg.Reputation.URL, "{number}") {
+			return nil, fmt.Errorf("reputation.url es requerido con provider=http y debe incluir {number}")
+		}
+	default:
+		return nil, fmt.Errorf("reputation.provider inválido: %s (http)", cfg.Reputation.Provider)
+	}
+	switch cfg.API.Locale {
+	case "", "es", "en":
+	default:
+		return nil, fmt.Errorf("api.locale inválido: %s (es o en)", cfg.API.Locale)
+	}
+	if err := cfg.Auth.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.IsContainer() {
+		cfg.applyContainerDefaults()
+	}
+	cfg.Security.applyDefaults()
 
 	return &cfg, nil
 }
 
-// overrideWithEnv permite sobrescribir configuración con variables de entorno
-func overrideWithEnv(cfg *Config) {
-	if v := os.Getenv("APICALL_AMI_USERNAME"); v != "" {
-		cfg.AMI.Username = v
-	}
-	if v := os.Getenv("APICALL_AMI_SECRET"); v != "" {
-		cfg.AMI.Secret = v
+// overrideWithEnv permite sobrescribir configuración con variables de entorno.
+// Cualquier clave se sobrescribe con APICALL_<SECCION>_<CLAVE> (ej: APICALL_AMI_HOST, APICALL_API_PORT,
+// APICALL_PROVISIONING_DRY_RUN); APICALL_DB_* se mantienen como alias de database.
+func overrideWithEnv(cfg *Config) error {
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), "APICALL"); err != nil {
+		return err
 	}
 	if v := os.Getenv("APICALL_DB_USERNAME"); v != "" {
 		cfg.Database.Username = v
@@ -97,6 +457,123 @@ func overrideWithEnv(cfg *Config) {
 	if v := os.Getenv("APICALL_DB_DATABASE"); v != "" {
 		cfg.Database.Database = v
 	}
+	return nil
+}
+
+// applyEnv recorre los campos con tag yaml y asigna las variables de entorno definidas
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok || raw == "" {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s inválido: %q", name, raw)
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s inválido: %q", name, raw)
+			}
+			field.SetBool(b)
+		case reflect.Ptr:
+			if field.Type().Elem().Kind() != reflect.Bool {
+				continue
+			}
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s inválido: %q", name, raw)
+			}
+			field.Set(reflect.ValueOf(&b))
+		}
+	}
+	return nil
+}
+
+// IsContainer indica si corre en modo container (Docker/Kubernetes)
+func (c *Config) IsContainer() bool {
+	return c.Mode == ModeContainer
+}
+
+// applyContainerDefaults completa los valores que normalmente trae el YAML y desactiva
+// todo lo que toca el filesystem del host: instalación de paquetes y archivos de /etc/asterisk
+// (las migraciones siguen corriendo contra la BD remota)
+func (c *Config) applyContainerDefaults() {
+	if c.FastAGI.Host == "" {
+		c.FastAGI.Host = "0.0.0.0"
+	}
+	if c.FastAGI.Port == 0 {
+		c.FastAGI.Port = 4573
+	}
+	if c.API.Host == "" {
+		c.API.Host = "0.0.0.0"
+	}
+	if c.API.Port == 0 {
+		c.API.Port = 8080
+	}
+	if c.AMI.Port == 0 {
+		c.AMI.Port = 5038
+	}
+	if c.AMI.ReconnectInterval == 0 {
+		c.AMI.ReconnectInterval = 5
+	}
+	if c.Database.Port == 0 {
+		c.Database.Port = 3306
+	}
+	if c.Database.MaxOpenConns == 0 {
+		c.Database.MaxOpenConns = 100
+	}
+	if c.Database.MaxIdleConns == 0 {
+		c.Database.MaxIdleConns = 25
+	}
+
+	off := false
+	c.Provisioning.ManageAsterisk = &off
+	c.Provisioning.ManageDB = &off
+
+	// Sin spool local: SFTP si está configurado, si no Originate por AMI
+	if c.Asterisk.Spool.Transport != SpoolSFTP {
+		c.Asterisk.Spool.Transport = SpoolAMI
+	}
+}
+
+// applyDefaults completa los valores no definidos de la política de seguridad
+func (s *SecurityConfig) applyDefaults() {
+	if s.PasswordMinLength == 0 {
+		s.PasswordMinLength = 8
+	}
+	switch {
+	case s.MaxFailedLogins == 0:
+		s.MaxFailedLogins = 5
+	case s.MaxFailedLogins < 0:
+		s.MaxFailedLogins = 0
+	}
+	switch {
+	case s.LockoutMinutes == 0:
+		s.LockoutMinutes = 15
+	case s.LockoutMinutes < 0:
+		s.LockoutMinutes = 0
+	}
 }
 
 // Address devuelve la dirección completa del servidor FastAGI
@@ -104,6 +581,99 @@ func (f FastAGIConfig) Address() string {
 	return fmt.Sprintf("%s:%d", f.Host, f.Port)
 }
 
+// SessionLimit devuelve el máximo de sesiones AGI concurrentes
+func (f FastAGIConfig) SessionLimit() int {
+	if f.MaxSessions <= 0 {
+		return 500
+	}
+	return f.MaxSessions
+}
+
+// IdleDeadline devuelve la espera máxima sin datos de Asterisk fuera de un comando
+func (f FastAGIConfig) IdleDeadline() time.Duration {
+	return secondsOr(f.IdleTimeout, 30)
+}
+
+// CommandDeadline devuelve el timeout de comandos AGI cortos
+func (f FastAGIConfig) CommandDeadline() time.Duration {
+	return secondsOr(f.CommandTimeout, 30)
+}
+
+// MediaDeadline devuelve el timeout de comandos que reproducen audio o ejecutan aplicaciones
+func (f FastAGIConfig) MediaDeadline() time.Duration {
+	return secondsOr(f.MediaTimeout, 600)
+}
+
+// BridgeDeadline devuelve el timeout de Queue()/Dial() hacia agentes (incluye la conversación)
+func (f FastAGIConfig) BridgeDeadline() time.Duration {
+	return secondsOr(f.BridgeTimeout, 7200)
+}
+
+func secondsOr(v, def int) time.Duration {
+	if v <= 0 {
+		v = def
+	}
+	return time.Duration(v) * time.Second
+}
+
+// RunInterval devuelve el intervalo entre pasadas del worker de retención
+func (r RetentionConfig) RunInterval() time.Duration {
+	return secondsOr(r.Interval*60, 3600)
+}
+
+// LeaseTTL devuelve la vigencia del lease de líder
+func (h HAConfig) LeaseTTL() time.Duration {
+	return secondsOr(h.LeaseSeconds, 15)
+}
+
+func (s SimulationConfig) validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	for _, rate := range []float64{s.AnswerRate, s.BusyRate, s.FailRate, s.MachineRate, s.DTMFRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("simulation: las tasas deben estar entre 0 y 1")
+		}
+	}
+	if s.Answer()+s.BusyRate+s.FailRate > 1 {
+		return fmt.Errorf("simulation: answer_rate + busy_rate + fail_rate no puede superar 1")
+	}
+	if s.RingMax > 0 && s.RingMax < s.RingMin {
+		return fmt.Errorf("simulation: ring_max no puede ser menor que ring_min")
+	}
+	return nil
+}
+
+// Answer devuelve la tasa de llamadas contestadas
+func (s SimulationConfig) Answer() float64 {
+	if s.AnswerRate <= 0 {
+		return 0.6
+	}
+	return s.AnswerRate
+}
+
+// RingRange devuelve el timbrado mínimo y máximo de las llamadas simuladas
+func (s SimulationConfig) RingRange() (time.Duration, time.Duration) {
+	min, max := secondsOr(s.RingMin, 2), secondsOr(s.RingMax, 15)
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// TalkTime devuelve la duración media de las conversaciones simuladas
+func (s SimulationConfig) TalkTime() time.Duration {
+	return secondsOr(s.TalkMean, 30)
+}
+
+// AppName devuelve el nombre de la aplicación Stasis
+func (a ARIConfig) AppName() string {
+	if a.App == "" {
+		return "apicall"
+	}
+	return a.App
+}
+
 // Address devuelve la dirección completa del servidor API
 func (a APIConfig) Address() string {
 	return fmt.Sprintf("%s:%d", a.Host, a.Port)
@@ -111,7 +681,92 @@ func (a APIConfig) Address() string {
 
 // Address devuelve la dirección completa del servidor AMI
 func (a AMIConfig) Address() string {
-	return fmt.Sprintf("%s:%d", a.Host, a.Port)
+	addr, _, err := a.Endpoint()
+	if err != nil {
+		return a.URL
+	}
+	return addr
+}
+
+// Endpoint devuelve host:puerto y si la sesión va cifrada. Con url, el esquema amis:// usa TLS
+// (puerto por defecto 5039, el tlsbindport de manager.conf); ami:// es TCP plano (5038).
+func (a AMIConfig) Endpoint() (string, bool, error) {
+	if a.URL == "" {
+		return fmt.Sprintf("%s:%d", a.Host, a.Port), false, nil
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Hostname() == "" {
+		return "", false, fmt.Errorf("ami.url inválida: %s", a.URL)
+	}
+	var useTLS bool
+	port := u.Port()
+	switch u.Scheme {
+	case "ami":
+		if port == "" {
+			port = "5038"
+		}
+	case "amis":
+		useTLS = true
+		if port == "" {
+			port = "5039"
+		}
+	default:
+		return "", false, fmt.Errorf("ami.url: esquema %q no soportado (ami o amis)", u.Scheme)
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// ReconnectBackoff devuelve la espera inicial y el tope entre reconexiones al AMI
+func (a AMIConfig) ReconnectBackoff() (time.Duration, time.Duration) {
+	return secondsOr(a.ReconnectInterval, 5), secondsOr(a.ReconnectMax, 60)
+}
+
+// SpoolTransport devuelve el transporte efectivo del spooler
+func (a AsteriskConfig) SpoolTransport() string {
+	if a.Spool.Transport == "" {
+		return SpoolLocal
+	}
+	return a.Spool.Transport
+}
+
+// Address devuelve host:puerto del servidor SSH/SFTP
+func (s SpoolConfig) Address() string {
+	port := s.Port
+	if port == 0 {
+		port = 22
+	}
+	return fmt.Sprintf("%s:%d", s.Host, port)
+}
+
+// Dir devuelve el directorio outgoing remoto
+func (s SpoolConfig) Dir() string {
+	if s.RemoteDir == "" {
+		return "/var/spool/asterisk/outgoing"
+	}
+	return s.RemoteDir
+}
+
+// AsteriskNodes devuelve los nodos Asterisk a los que se reparten los originate: ami + asterisk_nodes
+func (c *Config) AsteriskNodes() []AMIConfig {
+	nodes := make([]AMIConfig, 0, 1+len(c.Nodes))
+	primary := c.AMI
+	if primary.Name == "" {
+		primary.Name = "default"
+	}
+	nodes = append(nodes, primary)
+	for i, n := range c.Nodes {
+		if n.Name == "" {
+			n.Name = fmt.Sprintf("nodo-%d", i+1)
+		}
+		if n.Port == 0 {
+			n.Port = 5038
+		}
+		if n.ReconnectInterval == 0 {
+			n.ReconnectInterval = 5
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
 }
 
 // DSN devuelve el Data Source Name para MySQL
@@ -119,3 +774,14 @@ func (d DatabaseConfig) DSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4",
 		d.Username, d.Password, d.Host, d.Port, d.Database)
 }
+
+// JournalPath devuelve el archivo del journal del batcher de logs ("" = desactivado)
+func (d DatabaseConfig) JournalPath() string {
+	switch d.BatcherJournal {
+	case "":
+		return "/var/lib/apicall/log_batcher.journal"
+	case "-":
+		return ""
+	}
+	return d.BatcherJournal
+}
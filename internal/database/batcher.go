@@ -1,18 +1,29 @@
 package database
 
 import (
+	"bufio"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// Defaults, tunable with the batcher_* keys of apicall_config (see batcher_stats.go)
 const (
 	BatchSize     = 1000
 	FlushInterval = 500 * time.Millisecond
 	BufferSize    = 5000
+
+	retryMinWait = time.Second
+	retryMaxWait = 30 * time.Second
 )
 
 // LogUpdate represents a pending update to a call log
@@ -34,14 +45,32 @@ type LogBatcher struct {
 	wg        sync.WaitGroup
 	mu        sync.Mutex
 	isRunning bool
+
+	finishedMu sync.RWMutex
+	onFinished map[string]func(ids []int64) // Called with the calls that just got a final status
+
+	config     func(key string) (string, error) // apicall_config lookup for the tuning keys (nil = defaults)
+	settingsMu sync.RWMutex
+	settings   batcherSettings
+	metrics    batcherMetrics
+
+	// Overflow journal: while journaling, Queue appends to the file instead of the channel
+	// (keeps the order) until the worker replays it
+	journalMu    sync.Mutex
+	journal      *os.File
+	journalPath  string
+	journaling   bool
+	stopped      bool
+	pendingSaved bool // Worker only: a batch was saved on shutdown, the rest go after it
 }
 
 // NewLogBatcher creates a new batcher
 func NewLogBatcher(db *sql.DB) *LogBatcher {
 	return &LogBatcher{
 		db:      db,
-		updates: make(chan LogUpdate, BufferSize),
-		done:    make(chan struct{}),
+		updates:  make(chan LogUpdate, maxBufferSize),
+		done:     make(chan struct{}),
+		settings: defaultBatcherSettings,
 	}
 }
 
@@ -70,57 +99,394 @@ func (b *LogBatcher) Stop() {
 	b.isRunning = false
 	b.mu.Unlock()
 
+	b.journalMu.Lock()
+	b.stopped = true
+	b.journalMu.Unlock()
+
+	// done aborts the retries: what can't be written now is saved to the journal
+	close(b.done)
 	close(b.updates)
 	b.wg.Wait()
+
+	b.journalMu.Lock()
+	if b.journal != nil {
+		b.journal.Close()
+		b.journal = nil
+	}
+	b.journalMu.Unlock()
 	log.Println("[LogBatcher] Worker stopped")
 }
 
-// Queue adds an update to the buffer
+// EnableJournal keeps the updates that don't fit in the buffer in an append-only file at path
+// instead of dropping them. The worker replays the file once the buffer drains, along with
+// whatever a previous run left behind (path.replay, path.pending).
+func (b *LogBatcher) EnableJournal(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := openJournal(path, 0)
+	if err != nil {
+		return err
+	}
+
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+	b.journal = f
+	b.journalPath = path
+	for _, p := range []string{path + ".replay", path + ".pending", path} {
+		if info, err := os.Stat(p); err == nil && info.Size() > 0 {
+			b.journaling = true
+		}
+	}
+	if b.journaling {
+		log.Printf("[LogBatcher] Journaled updates found in %s, they will be replayed", path)
+	}
+	return nil
+}
+
+func openJournal(path string, flag int) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|flag, 0644)
+}
+
+// encodeUpdates serializes the updates as JSON lines
+func encodeUpdates(updates ...LogUpdate) ([]byte, error) {
+	var buf []byte
+	for _, u := range updates {
+		line, err := json.Marshal(u)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	return buf, nil
+}
+
+// setFinishedHook registers (or removes, with fn = nil) the function called under name with
+// the calls that got a final status
+func (b *LogBatcher) setFinishedHook(name string, fn func(ids []int64)) {
+	b.finishedMu.Lock()
+	defer b.finishedMu.Unlock()
+	if fn == nil {
+		delete(b.onFinished, name)
+		return
+	}
+	if b.onFinished == nil {
+		b.onFinished = make(map[string]func(ids []int64))
+	}
+	b.onFinished[name] = fn
+}
+
+// callsFinished notifies the hooks, if any (they must not block)
+func (b *LogBatcher) callsFinished(ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	b.finishedMu.RLock()
+	defer b.finishedMu.RUnlock()
+	for _, fn := range b.onFinished {
+		fn(ids)
+	}
+}
+
+// Queue adds an update to the buffer. If the buffer is full (or the journal has pending
+// updates, so the order is kept) it goes to the journal; without a journal it is dropped.
 func (b *LogBatcher) Queue(update LogUpdate) {
-	select {
-	case b.updates <- update:
-	default:
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+
+	if !b.stopped && (!b.journaling || b.journal == nil) && len(b.updates) < b.currentSettings().bufferSize {
+		// Only Queue sends, under journalMu: the length can't grow between the check and the send
+		b.updates <- update
+		return
+	}
+	if b.journal == nil {
+		b.metrics.add(&b.metrics.dropped, 1)
 		// Drop update if buffer is full to prevent blocking
-		log.Printf("[LogBatcher] WARNING: Buffer full, dropping update for ID %d", update.ID)
+		if b.stopped {
+			log.Printf("[LogBatcher] WARNING: Batcher stopped, dropping update for ID %d", update.ID)
+		} else {
+			log.Printf("[LogBatcher] WARNING: Buffer full, dropping update for ID %d", update.ID)
+		}
+		return
 	}
+
+	data, err := encodeUpdates(update)
+	if err == nil {
+		_, err = b.journal.Write(data)
+	}
+	if err != nil {
+		b.metrics.add(&b.metrics.dropped, 1)
+		log.Printf("[LogBatcher] ERROR: Journal write failed, dropping update for ID %d: %v", update.ID, err)
+		return
+	}
+	b.metrics.add(&b.metrics.journaled, 1)
+	if !b.journaling {
+		log.Printf("[LogBatcher] WARNING: Buffer full, journaling updates to %s", b.journalPath)
+		b.journaling = true
+	}
+}
+
+func (b *LogBatcher) isJournaling() bool {
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+	return b.journaling
 }
 
 func (b *LogBatcher) worker() {
 	defer b.wg.Done()
 
-	buffer := make([]LogUpdate, 0, BatchSize)
-	ticker := time.NewTicker(FlushInterval)
+	settings := b.loadSettings()
+	buffer := make([]LogUpdate, 0, settings.batchSize)
+	ticker := time.NewTicker(settings.flushInterval)
 	defer ticker.Stop()
+	reload := time.NewTicker(settingsInterval)
+	defer reload.Stop()
 
 	for {
 		select {
+		case <-reload.C:
+			s := b.loadSettings()
+			if s.flushInterval != settings.flushInterval {
+				ticker.Reset(s.flushInterval)
+			}
+			settings = s
 		case update, ok := <-b.updates:
 			if !ok {
 				// Channel closed, flush remaining
 				if len(buffer) > 0 {
-					b.flush(buffer)
+					b.flushOrSave(buffer)
 				}
 				return
 			}
 			buffer = append(buffer, update)
-			if len(buffer) >= BatchSize {
-				b.flush(buffer)
+			if len(buffer) >= settings.batchSize {
+				b.flushOrSave(buffer)
 				buffer = buffer[:0]
 			}
 		case <-ticker.C:
 			if len(buffer) > 0 {
-				b.flush(buffer)
+				b.flushOrSave(buffer)
 				buffer = buffer[:0]
 			}
+			// Buffer drained: replay what overflowed to the journal
+			if len(b.updates) == 0 && b.isJournaling() {
+				b.replayJournal()
+			}
 		}
 	}
 }
 
-func (b *LogBatcher) flush(updates []LogUpdate) {
-	if len(updates) == 0 {
+// flushOrSave writes the batch, retrying while the database is unavailable. If the batcher
+// stops first, the batch is saved to path.pending to be replayed on the next start.
+func (b *LogBatcher) flushOrSave(updates []LogUpdate) {
+	if !b.pendingSaved && b.flushWithRetry(updates) {
+		return
+	}
+	b.savePending(updates)
+}
+
+// flushWithRetry retries transient errors (connection lost, deadlock, lock timeout) with
+// backoff. A batch the server rejects is written row by row so one bad update doesn't
+// take the rest with it. Returns false if the batcher stopped before the batch was written.
+func (b *LogBatcher) flushWithRetry(updates []LogUpdate) bool {
+	wait := retryMinWait
+	for {
+		err := b.flush(updates)
+		if err == nil {
+			return true
+		}
+		b.metrics.add(&b.metrics.flushErrors, 1)
+		if !isTransientError(err) {
+			if len(updates) == 1 {
+				b.metrics.add(&b.metrics.discarded, 1)
+				log.Printf("[LogBatcher] ERROR: Discarding update for ID %d: %v", updates[0].ID, err)
+				return true
+			}
+			log.Printf("[LogBatcher] ERROR flushing batch of %d items, writing them one by one: %v", len(updates), err)
+			for i := range updates {
+				if !b.flushWithRetry(updates[i : i+1]) {
+					return false
+				}
+			}
+			return true
+		}
+
+		log.Printf("[LogBatcher] ERROR flushing batch of %d items, retrying in %v: %v", len(updates), wait, err)
+		select {
+		case <-b.done:
+			return false
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > retryMaxWait {
+			wait = retryMaxWait
+		}
+	}
+}
+
+// isTransientError reports whether retrying the same batch can succeed: connection errors and
+// the MySQL errors for busy or restarting servers, lock timeouts, deadlocks and read-only failover
+func isTransientError(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1040, 1053, 1205, 1213, 1290:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// savePending appends updates that couldn't be written on shutdown to path.pending
+func (b *LogBatcher) savePending(updates []LogUpdate) {
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+	if b.journal == nil {
+		b.metrics.add(&b.metrics.dropped, len(updates))
+		log.Printf("[LogBatcher] ERROR: %d updates lost, no journal configured", len(updates))
 		return
 	}
 
+	path := b.journalPath + ".pending"
+	data, err := encodeUpdates(updates...)
+	if err == nil {
+		var f *os.File
+		if f, err = openJournal(path, 0); err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		b.metrics.add(&b.metrics.dropped, len(updates))
+		log.Printf("[LogBatcher] ERROR: %d updates lost, could not save them to %s: %v", len(updates), path, err)
+		return
+	}
+	b.pendingSaved = true
+	log.Printf("[LogBatcher] Saved %d pending updates to %s", len(updates), path)
+}
+
+// replayJournal applies the journaled updates in order: the rest of an interrupted replay,
+// those saved on the last shutdown and then the journal, which is rotated to path.replay so
+// new overflow keeps going to a fresh file. Journaling ends when the journal is empty.
+func (b *LogBatcher) replayJournal() {
+	for _, suffix := range []string{".replay", ".pending"} {
+		if !b.replayFile(b.journalPath + suffix) {
+			return
+		}
+	}
+
+	for {
+		b.journalMu.Lock()
+		if b.journal == nil {
+			b.journaling = false
+			b.journalMu.Unlock()
+			return
+		}
+		if info, err := b.journal.Stat(); err == nil && info.Size() == 0 {
+			b.journaling = false
+			b.journalMu.Unlock()
+			log.Println("[LogBatcher] Journal replayed, back to the buffer")
+			return
+		}
+		err := b.rotateJournal()
+		b.journalMu.Unlock()
+		if err != nil {
+			log.Printf("[LogBatcher] ERROR rotating journal %s: %v", b.journalPath, err)
+			return
+		}
+
+		if !b.replayFile(b.journalPath + ".replay") {
+			return
+		}
+	}
+}
+
+// rotateJournal moves the journal to path.replay and opens a new one (journalMu held)
+func (b *LogBatcher) rotateJournal() error {
+	b.journal.Close()
+	err := os.Rename(b.journalPath, b.journalPath+".replay")
+	flag := os.O_TRUNC
+	if err != nil {
+		flag = 0
+	}
+	f, ferr := openJournal(b.journalPath, flag)
+	b.journal = f
+	if ferr != nil {
+		b.journal = nil
+		return ferr
+	}
+	return err
+}
+
+// replayFile applies the updates of a journal file in batches and removes it. Returns false
+// if it couldn't finish (the file is kept and replayed again later).
+func (b *LogBatcher) replayFile(path string) bool {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		log.Printf("[LogBatcher] ERROR opening %s: %v", path, err)
+		return false
+	}
+	defer f.Close()
+
+	replay := func(batch []LogUpdate) bool {
+		select {
+		case <-b.done:
+			return false
+		default:
+		}
+		return b.flushWithRetry(batch)
+	}
+
+	batchSize := b.currentSettings().batchSize
+	scanner := bufio.NewScanner(f)
+	batch := make([]LogUpdate, 0, batchSize)
+	total := 0
+	for scanner.Scan() {
+		var u LogUpdate
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			// Truncated line if the process died mid-write
+			log.Printf("[LogBatcher] WARNING: Skipping invalid journal line in %s: %v", path, err)
+			continue
+		}
+		batch = append(batch, u)
+		if len(batch) >= batchSize {
+			if !replay(batch) {
+				return false
+			}
+			total += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("[LogBatcher] ERROR reading %s: %v", path, err)
+		return false
+	}
+	if len(batch) > 0 {
+		if !replay(batch) {
+			return false
+		}
+		total += len(batch)
+	}
+
+	f.Close()
+	if err := os.Remove(path); err != nil {
+		log.Printf("[LogBatcher] ERROR removing %s: %v", path, err)
+		return false
+	}
+	log.Printf("[LogBatcher] Replayed %d journaled updates from %s", total, path)
+	return true
+}
+
+func (b *LogBatcher) flush(updates []LogUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
 	start := time.Now()
 	
 	// Create temporary table for bulk update
@@ -208,17 +574,28 @@ func (b *LogBatcher) flush(updates []LogUpdate) {
     
     _, err := b.db.Exec(query)
     if err != nil {
-        log.Printf("[LogBatcher] ERROR flushing batch of %d items: %v", len(updates), err)
-        // In a real system, we might want to retry or dump to a fallback file
-    } else {
-        log.Printf("[LogBatcher] Flushed %d updates in %v", len(updates), time.Since(start))
-        // Sync campaign contacts based on updated call logs
-        b.syncCampaignContacts(ids)
+        return err
+    }
+
+    b.metrics.observe(len(updates), time.Since(start))
+    log.Printf("[LogBatcher] Flushed %d updates in %v", len(updates), time.Since(start))
+    // Sync campaign contacts based on updated call logs
+    b.syncCampaignContacts(ids)
+    // Estimate cost of finalized calls with the trunk rate table
+    b.rateCalls(ids)
+
+    finished := make([]int64, 0, len(updates))
+    for _, u := range updates {
+        if u.Status != "DIALING" && u.Status != "CONNECTED" {
+            finished = append(finished, u.ID)
+        }
     }
+    b.callsFinished(finished)
+    return nil
 }
 
 // syncCampaignContacts updates campaign contacts based on finalized call logs
-// It matches by telefono and proyecto_id to find the correct campaign contact
+// It matches by call_log.contact_id, so the same number in several campaigns is not mixed up
 func (b *LogBatcher) syncCampaignContacts(logIDs []string) {
 	if len(logIDs) == 0 {
 		return
@@ -232,8 +609,7 @@ func (b *LogBatcher) syncCampaignContacts(logIDs []string) {
 	// - Others stay as is (dialing contacts without matching final status)
 	query := `
 		UPDATE apicall_campaign_contacts cc
-		INNER JOIN apicall_call_log cl ON cc.telefono = cl.telefono
-		INNER JOIN apicall_campaigns c ON cc.campaign_id = c.id AND c.proyecto_id = cl.proyecto_id
+		INNER JOIN apicall_call_log cl ON cl.contact_id = cc.id
 		SET 
 			cc.estado = CASE 
 				WHEN cl.status IN ('ANSWERED', 'ANSWER', 'AMD_HUMAN', 'COMPLETED') THEN 'completed'
@@ -259,3 +635,32 @@ func (b *LogBatcher) syncCampaignContacts(logIDs []string) {
 	}
 }
 
+// billedSeconds rounds duracion up with the trunk billing increments (e.g. 60/60, 30/6, 1/1):
+// the first incremento_inicial seconds are always billed, then blocks of incremento
+const billedSeconds = `CASE
+		WHEN cl.duracion <= 0 THEN 0
+		WHEN cl.duracion <= t.incremento_inicial THEN t.incremento_inicial
+		ELSE t.incremento_inicial + CEIL((cl.duracion - t.incremento_inicial) / GREATEST(t.incremento, 1)) * GREATEST(t.incremento, 1)
+	END`
+
+// rateCalls stores billed seconds and estimated cost of finalized call logs.
+// The rate in effect when the call ends is frozen in the log, so later rate changes
+// don't alter past costs.
+func (b *LogBatcher) rateCalls(logIDs []string) {
+	if len(logIDs) == 0 {
+		return
+	}
+
+	query := `
+		UPDATE apicall_call_log cl
+		INNER JOIN apicall_troncales t ON t.nombre = cl.troncal
+		SET cl.segundos_facturados = ` + billedSeconds + `,
+		    cl.costo = ` + billedSeconds + ` * t.costo_minuto / 60
+		WHERE cl.id IN (` + strings.Join(logIDs, ",") + `)
+		  AND COALESCE(cl.disposition, '') <> ''
+	`
+
+	if _, err := b.db.Exec(query); err != nil {
+		log.Printf("[LogBatcher] ERROR rating calls: %v", err)
+	}
+}
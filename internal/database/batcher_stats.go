@@ -0,0 +1,171 @@
+package database
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Tuning keys read from apicall_config (reloaded every settingsInterval without restarting)
+const (
+	settingBatchSize     = "batcher_batch_size"
+	settingFlushInterval = "batcher_flush_interval_ms"
+	settingBufferSize    = "batcher_buffer_size"
+
+	settingsInterval = 10 * time.Second
+
+	maxBatchSize     = 10000
+	maxBufferSize    = 50000 // Channel capacity: batcher_buffer_size is a soft limit below it
+	minFlushInterval = 50 * time.Millisecond
+	maxFlushInterval = 10 * time.Second
+)
+
+// BatcherStats summarizes the log batcher activity
+type BatcherStats struct {
+	QueueDepth      int   `json:"queue_depth"`
+	BufferSize      int   `json:"buffer_size"`
+	BatchSize       int   `json:"batch_size"`
+	FlushIntervalMs int64 `json:"flush_interval_ms"`
+	Journaling      bool  `json:"journaling"`
+	Flushes         int64 `json:"flushes"`
+	Rows            int64 `json:"rows"`
+	AvgRowsPerFlush int64 `json:"avg_rows_per_flush"`
+	LastFlushMs     int64 `json:"last_flush_ms"`
+	AvgFlushMs      int64 `json:"avg_flush_ms"`
+	MaxFlushMs      int64 `json:"max_flush_ms"`
+	FlushErrors     int64 `json:"flush_errors"` // Failed attempts (retried)
+	Discarded       int64 `json:"discarded"`    // Updates rejected by the server
+	Journaled       int64 `json:"journaled"`    // Updates sent to the journal because the buffer was full
+	Dropped         int64 `json:"dropped"`      // Updates lost: buffer full without journal, or journal write failed
+}
+
+// batcherSettings are the flush parameters in effect
+type batcherSettings struct {
+	batchSize     int
+	bufferSize    int
+	flushInterval time.Duration
+}
+
+var defaultBatcherSettings = batcherSettings{
+	batchSize:     BatchSize,
+	bufferSize:    BufferSize,
+	flushInterval: FlushInterval,
+}
+
+// batcherMetrics accumulates flush counters
+type batcherMetrics struct {
+	mu          sync.Mutex
+	flushes     int64
+	rows        int64
+	sum         time.Duration
+	last        time.Duration
+	max         time.Duration
+	flushErrors int64
+	discarded   int64
+	journaled   int64
+	dropped     int64
+}
+
+// observe records a successful flush
+func (m *batcherMetrics) observe(rows int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushes++
+	m.rows += int64(rows)
+	m.sum += d
+	m.last = d
+	if d > m.max {
+		m.max = d
+	}
+}
+
+func (m *batcherMetrics) add(counter *int64, n int) {
+	m.mu.Lock()
+	*counter += int64(n)
+	m.mu.Unlock()
+}
+
+// Stats returns the batcher metrics and the settings in effect
+func (b *LogBatcher) Stats() BatcherStats {
+	s := b.currentSettings()
+
+	b.journalMu.Lock()
+	st := BatcherStats{
+		QueueDepth:      len(b.updates),
+		BufferSize:      s.bufferSize,
+		BatchSize:       s.batchSize,
+		FlushIntervalMs: s.flushInterval.Milliseconds(),
+		Journaling:      b.journaling,
+	}
+	b.journalMu.Unlock()
+
+	m := &b.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st.Flushes = m.flushes
+	st.Rows = m.rows
+	st.LastFlushMs = m.last.Milliseconds()
+	st.MaxFlushMs = m.max.Milliseconds()
+	st.FlushErrors = m.flushErrors
+	st.Discarded = m.discarded
+	st.Journaled = m.journaled
+	st.Dropped = m.dropped
+	if m.flushes > 0 {
+		st.AvgRowsPerFlush = m.rows / m.flushes
+		st.AvgFlushMs = (m.sum / time.Duration(m.flushes)).Milliseconds()
+	}
+	return st
+}
+
+func (b *LogBatcher) currentSettings() batcherSettings {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings
+}
+
+// loadSettings reads the tuning keys (invalid or missing values keep the defaults) and
+// returns the settings in effect
+func (b *LogBatcher) loadSettings() batcherSettings {
+	if b.config == nil {
+		return b.currentSettings()
+	}
+
+	s := defaultBatcherSettings
+	if v := b.setting(settingBatchSize, 1, maxBatchSize); v > 0 {
+		s.batchSize = v
+	}
+	if v := b.setting(settingBufferSize, 1, maxBufferSize); v > 0 {
+		s.bufferSize = v
+	}
+	if v := b.setting(settingFlushInterval, int(minFlushInterval.Milliseconds()), int(maxFlushInterval.Milliseconds())); v > 0 {
+		s.flushInterval = time.Duration(v) * time.Millisecond
+	}
+
+	b.settingsMu.Lock()
+	defer b.settingsMu.Unlock()
+	if s != b.settings {
+		log.Printf("[LogBatcher] Settings: batch_size=%d buffer_size=%d flush_interval=%v", s.batchSize, s.bufferSize, s.flushInterval)
+		b.settings = s
+	}
+	return s
+}
+
+// setting reads an integer key clamped to [lo, hi]; 0 if not set or invalid
+func (b *LogBatcher) setting(key string, lo, hi int) int {
+	val, err := b.config(key)
+	if err != nil || val == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(val)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
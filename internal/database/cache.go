@@ -0,0 +1,67 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// CacheTTL es la vigencia de las lecturas en caché (proyectos, configuración y blacklist).
+	// Las escrituras hechas por este proceso invalidan la entrada al instante; las de otras
+	// instancias se ven como mucho tras CacheTTL.
+	CacheTTL = 30 * time.Second
+	// blacklistCacheMax es el máximo de números de un proyecto que se guardan en memoria;
+	// con blacklists más grandes IsBlacklisted consulta la BD en cada llamada
+	blacklistCacheMax = 200000
+)
+
+type cacheEntry[V any] struct {
+	value    V
+	loadedAt time.Time
+}
+
+// ttlMap es un mapa con vencimiento por entrada (el valor cero está listo para usarse)
+type ttlMap[K comparable, V any] struct {
+	mu      sync.RWMutex
+	entries map[K]cacheEntry[V]
+}
+
+func (m *ttlMap[K, V]) get(key K) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[key]
+	if !ok || time.Since(e.loadedAt) >= CacheTTL {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (m *ttlMap[K, V]) set(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[K]cacheEntry[V])
+	}
+	m.entries[key] = cacheEntry[V]{value: value, loadedAt: time.Now()}
+}
+
+func (m *ttlMap[K, V]) delete(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *ttlMap[K, V]) clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.entries)
+}
+
+// lookupCache guarda las lecturas que se repiten en cada llamada y en cada ciclo del Sweeper.
+// La comparten todas las vistas ForTenant del repositorio.
+type lookupCache struct {
+	proyectos  ttlMap[int, Proyecto]
+	configs    ttlMap[string, string]
+	blacklists ttlMap[int, map[string]struct{}] // nil = demasiado grande, se consulta la BD
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxEventDetail is the size of apicall_call_events.detalle
+const maxEventDetail = 255
+
+// EventBatcher buffers call timeline events and inserts them in bulk
+type EventBatcher struct {
+	db        *sql.DB
+	events    chan CallEvent
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	isRunning bool
+}
+
+// NewEventBatcher creates a new event batcher
+func NewEventBatcher(db *sql.DB) *EventBatcher {
+	return &EventBatcher{
+		db:     db,
+		events: make(chan CallEvent, BufferSize),
+	}
+}
+
+// Start initiates the background worker
+func (b *EventBatcher) Start() {
+	b.mu.Lock()
+	if b.isRunning {
+		b.mu.Unlock()
+		return
+	}
+	b.isRunning = true
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go b.worker()
+	log.Println("[EventBatcher] Worker started")
+}
+
+// Stop flushes remaining events and stops the worker
+func (b *EventBatcher) Stop() {
+	b.mu.Lock()
+	if !b.isRunning {
+		b.mu.Unlock()
+		return
+	}
+	b.isRunning = false
+	b.mu.Unlock()
+
+	close(b.events)
+	b.wg.Wait()
+	log.Println("[EventBatcher] Worker stopped")
+}
+
+// Queue adds an event to the buffer; events are dropped rather than blocking the call flow
+func (b *EventBatcher) Queue(event CallEvent) {
+	select {
+	case b.events <- event:
+	default:
+		log.Printf("[EventBatcher] WARNING: Buffer full, dropping %s event for log %d", event.Evento, event.LogID)
+	}
+}
+
+func (b *EventBatcher) worker() {
+	defer b.wg.Done()
+
+	buffer := make([]CallEvent, 0, BatchSize)
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-b.events:
+			if !ok {
+				if len(buffer) > 0 {
+					b.flush(buffer)
+				}
+				return
+			}
+			buffer = append(buffer, event)
+			if len(buffer) >= BatchSize {
+				b.flush(buffer)
+				buffer = buffer[:0]
+			}
+		case <-ticker.C:
+			if len(buffer) > 0 {
+				b.flush(buffer)
+				buffer = buffer[:0]
+			}
+		}
+	}
+}
+
+func (b *EventBatcher) flush(events []CallEvent) {
+	placeholders := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*4)
+	for i, e := range events {
+		placeholders[i] = "(?, ?, ?, ?)"
+		args = append(args, e.LogID, e.Evento, truncateDetail(e.Detalle), e.CreatedAt)
+	}
+
+	query := "INSERT INTO apicall_call_events (log_id, evento, detalle, created_at) VALUES " + strings.Join(placeholders, ", ")
+	if _, err := b.db.Exec(query, args...); err != nil {
+		log.Printf("[EventBatcher] Error inserting %d events: %v", len(events), err)
+	}
+}
+
+// truncateDetail cuts the detail to the column size without splitting a UTF-8 rune
+func truncateDetail(s string) string {
+	return truncateUTF8(s, maxEventDetail)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a UTF-8 rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
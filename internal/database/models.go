@@ -2,69 +2,217 @@ package database
 
 import "time"
 
+// DefaultTenantID es la organización a la que pertenecen los datos previos al modelo multi-tenant
+const DefaultTenantID = 1
+
+// Modos de transferencia del proyecto
+const (
+	TransferBlind     = "blind"     // Variables de canal para el Dial del dialplan (comportamiento original)
+	TransferQueue     = "queue"     // Queue() de Asterisk
+	TransferRingGroup = "ringgroup" // Dial() simultáneo a varios endpoints
+)
+
+// Tipos de regla de blacklist automática
+const (
+	RuleDisposition = "disposition" // Disposition de la llamada (ej: NI)
+	RuleDTMF        = "dtmf"        // Dígito marcado en el IVR (ej: 9 = baja)
+)
+
+// Eventos del timeline de una llamada (apicall_call_events)
+const (
+	CallEventQueued     = "queued"     // Entró en la cola del spool
+	CallEventOriginated = "originated" // Se originó por una troncal
+	CallEventAnswered   = "answered"   // El destino contestó (inicio de la sesión AGI)
+	CallEventAMD        = "amd"        // Resultado de la detección de contestador
+	CallEventAudio      = "audio"      // Audio reproducido
+	CallEventDTMF       = "dtmf"       // Dígito marcado en el IVR
+	CallEventTransfer   = "transfer"   // Transferencia al agente / desborde y su resultado
+	CallEventHangup     = "hangup"     // Cuelgue y causa
+)
+
+// Tenant representa una organización (cliente) del servicio
+type Tenant struct {
+	ID        int       `db:"id" json:"id"`
+	Nombre    string    `db:"nombre" json:"nombre"`
+	Slug      string    `db:"slug" json:"slug"`
+	Activo    bool      `db:"activo" json:"activo"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
 // Proyecto representa una campaña configurada
 type Proyecto struct {
-	ID             int       `db:"id" json:"id"`
-	Nombre         string    `db:"nombre" json:"nombre"`
-	CallerID       string    `db:"caller_id" json:"caller_id"`
-	Audio          string    `db:"audio" json:"audio"`
-	DTMFEsperado   string    `db:"dtmf_esperado" json:"dtmf_esperado"`
-	NumeroDesborde string    `db:"numero_desborde" json:"numero_desborde"`
-	TroncalSalida  string    `db:"troncal_salida" json:"troncal_salida"`
-	PrefijoSalida  string    `db:"prefijo_salida" json:"prefijo_salida"`
-	IPsAutorizadas string    `db:"ips_autorizadas" json:"ips_autorizadas"`
-	MaxRetries     int       `db:"max_retries" json:"max_retries"`
-	RetryTime      int       `db:"retry_time" json:"retry_time"`
-	AMDActive      bool      `db:"amd_active" json:"amd_active"`
-	SmartCIDActive bool      `db:"smart_cid_active" json:"smart_cid_active"`
-	Timezone       string    `db:"timezone" json:"timezone"`
-	CreatedAt      time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+	ID                 int       `db:"id" json:"id"`
+	Nombre             string    `db:"nombre" json:"nombre"`
+	CallerID           string    `db:"caller_id" json:"caller_id"`
+	Audio              string    `db:"audio" json:"audio"`
+	DTMFEsperado       string    `db:"dtmf_esperado" json:"dtmf_esperado"`
+	NumeroDesborde     string    `db:"numero_desborde" json:"numero_desborde"`
+	TroncalSalida      string    `db:"troncal_salida" json:"troncal_salida"`
+	PrefijoSalida      string    `db:"prefijo_salida" json:"prefijo_salida"`
+	IPsAutorizadas     string    `db:"ips_autorizadas" json:"ips_autorizadas"`
+	MaxRetries         int       `db:"max_retries" json:"max_retries"`
+	RetryTime          int       `db:"retry_time" json:"retry_time"`
+	AMDActive          bool      `db:"amd_active" json:"amd_active"`
+	SmartCIDActive     bool      `db:"smart_cid_active" json:"smart_cid_active"`
+	Timezone           string    `db:"timezone" json:"timezone"`
+	NoRepeatMinutes    int       `db:"no_repeat_minutes" json:"no_repeat_minutes"`             // 0 = sin restricción
+	Pais               string    `db:"pais" json:"pais"`                                       // ISO 3166-1 alpha-2 para normalizar números (vacío = sin normalizar)
+	CaptureDigits      int       `db:"capture_digits" json:"capture_digits"`                   // Máximo de dígitos a capturar (0 = desactivado)
+	CaptureAudio       string    `db:"capture_audio" json:"capture_audio"`                     // Audio que solicita los dígitos
+	CaptureTimeout     int       `db:"capture_timeout" json:"capture_timeout"`                 // Timeout entre dígitos (segundos)
+	TransferMode       string    `db:"transfer_mode" json:"transfer_mode"`                     // blind, queue, ringgroup
+	TransferTarget     string    `db:"transfer_target" json:"transfer_target"`                 // Cola o endpoints del grupo
+	TransferTimeout    int       `db:"transfer_timeout" json:"transfer_timeout"`               // Segundos esperando un agente
+	TransferFailAudio  string    `db:"transfer_fail_audio" json:"transfer_fail_audio"`         // Audio si ningún agente atiende
+	CallbackDTMF       string    `db:"callback_dtmf" json:"callback_dtmf"`                     // Dígito que solicita rellamada (vacío = desactivado)
+	CallbackAudio      string    `db:"callback_audio" json:"callback_audio"`                   // Audio que pide la hora preferida (opcional)
+	CallbackDelay      int       `db:"callback_delay" json:"callback_delay"`                   // Minutos hasta la rellamada si no se indica hora
+	CallbackWindow     int       `db:"callback_window" json:"callback_window"`                 // Duración de la ventana de rellamada (minutos)
+	DialEngine         string    `db:"dial_engine" json:"dial_engine"`                         // spool, ami o vacío (automático según el origen)
+	RingTimeout        int       `db:"ring_timeout" json:"ring_timeout"`                       // Segundos de timbrado (0 = 45)
+	RetentionDays      int       `db:"retention_days" json:"retention_days"`                   // Días a conservar logs, contactos y grabaciones (0 = sin límite)
+	SurveyID           int       `db:"survey_id" json:"survey_id"`                             // Encuesta tras el audio principal (0 = flujo DTMF)
+	MaxCallsDay        int       `db:"max_calls_day" json:"max_calls_day"`                     // Cuota diaria de llamadas (0 = sin límite)
+	MaxConcurrent      int       `db:"max_concurrent" json:"max_concurrent"`                   // Llamadas simultáneas (0 = sin límite)
+	TrunkStrategy      string    `db:"trunk_strategy" json:"trunk_strategy"`                   // Balanceo entre troncales: random, weighted, least_used o asr
+	PrefijosPermitidos string    `db:"prefijos_permitidos" json:"prefijos_permitidos"`         // Prefijos de destino permitidos separados por coma (vacío = todos)
+	PrefijosBloqueados string    `db:"prefijos_bloqueados" json:"prefijos_bloqueados"`         // Prefijos de destino que no se marcan
+	Locale             string    `db:"locale" json:"locale"`                                   // Idioma de los prompts de sistema del IVR (es, en)
+	MaxNumberAttempts  int       `db:"max_number_attempts_day" json:"max_number_attempts_day"` // Intentos por número y día en todos los proyectos (0 = solo el global)
+	HorarioLocal       string    `db:"horario_local" json:"horario_local"`                     // Horario local del destino según su prefijo, "HH:MM:SS-HH:MM:SS" (vacío = sin restricción)
+	TenantID           int       `db:"tenant_id" json:"tenant_id"`
+	CreatedAt          time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time `db:"updated_at" json:"updated_at"`
 }
 
 // Troncal representa una troncal SIP
 type Troncal struct {
-	ID       int    `db:"id" json:"id"`
-	Nombre   string `db:"nombre" json:"nombre"`
-	Host     string `db:"host" json:"host"`
-	Puerto   int    `db:"puerto" json:"puerto"`
-	Usuario  string `db:"usuario" json:"usuario"`
-	Password string `db:"password" json:"password"`
-	Contexto string `db:"contexto" json:"contexto"`
-	CallerID string `db:"caller_id" json:"caller_id"`
-	Activo   bool   `db:"activo" json:"activo"`
+	ID                int     `db:"id" json:"id"`
+	Nombre            string  `db:"nombre" json:"nombre"`
+	Host              string  `db:"host" json:"host"`
+	Puerto            int     `db:"puerto" json:"puerto"`
+	Usuario           string  `db:"usuario" json:"usuario"`
+	Password          string  `db:"password" json:"password"`
+	Contexto          string  `db:"contexto" json:"contexto"`
+	CallerID          string  `db:"caller_id" json:"caller_id"`
+	Activo            bool    `db:"activo" json:"activo"`
+	TenantID          int     `db:"tenant_id" json:"tenant_id"`
+	CostoMinuto       float64 `db:"costo_minuto" json:"costo_minuto"`             // Tarifa por minuto del carrier
+	IncrementoInicial int     `db:"incremento_inicial" json:"incremento_inicial"` // Segundos mínimos facturados
+	Incremento        int     `db:"incremento" json:"incremento"`                 // Incremento de facturación (ej: 60/60, 30/6, 1/1)
+	Capacidad         int     `db:"capacidad" json:"capacidad"`                   // Canales contratados (peso en trunk_strategy=weighted; 0 = límite por troncal del pool)
+	PAI               bool    `db:"pai" json:"pai"`                               // Envía P-Asserted-Identity con el Caller ID de la llamada
+	SIPHeaders        string  `db:"sip_headers" json:"sip_headers"`               // Headers SIP adicionales, uno por línea "Nombre: valor"
+	Attestation       string  `db:"attestation" json:"attestation"`               // Atestación STIR/SHAKEN del carrier: A, B, C o vacío
 }
 
 // CallLog representa el registro de una llamada
 type CallLog struct {
-	ID           int64     `db:"id" json:"id"`
-	ProyectoID   int       `db:"proyecto_id" json:"proyecto_id"`
-	CampaignID   *int      `db:"campaign_id" json:"campaign_id,omitempty"` // Pointer to allow NULL in JSON/DB
-	Telefono     string    `db:"telefono" json:"telefono"`
-	DTMFMarcado  string    `db:"dtmf_marcado" json:"dtmf_marcado"`
-	Interacciono bool      `db:"interacciono" json:"interacciono"`
-	Status       string    `db:"status" json:"status"`
-	Disposition  string    `db:"disposition" json:"disposition"`
-	Duracion     int       `db:"duracion" json:"duracion"`
-	Uniqueid     string    `db:"uniqueid" json:"uniqueid"`
-	CallerIDUsed string    `db:"caller_id_used" json:"caller_id_used"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	ID             int64     `db:"id" json:"id"`
+	ProyectoID     int       `db:"proyecto_id" json:"proyecto_id"`
+	CampaignID     *int      `db:"campaign_id" json:"campaign_id,omitempty"` // Pointer to allow NULL in JSON/DB
+	ContactID      *int64    `db:"contact_id" json:"contact_id,omitempty"`   // Contacto de campaña que originó la llamada
+	Telefono       string    `db:"telefono" json:"telefono"`
+	DTMFMarcado    string    `db:"dtmf_marcado" json:"dtmf_marcado"`
+	Interacciono   bool      `db:"interacciono" json:"interacciono"`
+	Status         string    `db:"status" json:"status"`
+	Disposition    string    `db:"disposition" json:"disposition"`
+	Duracion       int       `db:"duracion" json:"duracion"`
+	Uniqueid       string    `db:"uniqueid" json:"uniqueid"`
+	CallerIDUsed   string    `db:"caller_id_used" json:"caller_id_used"`
+	Variables      *string   `db:"variables" json:"variables,omitempty"`             // JSON con variables del integrador
+	ExternalRef    *string   `db:"external_ref" json:"external_ref,omitempty"`       // Idempotency-Key / referencia del integrador
+	DTMFCapturado  *string   `db:"dtmf_capturado" json:"dtmf_capturado,omitempty"`   // Dígitos capturados con GET DATA
+	TransferResult *string   `db:"transfer_result" json:"transfer_result,omitempty"` // AGENT_ANSWERED, ABANDONED_IN_QUEUE, NO_AGENT
+	TransferStatus *string   `db:"transfer_status" json:"transfer_status,omitempty"` // QUEUESTATUS / DIALSTATUS
+	CallbackOf     *int64    `db:"callback_of" json:"callback_of,omitempty"`         // Log original que pidió esta rellamada
+	AbandonStep    *string   `db:"abandon_step" json:"abandon_step,omitempty"`       // Paso del IVR en el que colgó el destino
+	AbandonAudio   *string   `db:"abandon_audio" json:"abandon_audio,omitempty"`     // Audio en reproducción al colgar
+	AbandonSeconds *int      `db:"abandon_seconds" json:"abandon_seconds,omitempty"` // Segundos dentro del paso
+	Troncal        string    `db:"troncal" json:"troncal"`                           // Troncal por la que salió la llamada
+	Costo          *float64  `db:"costo" json:"costo,omitempty"`                     // Costo estimado según la tarifa de la troncal
+	HangupCause    *int      `db:"hangup_cause" json:"hangup_cause,omitempty"`       // Cause Q.850 del cuelgue (Asterisk)
+	HangupCauseTxt *string   `db:"hangup_cause_txt" json:"hangup_cause_txt,omitempty"`
+	SIPCode        *int      `db:"sip_code" json:"sip_code,omitempty"` // Respuesta SIP final de la troncal
+	SIPReason      *string   `db:"sip_reason" json:"sip_reason,omitempty"`
+	Attestation    *string   `db:"attestation" json:"attestation,omitempty"`                     // Atestación STIR/SHAKEN de la troncal al marcar
+	RingSeconds    *int      `db:"segundos_timbrado" json:"segundos_timbrado,omitempty"`         // Del originate a la respuesta (o al cuelgue)
+	TalkSeconds    *int      `db:"segundos_conversacion" json:"segundos_conversacion,omitempty"` // De la respuesta al cuelgue
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+// CallEvent es un evento del timeline de una llamada
+type CallEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	LogID     int64     `db:"log_id" json:"log_id"`
+	Evento    string    `db:"evento" json:"evento"`
+	Detalle   string    `db:"detalle" json:"detalle"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
 
 // Campaign representa una campaña masiva de llamadas
 type Campaign struct {
-	ID                 int       `db:"id" json:"id"`
-	Nombre             string    `db:"nombre" json:"nombre"`
-	ProyectoID         int       `db:"proyecto_id" json:"proyecto_id"`
-	Estado             string    `db:"estado" json:"estado"` // draft, active, paused, completed, stopped
-	TotalContactos     int       `db:"total_contactos" json:"total_contactos"`
-	ContactosProcesados int     `db:"contactos_procesados" json:"contactos_procesados"`
-	ContactosExitosos  int     `db:"contactos_exitosos" json:"contactos_exitosos"`
-	ContactosFallidos  int     `db:"contactos_fallidos" json:"contactos_fallidos"`
-	FechaInicio        *time.Time `db:"fecha_inicio" json:"fecha_inicio"`
-	FechaFin           *time.Time `db:"fecha_fin" json:"fecha_fin"`
-	CreatedAt          time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt          time.Time `db:"updated_at" json:"updated_at"`
+	ID                  int        `db:"id" json:"id"`
+	Nombre              string     `db:"nombre" json:"nombre"`
+	ProyectoID          int        `db:"proyecto_id" json:"proyecto_id"`
+	Estado              string     `db:"estado" json:"estado"` // draft, active, paused, completed, stopped
+	TotalContactos      int        `db:"total_contactos" json:"total_contactos"`
+	ContactosProcesados int        `db:"contactos_procesados" json:"contactos_procesados"`
+	ContactosExitosos   int        `db:"contactos_exitosos" json:"contactos_exitosos"`
+	ContactosFallidos   int        `db:"contactos_fallidos" json:"contactos_fallidos"`
+	FechaInicio         *time.Time `db:"fecha_inicio" json:"fecha_inicio"`
+	FechaFin            *time.Time `db:"fecha_fin" json:"fecha_fin"`
+	ResultURL           string     `db:"result_url" json:"result_url"`                 // Webhook: se envía el resultado de cada contacto
+	RingTimeout         int        `db:"ring_timeout" json:"ring_timeout"`             // Override del timbrado del proyecto (0 = sin override)
+	Prioridad           int        `db:"prioridad" json:"prioridad"`                   // Peso en el reparto de canales entre campañas activas (1-100)
+	Troncales           string     `db:"troncales" json:"troncales"`                   // Override de troncales "nombre[:peso],..." (vacío = las del proyecto)
+	ExitMinASR          float64    `db:"exit_min_asr" json:"exit_min_asr"`             // Reglas de salida: % mínimo de contestadas (0 = desactivada)
+	ExitASRWindow       int        `db:"exit_asr_window" json:"exit_asr_window"`       // Últimas N llamadas evaluadas (0 = 500)
+	ExitDailyMinutes    int        `db:"exit_daily_minutes" json:"exit_daily_minutes"` // Minutos hablados por día (0 = sin límite)
+	ExitMaxConnects     int        `db:"exit_max_connects" json:"exit_max_connects"`   // Conexiones totales (0 = sin límite)
+	ExitDispositions    string     `db:"exit_dispositions" json:"exit_dispositions"`   // Dispositions que cuentan como conexión (vacío = contestadas por humano)
+	ExitMaxAbandon      float64    `db:"exit_max_abandon" json:"exit_max_abandon"`     // % máximo de abandono: contestadas por humano sin agente (0 = desactivada)
+	ExitAbandonHours    int        `db:"exit_abandon_hours" json:"exit_abandon_hours"` // Ventana deslizante del abandono en horas (0 = 24)
+	ExitReason          string     `db:"exit_reason" json:"exit_reason"`               // Regla que la pausó (solo lectura)
+	SummaryEmails       string     `db:"summary_emails" json:"summary_emails"`         // Destinatarios del resumen final, separados por coma
+	MaxCPS              int        `db:"max_cps" json:"max_cps"`                       // CPS objetivo de la campaña (0 = sin tope propio)
+	RampMinutes         int        `db:"ramp_minutes" json:"ramp_minutes"`             // Warm-up: minutos hasta llegar al CPS objetivo (0 = sin rampa)
+	RampStartCPS        int        `db:"ramp_start_cps" json:"ramp_start_cps"`         // CPS inicial de la rampa (0 = 1)
+	RampStartedAt       *time.Time `db:"ramp_started_at" json:"ramp_started_at"`       // Inicio de la rampa en curso (solo lectura)
+	StartAt             *time.Time `db:"start_at" json:"start_at"`                     // Inicio automático (nil = solo manual)
+	EndAt               *time.Time `db:"end_at" json:"end_at"`                         // Fin automático: pasa a completed (nil = sin fin programado)
+	RecurDays           string     `db:"recur_days" json:"recur_days"`                 // Recurrencia: días 0=Domingo..6=Sábado, ej: "1" o "1,4" (vacío = no recurrente)
+	RecurTime           string     `db:"recur_time" json:"recur_time"`                 // Hora HH:MM de la recurrencia (zona horaria del proyecto)
+	RecurMode           string     `db:"recur_mode" json:"recur_mode"`                 // reset (misma campaña) o clone (campaña nueva)
+	RecurEstados        string     `db:"recur_estados" json:"recur_estados"`           // Estados de contacto que se vuelven a marcar (vacío = pending,failed)
+	RecurDispositions   string     `db:"recur_dispositions" json:"recur_dispositions"` // Filtro opcional por resultado (ej: NA,BUSY)
+	RecurMax            int        `db:"recur_max" json:"recur_max"`                   // Recurrencias máximas (0 = sin límite)
+	RecurCount          int        `db:"recur_count" json:"recur_count"`               // Recurrencias aplicadas (solo lectura)
+	RecurLastAt         *time.Time `db:"recur_last_at" json:"recur_last_at"`           // Última recurrencia aplicada (solo lectura)
+	TenantID            int        `db:"tenant_id" json:"tenant_id"`
+	CreatedAt           time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt           time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// CampaignSummary es el resumen final de una campaña, generado al pasar a completed
+type CampaignSummary struct {
+	CampaignID     int            `json:"campaign_id"`
+	Nombre         string         `json:"nombre"`
+	ProyectoID     int            `json:"proyecto_id"`
+	FechaInicio    *time.Time     `json:"fecha_inicio"`
+	FechaFin       *time.Time     `json:"fecha_fin"`
+	Contactos      map[string]int `json:"contactos"` // Contactos por estado (completed, failed, skipped...)
+	Llamadas       int            `json:"llamadas"`
+	Dispositions   map[string]int `json:"dispositions"`
+	Answered       int            `json:"answered"`
+	Contacted      int            `json:"contacted"`       // Contestadas por humano
+	Converted      int            `json:"converted"`       // Contactadas que marcaron DTMF
+	ConnectRate    float64        `json:"connect_rate"`    // Contactadas / llamadas
+	DTMFConversion float64        `json:"dtmf_conversion"` // Convertidas / contactadas
+	AvgDuration    float64        `json:"avg_duration"`    // Segundos por llamada contestada
+	Minutos        float64        `json:"minutos"`         // Minutos facturados (llamadas tarifadas)
+	Costo          float64        `json:"costo"`           // Costo estimado según las tarifas de las troncales
+	GeneratedAt    time.Time      `json:"generated_at"`
 }
 
 // CampaignContact representa un contacto (número) dentro de una campaña
@@ -73,10 +221,14 @@ type CampaignContact struct {
 	CampaignID      int       `db:"campaign_id" json:"campaign_id"`
 	Telefono        string    `db:"telefono" json:"telefono"`
 	DatosAdicionales *string  `db:"datos_adicionales" json:"datos_adicionales"` // JSON string
-	Estado          string    `db:"estado" json:"estado"` // pending, dialing, completed, failed, skipped
+	Estado          string    `db:"estado" json:"estado"` // pending, dialing, completed, failed, skipped, excluded
 	Intentos        int       `db:"intentos" json:"intentos"`
 	UltimoIntento   *time.Time `db:"ultimo_intento" json:"ultimo_intento"`
 	Resultado       *string   `db:"resultado" json:"resultado"`
+	VentanaInicio   *string   `db:"ventana_inicio" json:"ventana_inicio,omitempty"` // Franja preferida "HH:MM:SS" (nil = sin franja)
+	VentanaFin      *string   `db:"ventana_fin" json:"ventana_fin,omitempty"`       // Fin exclusivo; menor que el inicio = cruza la medianoche
+	VentanaTZ       *string   `db:"ventana_tz" json:"ventana_tz,omitempty"`         // Zona IANA de la franja (nil = la del proyecto)
+	ZonaLocal       *string   `db:"zona_local" json:"zona_local,omitempty"`         // Zona del prefijo del número ("" = la del proyecto, nil = sin asignar)
 	CreatedAt       time.Time `db:"created_at" json:"created_at"`
 }
 
@@ -91,6 +243,25 @@ type CampaignSchedule struct {
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 }
 
+// Holiday es un feriado en el que las campañas no marcan, de un proyecto o de toda la organización
+type Holiday struct {
+	ID         int       `db:"id" json:"id"`
+	TenantID   int       `db:"tenant_id" json:"tenant_id"`
+	ProyectoID int       `db:"proyecto_id" json:"proyecto_id"` // 0 = todos los proyectos de la organización
+	Fecha      string    `db:"fecha" json:"fecha"`             // YYYY-MM-DD
+	Nombre     string    `db:"nombre" json:"nombre"`
+	Anual      bool      `db:"anual" json:"anual"` // Se repite cada año el mismo día y mes
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// PrefixTimezone asigna una zona horaria a los números que empiezan por un prefijo (gana el más largo)
+type PrefixTimezone struct {
+	Prefijo     string    `db:"prefijo" json:"prefijo"`   // E.164 sin + (ej: 52664 = Tijuana)
+	Timezone    string    `db:"timezone" json:"timezone"` // Zona IANA
+	Descripcion string    `db:"descripcion" json:"descripcion"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
 // BlacklistEntry representa un número bloqueado por proyecto
 type BlacklistEntry struct {
 	ID         int64     `db:"id" json:"id"`
@@ -99,3 +270,357 @@ type BlacklistEntry struct {
 	Razon      *string   `db:"razon" json:"razon"`
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 }
+
+// BlacklistRule bloquea un número automáticamente según el resultado de sus llamadas
+type BlacklistRule struct {
+	ID           int       `db:"id" json:"id"`
+	ProyectoID   int       `db:"proyecto_id" json:"proyecto_id"`
+	Tipo         string    `db:"tipo" json:"tipo"`                 // disposition o dtmf
+	Valor        string    `db:"valor" json:"valor"`               // Disposition (ej: NI) o dígito (ej: 9)
+	Consecutivos int       `db:"consecutivos" json:"consecutivos"` // Últimas llamadas finalizadas que deben cumplirla (1 = la actual)
+	DNC          bool      `db:"dnc" json:"dnc"`                   // Baja voluntaria: además descarta el número en las campañas del proyecto
+	Activo       bool      `db:"activo" json:"activo"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// NotificationChannel es un canal de chat (Slack o Telegram) que recibe los eventos de campaña y
+// las alertas de un proyecto
+type NotificationChannel struct {
+	ID         int       `db:"id" json:"id"`
+	ProyectoID int       `db:"proyecto_id" json:"proyecto_id"`
+	Tipo       string    `db:"tipo" json:"tipo"` // slack o telegram
+	Nombre     string    `db:"nombre" json:"nombre"`
+	WebhookURL string    `db:"webhook_url" json:"webhook_url"` // Slack: Incoming Webhook
+	BotToken   string    `db:"bot_token" json:"bot_token"`     // Telegram: token del bot
+	ChatID     string    `db:"chat_id" json:"chat_id"`         // Telegram: chat, grupo o canal destino
+	Eventos    string    `db:"eventos" json:"eventos"`         // Eventos separados por coma (vacío = todos)
+	Activo     bool      `db:"activo" json:"activo"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// ImportJob representa una importación de contactos procesada en segundo plano
+type ImportJob struct {
+	ID               int64      `db:"id" json:"id"`
+	CampaignID       int        `db:"campaign_id" json:"campaign_id"`
+	Filename         string     `db:"filename" json:"filename"`
+	FilePath         string     `db:"file_path" json:"-"`
+	Mapping          *string    `db:"mapping" json:"mapping,omitempty"` // JSON
+	Estado           string     `db:"estado" json:"estado"`             // pending, running, completed, failed
+	TotalRows        int        `db:"total_rows" json:"total_rows"`
+	ProcessedRows    int        `db:"processed_rows" json:"processed_rows"`
+	Inserted         int        `db:"inserted" json:"inserted"`
+	Duplicates       int        `db:"duplicates" json:"duplicates"`
+	Blacklisted      int        `db:"blacklisted" json:"blacklisted"`
+	Invalid          int        `db:"invalid" json:"invalid"`
+	SuppressActive   bool       `db:"suppress_active" json:"suppress_active"` // Omitir números presentes en otra campaña activa del proyecto
+	SuppressDays     int        `db:"suppress_days" json:"suppress_days"`     // Omitir números llamados en los últimos N días (0 = no)
+	SuppressedActive int        `db:"suppressed_active" json:"suppressed_active"`
+	SuppressedRecent int        `db:"suppressed_recent" json:"suppressed_recent"`
+	Errors           *string    `db:"errors" json:"errors,omitempty"` // JSON
+	ErrorMessage     *string    `db:"error_message" json:"error_message,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	StartedAt        *time.Time `db:"started_at" json:"started_at"`
+	FinishedAt       *time.Time `db:"finished_at" json:"finished_at"`
+}
+
+// ContactSource es el origen HTTP (API de un CRM) del que se traen periódicamente los contactos de
+// una campaña. Cada consulta genera un ImportJob con el mapeo de columnas del origen.
+type ContactSource struct {
+	CampaignID      int               `db:"campaign_id" json:"campaign_id"`
+	URL             string            `db:"url" json:"url"`
+	Formato         string            `db:"formato" json:"formato"` // json o csv
+	Headers         map[string]string `db:"headers" json:"headers"` // ej: Authorization
+	RecordsPath     string            `db:"records_path" json:"records_path"`
+	PhoneColumn     string            `db:"phone_column" json:"phone_column"`
+	NameColumn      string            `db:"name_column" json:"name_column"`
+	Fields          string            `db:"fields" json:"fields"`         // Columnas adicionales separadas por coma
+	Paginacion      string            `db:"paginacion" json:"paginacion"` // none, page o next
+	PageParam       string            `db:"page_param" json:"page_param"`
+	PageSizeParam   string            `db:"page_size_param" json:"page_size_param"`
+	PageSize        int               `db:"page_size" json:"page_size"`
+	NextPath        string            `db:"next_path" json:"next_path"`
+	MaxPages        int               `db:"max_pages" json:"max_pages"`
+	IntervalMinutes int               `db:"interval_minutes" json:"interval_minutes"` // 0 = solo manual
+	SuppressActive  bool              `db:"suppress_active" json:"suppress_active"`
+	SuppressDays    int               `db:"suppress_days" json:"suppress_days"`
+	Activo          bool              `db:"activo" json:"activo"`
+	LastRunAt       *time.Time        `db:"last_run_at" json:"last_run_at"`
+	LastImportID    *int64            `db:"last_import_id" json:"last_import_id"`
+	LastError       string            `db:"last_error" json:"last_error"`
+	CreatedAt       time.Time         `db:"created_at" json:"created_at"`
+}
+
+// ContactResult es el resultado final de un contacto pendiente de enviar al result_url de su campaña
+type ContactResult struct {
+	Contact        CampaignContact
+	ResultURL      string
+	ProyectoID     int
+	NotifyAttempts int
+}
+
+// Callback es una solicitud de rellamada hecha desde el IVR, a marcar dentro de su ventana
+type Callback struct {
+	ID            int64      `db:"id" json:"id"`
+	ProyectoID    int        `db:"proyecto_id" json:"proyecto_id"`
+	CampaignID    *int       `db:"campaign_id" json:"campaign_id,omitempty"`
+	ContactID     *int64     `db:"contact_id" json:"contact_id,omitempty"`
+	Telefono      string     `db:"telefono" json:"telefono"`
+	OriginalLogID int64      `db:"original_log_id" json:"original_log_id"`
+	WindowStart   time.Time  `db:"window_start" json:"window_start"`
+	WindowEnd     time.Time  `db:"window_end" json:"window_end"`
+	Estado        string     `db:"estado" json:"estado"` // pending, dialed, expired, skipped
+	DialedAt      *time.Time `db:"dialed_at" json:"dialed_at"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Survey es una encuesta IVR: preguntas que se responden con un dígito, en orden
+type Survey struct {
+	ID         int              `db:"id" json:"id"`
+	ProyectoID int              `db:"proyecto_id" json:"proyecto_id"`
+	Nombre     string           `db:"nombre" json:"nombre"`
+	EndAudio   string           `db:"end_audio" json:"end_audio"` // Audio al terminar (opcional)
+	Preguntas  []SurveyQuestion `json:"preguntas"`
+	CreatedAt  time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+// SurveyQuestion es una pregunta de la encuesta
+type SurveyQuestion struct {
+	ID       int    `db:"id" json:"id"`
+	SurveyID int    `db:"survey_id" json:"survey_id"`
+	Orden    int    `db:"orden" json:"orden"`
+	Texto    string `db:"texto" json:"texto"` // Enunciado (columna del export)
+	Audio    string `db:"audio" json:"audio"`
+	Opciones string `db:"opciones" json:"opciones"` // Dígitos válidos, ej: "12345" (vacío = cualquiera)
+	Timeout  int    `db:"timeout" json:"timeout"`   // Segundos esperando la respuesta (0 = 5)
+	Intentos int    `db:"intentos" json:"intentos"` // Intentos ante respuesta inválida o sin respuesta (0 = 2)
+}
+
+// SurveyResponse es la respuesta a una pregunta dentro de una llamada
+type SurveyResponse struct {
+	ID         int64     `db:"id" json:"id"`
+	SurveyID   int       `db:"survey_id" json:"survey_id"`
+	QuestionID int       `db:"question_id" json:"question_id"`
+	CallLogID  int64     `db:"call_log_id" json:"call_log_id"`
+	ProyectoID int       `db:"proyecto_id" json:"proyecto_id"`
+	CampaignID *int      `db:"campaign_id" json:"campaign_id,omitempty"`
+	ContactID  *int64    `db:"contact_id" json:"contact_id,omitempty"`
+	Telefono   string    `db:"telefono" json:"telefono"`
+	Respuesta  string    `db:"respuesta" json:"respuesta"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// Audio son los metadatos de un archivo de la biblioteca de audios (sound_path/apicall)
+type Audio struct {
+	ID         int       `db:"id" json:"id"`
+	Name       string    `db:"name" json:"name"`   // Nombre del archivo, ej: bienvenida.wav
+	Title      string    `db:"title" json:"title"` // Nombre descriptivo
+	Duration   float64   `db:"duration" json:"duration"`
+	Size       int64     `db:"size" json:"size"`
+	Tags       []string  `db:"tags" json:"tags"`
+	UploadedBy string    `db:"uploaded_by" json:"uploaded_by"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// AudioReference indica dónde se usa un audio (proyecto o encuesta)
+type AudioReference struct {
+	Tipo   string `json:"tipo"` // proyecto, encuesta
+	ID     int    `json:"id"`
+	Nombre string `json:"nombre"`
+	Campo  string `json:"campo"` // Columna que lo referencia, ej: capture_audio
+}
+
+// SpoolJob es una llamada aceptada y pendiente de generar su .call (cola persistente del spooler)
+type SpoolJob struct {
+	ID          int64     `db:"id" json:"id"`
+	ProyectoID  int       `db:"proyecto_id" json:"proyecto_id"`
+	Telefono    string    `db:"telefono" json:"telefono"`
+	ContactID   int64     `db:"contact_id" json:"contact_id"`
+	CampaignID  int       `db:"campaign_id" json:"campaign_id"`
+	Variables   *string   `db:"variables" json:"variables,omitempty"` // JSON
+	CallerID    string    `db:"caller_id" json:"caller_id"`
+	ExternalRef string    `db:"external_ref" json:"external_ref"`
+	CallbackOf  int64     `db:"callback_of" json:"callback_of"`
+	RingTimeout int       `db:"ring_timeout" json:"ring_timeout"`
+	Troncales   string    `db:"troncales" json:"troncales"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// WallboardStats son los totales del día para el wallboard en vivo
+type WallboardStats struct {
+	Since        time.Time        `json:"since"`
+	Attempted    int              `json:"attempted"`
+	Answered     int              `json:"answered"`
+	Machine      int              `json:"machine"`
+	Transferred  int              `json:"transferred"`
+	AvgDuration  float64          `json:"avg_duration"`  // Segundos, sobre llamadas contestadas
+	ASR          float64          `json:"asr"`           // Contestadas / intentadas
+	MachineRate  float64          `json:"machine_rate"`  // AM / contestadas
+	TransferRate float64          `json:"transfer_rate"` // XFER / contestadas por humano
+	Hourly       []WallboardHour  `json:"hourly"`
+	Trunks       []WallboardTrunk `json:"trunks"`
+}
+
+// WallboardHour es un bucket del histograma por hora
+type WallboardHour struct {
+	Hour      int `json:"hour"`
+	Attempted int `json:"attempted"`
+	Answered  int `json:"answered"`
+}
+
+// WallboardTrunk es el ASR de una troncal
+type WallboardTrunk struct {
+	Troncal   string  `json:"troncal"`
+	Attempted int     `json:"attempted"`
+	Answered  int     `json:"answered"`
+	ASR       float64 `json:"asr"`
+}
+
+// ProyectoStats es el resumen de un proyecto desde Since: los totales del wallboard (con el uso de
+// troncales) y las dispositions más frecuentes
+type ProyectoStats struct {
+	*WallboardStats
+	TopDispositions []DispositionTotal `json:"top_dispositions"`
+}
+
+// DispositionTotal es la cantidad de llamadas con una disposition
+type DispositionTotal struct {
+	Disposition string `json:"disposition"`
+	Count       int    `json:"count"`
+}
+
+// ReportPoint es un período (día, semana o mes) de la tendencia histórica, calculado desde los rollups horarios
+type ReportPoint struct {
+	Periodo        string  `json:"periodo"` // YYYY-MM-DD (inicio del período)
+	Attempted      int     `json:"attempted"`
+	Answered       int     `json:"answered"`
+	Contacted      int     `json:"contacted"` // Contestadas por humano
+	Converted      int     `json:"converted"` // Contactadas que marcaron DTMF
+	ASR            float64 `json:"asr"`
+	ContactRate    float64 `json:"contact_rate"`
+	DTMFConversion float64 `json:"dtmf_conversion"`
+	AvgDuration    float64 `json:"avg_duration"`
+	AvgRingTime    float64 `json:"avg_ring_time"` // Segundos de timbrado, sobre las llamadas con tiempos medidos
+	AvgTalkTime    float64 `json:"avg_talk_time"` // Segundos de conversación, sobre las contestadas con tiempos medidos
+}
+
+// ReportFilter acota los reportes históricos
+type ReportFilter struct {
+	From       time.Time
+	To         time.Time // Exclusivo
+	ProyectoID int       // 0 = todos
+	CampaignID int       // 0 = todas
+}
+
+// CostReportRow es el costo estimado de un grupo (día, campaña, troncal o proyecto)
+type CostReportRow struct {
+	Grupo              string  `json:"grupo"`
+	Llamadas           int     `json:"llamadas"`
+	Duracion           int64   `json:"duracion"`            // Segundos hablados
+	SegundosFacturados int64   `json:"segundos_facturados"` // Segundos tras aplicar los incrementos
+	Minutos            float64 `json:"minutos"`             // Minutos facturados
+	Costo              float64 `json:"costo"`
+}
+
+// HangupCauseRow es la cantidad de llamadas con una causa de cuelgue (por troncal si se pidió)
+type HangupCauseRow struct {
+	Troncal  string  `json:"troncal,omitempty"`
+	Cause    int     `json:"cause"`
+	CauseTxt string  `json:"cause_txt"`
+	Llamadas int     `json:"llamadas"`
+	Ratio    float64 `json:"ratio"` // Fracción del total de la troncal (o del rango sin agrupar)
+}
+
+// SIPCodeCount es la cantidad de llamadas con una respuesta SIP
+type SIPCodeCount struct {
+	Code     int    `json:"code"`
+	Reason   string `json:"reason"`
+	Llamadas int    `json:"llamadas"`
+}
+
+// SIPTrunkErrors son las respuestas SIP de una troncal y su tasa de error (respuestas >= 400)
+type SIPTrunkErrors struct {
+	Troncal   string         `json:"troncal"`
+	Llamadas  int            `json:"llamadas"` // Llamadas con respuesta SIP registrada
+	Errores   int            `json:"errores"`
+	ErrorRate float64        `json:"error_rate"`
+	Codes     []SIPCodeCount `json:"codes"` // De más a menos frecuente
+}
+
+// RetentionRun es el reporte de una pasada del worker de retención sobre un proyecto
+type RetentionRun struct {
+	ID         int64      `db:"id" json:"id"`
+	ProyectoID int        `db:"proyecto_id" json:"proyecto_id"`
+	DryRun     bool       `db:"dry_run" json:"dry_run"`
+	Cutoff     time.Time  `db:"cutoff" json:"cutoff"`
+	CallLogs   int        `db:"call_logs" json:"call_logs"`
+	Contacts   int        `db:"contacts" json:"contacts"`
+	Recordings int        `db:"recordings" json:"recordings"`
+	Archivos   string     `db:"archivos" json:"archivos"`
+	Error      string     `db:"error" json:"error,omitempty"`
+	StartedAt  time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt *time.Time `db:"finished_at" json:"finished_at"`
+}
+
+// Tipos de alerta operativa
+const (
+	AlertTrunkDown       = "trunk_down"
+	AlertDBUnreachable   = "db_unreachable"
+	AlertLowAnswerRate   = "low_answer_rate"
+	AlertSpoolSaturation = "spool_saturation"
+	AlertCIDQuarantined  = "cid_quarantined"
+)
+
+// CIDAnswerRate son las llamadas finalizadas y contestadas de un Caller ID en un proyecto
+type CIDAnswerRate struct {
+	CallerID    string
+	ProyectoID  int
+	Llamadas    int
+	Contestadas int
+}
+
+// CIDQuarantine es un Caller ID retirado de la rotación porque su tasa de contestación colapsó
+type CIDQuarantine struct {
+	CallerID   string    `db:"caller_id" json:"caller_id"`
+	TenantID   int       `db:"tenant_id" json:"tenant_id"`
+	ProyectoID int       `db:"proyecto_id" json:"proyecto_id"` // Proyecto en el que se detectó
+	Llamadas   int       `db:"llamadas" json:"llamadas"`       // Llamadas finalizadas en la ventana evaluada
+	AnswerRate float64   `db:"answer_rate" json:"answer_rate"` // % de contestadas en la ventana
+	Motivo     string    `db:"motivo" json:"motivo"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// CIDReputation es el resultado de la última consulta de reputación de un Caller ID
+
+type CIDReputation struct {
+	CallerID  string    `db:"caller_id" json:"caller_id"`
+	Provider  string    `db:"provider" json:"provider"`
+	Label     string    `db:"label" json:"label"`           // Etiqueta del proveedor (ej: spam, clean)
+	Score     *float64  `db:"score" json:"score"`           // Puntaje de riesgo (nil = no informado)
+	Error     string    `db:"error" json:"error,omitempty"` // Error de la última consulta
+	CheckedAt time.Time `db:"checked_at" json:"checked_at"`
+}
+
+// CIDStats son las llamadas finalizadas de un Caller ID presentado, con su cuarentena y reputación
+type CIDStats struct {
+	CallerID    string         `json:"caller_id"`
+	Llamadas    int            `json:"llamadas"`
+	Contestadas int            `json:"contestadas"`
+	AnswerRate  float64        `json:"answer_rate"`
+	Cuarentena  bool           `json:"cuarentena"`
+	Reputacion  *CIDReputation `json:"reputacion"` // nil = sin consultar
+}
+
+// Alert es una alerta operativa: se abre al cumplirse la condición y se resuelve cuando deja de cumplirse
+type Alert struct {
+	ID         int64      `db:"id" json:"id"`
+	TenantID   int        `db:"tenant_id" json:"tenant_id"` // 0 = alerta del sistema
+	Tipo       string     `db:"tipo" json:"tipo"`
+	Clave      string     `db:"clave" json:"clave"` // Troncal, campaña o instancia afectada
+	Mensaje    string     `db:"mensaje" json:"mensaje"`
+	Estado     string     `db:"estado" json:"estado"` // active, resolved
+	Notificada bool       `db:"notificada" json:"notificada"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt *time.Time `db:"resolved_at" json:"resolved_at"`
+}
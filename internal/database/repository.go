@@ -2,13 +2,24 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"apicall/internal/audio"
+	"apicall/internal/secrets"
 )
 
 // Repository maneja las operaciones de base de datos
 type Repository struct {
-	conn    *Connection
-	batcher *LogBatcher
+	conn     *Connection
+	batcher  *LogBatcher
+	events   *EventBatcher
+	cache    *lookupCache
+	tenantID int // 0 = sin restricción (workers internos y superadmin)
 }
 
 // NewRepository crea un nuevo repositorio
@@ -16,8 +27,12 @@ func NewRepository(conn *Connection) *Repository {
 	repo := &Repository{
 		conn:    conn,
 		batcher: NewLogBatcher(conn.DB),
+		events:  NewEventBatcher(conn.DB),
+		cache:   &lookupCache{},
 	}
+	repo.batcher.config = repo.GetConfig
 	repo.batcher.Start()
+	repo.events.Start()
 	return repo
 }
 
@@ -26,6 +41,26 @@ func (r *Repository) Close() {
 	if r.batcher != nil {
 		r.batcher.Stop()
 	}
+	if r.events != nil {
+		r.events.Stop()
+	}
+}
+
+// EnableLogJournal activa el journal en disco del batcher de logs: las actualizaciones que no
+// entran en el buffer se guardan en path y se reaplican cuando la base de datos se recupera
+func (r *Repository) EnableLogJournal(path string) error {
+	return r.batcher.EnableJournal(path)
+}
+
+// LogBatcherStats devuelve las métricas del batcher de logs y los parámetros de flush en uso
+func (r *Repository) LogBatcherStats() BatcherStats {
+	return r.batcher.Stats()
+}
+
+// OnCallFinished registra fn con el nombre name para las llamadas que acaban de recibir su resultado
+// final (batcher y eventos AMI); fn = nil lo quita. Se llama desde el batcher: fn no debe bloquear.
+func (r *Repository) OnCallFinished(name string, fn func(ids []int64)) {
+	r.batcher.setFinishedHook(name, fn)
 }
 
 // GetDB returns the underlying sql.DB
@@ -33,45 +68,127 @@ func (r *Repository) GetDB() *sql.DB {
 	return r.conn.DB
 }
 
-// GetProyecto obtiene un proyecto por ID
-func (r *Repository) GetProyecto(id int) (*Proyecto, error) {
-	query := `
-		SELECT id, nombre, caller_id, audio, dtmf_esperado, numero_desborde,
+// ForTenant devuelve una vista del repositorio acotada a una organización.
+// Comparte conexión, batchers y caché con el repositorio original (no llamar Close sobre la vista).
+// tenantID = 0 devuelve una vista sin restricción.
+func (r *Repository) ForTenant(tenantID int) *Repository {
+	return &Repository{conn: r.conn, batcher: r.batcher, events: r.events, cache: r.cache, tenantID: tenantID}
+}
+
+// TenantID devuelve la organización de la vista (0 = sin restricción)
+func (r *Repository) TenantID() int {
+	return r.tenantID
+}
+
+// tenantFilter agrega " AND <column> = ?" cuando el repositorio está acotado a un tenant
+func (r *Repository) tenantFilter(column string, args []interface{}) (string, []interface{}) {
+	if r.tenantID == 0 {
+		return "", args
+	}
+	return " AND " + column + " = ?", append(args, r.tenantID)
+}
+
+// proyectoFilter acota tablas que pertenecen al tenant a través de su proyecto (logs, blacklist)
+func (r *Repository) proyectoFilter(column string, args []interface{}) (string, []interface{}) {
+	if r.tenantID == 0 {
+		return "", args
+	}
+	return " AND " + column + " IN (SELECT id FROM apicall_proyectos WHERE tenant_id = ?)", append(args, r.tenantID)
+}
+
+// campaignFilter acota tablas que pertenecen al tenant a través de su campaña (contactos, horarios, imports)
+func (r *Repository) campaignFilter(column string, args []interface{}) (string, []interface{}) {
+	if r.tenantID == 0 {
+		return "", args
+	}
+	return " AND " + column + " IN (SELECT id FROM apicall_campaigns WHERE tenant_id = ?)", append(args, r.tenantID)
+}
+
+// tenantForInsert devuelve el tenant con el que se crea un registro:
+// la vista acotada siempre impone el suyo, la vista sin restricción respeta el recibido
+func (r *Repository) tenantForInsert(requested int) int {
+	if r.tenantID != 0 {
+		return r.tenantID
+	}
+	if requested == 0 {
+		return DefaultTenantID
+	}
+	return requested
+}
+
+// proyectoColumns es la lista de columnas usada por las consultas de proyectos
+const proyectoColumns = `id, nombre, caller_id, audio, dtmf_esperado, numero_desborde,
 		       troncal_salida, prefijo_salida, ips_autorizadas, max_retries,
-		       retry_time, amd_active, smart_cid_active, COALESCE(timezone, 'America/Bogota'), created_at, updated_at
-		FROM apicall_proyectos
-		WHERE id = ?
-	`
+		       retry_time, amd_active, smart_cid_active, COALESCE(timezone, 'America/Bogota'),
+		       COALESCE(no_repeat_minutes, 0), COALESCE(pais, ''), COALESCE(capture_digits, 0),
+		       COALESCE(capture_audio, ''), COALESCE(capture_timeout, 5), COALESCE(transfer_mode, 'blind'),
+		       COALESCE(transfer_target, ''), COALESCE(transfer_timeout, 30), COALESCE(transfer_fail_audio, ''),
+		       COALESCE(callback_dtmf, ''), COALESCE(callback_audio, ''), COALESCE(callback_delay, 60),
+		       COALESCE(callback_window, 60), COALESCE(dial_engine, ''),
+		       COALESCE(ring_timeout, 45), COALESCE(retention_days, 0), COALESCE(survey_id, 0),
+		       COALESCE(max_calls_day, 0), COALESCE(max_concurrent, 0), COALESCE(trunk_strategy, 'random'),
+		       COALESCE(prefijos_permitidos, ''), COALESCE(prefijos_bloqueados, ''), COALESCE(locale, 'es'),
+		       COALESCE(max_number_attempts_day, 0), COALESCE(horario_local, ''), tenant_id, created_at, updated_at`
+
+// rowScanner abstrae *sql.Row y *sql.Rows para reutilizar funciones de escaneo
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+// scanProyecto escanea una fila con el formato de proyectoColumns
+func scanProyecto(row rowScanner) (*Proyecto, error) {
 	var p Proyecto
-	err := r.conn.DB.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&p.ID, &p.Nombre, &p.CallerID, &p.Audio, &p.DTMFEsperado,
 		&p.NumeroDesborde, &p.TroncalSalida, &p.PrefijoSalida,
 		&p.IPsAutorizadas, &p.MaxRetries, &p.RetryTime, &p.AMDActive, &p.SmartCIDActive,
-		&p.Timezone, &p.CreatedAt, &p.UpdatedAt,
+		&p.Timezone, &p.NoRepeatMinutes, &p.Pais, &p.CaptureDigits, &p.CaptureAudio, &p.CaptureTimeout,
+		&p.TransferMode, &p.TransferTarget, &p.TransferTimeout, &p.TransferFailAudio,
+		&p.CallbackDTMF, &p.CallbackAudio, &p.CallbackDelay, &p.CallbackWindow, &p.DialEngine,
+		&p.RingTimeout, &p.RetentionDays, &p.SurveyID, &p.MaxCallsDay, &p.MaxConcurrent, &p.TrunkStrategy,
+		&p.PrefijosPermitidos, &p.PrefijosBloqueados, &p.Locale, &p.MaxNumberAttempts, &p.HorarioLocal, &p.TenantID, &p.CreatedAt, &p.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetProyecto obtiene un proyecto por ID (en caché durante CacheTTL)
+func (r *Repository) GetProyecto(id int) (*Proyecto, error) {
+	if p, ok := r.cache.proyectos.get(id); ok && (r.tenantID == 0 || p.TenantID == r.tenantID) {
+		return &p, nil
+	}
+
+	query := `
+		SELECT ` + proyectoColumns + `
+		FROM apicall_proyectos
+		WHERE id = ?
+	`
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
 
+	p, err := scanProyecto(r.conn.DB.QueryRow(query+filter, args...))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("proyecto %d no encontrado", id)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("error consultando proyecto: %w", err)
 	}
+	r.cache.proyectos.set(id, *p)
 
-	return &p, nil
+	return p, nil
 }
 
 // ListProyectos lista todos los proyectos
 func (r *Repository) ListProyectos() ([]Proyecto, error) {
 	query := `
-		SELECT id, nombre, caller_id, audio, dtmf_esperado, numero_desborde,
-		       troncal_salida, prefijo_salida, ips_autorizadas, max_retries, retry_time, amd_active,
-		       smart_cid_active, COALESCE(timezone, 'America/Bogota'), created_at, updated_at
+		SELECT ` + proyectoColumns + `
 		FROM apicall_proyectos
-		ORDER BY id
+		WHERE 1=1
 	`
+	filter, args := r.tenantFilter("tenant_id", nil)
 
-	rows, err := r.conn.DB.Query(query)
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY id", args...)
 	if err != nil {
 		return nil, fmt.Errorf("error listando proyectos: %w", err)
 	}
@@ -79,22 +196,35 @@ func (r *Repository) ListProyectos() ([]Proyecto, error) {
 
 	var proyectos []Proyecto
 	for rows.Next() {
-		var p Proyecto
-		err := rows.Scan(
-			&p.ID, &p.Nombre, &p.CallerID, &p.Audio, &p.DTMFEsperado,
-			&p.NumeroDesborde, &p.TroncalSalida, &p.PrefijoSalida,
-			&p.IPsAutorizadas, &p.MaxRetries, &p.RetryTime, &p.AMDActive,
-			&p.SmartCIDActive, &p.Timezone, &p.CreatedAt, &p.UpdatedAt,
-		)
+		p, err := scanProyecto(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error escaneando proyecto: %w", err)
 		}
-		proyectos = append(proyectos, p)
+		proyectos = append(proyectos, *p)
 	}
 
 	return proyectos, nil
 }
 
+// ListProyectoLocales devuelve los idiomas que usan los proyectos de todos los tenants
+func (r *Repository) ListProyectoLocales() ([]string, error) {
+	rows, err := r.conn.DB.Query("SELECT DISTINCT COALESCE(locale, 'es') FROM apicall_proyectos ORDER BY 1")
+	if err != nil {
+		return nil, fmt.Errorf("error listando idiomas de proyectos: %w", err)
+	}
+	defer rows.Close()
+
+	var locales []string
+	for rows.Next() {
+		var locale string
+		if err := rows.Scan(&locale); err != nil {
+			return nil, fmt.Errorf("error escaneando idioma: %w", err)
+		}
+		locales = append(locales, locale)
+	}
+	return locales, rows.Err()
+}
+
 // CreateProyecto crea un nuevo proyecto
 func (r *Repository) CreateProyecto(p *Proyecto) error {
 	// Valores por defecto si no se especifican
@@ -109,23 +239,39 @@ func (r *Repository) CreateProyecto(p *Proyecto) error {
 	if p.Timezone == "" {
 		p.Timezone = "America/Bogota"
 	}
+	if p.Locale == "" {
+		p.Locale = "es"
+	}
+
+	p.TenantID = r.tenantForInsert(p.TenantID)
 
 	query := `
 		INSERT INTO apicall_proyectos (id, nombre, caller_id, audio, dtmf_esperado,
 		                                numero_desborde, troncal_salida, prefijo_salida,
-		                                ips_autorizadas, max_retries, retry_time, amd_active, timezone)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                                ips_autorizadas, max_retries, retry_time, amd_active, timezone,
+		                                no_repeat_minutes, pais, capture_digits, capture_audio, capture_timeout,
+		                                transfer_mode, transfer_target, transfer_timeout, transfer_fail_audio,
+		                                callback_dtmf, callback_audio, callback_delay, callback_window, dial_engine,
+		                                ring_timeout, retention_days, survey_id, max_calls_day, max_concurrent, trunk_strategy,
+		                                prefijos_permitidos, prefijos_bloqueados, locale, max_number_attempts_day, horario_local, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := r.conn.DB.Exec(query,
 		p.ID, p.Nombre, p.CallerID, p.Audio, p.DTMFEsperado,
 		p.NumeroDesborde, p.TroncalSalida, p.PrefijoSalida,
 		p.IPsAutorizadas, p.MaxRetries, p.RetryTime, p.AMDActive, p.Timezone,
+		p.NoRepeatMinutes, p.Pais, p.CaptureDigits, p.CaptureAudio, p.CaptureTimeout,
+		p.TransferMode, p.TransferTarget, p.TransferTimeout, p.TransferFailAudio,
+		p.CallbackDTMF, p.CallbackAudio, p.CallbackDelay, p.CallbackWindow, p.DialEngine,
+		p.RingTimeout, p.RetentionDays, p.SurveyID, p.MaxCallsDay, p.MaxConcurrent, p.TrunkStrategy,
+		p.PrefijosPermitidos, p.PrefijosBloqueados, p.Locale, p.MaxNumberAttempts, p.HorarioLocal, p.TenantID,
 	)
 
 	if err != nil {
 		return fmt.Errorf("error creando proyecto: %w", err)
 	}
+	r.cache.proyectos.delete(p.ID)
 
 	return nil
 }
@@ -133,11 +279,13 @@ func (r *Repository) CreateProyecto(p *Proyecto) error {
 // DeleteProyecto elimina un proyecto
 func (r *Repository) DeleteProyecto(id int) error {
 	query := `DELETE FROM apicall_proyectos WHERE id = ?`
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
 
-	result, err := r.conn.DB.Exec(query, id)
+	result, err := r.conn.DB.Exec(query+filter, args...)
 	if err != nil {
 		return fmt.Errorf("error eliminando proyecto: %w", err)
 	}
+	r.cache.proyectos.delete(id)
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
@@ -154,20 +302,32 @@ func (r *Repository) UpdateProyecto(p *Proyecto) error {
 		SET nombre = ?, caller_id = ?, audio = ?, dtmf_esperado = ?,
 		    numero_desborde = ?, troncal_salida = ?, prefijo_salida = ?,
 		    ips_autorizadas = ?, max_retries = ?, retry_time = ?, 
-		    amd_active = ?, smart_cid_active = ?, timezone = ?, updated_at = NOW()
+		    amd_active = ?, smart_cid_active = ?, timezone = ?, no_repeat_minutes = ?,
+		    pais = ?, capture_digits = ?, capture_audio = ?, capture_timeout = ?,
+		    transfer_mode = ?, transfer_target = ?, transfer_timeout = ?, transfer_fail_audio = ?,
+		    callback_dtmf = ?, callback_audio = ?, callback_delay = ?, callback_window = ?,
+		    dial_engine = ?, ring_timeout = ?, retention_days = ?, survey_id = ?,
+		    max_calls_day = ?, max_concurrent = ?, trunk_strategy = ?,
+		    prefijos_permitidos = ?, prefijos_bloqueados = ?, locale = ?, max_number_attempts_day = ?, horario_local = ?, updated_at = NOW()
 		WHERE id = ?
 	`
-
-	result, err := r.conn.DB.Exec(query,
+	filter, args := r.tenantFilter("tenant_id", []interface{}{
 		p.Nombre, p.CallerID, p.Audio, p.DTMFEsperado,
 		p.NumeroDesborde, p.TroncalSalida, p.PrefijoSalida,
 		p.IPsAutorizadas, p.MaxRetries, p.RetryTime, p.AMDActive, p.SmartCIDActive, p.Timezone,
-		p.ID,
-	)
+		p.NoRepeatMinutes, p.Pais, p.CaptureDigits, p.CaptureAudio, p.CaptureTimeout,
+		p.TransferMode, p.TransferTarget, p.TransferTimeout, p.TransferFailAudio,
+		p.CallbackDTMF, p.CallbackAudio, p.CallbackDelay, p.CallbackWindow, p.DialEngine,
+		p.RingTimeout, p.RetentionDays, p.SurveyID, p.MaxCallsDay, p.MaxConcurrent, p.TrunkStrategy,
+		p.PrefijosPermitidos, p.PrefijosBloqueados, p.Locale, p.MaxNumberAttempts, p.HorarioLocal, p.ID,
+	})
+
+	result, err := r.conn.DB.Exec(query+filter, args...)
 
 	if err != nil {
 		return fmt.Errorf("error actualizando proyecto: %w", err)
 	}
+	r.cache.proyectos.delete(p.ID)
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
@@ -181,12 +341,13 @@ func (r *Repository) UpdateProyecto(p *Proyecto) error {
 // CreateCallLog registra una llamada
 func (r *Repository) CreateCallLog(log *CallLog) (int64, error) {
 	query := `
-		INSERT INTO apicall_call_log (proyecto_id, telefono, status, interacciono, caller_id_used, campaign_id, uniqueid)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO apicall_call_log (proyecto_id, telefono, status, interacciono, caller_id_used, campaign_id, contact_id, uniqueid, variables, external_ref, callback_of, troncal, attestation)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := r.conn.DB.Exec(query,
-		log.ProyectoID, log.Telefono, log.Status, log.Interacciono, log.CallerIDUsed, log.CampaignID, log.Uniqueid,
+		log.ProyectoID, log.Telefono, log.Status, log.Interacciono, log.CallerIDUsed, log.CampaignID, log.ContactID, log.Uniqueid, log.Variables,
+		log.ExternalRef, log.CallbackOf, log.Troncal, log.Attestation,
 	)
 
 	if err != nil {
@@ -201,8 +362,23 @@ func (r *Repository) CreateCallLog(log *CallLog) (int64, error) {
 	return id, nil
 }
 
-// UpdateCallLog actualiza un registro de llamada
+// ErrCallLogNotFound indica que el registro de llamada no existe o es de otra organización
+var ErrCallLogNotFound = errors.New("registro de llamada no encontrado")
+
+// UpdateCallLog actualiza un registro de llamada. En una vista acotada solo acepta logs de proyectos del tenant.
 func (r *Repository) UpdateCallLog(id int64, dtmfMarcado *string, disposition *string, uniqueid *string, interacciono bool, status string, duracion int) error {
+	if r.tenantID != 0 {
+		filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+		var found int
+		err := r.conn.DB.QueryRow(`SELECT 1 FROM apicall_call_log WHERE id = ?`+filter, args...).Scan(&found)
+		if err == sql.ErrNoRows {
+			return ErrCallLogNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error consultando registro de llamada: %w", err)
+		}
+	}
+
 	// Optimization: Use Batcher instead of direct SQL
 	update := LogUpdate{
 		ID:           id,
@@ -217,89 +393,108 @@ func (r *Repository) UpdateCallLog(id int64, dtmfMarcado *string, disposition *s
 	return nil
 }
 
-// GetCallLogsByProyecto obtiene logs de llamadas por proyecto
-func (r *Repository) GetCallLogsByProyecto(proyectoID int, campaignID *int, limit int) ([]CallLog, error) {
-	query := `
-		SELECT id, proyecto_id, telefono, COALESCE(dtmf_marcado, ''), interacciono, status, COALESCE(disposition, ''), duracion, COALESCE(uniqueid, ''), COALESCE(caller_id_used, ''), campaign_id, created_at
-		FROM apicall_call_log
-		WHERE proyecto_id = ?
-	`
-	args := []interface{}{proyectoID}
-
-	if campaignID != nil {
-		query += " AND campaign_id = ?"
-		args = append(args, *campaignID)
+// CountCallsSince cuenta las llamadas de un proyecto creadas desde since (cuota diaria).
+// Sin filtro de tenant: lo usa el pipeline de marcación.
+func (r *Repository) CountCallsSince(proyectoID int, since time.Time) (int, error) {
+	var n int
+	err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_call_log WHERE proyecto_id = ? AND created_at >= ?`, proyectoID, since).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error contando llamadas del proyecto: %w", err)
 	}
+	return n, nil
+}
 
-	query += " ORDER BY created_at DESC LIMIT ?"
-	args = append(args, limit)
-
-	rows, err := r.conn.DB.Query(query, args...)
+// CountNumberCallsSince cuenta las llamadas a un número creadas desde since, en todos los proyectos
+// (intentos por número). Sin filtro de tenant: lo usa el pipeline de marcación.
+func (r *Repository) CountNumberCallsSince(telefono string, since time.Time) (int, error) {
+	var n int
+	err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_call_log WHERE telefono = ? AND created_at >= ?`, telefono, since).Scan(&n)
 	if err != nil {
-		return nil, fmt.Errorf("error consultando logs: %w", err)
+		return 0, fmt.Errorf("error contando intentos del número: %w", err)
 	}
-	defer rows.Close()
+	return n, nil
+}
 
-	logs := make([]CallLog, 0)
-	for rows.Next() {
-		var log CallLog
-		err := rows.Scan(
-			&log.ID, &log.ProyectoID, &log.Telefono, &log.DTMFMarcado,
-			&log.Interacciono, &log.Status, &log.Disposition, &log.Duracion, &log.Uniqueid, &log.CallerIDUsed, &log.CampaignID, &log.CreatedAt,
-		)
+// CountNumbersCallsSince cuenta, para un lote de números, las llamadas creadas desde since en todos
+// los proyectos. Los números sin llamadas no aparecen en el mapa.
+func (r *Repository) CountNumbersCallsSince(telefonos []string, since time.Time) (map[string]int, error) {
+	result := make(map[string]int)
+	const chunkSize = 500
+
+	for start := 0; start < len(telefonos); start += chunkSize {
+		chunk := telefonos[start:min(start+chunkSize, len(telefonos))]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)+1)
+		for i, tel := range chunk {
+			placeholders[i] = "?"
+			args = append(args, tel)
+		}
+		args = append(args, since)
+
+		query := fmt.Sprintf(`SELECT telefono, COUNT(*) FROM apicall_call_log WHERE telefono IN (%s) AND created_at >= ? GROUP BY telefono`,
+			strings.Join(placeholders, ","))
+		rows, err := r.conn.DB.Query(query, args...)
 		if err != nil {
-			return nil, fmt.Errorf("error escaneando log: %w", err)
+			return nil, fmt.Errorf("error contando intentos por número: %w", err)
 		}
-		logs = append(logs, log)
+		for rows.Next() {
+			var tel string
+			var n int
+			if err := rows.Scan(&tel, &n); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error escaneando intentos por número: %w", err)
+			}
+			result[tel] = n
+		}
+		rows.Close()
 	}
-
-	return logs, nil
+	return result, nil
 }
 
-// UpdateDialingCallByUniqueid updates a call that's still in DIALING status
-// This is called by the AMI event handler when a call ends without reaching FastAGI
-func (r *Repository) UpdateDialingCallByUniqueid(uniqueid string, status string, disposition string) (bool, error) {
-	// Only update if the call is still in DIALING status
-	// This prevents overwriting updates from FastAGI
-	query := `
-		UPDATE apicall_call_log 
-		SET status = ?, disposition = ?
-		WHERE status = 'DIALING' 
-		  AND created_at > NOW() - INTERVAL 10 MINUTE
-		  AND (uniqueid = ? OR uniqueid LIKE ?)
-		LIMIT 1
-	`
-	
-	result, err := r.conn.DB.Exec(query, status, disposition, uniqueid, "%"+uniqueid+"%")
+// MarkCallAbandoned registra en qué paso del IVR colgó el destino.
+// Se escribe directo (no vía batcher): es poco frecuente y no compite con las columnas del batcher.
+func (r *Repository) MarkCallAbandoned(id int64, step, audio string, seconds int) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET abandon_step = ?, abandon_audio = NULLIF(?, ''), abandon_seconds = ?
+		WHERE id = ?
+	`, step, audio, seconds, id)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("error registrando abandono: %w", err)
 	}
-	
-	rows, _ := result.RowsAffected()
-	return rows > 0, nil
+	return nil
 }
 
-// GetRecentCallLogs obtiene los logs más recientes sin filtrar por proyecto
-func (r *Repository) GetRecentCallLogs(limit int) ([]CallLog, error) {
-	query := `
-		SELECT id, proyecto_id, telefono, COALESCE(dtmf_marcado, ''), interacciono, status, COALESCE(disposition, ''), duracion, COALESCE(uniqueid, ''), COALESCE(caller_id_used, ''), campaign_id, created_at
-		FROM apicall_call_log
-		ORDER BY created_at DESC
-		LIMIT ?
-	`
+// SetCallCapturedDigits guarda los dígitos capturados con GET DATA (escritura directa, fuera del batcher)
+func (r *Repository) SetCallCapturedDigits(id int64, digits string) error {
+	_, err := r.conn.DB.Exec(`UPDATE apicall_call_log SET dtmf_capturado = ? WHERE id = ?`, digits, id)
+	if err != nil {
+		return fmt.Errorf("error guardando dígitos capturados: %w", err)
+	}
+	return nil
+}
 
-	rows, err := r.conn.DB.Query(query, limit)
+// SetCallTransferResult guarda el resultado de una transferencia a cola o grupo de timbrado
+func (r *Repository) SetCallTransferResult(id int64, result, status string) error {
+	_, err := r.conn.DB.Exec(`UPDATE apicall_call_log SET transfer_result = ?, transfer_status = NULLIF(?, '') WHERE id = ?`, result, status, id)
 	if err != nil {
-		return nil, fmt.Errorf("error consultando logs: %w", err)
+		return fmt.Errorf("error guardando resultado de transferencia: %w", err)
 	}
-	defer rows.Close()
+	return nil
+}
+
+// callLogColumns es la lista de columnas usada por todas las consultas de logs
+const callLogColumns = `id, proyecto_id, telefono, COALESCE(dtmf_marcado, ''), interacciono, status, COALESCE(disposition, ''), duracion, COALESCE(uniqueid, ''), COALESCE(caller_id_used, ''), campaign_id, contact_id, variables, external_ref, dtmf_capturado, transfer_result, transfer_status, callback_of, abandon_step, abandon_audio, abandon_seconds, COALESCE(troncal, ''), costo, hangup_cause, hangup_cause_txt, sip_code, sip_reason, attestation, segundos_timbrado, segundos_conversacion, created_at`
 
+// scanCallLogs escanea filas con el formato de callLogColumns
+func scanCallLogs(rows *sql.Rows) ([]CallLog, error) {
 	logs := make([]CallLog, 0)
 	for rows.Next() {
 		var log CallLog
 		err := rows.Scan(
 			&log.ID, &log.ProyectoID, &log.Telefono, &log.DTMFMarcado,
-			&log.Interacciono, &log.Status, &log.Disposition, &log.Duracion, &log.Uniqueid, &log.CallerIDUsed, &log.CampaignID, &log.CreatedAt,
+			&log.Interacciono, &log.Status, &log.Disposition, &log.Duracion, &log.Uniqueid, &log.CallerIDUsed, &log.CampaignID, &log.ContactID,
+			&log.Variables, &log.ExternalRef, &log.DTMFCapturado, &log.TransferResult, &log.TransferStatus, &log.CallbackOf, &log.AbandonStep, &log.AbandonAudio, &log.AbandonSeconds, &log.Troncal, &log.Costo, &log.HangupCause, &log.HangupCauseTxt, &log.SIPCode, &log.SIPReason, &log.Attestation, &log.RingSeconds, &log.TalkSeconds, &log.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error escaneando log: %w", err)
@@ -310,173 +505,663 @@ func (r *Repository) GetRecentCallLogs(limit int) ([]CallLog, error) {
 	return logs, nil
 }
 
-// GetCallLogsByProyectoWithDates obtiene logs de llamadas por proyecto con filtro de fechas
-func (r *Repository) GetCallLogsByProyectoWithDates(proyectoID int, campaignID *int, limit int, fromDate, toDate string) ([]CallLog, error) {
-	query := `
-		SELECT id, proyecto_id, telefono, COALESCE(dtmf_marcado, ''), interacciono, status, COALESCE(disposition, ''), duracion, COALESCE(uniqueid, ''), COALESCE(caller_id_used, ''), campaign_id, created_at
-		FROM apicall_call_log
-		WHERE proyecto_id = ?
-	`
+// CallLogFilter son los criterios de búsqueda de llamadas; los no vacíos se combinan con AND
+type CallLogFilter struct {
+	ProyectoID   int
+	CampaignID   *int
+	Telefono     string   // Número normalizado (coincidencia exacta)
+	Uniqueid     string   // Uniqueid de Asterisk
+	Dispositions []string // Alguna de estas dispositions
+	FromDate     string   // YYYY-MM-DD inclusive
+	ToDate       string   // YYYY-MM-DD inclusive
+}
 
-	args := []interface{}{proyectoID}
+// CallLogCursor es la última llamada de la página anterior: la siguiente empieza justo después en el
+// orden (created_at DESC, id DESC), sin OFFSET y sin saltar filas aunque entren llamadas nuevas
+type CallLogCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
 
-	if campaignID != nil {
-		query += " AND campaign_id = ?"
-		args = append(args, *campaignID)
+// where arma las condiciones del filtro (con " AND " inicial). Las fechas se comparan como rango
+// sobre created_at (sin DATE()) para que MySQL use los índices por teléfono y disposition.
+func (f CallLogFilter) where(args []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	if f.ProyectoID != 0 {
+		sb.WriteString(" AND proyecto_id = ?")
+		args = append(args, f.ProyectoID)
 	}
-
-	if fromDate != "" {
-		query += " AND DATE(created_at) >= ?"
-		args = append(args, fromDate)
+	if f.CampaignID != nil {
+		sb.WriteString(" AND campaign_id = ?")
+		args = append(args, *f.CampaignID)
 	}
-
-	if toDate != "" {
-		query += " AND DATE(created_at) <= ?"
-		args = append(args, toDate)
+	if f.Telefono != "" {
+		sb.WriteString(" AND telefono = ?")
+		args = append(args, f.Telefono)
+	}
+	if f.Uniqueid != "" {
+		sb.WriteString(" AND uniqueid = ?")
+		args = append(args, f.Uniqueid)
+	}
+	if len(f.Dispositions) > 0 {
+		sb.WriteString(" AND disposition IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.Dispositions)), ",") + ")")
+		for _, d := range f.Dispositions {
+			args = append(args, d)
+		}
+	}
+	if f.FromDate != "" {
+		sb.WriteString(" AND created_at >= ?")
+		args = append(args, f.FromDate)
+	}
+	if f.ToDate != "" {
+		sb.WriteString(" AND created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, f.ToDate)
 	}
+	return sb.String(), args
+}
 
-	query += " ORDER BY created_at DESC LIMIT ?"
-	args = append(args, limit)
+// SearchCallLogs devuelve una página de las llamadas que cumplen el filtro, de la más reciente a la
+// más antigua. Con cursor la página empieza después de esa llamada y se ignora offset.
+func (r *Repository) SearchCallLogs(f CallLogFilter, cursor *CallLogCursor, limit, offset int) ([]CallLog, error) {
+	where, args := f.where(nil)
+	if cursor != nil {
+		where += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+		offset = 0
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
 
-	rows, err := r.conn.DB.Query(query, args...)
+	rows, err := r.conn.DB.Query(`SELECT `+callLogColumns+` FROM apicall_call_log WHERE 1=1`+where+filter+
+		` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("error consultando logs: %w", err)
 	}
 	defer rows.Close()
 
-	logs := make([]CallLog, 0)
-	for rows.Next() {
-		var log CallLog
-		err := rows.Scan(
-			&log.ID, &log.ProyectoID, &log.Telefono, &log.DTMFMarcado,
-			&log.Interacciono, &log.Status, &log.Disposition, &log.Duracion, &log.Uniqueid, &log.CallerIDUsed, &log.CampaignID, &log.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error escaneando log: %w", err)
-		}
-		logs = append(logs, log)
-	}
+	return scanCallLogs(rows)
+}
 
-	return logs, nil
+// CountCallLogs cuenta las llamadas que cumplen el filtro
+func (r *Repository) CountCallLogs(f CallLogFilter) (int, error) {
+	where, args := f.where(nil)
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	var total int
+	if err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_call_log WHERE 1=1`+where+filter, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("error contando logs: %w", err)
+	}
+	return total, nil
 }
 
-// GetRecentCallLogsWithDates obtiene los logs más recientes con filtro de fechas
-func (r *Repository) GetRecentCallLogsWithDates(limit int, fromDate, toDate string) ([]CallLog, error) {
+// HasRecentCall indica si ya se llamó (o se está llamando) al número en los últimos N minutos.
+// Las llamadas que siguen en la cola del spooler o los contactos de campaña en 'dialing' todavía no
+// tienen log, así que también cuentan.
+func (r *Repository) HasRecentCall(proyectoID int, telefono string, minutes int) (bool, error) {
 	query := `
-		SELECT id, proyecto_id, telefono, COALESCE(dtmf_marcado, ''), interacciono, status, COALESCE(disposition, ''), duracion, COALESCE(uniqueid, ''), COALESCE(caller_id_used, ''), campaign_id, created_at
-		FROM apicall_call_log
-		WHERE 1=1
+		SELECT
+			(SELECT COUNT(*) FROM apicall_call_log
+			 WHERE proyecto_id = ? AND telefono = ?
+			   AND created_at > NOW() - INTERVAL ? MINUTE)
+			+ (SELECT COUNT(*) FROM apicall_spool_queue
+			   WHERE proyecto_id = ? AND telefono = ?)
+			+ (SELECT COUNT(*) FROM apicall_campaign_contacts cc
+			   JOIN apicall_campaigns c ON c.id = cc.campaign_id
+			   WHERE c.proyecto_id = ? AND cc.telefono = ? AND cc.estado = 'dialing')
 	`
-
-	args := []interface{}{}
-
-	if fromDate != "" {
-		query += " AND DATE(created_at) >= ?"
-		args = append(args, fromDate)
+	var count int
+	if err := r.conn.DB.QueryRow(query, proyectoID, telefono, minutes, proyectoID, telefono, proyectoID, telefono).Scan(&count); err != nil {
+		return false, fmt.Errorf("error consultando llamadas recientes: %w", err)
 	}
+	return count > 0, nil
+}
 
-	if toDate != "" {
-		query += " AND DATE(created_at) <= ?"
-		args = append(args, toDate)
+// ReserveIdempotencyKey registra una Idempotency-Key para un proyecto.
+// Retorna false si la clave ya fue usada en las últimas 24 horas (solicitud duplicada).
+func (r *Repository) ReserveIdempotencyKey(proyectoID int, key, telefono string) (bool, error) {
+	// Si la clave existe pero expiró, se reutiliza (affected = 2). Si sigue vigente no cambia nada (affected = 0).
+	query := `
+		INSERT INTO apicall_idempotency_keys (proyecto_id, idem_key, telefono, created_at)
+		VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE
+			telefono = IF(created_at < NOW() - INTERVAL 24 HOUR, VALUES(telefono), telefono),
+			created_at = IF(created_at < NOW() - INTERVAL 24 HOUR, NOW(), created_at)
+	`
+	result, err := r.conn.DB.Exec(query, proyectoID, key, telefono)
+	if err != nil {
+		return false, fmt.Errorf("error registrando idempotency key: %w", err)
 	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
 
-	query += " ORDER BY created_at DESC LIMIT ?"
-	args = append(args, limit)
+// ReleaseIdempotencyKey libera una clave reservada (p.ej. si la llamada no se pudo encolar)
+func (r *Repository) ReleaseIdempotencyKey(proyectoID int, key string) error {
+	_, err := r.conn.DB.Exec("DELETE FROM apicall_idempotency_keys WHERE proyecto_id = ? AND idem_key = ?", proyectoID, key)
+	return err
+}
 
-	rows, err := r.conn.DB.Query(query, args...)
+// UpdateDialingCallByID updates a call that's still in DIALING status
+// This is called by the AMI event handler when a call ends without reaching FastAGI
+func (r *Repository) UpdateDialingCallByID(id int64, status string, disposition string) (bool, error) {
+	// Only update if the call is still in DIALING status
+	// This prevents overwriting updates from FastAGI
+	result, err := r.conn.DB.Exec(
+		"UPDATE apicall_call_log SET status = ?, disposition = ? WHERE id = ? AND status = 'DIALING'",
+		status, disposition, id,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error consultando logs: %w", err)
+		return false, err
 	}
-	defer rows.Close()
-
-	logs := make([]CallLog, 0)
-	for rows.Next() {
-		var log CallLog
-		err := rows.Scan(
-			&log.ID, &log.ProyectoID, &log.Telefono, &log.DTMFMarcado,
-			&log.Interacciono, &log.Status, &log.Disposition, &log.Duracion, &log.Uniqueid, &log.CallerIDUsed, &log.CampaignID, &log.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error escaneando log: %w", err)
-		}
-		logs = append(logs, log)
+	rows, _ := result.RowsAffected()
+	if rows > 0 {
+		r.batcher.callsFinished([]int64{id})
 	}
-
-	return logs, nil
+	return rows > 0, nil
 }
 
-// CreateTroncal crea una nueva troncal
-func (r *Repository) CreateTroncal(troncal *Troncal) error {
-	query := `INSERT INTO apicall_troncales (nombre, host, puerto, usuario, password, contexto, caller_id, activo) 
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-
-	res, err := r.conn.DB.Exec(query, troncal.Nombre, troncal.Host, troncal.Puerto, troncal.Usuario, troncal.Password, troncal.Contexto, troncal.CallerID, troncal.Activo)
+// UpdateDialingCallByUniqueid is the fallback for calls no longer in the tracker (e.g. after a
+// restart): exact match on the Asterisk uniqueid stored by SetDialingCallUniqueid (idx_uniqueid)
+func (r *Repository) UpdateDialingCallByUniqueid(uniqueid string, status string, disposition string) (bool, error) {
+	var id int64
+	err := r.conn.DB.QueryRow(`
+		SELECT id FROM apicall_call_log
+		WHERE uniqueid = ?
+		  AND status = 'DIALING' 
+		  AND created_at > NOW() - INTERVAL 10 MINUTE
+		LIMIT 1
+	`, uniqueid).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
-		return fmt.Errorf("error insertando troncal: %w", err)
+		return false, err
 	}
+	return r.UpdateDialingCallByID(id, status, disposition)
+}
 
-	id, err := res.LastInsertId()
+// SetCallHangupCause guarda la causa de cuelgue de Asterisk (escritura directa, fuera del batcher).
+// Solo la primera: el Hangup de la pierna del destino llega una vez por canal.
+func (r *Repository) SetCallHangupCause(id int64, cause int, causeTxt string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET hangup_cause = ?, hangup_cause_txt = NULLIF(?, '')
+		WHERE id = ? AND hangup_cause IS NULL
+	`, cause, causeTxt, id)
 	if err != nil {
-		return err
+		return fmt.Errorf("error guardando causa de cuelgue: %w", err)
 	}
-	troncal.ID = int(id)
 	return nil
 }
 
-// ListTroncales devuelve todas las troncales
-func (r *Repository) ListTroncales() ([]Troncal, error) {
-	query := `SELECT id, nombre, host, puerto, COALESCE(usuario, ''), COALESCE(password, ''), contexto, COALESCE(caller_id, ''), activo FROM apicall_troncales`
-	rows, err := r.conn.DB.Query(query)
+// SetCallHangupCauseByUniqueid es el fallback de SetCallHangupCause para llamadas fuera del tracker
+// (ej: tras un reinicio), por el uniqueid de Asterisk (idx_uniqueid)
+func (r *Repository) SetCallHangupCauseByUniqueid(uniqueid string, cause int, causeTxt string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET hangup_cause = ?, hangup_cause_txt = NULLIF(?, '')
+		WHERE uniqueid = ? AND hangup_cause IS NULL AND created_at > NOW() - INTERVAL 1 DAY
+	`, cause, causeTxt, uniqueid)
 	if err != nil {
-		return nil, fmt.Errorf("error consultando troncales: %w", err)
+		return fmt.Errorf("error guardando causa de cuelgue: %w", err)
 	}
-	defer rows.Close()
+	return nil
+}
 
-	var troncales []Troncal
-	for rows.Next() {
-		var t Troncal
-		if err := rows.Scan(&t.ID, &t.Nombre, &t.Host, &t.Puerto, &t.Usuario, &t.Password, &t.Contexto, &t.CallerID, &t.Activo); err != nil {
-			return nil, fmt.Errorf("error escaneando troncal: %w", err)
-		}
-		troncales = append(troncales, t)
+// SetCallTiming guarda los segundos de timbrado y de conversación calculados con los eventos del canal
+// (el primero que llega gana, como la causa de cuelgue)
+func (r *Repository) SetCallTiming(id int64, ringSeconds, talkSeconds int) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET segundos_timbrado = ?, segundos_conversacion = ?
+		WHERE id = ? AND segundos_timbrado IS NULL
+	`, ringSeconds, talkSeconds, id)
+	if err != nil {
+		return fmt.Errorf("error guardando tiempos de la llamada: %w", err)
 	}
-	return troncales, nil
+	return nil
 }
 
-// DeleteTroncal elimina una troncal
-func (r *Repository) DeleteTroncal(id int) error {
-	_, err := r.conn.DB.Exec("DELETE FROM apicall_troncales WHERE id = ?", id)
-	return err
+// SetCallTimingByUniqueid es el fallback de SetCallTiming para llamadas fuera del tracker
+func (r *Repository) SetCallTimingByUniqueid(uniqueid string, ringSeconds, talkSeconds int) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET segundos_timbrado = ?, segundos_conversacion = ?
+		WHERE uniqueid = ? AND segundos_timbrado IS NULL AND created_at > NOW() - INTERVAL 1 DAY
+	`, ringSeconds, talkSeconds, uniqueid)
+	if err != nil {
+		return fmt.Errorf("error guardando tiempos de la llamada: %w", err)
+	}
+	return nil
 }
 
-// GetConfig obtiene un valor de configuración por clave
-func (r *Repository) GetConfig(key string) (string, error) {
-	query := `SELECT config_value FROM apicall_config WHERE config_key = ?`
-	var value string
-	err := r.conn.DB.QueryRow(query, key).Scan(&value)
-	if err == sql.ErrNoRows {
-		return "", nil // Return empty string if not found, not error
+// SetCallSIPResponse guarda la respuesta SIP final de la troncal (la última gana: tras un 183 puede llegar un 486)
+func (r *Repository) SetCallSIPResponse(id int64, code int, reason string) error {
+	_, err := r.conn.DB.Exec(`UPDATE apicall_call_log SET sip_code = ?, sip_reason = NULLIF(?, '') WHERE id = ?`, code, reason, id)
+	if err != nil {
+		return fmt.Errorf("error guardando respuesta SIP: %w", err)
 	}
+	return nil
+}
+
+// SetCallSIPResponseByUniqueid es el fallback de SetCallSIPResponse para llamadas fuera del tracker
+func (r *Repository) SetCallSIPResponseByUniqueid(uniqueid string, code int, reason string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log SET sip_code = ?, sip_reason = NULLIF(?, '')
+		WHERE uniqueid = ? AND created_at > NOW() - INTERVAL 1 DAY
+	`, code, reason, uniqueid)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("error guardando respuesta SIP: %w", err)
 	}
-	return value, nil
+	return nil
 }
 
-// SetConfig establece o actualiza un valor de configuración
-func (r *Repository) SetConfig(key, value, description string) error {
-	query := `
-		INSERT INTO apicall_config (config_key, config_value, description)
-		VALUES (?, ?, ?)
-		ON DUPLICATE KEY UPDATE 
-			config_value = VALUES(config_value),
-			description = COALESCE(VALUES(description), description)
-	`
-	_, err := r.conn.DB.Exec(query, key, value, description)
+// SetDialingCallUniqueid guarda el uniqueid de Asterisk de una llamada que aún está marcando
+// (FastAGI lo reescribe al contestar con el mismo valor)
+func (r *Repository) SetDialingCallUniqueid(id int64, uniqueid string) error {
+	_, err := r.conn.DB.Exec(
+		"UPDATE apicall_call_log SET uniqueid = ? WHERE id = ? AND status = 'DIALING'",
+		uniqueid, id,
+	)
 	return err
 }
 
-// Config represents a system configuration entry
+// GetInFlightCallLogs devuelve los logs sin resultado final (DIALING o CONNECTED) creados dentro
+// de window; se usa al arrancar para recuperar las llamadas que siguen en curso
+func (r *Repository) GetInFlightCallLogs(window time.Duration) ([]CallLog, error) {
+	query := `
+		SELECT ` + callLogColumns + `
+		FROM apicall_call_log
+		WHERE status IN ('DIALING', 'CONNECTED')
+		  AND created_at > NOW() - INTERVAL ? SECOND
+	`
+	rows, err := r.conn.DB.Query(query, int(window.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("error consultando llamadas en curso: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCallLogs(rows)
+}
+
+// CloseDialingCalls cierra como COMPLETED/NA los logs DIALING indicados con más de minAge (llamadas
+// cuyo canal ya no existe en Asterisk) y marca como fallidos sus contactos de campaña en curso
+func (r *Repository) CloseDialingCalls(ids []int64, minAge time.Duration) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, int(minAge.Seconds()))
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE apicall_call_log SET status = 'COMPLETED', disposition = 'NA'
+		WHERE id IN (`+placeholders+`) AND status = 'DIALING'
+		  AND created_at < NOW() - INTERVAL ? SECOND
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error cerrando llamadas: %w", err)
+	}
+	closed, _ := result.RowsAffected()
+	if closed > 0 {
+		if _, err := tx.Exec(`
+			UPDATE apicall_campaign_contacts cc
+			INNER JOIN apicall_call_log cl ON cl.contact_id = cc.id
+			SET cc.estado = 'failed', cc.resultado = 'NA', cc.ultimo_intento = NOW()
+			WHERE cl.id IN (`+placeholders+`) AND cl.disposition = 'NA' AND cc.estado = 'dialing'
+		`, args[:len(ids)]...); err != nil {
+			return 0, fmt.Errorf("error actualizando contactos: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando cierre de llamadas: %w", err)
+	}
+	return closed, nil
+}
+
+// CloseStaleDialingCalls cierra como COMPLETED/NA los logs que siguen en DIALING tras maxAge
+func (r *Repository) CloseStaleDialingCalls(maxAge time.Duration) (int64, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_call_log
+		SET status = 'COMPLETED', disposition = 'NA'
+		WHERE status = 'DIALING'
+		  AND created_at < NOW() - INTERVAL ? SECOND
+	`, int(maxAge.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("error cerrando llamadas huérfanas: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SyncClosedCallContacts pasa a su estado final los contactos en 'dialing' cuyo log (del último
+// día) ya tiene resultado
+func (r *Repository) SyncClosedCallContacts() (int64, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts cc
+		INNER JOIN apicall_call_log cl ON cl.contact_id = cc.id
+		SET 
+			cc.estado = CASE 
+				WHEN cl.status IN ('ANSWERED', 'ANSWER', 'AMD_HUMAN', 'COMPLETED', 'A') THEN 'completed'
+				WHEN cl.status IN ('NOANSWER', 'NO ANSWER', 'BUSY', 'FAILED', 'CONGESTION', 'CANCEL', 'TIMEOUT', 'AMD_MACHINE', 'NA', 'B', 'N', 'AM', 'FAIL', 'CONG') THEN 'failed'
+				WHEN cl.status IN ('BLACKLISTED', 'DNC') THEN 'skipped'
+				WHEN cl.status IN ('XFER', 'TRANSFERRED') THEN 'completed'
+				ELSE 'failed'
+			END,
+			cc.resultado = cl.status,
+			cc.ultimo_intento = NOW()
+		WHERE cc.estado = 'dialing'
+		  AND cl.status != 'DIALING'
+		  AND cl.created_at > NOW() - INTERVAL 1 DAY
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("error sincronizando contactos: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// FailStaleDialingContacts marca como fallidos (NA) los contactos que siguen en 'dialing' tras maxAge
+func (r *Repository) FailStaleDialingContacts(maxAge time.Duration) (int64, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts 
+		SET estado = 'failed', resultado = 'NA'
+		WHERE estado = 'dialing' 
+		  AND ultimo_intento IS NOT NULL
+		  AND ultimo_intento < NOW() - INTERVAL ? SECOND
+	`, int(maxAge.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("error limpiando contactos huérfanos: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// CreateTroncal crea una nueva troncal
+func (r *Repository) CreateTroncal(troncal *Troncal) error {
+	troncal.TenantID = r.tenantForInsert(troncal.TenantID)
+	password, err := secrets.Encrypt(troncal.Password)
+	if err != nil {
+		return fmt.Errorf("error cifrando secreto de troncal: %w", err)
+	}
+	if err := r.checkTroncalSecretWidth(password); err != nil {
+		return err
+	}
+	troncal.Password = password
+	query := `INSERT INTO apicall_troncales (nombre, host, puerto, usuario, password, contexto, caller_id, activo, tenant_id, costo_minuto, incremento_inicial, incremento, capacidad, pai, sip_headers, attestation) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	res, err := r.conn.DB.Exec(query, troncal.Nombre, troncal.Host, troncal.Puerto, troncal.Usuario, troncal.Password, troncal.Contexto, troncal.CallerID, troncal.Activo, troncal.TenantID,
+		troncal.CostoMinuto, troncal.IncrementoInicial, troncal.Incremento, troncal.Capacidad, troncal.PAI, troncal.SIPHeaders, troncal.Attestation)
+	if err != nil {
+		return fmt.Errorf("error insertando troncal: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	troncal.ID = int(id)
+	return nil
+}
+
+// troncalColumns son las columnas que lee scanTroncal (t = apicall_troncales)
+const troncalColumns = `t.id, t.nombre, t.host, t.puerto, COALESCE(t.usuario, ''), COALESCE(t.password, ''), t.contexto, COALESCE(t.caller_id, ''), t.activo, t.tenant_id, t.costo_minuto, t.incremento_inicial, t.incremento, t.capacidad, t.pai, COALESCE(t.sip_headers, ''), t.attestation`
+
+func scanTroncal(row rowScanner) (*Troncal, error) {
+	var t Troncal
+	if err := row.Scan(&t.ID, &t.Nombre, &t.Host, &t.Puerto, &t.Usuario, &t.Password, &t.Contexto, &t.CallerID, &t.Activo, &t.TenantID, &t.CostoMinuto, &t.IncrementoInicial, &t.Incremento, &t.Capacidad, &t.PAI, &t.SIPHeaders, &t.Attestation); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func scanTroncales(rows *sql.Rows) ([]Troncal, error) {
+	var troncales []Troncal
+	for rows.Next() {
+		t, err := scanTroncal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando troncal: %w", err)
+		}
+		troncales = append(troncales, *t)
+	}
+	return troncales, rows.Err()
+}
+
+// ListTroncales devuelve todas las troncales
+func (r *Repository) ListTroncales() ([]Troncal, error) {
+	query := `SELECT ` + troncalColumns + ` FROM apicall_troncales t WHERE 1=1`
+	filter, args := r.tenantFilter("t.tenant_id", nil)
+	rows, err := r.conn.DB.Query(query+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando troncales: %w", err)
+	}
+	defer rows.Close()
+	return scanTroncales(rows)
+}
+
+// GetTroncal obtiene una troncal por ID
+func (r *Repository) GetTroncal(id int) (*Troncal, error) {
+	filter, args := r.tenantFilter("t.tenant_id", []interface{}{id})
+	t, err := scanTroncal(r.conn.DB.QueryRow(`SELECT `+troncalColumns+` FROM apicall_troncales t WHERE t.id = ?`+filter, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("troncal %d no encontrada", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando troncal: %w", err)
+	}
+	return t, nil
+}
+
+// UpdateTroncal actualiza los datos SIP, el estado, la tarifa y la capacidad de una troncal.
+// El nombre no cambia: lo referencian proyectos, campañas y logs. Una nueva tarifa solo afecta a
+// las llamadas que finalicen después: el costo de las ya tarifadas queda congelado.
+func (r *Repository) UpdateTroncal(t *Troncal) error {
+	password, err := secrets.Encrypt(t.Password)
+	if err != nil {
+		return fmt.Errorf("error cifrando secreto de troncal: %w", err)
+	}
+	if err := r.checkTroncalSecretWidth(password); err != nil {
+		return err
+	}
+	t.Password = password
+	filter, args := r.tenantFilter("tenant_id", []interface{}{
+		t.Host, t.Puerto, t.Usuario, t.Password, t.Contexto, t.CallerID, t.Activo,
+		t.CostoMinuto, t.IncrementoInicial, t.Incremento, t.Capacidad, t.PAI, t.SIPHeaders, t.Attestation, t.ID,
+	})
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_troncales
+		SET host = ?, puerto = ?, usuario = ?, password = ?, contexto = ?, caller_id = ?, activo = ?,
+		    costo_minuto = ?, incremento_inicial = ?, incremento = ?, capacidad = ?,
+		    pai = ?, sip_headers = ?, attestation = ?
+		WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error actualizando troncal: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetTroncal(t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTroncalPassword cambia el secreto SIP de una troncal
+func (r *Repository) UpdateTroncalPassword(id int, password string) error {
+	password, err := secrets.Encrypt(password)
+	if err != nil {
+		return fmt.Errorf("error cifrando secreto de troncal: %w", err)
+	}
+	if err := r.checkTroncalSecretWidth(password); err != nil {
+		return err
+	}
+	filter, args := r.tenantFilter("tenant_id", []interface{}{password, id})
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_troncales SET password = ? WHERE id = ?`+filter, args...); err != nil {
+		return fmt.Errorf("error actualizando secreto de troncal: %w", err)
+	}
+	return nil
+}
+
+// troncalSecretWidth devuelve el largo de la columna password de apicall_troncales (0 = sin límite conocido)
+func (r *Repository) troncalSecretWidth() (int, error) {
+	var width sql.NullInt64
+	err := r.conn.DB.QueryRow(`
+		SELECT CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'apicall_troncales' AND COLUMN_NAME = 'password'`).Scan(&width)
+	if err != nil {
+		return 0, fmt.Errorf("error consultando la columna de secretos de troncales: %w", err)
+	}
+	return int(width.Int64), nil
+}
+
+// checkTroncalSecretWidth rechaza secretos que no entran en la columna (sin modo estricto MariaDB los trunca)
+func (r *Repository) checkTroncalSecretWidth(password string) error {
+	if len(password) <= 100 {
+		return nil
+	}
+	width, err := r.troncalSecretWidth()
+	if err != nil {
+		return err
+	}
+	if width > 0 && len(password) > width {
+		return fmt.Errorf("el secreto de la troncal es demasiado largo (%d caracteres, máximo %d)", len(password), width)
+	}
+	return nil
+}
+
+// EncryptTroncalSecrets cifra los secretos SIP que siguen en texto plano (troncales creadas antes de
+// configurar security.secrets_key). Devuelve cuántos cifró.
+func (r *Repository) EncryptTroncalSecrets() (int, error) {
+	if !secrets.Enabled() {
+		return 0, nil
+	}
+	rows, err := r.conn.DB.Query(`SELECT id, password FROM apicall_troncales WHERE password IS NOT NULL AND password <> '' AND password NOT LIKE 'enc:%'`)
+	if err != nil {
+		return 0, fmt.Errorf("error consultando secretos de troncales: %w", err)
+	}
+	plain := map[int]string{}
+	for rows.Next() {
+		var id int
+		var password string
+		if err := rows.Scan(&id, &password); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain[id] = password
+	}
+	rows.Close()
+
+	// Cifrar todo antes de tocar filas: si la columna no admite el valor cifrado no se reescribe ninguna
+	width, err := r.troncalSecretWidth()
+	if err != nil {
+		return 0, err
+	}
+	encrypted := make(map[int]string, len(plain))
+	for id, password := range plain {
+		enc, err := secrets.Encrypt(password)
+		if err != nil {
+			return 0, err
+		}
+		if width > 0 && len(enc) > width {
+			return 0, fmt.Errorf("apicall_troncales.password es VARCHAR(%d) y el secreto cifrado de la troncal %d ocupa %d (¿falta la migración 061?)", width, id, len(enc))
+		}
+		encrypted[id] = enc
+	}
+
+	n := 0
+	for id, password := range plain {
+		enc := encrypted[id]
+		// Solo si no cambió mientras tanto
+		res, err := r.conn.DB.Exec(`UPDATE apicall_troncales SET password = ? WHERE id = ? AND password = ?`, enc, id, password)
+		if err != nil {
+			return n, fmt.Errorf("error cifrando secreto de troncal %d: %w", id, err)
+		}
+		if affected, _ := res.RowsAffected(); affected > 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetTroncalCapacidades devuelve la capacidad configurada de cada troncal por nombre
+func (r *Repository) GetTroncalCapacidades() (map[string]int, error) {
+	rows, err := r.conn.DB.Query(`SELECT nombre, capacidad FROM apicall_troncales`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando capacidad de troncales: %w", err)
+	}
+	defer rows.Close()
+
+	capacidades := make(map[string]int)
+	for rows.Next() {
+		var nombre string
+		var capacidad int
+		if err := rows.Scan(&nombre, &capacidad); err != nil {
+			return nil, fmt.Errorf("error escaneando troncal: %w", err)
+		}
+		capacidades[nombre] = capacidad
+	}
+	return capacidades, rows.Err()
+}
+
+// GetTroncalIdentities devuelve por nombre las troncales con identidad SIP configurada
+// (P-Asserted-Identity, headers propios o atestación STIR/SHAKEN)
+func (r *Repository) GetTroncalIdentities() (map[string]*Troncal, error) {
+	rows, err := r.conn.DB.Query(`SELECT ` + troncalColumns + ` FROM apicall_troncales t
+		WHERE t.pai OR COALESCE(t.sip_headers, '') <> '' OR t.attestation <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando identidad de troncales: %w", err)
+	}
+	defer rows.Close()
+
+	troncales, err := scanTroncales(rows)
+	if err != nil {
+		return nil, err
+	}
+	identities := make(map[string]*Troncal, len(troncales))
+	for i := range troncales {
+		identities[troncales[i].Nombre] = &troncales[i]
+	}
+	return identities, nil
+}
+
+// DeleteTroncal elimina una troncal
+func (r *Repository) DeleteTroncal(id int) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	_, err := r.conn.DB.Exec("DELETE FROM apicall_troncales WHERE id = ?"+filter, args...)
+	return err
+}
+
+// GetConfig obtiene un valor de configuración por clave (en caché durante CacheTTL)
+func (r *Repository) GetConfig(key string) (string, error) {
+	if value, ok := r.cache.configs.get(key); ok {
+		return value, nil
+	}
+	query := `SELECT config_value FROM apicall_config WHERE config_key = ?`
+	var value string
+	err := r.conn.DB.QueryRow(query, key).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	// Return empty string if not found, not error
+	r.cache.configs.set(key, value)
+	return value, nil
+}
+
+// SetConfig establece o actualiza un valor de configuración
+func (r *Repository) SetConfig(key, value, description string) error {
+	query := `
+		INSERT INTO apicall_config (config_key, config_value, description)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+			config_value = VALUES(config_value),
+			description = COALESCE(VALUES(description), description)
+	`
+	_, err := r.conn.DB.Exec(query, key, value, description)
+	r.cache.configs.delete(key)
+	return err
+}
+
+// Config represents a system configuration entry
 type Config struct {
 	ID          int    `db:"id" json:"id"`
 	Key         string `db:"config_key" json:"key"`
@@ -504,20 +1189,79 @@ func (r *Repository) ListConfigs() ([]Config, error) {
 	return configs, nil
 }
 
-// AssignTroncalToProyecto vincula una troncal a un proyecto
+// AssignTroncalToProyecto vincula una troncal a un proyecto.
+// Solo se vinculan proyecto y troncal de la misma organización.
 func (r *Repository) AssignTroncalToProyecto(proyectoID, troncalID int) error {
-	query := `INSERT IGNORE INTO apicall_proyecto_troncal (proyecto_id, troncal_id) VALUES (?, ?)`
-	_, err := r.conn.DB.Exec(query, proyectoID, troncalID)
-	return err
+	query := `
+		INSERT IGNORE INTO apicall_proyecto_troncal (proyecto_id, troncal_id)
+		SELECT p.id, t.id
+		FROM apicall_proyectos p
+		INNER JOIN apicall_troncales t ON t.tenant_id = p.tenant_id
+		WHERE p.id = ? AND t.id = ?
+	`
+	filter, args := r.tenantFilter("p.tenant_id", []interface{}{proyectoID, troncalID})
+	result, err := r.conn.DB.Exec(query+filter, args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		var linked int
+		r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_proyecto_troncal WHERE proyecto_id = ? AND troncal_id = ?`, proyectoID, troncalID).Scan(&linked)
+		if linked == 0 {
+			return fmt.Errorf("troncal %d no encontrada para el proyecto %d", troncalID, proyectoID)
+		}
+	}
+	return nil
 }
 
 // RemoveTroncalFromProyecto desvincula una troncal
 func (r *Repository) RemoveTroncalFromProyecto(proyectoID, troncalID int) error {
 	query := `DELETE FROM apicall_proyecto_troncal WHERE proyecto_id = ? AND troncal_id = ?`
-	_, err := r.conn.DB.Exec(query, proyectoID, troncalID)
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID, troncalID})
+	_, err := r.conn.DB.Exec(query+filter, args...)
 	return err
 }
 
+// ListTroncalesByProyecto devuelve las troncales asignadas a un proyecto (activas o no)
+func (r *Repository) ListTroncalesByProyecto(proyectoID int) ([]Troncal, error) {
+	query := `
+		SELECT ` + troncalColumns + `
+		FROM apicall_troncales t
+		JOIN apicall_proyecto_troncal pt ON t.id = pt.troncal_id
+		WHERE pt.proyecto_id = ?`
+	filter, args := r.tenantFilter("t.tenant_id", []interface{}{proyectoID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY t.nombre", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando troncales del proyecto: %w", err)
+	}
+	defer rows.Close()
+	return scanTroncales(rows)
+}
+
+// ListProyectosByTroncal devuelve los proyectos que tienen asignada una troncal
+func (r *Repository) ListProyectosByTroncal(troncalID int) ([]Proyecto, error) {
+	query := `
+		SELECT ` + proyectoColumns + `
+		FROM apicall_proyectos
+		WHERE id IN (SELECT proyecto_id FROM apicall_proyecto_troncal WHERE troncal_id = ?)`
+	filter, args := r.tenantFilter("tenant_id", []interface{}{troncalID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando proyectos de la troncal: %w", err)
+	}
+	defer rows.Close()
+
+	var proyectos []Proyecto
+	for rows.Next() {
+		p, err := scanProyecto(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando proyecto: %w", err)
+		}
+		proyectos = append(proyectos, *p)
+	}
+	return proyectos, rows.Err()
+}
+
 // GetTroncalesNamesByProyecto retorna los nombres de las troncales asignadas a un proyecto
 func (r *Repository) GetTroncalesNamesByProyecto(proyectoID int) ([]string, error) {
 	query := `
@@ -546,38 +1290,105 @@ func (r *Repository) GetTroncalesNamesByProyecto(proyectoID int) ([]string, erro
 // --- USER MANAGEMENT ---
 
 type User struct {
-	ID           int    `json:"id"`
-	Username     string `json:"username"`
-	PasswordHash string `json:"-"`
-	Role         string `json:"role"`
-	FullName     string `json:"full_name"`
-	Active       bool   `json:"active"`
+	ID                 int        `json:"id"`
+	TenantID           int        `json:"tenant_id"`
+	Username           string     `json:"username"`
+	PasswordHash       string     `json:"-"`
+	Role               string     `json:"role"`
+	FullName           string     `json:"full_name"`
+	Active             bool       `json:"active"`
+	FailedLogins       int        `json:"failed_logins"`
+	LockedAt           *time.Time `json:"locked_at"`
+	MustChangePassword bool       `json:"must_change_password"`
+	TOTPEnabled        bool       `json:"totp_enabled"` // Autenticación en dos pasos activa
+	AuthSource         string     `json:"auth_source"`  // local, ldap u oidc
 }
 
-func (r *Repository) GetUserByUsername(username string) (*User, error) {
-	query := `SELECT id, username, password_hash, role, full_name, active FROM users WHERE username = ?`
-	row := r.conn.DB.QueryRow(query, username)
+const userColumns = `id, tenant_id, username, password_hash, role, COALESCE(full_name, ''), active,
+		COALESCE(failed_logins, 0), locked_at, COALESCE(must_change_password, FALSE), COALESCE(totp_enabled, FALSE),
+		COALESCE(auth_source, 'local')`
 
+func scanUser(row rowScanner) (*User, error) {
 	var u User
-	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.FullName, &u.Active)
+	err := row.Scan(&u.ID, &u.TenantID, &u.Username, &u.PasswordHash, &u.Role, &u.FullName, &u.Active,
+		&u.FailedLogins, &u.LockedAt, &u.MustChangePassword, &u.TOTPEnabled, &u.AuthSource)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByUsername busca un usuario por nombre (usado en el login, no se acota por tenant)
+func (r *Repository) GetUserByUsername(username string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	u, err := scanUser(r.conn.DB.QueryRow(query, username))
 	if err == sql.ErrNoRows {
 		return nil, nil // Not found
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &u, nil
+	return u, nil
+}
+
+// GetUser obtiene un usuario por ID (acotado por tenant)
+func (r *Repository) GetUser(id int) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	u, err := scanUser(r.conn.DB.QueryRow(query+filter, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("usuario %d no encontrado", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando usuario: %w", err)
+	}
+	return u, nil
 }
 
 func (r *Repository) CreateUser(u *User) error {
-	query := `INSERT INTO users (username, password_hash, role, full_name) VALUES (?, ?, ?, ?)`
-	_, err := r.conn.DB.Exec(query, u.Username, u.PasswordHash, u.Role, u.FullName)
+	u.TenantID = r.tenantForInsert(u.TenantID)
+	query := `INSERT INTO users (username, password_hash, role, full_name, tenant_id, must_change_password) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := r.conn.DB.Exec(query, u.Username, u.PasswordHash, u.Role, u.FullName, u.TenantID, u.MustChangePassword)
 	return err
 }
 
+// SyncExternalUser crea o actualiza el usuario de un proveedor externo (LDAP/OIDC) en su login: el rol y el
+// nombre se sincronizan en cada ingreso. Un usuario local con el mismo nombre no se toca.
+// ErrAuthSourceConflict indica que el usuario ya existe con otro origen (por ejemplo, un usuario local)
+var ErrAuthSourceConflict = errors.New("el usuario ya existe con otro origen")
+
+func (r *Repository) SyncExternalUser(u *User) (*User, error) {
+	existing, err := r.GetUserByUsername(u.Username)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando usuario: %w", err)
+	}
+	if existing != nil {
+		if existing.AuthSource != u.AuthSource {
+			return nil, fmt.Errorf("%w: %s es %s", ErrAuthSourceConflict, u.Username, existing.AuthSource)
+		}
+		if _, err := r.conn.DB.Exec(`UPDATE users SET role = ?, full_name = ? WHERE id = ?`, u.Role, u.FullName, existing.ID); err != nil {
+			return nil, fmt.Errorf("error actualizando usuario: %w", err)
+		}
+		existing.Role, existing.FullName = u.Role, u.FullName
+		return existing, nil
+	}
+
+	// Sin contraseña local: "!" no es un hash bcrypt válido y nunca coincide
+	_, err = r.conn.DB.Exec(`
+		INSERT INTO users (username, password_hash, role, full_name, tenant_id, auth_source) VALUES (?, '!', ?, ?, ?, ?)
+	`, u.Username, u.Role, u.FullName, u.TenantID, u.AuthSource)
+	if err != nil {
+		return nil, fmt.Errorf("error creando usuario: %w", err)
+	}
+	return r.GetUserByUsername(u.Username)
+}
+
 func (r *Repository) ListUsers() ([]User, error) {
-	query := `SELECT id, username, role, full_name, active, created_at FROM users`
-	rows, err := r.conn.DB.Query(query)
+	query := `SELECT id, tenant_id, username, role, full_name, active, created_at,
+		COALESCE(failed_logins, 0), locked_at, COALESCE(must_change_password, FALSE), COALESCE(totp_enabled, FALSE),
+		COALESCE(auth_source, 'local') FROM users WHERE 1=1`
+	filter, args := r.tenantFilter("tenant_id", nil)
+	rows, err := r.conn.DB.Query(query+filter, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -587,7 +1398,8 @@ func (r *Repository) ListUsers() ([]User, error) {
 	for rows.Next() {
 		var u User
 		var createdAt string // Placeholder
-		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.FullName, &u.Active, &createdAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.TenantID, &u.Username, &u.Role, &u.FullName, &u.Active, &createdAt,
+			&u.FailedLogins, &u.LockedAt, &u.MustChangePassword, &u.TOTPEnabled, &u.AuthSource); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -596,27 +1408,497 @@ func (r *Repository) ListUsers() ([]User, error) {
 }
 
 func (r *Repository) DeleteUser(id int) error {
-	_, err := r.conn.DB.Exec("DELETE FROM users WHERE id = ?", id)
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	_, err := r.conn.DB.Exec("DELETE FROM users WHERE id = ?"+filter, args...)
 	return err
 }
 
-// --- BLACKLIST MANAGEMENT ---
+// IsUserLocked indica si la cuenta está bloqueada por intentos fallidos.
+// lockoutMinutes = 0 significa bloqueo hasta desbloqueo manual.
+func (r *Repository) IsUserLocked(id int, lockoutMinutes int) (bool, error) {
+	var locked bool
+	err := r.conn.DB.QueryRow(`
+		SELECT locked_at IS NOT NULL AND (? = 0 OR locked_at > NOW() - INTERVAL ? MINUTE)
+		FROM users WHERE id = ?
+	`, lockoutMinutes, lockoutMinutes, id).Scan(&locked)
+	if err != nil {
+		return false, fmt.Errorf("error consultando bloqueo: %w", err)
+	}
+	return locked, nil
+}
 
-// IsBlacklisted verifica si un número está bloqueado para un proyecto
-func (r *Repository) IsBlacklisted(proyectoID int, telefono string) (bool, error) {
-	query := `SELECT COUNT(*) FROM apicall_blacklist WHERE proyecto_id = ? AND telefono = ?`
-	var count int
-	err := r.conn.DB.QueryRow(query, proyectoID, telefono).Scan(&count)
+// RegisterFailedLogin suma un intento fallido y bloquea la cuenta al llegar a maxAttempts (0 = sin bloqueo).
+// Si el bloqueo anterior ya venció (lockoutMinutes, 0 = permanente) el contador vuelve a empezar.
+// Retorna true si la cuenta quedó bloqueada.
+func (r *Repository) RegisterFailedLogin(id int, maxAttempts int, lockoutMinutes int) (bool, error) {
+	// MySQL evalúa las asignaciones de izquierda a derecha: locked_at ve el contador ya incrementado,
+	// pero su propio valor anterior (el bloqueo vencido se limpia)
+	_, err := r.conn.DB.Exec(`
+		UPDATE users
+		SET failed_logins = IF(? > 0 AND locked_at IS NOT NULL AND locked_at <= NOW() - INTERVAL ? MINUTE, 1, COALESCE(failed_logins, 0) + 1),
+		    locked_at = IF(? > 0 AND failed_logins >= ?, NOW(),
+		                   IF(? > 0 AND locked_at IS NOT NULL AND locked_at <= NOW() - INTERVAL ? MINUTE, NULL, locked_at))
+		WHERE id = ?
+	`, lockoutMinutes, lockoutMinutes, maxAttempts, maxAttempts, lockoutMinutes, lockoutMinutes, id)
 	if err != nil {
+		return false, fmt.Errorf("error registrando intento fallido: %w", err)
+	}
+	if maxAttempts <= 0 {
+		return false, nil
+	}
+	var failed int
+	if err := r.conn.DB.QueryRow(`SELECT failed_logins FROM users WHERE id = ?`, id).Scan(&failed); err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	return failed >= maxAttempts, nil
+}
+
+// ResetFailedLogins limpia el contador de intentos y el bloqueo tras un login exitoso
+func (r *Repository) ResetFailedLogins(id int) error {
+	_, err := r.conn.DB.Exec(`UPDATE users SET failed_logins = 0, locked_at = NULL WHERE id = ?`, id)
+	return err
+}
+
+// UnlockUser desbloquea una cuenta (acotado por tenant)
+func (r *Repository) UnlockUser(id int) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	result, err := r.conn.DB.Exec(`UPDATE users SET failed_logins = 0, locked_at = NULL WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error desbloqueando usuario: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetUser(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateUserPassword cambia la contraseña y define si debe cambiarse en el próximo login
+func (r *Repository) UpdateUserPassword(id int, passwordHash string, mustChange bool) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{passwordHash, mustChange, id})
+	result, err := r.conn.DB.Exec(`
+		UPDATE users SET password_hash = ?, must_change_password = ?, password_changed_at = NOW()
+		WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error actualizando contraseña: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("usuario %d no encontrado", id)
+	}
+	return nil
+}
+
+// SetMustChangePassword obliga (o no) a cambiar la contraseña en el próximo login
+func (r *Repository) SetMustChangePassword(id int, mustChange bool) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{mustChange, id})
+	result, err := r.conn.DB.Exec(`UPDATE users SET must_change_password = ? WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error actualizando usuario: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetUser(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- TWO-FACTOR AUTHENTICATION ---
+
+// UserTOTP es la configuración de la autenticación en dos pasos de un usuario
+type UserTOTP struct {
+	Secret   string   // Vacío = sin configurar
+	Enabled  bool     // false con Secret = alta pendiente de confirmar
+	LastStep int64    // Último período usado
+	Recovery []string // Hashes de los códigos de recuperación sin usar
+}
+
+// GetUserTOTP obtiene la configuración TOTP de un usuario
+func (r *Repository) GetUserTOTP(id int) (*UserTOTP, error) {
+	var t UserTOTP
+	var recovery sql.NullString
+	err := r.conn.DB.QueryRow(`
+		SELECT totp_secret, totp_enabled, totp_last_step, totp_recovery FROM users WHERE id = ?
+	`, id).Scan(&t.Secret, &t.Enabled, &t.LastStep, &recovery)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("usuario %d no encontrado", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando autenticación en dos pasos: %w", err)
+	}
+	if recovery.String != "" {
+		t.Recovery = strings.Split(recovery.String, ",")
+	}
+	return &t, nil
+}
+
+// SetUserTOTPSecret registra un secreto pendiente de confirmar (reemplaza uno pendiente anterior)
+func (r *Repository) SetUserTOTPSecret(id int, secret string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE users SET totp_secret = ?, totp_last_step = 0, totp_recovery = NULL
+		WHERE id = ? AND totp_enabled = FALSE`, secret, id)
+	if err != nil {
+		return fmt.Errorf("error guardando secreto TOTP: %w", err)
+	}
+	return nil
+}
+
+// EnableUserTOTP activa la autenticación en dos pasos con el período que la confirmó y los códigos de recuperación
+func (r *Repository) EnableUserTOTP(id int, step int64, recovery []string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE users SET totp_enabled = TRUE, totp_last_step = ?, totp_recovery = ?
+		WHERE id = ? AND totp_secret <> ''`, step, strings.Join(recovery, ","), id)
+	if err != nil {
+		return fmt.Errorf("error activando autenticación en dos pasos: %w", err)
+	}
+	return nil
+}
+
+// DisableUserTOTP desactiva la autenticación en dos pasos y borra el secreto (acotado por tenant)
+func (r *Repository) DisableUserTOTP(id int) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	result, err := r.conn.DB.Exec(`
+		UPDATE users SET totp_enabled = FALSE, totp_secret = '', totp_last_step = 0, totp_recovery = NULL
+		WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error desactivando autenticación en dos pasos: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetUser(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseTOTPStep registra el período de un código aceptado. Retorna false si ya se usó ese período o uno
+// posterior (dos solicitudes simultáneas con el mismo código).
+func (r *Repository) UseTOTPStep(id int, step int64) (bool, error) {
+	result, err := r.conn.DB.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, id, step)
+	if err != nil {
+		return false, fmt.Errorf("error registrando código TOTP: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// UseRecoveryCode consume un código de recuperación (por su hash). Retorna false si no es válido.
+func (r *Repository) UseRecoveryCode(id int, hash string) (bool, error) {
+	t, err := r.GetUserTOTP(id)
+	if err != nil {
+		return false, err
+	}
+	remaining := make([]string, 0, len(t.Recovery))
+	found := false
+	for _, h := range t.Recovery {
+		if h == hash && !found {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return false, nil
+	}
+	// Solo se actualiza si nadie consumió otro código mientras tanto
+	result, err := r.conn.DB.Exec(`UPDATE users SET totp_recovery = ? WHERE id = ? AND totp_recovery = ?`,
+		strings.Join(remaining, ","), id, strings.Join(t.Recovery, ","))
+	if err != nil {
+		return false, fmt.Errorf("error registrando código de recuperación: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// SetRecoveryCodes reemplaza los códigos de recuperación de un usuario
+func (r *Repository) SetRecoveryCodes(id int, recovery []string) error {
+	_, err := r.conn.DB.Exec(`UPDATE users SET totp_recovery = ? WHERE id = ? AND totp_enabled = TRUE`, strings.Join(recovery, ","), id)
+	if err != nil {
+		return fmt.Errorf("error guardando códigos de recuperación: %w", err)
+	}
+	return nil
+}
+
+// --- USER SESSIONS ---
+
+// UserSession es una sesión iniciada (un login); sus tokens llevan el ID como jti
+type UserSession struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	TenantID   int        `json:"tenant_id"`
+	Username   string     `json:"username"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateUserSession registra una sesión y borra las vencidas del usuario
+func (r *Repository) CreateUserSession(sess *UserSession) error {
+	if len(sess.UserAgent) > 255 {
+		sess.UserAgent = sess.UserAgent[:255]
+	}
+	now := time.Now()
+	sess.CreatedAt, sess.LastSeenAt = now, now
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_user_sessions (id, user_id, tenant_id, ip, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, sess.ID, sess.UserID, sess.TenantID, sess.IP, sess.UserAgent, now, now, sess.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error creando sesión: %w", err)
+	}
+	r.conn.DB.Exec(`DELETE FROM apicall_user_sessions WHERE user_id = ? AND expires_at < ?`, sess.UserID, now)
+	return nil
+}
+
+// ListUserSessions lista las sesiones vigentes (no revocadas ni vencidas), de un usuario o de todos (userID = 0)
+func (r *Repository) ListUserSessions(userID int) ([]UserSession, error) {
+	query := `
+		SELECT s.id, s.user_id, s.tenant_id, COALESCE(u.username, ''), s.ip, s.user_agent,
+			s.created_at, s.last_seen_at, s.expires_at
+		FROM apicall_user_sessions s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.revoked_at IS NULL AND s.expires_at > ?`
+	args := []interface{}{time.Now()}
+	if userID != 0 {
+		query += ` AND s.user_id = ?`
+		args = append(args, userID)
+	}
+	filter, args := r.tenantFilter("s.tenant_id", args)
+	rows, err := r.conn.DB.Query(query+filter+` ORDER BY s.last_seen_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando sesiones: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []UserSession{}
+	for rows.Next() {
+		var sess UserSession
+		if err := rows.Scan(&sess.ID, &sess.UserID, &sess.TenantID, &sess.Username, &sess.IP, &sess.UserAgent,
+			&sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("error escaneando sesión: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// GetUserSession obtiene una sesión por ID (acotado por tenant); nil si no existe
+func (r *Repository) GetUserSession(id string) (*UserSession, error) {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	var sess UserSession
+	err := r.conn.DB.QueryRow(`
+		SELECT id, user_id, tenant_id, ip, user_agent, created_at, last_seen_at, expires_at, revoked_at
+		FROM apicall_user_sessions WHERE id = ?`+filter, args...).Scan(&sess.ID, &sess.UserID, &sess.TenantID,
+		&sess.IP, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt, &sess.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando sesión: %w", err)
+	}
+	return &sess, nil
+}
+
+// ExtendUserSession extiende el vencimiento de una sesión vigente al renovar su token.
+// Retorna false si la sesión no existe o fue revocada.
+func (r *Repository) ExtendUserSession(id string, expiresAt time.Time) (bool, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_user_sessions SET expires_at = ?, last_seen_at = ?
+		WHERE id = ? AND revoked_at IS NULL`, expiresAt, time.Now(), id)
+	if err != nil {
+		return false, fmt.Errorf("error renovando sesión: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// RevokeUserSession revoca una sesión (acotado por tenant). Retorna false si no existe o ya estaba revocada.
+func (r *Repository) RevokeUserSession(id string) (bool, error) {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{time.Now(), id})
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_user_sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`+filter, args...)
+	if err != nil {
+		return false, fmt.Errorf("error revocando sesión: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// RevokeUserSessions revoca todas las sesiones vigentes de un usuario (acotado por tenant) y devuelve sus IDs
+func (r *Repository) RevokeUserSessions(userID int) ([]string, error) {
+	now := time.Now()
+	filter, args := r.tenantFilter("tenant_id", []interface{}{userID, now})
+	rows, err := r.conn.DB.Query(`
+		SELECT id FROM apicall_user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando sesiones: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error escaneando sesión: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args = []interface{}{now}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_user_sessions SET revoked_at = ? WHERE revoked_at IS NULL AND id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("error revocando sesiones: %w", err)
+	}
+	return ids, nil
+}
+
+// RevokedSessions devuelve las sesiones revocadas cuyo token todavía no vence (sesión -> vencimiento).
+// Es la lista de revocación que consulta el middleware.
+func (r *Repository) RevokedSessions() (map[string]time.Time, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, expires_at FROM apicall_user_sessions
+		WHERE revoked_at IS NOT NULL AND expires_at > ?`, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error consultando sesiones revocadas: %w", err)
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var expires time.Time
+		if err := rows.Scan(&id, &expires); err != nil {
+			return nil, fmt.Errorf("error escaneando sesión: %w", err)
+		}
+		revoked[id] = expires
+	}
+	return revoked, rows.Err()
+}
+
+// TouchUserSessions registra la última actividad de las sesiones indicadas
+func (r *Repository) TouchUserSessions(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []interface{}{time.Now()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	_, err := r.conn.DB.Exec(`UPDATE apicall_user_sessions SET last_seen_at = ? WHERE id IN (`+placeholders+`)`, args...)
+	return err
+}
+
+// --- BLACKLIST MANAGEMENT ---
+
+// IsBlacklisted verifica si un número está bloqueado para un proyecto.
+// La blacklist del proyecto se mantiene en memoria durante CacheTTL (salvo las muy grandes).
+func (r *Repository) IsBlacklisted(proyectoID int, telefono string) (bool, error) {
+	set, ok := r.cache.blacklists.get(proyectoID)
+	if !ok {
+		var err error
+		if set, err = r.loadBlacklistSet(proyectoID); err != nil {
+			return false, err
+		}
+		r.cache.blacklists.set(proyectoID, set)
+	}
+	if set != nil {
+		_, blocked := set[telefono]
+		return blocked, nil
+	}
+
+	query := `SELECT COUNT(*) FROM apicall_blacklist WHERE proyecto_id = ? AND telefono = ?`
+	var count int
+	err := r.conn.DB.QueryRow(query, proyectoID, telefono).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// loadBlacklistSet carga los números bloqueados de un proyecto; devuelve nil si son más
+// de blacklistCacheMax
+func (r *Repository) loadBlacklistSet(proyectoID int) (map[string]struct{}, error) {
+	rows, err := r.conn.DB.Query(`SELECT telefono FROM apicall_blacklist WHERE proyecto_id = ? LIMIT ?`, proyectoID, blacklistCacheMax+1)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando blacklist: %w", err)
+	}
+	defer rows.Close()
+
+	set := make(map[string]struct{})
+	for rows.Next() {
+		var tel string
+		if err := rows.Scan(&tel); err != nil {
+			return nil, fmt.Errorf("error escaneando blacklist: %w", err)
+		}
+		set[tel] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error consultando blacklist: %w", err)
+	}
+	if len(set) > blacklistCacheMax {
+		return nil, nil
+	}
+	return set, nil
+}
+
+// GetBlacklistedSet devuelve cuáles de los números dados están bloqueados para un proyecto.
+// Consulta en bloques para evitar cláusulas IN gigantes.
+func (r *Repository) GetBlacklistedSet(proyectoID int, telefonos []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	const chunkSize = 500
+
+	for start := 0; start < len(telefonos); start += chunkSize {
+		end := start + chunkSize
+		if end > len(telefonos) {
+			end = len(telefonos)
+		}
+		chunk := telefonos[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)+1)
+		args = append(args, proyectoID)
+		for i, tel := range chunk {
+			placeholders[i] = "?"
+			args = append(args, tel)
+		}
+
+		query := fmt.Sprintf(`SELECT telefono FROM apicall_blacklist WHERE proyecto_id = ? AND telefono IN (%s)`,
+			strings.Join(placeholders, ","))
+		rows, err := r.conn.DB.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error consultando blacklist: %w", err)
+		}
+		for rows.Next() {
+			var tel string
+			if err := rows.Scan(&tel); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error escaneando blacklist: %w", err)
+			}
+			result[tel] = true
+		}
+		rows.Close()
+	}
+
+	return result, nil
 }
 
 // AddToBlacklist agrega un número a la lista negra
 func (r *Repository) AddToBlacklist(entry *BlacklistEntry) error {
 	query := `INSERT INTO apicall_blacklist (proyecto_id, telefono, razon) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE razon = VALUES(razon)`
 	_, err := r.conn.DB.Exec(query, entry.ProyectoID, entry.Telefono, entry.Razon)
+	r.cache.blacklists.delete(entry.ProyectoID)
 	return err
 }
 
@@ -653,13 +1935,63 @@ func (r *Repository) AddToBlacklistBulk(proyectoID int, telefonos []string) (int
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
+	r.cache.blacklists.delete(proyectoID)
 	return inserted, nil
 }
 
-// ListBlacklist lista los números bloqueados para un proyecto
-func (r *Repository) ListBlacklist(proyectoID int, limit int) ([]BlacklistEntry, error) {
-	query := `SELECT id, proyecto_id, telefono, razon, created_at FROM apicall_blacklist WHERE proyecto_id = ? ORDER BY created_at DESC LIMIT ?`
-	rows, err := r.conn.DB.Query(query, proyectoID, limit)
+// NormalizeBlacklist reescribe los números bloqueados del proyecto con normalize (p.ej. al formato
+// E.164 del país del proyecto). Si el número normalizado ya estaba bloqueado se elimina la entrada
+// anterior. Los números que normalize rechaza quedan como están. Devuelve cuántos cambiaron.
+func (r *Repository) NormalizeBlacklist(proyectoID int, normalize func(string) (string, error)) (int, error) {
+	rows, err := r.conn.DB.Query(`SELECT id, telefono FROM apicall_blacklist WHERE proyecto_id = ?`, proyectoID)
+	if err != nil {
+		return 0, fmt.Errorf("error consultando blacklist: %w", err)
+	}
+	type change struct {
+		id       int64
+		telefono string
+	}
+	var changes []change
+	for rows.Next() {
+		var c change
+		var tel string
+		if err := rows.Scan(&c.id, &tel); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error escaneando blacklist: %w", err)
+		}
+		if c.telefono, err = normalize(tel); err == nil && c.telefono != tel {
+			changes = append(changes, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error consultando blacklist: %w", err)
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	defer r.cache.blacklists.delete(proyectoID)
+	for i, c := range changes {
+		res, err := r.conn.DB.Exec(`UPDATE IGNORE apicall_blacklist SET telefono = ? WHERE id = ?`, c.telefono, c.id)
+		if err != nil {
+			return i, fmt.Errorf("error normalizando blacklist: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// Duplicado: el número normalizado ya está bloqueado
+			if _, err := r.conn.DB.Exec(`DELETE FROM apicall_blacklist WHERE id = ?`, c.id); err != nil {
+				return i, fmt.Errorf("error normalizando blacklist: %w", err)
+			}
+		}
+	}
+	return len(changes), nil
+}
+
+// ListBlacklist lista una página de los números bloqueados para un proyecto (más recientes primero)
+func (r *Repository) ListBlacklist(proyectoID int, limit, offset int) ([]BlacklistEntry, error) {
+	query := `SELECT id, proyecto_id, telefono, razon, created_at FROM apicall_blacklist WHERE proyecto_id = ?`
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("error consultando blacklist: %w", err)
 	}
@@ -678,139 +2010,456 @@ func (r *Repository) ListBlacklist(proyectoID int, limit int) ([]BlacklistEntry,
 
 // DeleteFromBlacklist elimina un número de la lista negra
 func (r *Repository) DeleteFromBlacklist(id int64) error {
-	_, err := r.conn.DB.Exec("DELETE FROM apicall_blacklist WHERE id = ?", id)
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+	_, err := r.conn.DB.Exec("DELETE FROM apicall_blacklist WHERE id = ?"+filter, args...)
+	// Sin el proyecto de la entrada se invalidan todas las blacklists
+	r.cache.blacklists.clear()
 	return err
 }
 
 // ClearBlacklist elimina todos los números bloqueados de un proyecto
 func (r *Repository) ClearBlacklist(proyectoID int) error {
-	_, err := r.conn.DB.Exec("DELETE FROM apicall_blacklist WHERE proyecto_id = ?", proyectoID)
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID})
+	_, err := r.conn.DB.Exec("DELETE FROM apicall_blacklist WHERE proyecto_id = ?"+filter, args...)
+	r.cache.blacklists.delete(proyectoID)
 	return err
 }
 
 // CountBlacklist cuenta los números bloqueados de un proyecto
 func (r *Repository) CountBlacklist(proyectoID int) (int, error) {
 	query := `SELECT COUNT(*) FROM apicall_blacklist WHERE proyecto_id = ?`
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID})
 	var count int
-	err := r.conn.DB.QueryRow(query, proyectoID).Scan(&count)
+	err := r.conn.DB.QueryRow(query+filter, args...).Scan(&count)
 	return count, err
 }
 
-// --- CAMPAIGN MANAGEMENT ---
+// --- BLACKLIST RULES ---
 
-// CreateCampaign crea una nueva campaña masiva
-func (r *Repository) CreateCampaign(c *Campaign) error {
-	query := `
-		INSERT INTO apicall_campaigns (nombre, proyecto_id, estado, total_contactos)
-		VALUES (?, ?, ?, ?)
-	`
-	res, err := r.conn.DB.Exec(query, c.Nombre, c.ProyectoID, c.Estado, c.TotalContactos)
+// blacklistRuleColumns es la lista de columnas usada por las consultas de reglas de blacklist
+const blacklistRuleColumns = `id, proyecto_id, tipo, valor, consecutivos, dnc, activo, created_at`
+
+// scanBlacklistRules escanea todas las filas de una consulta de reglas
+func scanBlacklistRules(rows *sql.Rows) ([]BlacklistRule, error) {
+	rules := make([]BlacklistRule, 0)
+	for rows.Next() {
+		var rule BlacklistRule
+		if err := rows.Scan(&rule.ID, &rule.ProyectoID, &rule.Tipo, &rule.Valor, &rule.Consecutivos,
+			&rule.DNC, &rule.Activo, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando regla de blacklist: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// ListBlacklistRules lista las reglas de blacklist automática de un proyecto
+func (r *Repository) ListBlacklistRules(proyectoID int) ([]BlacklistRule, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID})
+	rows, err := r.conn.DB.Query(`SELECT `+blacklistRuleColumns+` FROM apicall_blacklist_rules WHERE proyecto_id = ?`+filter+` ORDER BY id`, args...)
 	if err != nil {
-		return fmt.Errorf("error creando campaña: %w", err)
+		return nil, fmt.Errorf("error consultando reglas de blacklist: %w", err)
 	}
-	id, err := res.LastInsertId()
+	defer rows.Close()
+	return scanBlacklistRules(rows)
+}
+
+// GetActiveBlacklistRules devuelve las reglas activas de todos los proyectos (evaluador de reglas)
+func (r *Repository) GetActiveBlacklistRules() ([]BlacklistRule, error) {
+	rows, err := r.conn.DB.Query(`SELECT ` + blacklistRuleColumns + ` FROM apicall_blacklist_rules WHERE activo = TRUE`)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error consultando reglas de blacklist: %w", err)
 	}
-	c.ID = int(id)
-	return nil
+	defer rows.Close()
+	return scanBlacklistRules(rows)
 }
 
-// GetCampaign obtiene una campaña por ID
-func (r *Repository) GetCampaign(id int) (*Campaign, error) {
-	query := `
-		SELECT id, nombre, proyecto_id, estado, total_contactos, contactos_procesados,
-		       contactos_exitosos, contactos_fallidos, fecha_inicio, fecha_fin,
-		       created_at, updated_at
-		FROM apicall_campaigns
-		WHERE id = ?
-	`
-	var c Campaign
-	err := r.conn.DB.QueryRow(query, id).Scan(
-		&c.ID, &c.Nombre, &c.ProyectoID, &c.Estado, &c.TotalContactos,
-		&c.ContactosProcesados, &c.ContactosExitosos, &c.ContactosFallidos,
-		&c.FechaInicio, &c.FechaFin, &c.CreatedAt, &c.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("campaña %d no encontrada", id)
+// CreateBlacklistRule crea una regla de blacklist automática
+func (r *Repository) CreateBlacklistRule(rule *BlacklistRule) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_blacklist_rules (proyecto_id, tipo, valor, consecutivos, dnc, activo)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, rule.ProyectoID, rule.Tipo, rule.Valor, rule.Consecutivos, rule.DNC, rule.Activo)
+	if err != nil {
+		return fmt.Errorf("error creando regla de blacklist: %w", err)
 	}
+	id, err := res.LastInsertId()
 	if err != nil {
-		return nil, fmt.Errorf("error consultando campaña: %w", err)
+		return err
 	}
-	return &c, nil
+	rule.ID = int(id)
+	return nil
 }
 
-// ListCampaigns lista todas las campañas
-func (r *Repository) ListCampaigns() ([]Campaign, error) {
-	query := `
-		SELECT id, nombre, proyecto_id, estado, total_contactos, contactos_procesados,
-		       contactos_exitosos, contactos_fallidos, fecha_inicio, fecha_fin,
-		       created_at, updated_at
-		FROM apicall_campaigns
-		ORDER BY created_at DESC
-	`
-	rows, err := r.conn.DB.Query(query)
+// DeleteBlacklistRule elimina una regla de blacklist automática
+func (r *Repository) DeleteBlacklistRule(id int) error {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+	result, err := r.conn.DB.Exec("DELETE FROM apicall_blacklist_rules WHERE id = ?"+filter, args...)
 	if err != nil {
-		return nil, fmt.Errorf("error listando campañas: %w", err)
+		return fmt.Errorf("error eliminando regla de blacklist: %w", err)
 	}
-	defer rows.Close()
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("regla %d no encontrada", id)
+	}
+	return nil
+}
 
-	campaigns := make([]Campaign, 0)
+// --- NOTIFICATION CHANNELS ---
+
+// notificationChannelColumns es la lista de columnas usada por las consultas de canales de notificación
+const notificationChannelColumns = `id, proyecto_id, tipo, nombre, webhook_url, bot_token, chat_id, eventos, activo, created_at`
+
+// scanNotificationChannels escanea todas las filas de una consulta de canales
+func scanNotificationChannels(rows *sql.Rows) ([]NotificationChannel, error) {
+	channels := make([]NotificationChannel, 0)
 	for rows.Next() {
-		var c Campaign
-		err := rows.Scan(
-			&c.ID, &c.Nombre, &c.ProyectoID, &c.Estado, &c.TotalContactos,
-			&c.ContactosProcesados, &c.ContactosExitosos, &c.ContactosFallidos,
-			&c.FechaInicio, &c.FechaFin, &c.CreatedAt, &c.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error escaneando campaña: %w", err)
+		var ch NotificationChannel
+		if err := rows.Scan(&ch.ID, &ch.ProyectoID, &ch.Tipo, &ch.Nombre, &ch.WebhookURL, &ch.BotToken,
+			&ch.ChatID, &ch.Eventos, &ch.Activo, &ch.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando canal de notificación: %w", err)
 		}
-		campaigns = append(campaigns, c)
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// ListNotificationChannels lista los canales de notificación de un proyecto
+func (r *Repository) ListNotificationChannels(proyectoID int) ([]NotificationChannel, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{proyectoID})
+	rows, err := r.conn.DB.Query(`SELECT `+notificationChannelColumns+` FROM apicall_notification_channels WHERE proyecto_id = ?`+filter+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando canales de notificación: %w", err)
+	}
+	defer rows.Close()
+	return scanNotificationChannels(rows)
+}
+
+// GetActiveNotificationChannels devuelve los canales activos de un proyecto (envío de eventos)
+func (r *Repository) GetActiveNotificationChannels(proyectoID int) ([]NotificationChannel, error) {
+	rows, err := r.conn.DB.Query(`SELECT `+notificationChannelColumns+` FROM apicall_notification_channels WHERE proyecto_id = ? AND activo = TRUE`, proyectoID)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando canales de notificación: %w", err)
+	}
+	defer rows.Close()
+	return scanNotificationChannels(rows)
+}
+
+// GetNotificationChannel obtiene un canal de notificación por ID
+func (r *Repository) GetNotificationChannel(id int) (*NotificationChannel, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+	rows, err := r.conn.DB.Query(`SELECT `+notificationChannelColumns+` FROM apicall_notification_channels WHERE id = ?`+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando canal de notificación: %w", err)
+	}
+	defer rows.Close()
+	channels, err := scanNotificationChannels(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("canal %d no encontrado", id)
+	}
+	return &channels[0], nil
+}
+
+// CreateNotificationChannel crea un canal de notificación
+func (r *Repository) CreateNotificationChannel(ch *NotificationChannel) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_notification_channels (proyecto_id, tipo, nombre, webhook_url, bot_token, chat_id, eventos, activo)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, ch.ProyectoID, ch.Tipo, ch.Nombre, ch.WebhookURL, ch.BotToken, ch.ChatID, ch.Eventos, ch.Activo)
+	if err != nil {
+		return fmt.Errorf("error creando canal de notificación: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ch.ID = int(id)
+	return nil
+}
+
+// UpdateNotificationChannel actualiza un canal de notificación (el proyecto no cambia)
+func (r *Repository) UpdateNotificationChannel(ch *NotificationChannel) error {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{
+		ch.Tipo, ch.Nombre, ch.WebhookURL, ch.BotToken, ch.ChatID, ch.Eventos, ch.Activo, ch.ID,
+	})
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_notification_channels
+		SET tipo = ?, nombre = ?, webhook_url = ?, bot_token = ?, chat_id = ?, eventos = ?, activo = ?
+		WHERE id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error actualizando canal de notificación: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetNotificationChannel(ch.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteNotificationChannel elimina un canal de notificación
+func (r *Repository) DeleteNotificationChannel(id int) error {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+	result, err := r.conn.DB.Exec("DELETE FROM apicall_notification_channels WHERE id = ?"+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error eliminando canal de notificación: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("canal %d no encontrado", id)
+	}
+	return nil
+}
+
+// GetCallLog devuelve un log por ID
+func (r *Repository) GetCallLog(id int64) (*CallLog, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+	rows, err := r.conn.DB.Query(`SELECT `+callLogColumns+` FROM apicall_call_log WHERE id = ?`+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando log: %w", err)
+	}
+	defer rows.Close()
+	logs, err := scanCallLogs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, fmt.Errorf("log %d no encontrado", id)
+	}
+	return &logs[0], nil
+}
+
+// AddCallEvent agrega un evento al timeline de la llamada (escritura en lote, no bloquea)
+func (r *Repository) AddCallEvent(logID int64, evento, detalle string) {
+	r.AddCallEventAt(logID, evento, detalle, time.Now())
+}
+
+// AddCallEventAt agrega un evento ocurrido en at (ej: la entrada en la cola del spool)
+func (r *Repository) AddCallEventAt(logID int64, evento, detalle string, at time.Time) {
+	if logID <= 0 || r.events == nil {
+		return
+	}
+	r.events.Queue(CallEvent{LogID: logID, Evento: evento, Detalle: detalle, CreatedAt: at})
+}
+
+// GetCallEvents devuelve el timeline de la llamada en orden cronológico.
+// No aplica el filtro de organización: validar antes el log con GetCallLog.
+func (r *Repository) GetCallEvents(logID int64) ([]CallEvent, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, log_id, evento, detalle, created_at
+		FROM apicall_call_events
+		WHERE log_id = ?
+		ORDER BY created_at, id
+	`, logID)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando eventos de la llamada: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]CallEvent, 0)
+	for rows.Next() {
+		var e CallEvent
+		if err := rows.Scan(&e.ID, &e.LogID, &e.Evento, &e.Detalle, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando evento: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetCallLogsByIDs devuelve los logs indicados
+func (r *Repository) GetCallLogsByIDs(ids []int64) ([]CallLog, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := r.conn.DB.Query(`SELECT `+callLogColumns+` FROM apicall_call_log WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando logs: %w", err)
+	}
+	defer rows.Close()
+	return scanCallLogs(rows)
+}
+
+// GetLastFinishedCalls devuelve las últimas n llamadas finalizadas de un número en un proyecto,
+// de la más reciente a la más antigua (idx_proyecto_telefono)
+func (r *Repository) GetLastFinishedCalls(proyectoID int, telefono string, n int) ([]CallLog, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT `+callLogColumns+`
+		FROM apicall_call_log
+		WHERE proyecto_id = ? AND telefono = ? AND status NOT IN ('DIALING', 'CONNECTED')
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, proyectoID, telefono, n)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando llamadas del número: %w", err)
+	}
+	defer rows.Close()
+	return scanCallLogs(rows)
+}
+
+// SkipPendingContactsByPhone descarta un número en las campañas del proyecto que aún no lo marcaron
+// (baja voluntaria). Devuelve cuántos contactos se descartaron.
+func (r *Repository) SkipPendingContactsByPhone(proyectoID int, telefono, resultado string) (int64, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts cc
+		INNER JOIN apicall_campaigns c ON c.id = cc.campaign_id
+		SET cc.estado = 'skipped', cc.resultado = ?
+		WHERE c.proyecto_id = ? AND cc.telefono = ? AND cc.estado = 'pending'
+	`, resultado, proyectoID, telefono)
+	if err != nil {
+		return 0, fmt.Errorf("error descartando contactos del número: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// --- CAMPAIGN MANAGEMENT ---
+
+// campaignColumns es la lista de columnas usada por las consultas de campañas
+const campaignColumns = `id, nombre, proyecto_id, estado, total_contactos, contactos_procesados,
+		       contactos_exitosos, contactos_fallidos, fecha_inicio, fecha_fin,
+		       COALESCE(result_url, ''), COALESCE(ring_timeout, 0), COALESCE(prioridad, 1), COALESCE(troncales, ''),
+		       COALESCE(exit_min_asr, 0), COALESCE(exit_asr_window, 0), COALESCE(exit_daily_minutes, 0),
+		       COALESCE(exit_max_connects, 0), COALESCE(exit_dispositions, ''), COALESCE(exit_max_abandon, 0),
+		       COALESCE(exit_abandon_hours, 0), COALESCE(exit_reason, ''), COALESCE(summary_emails, ''), COALESCE(max_cps, 0), COALESCE(ramp_minutes, 0), COALESCE(ramp_start_cps, 0),
+		       ramp_started_at, start_at, end_at, recur_days, recur_time, recur_mode, recur_estados, recur_dispositions,
+		       recur_max, recur_count, recur_last_at, tenant_id, created_at, updated_at`
+
+// scanCampaign escanea una fila con el formato de campaignColumns
+func scanCampaign(row rowScanner) (*Campaign, error) {
+	var c Campaign
+	err := row.Scan(
+		&c.ID, &c.Nombre, &c.ProyectoID, &c.Estado, &c.TotalContactos,
+		&c.ContactosProcesados, &c.ContactosExitosos, &c.ContactosFallidos,
+		&c.FechaInicio, &c.FechaFin, &c.ResultURL, &c.RingTimeout, &c.Prioridad, &c.Troncales,
+		&c.ExitMinASR, &c.ExitASRWindow, &c.ExitDailyMinutes, &c.ExitMaxConnects, &c.ExitDispositions,
+		&c.ExitMaxAbandon, &c.ExitAbandonHours, &c.ExitReason, &c.SummaryEmails, &c.MaxCPS, &c.RampMinutes, &c.RampStartCPS, &c.RampStartedAt,
+		&c.StartAt, &c.EndAt, &c.RecurDays, &c.RecurTime, &c.RecurMode, &c.RecurEstados, &c.RecurDispositions,
+		&c.RecurMax, &c.RecurCount, &c.RecurLastAt, &c.TenantID, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// scanCampaigns escanea todas las filas de una consulta de campañas
+func scanCampaigns(rows *sql.Rows) ([]Campaign, error) {
+	campaigns := make([]Campaign, 0)
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando campaña: %w", err)
+		}
+		campaigns = append(campaigns, *c)
 	}
 	return campaigns, nil
 }
 
+// CreateCampaign crea una nueva campaña masiva.
+// La campaña hereda la organización de su proyecto, que debe ser visible para el repositorio.
+func (r *Repository) CreateCampaign(c *Campaign) error {
+	p, err := r.GetProyecto(c.ProyectoID)
+	if err != nil {
+		return err
+	}
+	c.TenantID = p.TenantID
+
+	query := `
+		INSERT INTO apicall_campaigns (nombre, proyecto_id, estado, total_contactos, result_url, ring_timeout, prioridad, troncales,
+			exit_min_asr, exit_asr_window, exit_daily_minutes, exit_max_connects, exit_dispositions, exit_max_abandon,
+			exit_abandon_hours, summary_emails, max_cps, ramp_minutes, ramp_start_cps, start_at, end_at, recur_days,
+			recur_time, recur_mode, recur_estados, recur_dispositions, recur_max, recur_count, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	res, err := r.conn.DB.Exec(query, c.Nombre, c.ProyectoID, c.Estado, c.TotalContactos, c.ResultURL, c.RingTimeout, c.Prioridad, c.Troncales,
+		c.ExitMinASR, c.ExitASRWindow, c.ExitDailyMinutes, c.ExitMaxConnects, c.ExitDispositions, c.ExitMaxAbandon,
+		c.ExitAbandonHours, c.SummaryEmails, c.MaxCPS, c.RampMinutes, c.RampStartCPS, c.StartAt, c.EndAt, c.RecurDays,
+		c.RecurTime, c.RecurMode, c.RecurEstados, c.RecurDispositions, c.RecurMax, c.RecurCount, c.TenantID)
+	if err != nil {
+		return fmt.Errorf("error creando campaña: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = int(id)
+	return nil
+}
+
+// GetCampaign obtiene una campaña por ID
+func (r *Repository) GetCampaign(id int) (*Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM apicall_campaigns
+		WHERE id = ?
+	`
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	c, err := scanCampaign(r.conn.DB.QueryRow(query+filter, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("campaña %d no encontrada", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando campaña: %w", err)
+	}
+	return c, nil
+}
+
+// ListCampaigns lista todas las campañas
+func (r *Repository) ListCampaigns() ([]Campaign, error) {
+	query := `
+		SELECT ` + campaignColumns + `
+		FROM apicall_campaigns
+		WHERE 1=1
+	`
+	filter, args := r.tenantFilter("tenant_id", nil)
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando campañas: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCampaigns(rows)
+}
+
 // ListCampaignsByProyecto lista campañas de un proyecto específico
 func (r *Repository) ListCampaignsByProyecto(proyectoID int) ([]Campaign, error) {
 	query := `
-		SELECT id, nombre, proyecto_id, estado, total_contactos, contactos_procesados,
-		       contactos_exitosos, contactos_fallidos, fecha_inicio, fecha_fin,
-		       created_at, updated_at
+		SELECT ` + campaignColumns + `
 		FROM apicall_campaigns
 		WHERE proyecto_id = ?
-		ORDER BY created_at DESC
 	`
-	rows, err := r.conn.DB.Query(query, proyectoID)
+	filter, args := r.tenantFilter("tenant_id", []interface{}{proyectoID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY created_at DESC", args...)
 	if err != nil {
 		return nil, fmt.Errorf("error listando campañas: %w", err)
 	}
 	defer rows.Close()
 
-	campaigns := make([]Campaign, 0)
-	for rows.Next() {
-		var c Campaign
-		err := rows.Scan(
-			&c.ID, &c.Nombre, &c.ProyectoID, &c.Estado, &c.TotalContactos,
-			&c.ContactosProcesados, &c.ContactosExitosos, &c.ContactosFallidos,
-			&c.FechaInicio, &c.FechaFin, &c.CreatedAt, &c.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error escaneando campaña: %w", err)
-		}
-		campaigns = append(campaigns, c)
-	}
-	return campaigns, nil
+	return scanCampaigns(rows)
 }
 
 // UpdateCampaign actualiza una campaña
 func (r *Repository) UpdateCampaign(c *Campaign) error {
 	query := `
 		UPDATE apicall_campaigns 
-		SET nombre = ?, estado = ?, updated_at = NOW()
+		SET nombre = ?, estado = ?, result_url = ?, ring_timeout = ?, prioridad = ?, troncales = NULLIF(?, ''),
+		    exit_min_asr = ?, exit_asr_window = ?, exit_daily_minutes = ?, exit_max_connects = ?, exit_dispositions = ?,
+		    exit_max_abandon = ?, exit_abandon_hours = ?, summary_emails = ?, max_cps = ?, ramp_minutes = ?, ramp_start_cps = ?, start_at = ?, end_at = ?,
+		    recur_days = ?, recur_time = ?, recur_mode = ?, recur_estados = ?, recur_dispositions = ?, recur_max = ?,
+		    recur_last_at = IF(recur_days = '', NULL, recur_last_at), updated_at = NOW()
 		WHERE id = ?
 	`
-	result, err := r.conn.DB.Exec(query, c.Nombre, c.Estado, c.ID)
+	filter, args := r.tenantFilter("tenant_id", []interface{}{c.Nombre, c.Estado, c.ResultURL, c.RingTimeout, c.Prioridad, c.Troncales,
+		c.ExitMinASR, c.ExitASRWindow, c.ExitDailyMinutes, c.ExitMaxConnects, c.ExitDispositions,
+		c.ExitMaxAbandon, c.ExitAbandonHours, c.SummaryEmails, c.MaxCPS, c.RampMinutes, c.RampStartCPS, c.StartAt, c.EndAt,
+		c.RecurDays, c.RecurTime, c.RecurMode, c.RecurEstados, c.RecurDispositions, c.RecurMax, c.ID})
+	result, err := r.conn.DB.Exec(query+filter, args...)
 	if err != nil {
 		return fmt.Errorf("error actualizando campaña: %w", err)
 	}
@@ -825,14 +2474,131 @@ func (r *Repository) UpdateCampaign(c *Campaign) error {
 func (r *Repository) UpdateCampaignStatus(id int, estado string) error {
 	query := `UPDATE apicall_campaigns SET estado = ?, updated_at = NOW() WHERE id = ?`
 	if estado == "active" {
-		query = `UPDATE apicall_campaigns SET estado = ?, fecha_inicio = COALESCE(fecha_inicio, NOW()), updated_at = NOW() WHERE id = ?`
+		query = `UPDATE apicall_campaigns SET estado = ?, fecha_inicio = COALESCE(fecha_inicio, NOW()), exit_reason = '', updated_at = NOW() WHERE id = ?`
 	} else if estado == "completed" || estado == "stopped" {
 		query = `UPDATE apicall_campaigns SET estado = ?, fecha_fin = NOW(), updated_at = NOW() WHERE id = ?`
 	}
-	_, err := r.conn.DB.Exec(query, estado, id)
+	filter, args := r.tenantFilter("tenant_id", []interface{}{estado, id})
+	_, err := r.conn.DB.Exec(query+filter, args...)
 	return err
 }
 
+// SetCampaignRampStart registra el inicio de la rampa de CPS de una campaña (nil = sin rampa en curso)
+func (r *Repository) SetCampaignRampStart(id int, at *time.Time) error {
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_campaigns SET ramp_started_at = ? WHERE id = ?`, at, id); err != nil {
+		return fmt.Errorf("error registrando rampa de campaña %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetDueCampaignStarts devuelve las campañas (de todas las organizaciones) cuyo inicio programado llegó:
+// draft o paused, con start_at <= now aún no aplicado y sin end_at vencido
+func (r *Repository) GetDueCampaignStarts(now time.Time) ([]Campaign, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT `+campaignColumns+`
+		FROM apicall_campaigns
+		WHERE start_at IS NOT NULL AND start_at <= ? AND estado IN ('draft', 'paused')
+		  AND (auto_started_at IS NULL OR auto_started_at < start_at)
+		  AND (end_at IS NULL OR end_at > ?)
+		ORDER BY start_at, id
+	`, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando inicios programados: %w", err)
+	}
+	defer rows.Close()
+	return scanCampaigns(rows)
+}
+
+// GetDueCampaignEnds devuelve las campañas activas o pausadas (de todas las organizaciones) cuyo end_at venció
+func (r *Repository) GetDueCampaignEnds(now time.Time) ([]Campaign, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT `+campaignColumns+`
+		FROM apicall_campaigns
+		WHERE end_at IS NOT NULL AND end_at <= ? AND estado IN ('active', 'paused')
+		ORDER BY end_at, id
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando fines programados: %w", err)
+	}
+	defer rows.Close()
+	return scanCampaigns(rows)
+}
+
+// AutoStartCampaign activa una campaña por su inicio programado y lo marca como aplicado.
+// Devuelve false si la campaña ya no estaba en draft o paused.
+func (r *Repository) AutoStartCampaign(id int, at time.Time) (bool, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaigns SET estado = 'active', fecha_inicio = COALESCE(fecha_inicio, NOW()), exit_reason = '',
+		       auto_started_at = ?, updated_at = NOW()
+		WHERE id = ? AND estado IN ('draft', 'paused')
+	`, at, id)
+	if err != nil {
+		return false, fmt.Errorf("error iniciando campaña %d: %w", id, err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// AutoEndCampaign completa una campaña por su fin programado.
+// Devuelve false si la campaña ya no estaba activa ni pausada.
+func (r *Repository) AutoEndCampaign(id int) (bool, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaigns SET estado = 'completed', fecha_fin = NOW(), updated_at = NOW()
+		WHERE id = ? AND estado IN ('active', 'paused')
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("error finalizando campaña %d: %w", id, err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// GetRecurringCampaigns devuelve las campañas recurrentes (de todas las organizaciones) activas o
+// completadas que no agotaron recur_max
+func (r *Repository) GetRecurringCampaigns() ([]Campaign, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT ` + campaignColumns + `
+		FROM apicall_campaigns
+		WHERE recur_days <> '' AND estado IN ('active', 'completed') AND (recur_max = 0 OR recur_count < recur_max)
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando campañas recurrentes: %w", err)
+	}
+	defer rows.Close()
+	return scanCampaigns(rows)
+}
+
+// SetCampaignRecurrence registra las recurrencias aplicadas y la última
+func (r *Repository) SetCampaignRecurrence(id, count int, at time.Time) error {
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_campaigns SET recur_count = ?, recur_last_at = ? WHERE id = ?`, count, at, id); err != nil {
+		return fmt.Errorf("error registrando recurrencia de campaña %d: %w", id, err)
+	}
+	return nil
+}
+
+// ClearCampaignRecurrence quita la recurrencia de una campaña (pasó a la copia con recur_mode=clone)
+func (r *Repository) ClearCampaignRecurrence(id int) error {
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_campaigns SET recur_days = '', recur_last_at = NULL WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("error quitando recurrencia de campaña %d: %w", id, err)
+	}
+	return nil
+}
+
+// ExitCampaign pausa una campaña activa por una regla de salida y guarda el motivo.
+// Devuelve false si la campaña ya no estaba activa (ej: la pausó un usuario).
+func (r *Repository) ExitCampaign(id int, reason string) (bool, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaigns SET estado = 'paused', exit_reason = ?, updated_at = NOW()
+		WHERE id = ? AND estado = 'active'
+	`, reason, id)
+	if err != nil {
+		return false, fmt.Errorf("error pausando campaña %d: %w", id, err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
 // UpdateCampaignStats actualiza las estadísticas de contactos procesados
 func (r *Repository) UpdateCampaignStats(id int, processed, success, failed int) error {
 	query := `
@@ -847,7 +2613,8 @@ func (r *Repository) UpdateCampaignStats(id int, processed, success, failed int)
 // DeleteCampaign elimina una campaña y sus contactos/schedules (cascade)
 func (r *Repository) DeleteCampaign(id int) error {
 	query := `DELETE FROM apicall_campaigns WHERE id = ?`
-	result, err := r.conn.DB.Exec(query, id)
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	result, err := r.conn.DB.Exec(query+filter, args...)
 	if err != nil {
 		return fmt.Errorf("error eliminando campaña: %w", err)
 	}
@@ -861,11 +2628,10 @@ func (r *Repository) DeleteCampaign(id int) error {
 // GetActiveCampaigns obtiene todas las campañas activas (para sweeper)
 func (r *Repository) GetActiveCampaigns() ([]Campaign, error) {
 	query := `
-		SELECT id, nombre, proyecto_id, estado, total_contactos, contactos_procesados,
-		       contactos_exitosos, contactos_fallidos, fecha_inicio, fecha_fin,
-		       created_at, updated_at
+		SELECT ` + campaignColumns + `
 		FROM apicall_campaigns
 		WHERE estado = 'active'
+		ORDER BY prioridad DESC, id
 	`
 	rows, err := r.conn.DB.Query(query)
 	if err != nil {
@@ -873,107 +2639,236 @@ func (r *Repository) GetActiveCampaigns() ([]Campaign, error) {
 	}
 	defer rows.Close()
 
-	campaigns := make([]Campaign, 0)
-	for rows.Next() {
-		var c Campaign
-		err := rows.Scan(
-			&c.ID, &c.Nombre, &c.ProyectoID, &c.Estado, &c.TotalContactos,
-			&c.ContactosProcesados, &c.ContactosExitosos, &c.ContactosFallidos,
-			&c.FechaInicio, &c.FechaFin, &c.CreatedAt, &c.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("error escaneando campaña: %w", err)
-		}
-		campaigns = append(campaigns, c)
-	}
-	return campaigns, nil
+	return scanCampaigns(rows)
 }
 
 // --- CAMPAIGN CONTACTS ---
 
-// CreateCampaignContactsBulk inserta contactos en batches de 1000
+// contactInsertBatch es el máximo de filas por INSERT multi-fila
+const contactInsertBatch = 1000
+
+// CreateCampaignContactsBulk inserta contactos con INSERTs multi-fila de contactInsertBatch filas.
+// Omite vacíos, repetidos en la lista y los que ya existen en la campaña; devuelve los insertados.
 func (r *Repository) CreateCampaignContactsBulk(campaignID int, telefonos []string) (int, error) {
-	if len(telefonos) == 0 {
+	seen := make(map[string]bool, len(telefonos))
+	unique := make([]string, 0, len(telefonos))
+	for _, tel := range telefonos {
+		if tel != "" && !seen[tel] {
+			seen[tel] = true
+			unique = append(unique, tel)
+		}
+	}
+	if len(unique) == 0 {
 		return 0, nil
 	}
 
-	const batchSize = 1000
-	inserted := 0
-
-	tx, err := r.conn.DB.Begin()
+	existing, err := r.GetExistingCampaignTelefonos(campaignID, unique)
 	if err != nil {
 		return 0, err
 	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(`INSERT INTO apicall_campaign_contacts (campaign_id, telefono, estado) VALUES (?, ?, 'pending')`)
-	if err != nil {
-		return 0, err
+	contacts := make([]CampaignContact, 0, len(unique))
+	for _, tel := range unique {
+		if !existing[tel] {
+			contacts = append(contacts, CampaignContact{Telefono: tel})
+		}
 	}
-	defer stmt.Close()
 
-	for i, tel := range telefonos {
-		if tel == "" {
-			continue
-		}
-		_, err := stmt.Exec(campaignID, tel)
+	inserted := 0
+	for start := 0; start < len(contacts); start += contactInsertBatch {
+		end := min(start+contactInsertBatch, len(contacts))
+		n, err := insertContactRows(r.conn.DB, campaignID, contacts[start:end])
+		inserted += n
 		if err != nil {
-			continue // Skip errors (duplicates, etc)
-		}
-		inserted++
-
-		// Commit in batches to avoid long transactions
-		if (i+1)%batchSize == 0 {
-			if err := tx.Commit(); err != nil {
-				return inserted, err
-			}
-			tx, err = r.conn.DB.Begin()
-			if err != nil {
-				return inserted, err
-			}
-			stmt, err = tx.Prepare(`INSERT INTO apicall_campaign_contacts (campaign_id, telefono, estado) VALUES (?, ?, 'pending')`)
-			if err != nil {
-				return inserted, err
-			}
+			return inserted, err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return inserted, err
-	}
-
 	// Update campaign total
-	r.conn.DB.Exec(`UPDATE apicall_campaigns SET total_contactos = ? WHERE id = ?`, inserted, campaignID)
+	r.RefreshCampaignTotal(campaignID)
 
 	return inserted, nil
 }
 
-// GetPendingContacts obtiene contactos pendientes para procesar
-func (r *Repository) GetPendingContacts(campaignID int, limit int) ([]CampaignContact, error) {
-	query := `
-		SELECT id, campaign_id, telefono, datos_adicionales, estado, intentos, ultimo_intento, resultado, created_at
-		FROM apicall_campaign_contacts
-		WHERE campaign_id = ? AND estado = 'pending'
-		ORDER BY id
-		LIMIT ?
-	`
-	rows, err := r.conn.DB.Query(query, campaignID, limit)
+// insertContactRows inserta los contactos en un solo INSERT multi-fila y devuelve las filas insertadas
+func insertContactRows(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, campaignID int, contacts []CampaignContact) (int, error) {
+	if len(contacts) == 0 {
+		return 0, nil
+	}
+	placeholders := make([]string, len(contacts))
+	args := make([]interface{}, 0, len(contacts)*6)
+	for i, c := range contacts {
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, 'pending')"
+		args = append(args, campaignID, c.Telefono, c.DatosAdicionales, c.VentanaInicio, c.VentanaFin, c.VentanaTZ)
+	}
+
+	res, err := db.Exec(`INSERT INTO apicall_campaign_contacts (campaign_id, telefono, datos_adicionales, ventana_inicio, ventana_fin, ventana_tz, estado) VALUES `+
+		strings.Join(placeholders, ", "), args...)
+	if err != nil {
+		return 0, fmt.Errorf("error insertando contactos: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// GetExistingCampaignTelefonos devuelve cuáles de los números ya existen en la campaña
+func (r *Repository) GetExistingCampaignTelefonos(campaignID int, telefonos []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	const chunkSize = 500
+
+	for start := 0; start < len(telefonos); start += chunkSize {
+		end := start + chunkSize
+		if end > len(telefonos) {
+			end = len(telefonos)
+		}
+		chunk := telefonos[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)+1)
+		args = append(args, campaignID)
+		for i, tel := range chunk {
+			placeholders[i] = "?"
+			args = append(args, tel)
+		}
+
+		query := fmt.Sprintf(`SELECT telefono FROM apicall_campaign_contacts WHERE campaign_id = ? AND telefono IN (%s)`,
+			strings.Join(placeholders, ","))
+		rows, err := r.conn.DB.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("error consultando contactos existentes: %w", err)
+		}
+		for rows.Next() {
+			var tel string
+			if err := rows.Scan(&tel); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error escaneando contacto: %w", err)
+			}
+			result[tel] = true
+		}
+		rows.Close()
+	}
+
+	return result, nil
+}
+
+// InsertCampaignContacts inserta contactos con datos adicionales (una transacción por llamada,
+// INSERTs multi-fila de contactInsertBatch filas)
+func (r *Repository) InsertCampaignContacts(campaignID int, contacts []CampaignContact) (int, error) {
+	if len(contacts) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted := 0
+	for start := 0; start < len(contacts); start += contactInsertBatch {
+		end := min(start+contactInsertBatch, len(contacts))
+		n, err := insertContactRows(tx, campaignID, contacts[start:end])
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// RefreshCampaignTotal recalcula total_contactos a partir de los contactos existentes
+func (r *Repository) RefreshCampaignTotal(campaignID int) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaigns
+		SET total_contactos = (SELECT COUNT(*) FROM apicall_campaign_contacts WHERE campaign_id = ?)
+		WHERE id = ?
+	`, campaignID, campaignID)
+	return err
+}
+
+// ClaimFilter restringe por hora local los contactos que reclama ClaimPendingContacts
+type ClaimFilter struct {
+	LocalTimes map[string]string // Hora local actual "HH:MM:SS" por zona ("" = la del proyecto)
+	LocalHours bool              // El proyecto tiene horario_local: solo contactos con zona_local en OpenZones
+	OpenZones  []string          // Zonas dentro del horario local del proyecto
+}
+
+// ClaimPendingContacts reclama hasta limit contactos pendientes y los deja en 'dialing' en una
+// transacción. FOR UPDATE SKIP LOCKED evita que dos sweepers (o una pareja HA durante el traspaso)
+// tomen las mismas filas: cada uno salta las que el otro tiene bloqueadas. Los contactos con franja
+// solo se reclaman dentro de ella, y con horario local solo los de zonas abiertas.
+func (r *Repository) ClaimPendingContacts(campaignID int, limit int, f ClaimFilter) ([]CampaignContact, error) {
+	if f.LocalHours && len(f.OpenZones) == 0 {
+		return []CampaignContact{}, nil
+	}
+
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	window, args := contactWindowOpen(f.LocalTimes, []interface{}{campaignID})
+	if f.LocalHours {
+		window += " AND zona_local IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.OpenZones)), ",") + ")"
+		for _, zone := range f.OpenZones {
+			args = append(args, zone)
+		}
+	}
+	rows, err := tx.Query(`
+		SELECT id, campaign_id, telefono, datos_adicionales, estado, intentos, ultimo_intento, resultado,
+		       ventana_inicio, ventana_fin, ventana_tz, zona_local, created_at
+		FROM apicall_campaign_contacts
+		WHERE campaign_id = ? AND estado = 'pending' AND `+window+`
+		ORDER BY id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("error consultando contactos: %w", err)
 	}
-	defer rows.Close()
 
 	contacts := make([]CampaignContact, 0)
+	ids := make([]interface{}, 0)
 	for rows.Next() {
 		var c CampaignContact
 		err := rows.Scan(
 			&c.ID, &c.CampaignID, &c.Telefono, &c.DatosAdicionales,
-			&c.Estado, &c.Intentos, &c.UltimoIntento, &c.Resultado, &c.CreatedAt,
+			&c.Estado, &c.Intentos, &c.UltimoIntento, &c.Resultado,
+			&c.VentanaInicio, &c.VentanaFin, &c.VentanaTZ, &c.ZonaLocal, &c.CreatedAt,
 		)
 		if err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("error escaneando contacto: %w", err)
 		}
 		contacts = append(contacts, c)
+		ids = append(ids, c.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error consultando contactos: %w", err)
+	}
+	if len(contacts) == 0 {
+		return contacts, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	if _, err := tx.Exec(`UPDATE apicall_campaign_contacts SET estado = 'dialing', ultimo_intento = NOW() WHERE id IN (`+placeholders+`)`, ids...); err != nil {
+		return nil, fmt.Errorf("error reclamando contactos: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error confirmando contactos reclamados: %w", err)
+	}
+
+	now := time.Now()
+	for i := range contacts {
+		contacts[i].Estado = "dialing"
+		contacts[i].UltimoIntento = &now
 	}
 	return contacts, nil
 }
@@ -985,22 +2880,15 @@ func (r *Repository) UpdateContactStatus(id int64, estado string, resultado *str
 	return err
 }
 
-// MarkContactDialing marca un contacto como "dialing"
-func (r *Repository) MarkContactDialing(id int64) error {
-	query := `UPDATE apicall_campaign_contacts SET estado = 'dialing', ultimo_intento = NOW() WHERE id = ?`
-	_, err := r.conn.DB.Exec(query, id)
-	return err
-}
-
 // CountContactsByStatus cuenta contactos por estado
 func (r *Repository) CountContactsByStatus(campaignID int) (map[string]int, error) {
 	query := `
 		SELECT estado, COUNT(*) as cnt
 		FROM apicall_campaign_contacts
 		WHERE campaign_id = ?
-		GROUP BY estado
 	`
-	rows, err := r.conn.DB.Query(query, campaignID)
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+	rows, err := r.conn.DB.Query(query+filter+" GROUP BY estado", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1037,9 +2925,9 @@ func (r *Repository) GetCampaignSchedules(campaignID int) ([]CampaignSchedule, e
 		SELECT id, campaign_id, dia_semana, hora_inicio, hora_fin, activo, created_at
 		FROM apicall_campaign_schedules
 		WHERE campaign_id = ?
-		ORDER BY dia_semana
 	`
-	rows, err := r.conn.DB.Query(query, campaignID)
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY dia_semana", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1058,6 +2946,10 @@ func (r *Repository) GetCampaignSchedules(campaignID int) ([]CampaignSchedule, e
 
 // UpdateCampaignSchedules reemplaza todos los schedules de una campaña
 func (r *Repository) UpdateCampaignSchedules(campaignID int, schedules []CampaignSchedule) error {
+	if _, err := r.GetCampaign(campaignID); err != nil {
+		return err
+	}
+
 	tx, err := r.conn.DB.Begin()
 	if err != nil {
 		return err
@@ -1093,21 +2985,239 @@ func (r *Repository) UpdateCampaignSchedules(campaignID int, schedules []Campaig
 // IsWithinSchedule verifica si la hora actual está dentro del horario de la campaña
 func (r *Repository) IsWithinSchedule(campaignID int) (bool, error) {
 	// MySQL: DAYOFWEEK returns 1=Sunday, 2=Monday, etc. We need to map to our 0=Sunday format
+	// Los feriados del proyecto o de su organización cierran el horario todo el día
 	query := `
 		SELECT COUNT(*) FROM apicall_campaign_schedules
 		WHERE campaign_id = ?
 		  AND activo = TRUE
 		  AND dia_semana = (DAYOFWEEK(NOW()) - 1)
 		  AND CURTIME() BETWEEN hora_inicio AND hora_fin
+		  AND NOT EXISTS (
+		      SELECT 1 FROM apicall_holidays h JOIN apicall_campaigns c ON c.id = ?
+		      WHERE ` + holidayToday + `
+		  )
 	`
 	var count int
-	err := r.conn.DB.QueryRow(query, campaignID).Scan(&count)
+	err := r.conn.DB.QueryRow(query, campaignID, campaignID).Scan(&count)
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
+// --- HOLIDAYS ---
+
+// holidayColumns es la lista de columnas usada por las consultas de feriados
+const holidayColumns = `h.id, h.tenant_id, h.proyecto_id, DATE_FORMAT(h.fecha, '%Y-%m-%d'), h.nombre, h.anual, h.created_at`
+
+// holidayToday es la condición de un feriado h que cae hoy y aplica a la campaña c
+const holidayToday = `h.tenant_id = c.tenant_id AND h.proyecto_id IN (0, c.proyecto_id)
+		  AND (h.fecha = CURDATE() OR (h.anual AND MONTH(h.fecha) = MONTH(CURDATE()) AND DAY(h.fecha) = DAY(CURDATE())))`
+
+// scanHolidays escanea todas las filas de una consulta de feriados
+func scanHolidays(rows *sql.Rows) ([]Holiday, error) {
+	holidays := make([]Holiday, 0)
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.ID, &h.TenantID, &h.ProyectoID, &h.Fecha, &h.Nombre, &h.Anual, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando feriado: %w", err)
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// ListHolidays lista los feriados visibles; con proyectoID > 0 solo los que aplican al proyecto
+// (los suyos y los de toda su organización)
+func (r *Repository) ListHolidays(proyectoID int) ([]Holiday, error) {
+	query := `SELECT ` + holidayColumns + ` FROM apicall_holidays h WHERE 1=1`
+	var args []interface{}
+	if proyectoID > 0 {
+		p, err := r.GetProyecto(proyectoID)
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND h.tenant_id = ? AND h.proyecto_id IN (0, ?)`
+		args = append(args, p.TenantID, p.ID)
+	}
+	filter, args := r.tenantFilter("h.tenant_id", args)
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY h.fecha, h.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando feriados: %w", err)
+	}
+	defer rows.Close()
+	return scanHolidays(rows)
+}
+
+// GetCampaignHolidayToday devuelve el feriado de hoy que detiene la campaña (nil si no hay)
+func (r *Repository) GetCampaignHolidayToday(campaignID int) (*Holiday, error) {
+	query := `SELECT ` + holidayColumns + ` FROM apicall_holidays h JOIN apicall_campaigns c ON c.id = ? WHERE ` + holidayToday
+	filter, args := r.tenantFilter("c.tenant_id", []interface{}{campaignID})
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY h.proyecto_id DESC LIMIT 1", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando feriados: %w", err)
+	}
+	defer rows.Close()
+	holidays, err := scanHolidays(rows)
+	if err != nil || len(holidays) == 0 {
+		return nil, err
+	}
+	return &holidays[0], nil
+}
+
+// SaveHolidays crea los feriados; si la fecha ya existe para el mismo proyecto u organización
+// actualiza su nombre y si es anual. Los de un proyecto toman la organización del proyecto, que debe
+// ser visible para el repositorio.
+func (r *Repository) SaveHolidays(holidays []Holiday) error {
+	for i := range holidays {
+		h := &holidays[i]
+		if h.ProyectoID > 0 {
+			p, err := r.GetProyecto(h.ProyectoID)
+			if err != nil {
+				return err
+			}
+			h.TenantID = p.TenantID
+		} else {
+			h.TenantID = r.tenantForInsert(h.TenantID)
+		}
+	}
+
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO apicall_holidays (tenant_id, proyecto_id, fecha, nombre, anual)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE nombre = VALUES(nombre), anual = VALUES(anual), id = LAST_INSERT_ID(id)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := range holidays {
+		h := &holidays[i]
+		res, err := stmt.Exec(h.TenantID, h.ProyectoID, h.Fecha, h.Nombre, h.Anual)
+		if err != nil {
+			return fmt.Errorf("error guardando feriado %s: %w", h.Fecha, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		h.ID = int(id)
+	}
+	return tx.Commit()
+}
+
+// DeleteHoliday elimina un feriado
+func (r *Repository) DeleteHoliday(id int) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{id})
+	result, err := r.conn.DB.Exec("DELETE FROM apicall_holidays WHERE id = ?"+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error eliminando feriado: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("feriado %d no encontrado", id)
+	}
+	return nil
+}
+
+// --- PREFIX TIMEZONES ---
+
+// ListPrefixTimezones lista la tabla de zonas horarias por prefijo
+func (r *Repository) ListPrefixTimezones() ([]PrefixTimezone, error) {
+	rows, err := r.conn.DB.Query(`SELECT prefijo, timezone, descripcion, created_at FROM apicall_prefix_timezones ORDER BY prefijo`)
+	if err != nil {
+		return nil, fmt.Errorf("error listando zonas por prefijo: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]PrefixTimezone, 0)
+	for rows.Next() {
+		var pt PrefixTimezone
+		if err := rows.Scan(&pt.Prefijo, &pt.Timezone, &pt.Descripcion, &pt.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando zona por prefijo: %w", err)
+		}
+		list = append(list, pt)
+	}
+	return list, rows.Err()
+}
+
+// SavePrefixTimezones crea o actualiza prefijos y vuelve a asignar la zona de los contactos pendientes
+func (r *Repository) SavePrefixTimezones(list []PrefixTimezone) error {
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO apicall_prefix_timezones (prefijo, timezone, descripcion) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE timezone = VALUES(timezone), descripcion = VALUES(descripcion)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, pt := range list {
+		if _, err := stmt.Exec(pt.Prefijo, pt.Timezone, pt.Descripcion); err != nil {
+			return fmt.Errorf("error guardando prefijo %s: %w", pt.Prefijo, err)
+		}
+	}
+	if err := resetContactZones(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeletePrefixTimezone elimina un prefijo y vuelve a asignar la zona de los contactos pendientes
+func (r *Repository) DeletePrefixTimezone(prefijo string) error {
+	result, err := r.conn.DB.Exec(`DELETE FROM apicall_prefix_timezones WHERE prefijo = ?`, prefijo)
+	if err != nil {
+		return fmt.Errorf("error eliminando prefijo: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("prefijo %s no encontrado", prefijo)
+	}
+	return resetContactZones(r.conn.DB)
+}
+
+// resetContactZones borra la zona asignada a los contactos pendientes: el Sweeper la recalcula con la tabla vigente
+func resetContactZones(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}) error {
+	if _, err := db.Exec(`UPDATE apicall_campaign_contacts SET zona_local = NULL WHERE estado = 'pending' AND zona_local IS NOT NULL`); err != nil {
+		return fmt.Errorf("error reiniciando zonas de contactos: %w", err)
+	}
+	return nil
+}
+
+// AssignContactZones asigna a hasta limit contactos pendientes sin zona la de su prefijo más largo
+// ('' = sin prefijo en la tabla, se usa la del proyecto). Devuelve los contactos asignados.
+func (r *Repository) AssignContactZones(campaignID, limit int) (int, error) {
+	result, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts cc
+		SET cc.zona_local = COALESCE((
+			SELECT pt.timezone FROM apicall_prefix_timezones pt
+			WHERE cc.telefono LIKE CONCAT(pt.prefijo, '%')
+			ORDER BY LENGTH(pt.prefijo) DESC
+			LIMIT 1
+		), '')
+		WHERE cc.campaign_id = ? AND cc.estado = 'pending' AND cc.zona_local IS NULL
+		LIMIT ?
+	`, campaignID, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error asignando zonas de contactos: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
 // --- CAMPAIGN RECYCLING ---
 
 // DispositionCount representa el conteo de contactos por resultado
@@ -1122,10 +3232,9 @@ func (r *Repository) CountContactsByResultado(campaignID int) ([]DispositionCoun
 		SELECT COALESCE(resultado, 'PENDING') as resultado, COUNT(*) as cnt
 		FROM apicall_campaign_contacts
 		WHERE campaign_id = ?
-		GROUP BY resultado
-		ORDER BY cnt DESC
 	`
-	rows, err := r.conn.DB.Query(query, campaignID)
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+	rows, err := r.conn.DB.Query(query+filter+" GROUP BY resultado ORDER BY cnt DESC", args...)
 	if err != nil {
 		return nil, fmt.Errorf("error contando contactos por resultado: %w", err)
 	}
@@ -1147,6 +3256,11 @@ func (r *Repository) RecycleCampaignContacts(sourceCampaignID, targetCampaignID
 	if len(resultados) == 0 {
 		return 0, nil
 	}
+	for _, id := range []int{sourceCampaignID, targetCampaignID} {
+		if _, err := r.GetCampaign(id); err != nil {
+			return 0, err
+		}
+	}
 
 	// Construir placeholders para IN clause
 	placeholders := ""
@@ -1161,8 +3275,8 @@ func (r *Repository) RecycleCampaignContacts(sourceCampaignID, targetCampaignID
 	}
 
 	query := fmt.Sprintf(`
-		INSERT INTO apicall_campaign_contacts (campaign_id, telefono, datos_adicionales, estado)
-		SELECT ?, telefono, datos_adicionales, 'pending'
+		INSERT INTO apicall_campaign_contacts (campaign_id, telefono, datos_adicionales, ventana_inicio, ventana_fin, ventana_tz, estado)
+		SELECT ?, telefono, datos_adicionales, ventana_inicio, ventana_fin, ventana_tz, 'pending'
 		FROM apicall_campaign_contacts
 		WHERE campaign_id = ? AND COALESCE(resultado, 'PENDING') IN (%s)
 	`, placeholders)
@@ -1179,3 +3293,2398 @@ func (r *Repository) RecycleCampaignContacts(sourceCampaignID, targetCampaignID
 
 	return int(inserted), nil
 }
+
+// CopyCampaignContacts copia a targetCampaignID, como pendientes, los contactos de la campaña origen
+// que cumplen el filtro (recurrencias con recur_mode=clone). Devuelve los contactos copiados.
+func (r *Repository) CopyCampaignContacts(sourceCampaignID, targetCampaignID int, f ContactFilter) (int, error) {
+	where, args := f.where([]interface{}{targetCampaignID, sourceCampaignID})
+	result, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_campaign_contacts (campaign_id, telefono, datos_adicionales, ventana_inicio, ventana_fin, ventana_tz, estado)
+		SELECT ?, telefono, datos_adicionales, ventana_inicio, ventana_fin, ventana_tz, 'pending'
+		FROM apicall_campaign_contacts
+		WHERE campaign_id = ?`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error copiando contactos: %w", err)
+	}
+	copied, _ := result.RowsAffected()
+	r.conn.DB.Exec(`UPDATE apicall_campaigns SET total_contactos = ? WHERE id = ?`, copied, targetCampaignID)
+	return int(copied), nil
+}
+
+// --- CONTACT ACTIONS ---
+
+// ContactFilter selecciona contactos de una campaña; los criterios no vacíos se combinan con AND
+type ContactFilter struct {
+	IDs        []int64  `json:"contact_ids"`
+	Telefonos  []string `json:"telefonos"`
+	Estados    []string `json:"estados"`
+	Resultados []string `json:"resultados"` // Disposición (PENDING = sin resultado)
+}
+
+// Empty indica que el filtro no restringe nada
+func (f ContactFilter) Empty() bool {
+	return len(f.IDs) == 0 && len(f.Telefonos) == 0 && len(f.Estados) == 0 && len(f.Resultados) == 0
+}
+
+// where arma las condiciones del filtro (con " AND " inicial)
+func (f ContactFilter) where(args []interface{}) (string, []interface{}) {
+	var sb strings.Builder
+	in := func(column string, n int) {
+		if n > 0 {
+			sb.WriteString(" AND " + column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")")
+		}
+	}
+	in("id", len(f.IDs))
+	for _, id := range f.IDs {
+		args = append(args, id)
+	}
+	in("telefono", len(f.Telefonos))
+	for _, t := range f.Telefonos {
+		args = append(args, t)
+	}
+	in("estado", len(f.Estados))
+	for _, e := range f.Estados {
+		args = append(args, e)
+	}
+	in("COALESCE(resultado, 'PENDING')", len(f.Resultados))
+	for _, res := range f.Resultados {
+		args = append(args, res)
+	}
+	return sb.String(), args
+}
+
+// ListCampaignContacts lista contactos de una campaña que cumplen el filtro (paginado por id). Con
+// afterID > 0 (cursor: último id de la página anterior) la página empieza después de ese contacto y
+// se ignora offset. El total es el de todo el filtro.
+func (r *Repository) ListCampaignContacts(campaignID int, f ContactFilter, limit, offset int, afterID int64) ([]CampaignContact, int, error) {
+	where, args := f.where([]interface{}{campaignID})
+	filter, args := r.campaignFilter("campaign_id", args)
+	where = " WHERE campaign_id = ?" + where + filter
+
+	var total int
+	if err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_campaign_contacts`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error contando contactos: %w", err)
+	}
+
+	if afterID > 0 {
+		where += " AND id > ?"
+		args = append(args, afterID)
+		offset = 0
+	}
+	rows, err := r.conn.DB.Query(`
+		SELECT id, campaign_id, telefono, datos_adicionales, estado, intentos, ultimo_intento, resultado,
+		       ventana_inicio, ventana_fin, ventana_tz, zona_local, created_at
+		FROM apicall_campaign_contacts`+where+` ORDER BY id LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error listando contactos: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := make([]CampaignContact, 0)
+	for rows.Next() {
+		var c CampaignContact
+		err := rows.Scan(
+			&c.ID, &c.CampaignID, &c.Telefono, &c.DatosAdicionales,
+			&c.Estado, &c.Intentos, &c.UltimoIntento, &c.Resultado,
+			&c.VentanaInicio, &c.VentanaFin, &c.VentanaTZ, &c.ZonaLocal, &c.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error escaneando contacto: %w", err)
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, total, nil
+}
+
+// GetCampaignContact obtiene un contacto de campaña por id
+func (r *Repository) GetCampaignContact(id int64) (*CampaignContact, error) {
+	filter, args := r.campaignFilter("campaign_id", []interface{}{id})
+	var c CampaignContact
+	err := r.conn.DB.QueryRow(`
+		SELECT id, campaign_id, telefono, datos_adicionales, estado, intentos, ultimo_intento, resultado,
+		       ventana_inicio, ventana_fin, ventana_tz, zona_local, created_at
+		FROM apicall_campaign_contacts WHERE id = ?`+filter, args...).Scan(
+		&c.ID, &c.CampaignID, &c.Telefono, &c.DatosAdicionales,
+		&c.Estado, &c.Intentos, &c.UltimoIntento, &c.Resultado,
+		&c.VentanaInicio, &c.VentanaFin, &c.VentanaTZ, &c.ZonaLocal, &c.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("contacto %d no encontrado", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando contacto: %w", err)
+	}
+	return &c, nil
+}
+
+// GetContactCallLogs devuelve todos los intentos de llamada de un contacto de campaña, del más
+// antiguo al más reciente (idx_contact). Los logs anteriores a contact_id no tienen el vínculo.
+func (r *Repository) GetContactCallLogs(contactID int64) ([]CallLog, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{contactID})
+	rows, err := r.conn.DB.Query(`SELECT `+callLogColumns+` FROM apicall_call_log WHERE contact_id = ?`+filter+
+		` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando llamadas del contacto: %w", err)
+	}
+	defer rows.Close()
+	return scanCallLogs(rows)
+}
+
+// MoveContacts pasa a estado to los contactos de la campaña que cumplen el filtro y están en
+// alguno de los estados from. Al volver a pending se limpian el resultado y la entrega al result_url
+// (los intentos se conservan como historial). Devuelve los contactos afectados.
+func (r *Repository) MoveContacts(campaignID int, from []string, to string, f ContactFilter) (int, error) {
+	if _, err := r.GetCampaign(campaignID); err != nil {
+		return 0, err
+	}
+
+	set := "estado = ?"
+	if to == "pending" {
+		set += ", resultado = NULL, notified_at = NULL, notify_attempts = 0, notify_next_at = NULL"
+	}
+	args := []interface{}{to, campaignID}
+	for _, estado := range from {
+		args = append(args, estado)
+	}
+	where, args := f.where(args)
+
+	query := `UPDATE apicall_campaign_contacts SET ` + set + ` WHERE campaign_id = ?` +
+		` AND estado IN (` + strings.TrimSuffix(strings.Repeat("?,", len(from)), ",") + `)` + where
+	result, err := r.conn.DB.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error actualizando contactos: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return int(affected), nil
+}
+
+// SetContactWindow asigna la franja preferida (inicio y fin "HH:MM:SS", zona IANA opcional) a los
+// contactos pendientes de la campaña que cumplen el filtro; nil la quita. Devuelve los afectados.
+func (r *Repository) SetContactWindow(campaignID int, inicio, fin, zona *string, f ContactFilter) (int, error) {
+	if _, err := r.GetCampaign(campaignID); err != nil {
+		return 0, err
+	}
+
+	where, args := f.where([]interface{}{inicio, fin, zona, campaignID})
+	result, err := r.conn.DB.Exec(`UPDATE apicall_campaign_contacts SET ventana_inicio = ?, ventana_fin = ?, ventana_tz = ?
+		WHERE campaign_id = ? AND estado = 'pending'`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error actualizando franja de contactos: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return int(affected), nil
+}
+
+// GetContactZones devuelve las zonas horarias de las franjas y de los prefijos de los contactos
+// pendientes de la campaña ("" = la del proyecto)
+func (r *Repository) GetContactZones(campaignID int) ([]string, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT DISTINCT COALESCE(ventana_tz, '') FROM apicall_campaign_contacts
+		WHERE campaign_id = ? AND estado = 'pending' AND ventana_inicio IS NOT NULL
+		UNION
+		SELECT DISTINCT zona_local FROM apicall_campaign_contacts
+		WHERE campaign_id = ? AND estado = 'pending' AND zona_local IS NOT NULL
+	`, campaignID, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando zonas de franjas: %w", err)
+	}
+	defer rows.Close()
+
+	var zones []string
+	for rows.Next() {
+		var z string
+		if err := rows.Scan(&z); err != nil {
+			return nil, fmt.Errorf("error escaneando zona: %w", err)
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// contactWindowOpen arma la condición "sin franja o dentro de ella" con la hora local de cada zona.
+// Una franja con fin menor que el inicio cruza la medianoche (ej: 20:00-02:00).
+func contactWindowOpen(localTimes map[string]string, args []interface{}) (string, []interface{}) {
+	conds := []string{"ventana_inicio IS NULL", "ventana_fin IS NULL"}
+	for zone, t := range localTimes {
+		conds = append(conds, `(COALESCE(ventana_tz, '') = ? AND CASE WHEN ventana_inicio <= ventana_fin
+			THEN CAST(? AS TIME) >= ventana_inicio AND CAST(? AS TIME) < ventana_fin
+			ELSE CAST(? AS TIME) >= ventana_inicio OR CAST(? AS TIME) < ventana_fin END)`)
+		args = append(args, zone, t, t, t, t)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// --- IMPORT JOBS ---
+
+const importJobColumns = `id, campaign_id, filename, file_path, mapping, estado, total_rows, processed_rows,
+		inserted, duplicates, blacklisted, invalid, suppress_active, suppress_days, suppressed_active, suppressed_recent,
+		errors, error_message, created_at, started_at, finished_at`
+
+func scanImportJob(row rowScanner) (*ImportJob, error) {
+	var j ImportJob
+	err := row.Scan(
+		&j.ID, &j.CampaignID, &j.Filename, &j.FilePath, &j.Mapping, &j.Estado, &j.TotalRows, &j.ProcessedRows,
+		&j.Inserted, &j.Duplicates, &j.Blacklisted, &j.Invalid, &j.SuppressActive, &j.SuppressDays,
+		&j.SuppressedActive, &j.SuppressedRecent, &j.Errors, &j.ErrorMessage,
+		&j.CreatedAt, &j.StartedAt, &j.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// CreateImportJob registra un nuevo job de importación en estado pending
+func (r *Repository) CreateImportJob(j *ImportJob) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_import_jobs (campaign_id, filename, file_path, mapping, suppress_active, suppress_days, estado)
+		VALUES (?, ?, ?, ?, ?, ?, 'pending')
+	`, j.CampaignID, j.Filename, j.FilePath, j.Mapping, j.SuppressActive, j.SuppressDays)
+	if err != nil {
+		return fmt.Errorf("error creando job de importación: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	j.ID = id
+	j.Estado = "pending"
+	return nil
+}
+
+// GetImportJob obtiene un job de importación por ID
+func (r *Repository) GetImportJob(id int64) (*ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM apicall_import_jobs WHERE id = ?`
+	filter, args := r.campaignFilter("campaign_id", []interface{}{id})
+	j, err := scanImportJob(r.conn.DB.QueryRow(query+filter, args...))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("import %d no encontrado", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando import: %w", err)
+	}
+	return j, nil
+}
+
+// ListImportJobs lista los jobs de importación (opcionalmente por campaña)
+func (r *Repository) ListImportJobs(campaignID int, limit int) ([]ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM apicall_import_jobs WHERE 1=1`
+	filter, args := r.campaignFilter("campaign_id", nil)
+	query += filter
+	if campaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, campaignID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando imports: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]ImportJob, 0)
+	for rows.Next() {
+		j, err := scanImportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando import: %w", err)
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, nil
+}
+
+// ClaimNextImportJob toma el job pendiente más antiguo y lo marca como running.
+// Retorna nil si no hay jobs pendientes.
+func (r *Repository) ClaimNextImportJob() (*ImportJob, error) {
+	for {
+		var id int64
+		err := r.conn.DB.QueryRow(`SELECT id FROM apicall_import_jobs WHERE estado = 'pending' ORDER BY id LIMIT 1`).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error buscando imports pendientes: %w", err)
+		}
+
+		res, err := r.conn.DB.Exec(`
+			UPDATE apicall_import_jobs
+			SET estado = 'running', started_at = NOW(), processed_rows = 0, inserted = 0,
+			    duplicates = 0, blacklisted = 0, invalid = 0, suppressed_active = 0, suppressed_recent = 0
+			WHERE id = ? AND estado = 'pending'
+		`, id)
+		if err != nil {
+			return nil, fmt.Errorf("error tomando import %d: %w", id, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // Otro worker lo tomó primero
+		}
+		return r.GetImportJob(id)
+	}
+}
+
+// UpdateImportJobProgress guarda el progreso de un job en ejecución
+func (r *Repository) UpdateImportJobProgress(j *ImportJob) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_import_jobs
+		SET total_rows = ?, processed_rows = ?, inserted = ?, duplicates = ?, blacklisted = ?, invalid = ?,
+		    suppressed_active = ?, suppressed_recent = ?, errors = ?
+		WHERE id = ?
+	`, j.TotalRows, j.ProcessedRows, j.Inserted, j.Duplicates, j.Blacklisted, j.Invalid,
+		j.SuppressedActive, j.SuppressedRecent, j.Errors, j.ID)
+	return err
+}
+
+// FinishImportJob marca un job como completed o failed
+func (r *Repository) FinishImportJob(id int64, estado string, errorMessage *string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_import_jobs SET estado = ?, error_message = ?, finished_at = NOW() WHERE id = ?
+	`, estado, errorMessage, id)
+	return err
+}
+
+// ResetRunningImportJobs devuelve a pending los jobs interrumpidos (p.ej. por un reinicio).
+// Reprocesar es seguro porque la importación deduplica contra la campaña.
+func (r *Repository) ResetRunningImportJobs() (int64, error) {
+	res, err := r.conn.DB.Exec(`UPDATE apicall_import_jobs SET estado = 'pending' WHERE estado = 'running'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// --- CONTACT SOURCES ---
+
+const contactSourceColumns = `campaign_id, url, formato, headers, records_path, phone_column, name_column, fields,
+		paginacion, page_param, page_size_param, page_size, next_path, max_pages, interval_minutes,
+		suppress_active, suppress_days, activo, last_run_at, last_import_id, last_error, created_at`
+
+func scanContactSource(row rowScanner) (*ContactSource, error) {
+	var s ContactSource
+	var headers sql.NullString
+	err := row.Scan(
+		&s.CampaignID, &s.URL, &s.Formato, &headers, &s.RecordsPath, &s.PhoneColumn, &s.NameColumn, &s.Fields,
+		&s.Paginacion, &s.PageParam, &s.PageSizeParam, &s.PageSize, &s.NextPath, &s.MaxPages, &s.IntervalMinutes,
+		&s.SuppressActive, &s.SuppressDays, &s.Activo, &s.LastRunAt, &s.LastImportID, &s.LastError, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if headers.Valid && headers.String != "" {
+		if err := json.Unmarshal([]byte(headers.String), &s.Headers); err != nil {
+			return nil, fmt.Errorf("headers inválidos en el origen de la campaña %d: %w", s.CampaignID, err)
+		}
+	}
+	return &s, nil
+}
+
+// GetContactSource obtiene el origen de contactos de una campaña (nil si no tiene)
+func (r *Repository) GetContactSource(campaignID int) (*ContactSource, error) {
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+	s, err := scanContactSource(r.conn.DB.QueryRow(`SELECT `+contactSourceColumns+` FROM apicall_contact_sources WHERE campaign_id = ?`+filter, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando origen de contactos: %w", err)
+	}
+	return s, nil
+}
+
+// SaveContactSource crea o reemplaza el origen de contactos de una campaña (conserva la última ejecución)
+func (r *Repository) SaveContactSource(s *ContactSource) error {
+	var headers *string
+	if len(s.Headers) > 0 {
+		data, err := json.Marshal(s.Headers)
+		if err != nil {
+			return fmt.Errorf("error serializando headers: %w", err)
+		}
+		h := string(data)
+		headers = &h
+	}
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_contact_sources (campaign_id, url, formato, headers, records_path, phone_column, name_column,
+			fields, paginacion, page_param, page_size_param, page_size, next_path, max_pages, interval_minutes,
+			suppress_active, suppress_days, activo)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE url = VALUES(url), formato = VALUES(formato), headers = VALUES(headers),
+			records_path = VALUES(records_path), phone_column = VALUES(phone_column), name_column = VALUES(name_column),
+			fields = VALUES(fields), paginacion = VALUES(paginacion), page_param = VALUES(page_param),
+			page_size_param = VALUES(page_size_param), page_size = VALUES(page_size), next_path = VALUES(next_path),
+			max_pages = VALUES(max_pages), interval_minutes = VALUES(interval_minutes),
+			suppress_active = VALUES(suppress_active), suppress_days = VALUES(suppress_days), activo = VALUES(activo)
+	`, s.CampaignID, s.URL, s.Formato, headers, s.RecordsPath, s.PhoneColumn, s.NameColumn,
+		s.Fields, s.Paginacion, s.PageParam, s.PageSizeParam, s.PageSize, s.NextPath, s.MaxPages, s.IntervalMinutes,
+		s.SuppressActive, s.SuppressDays, s.Activo)
+	if err != nil {
+		return fmt.Errorf("error guardando origen de contactos: %w", err)
+	}
+	return nil
+}
+
+// DeleteContactSource elimina el origen de contactos de una campaña
+func (r *Repository) DeleteContactSource(campaignID int) error {
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+	result, err := r.conn.DB.Exec(`DELETE FROM apicall_contact_sources WHERE campaign_id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error eliminando origen de contactos: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("la campaña %d no tiene origen de contactos", campaignID)
+	}
+	return nil
+}
+
+// GetDueContactSources devuelve los orígenes activos con consulta periódica vencida, de campañas que
+// todavía pueden recibir contactos (draft, active o paused)
+func (r *Repository) GetDueContactSources() ([]ContactSource, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT ` + contactSourceColumns + `
+		FROM apicall_contact_sources
+		WHERE activo = TRUE AND interval_minutes > 0
+		  AND (last_run_at IS NULL OR last_run_at <= NOW() - INTERVAL interval_minutes MINUTE)
+		  AND campaign_id IN (SELECT id FROM apicall_campaigns WHERE estado IN ('draft', 'active', 'paused'))
+		ORDER BY last_run_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando orígenes de contactos: %w", err)
+	}
+	defer rows.Close()
+
+	sources := make([]ContactSource, 0)
+	for rows.Next() {
+		s, err := scanContactSource(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando origen de contactos: %w", err)
+		}
+		sources = append(sources, *s)
+	}
+	return sources, rows.Err()
+}
+
+// SetContactSourceRun registra la última consulta del origen: el import generado (nil si no hubo
+// registros o falló) y el error
+func (r *Repository) SetContactSourceRun(campaignID int, at time.Time, importID *int64, lastError string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_contact_sources SET last_run_at = ?, last_import_id = COALESCE(?, last_import_id), last_error = ?
+		WHERE campaign_id = ?
+	`, at, importID, truncateUTF8(lastError, 500), campaignID)
+	if err != nil {
+		return fmt.Errorf("error registrando consulta del origen de la campaña %d: %w", campaignID, err)
+	}
+	return nil
+}
+
+// GetActiveCampaignTelefonos devuelve cuáles de los números ya están en otra campaña activa del proyecto
+func (r *Repository) GetActiveCampaignTelefonos(proyectoID, excludeCampaignID int, telefonos []string) (map[string]bool, error) {
+	return r.telefonoSet(`
+		SELECT DISTINCT cc.telefono FROM apicall_campaign_contacts cc
+		INNER JOIN apicall_campaigns c ON c.id = cc.campaign_id
+		WHERE c.proyecto_id = ? AND c.estado = 'active' AND c.id <> ? AND cc.telefono IN (%s)
+	`, []interface{}{proyectoID, excludeCampaignID}, telefonos)
+}
+
+// GetRecentlyCalledSet devuelve cuáles de los números fueron llamados por el proyecto desde since
+func (r *Repository) GetRecentlyCalledSet(proyectoID int, since time.Time, telefonos []string) (map[string]bool, error) {
+	return r.telefonoSet(`
+		SELECT DISTINCT telefono FROM apicall_call_log
+		WHERE proyecto_id = ? AND created_at >= ? AND telefono IN (%s)
+	`, []interface{}{proyectoID, since}, telefonos)
+}
+
+// telefonoSet ejecuta query (con un %s para la lista IN) en bloques de 500 números y
+// devuelve el conjunto de teléfonos encontrados
+func (r *Repository) telefonoSet(query string, params []interface{}, telefonos []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	const chunkSize = 500
+
+	for start := 0; start < len(telefonos); start += chunkSize {
+		chunk := telefonos[start:min(start+chunkSize, len(telefonos))]
+
+		args := append([]interface{}{}, params...)
+		for _, tel := range chunk {
+			args = append(args, tel)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+
+		rows, err := r.conn.DB.Query(fmt.Sprintf(query, placeholders), args...)
+		if err != nil {
+			return nil, fmt.Errorf("error consultando teléfonos: %w", err)
+		}
+		for rows.Next() {
+			var tel string
+			if err := rows.Scan(&tel); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error escaneando teléfono: %w", err)
+			}
+			result[tel] = true
+		}
+		rows.Close()
+	}
+
+	return result, nil
+}
+
+// ==========================================
+// RESULT WEBHOOK
+// ==========================================
+
+// GetPendingContactResults devuelve contactos en estado final cuya campaña tiene result_url
+// y que todavía no fueron entregados (respetando el backoff de reintentos)
+func (r *Repository) GetPendingContactResults(maxAttempts, limit int) ([]ContactResult, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT cc.id, cc.campaign_id, cc.telefono, cc.datos_adicionales, cc.estado, cc.intentos,
+		       cc.ultimo_intento, cc.resultado, cc.created_at,
+		       c.result_url, c.proyecto_id, COALESCE(cc.notify_attempts, 0)
+		FROM apicall_campaign_contacts cc
+		INNER JOIN apicall_campaigns c ON c.id = cc.campaign_id
+		WHERE c.result_url <> ''
+		  AND cc.estado IN ('completed', 'failed', 'skipped')
+		  AND cc.notified_at IS NULL
+		  AND COALESCE(cc.notify_attempts, 0) < ?
+		  AND (cc.notify_next_at IS NULL OR cc.notify_next_at <= NOW())
+		ORDER BY cc.id ASC
+		LIMIT ?
+	`, maxAttempts, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo resultados pendientes: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]ContactResult, 0)
+	for rows.Next() {
+		var res ContactResult
+		c := &res.Contact
+		if err := rows.Scan(
+			&c.ID, &c.CampaignID, &c.Telefono, &c.DatosAdicionales, &c.Estado, &c.Intentos,
+			&c.UltimoIntento, &c.Resultado, &c.CreatedAt,
+			&res.ResultURL, &res.ProyectoID, &res.NotifyAttempts,
+		); err != nil {
+			return nil, fmt.Errorf("error escaneando resultado: %w", err)
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+// GetLastCallLogForContact devuelve la última llamada de un contacto de campaña (nil si no hay)
+func (r *Repository) GetLastCallLogForContact(campaignID int, telefono string) (*CallLog, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT `+callLogColumns+`
+		FROM apicall_call_log
+		WHERE campaign_id = ? AND telefono = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, campaignID, telefono)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo última llamada: %w", err)
+	}
+	defer rows.Close()
+
+	logs, err := scanCallLogs(rows)
+	if err != nil || len(logs) == 0 {
+		return nil, err
+	}
+	return &logs[0], nil
+}
+
+// MarkContactNotified registra la entrega del resultado de un contacto
+func (r *Repository) MarkContactNotified(contactID int64) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts
+		SET notified_at = NOW(), notify_attempts = COALESCE(notify_attempts, 0) + 1
+		WHERE id = ?
+	`, contactID)
+	return err
+}
+
+// DeferContactNotification registra un intento fallido y programa el siguiente
+func (r *Repository) DeferContactNotification(contactID int64, retryIn time.Duration) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_campaign_contacts
+		SET notify_attempts = COALESCE(notify_attempts, 0) + 1,
+		    notify_next_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE id = ?
+	`, int(retryIn.Seconds()), contactID)
+	return err
+}
+
+// ==========================================
+// CALLBACKS
+// ==========================================
+
+// CreateCallback registra una solicitud de rellamada
+func (r *Repository) CreateCallback(cb *Callback) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_callbacks (proyecto_id, campaign_id, contact_id, telefono, original_log_id, window_start, window_end)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, cb.ProyectoID, cb.CampaignID, cb.ContactID, cb.Telefono, cb.OriginalLogID, cb.WindowStart, cb.WindowEnd)
+	if err != nil {
+		return fmt.Errorf("error creando rellamada: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	cb.ID = id
+	cb.Estado = "pending"
+	return nil
+}
+
+// GetDueCallbacks devuelve rellamadas pendientes cuya ventana está abierta en now
+func (r *Repository) GetDueCallbacks(now time.Time, limit int) ([]Callback, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, proyecto_id, campaign_id, contact_id, telefono, original_log_id,
+		       window_start, window_end, estado, dialed_at, created_at
+		FROM apicall_callbacks
+		WHERE estado = 'pending' AND window_start <= ? AND window_end > ?
+		ORDER BY window_start ASC
+		LIMIT ?
+	`, now, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo rellamadas: %w", err)
+	}
+	defer rows.Close()
+
+	callbacks := make([]Callback, 0)
+	for rows.Next() {
+		var cb Callback
+		if err := rows.Scan(
+			&cb.ID, &cb.ProyectoID, &cb.CampaignID, &cb.ContactID, &cb.Telefono, &cb.OriginalLogID,
+			&cb.WindowStart, &cb.WindowEnd, &cb.Estado, &cb.DialedAt, &cb.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error escaneando rellamada: %w", err)
+		}
+		callbacks = append(callbacks, cb)
+	}
+	return callbacks, rows.Err()
+}
+
+// UpdateCallbackEstado cambia el estado de una rellamada (dialed registra además dialed_at)
+func (r *Repository) UpdateCallbackEstado(id int64, estado string) error {
+	_, err := r.conn.DB.Exec(`
+		UPDATE apicall_callbacks
+		SET estado = ?, dialed_at = IF(? = 'dialed', NOW(), dialed_at)
+		WHERE id = ?
+	`, estado, estado, id)
+	if err != nil {
+		return fmt.Errorf("error actualizando rellamada %d: %w", id, err)
+	}
+	return nil
+}
+
+// ExpireCallbacks marca como vencidas las rellamadas cuya ventana cerró sin marcarse
+func (r *Repository) ExpireCallbacks(now time.Time) (int64, error) {
+	res, err := r.conn.DB.Exec(`UPDATE apicall_callbacks SET estado = 'expired' WHERE estado = 'pending' AND window_end <= ?`, now)
+	if err != nil {
+		return 0, fmt.Errorf("error venciendo rellamadas: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ==========================================
+// SPOOL QUEUE
+// ==========================================
+
+// EnqueueSpoolJob persiste una llamada aceptada y devuelve su ID en la cola
+func (r *Repository) EnqueueSpoolJob(j *SpoolJob) (int64, error) {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_spool_queue (proyecto_id, telefono, contact_id, campaign_id, variables, caller_id, external_ref, callback_of, ring_timeout, troncales)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`, j.ProyectoID, j.Telefono, j.ContactID, j.CampaignID, j.Variables, j.CallerID, j.ExternalRef, j.CallbackOf, j.RingTimeout, j.Troncales)
+	if err != nil {
+		return 0, fmt.Errorf("error encolando llamada: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// ClaimSpoolJobs toma hasta limit llamadas no cargadas, en orden de llegada, y las marca como cargadas por holder
+func (r *Repository) ClaimSpoolJobs(limit int, holder string) ([]SpoolJob, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, proyecto_id, telefono, contact_id, campaign_id, variables, caller_id, external_ref, callback_of,
+		       COALESCE(ring_timeout, 0), COALESCE(troncales, ''), created_at
+		FROM apicall_spool_queue
+		WHERE loaded = 0
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo cola del spooler: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]SpoolJob, 0)
+	ids := make([]interface{}, 0)
+	for rows.Next() {
+		var j SpoolJob
+		if err := rows.Scan(&j.ID, &j.ProyectoID, &j.Telefono, &j.ContactID, &j.CampaignID, &j.Variables,
+			&j.CallerID, &j.ExternalRef, &j.CallbackOf, &j.RingTimeout, &j.Troncales, &j.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando cola del spooler: %w", err)
+		}
+		jobs = append(jobs, j)
+		ids = append(ids, j.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return jobs, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := append([]interface{}{holder}, ids...)
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_spool_queue SET loaded = 1, loaded_by = ? WHERE id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("error marcando cola del spooler: %w", err)
+	}
+	return jobs, nil
+}
+
+// ResetSpoolJobs vuelve a dejar disponibles las llamadas cargadas por otro proceso
+// (uno anterior a este reinicio o una instancia que perdió el liderazgo)
+func (r *Repository) ResetSpoolJobs(holder string) (int, error) {
+	if _, err := r.conn.DB.Exec(`
+		UPDATE apicall_spool_queue SET loaded = 0, loaded_by = NULL
+		WHERE loaded = 1 AND (loaded_by IS NULL OR loaded_by <> ?)
+	`, holder); err != nil {
+		return 0, fmt.Errorf("error reiniciando cola del spooler: %w", err)
+	}
+	return r.CountSpoolJobs()
+}
+
+// CountSpoolJobs devuelve cuántas llamadas hay en la cola persistente
+func (r *Repository) CountSpoolJobs() (int, error) {
+	var n int
+	if err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_spool_queue`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error contando cola del spooler: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteSpoolJob quita una llamada de la cola (ya procesada o descartada)
+func (r *Repository) DeleteSpoolJob(id int64) error {
+	if _, err := r.conn.DB.Exec(`DELETE FROM apicall_spool_queue WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("error quitando llamada %d de la cola: %w", id, err)
+	}
+	return nil
+}
+
+// ==========================================
+// WALLBOARD
+// ==========================================
+
+// wallboardAnswered identifica llamadas contestadas (humano o máquina) por su disposition
+const wallboardAnswered = `disposition NOT IN ('', 'NA', 'B', 'CONG', 'FAIL')`
+
+// GetWallboardStats agrega los logs desde since en tres consultas sobre idx_created_troncal
+func (r *Repository) GetWallboardStats(since time.Time) (*WallboardStats, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{since})
+	return r.wallboardStats(since, filter, args)
+}
+
+// GetProyectoWallboard agrega los logs de un proyecto desde since (detalle del proyecto)
+func (r *Repository) GetProyectoWallboard(proyectoID int, since time.Time) (*WallboardStats, error) {
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{since, proyectoID})
+	return r.wallboardStats(since, " AND proyecto_id = ?"+filter, args)
+}
+
+// GetProyectoStats resume los logs de un proyecto desde since, con las topN dispositions más
+// frecuentes (las llamadas aún sin disposition cuentan como PENDING)
+func (r *Repository) GetProyectoStats(proyectoID int, since time.Time, topN int) (*ProyectoStats, error) {
+	wb, err := r.GetProyectoWallboard(proyectoID, since)
+	if err != nil {
+		return nil, err
+	}
+	stats := &ProyectoStats{WallboardStats: wb, TopDispositions: make([]DispositionTotal, 0)}
+
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{since, proyectoID})
+	rows, err := r.conn.DB.Query(`
+		SELECT COALESCE(NULLIF(disposition, ''), 'PENDING'), COUNT(*)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND proyecto_id = ?`+filter+`
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT ?`, append(args, topN)...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando dispositions del proyecto: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DispositionTotal
+		if err := rows.Scan(&d.Disposition, &d.Count); err != nil {
+			return nil, fmt.Errorf("error escaneando dispositions: %w", err)
+		}
+		stats.TopDispositions = append(stats.TopDispositions, d)
+	}
+	return stats, nil
+}
+
+// wallboardStats calcula el wallboard de los logs desde since que cumplen filter
+func (r *Repository) wallboardStats(since time.Time, filter string, args []interface{}) (*WallboardStats, error) {
+	stats := &WallboardStats{
+		Since:  since,
+		Hourly: make([]WallboardHour, 24),
+		Trunks: make([]WallboardTrunk, 0),
+	}
+	for h := range stats.Hourly {
+		stats.Hourly[h].Hour = h
+	}
+
+	err := r.conn.DB.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(`+wallboardAnswered+`), 0),
+		       COALESCE(SUM(disposition = 'AM'), 0),
+		       COALESCE(SUM(disposition = 'XFER'), 0),
+		       COALESCE(AVG(CASE WHEN `+wallboardAnswered+` THEN duracion END), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ?`+filter, args...,
+	).Scan(&stats.Attempted, &stats.Answered, &stats.Machine, &stats.Transferred, &stats.AvgDuration)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando totales del wallboard: %w", err)
+	}
+
+	rows, err := r.conn.DB.Query(`
+		SELECT HOUR(created_at), COUNT(*), COALESCE(SUM(`+wallboardAnswered+`), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ?`+filter+`
+		GROUP BY HOUR(created_at)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando histograma del wallboard: %w", err)
+	}
+	for rows.Next() {
+		var h WallboardHour
+		if err := rows.Scan(&h.Hour, &h.Attempted, &h.Answered); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error escaneando histograma: %w", err)
+		}
+		if h.Hour >= 0 && h.Hour < 24 {
+			stats.Hourly[h.Hour] = h
+		}
+	}
+	rows.Close()
+
+	rows, err = r.conn.DB.Query(`
+		SELECT COALESCE(troncal, ''), COUNT(*), COALESCE(SUM(`+wallboardAnswered+`), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ?`+filter+`
+		GROUP BY troncal
+		ORDER BY COUNT(*) DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando ASR por troncal: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t WallboardTrunk
+		if err := rows.Scan(&t.Troncal, &t.Attempted, &t.Answered); err != nil {
+			return nil, fmt.Errorf("error escaneando troncal: %w", err)
+		}
+		t.ASR = ratio(t.Answered, t.Attempted)
+		stats.Trunks = append(stats.Trunks, t)
+	}
+
+	stats.ASR = ratio(stats.Answered, stats.Attempted)
+	stats.MachineRate = ratio(stats.Machine, stats.Answered)
+	stats.TransferRate = ratio(stats.Transferred, stats.Answered-stats.Machine)
+	return stats, nil
+}
+
+// GetTrunkASR devuelve intentos y contestadas por troncal de las llamadas finalizadas desde since,
+// de todas las organizaciones (la salud de una troncal es global). Usa idx_created_troncal.
+func (r *Repository) GetTrunkASR(since time.Time) (map[string]WallboardTrunk, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT troncal, COUNT(*), COALESCE(SUM(`+wallboardAnswered+`), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND troncal IS NOT NULL AND disposition IS NOT NULL AND disposition <> ''
+		GROUP BY troncal`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando ASR por troncal: %w", err)
+	}
+	defer rows.Close()
+
+	trunks := make(map[string]WallboardTrunk)
+	for rows.Next() {
+		var t WallboardTrunk
+		if err := rows.Scan(&t.Troncal, &t.Attempted, &t.Answered); err != nil {
+			return nil, fmt.Errorf("error escaneando troncal: %w", err)
+		}
+		t.ASR = ratio(t.Answered, t.Attempted)
+		trunks[t.Troncal] = t
+	}
+	return trunks, rows.Err()
+}
+
+// ratio devuelve a/b redondeado a 4 decimales (0 si b es 0)
+func ratio(a, b int) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return math.Round(float64(a)/float64(b)*10000) / 10000
+}
+
+// ==========================================
+// REPORTS (rollups horarios)
+// ==========================================
+
+// rollupAnswered es wallboardAnswered sobre la tabla de rollups
+const rollupAnswered = `disposition NOT IN ('', 'NA', 'B', 'CONG', 'FAIL')`
+
+// Granularidades de los reportes históricos
+var reportPeriods = map[string]string{
+	"day":   "DATE(hora)",
+	"week":  "DATE_SUB(DATE(hora), INTERVAL WEEKDAY(hora) DAY)",
+	"month": "DATE(DATE_FORMAT(hora, '%Y-%m-01'))",
+}
+
+// GetRollupWatermark devuelve la última hora agregada (nil si la tabla está vacía)
+func (r *Repository) GetRollupWatermark() (*time.Time, error) {
+	var hora sql.NullTime
+	if err := r.conn.DB.QueryRow(`SELECT MAX(hora) FROM apicall_call_rollup_hourly`).Scan(&hora); err != nil {
+		return nil, fmt.Errorf("error leyendo watermark de rollups: %w", err)
+	}
+	if !hora.Valid {
+		return nil, nil
+	}
+	return &hora.Time, nil
+}
+
+// GetFirstCallLogTime devuelve la fecha del log más antiguo (nil si no hay logs)
+func (r *Repository) GetFirstCallLogTime() (*time.Time, error) {
+	var first sql.NullTime
+	if err := r.conn.DB.QueryRow(`SELECT MIN(created_at) FROM apicall_call_log`).Scan(&first); err != nil {
+		return nil, fmt.Errorf("error leyendo primer log: %w", err)
+	}
+	if !first.Valid {
+		return nil, nil
+	}
+	return &first.Time, nil
+}
+
+// RefreshCallRollups recalcula los rollups de las horas en [from, to).
+// Borra y reinserta en una transacción: las dispositions de las horas recientes
+// siguen cambiando mientras el batcher actualiza los logs.
+func (r *Repository) RefreshCallRollups(from, to time.Time) (int64, error) {
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error iniciando transacción de rollups: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM apicall_call_rollup_hourly WHERE hora >= ? AND hora < ?`, from, to); err != nil {
+		return 0, fmt.Errorf("error limpiando rollups: %w", err)
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO apicall_call_rollup_hourly (hora, proyecto_id, campaign_id, disposition, llamadas, con_dtmf, duracion_total,
+		                                        con_tiempos, timbrado_total, conversacion_total)
+		SELECT DATE_FORMAT(created_at, '%Y-%m-%d %H:00:00'), proyecto_id, COALESCE(campaign_id, 0), COALESCE(disposition, ''),
+		       COUNT(*), SUM(COALESCE(dtmf_marcado, '') <> ''), SUM(duracion),
+		       COUNT(segundos_timbrado), COALESCE(SUM(segundos_timbrado), 0), COALESCE(SUM(segundos_conversacion), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY 1, 2, 3, 4
+	`, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("error agregando rollups: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error confirmando rollups: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// GetReportTrend agrupa los rollups por día, semana o mes
+func (r *Repository) GetReportTrend(granularity string, f ReportFilter) ([]ReportPoint, error) {
+	period, ok := reportPeriods[granularity]
+	if !ok {
+		return nil, fmt.Errorf("granularidad inválida: %s", granularity)
+	}
+
+	query := `
+		SELECT ` + period + ` AS periodo,
+		       SUM(llamadas),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` THEN llamadas END), 0),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` AND disposition <> 'AM' THEN llamadas END), 0),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` AND disposition <> 'AM' THEN con_dtmf END), 0),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` THEN duracion_total END), 0),
+		       SUM(con_tiempos), SUM(timbrado_total),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` THEN con_tiempos END), 0),
+		       COALESCE(SUM(CASE WHEN ` + rollupAnswered + ` THEN conversacion_total END), 0)
+		FROM apicall_call_rollup_hourly
+		WHERE hora >= ? AND hora < ?
+	`
+	args := []interface{}{f.From, f.To}
+	if f.ProyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, f.ProyectoID)
+	}
+	if f.CampaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, f.CampaignID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " GROUP BY periodo ORDER BY periodo"
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando tendencia: %w", err)
+	}
+	defer rows.Close()
+
+	points := make([]ReportPoint, 0)
+	for rows.Next() {
+		var p ReportPoint
+		var periodo time.Time
+		var duracion, timed, ring, answeredTimed, talk int64
+		if err := rows.Scan(&periodo, &p.Attempted, &p.Answered, &p.Contacted, &p.Converted, &duracion,
+			&timed, &ring, &answeredTimed, &talk); err != nil {
+			return nil, fmt.Errorf("error escaneando tendencia: %w", err)
+		}
+		p.Periodo = periodo.Format("2006-01-02")
+		p.ASR = ratio(p.Answered, p.Attempted)
+		p.ContactRate = ratio(p.Contacted, p.Attempted)
+		p.DTMFConversion = ratio(p.Converted, p.Contacted)
+		if p.Answered > 0 {
+			p.AvgDuration = math.Round(float64(duracion)/float64(p.Answered)*100) / 100
+		}
+		if timed > 0 {
+			p.AvgRingTime = math.Round(float64(ring)/float64(timed)*100) / 100
+		}
+		if answeredTimed > 0 {
+			p.AvgTalkTime = math.Round(float64(talk)/float64(answeredTimed)*100) / 100
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// GetReportDispositions totaliza las llamadas por disposition en el rango
+func (r *Repository) GetReportDispositions(f ReportFilter) (map[string]int, error) {
+	query := `
+		SELECT disposition, SUM(llamadas)
+		FROM apicall_call_rollup_hourly
+		WHERE hora >= ? AND hora < ?
+	`
+	args := []interface{}{f.From, f.To}
+	if f.ProyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, f.ProyectoID)
+	}
+	if f.CampaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, f.CampaignID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " GROUP BY disposition"
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando dispositions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var disposition string
+		var n int
+		if err := rows.Scan(&disposition, &n); err != nil {
+			return nil, fmt.Errorf("error escaneando dispositions: %w", err)
+		}
+		if disposition == "" {
+			disposition = "PENDING"
+		}
+		counts[disposition] = n
+	}
+	return counts, nil
+}
+
+// GetHangupCauseReport cuenta las llamadas por causa de cuelgue en el rango (por troncal si byTrunk).
+// Se lee del log: los rollups no guardan la causa.
+func (r *Repository) GetHangupCauseReport(f ReportFilter, byTrunk bool) ([]HangupCauseRow, error) {
+	group := "''"
+	if byTrunk {
+		group = "COALESCE(troncal, '')"
+	}
+	query := `
+		SELECT ` + group + ` AS grupo, hangup_cause, COALESCE(MAX(hangup_cause_txt), ''), COUNT(*)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND created_at < ? AND hangup_cause IS NOT NULL
+	`
+	args := []interface{}{f.From, f.To}
+	if f.ProyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, f.ProyectoID)
+	}
+	if f.CampaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, f.CampaignID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " GROUP BY grupo, hangup_cause ORDER BY grupo, COUNT(*) DESC"
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando causas de cuelgue: %w", err)
+	}
+	defer rows.Close()
+
+	report := make([]HangupCauseRow, 0)
+	totals := make(map[string]int)
+	for rows.Next() {
+		var c HangupCauseRow
+		if err := rows.Scan(&c.Troncal, &c.Cause, &c.CauseTxt, &c.Llamadas); err != nil {
+			return nil, fmt.Errorf("error escaneando causas de cuelgue: %w", err)
+		}
+		totals[c.Troncal] += c.Llamadas
+		report = append(report, c)
+	}
+	for i := range report {
+		report[i].Ratio = ratio(report[i].Llamadas, totals[report[i].Troncal])
+	}
+	return report, nil
+}
+
+// GetSIPErrorReport agrupa por troncal las respuestas SIP registradas en el rango, con la tasa de error
+func (r *Repository) GetSIPErrorReport(f ReportFilter) ([]SIPTrunkErrors, error) {
+	query := `
+		SELECT COALESCE(troncal, '') AS grupo, sip_code, COALESCE(MAX(sip_reason), ''), COUNT(*)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND created_at < ? AND sip_code IS NOT NULL
+	`
+	args := []interface{}{f.From, f.To}
+	if f.ProyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, f.ProyectoID)
+	}
+	if f.CampaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, f.CampaignID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " GROUP BY grupo, sip_code ORDER BY grupo, COUNT(*) DESC"
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando respuestas SIP: %w", err)
+	}
+	defer rows.Close()
+
+	report := make([]SIPTrunkErrors, 0)
+	for rows.Next() {
+		var troncal string
+		var c SIPCodeCount
+		if err := rows.Scan(&troncal, &c.Code, &c.Reason, &c.Llamadas); err != nil {
+			return nil, fmt.Errorf("error escaneando respuestas SIP: %w", err)
+		}
+		if len(report) == 0 || report[len(report)-1].Troncal != troncal {
+			report = append(report, SIPTrunkErrors{Troncal: troncal, Codes: make([]SIPCodeCount, 0)})
+		}
+		t := &report[len(report)-1]
+		t.Llamadas += c.Llamadas
+		if c.Code >= 400 {
+			t.Errores += c.Llamadas
+		}
+		t.Codes = append(t.Codes, c)
+	}
+	for i := range report {
+		report[i].ErrorRate = ratio(report[i].Errores, report[i].Llamadas)
+	}
+	return report, nil
+}
+
+// BuildCampaignSummary calcula el resumen de la campaña desde sus contactos y el log de llamadas
+func (r *Repository) BuildCampaignSummary(c *Campaign) (*CampaignSummary, error) {
+	s := &CampaignSummary{
+		CampaignID:   c.ID,
+		Nombre:       c.Nombre,
+		ProyectoID:   c.ProyectoID,
+		FechaInicio:  c.FechaInicio,
+		FechaFin:     c.FechaFin,
+		Contactos:    make(map[string]int),
+		Dispositions: make(map[string]int),
+		GeneratedAt:  time.Now(),
+	}
+
+	rows, err := r.conn.DB.Query(`SELECT estado, COUNT(*) FROM apicall_campaign_contacts WHERE campaign_id = ? GROUP BY estado`, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error contando contactos de campaña %d: %w", c.ID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var estado string
+		var n int
+		if err := rows.Scan(&estado, &n); err != nil {
+			return nil, fmt.Errorf("error escaneando contactos de campaña %d: %w", c.ID, err)
+		}
+		s.Contactos[estado] = n
+	}
+
+	dispRows, err := r.conn.DB.Query(`
+		SELECT COALESCE(disposition, ''), COUNT(*),
+		       SUM(COALESCE(dtmf_marcado, '') <> ''), SUM(duracion),
+		       COALESCE(SUM(segundos_facturados), 0), COALESCE(SUM(costo), 0)
+		FROM apicall_call_log
+		WHERE campaign_id = ?
+		GROUP BY 1
+	`, c.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando llamadas de campaña %d: %w", c.ID, err)
+	}
+	defer dispRows.Close()
+
+	var answeredSeconds, billedSeconds int64
+	for dispRows.Next() {
+		var disposition string
+		var n, conDTMF int
+		var duracion, facturados int64
+		var costo float64
+		if err := dispRows.Scan(&disposition, &n, &conDTMF, &duracion, &facturados, &costo); err != nil {
+			return nil, fmt.Errorf("error escaneando llamadas de campaña %d: %w", c.ID, err)
+		}
+		if disposition == "" {
+			disposition = "PENDING"
+		}
+		s.Dispositions[disposition] += n
+		s.Llamadas += n
+		billedSeconds += facturados
+		s.Costo += costo
+		switch disposition {
+		case "PENDING", "NA", "B", "CONG", "FAIL": // Mismo criterio que rollupAnswered
+			continue
+		}
+		s.Answered += n
+		answeredSeconds += duracion
+		if disposition != "AM" {
+			s.Contacted += n
+			s.Converted += conDTMF
+		}
+	}
+
+	s.ConnectRate = ratio(s.Contacted, s.Llamadas)
+	s.DTMFConversion = ratio(s.Converted, s.Contacted)
+	if s.Answered > 0 {
+		s.AvgDuration = math.Round(float64(answeredSeconds)/float64(s.Answered)*100) / 100
+	}
+	s.Minutos = math.Round(float64(billedSeconds)/60*100) / 100
+	s.Costo = math.Round(s.Costo*10000) / 10000
+	return s, nil
+}
+
+// SaveCampaignSummary guarda el resumen final de la campaña
+func (r *Repository) SaveCampaignSummary(s *CampaignSummary) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error serializando resumen: %w", err)
+	}
+	_, err = r.conn.DB.Exec(`UPDATE apicall_campaigns SET summary = ?, summary_at = ? WHERE id = ?`, string(data), s.GeneratedAt, s.CampaignID)
+	if err != nil {
+		return fmt.Errorf("error guardando resumen de campaña %d: %w", s.CampaignID, err)
+	}
+	return nil
+}
+
+// GetCampaignSummary devuelve el resumen final guardado (nil si la campaña aún no se completó)
+func (r *Repository) GetCampaignSummary(campaignID int) (*CampaignSummary, error) {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{campaignID})
+	var data sql.NullString
+	err := r.conn.DB.QueryRow(`SELECT summary FROM apicall_campaigns WHERE id = ?`+filter, args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("campaña %d no encontrada", campaignID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo resumen de campaña %d: %w", campaignID, err)
+	}
+	if !data.Valid {
+		return nil, nil
+	}
+	var s CampaignSummary
+	if err := json.Unmarshal([]byte(data.String), &s); err != nil {
+		return nil, fmt.Errorf("resumen inválido de campaña %d: %w", campaignID, err)
+	}
+	return &s, nil
+}
+
+// Agrupaciones del reporte de costos
+var costGroups = map[string]string{
+	"day":      "DATE_FORMAT(created_at, '%Y-%m-%d')",
+	"campaign": "CAST(COALESCE(campaign_id, 0) AS CHAR)",
+	"troncal":  "COALESCE(troncal, '')",
+	"proyecto": "CAST(proyecto_id AS CHAR)",
+}
+
+// GetCostReport totaliza el costo estimado de las llamadas tarifadas en el rango,
+// agrupado por día, campaña, troncal o proyecto. Se lee del log (no de los rollups)
+// para que cuadre llamada a llamada con la factura del carrier.
+func (r *Repository) GetCostReport(groupBy string, f ReportFilter) ([]CostReportRow, error) {
+	group, ok := costGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("agrupación inválida: %s", groupBy)
+	}
+
+	query := `
+		SELECT ` + group + ` AS grupo, COUNT(*), COALESCE(SUM(duracion), 0),
+		       COALESCE(SUM(segundos_facturados), 0), COALESCE(SUM(costo), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND created_at < ? AND costo IS NOT NULL
+	`
+	args := []interface{}{f.From, f.To}
+	if f.ProyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, f.ProyectoID)
+	}
+	if f.CampaignID > 0 {
+		query += " AND campaign_id = ?"
+		args = append(args, f.CampaignID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " GROUP BY grupo ORDER BY grupo"
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando costos: %w", err)
+	}
+	defer rows.Close()
+
+	report := make([]CostReportRow, 0)
+	for rows.Next() {
+		var c CostReportRow
+		if err := rows.Scan(&c.Grupo, &c.Llamadas, &c.Duracion, &c.SegundosFacturados, &c.Costo); err != nil {
+			return nil, fmt.Errorf("error escaneando costos: %w", err)
+		}
+		c.Minutos = math.Round(float64(c.SegundosFacturados)/60*100) / 100
+		c.Costo = math.Round(c.Costo*10000) / 10000
+		report = append(report, c)
+	}
+	return report, nil
+}
+
+// ==========================================
+// CAMPAIGN EXIT RULES
+// ==========================================
+
+// CampaignExitMetrics son las métricas con las que el Sweeper evalúa las reglas de salida
+type CampaignExitMetrics struct {
+	WindowCalls    int // Llamadas finalizadas consideradas (hasta la ventana)
+	WindowAnswered int
+	DailySeconds   int // Segundos hablados desde dayStart
+	Connects       int
+}
+
+// GetCampaignExitMetrics calcula el ASR de las últimas window llamadas finalizadas, los segundos
+// hablados desde dayStart y las conexiones totales (dispositions indicadas o contestadas por humano)
+func (r *Repository) GetCampaignExitMetrics(campaignID, window int, dayStart time.Time, dispositions []string) (*CampaignExitMetrics, error) {
+	m := &CampaignExitMetrics{}
+	var err error
+	if m.WindowCalls, m.WindowAnswered, err = r.GetCampaignWindowASR(campaignID, window); err != nil {
+		return nil, err
+	}
+
+	err = r.conn.DB.QueryRow(`
+		SELECT COALESCE(SUM(duracion), 0) FROM apicall_call_log WHERE campaign_id = ? AND created_at >= ?
+	`, campaignID, dayStart).Scan(&m.DailySeconds)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando minutos de campaña %d: %w", campaignID, err)
+	}
+
+	connected := wallboardAnswered + ` AND disposition <> 'AM'`
+	args := []interface{}{campaignID}
+	if len(dispositions) > 0 {
+		connected = `disposition IN (` + strings.TrimSuffix(strings.Repeat("?,", len(dispositions)), ",") + `)`
+		for _, d := range dispositions {
+			args = append(args, d)
+		}
+	}
+	err = r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_call_log WHERE campaign_id = ? AND `+connected, args...).Scan(&m.Connects)
+	if err != nil {
+		return nil, fmt.Errorf("error contando conexiones de campaña %d: %w", campaignID, err)
+	}
+	return m, nil
+}
+
+// GetCampaignWindowASR devuelve las últimas window llamadas finalizadas de la campaña y cuántas se contestaron
+func (r *Repository) GetCampaignWindowASR(campaignID, window int) (int, int, error) {
+	var calls, answered int
+	err := r.conn.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(`+wallboardAnswered+`), 0)
+		FROM (
+			SELECT disposition FROM apicall_call_log
+			WHERE campaign_id = ? AND disposition IS NOT NULL AND disposition <> ''
+			ORDER BY id DESC LIMIT ?
+		) t
+	`, campaignID, window).Scan(&calls, &answered)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error calculando ASR de campaña %d: %w", campaignID, err)
+	}
+	return calls, answered, nil
+}
+
+// CampaignAbandonStats es la tasa de abandono de una campaña en una ventana deslizante. Una llamada
+// abandonada es una contestada por humano que no llegó a un agente (transferencia sin agente o
+// destino que colgó esperando en la cola: disposition XFERFAIL).
+type CampaignAbandonStats struct {
+	CampaignID     int       `json:"campaign_id"`
+	WindowHours    int       `json:"window_hours"`
+	Since          time.Time `json:"since"`
+	Answered       int       `json:"answered"` // Contestadas (humano o máquina)
+	Human          int       `json:"human"`
+	Machine        int       `json:"machine"` // Contestadas por contestadora (AM)
+	Abandoned      int       `json:"abandoned"`
+	AbandonRate    float64   `json:"abandon_rate"`     // Abandonadas / contestadas por humano
+	MachineRate    float64   `json:"machine_rate"`     // AM / contestadas
+	ExitMaxAbandon float64   `json:"exit_max_abandon"` // Regla de salida de la campaña (%, 0 = desactivada)
+}
+
+// GetCampaignAbandonStats cuenta las llamadas contestadas, por contestadora y abandonadas de la
+// campaña creadas desde since
+func (r *Repository) GetCampaignAbandonStats(campaignID int, since time.Time) (*CampaignAbandonStats, error) {
+	st := &CampaignAbandonStats{CampaignID: campaignID, Since: since}
+	err := r.conn.DB.QueryRow(`
+		SELECT COALESCE(SUM(`+wallboardAnswered+`), 0),
+		       COALESCE(SUM(disposition = 'AM'), 0),
+		       COALESCE(SUM(disposition = 'XFERFAIL'), 0)
+		FROM apicall_call_log
+		WHERE campaign_id = ? AND created_at >= ? AND disposition IS NOT NULL
+	`, campaignID, since).Scan(&st.Answered, &st.Machine, &st.Abandoned)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando abandono de campaña %d: %w", campaignID, err)
+	}
+	st.Human = st.Answered - st.Machine
+	st.AbandonRate = ratio(st.Abandoned, st.Human)
+	st.MachineRate = ratio(st.Machine, st.Answered)
+	return st, nil
+}
+
+// ==========================================
+// ALERTS
+// ==========================================
+
+const alertColumns = `id, tenant_id, tipo, clave, mensaje, estado, notificada, created_at, resolved_at`
+
+func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.TenantID, &a.Tipo, &a.Clave, &a.Mensaje, &a.Estado, &a.Notificada, &a.CreatedAt, &a.ResolvedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando alerta: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// CreateAlert registra una alerta abierta
+func (r *Repository) CreateAlert(a *Alert) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_alerts (tenant_id, tipo, clave, mensaje, estado, notificada, created_at, resolved_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.TenantID, a.Tipo, truncateUTF8(a.Clave, 100), truncateUTF8(a.Mensaje, 500), a.Estado, a.Notificada, a.CreatedAt, a.ResolvedAt)
+	if err != nil {
+		return fmt.Errorf("error registrando alerta %s: %w", a.Tipo, err)
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+// ResolveAlert marca una alerta como resuelta
+func (r *Repository) ResolveAlert(id int64, at time.Time) error {
+	_, err := r.conn.DB.Exec(`UPDATE apicall_alerts SET estado = 'resolved', resolved_at = ? WHERE id = ? AND estado = 'active'`, at, id)
+	if err != nil {
+		return fmt.Errorf("error resolviendo alerta %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetActiveAlerts devuelve las alertas abiertas de todas las organizaciones (estado del monitor al arrancar)
+func (r *Repository) GetActiveAlerts() ([]Alert, error) {
+	rows, err := r.conn.DB.Query(`SELECT ` + alertColumns + ` FROM apicall_alerts WHERE estado = 'active' ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando alertas activas: %w", err)
+	}
+	defer rows.Close()
+	return scanAlerts(rows)
+}
+
+// ListAlerts lista las alertas de la organización, más recientes primero (estado vacío = todas).
+// Las alertas del sistema (tenant 0) solo las ve la vista sin restricción.
+func (r *Repository) ListAlerts(estado string, limit, offset int) ([]Alert, error) {
+	query := `SELECT ` + alertColumns + ` FROM apicall_alerts WHERE 1=1`
+	var args []interface{}
+	if estado != "" {
+		query += ` AND estado = ?`
+		args = append(args, estado)
+	}
+	filter, args := r.tenantFilter("tenant_id", args)
+	rows, err := r.conn.DB.Query(query+filter+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando alertas: %w", err)
+	}
+	defer rows.Close()
+	return scanAlerts(rows)
+}
+
+// GetCIDAnswerRates devuelve las llamadas finalizadas y contestadas desde since por Caller ID y proyecto
+// (idx_created_cid)
+func (r *Repository) GetCIDAnswerRates(since time.Time) ([]CIDAnswerRate, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT caller_id_used, proyecto_id, COUNT(*), COALESCE(SUM(`+wallboardAnswered+`), 0)
+		FROM apicall_call_log
+		WHERE created_at >= ? AND caller_id_used IS NOT NULL AND caller_id_used <> ''
+		  AND disposition IS NOT NULL AND disposition <> ''
+		GROUP BY caller_id_used, proyecto_id
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("error calculando ASR por Caller ID: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []CIDAnswerRate
+	for rows.Next() {
+		var c CIDAnswerRate
+		if err := rows.Scan(&c.CallerID, &c.ProyectoID, &c.Llamadas, &c.Contestadas); err != nil {
+			return nil, fmt.Errorf("error escaneando ASR por Caller ID: %w", err)
+		}
+		rates = append(rates, c)
+	}
+	return rates, rows.Err()
+}
+
+// QuarantineCID retira un Caller ID de la rotación (si ya estaba en cuarentena no cambia nada).
+// Devuelve false si ya estaba.
+func (r *Repository) QuarantineCID(q *CIDQuarantine) (bool, error) {
+	res, err := r.conn.DB.Exec(`
+		INSERT IGNORE INTO apicall_cid_quarantine (caller_id, tenant_id, proyecto_id, llamadas, answer_rate, motivo)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, q.CallerID, q.TenantID, q.ProyectoID, q.Llamadas, q.AnswerRate, truncateUTF8(q.Motivo, 255))
+	if err != nil {
+		return false, fmt.Errorf("error poniendo en cuarentena %s: %w", q.CallerID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListCIDQuarantine lista los Caller IDs en cuarentena de la organización, más recientes primero
+func (r *Repository) ListCIDQuarantine() ([]CIDQuarantine, error) {
+	filter, args := r.tenantFilter("tenant_id", nil)
+	rows, err := r.conn.DB.Query(`
+		SELECT caller_id, tenant_id, proyecto_id, llamadas, answer_rate, motivo, created_at
+		FROM apicall_cid_quarantine WHERE 1=1`+filter+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando Caller IDs en cuarentena: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]CIDQuarantine, 0)
+	for rows.Next() {
+		var q CIDQuarantine
+		if err := rows.Scan(&q.CallerID, &q.TenantID, &q.ProyectoID, &q.Llamadas, &q.AnswerRate, &q.Motivo, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando Caller ID en cuarentena: %w", err)
+		}
+		list = append(list, q)
+	}
+	return list, rows.Err()
+}
+
+// GetQuarantinedCIDs devuelve el conjunto de Caller IDs en cuarentena de todas las organizaciones
+// (los excluye el pipeline de pre-marcación)
+func (r *Repository) GetQuarantinedCIDs() (map[string]bool, error) {
+	rows, err := r.conn.DB.Query(`SELECT caller_id FROM apicall_cid_quarantine`)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando Caller IDs en cuarentena: %w", err)
+	}
+	defer rows.Close()
+
+	set := make(map[string]bool)
+	for rows.Next() {
+		var cid string
+		if err := rows.Scan(&cid); err != nil {
+			return nil, fmt.Errorf("error escaneando Caller ID en cuarentena: %w", err)
+		}
+		set[cid] = true
+	}
+	return set, rows.Err()
+}
+
+// ReleaseCID libera un Caller ID de la cuarentena: vuelve a la rotación
+func (r *Repository) ReleaseCID(callerID string) error {
+	filter, args := r.tenantFilter("tenant_id", []interface{}{callerID})
+	result, err := r.conn.DB.Exec(`DELETE FROM apicall_cid_quarantine WHERE caller_id = ?`+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error liberando Caller ID: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Caller ID %s no está en cuarentena", callerID)
+	}
+	return nil
+}
+
+// GetCIDsToCheck devuelve los Caller IDs presentados desde since (y los fijos de los proyectos) cuya
+// reputación nunca se consultó o se consultó antes de checkedBefore, los más antiguos primero
+func (r *Repository) GetCIDsToCheck(since, checkedBefore time.Time, limit int) ([]string, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT c.cid FROM (
+			SELECT DISTINCT caller_id_used AS cid FROM apicall_call_log
+			WHERE created_at >= ? AND caller_id_used IS NOT NULL AND caller_id_used <> ''
+			UNION
+			SELECT caller_id FROM apicall_proyectos WHERE caller_id <> ''
+		) c
+		LEFT JOIN apicall_cid_reputation r ON r.caller_id = c.cid
+		WHERE r.checked_at IS NULL OR r.checked_at < ?
+		ORDER BY r.checked_at IS NOT NULL, r.checked_at
+		LIMIT ?
+	`, since, checkedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando Caller IDs a verificar: %w", err)
+	}
+	defer rows.Close()
+
+	var cids []string
+	for rows.Next() {
+		var cid string
+		if err := rows.Scan(&cid); err != nil {
+			return nil, fmt.Errorf("error escaneando Caller ID: %w", err)
+		}
+		cids = append(cids, cid)
+	}
+	return cids, rows.Err()
+}
+
+// SaveCIDReputation guarda el resultado de la consulta de reputación de un Caller ID
+func (r *Repository) SaveCIDReputation(rep *CIDReputation) error {
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_cid_reputation (caller_id, provider, label, score, error, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE provider = VALUES(provider), label = VALUES(label), score = VALUES(score),
+			error = VALUES(error), checked_at = VALUES(checked_at)
+	`, rep.CallerID, rep.Provider, truncateUTF8(rep.Label, 100), rep.Score, truncateUTF8(rep.Error, 255), rep.CheckedAt)
+	if err != nil {
+		return fmt.Errorf("error guardando reputación de %s: %w", rep.CallerID, err)
+	}
+	return nil
+}
+
+// GetCIDStats devuelve las llamadas finalizadas desde since por Caller ID presentado (proyectoID 0 =
+// todos los de la organización), con su cuarentena y la última reputación consultada
+func (r *Repository) GetCIDStats(proyectoID int, since time.Time, limit int) ([]CIDStats, error) {
+	where := "created_at >= ? AND caller_id_used IS NOT NULL AND caller_id_used <> '' AND disposition IS NOT NULL AND disposition <> ''"
+	args := []interface{}{since}
+	if proyectoID > 0 {
+		where += " AND proyecto_id = ?"
+		args = append(args, proyectoID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	args = append(args, limit)
+
+	rows, err := r.conn.DB.Query(`
+		SELECT s.cid, s.llamadas, s.contestadas, q.caller_id IS NOT NULL,
+			r.caller_id, r.provider, r.label, r.score, r.error, r.checked_at
+		FROM (
+			SELECT caller_id_used AS cid, COUNT(*) AS llamadas, COALESCE(SUM(`+wallboardAnswered+`), 0) AS contestadas
+			FROM apicall_call_log
+			WHERE `+where+filter+`
+			GROUP BY caller_id_used
+			ORDER BY llamadas DESC
+			LIMIT ?
+		) s
+		LEFT JOIN apicall_cid_quarantine q ON q.caller_id = s.cid
+		LEFT JOIN apicall_cid_reputation r ON r.caller_id = s.cid
+		ORDER BY s.llamadas DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo estadísticas por Caller ID: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]CIDStats, 0)
+	for rows.Next() {
+		var st CIDStats
+		var repCID, provider, label, repErr sql.NullString
+		var score sql.NullFloat64
+		var checked sql.NullTime
+		if err := rows.Scan(&st.CallerID, &st.Llamadas, &st.Contestadas, &st.Cuarentena,
+			&repCID, &provider, &label, &score, &repErr, &checked); err != nil {
+			return nil, fmt.Errorf("error escaneando estadísticas por Caller ID: %w", err)
+		}
+		if st.Llamadas > 0 {
+			st.AnswerRate = math.Round(float64(st.Contestadas)*10000/float64(st.Llamadas)) / 100
+		}
+		if repCID.Valid {
+			st.Reputacion = &CIDReputation{
+				CallerID:  repCID.String,
+				Provider:  provider.String,
+				Label:     label.String,
+				Error:     repErr.String,
+				CheckedAt: checked.Time,
+			}
+			if score.Valid {
+				st.Reputacion.Score = &score.Float64
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// ==========================================
+// RETENTION
+// ==========================================
+
+// GetExpiredCallLogs devuelve logs del proyecto anteriores a cutoff, en orden de id
+func (r *Repository) GetExpiredCallLogs(proyectoID int, cutoff time.Time, limit int) ([]CallLog, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT `+callLogColumns+`
+		FROM apicall_call_log
+		WHERE proyecto_id = ? AND created_at < ?
+		ORDER BY id
+		LIMIT ?
+	`, proyectoID, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando logs vencidos: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCallLogs(rows)
+}
+
+// CountExpiredCallLogs cuenta los logs del proyecto anteriores a cutoff (dry-run)
+func (r *Repository) CountExpiredCallLogs(proyectoID int, cutoff time.Time) (int, error) {
+	var n int
+	err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_call_log WHERE proyecto_id = ? AND created_at < ?`,
+		proyectoID, cutoff).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error contando logs vencidos: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteCallLogs elimina logs por id
+func (r *Repository) DeleteCallLogs(ids []int64) (int64, error) {
+	return r.deleteByIDs("apicall_call_log", ids)
+}
+
+// expiredContactsWhere selecciona contactos en estado final, de campañas del proyecto, anteriores a cutoff.
+// Los pendientes nunca se purgan: la campaña todavía puede marcarlos.
+const expiredContactsWhere = `
+		WHERE campaign_id IN (SELECT id FROM apicall_campaigns WHERE proyecto_id = ?)
+		  AND estado IN ('completed', 'failed', 'skipped')
+		  AND created_at < ?`
+
+// GetExpiredContacts devuelve contactos vencidos del proyecto, en orden de id
+func (r *Repository) GetExpiredContacts(proyectoID int, cutoff time.Time, limit int) ([]CampaignContact, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, campaign_id, telefono, datos_adicionales, estado, intentos, ultimo_intento, resultado, created_at
+		FROM apicall_campaign_contacts`+expiredContactsWhere+`
+		ORDER BY id
+		LIMIT ?
+	`, proyectoID, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando contactos vencidos: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := make([]CampaignContact, 0)
+	for rows.Next() {
+		var c CampaignContact
+		if err := rows.Scan(&c.ID, &c.CampaignID, &c.Telefono, &c.DatosAdicionales,
+			&c.Estado, &c.Intentos, &c.UltimoIntento, &c.Resultado, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando contacto: %w", err)
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, nil
+}
+
+// CountExpiredContacts cuenta los contactos vencidos del proyecto (dry-run)
+func (r *Repository) CountExpiredContacts(proyectoID int, cutoff time.Time) (int, error) {
+	var n int
+	err := r.conn.DB.QueryRow(`SELECT COUNT(*) FROM apicall_campaign_contacts`+expiredContactsWhere,
+		proyectoID, cutoff).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error contando contactos vencidos: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteCampaignContacts elimina contactos por id
+func (r *Repository) DeleteCampaignContacts(ids []int64) (int64, error) {
+	return r.deleteByIDs("apicall_campaign_contacts", ids)
+}
+
+func (r *Repository) deleteByIDs(table string, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	res, err := r.conn.DB.Exec("DELETE FROM "+table+" WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return 0, fmt.Errorf("error eliminando de %s: %w", table, err)
+	}
+	return res.RowsAffected()
+}
+
+// CreateRetentionRun registra el reporte de una pasada de retención
+func (r *Repository) CreateRetentionRun(run *RetentionRun) error {
+	res, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_retention_runs (proyecto_id, dry_run, cutoff, call_logs, contacts, recordings, archivos, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.ProyectoID, run.DryRun, run.Cutoff, run.CallLogs, run.Contacts, run.Recordings, run.Archivos,
+		run.Error, run.StartedAt, run.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("error registrando pasada de retención: %w", err)
+	}
+	run.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListRetentionRuns lista las últimas pasadas de retención (opcionalmente de un proyecto)
+func (r *Repository) ListRetentionRuns(proyectoID int, limit int) ([]RetentionRun, error) {
+	query := `
+		SELECT id, proyecto_id, dry_run, cutoff, call_logs, contacts, recordings,
+		       COALESCE(archivos, ''), COALESCE(error, ''), started_at, finished_at
+		FROM apicall_retention_runs
+		WHERE 1=1
+	`
+	var args []interface{}
+	if proyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, proyectoID)
+	}
+	filter, args := r.proyectoFilter("proyecto_id", args)
+	query += filter + " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.conn.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando pasadas de retención: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]RetentionRun, 0)
+	for rows.Next() {
+		var run RetentionRun
+		if err := rows.Scan(&run.ID, &run.ProyectoID, &run.DryRun, &run.Cutoff, &run.CallLogs, &run.Contacts,
+			&run.Recordings, &run.Archivos, &run.Error, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando pasada de retención: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// ==========================================
+// SURVEYS
+// ==========================================
+
+// GetSurvey obtiene una encuesta con sus preguntas en orden
+func (r *Repository) GetSurvey(id int) (*Survey, error) {
+	query := `SELECT id, proyecto_id, nombre, COALESCE(end_audio, ''), created_at, updated_at FROM apicall_surveys WHERE id = ?`
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+
+	var sv Survey
+	err := r.conn.DB.QueryRow(query+filter, args...).Scan(&sv.ID, &sv.ProyectoID, &sv.Nombre, &sv.EndAudio, &sv.CreatedAt, &sv.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("encuesta %d no encontrada", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando encuesta: %w", err)
+	}
+	if sv.Preguntas, err = r.getSurveyQuestions(sv.ID); err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// ListSurveys lista las encuestas (opcionalmente de un proyecto) con sus preguntas
+func (r *Repository) ListSurveys(proyectoID int) ([]Survey, error) {
+	query := `SELECT id, proyecto_id, nombre, COALESCE(end_audio, ''), created_at, updated_at FROM apicall_surveys WHERE 1=1`
+	filter, args := r.proyectoFilter("proyecto_id", nil)
+	query += filter
+	if proyectoID > 0 {
+		query += " AND proyecto_id = ?"
+		args = append(args, proyectoID)
+	}
+
+	rows, err := r.conn.DB.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando encuestas: %w", err)
+	}
+	surveys := make([]Survey, 0)
+	for rows.Next() {
+		var sv Survey
+		if err := rows.Scan(&sv.ID, &sv.ProyectoID, &sv.Nombre, &sv.EndAudio, &sv.CreatedAt, &sv.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error escaneando encuesta: %w", err)
+		}
+		surveys = append(surveys, sv)
+	}
+	rows.Close()
+
+	for i := range surveys {
+		if surveys[i].Preguntas, err = r.getSurveyQuestions(surveys[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return surveys, nil
+}
+
+func (r *Repository) getSurveyQuestions(surveyID int) ([]SurveyQuestion, error) {
+	rows, err := r.conn.DB.Query(`
+		SELECT id, survey_id, orden, texto, audio, COALESCE(opciones, ''), COALESCE(timeout, 5), COALESCE(intentos, 2)
+		FROM apicall_survey_questions WHERE survey_id = ? ORDER BY orden, id
+	`, surveyID)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando preguntas: %w", err)
+	}
+	defer rows.Close()
+
+	questions := make([]SurveyQuestion, 0)
+	for rows.Next() {
+		var q SurveyQuestion
+		if err := rows.Scan(&q.ID, &q.SurveyID, &q.Orden, &q.Texto, &q.Audio, &q.Opciones, &q.Timeout, &q.Intentos); err != nil {
+			return nil, fmt.Errorf("error escaneando pregunta: %w", err)
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// CreateSurvey crea una encuesta con sus preguntas (el orden es el de la lista)
+func (r *Repository) CreateSurvey(sv *Survey) error {
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO apicall_surveys (proyecto_id, nombre, end_audio) VALUES (?, ?, ?)`,
+		sv.ProyectoID, sv.Nombre, sv.EndAudio)
+	if err != nil {
+		return fmt.Errorf("error creando encuesta: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sv.ID = int(id)
+
+	if err := saveSurveyQuestions(tx, sv); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateSurvey actualiza la encuesta y sus preguntas: las que traen id se modifican, las nuevas
+// se agregan y las que ya no están se eliminan. Mantener el id conserva sus respuestas en el export.
+func (r *Repository) UpdateSurvey(sv *Survey) error {
+	tx, err := r.conn.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{sv.ID})
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM apicall_surveys WHERE id = ?`+filter, args...).Scan(&exists); err != nil {
+		return fmt.Errorf("error consultando encuesta: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("encuesta %d no encontrada", sv.ID)
+	}
+
+	if _, err := tx.Exec(`UPDATE apicall_surveys SET nombre = ?, end_audio = ? WHERE id = ?`, sv.Nombre, sv.EndAudio, sv.ID); err != nil {
+		return fmt.Errorf("error actualizando encuesta: %w", err)
+	}
+
+	if err := saveSurveyQuestions(tx, sv); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveSurveyQuestions sincroniza las preguntas de sv dentro de la transacción
+func saveSurveyQuestions(tx *sql.Tx, sv *Survey) error {
+	existing := make(map[int]bool)
+	rows, err := tx.Query(`SELECT id FROM apicall_survey_questions WHERE survey_id = ?`, sv.ID)
+	if err != nil {
+		return fmt.Errorf("error consultando preguntas: %w", err)
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("error escaneando pregunta: %w", err)
+		}
+		existing[id] = true
+	}
+	rows.Close()
+
+	keep := make([]interface{}, 0, len(sv.Preguntas)+1)
+	keep = append(keep, sv.ID)
+	for i := range sv.Preguntas {
+		q := &sv.Preguntas[i]
+		q.SurveyID = sv.ID
+		q.Orden = i + 1
+
+		// Un id que no es de esta encuesta se trata como pregunta nueva
+		if existing[q.ID] {
+			if _, err := tx.Exec(`
+				UPDATE apicall_survey_questions SET orden = ?, texto = ?, audio = ?, opciones = ?, timeout = ?, intentos = ?
+				WHERE id = ?
+			`, q.Orden, q.Texto, q.Audio, q.Opciones, q.Timeout, q.Intentos, q.ID); err != nil {
+				return fmt.Errorf("error actualizando pregunta %d: %w", q.ID, err)
+			}
+			keep = append(keep, q.ID)
+			continue
+		}
+
+		res, err := tx.Exec(`
+			INSERT INTO apicall_survey_questions (survey_id, orden, texto, audio, opciones, timeout, intentos)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, sv.ID, q.Orden, q.Texto, q.Audio, q.Opciones, q.Timeout, q.Intentos)
+		if err != nil {
+			return fmt.Errorf("error creando pregunta: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		q.ID = int(id)
+		keep = append(keep, q.ID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keep)-1), ",")
+	query := `DELETE FROM apicall_survey_questions WHERE survey_id = ?`
+	if placeholders != "" {
+		query += ` AND id NOT IN (` + placeholders + `)`
+	}
+	if _, err := tx.Exec(query, keep...); err != nil {
+		return fmt.Errorf("error eliminando preguntas: %w", err)
+	}
+	return nil
+}
+
+// DeleteSurvey elimina una encuesta (las respuestas se conservan para el export histórico)
+// y la desasigna de los proyectos que la usaban
+func (r *Repository) DeleteSurvey(id int) error {
+	query := `DELETE FROM apicall_surveys WHERE id = ?`
+	filter, args := r.proyectoFilter("proyecto_id", []interface{}{id})
+
+	res, err := r.conn.DB.Exec(query+filter, args...)
+	if err != nil {
+		return fmt.Errorf("error eliminando encuesta: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("encuesta %d no encontrada", id)
+	}
+	if _, err := r.conn.DB.Exec(`UPDATE apicall_proyectos SET survey_id = 0 WHERE survey_id = ?`, id); err != nil {
+		return fmt.Errorf("error desasignando encuesta: %w", err)
+	}
+	r.cache.proyectos.clear()
+	return nil
+}
+
+// SaveSurveyResponse guarda la respuesta a una pregunta (si se repite en la llamada queda la última)
+func (r *Repository) SaveSurveyResponse(resp *SurveyResponse) error {
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_survey_responses (survey_id, question_id, call_log_id, proyecto_id, campaign_id, contact_id, telefono, respuesta)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE respuesta = VALUES(respuesta)
+	`, resp.SurveyID, resp.QuestionID, resp.CallLogID, resp.ProyectoID, resp.CampaignID, resp.ContactID, resp.Telefono, resp.Respuesta)
+	if err != nil {
+		return fmt.Errorf("error guardando respuesta de encuesta: %w", err)
+	}
+	return nil
+}
+
+// ListCampaignSurveyResponses devuelve las respuestas de encuesta de una campaña agrupadas por llamada
+func (r *Repository) ListCampaignSurveyResponses(campaignID int) ([]SurveyResponse, error) {
+	query := `
+		SELECT id, survey_id, question_id, call_log_id, proyecto_id, campaign_id, contact_id, telefono, respuesta, created_at
+		FROM apicall_survey_responses
+		WHERE campaign_id = ?`
+	filter, args := r.campaignFilter("campaign_id", []interface{}{campaignID})
+
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY call_log_id, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando respuestas de encuesta: %w", err)
+	}
+	defer rows.Close()
+
+	responses := make([]SurveyResponse, 0)
+	for rows.Next() {
+		var sr SurveyResponse
+		if err := rows.Scan(&sr.ID, &sr.SurveyID, &sr.QuestionID, &sr.CallLogID, &sr.ProyectoID, &sr.CampaignID,
+			&sr.ContactID, &sr.Telefono, &sr.Respuesta, &sr.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando respuesta de encuesta: %w", err)
+		}
+		responses = append(responses, sr)
+	}
+	return responses, rows.Err()
+}
+
+// ==========================================
+// AUDIOS
+// ==========================================
+
+// La biblioteca de audios es compartida (un único directorio en Asterisk): no se filtra por tenant
+
+const audioColumns = `id, name, COALESCE(title, ''), COALESCE(duration, 0), COALESCE(size, 0), COALESCE(tags, ''), COALESCE(uploaded_by, ''), created_at, updated_at`
+
+func scanAudio(row rowScanner) (*Audio, error) {
+	var a Audio
+	var tags string
+	if err := row.Scan(&a.ID, &a.Name, &a.Title, &a.Duration, &a.Size, &tags, &a.UploadedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	a.Tags = audio.ParseTags(tags)
+	return &a, nil
+}
+
+// GetAudio obtiene los metadatos de un audio por nombre de archivo
+func (r *Repository) GetAudio(name string) (*Audio, error) {
+	a, err := scanAudio(r.conn.DB.QueryRow(`SELECT `+audioColumns+` FROM apicall_audios WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("audio %s no encontrado", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando audio: %w", err)
+	}
+	return a, nil
+}
+
+// ListAudios lista los audios registrados (opcionalmente solo los que tienen la etiqueta tag)
+func (r *Repository) ListAudios(tag string) ([]Audio, error) {
+	query := `SELECT ` + audioColumns + ` FROM apicall_audios WHERE 1=1`
+	var args []interface{}
+	if tag != "" {
+		query += " AND FIND_IN_SET(?, tags) > 0"
+		args = append(args, strings.ToLower(tag))
+	}
+
+	rows, err := r.conn.DB.Query(query+" ORDER BY name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando audios: %w", err)
+	}
+	defer rows.Close()
+
+	audios := make([]Audio, 0)
+	for rows.Next() {
+		a, err := scanAudio(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error escaneando audio: %w", err)
+		}
+		audios = append(audios, *a)
+	}
+	return audios, nil
+}
+
+// UpsertAudio registra un audio o, si el archivo ya existía (re-subida), actualiza sus metadatos.
+// Un título o uploaded_by vacíos no pisan los previos.
+func (r *Repository) UpsertAudio(a *Audio) error {
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_audios (name, title, duration, size, tags, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			title = IF(VALUES(title) = '', title, VALUES(title)),
+			duration = VALUES(duration),
+			size = VALUES(size),
+			tags = IF(VALUES(tags) = '', tags, VALUES(tags)),
+			uploaded_by = IF(VALUES(uploaded_by) = '', uploaded_by, VALUES(uploaded_by))
+	`, a.Name, a.Title, a.Duration, a.Size, strings.Join(a.Tags, ","), a.UploadedBy)
+	if err != nil {
+		return fmt.Errorf("error guardando audio: %w", err)
+	}
+	return nil
+}
+
+// UpdateAudioMeta actualiza el título y las etiquetas de un audio
+func (r *Repository) UpdateAudioMeta(name, title string, tags []string) error {
+	result, err := r.conn.DB.Exec(`UPDATE apicall_audios SET title = ?, tags = ? WHERE name = ?`,
+		title, strings.Join(tags, ","), name)
+	if err != nil {
+		return fmt.Errorf("error actualizando audio: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := r.GetAudio(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAudio elimina los metadatos de un audio
+func (r *Repository) DeleteAudio(name string) error {
+	if _, err := r.conn.DB.Exec(`DELETE FROM apicall_audios WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("error eliminando audio: %w", err)
+	}
+	return nil
+}
+
+// SetProyectoAudio fija el audio principal de un proyecto
+func (r *Repository) SetProyectoAudio(proyectoID int, name string) error {
+	query := "UPDATE apicall_proyectos SET audio = ? WHERE id = ?"
+	filter, args := r.tenantFilter("tenant_id", []interface{}{name, proyectoID})
+	if _, err := r.conn.DB.Exec(query+filter, args...); err != nil {
+		return fmt.Errorf("error actualizando audio del proyecto: %w", err)
+	}
+	r.cache.proyectos.delete(proyectoID)
+	return nil
+}
+
+// AudioReferences devuelve los proyectos y encuestas (de cualquier tenant) que usan el archivo name.
+// Se compara contra todas las formas de referenciarlo: con o sin extensión y con o sin "apicall/".
+func (r *Repository) AudioReferences(name string) ([]AudioReference, error) {
+	names := audio.RefNames(name)
+	in := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	args := make([]interface{}, len(names))
+	for i, n := range names {
+		args[i] = n
+	}
+
+	refs := make([]AudioReference, 0)
+	collect := func(tipo, query string, argCount int) error {
+		queryArgs := make([]interface{}, 0, len(args)*argCount)
+		for i := 0; i < argCount; i++ {
+			queryArgs = append(queryArgs, args...)
+		}
+		rows, err := r.conn.DB.Query(strings.ReplaceAll(query, "%s", in), queryArgs...)
+		if err != nil {
+			return fmt.Errorf("error buscando referencias del audio: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			ref := AudioReference{Tipo: tipo}
+			if err := rows.Scan(&ref.ID, &ref.Nombre, &ref.Campo); err != nil {
+				return fmt.Errorf("error escaneando referencia: %w", err)
+			}
+			refs = append(refs, ref)
+		}
+		return rows.Err()
+	}
+
+	if err := collect("proyecto", `
+		SELECT id, nombre, 'audio' FROM apicall_proyectos WHERE audio IN (%s)
+		UNION ALL SELECT id, nombre, 'capture_audio' FROM apicall_proyectos WHERE capture_audio IN (%s)
+		UNION ALL SELECT id, nombre, 'transfer_fail_audio' FROM apicall_proyectos WHERE transfer_fail_audio IN (%s)
+		UNION ALL SELECT id, nombre, 'callback_audio' FROM apicall_proyectos WHERE callback_audio IN (%s)
+	`, 4); err != nil {
+		return nil, err
+	}
+	if err := collect("encuesta", `
+		SELECT id, nombre, 'end_audio' FROM apicall_surveys WHERE end_audio IN (%s)
+		UNION ALL SELECT s.id, s.nombre, CONCAT('pregunta ', q.orden) FROM apicall_survey_questions q
+			JOIN apicall_surveys s ON s.id = q.survey_id WHERE q.audio IN (%s)
+	`, 2); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// ==========================================
+// LEADER LEASE
+// ==========================================
+
+// AcquireLease toma o renueva el lease name para holder por ttl. Devuelve true si holder
+// quedó como dueño: el lease es suyo o el del anterior dueño ya venció.
+// Los vencimientos se calculan con el reloj de la BD, común a todas las instancias.
+func (r *Repository) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	ms := ttl.Milliseconds()
+	// MySQL aplica las asignaciones en orden: expires_at ve el holder ya actualizado
+	_, err := r.conn.DB.Exec(`
+		INSERT INTO apicall_leader_lease (name, holder, expires_at)
+		VALUES (?, ?, NOW(3) + INTERVAL ? MICROSECOND)
+		ON DUPLICATE KEY UPDATE
+			holder = IF(holder = VALUES(holder) OR expires_at < NOW(3), VALUES(holder), holder),
+			expires_at = IF(holder = VALUES(holder), VALUES(expires_at), expires_at)
+	`, name, holder, ms*1000)
+	if err != nil {
+		return false, fmt.Errorf("error tomando lease %s: %w", name, err)
+	}
+
+	var current string
+	if err := r.conn.DB.QueryRow(`SELECT holder FROM apicall_leader_lease WHERE name = ?`, name).Scan(&current); err != nil {
+		return false, fmt.Errorf("error leyendo lease %s: %w", name, err)
+	}
+	return current == holder, nil
+}
+
+// ReleaseLease vence el lease si holder es el dueño, para que otra instancia lo tome de inmediato
+func (r *Repository) ReleaseLease(name, holder string) error {
+	if _, err := r.conn.DB.Exec(`
+		UPDATE apicall_leader_lease SET expires_at = NOW(3) WHERE name = ? AND holder = ?
+	`, name, holder); err != nil {
+		return fmt.Errorf("error liberando lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// ==========================================
+// TENANTS
+// ==========================================
+
+// ListTenants lista las organizaciones (la vista acotada solo ve la suya)
+func (r *Repository) ListTenants() ([]Tenant, error) {
+	query := `SELECT id, nombre, slug, activo, created_at FROM apicall_tenants WHERE 1=1`
+	filter, args := r.tenantFilter("id", nil)
+	rows, err := r.conn.DB.Query(query+filter+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listando tenants: %w", err)
+	}
+	defer rows.Close()
+
+	tenants := make([]Tenant, 0)
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Nombre, &t.Slug, &t.Activo, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error escaneando tenant: %w", err)
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+// GetTenant obtiene una organización por ID
+func (r *Repository) GetTenant(id int) (*Tenant, error) {
+	query := `SELECT id, nombre, slug, activo, created_at FROM apicall_tenants WHERE id = ?`
+	filter, args := r.tenantFilter("id", []interface{}{id})
+
+	var t Tenant
+	err := r.conn.DB.QueryRow(query+filter, args...).Scan(&t.ID, &t.Nombre, &t.Slug, &t.Activo, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("tenant %d no encontrado", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consultando tenant: %w", err)
+	}
+	return &t, nil
+}
+
+// CreateTenant crea una nueva organización
+func (r *Repository) CreateTenant(t *Tenant) error {
+	res, err := r.conn.DB.Exec(`INSERT INTO apicall_tenants (nombre, slug, activo) VALUES (?, ?, ?)`, t.Nombre, t.Slug, t.Activo)
+	if err != nil {
+		return fmt.Errorf("error creando tenant: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = int(id)
+	return nil
+}
+
+// UpdateTenant actualiza nombre, slug y estado de una organización
+func (r *Repository) UpdateTenant(t *Tenant) error {
+	result, err := r.conn.DB.Exec(`UPDATE apicall_tenants SET nombre = ?, slug = ?, activo = ? WHERE id = ?`, t.Nombre, t.Slug, t.Activo, t.ID)
+	if err != nil {
+		return fmt.Errorf("error actualizando tenant: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("tenant %d no encontrado", t.ID)
+	}
+	return nil
+}
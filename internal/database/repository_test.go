@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// testRepository abre la BD de APICALL_TEST_DSN (con las migraciones aplicadas, ej:
+// "apicall:pass@tcp(127.0.0.1:3306)/apicall_test?parseTime=true"); sin ella el test se omite
+func testRepository(t *testing.T) *Repository {
+	t.Helper()
+	dsn := os.Getenv("APICALL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("APICALL_TEST_DSN no configurada")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Repository{conn: &Connection{DB: db}}
+}
+
+func TestRegisterFailedLoginAfterLockoutExpired(t *testing.T) {
+	repo := testRepository(t)
+	const maxAttempts, lockoutMinutes = 5, 15
+
+	username := fmt.Sprintf("lockout-test-%d", time.Now().UnixNano())
+	if err := repo.CreateUser(&User{Username: username, PasswordHash: "x", Role: "user", TenantID: DefaultTenantID}); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := repo.conn.DB.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.conn.DB.Exec(`DELETE FROM users WHERE id = ?`, id) })
+
+	// Bloqueo vencido: contador al máximo y locked_at más viejo que lockout_minutes
+	if _, err := repo.conn.DB.Exec(`UPDATE users SET failed_logins = ?, locked_at = NOW() - INTERVAL ? MINUTE WHERE id = ?`,
+		maxAttempts, lockoutMinutes+1, id); err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := repo.IsUserLocked(id, lockoutMinutes); err != nil || locked {
+		t.Fatalf("IsUserLocked = %v, %v; se esperaba desbloqueada", locked, err)
+	}
+
+	// Un solo intento fallido no vuelve a bloquear la cuenta
+	locked, err := repo.RegisterFailedLogin(id, maxAttempts, lockoutMinutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		t.Fatal("RegisterFailedLogin bloqueó la cuenta tras un intento con el bloqueo vencido")
+	}
+	var failed int
+	var lockedAt sql.NullTime
+	if err := repo.conn.DB.QueryRow(`SELECT failed_logins, locked_at FROM users WHERE id = ?`, id).Scan(&failed, &lockedAt); err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 || lockedAt.Valid {
+		t.Fatalf("failed_logins = %d, locked_at = %v; se esperaba 1 y NULL", failed, lockedAt)
+	}
+	if locked, err := repo.IsUserLocked(id, lockoutMinutes); err != nil || locked {
+		t.Fatalf("IsUserLocked = %v, %v; se esperaba desbloqueada", locked, err)
+	}
+}
@@ -14,14 +14,17 @@ type ActiveCall struct {
 	CampaignID int
 	ProyectoID int
 	Trunk      string
+	Node       string // Nodo Asterisk que originó la llamada (vacío = spool / ARI)
 	Telefono   string
 	StartTime  time.Time
+	Slot       *Reservation // Slot del Channel Pool (nil = sin pool); se libera vía CallManager
 }
 
 // ActiveCallTracker tracks all active calls for correlation and cleanup
 type ActiveCallTracker struct {
 	calls   map[string]*ActiveCall // uniqueID (Internal UUID) -> ActiveCall
 	aliases map[string]string      // asteriskID -> uniqueID (Internal UUID)
+	byNode  map[string]int         // Llamadas activas por nodo Asterisk
 	mu      sync.RWMutex
 }
 
@@ -30,6 +33,7 @@ func NewActiveCallTracker() *ActiveCallTracker {
 	return &ActiveCallTracker{
 		calls:   make(map[string]*ActiveCall),
 		aliases: make(map[string]string),
+		byNode:  make(map[string]int),
 	}
 }
 
@@ -37,6 +41,9 @@ func NewActiveCallTracker() *ActiveCallTracker {
 func (t *ActiveCallTracker) Add(call *ActiveCall) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if _, exists := t.calls[call.UniqueID]; !exists && call.Node != "" {
+		t.byNode[call.Node]++
+	}
 	t.calls[call.UniqueID] = call
 	log.Printf("[ActiveCallTracker] Added call %s (contact=%d, campaign=%d)", 
 		call.UniqueID, call.ContactID, call.CampaignID)
@@ -56,6 +63,9 @@ func (t *ActiveCallTracker) Remove(uniqueID string) *ActiveCall {
 	call, ok := t.calls[uniqueID]
 	if ok {
 		delete(t.calls, uniqueID)
+		if call.Node != "" {
+			t.byNode[call.Node]--
+		}
 		
 		// Remove any alias pointing to this call
 		// This is O(N) unfortunately, but N (aliases) is small per call (0 or 1)
@@ -109,6 +119,26 @@ func (t *ActiveCallTracker) CountByTrunk() map[string]int {
 	return counts
 }
 
+// CountNode devuelve las llamadas activas originadas en un nodo Asterisk
+func (t *ActiveCallTracker) CountNode(node string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.byNode[node]
+}
+
+// CountProyecto devuelve las llamadas activas de un proyecto (cuota max_concurrent)
+func (t *ActiveCallTracker) CountProyecto(proyectoID int) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	n := 0
+	for _, call := range t.calls {
+		if call.ProyectoID == proyectoID {
+			n++
+		}
+	}
+	return n
+}
+
 // CountByCampaign returns call counts grouped by campaign
 func (t *ActiveCallTracker) CountByCampaign() map[int]int {
 	t.mu.RLock()
@@ -135,6 +165,20 @@ func (t *ActiveCallTracker) List() []*ActiveCall {
 	return calls
 }
 
+// Reservations returns the pool slots owned by tracked calls (for the pool audit)
+func (t *ActiveCallTracker) Reservations() map[*Reservation]bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	owned := make(map[*Reservation]bool, len(t.calls))
+	for _, call := range t.calls {
+		if call.Slot != nil {
+			owned[call.Slot] = true
+		}
+	}
+	return owned
+}
+
 // AddAlias adds an alias (e.g. Asterisk ID) for an existing call
 func (t *ActiveCallTracker) AddAlias(alias, uniqueID string) {
 	t.mu.Lock()
@@ -1,14 +1,15 @@
 package dialer
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"apicall/internal/ami"
 	"apicall/internal/database"
-	"apicall/internal/smartcid"
 )
 
 // DialRequest contains the specific details for a single call
@@ -19,39 +20,63 @@ type DialRequest struct {
 	Destination   string
 	Variables     map[string]string
 	Timeout       time.Duration
+	CallerID      string // Override de Caller ID (vacío = proyecto / Smart CID)
+	ExternalRef   string
+	CallbackOf    int64
+	Troncales     string          // Override de troncales de la campaña (vacío = las del proyecto)
+	Ctx           context.Context // Cancela el Originate pendiente (pausa de campaña, apagado); nil = sin cancelación
+	QueuedAt      time.Time       // Entrada en la cola del spool (cero = no pasó por la cola)
 }
 
-// AMIDialer handles synchronous dialing via AMI
+// AMIDialer handles synchronous dialing via AMI, repartiendo entre los nodos Asterisk
 type AMIDialer struct {
-	client      *ami.Client
-	pool        *ChannelPool
-	tracker     *ActiveCallTracker
-	repo        *database.Repository
-	scidGen     *smartcid.Generator
+	nodes       *NodeSet
+	pre         *PreDial
 
 	// Event Dispatching
 	mu          sync.RWMutex
 	pending     map[string]chan ami.Event
+	channels    map[string]string   // UUID interno -> canal originado, mientras el Originate está pendiente
+	cancelled   map[string]struct{} // Originates cancelados cuyo canal aún no apareció
 	stopChan    chan struct{}
 	running     bool
 }
 
-// NewAMIDialer creates a new dialer
-func NewAMIDialer(client *ami.Client, pool *ChannelPool, tracker *ActiveCallTracker, repo *database.Repository) *AMIDialer {
+// NewAMIDialer creates a new dialer sharing the pre-dial pipeline with the spooler
+func NewAMIDialer(nodes *NodeSet, pre *PreDial) *AMIDialer {
 	return &AMIDialer{
-		client:   client,
-		pool:     pool,
-		tracker:  tracker,
-		repo:     repo,
-		pending:  make(map[string]chan ami.Event),
-		stopChan: make(chan struct{}),
+		nodes:    nodes,
+		pre:      pre,
+		pending:   make(map[string]chan ami.Event),
+		channels:  make(map[string]string),
+		cancelled: make(map[string]struct{}),
+		stopChan:  make(chan struct{}),
 	}
 }
 
-// SetSmartCIDGenerator sets the Smart Caller ID generator
-func (d *AMIDialer) SetSmartCIDGenerator(gen *smartcid.Generator) {
-	d.scidGen = gen
-	log.Printf("[AMIDialer] Smart CID Generator configured")
+// Pool devuelve el pool de canales compartido con el pipeline de pre-marcación
+func (d *AMIDialer) Pool() *ChannelPool {
+	return d.pre.Pool()
+}
+
+// Quotas devuelve el control de cuotas por proyecto del pipeline de pre-marcación
+func (d *AMIDialer) Quotas() *Quotas {
+	return d.pre.Quotas()
+}
+
+// Attempts devuelve el control de intentos por número y día
+func (d *AMIDialer) Attempts() *AttemptCaps {
+	return d.pre.Attempts()
+}
+
+// AudioMissing indica si el audio principal del proyecto no existe en sound_path
+func (d *AMIDialer) AudioMissing(proyecto *database.Proyecto) bool {
+	return d.pre.AudioMissing(proyecto)
+}
+
+// Nodes devuelve los nodos Asterisk entre los que se reparten los originates
+func (d *AMIDialer) Nodes() *NodeSet {
+	return d.nodes
 }
 
 // Start begins the event listener loop
@@ -64,8 +89,10 @@ func (d *AMIDialer) Start() {
 	d.running = true
 	d.mu.Unlock()
 
-	go d.listenEvents()
-	log.Println("[AMIDialer] Started event listener")
+	for _, node := range d.nodes.Nodes() {
+		go d.listenEvents(node.Client)
+	}
+	log.Printf("[AMIDialer] Started event listener (%d nodos Asterisk)", len(d.nodes.Nodes()))
 }
 
 // Stop stops the dialer
@@ -79,19 +106,25 @@ func (d *AMIDialer) Stop() {
 	close(d.stopChan)
 }
 
-func (d *AMIDialer) listenEvents() {
-	// Single persistent subscription
-	events := d.client.Subscribe()
+func (d *AMIDialer) listenEvents(client *ami.Client) {
+	// Single persistent subscription per node (los ActionID son únicos entre nodos)
+	events := client.Subscribe()
 
 	for {
 		select {
 		case <-d.stopChan:
 			return
 		case event := <-events:
-			if event.Type == "OriginateResponse" {
+			switch event.Type {
+			case "OriginateResponse":
 				actionID := event.Fields["ActionID"]
 				if actionID != "" {
 					d.dispatch(actionID, event)
+					d.resolveCancelled(client, strings.TrimPrefix(actionID, "act-"), event)
+				}
+			case "VarSet":
+				if event.Fields["Variable"] == "APICALL_UNIQUEID" {
+					d.trackChannel(client, event.Fields["Value"], event.Fields["Channel"])
 				}
 			}
 		}
@@ -112,84 +145,114 @@ func (d *AMIDialer) dispatch(actionID string, event ami.Event) {
 	}
 }
 
-// Dial executes a call synchronously using AMI Originate
-func (d *AMIDialer) Dial(req DialRequest) error {
-	// 1. Acquire Channel Slot
-	if !d.pool.Acquire(req.Project.TroncalSalida) {
-		return fmt.Errorf("channel limit reached for trunk %s", req.Project.TroncalSalida)
+// trackChannel registra el canal de un Originate pendiente (VarSet de APICALL_UNIQUEID)
+// y lo cuelga si el Dial ya se canceló
+func (d *AMIDialer) trackChannel(client *ami.Client, uniqueID, channel string) {
+	if uniqueID == "" || channel == "" {
+		return
+	}
+	d.mu.Lock()
+	if _, pending := d.pending["act-"+uniqueID]; pending {
+		d.channels[uniqueID] = channel
 	}
+	_, cancelled := d.cancelled[uniqueID]
+	delete(d.cancelled, uniqueID)
+	d.mu.Unlock()
 
-	// Track if we need to release slot (set to false on successful answer/handover)
-	// Actually, tracker logic: Handover happens via VarSet/Hangup. 
-	// If Dial returns Success, the call IS active in Asterisk, so Tracker takes over.
-	// If Dial returns Fail, the call is DEAD, so WE must release.
-	releaseRequired := true
-	defer func() {
-		if releaseRequired {
-			d.pool.Release(req.Project.TroncalSalida)
-			// Also remove from tracker if it was added
-		}
-	}()
+	if cancelled {
+		d.hangup(client, uniqueID, channel)
+	}
+}
 
-	// 2. Setup ID and Tracking
-	internalUUID := fmt.Sprintf("%d-%d-%d", req.CampaignID, req.ContactID, time.Now().UnixNano())
-	actionID := "act-" + internalUUID
+// resolveCancelled cierra un Originate cancelado antes de que apareciera su canal: si se
+// contestó igual, lo cuelga
+func (d *AMIDialer) resolveCancelled(client *ami.Client, uniqueID string, event ami.Event) {
+	d.mu.Lock()
+	_, cancelled := d.cancelled[uniqueID]
+	delete(d.cancelled, uniqueID)
+	d.mu.Unlock()
 
-	// 3. Smart Caller ID Determination
-	callerID := req.Project.CallerID
-	if d.scidGen != nil && req.Project.SmartCIDActive {
-		generatedCID := d.scidGen.GetCallerID(req.Destination, callerID, req.Project.SmartCIDActive)
-		log.Printf("[AMIDialer] Smart CID: Proyecto=%d, Destino=%s, Original=%s, Generado=%s",
-			req.Project.ID, req.Destination, callerID, generatedCID)
-		callerID = generatedCID
-	} else {
-		log.Printf("[AMIDialer] Using static CID: Proyecto=%d, CID=%s (SmartGen=%v, SmartActive=%v)",
-			req.Project.ID, callerID, d.scidGen != nil, req.Project.SmartCIDActive)
+	if cancelled && event.Fields["Response"] == "Success" {
+		d.hangup(client, uniqueID, event.Fields["Channel"])
 	}
+}
 
-	// 4. Create CallLog in database for tracking
-	var campaignID *int
-	if req.CampaignID > 0 {
-		cid := req.CampaignID
-		campaignID = &cid
+// cancelOriginate cuelga el canal de un Originate que aún no se contestó; si Asterisk todavía
+// no lo creó, queda marcado para colgarlo en cuanto aparezca
+func (d *AMIDialer) cancelOriginate(client *ami.Client, uniqueID string) {
+	d.mu.Lock()
+	channel, known := d.channels[uniqueID]
+	if !known {
+		d.cancelled[uniqueID] = struct{}{}
 	}
+	d.mu.Unlock()
 
-	callLog := &database.CallLog{
-		ProyectoID:   req.Project.ID,
-		Telefono:     req.Destination,
-		Status:       "DIALING",
-		Interacciono: false,
-		CallerIDUsed: callerID,
-		CampaignID:   campaignID,
+	if known {
+		d.hangup(client, uniqueID, channel)
+	}
+}
+
+func (d *AMIDialer) hangup(client *ami.Client, uniqueID, channel string) {
+	if channel == "" {
+		return
+	}
+	if err := client.Hangup(channel, "16"); err != nil {
+		log.Printf("[AMIDialer] Error colgando %s (%s): %v", channel, uniqueID, err)
+		return
+	}
+	log.Printf("[AMIDialer] Originate cancelado: colgado %s (%s)", channel, uniqueID)
+}
+
+// Dial executes a call synchronously using AMI Originate. Cancelling req.Ctx (or stopping the
+// dialer) while the call rings aborts it: the log is closed as CANCEL and the channel hung up.
+func (d *AMIDialer) Dial(req DialRequest) error {
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("originate cancelado: %w", err)
 	}
 
-	logID, err := d.repo.CreateCallLog(callLog)
+	// 0. Nodo Asterisk: conectado y con menos llamadas activas
+	node, err := d.nodes.Pick()
 	if err != nil {
-		log.Printf("[AMIDialer] Error creating call log: %v", err)
-		// Continue anyway, don't fail the call just because logging failed
-	} else {
-		log.Printf("[AMIDialer] Created call log ID=%d for campaign=%d contact=%d callerID=%s", logID, req.CampaignID, req.ContactID, callerID)
+		return err
 	}
 
-	// Register in Tracker (Pending) - include LogID for later updates
-	call := &ActiveCall{
-		UniqueID:   internalUUID,
-		Trunk:      req.Project.TroncalSalida,
-		StartTime:  time.Now(),
-		CampaignID: req.CampaignID,
-		ContactID:  req.ContactID,
-		ProyectoID: req.Project.ID,
-		LogID:      logID,
+	// 1-4. Pipeline común: blacklist, troncal, Caller ID, slot de canal, log y tracking
+	pc, err := d.pre.Prepare(CallSpec{
+		Proyecto:    req.Project,
+		Telefono:    req.Destination,
+		ContactID:   req.ContactID,
+		CampaignID:  req.CampaignID,
+		Variables:   req.Variables,
+		CallerID:    req.CallerID,
+		ExternalRef: req.ExternalRef,
+		CallbackOf:  req.CallbackOf,
+		Troncales:   req.Troncales,
+		Node:        node.Name,
+		QueuedAt:    req.QueuedAt,
+	})
+	node.Done() // La llamada ya cuenta en el tracker (o se descartó)
+	if err != nil {
+		return err
 	}
-	d.tracker.Add(call)
+	log.Printf("[AMIDialer] Created call log ID=%d for campaign=%d contact=%d callerID=%s node=%s", pc.LogID, req.CampaignID, req.ContactID, pc.CallerID, node.Name)
 
+	// If Dial returns Success, the call IS active in Asterisk, so Tracker takes over.
+	// If Dial returns Fail, the call is DEAD, so WE must release.
+	releaseRequired := true
 	defer func() {
 		if releaseRequired {
-			d.tracker.Remove(internalUUID)
+			d.pre.Abort(pc, "FAILED")
 		}
 	}()
 
-	// 3. Prepare result channel
+	internalUUID := pc.UniqueID
+	actionID := "act-" + internalUUID
+
+	// 5. Prepare result channel
 	respChan := make(chan ami.Event, 1)
 	d.mu.Lock()
 	d.pending[actionID] = respChan
@@ -198,23 +261,12 @@ func (d *AMIDialer) Dial(req DialRequest) error {
 	defer func() {
 		d.mu.Lock()
 		delete(d.pending, actionID)
+		delete(d.channels, internalUUID)
 		d.mu.Unlock()
 	}()
 
-	// 4. Construct AMI Action
-	// Build channel string: SIP/trunk/prefix+number
-	// Assuming logic from spooler for prefix construction:
-	// "SIP/%s/%s%s", proyecto.TroncalSalida, proyecto.PrefijoSalida, telefono
-	// We need 'dest' passed fully formed or constructed here. 
-	// The Req has Destination. Assuming it's just the number.
-	// Let's assume Caller ensures full number format or we do it here.
-	// Sweeper logic adds prefix. Let's assume Req has full dial string or parts.
-	// Based on sweeper.go, it passes 'telefono'. 
-	// Standard: Local/number@context or SIP/trunk/number.
-	// Let's use Local channel for flexibility or direct endpoint if configured.
-	// Spooler uses: fmt.Sprintf("SIP/%s/%s%s", proyecto.TroncalSalida, proyecto.PrefijoSalida, telefono)
-	
-	dialString := fmt.Sprintf("SIP/%s/%s%s", req.Project.TroncalSalida, req.Project.PrefijoSalida, req.Destination)
+	// 6. Construct AMI Action
+	dialString := fmt.Sprintf("SIP/%s/%s", pc.Trunk, pc.DialNumber)
 	
 	vars := ""
 	for k, v := range req.Variables {
@@ -230,7 +282,16 @@ func (d *AMIDialer) Dial(req DialRequest) error {
 	vars += fmt.Sprintf(",APICALL_CAMPAIGN_ID=%d", req.CampaignID)
 	vars += fmt.Sprintf(",APICALL_CONTACT_ID=%d", req.ContactID)
 	// CRITICAL: Pass the LogID so AGI knows which log to update!
-	vars += fmt.Sprintf(",APICALL_LOG_ID=%d", logID)
+	vars += fmt.Sprintf(",APICALL_LOG_ID=%d", pc.LogID)
+	vars += fmt.Sprintf(",APICALL_TELEFONO=%s", req.Destination)
+	if node.AGIURL != "" {
+		vars += fmt.Sprintf(",APICALL_AGI_URL=%s", node.AGIURL)
+	}
+	// Trunk SIP headers go on their own Variable lines: values may contain commas
+	headers := ""
+	for _, k := range sortedKeys(pc.SIPHeaders) {
+		headers += fmt.Sprintf("Variable: %s=%s\r\n", k, pc.SIPHeaders[k])
+	}
 
 	action := fmt.Sprintf(
 		"Action: Originate\r\n"+
@@ -243,21 +304,24 @@ func (d *AMIDialer) Dial(req DialRequest) error {
 		"Timeout: %d\r\n"+
 		"Async: true\r\n"+
 		"Variable: %s\r\n"+
+		"%s"+
 		"\r\n",
 		actionID,
 		dialString,
 		"apicall_context", // Hardcoded context matching dialplan
-		callerID, // Smart CID if active, otherwise project CallerID
+		pc.CallerID, // Override, Smart CID if active, otherwise project CallerID
 		int(req.Timeout.Milliseconds()),
 		vars,
+		headers,
 	)
 
-	// 5. Send Action
-	if err := d.client.SendAction(action); err != nil {
+	// 7. Send Action
+	if err := node.Client.SendAction(action); err != nil {
 		return fmt.Errorf("failed to send originate: %w", err)
 	}
 
-	// 6. Wait for Response
+	// 8. Wait for Response
+	var cause error
 	select {
 	case event := <-respChan:
 		response := event.Fields["Response"]
@@ -274,5 +338,18 @@ func (d *AMIDialer) Dial(req DialRequest) error {
 	case <-time.After(req.Timeout + 5*time.Second):
 		// Use a buffer over expected timeout
 		return fmt.Errorf("originate timeout mismatch (no response from AMI)")
+
+	case <-ctx.Done():
+		cause = ctx.Err()
+
+	case <-d.stopChan:
+		cause = context.Canceled
 	}
+
+	// 9. Cancelled while ringing: close the log and release the slot before hanging up,
+	// so the Hangup event that follows is not handled as a regular call
+	releaseRequired = false
+	d.pre.Abort(pc, "CANCEL")
+	d.cancelOriginate(node.Client, internalUUID)
+	return fmt.Errorf("originate cancelado: %w", cause)
 }
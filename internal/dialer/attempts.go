@@ -0,0 +1,139 @@
+package dialer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// ErrAttemptCap se devuelve cuando el número alcanzó su máximo de intentos del día (en todos los proyectos)
+var ErrAttemptCap = errors.New("número alcanzó el máximo de intentos del día")
+
+// AttemptCapKey es la clave de apicall_config con el máximo global de intentos por número y día (0 = sin límite)
+const AttemptCapKey = "max_number_attempts_day"
+
+// AttemptStatus es el consumo de intentos de un número en el día
+type AttemptStatus struct {
+	Telefono string    `json:"telefono"`
+	Limit    int       `json:"limit"` // 0 = sin límite
+	Attempts int       `json:"attempts"`
+	ResetAt  time.Time `json:"reset_at"` // Próxima medianoche en la zona del proyecto
+}
+
+// Exceeded indica si el número ya no admite más intentos hoy
+func (s *AttemptStatus) Exceeded() bool {
+	return s.Limit > 0 && s.Attempts >= s.Limit
+}
+
+// Err devuelve ErrAttemptCap con el detalle, o nil si el número admite otro intento
+func (s *AttemptStatus) Err() error {
+	if s.Exceeded() {
+		return fmt.Errorf("%w: %d/%d intentos hoy", ErrAttemptCap, s.Attempts, s.Limit)
+	}
+	return nil
+}
+
+// AttemptCaps limita los intentos por número y día sumando las llamadas de todos los proyectos
+// (contadas en el log). El límite es el menor entre el global de apicall_config y el del proyecto.
+type AttemptCaps struct {
+	repo *database.Repository
+
+	mu      sync.Mutex
+	pending map[string]int // Intentos reservados cuyo log aún no se crea
+}
+
+// NewAttemptCaps crea el control de intentos por número
+func NewAttemptCaps(repo *database.Repository) *AttemptCaps {
+	return &AttemptCaps{repo: repo, pending: make(map[string]int)}
+}
+
+// Limit devuelve el máximo de intentos por número y día que aplica al proyecto (0 = sin límite)
+func (a *AttemptCaps) Limit(proyecto *database.Proyecto) int {
+	limit := proyecto.MaxNumberAttempts
+	if val, err := a.repo.GetConfig(AttemptCapKey); err == nil && val != "" {
+		if global, err := strconv.Atoi(val); err == nil && global > 0 && (limit <= 0 || global < limit) {
+			limit = global
+		}
+	}
+	return max(limit, 0)
+}
+
+// Status devuelve los intentos del número en el día del proyecto
+func (a *AttemptCaps) Status(proyecto *database.Proyecto, telefono string) (*AttemptStatus, error) {
+	dayStart := projectDayStart(proyecto, time.Now())
+	status := &AttemptStatus{
+		Telefono: telefono,
+		Limit:    a.Limit(proyecto),
+		ResetAt:  dayStart.AddDate(0, 0, 1),
+	}
+	if status.Limit == 0 {
+		return status, nil
+	}
+	n, err := a.repo.CountNumberCallsSince(telefono, dayStart)
+	if err != nil {
+		return status, err
+	}
+	a.mu.Lock()
+	status.Attempts = n + a.pending[telefono]
+	a.mu.Unlock()
+	return status, nil
+}
+
+// Reserve verifica el límite y cuenta el intento hasta que su log quede creado. Si no devuelve error
+// el llamador debe invocar Done. Si la BD no responde se permite la llamada, como en las cuotas.
+func (a *AttemptCaps) Reserve(proyecto *database.Proyecto, telefono string) error {
+	limit := a.Limit(proyecto)
+	n := 0
+	if limit > 0 {
+		var err error
+		if n, err = a.repo.CountNumberCallsSince(telefono, projectDayStart(proyecto, time.Now())); err != nil {
+			log.Printf("[Attempts] WARNING: sin conteo de intentos para %s: %v", telefono, err)
+			limit = 0
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if attempts := n + a.pending[telefono]; limit > 0 && attempts >= limit {
+		return fmt.Errorf("%w: %d/%d intentos hoy", ErrAttemptCap, attempts, limit)
+	}
+	a.pending[telefono]++
+	return nil
+}
+
+// Done libera la reserva tomada en Reserve (el intento ya cuenta en el log, o no se marcó)
+func (a *AttemptCaps) Done(telefono string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending[telefono] <= 1 {
+		delete(a.pending, telefono)
+		return
+	}
+	a.pending[telefono]--
+}
+
+// Counts devuelve el límite del proyecto y los intentos de hoy de cada número del lote (sin
+// consultar la BD si no hay límite). Lo usan la API bulk y el Sweeper para descartar antes de encolar.
+func (a *AttemptCaps) Counts(proyecto *database.Proyecto, telefonos []string) (int, map[string]int, error) {
+	limit := a.Limit(proyecto)
+	if limit == 0 || len(telefonos) == 0 {
+		return limit, nil, nil
+	}
+	counts, err := a.repo.CountNumbersCallsSince(telefonos, projectDayStart(proyecto, time.Now()))
+	if err != nil {
+		return 0, nil, err
+	}
+	a.mu.Lock()
+	for _, tel := range telefonos {
+		if n := a.pending[tel]; n > 0 {
+			counts[tel] += n
+		}
+	}
+	a.mu.Unlock()
+	return limit, counts, nil
+}
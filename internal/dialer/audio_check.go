@@ -0,0 +1,47 @@
+package dialer
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/audio"
+)
+
+// audioCheckTTL es cada cuánto se vuelve a comprobar en disco un audio de proyecto
+const audioCheckTTL = 30 * time.Second
+
+// audioCheck recuerda qué audios de proyecto faltan en sound_path para no tocar el disco en cada llamada
+type audioCheck struct {
+	soundPath string
+
+	mu      sync.Mutex
+	results map[string]audioResult
+}
+
+type audioResult struct {
+	missing bool
+	at      time.Time
+}
+
+func newAudioCheck(soundPath string) *audioCheck {
+	return &audioCheck{soundPath: soundPath, results: make(map[string]audioResult)}
+}
+
+// missing indica si ref no existe; la alerta se registra como mucho una vez por audioCheckTTL
+func (a *audioCheck) missing(ref string) bool {
+	if a == nil || ref == "" {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r, ok := a.results[ref]; ok && time.Since(r.at) < audioCheckTTL {
+		return r.missing
+	}
+	missing := audio.Missing(a.soundPath, ref)
+	a.results[ref] = audioResult{missing: missing, at: time.Now()}
+	if missing {
+		log.Printf("[PreDial] ALERTA: el audio '%s' no existe en %s, no se marcan llamadas de sus proyectos (NO_AUDIO)", ref, a.soundPath)
+	}
+	return missing
+}
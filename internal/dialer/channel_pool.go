@@ -4,16 +4,46 @@ import (
 	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ChannelPool manages concurrent call limits
-// It tracks active channels globally and per-trunk to prevent system overload
+// It tracks active channels globally and per-trunk to prevent system overload.
+// Every slot is a Reservation owned by one call (ActiveCall.Slot) and released through CallManager.
 type ChannelPool struct {
-	maxGlobal      int32            // Maximum global concurrent calls
-	maxPerTrunk    int32            // Maximum calls per trunk
-	activeGlobal   int32            // Current global active calls (atomic)
-	perTrunk       sync.Map         // trunk -> *int32 (atomic counter)
-	mu             sync.RWMutex
+	maxGlobal    int32    // Maximum global concurrent calls
+	maxPerTrunk  int32    // Maximum calls per trunk
+	activeGlobal int32    // Current global active calls (atomic)
+	perTrunk     sync.Map // trunk -> *int32 (atomic counter)
+	mu           sync.RWMutex
+	held         map[*Reservation]struct{} // Unreleased reservations (source of truth for the audit)
+
+	leaked           atomic.Int64 // Reservations released by the audit (no call owned them)
+	doubleReleases   atomic.Int64 // Release calls on an already released reservation
+	driftCorrections atomic.Int64 // Audits that had to reset the counters
+}
+
+// Reservation is a channel slot held by one call. It is stored on the ActiveCall and released
+// exactly once; a second Release is counted and ignored instead of freeing someone else's slot.
+type Reservation struct {
+	Trunk    string
+	pool     *ChannelPool
+	acquired time.Time
+	released atomic.Bool
+}
+
+// Release frees the slot; returns false if it was already released
+func (r *Reservation) Release() bool {
+	if r == nil {
+		return false
+	}
+	if !r.released.CompareAndSwap(false, true) {
+		r.pool.doubleReleases.Add(1)
+		log.Printf("[ChannelPool] WARNING: Double release of a '%s' slot ignored", r.Trunk)
+		return false
+	}
+	r.pool.release(r)
+	return true
 }
 
 // NewChannelPool creates a new channel pool with specified limits
@@ -21,93 +51,135 @@ func NewChannelPool(maxGlobal, maxPerTrunk int) *ChannelPool {
 	return &ChannelPool{
 		maxGlobal:   int32(maxGlobal),
 		maxPerTrunk: int32(maxPerTrunk),
+		held:        make(map[*Reservation]struct{}),
 	}
 }
 
-// Acquire attempts to acquire a channel slot for the given trunk
-// Returns true if successful, false if limits would be exceeded
-func (cp *ChannelPool) Acquire(trunk string) bool {
+// Reserve takes a channel slot for the given trunk
+// Returns nil if the global or per-trunk limit would be exceeded
+func (cp *ChannelPool) Reserve(trunk string) *Reservation {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
 	// Check global limit first
 	current := atomic.LoadInt32(&cp.activeGlobal)
-	if current >= cp.maxGlobal {
+	if current >= atomic.LoadInt32(&cp.maxGlobal) {
 		log.Printf("[ChannelPool] Global limit reached: %d/%d", current, cp.maxGlobal)
-		return false
+		return nil
 	}
 
-	// Get or create per-trunk counter
-	counterI, _ := cp.perTrunk.LoadOrStore(trunk, new(int32))
-	counter := counterI.(*int32)
-
 	// Check per-trunk limit
+	counter := cp.trunkCounter(trunk)
 	trunkCurrent := atomic.LoadInt32(counter)
-	if trunkCurrent >= cp.maxPerTrunk {
+	if trunkCurrent >= atomic.LoadInt32(&cp.maxPerTrunk) {
 		log.Printf("[ChannelPool] Trunk '%s' limit reached: %d/%d", trunk, trunkCurrent, cp.maxPerTrunk)
-		return false
-	}
-
-	// Atomically increment both counters
-	// Use CompareAndSwap to prevent race conditions
-	for {
-		current = atomic.LoadInt32(&cp.activeGlobal)
-		if current >= cp.maxGlobal {
-			return false
-		}
-		if atomic.CompareAndSwapInt32(&cp.activeGlobal, current, current+1) {
-			break
-		}
-	}
-
-	for {
-		trunkCurrent = atomic.LoadInt32(counter)
-		if trunkCurrent >= cp.maxPerTrunk {
-			// Rollback global increment
-			atomic.AddInt32(&cp.activeGlobal, -1)
-			return false
-		}
-		if atomic.CompareAndSwapInt32(counter, trunkCurrent, trunkCurrent+1) {
-			break
-		}
+		return nil
 	}
 
+	r := cp.hold(trunk, counter)
 	log.Printf("[ChannelPool] Acquired slot: trunk='%s' (global: %d/%d, trunk: %d/%d)",
 		trunk,
 		atomic.LoadInt32(&cp.activeGlobal), cp.maxGlobal,
 		atomic.LoadInt32(counter), cp.maxPerTrunk)
+	return r
+}
 
-	return true
+// Adopt takes a slot for a channel that is already in use, ignoring the limits
+// (calls recovered after a restart are live whether or not they fit)
+func (cp *ChannelPool) Adopt(trunk string) *Reservation {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.hold(trunk, cp.trunkCounter(trunk))
 }
 
-// Release releases a channel slot for the given trunk
-func (cp *ChannelPool) Release(trunk string) {
-	// Decrement global counter
-	newGlobal := atomic.AddInt32(&cp.activeGlobal, -1)
-	if newGlobal < 0 {
-		// Safety: prevent negative counts
+func (cp *ChannelPool) trunkCounter(trunk string) *int32 {
+	counterI, _ := cp.perTrunk.LoadOrStore(trunk, new(int32))
+	return counterI.(*int32)
+}
+
+// hold registers a reservation and increments both counters (cp.mu held)
+func (cp *ChannelPool) hold(trunk string, counter *int32) *Reservation {
+	atomic.AddInt32(&cp.activeGlobal, 1)
+	atomic.AddInt32(counter, 1)
+	r := &Reservation{Trunk: trunk, pool: cp, acquired: time.Now()}
+	cp.held[r] = struct{}{}
+	return r
+}
+
+// release decrements the counters of a reservation (called once, from Reservation.Release)
+func (cp *ChannelPool) release(r *Reservation) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	delete(cp.held, r)
+
+	// Safety: prevent negative counts (the audit corrects any drift)
+	if atomic.AddInt32(&cp.activeGlobal, -1) < 0 {
 		atomic.StoreInt32(&cp.activeGlobal, 0)
 		log.Printf("[ChannelPool] WARNING: Global counter went negative, reset to 0")
 	}
+	counter := cp.trunkCounter(r.Trunk)
+	if atomic.AddInt32(counter, -1) < 0 {
+		atomic.StoreInt32(counter, 0)
+		log.Printf("[ChannelPool] WARNING: Trunk '%s' counter went negative, reset to 0", r.Trunk)
+	}
+	log.Printf("[ChannelPool] Released slot: trunk='%s' (global: %d/%d, trunk: %d/%d)",
+		r.Trunk,
+		atomic.LoadInt32(&cp.activeGlobal), cp.maxGlobal,
+		atomic.LoadInt32(counter), cp.maxPerTrunk)
+}
+
+// Audit compares the held reservations with the ones owned by tracked calls. Reservations older
+// than grace that no call owns are leaks and get released; then the counters are recomputed from
+// the held set, so any drift is corrected. Returns the number of leaked reservations.
+func (cp *ChannelPool) Audit(owned map[*Reservation]bool, grace time.Duration) int {
+	cp.mu.RLock()
+	var leaks []*Reservation
+	for r := range cp.held {
+		if !owned[r] && time.Since(r.acquired) > grace {
+			leaks = append(leaks, r)
+		}
+	}
+	cp.mu.RUnlock()
 
-	// Decrement per-trunk counter
-	if counterI, ok := cp.perTrunk.Load(trunk); ok {
-		counter := counterI.(*int32)
-		newTrunk := atomic.AddInt32(counter, -1)
-		if newTrunk < 0 {
-			atomic.StoreInt32(counter, 0)
-			log.Printf("[ChannelPool] WARNING: Trunk '%s' counter went negative, reset to 0", trunk)
+	for _, r := range leaks {
+		log.Printf("[ChannelPool] WARNING: Leaked '%s' slot (held %v without a call), releasing", r.Trunk, time.Since(r.acquired).Round(time.Second))
+		if r.released.CompareAndSwap(false, true) {
+			cp.release(r)
+			cp.leaked.Add(1)
 		}
-		log.Printf("[ChannelPool] Released slot: trunk='%s' (global: %d/%d, trunk: %d/%d)",
-			trunk,
-			atomic.LoadInt32(&cp.activeGlobal), cp.maxGlobal,
-			atomic.LoadInt32(counter), cp.maxPerTrunk)
 	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	expected := make(map[string]int32)
+	for r := range cp.held {
+		expected[r.Trunk]++
+	}
+	drift := atomic.LoadInt32(&cp.activeGlobal) != int32(len(cp.held))
+	atomic.StoreInt32(&cp.activeGlobal, int32(len(cp.held)))
+	cp.perTrunk.Range(func(key, value interface{}) bool {
+		counter := value.(*int32)
+		if atomic.SwapInt32(counter, expected[key.(string)]) != expected[key.(string)] {
+			drift = true
+		}
+		return true
+	})
+	if drift {
+		cp.driftCorrections.Add(1)
+		log.Printf("[ChannelPool] WARNING: Counters out of sync with reservations, corrected (global: %d)", len(cp.held))
+	}
+	return len(leaks)
 }
 
 // Stats returns current usage statistics
 func (cp *ChannelPool) Stats() PoolStats {
 	stats := PoolStats{
-		MaxGlobal:    int(cp.maxGlobal),
-		ActiveGlobal: int(atomic.LoadInt32(&cp.activeGlobal)),
-		PerTrunk:     make(map[string]TrunkStats),
+		MaxGlobal:        int(atomic.LoadInt32(&cp.maxGlobal)),
+		ActiveGlobal:     int(atomic.LoadInt32(&cp.activeGlobal)),
+		PerTrunk:         make(map[string]TrunkStats),
+		Leaked:           cp.leaked.Load(),
+		DoubleReleases:   cp.doubleReleases.Load(),
+		DriftCorrections: cp.driftCorrections.Load(),
 	}
 
 	cp.perTrunk.Range(func(key, value interface{}) bool {
@@ -115,7 +187,7 @@ func (cp *ChannelPool) Stats() PoolStats {
 		counter := value.(*int32)
 		stats.PerTrunk[trunk] = TrunkStats{
 			Active: int(atomic.LoadInt32(counter)),
-			Max:    int(cp.maxPerTrunk),
+			Max:    int(atomic.LoadInt32(&cp.maxPerTrunk)),
 		}
 		return true
 	})
@@ -125,15 +197,18 @@ func (cp *ChannelPool) Stats() PoolStats {
 
 // PoolStats contains pool statistics
 type PoolStats struct {
-	MaxGlobal    int
-	ActiveGlobal int
-	PerTrunk     map[string]TrunkStats
+	MaxGlobal        int                   `json:"max_global"`
+	ActiveGlobal     int                   `json:"active_global"`
+	PerTrunk         map[string]TrunkStats `json:"per_trunk"`
+	Leaked           int64                 `json:"leaked"`            // Slots released by the audit
+	DoubleReleases   int64                 `json:"double_releases"`   // Repeated releases ignored
+	DriftCorrections int64                 `json:"drift_corrections"` // Counter resets by the audit
 }
 
 // TrunkStats contains per-trunk statistics
 type TrunkStats struct {
-	Active int
-	Max    int
+	Active int `json:"active"`
+	Max    int `json:"max"`
 }
 
 // Available returns how many slots are available globally
@@ -161,6 +236,20 @@ func (cp *ChannelPool) AvailableForTrunk(trunk string) int {
 	return available
 }
 
+// ActiveForTrunk returns how many slots a trunk is using
+func (cp *ChannelPool) ActiveForTrunk(trunk string) int {
+	counterI, ok := cp.perTrunk.Load(trunk)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt32(counterI.(*int32)))
+}
+
+// MaxPerTrunk returns the per-trunk limit
+func (cp *ChannelPool) MaxPerTrunk() int {
+	return int(atomic.LoadInt32(&cp.maxPerTrunk))
+}
+
 // SetMaxGlobal updates the global limit dynamically
 func (cp *ChannelPool) SetMaxGlobal(max int) {
 	atomic.StoreInt32(&cp.maxGlobal, int32(max))
@@ -0,0 +1,47 @@
+package dialer
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+const (
+	// quarantineTTL es cada cuánto se recargan los Caller IDs en cuarentena
+	quarantineTTL = 30 * time.Second
+	// smartCIDRetries son los Caller IDs que se generan antes de caer al del proyecto si salen en cuarentena
+	smartCIDRetries = 5
+)
+
+// cidQuarantine cachea los Caller IDs en cuarentena (se recarga como mucho cada quarantineTTL)
+type cidQuarantine struct {
+	repo *database.Repository
+
+	mu       sync.Mutex
+	cids     map[string]bool
+	loadedAt time.Time
+}
+
+func newCIDQuarantine(repo *database.Repository) *cidQuarantine {
+	return &cidQuarantine{repo: repo}
+}
+
+// has indica si el Caller ID está en cuarentena. Si la consulta falla se siguen usando los últimos valores.
+func (c *cidQuarantine) has(cid string) bool {
+	if cid == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loadedAt) >= quarantineTTL {
+		c.loadedAt = time.Now()
+		if cids, err := c.repo.GetQuarantinedCIDs(); err != nil {
+			log.Printf("[PreDial] Error leyendo Caller IDs en cuarentena: %v", err)
+		} else {
+			c.cids = cids
+		}
+	}
+	return c.cids[cid]
+}
@@ -0,0 +1,54 @@
+package dialer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"apicall/internal/database"
+)
+
+// ErrDestinationDenied se devuelve cuando el número no cumple las reglas de prefijos del proyecto
+var ErrDestinationDenied = errors.New("destino no permitido")
+
+// ParsePrefixes normaliza una lista de prefijos separados por coma (solo dígitos, sin repetidos)
+func ParsePrefixes(raw string) ([]string, error) {
+	prefixes := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimPrefix(strings.TrimSpace(p), "+")
+		if p == "" || seen[p] {
+			continue
+		}
+		for _, c := range p {
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("prefijo inválido '%s' (solo dígitos)", p)
+			}
+		}
+		seen[p] = true
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// CheckDestination aplica las reglas de prefijos del proyecto al número normalizado: los prefijos
+// bloqueados se rechazan siempre y, si hay permitidos, el número debe empezar por alguno
+func CheckDestination(proyecto *database.Proyecto, telefono string) error {
+	if prefix := matchPrefix(proyecto.PrefijosBloqueados, telefono); prefix != "" {
+		return fmt.Errorf("%w: prefijo %s bloqueado en el proyecto", ErrDestinationDenied, prefix)
+	}
+	if strings.TrimSpace(proyecto.PrefijosPermitidos) != "" && matchPrefix(proyecto.PrefijosPermitidos, telefono) == "" {
+		return fmt.Errorf("%w: el número no empieza por un prefijo permitido del proyecto", ErrDestinationDenied)
+	}
+	return nil
+}
+
+// matchPrefix devuelve el prefijo de la lista por el que empieza telefono (vacío si ninguno)
+func matchPrefix(list, telefono string) string {
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" && strings.HasPrefix(telefono, p) {
+			return p
+		}
+	}
+	return ""
+}
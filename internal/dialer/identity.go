@@ -0,0 +1,166 @@
+package dialer
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+const (
+	// identityTTL es cada cuánto se recarga la identidad SIP de las troncales
+	identityTTL = 30 * time.Second
+	// MaxSIPHeaders es la cantidad máxima de headers propios por troncal
+	MaxSIPHeaders = 10
+)
+
+// reservedSIPHeaders los arma Asterisk: reemplazarlos rompe el diálogo
+var reservedSIPHeaders = map[string]bool{
+	"via": true, "from": true, "to": true, "call-id": true, "cseq": true, "contact": true,
+	"max-forwards": true, "content-length": true, "content-type": true, "route": true, "record-route": true,
+}
+
+// SIPHeader es un header SIP adicional de una troncal
+type SIPHeader struct {
+	Nombre string
+	Valor  string
+}
+
+// IsAttestation indica si s es un nivel de atestación STIR/SHAKEN válido (vacío = sin atestación)
+func IsAttestation(s string) bool {
+	switch s {
+	case "", "A", "B", "C":
+		return true
+	}
+	return false
+}
+
+// ParseSIPHeaders interpreta los headers de una troncal, uno por línea "Nombre: valor". El valor admite
+// {callerid}, {destino}, {host} y {attestation}, que se reemplazan en cada llamada.
+func ParseSIPHeaders(spec string) ([]SIPHeader, error) {
+	var headers []SIPHeader
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("header inválido '%s' (formato: Nombre: valor)", line)
+		}
+		nombre, valor := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if !isHeaderName(nombre) {
+			return nil, fmt.Errorf("nombre de header inválido '%s'", nombre)
+		}
+		if reservedSIPHeaders[strings.ToLower(nombre)] {
+			return nil, fmt.Errorf("el header %s lo arma Asterisk y no se puede reemplazar", nombre)
+		}
+		if valor == "" {
+			return nil, fmt.Errorf("header %s sin valor", nombre)
+		}
+		headers = append(headers, SIPHeader{Nombre: nombre, Valor: valor})
+	}
+	if len(headers) > MaxSIPHeaders {
+		return nil, fmt.Errorf("máximo %d headers por troncal", MaxSIPHeaders)
+	}
+	return headers, nil
+}
+
+// isHeaderName valida un nombre de header SIP (token: letras, dígitos y -.!%*_+`'~)
+func isHeaderName(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-.!%*_+`'~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SIPHeaderVars arma las variables SIPADDHEADERnn que chan_sip agrega al INVITE de la llamada:
+// P-Asserted-Identity si la troncal lo pide y sus headers propios, con los valores de la llamada
+func SIPHeaderVars(t *database.Troncal, callerID, destino string) map[string]string {
+	if t == nil {
+		return nil
+	}
+	var headers []SIPHeader
+	if t.PAI && callerID != "" {
+		headers = append(headers, SIPHeader{Nombre: "P-Asserted-Identity", Valor: "<sip:{callerid}@{host}>"})
+	}
+	custom, err := ParseSIPHeaders(t.SIPHeaders)
+	if err != nil {
+		log.Printf("[PreDial] WARNING: Headers SIP inválidos en la troncal %s: %v", t.Nombre, err)
+	}
+	headers = append(headers, custom...)
+	if len(headers) == 0 {
+		return nil
+	}
+
+	replacer := strings.NewReplacer(
+		"{callerid}", callerID,
+		"{destino}", destino,
+		"{host}", t.Host,
+		"{attestation}", t.Attestation,
+	)
+	vars := make(map[string]string, len(headers))
+	for i, h := range headers {
+		valor := strings.Map(dropNewline, replacer.Replace(h.Valor)) // Una variable por línea en .call y AMI
+		vars[fmt.Sprintf("SIPADDHEADER%02d", i+1)] = h.Nombre + ": " + valor
+	}
+	return vars
+}
+
+// sortedKeys devuelve las variables en orden estable (facilita el diagnóstico del Originate)
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dropNewline(r rune) rune {
+	if r == '\r' || r == '\n' {
+		return -1
+	}
+	return r
+}
+
+// trunkIdentities cachea la identidad SIP de las troncales (se recarga como mucho cada identityTTL)
+type trunkIdentities struct {
+	repo *database.Repository
+
+	mu       sync.Mutex
+	trunks   map[string]*database.Troncal
+	loadedAt time.Time
+}
+
+func newTrunkIdentities(repo *database.Repository) *trunkIdentities {
+	return &trunkIdentities{repo: repo}
+}
+
+// get devuelve la troncal si tiene identidad configurada (nil = ninguna). Si la consulta falla se
+// siguen usando los últimos valores.
+func (c *trunkIdentities) get(trunk string) *database.Troncal {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loadedAt) >= identityTTL {
+		c.loadedAt = time.Now()
+		if trunks, err := c.repo.GetTroncalIdentities(); err != nil {
+			log.Printf("[PreDial] Error leyendo identidad de troncales: %v", err)
+		} else {
+			c.trunks = trunks
+		}
+	}
+	return c.trunks[trunk]
+}
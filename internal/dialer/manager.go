@@ -2,6 +2,7 @@ package dialer
 
 import (
 	"log"
+	"time"
 )
 
 // CallManager coordinates between ChannelPool and ActiveCallTracker
@@ -33,6 +34,18 @@ func (m *CallManager) GetContactID(uniqueID string) (int64, bool) {
 	return 0, false
 }
 
+// GetLogID returns the call_log ID for a given uniqueID (internal UUID or alias)
+func (m *CallManager) GetLogID(uniqueID string) (int64, bool) {
+	call := m.tracker.Get(uniqueID)
+	if call == nil {
+		call = m.tracker.GetByAlias(uniqueID)
+	}
+	if call != nil && call.LogID > 0 {
+		return call.LogID, true
+	}
+	return 0, false
+}
+
 // AddAlias links an alias (e.g. Asterisk ID) to an internal uniqueID
 func (m *CallManager) AddAlias(alias, uniqueID string) {
 	m.tracker.AddAlias(alias, uniqueID)
@@ -40,30 +53,49 @@ func (m *CallManager) AddAlias(alias, uniqueID string) {
 
 // Release releases the channel slot and removes tracking
 func (m *CallManager) Release(uniqueID string) {
-	// Resolve if alias
+	if call := m.release(uniqueID); call != nil {
+		log.Printf("[CallManager] Released call %s (trunk=%s)", call.UniqueID, call.Trunk)
+	} else {
+		// Already released by another path (FastAGI, ARI, reconciler) or never tracked
+		log.Printf("[CallManager] WARNING: Requested release for unknown call %s", uniqueID)
+	}
+}
+
+// release removes the call (by internal UUID or alias) from the tracker and frees its slot.
+// It is the only path that releases pool slots of tracked calls; returns nil if not tracked.
+func (m *CallManager) release(uniqueID string) *ActiveCall {
 	targetID := uniqueID
-	call := m.tracker.GetByAlias(uniqueID)
-	if call != nil {
+	if call := m.tracker.GetByAlias(uniqueID); call != nil {
 		targetID = call.UniqueID
-	} else {
-		// Check if it's a direct ID
-		call = m.tracker.Get(uniqueID)
 	}
 
-	// Remove from tracker
-	// Remove returns the call object, so we can get Trunk info if we didn't have it
-	removedCall := m.tracker.Remove(targetID)
-	
-	if removedCall != nil {
-		// Release slot based on Trunk
-		m.pool.Release(removedCall.Trunk)
-		log.Printf("[CallManager] Released call %s (trunk=%s)", targetID, removedCall.Trunk)
-	} else {
-		// If we couldn't find it in tracker, we might still need to release if we knew the trunk
-		// But without tracker we don't know which trunk it used.
-		// However, ChannelPool Release takes a trunk name.
-		// If we don't have the call, we can't release the specific trunk slot.
-		// This implies we rely entirely on Tracker to know what to release.
-		log.Printf("[CallManager] WARNING: Requested release for unknown call %s", uniqueID)
+	call := m.tracker.Remove(targetID)
+	if call != nil {
+		call.Slot.Release()
+	}
+	return call
+}
+
+// Adopt tracks a call that is already live (recovered after a restart): its slot is taken
+// regardless of the pool limits
+func (m *CallManager) Adopt(call *ActiveCall) {
+	if m.pool != nil {
+		call.Slot = m.pool.Adopt(call.Trunk)
+	}
+	m.tracker.Add(call)
+}
+
+// poolAuditGrace is how long a reservation may exist without a tracked call (PreDial reserves
+// the slot before creating the log and tracking the call)
+const poolAuditGrace = time.Minute
+
+// Audit compares the pool with the tracker: slots no tracked call owns are released and the
+// counters are corrected (see ChannelPool.Audit)
+func (m *CallManager) Audit() {
+	if m.pool == nil {
+		return
+	}
+	if leaked := m.pool.Audit(m.tracker.Reservations(), poolAuditGrace); leaked > 0 {
+		log.Printf("[CallManager] Pool audit released %d leaked slots", leaked)
 	}
 }
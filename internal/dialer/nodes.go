@@ -0,0 +1,165 @@
+package dialer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"apicall/internal/ami"
+)
+
+// ErrNoNodes se devuelve cuando ningún nodo Asterisk está conectado con capacidad libre
+var ErrNoNodes = errors.New("no hay nodos Asterisk disponibles")
+
+// Node es un servidor Asterisk al que el AMIDialer puede enviar originates
+type Node struct {
+	Name        string
+	Client      *ami.Client
+	AGIURL      string // FastAGI de apicall visto desde el nodo (vacío = el del dialplan)
+	MaxChannels int    // 0 = sin límite propio (solo aplica el Channel Pool global)
+
+	pending atomic.Int32 // Originates elegidos que aún no llegan al tracker
+}
+
+// NodeStats es el estado de un nodo para monitoreo
+type NodeStats struct {
+	Name        string `json:"name"`
+	Connected   bool   `json:"connected"`
+	Active      int    `json:"active"`
+	MaxChannels int    `json:"max_channels"`
+}
+
+// NodePeers son los peers SIP que reporta un nodo (estado de las troncales)
+type NodePeers struct {
+	Node          string
+	Peers         []ami.PeerStatus
+	Registrations []ami.Registration // chan_sip: registros salientes sin peer asociado
+	Err           error              // Nodo desconectado o consulta fallida
+}
+
+// NodeSet reparte los originates entre nodos Asterisk: el nodo conectado con menos
+// llamadas activas (least-connections), respetando el max_channels de cada uno.
+type NodeSet struct {
+	nodes   []*Node
+	tracker *ActiveCallTracker
+	next    atomic.Uint32 // Desempate round-robin
+}
+
+// NewNodeSet crea el conjunto de nodos; el primero es el principal
+func NewNodeSet(tracker *ActiveCallTracker, nodes ...*Node) *NodeSet {
+	return &NodeSet{nodes: nodes, tracker: tracker}
+}
+
+// Nodes devuelve los nodos registrados
+func (s *NodeSet) Nodes() []*Node {
+	return s.nodes
+}
+
+// Primary devuelve el nodo principal (sección ami)
+func (s *NodeSet) Primary() *Node {
+	if len(s.nodes) == 0 {
+		return nil
+	}
+	return s.nodes[0]
+}
+
+// AnyConnected indica si al menos un nodo tiene sesión AMI
+func (s *NodeSet) AnyConnected() bool {
+	for _, n := range s.nodes {
+		if n.Client.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick elige el nodo para un originate y lo reserva hasta que la llamada quede en el
+// tracker: el llamador debe invocar Done sobre el nodo devuelto.
+func (s *NodeSet) Pick() (*Node, error) {
+	var best *Node
+	bestLoad := 0
+	start := int(s.next.Add(1))
+	for i := range s.nodes {
+		n := s.nodes[(start+i)%len(s.nodes)]
+		if !n.Client.IsConnected() {
+			continue
+		}
+		load := s.load(n)
+		if n.MaxChannels > 0 && load >= n.MaxChannels {
+			continue
+		}
+		if best == nil || load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+	if best == nil {
+		return nil, ErrNoNodes
+	}
+	best.pending.Add(1)
+	return best, nil
+}
+
+// Done libera la reserva tomada en Pick (la llamada ya quedó en el tracker o se descartó)
+func (n *Node) Done() {
+	n.pending.Add(-1)
+}
+
+func (s *NodeSet) load(n *Node) int {
+	return s.tracker.CountNode(n.Name) + int(n.pending.Load())
+}
+
+// Peers consulta en paralelo los peers SIP de cada nodo
+func (s *NodeSet) Peers(timeout time.Duration) []NodePeers {
+	result := make([]NodePeers, len(s.nodes))
+	var wg sync.WaitGroup
+	for i, n := range s.nodes {
+		result[i].Node = n.Name
+		if !n.Client.IsConnected() {
+			result[i].Err = errors.New("nodo desconectado")
+			continue
+		}
+		wg.Add(1)
+		go func(np *NodePeers, n *Node) {
+			defer wg.Done()
+			np.Peers, np.Registrations, np.Err = n.Client.ShowPeers(timeout)
+		}(&result[i], n)
+	}
+	wg.Wait()
+	return result
+}
+
+// Spy busca en los nodos el canal de la llamada uniqueID y, si está transferida a un agente, origina
+// desde ese nodo la supervisión (ChanSpy) hacia supervisor. Devuelve el nodo y el canal del agente.
+func (s *NodeSet) Spy(uniqueID, supervisor, mode, callerID string, ringTimeout, timeout time.Duration) (string, string, error) {
+	err := ami.ErrChannelNotFound
+	for _, n := range s.nodes {
+		if !n.Client.IsConnected() {
+			continue
+		}
+		agent, findErr := n.Client.FindTransferLeg(uniqueID, timeout)
+		if errors.Is(findErr, ami.ErrChannelNotFound) {
+			continue
+		}
+		if findErr != nil {
+			err = findErr
+			continue
+		}
+		return n.Name, agent, n.Client.Spy(supervisor, agent, mode, callerID, ringTimeout)
+	}
+	return "", "", err
+}
+
+// Stats devuelve el estado de cada nodo
+func (s *NodeSet) Stats() []NodeStats {
+	stats := make([]NodeStats, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		stats = append(stats, NodeStats{
+			Name:        n.Name,
+			Connected:   n.Client.IsConnected(),
+			Active:      s.tracker.CountNode(n.Name),
+			MaxChannels: n.MaxChannels,
+		})
+	}
+	return stats
+}
@@ -0,0 +1,420 @@
+package dialer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/smartcid"
+
+	"github.com/google/uuid"
+)
+
+// Motores de marcación (dial_engine del proyecto)
+const (
+	EngineSpool = "spool" // .call files en el spool de Asterisk
+	EngineAMI   = "ami"   // Originate vía AMI
+	EngineARI   = "ari"   // Originate e IVR vía ARI (aplicación Stasis)
+)
+
+var (
+	ErrBlacklisted  = errors.New("número en lista negra")
+	ErrChannelLimit = errors.New("channel limit reached")
+	ErrNoAudio      = errors.New("audio del proyecto no encontrado")
+)
+
+// Dialer origina llamadas de un motor de marcación (AMIDialer, ari.Engine)
+type Dialer interface {
+	Dial(req DialRequest) error
+}
+
+// DefaultRingTimeout es el timbrado si el proyecto no define ring_timeout
+const DefaultRingTimeout = 45 * time.Second
+
+// RingTimeout resuelve el tiempo de timbrado: override (campaña / llamada) o el del proyecto
+func RingTimeout(proyecto *database.Proyecto, override int) time.Duration {
+	if override > 0 {
+		return time.Duration(override) * time.Second
+	}
+	if proyecto.RingTimeout > 0 {
+		return time.Duration(proyecto.RingTimeout) * time.Second
+	}
+	return DefaultRingTimeout
+}
+
+// CallSpec describe una llamada a preparar, independiente del motor que la marque
+type CallSpec struct {
+	Proyecto    *database.Proyecto
+	Telefono    string
+	ContactID   int64             // 0 si no aplica
+	CampaignID  int               // 0 si no aplica
+	Variables   map[string]string // Variables de canal del integrador
+	CallerID    string            // Override de Caller ID (vacío = proyecto / Smart CID)
+	ExternalRef string            // Idempotency-Key / referencia del integrador
+	CallbackOf  int64             // Log original si es una rellamada
+	Troncales   string            // Override de troncales de la campaña "nombre[:peso],..." (vacío = las del proyecto)
+	Node        string            // Nodo Asterisk elegido (solo AMIDialer)
+	QueuedAt    time.Time         // Entrada en la cola del spool (cero = no pasó por la cola)
+}
+
+// PreparedCall es una llamada lista para marcar: slot de canal tomado, log creado y registrada en el tracker
+type PreparedCall struct {
+	UniqueID   string
+	LogID      int64
+	Trunk      string
+	CallerID   string
+	DialNumber string // Prefijo + teléfono
+
+	SIPHeaders  map[string]string // Variables SIPADDHEADERnn de la troncal (identidad SIP, STIR/SHAKEN)
+	Attestation string            // Atestación STIR/SHAKEN de la troncal (vacío = sin configurar)
+
+	slot *Reservation // Slot del pool (lo libera CallManager vía el tracker)
+}
+
+// DispositionNoAudio es la disposición de las llamadas descartadas porque falta el audio del proyecto
+const DispositionNoAudio = "NO_AUDIO"
+
+// PreDial es el pipeline común previo a marcar, compartido por el spooler y el AMIDialer:
+// blacklist, prefijos de destino, audio, intentos por número, cuotas del proyecto, selección de troncal, Caller ID, límite de canales, log y tracking.
+type PreDial struct {
+	repo    *database.Repository
+	pool    *ChannelPool
+	tracker *ActiveCallTracker
+	calls   *CallManager // Único camino de liberación de slots (nil = sin tracker)
+	quotas  *Quotas
+	tries   *AttemptCaps
+	trunks  *trunkBalancer
+	ids     *trunkIdentities
+	audios  *audioCheck // nil = sin verificación de audios
+	scidGen *smartcid.Generator
+	blocked *cidQuarantine // Caller IDs retirados de la rotación
+}
+
+// NewPreDial crea el pipeline de pre-marcación
+func NewPreDial(repo *database.Repository, pool *ChannelPool, tracker *ActiveCallTracker) *PreDial {
+	p := &PreDial{
+		repo:    repo,
+		pool:    pool,
+		tracker: tracker,
+		quotas:  NewQuotas(repo, tracker),
+		tries:   NewAttemptCaps(repo),
+		trunks:  newTrunkBalancer(repo, pool),
+		ids:     newTrunkIdentities(repo),
+		blocked: newCIDQuarantine(repo),
+	}
+	if tracker != nil {
+		p.calls = NewCallManager(pool, tracker)
+	}
+	return p
+}
+
+// SetSmartCIDGenerator configura el generador de Smart Caller ID
+func (p *PreDial) SetSmartCIDGenerator(gen *smartcid.Generator) {
+	p.scidGen = gen
+}
+
+// SetSoundPath activa la verificación del audio principal de los proyectos antes de marcar
+func (p *PreDial) SetSoundPath(soundPath string) {
+	p.audios = newAudioCheck(soundPath)
+}
+
+// AudioMissing indica si el audio principal del proyecto no existe en sound_path
+func (p *PreDial) AudioMissing(proyecto *database.Proyecto) bool {
+	return p.audios.missing(proyecto.Audio)
+}
+
+// Pool devuelve el pool de canales compartido
+func (p *PreDial) Pool() *ChannelPool {
+	return p.pool
+}
+
+// Tracker devuelve el tracker de llamadas activas compartido
+func (p *PreDial) Tracker() *ActiveCallTracker {
+	return p.tracker
+}
+
+// Calls devuelve el CallManager que libera los slots de las llamadas en curso
+func (p *PreDial) Calls() *CallManager {
+	return p.calls
+}
+
+// Quotas devuelve el control de cuotas por proyecto
+func (p *PreDial) Quotas() *Quotas {
+	return p.quotas
+}
+
+// Attempts devuelve el control de intentos por número y día
+func (p *PreDial) Attempts() *AttemptCaps {
+	return p.tries
+}
+
+// Prepare ejecuta el pipeline y deja la llamada lista para marcar.
+// Si devuelve error no queda nada tomado (slot, log ni tracking).
+func (p *PreDial) Prepare(spec CallSpec) (*PreparedCall, error) {
+	proyecto := spec.Proyecto
+
+	// 1. Blacklist (el número pudo bloquearse mientras esperaba en cola) y reglas de prefijos
+	if blocked, err := p.repo.IsBlacklisted(proyecto.ID, spec.Telefono); err == nil && blocked {
+		return nil, ErrBlacklisted
+	}
+	if err := CheckDestination(proyecto, spec.Telefono); err != nil {
+		return nil, err
+	}
+
+	// 2. Audio principal: sin archivo la llamada terminaría en FAIL tras consumir minutos
+	if p.AudioMissing(proyecto) {
+		p.logNoAudio(spec)
+		return nil, ErrNoAudio
+	}
+
+	// 3. Intentos del número en el día (todos los proyectos); la reserva se libera al crear el log
+	if err := p.tries.Reserve(proyecto, spec.Telefono); err != nil {
+		return nil, err
+	}
+	defer p.tries.Done(spec.Telefono)
+
+	// 4. Cuotas del proyecto (diaria y simultáneas)
+	if err := p.quotas.Reserve(proyecto); err != nil {
+		return nil, err
+	}
+
+	// 5. Troncal y límite de canales
+	trunk := p.selectTrunk(proyecto, spec.Troncales)
+	var slot *Reservation
+	if p.pool != nil {
+		if slot = p.pool.Reserve(trunk); slot == nil {
+			p.quotas.Cancel(proyecto)
+			return nil, fmt.Errorf("%w for trunk %s", ErrChannelLimit, trunk)
+		}
+	}
+
+	pc := &PreparedCall{
+		UniqueID:   uuid.New().String(),
+		Trunk:      trunk,
+		CallerID:   p.callerID(spec),
+		DialNumber: proyecto.PrefijoSalida + spec.Telefono,
+		slot:       slot,
+	}
+	if identity := p.ids.get(trunk); identity != nil {
+		pc.SIPHeaders = SIPHeaderVars(identity, pc.CallerID, pc.DialNumber)
+		pc.Attestation = identity.Attestation
+	}
+
+	// 6. Log
+	callLog := newCallLog(spec)
+	callLog.Status = "DIALING"
+	callLog.CallerIDUsed = pc.CallerID
+	callLog.Troncal = trunk
+	if pc.Attestation != "" {
+		callLog.Attestation = &pc.Attestation
+	}
+
+	logID, err := p.repo.CreateCallLog(callLog)
+	if err != nil {
+		slot.Release()
+		p.quotas.Cancel(proyecto)
+		return nil, err
+	}
+	pc.LogID = logID
+	if !spec.QueuedAt.IsZero() {
+		p.repo.AddCallEventAt(logID, database.CallEventQueued, "", spec.QueuedAt)
+	}
+	originated := fmt.Sprintf("troncal %s, CID %s", trunk, pc.CallerID)
+	if pc.Attestation != "" {
+		originated += ", atestación " + pc.Attestation
+	}
+	if spec.Node != "" {
+		originated += ", nodo " + spec.Node
+	}
+	p.repo.AddCallEvent(logID, database.CallEventOriginated, originated)
+
+	// 7. Tracking (antes de marcar: los eventos de Asterisk pueden llegar de inmediato)
+	if p.tracker != nil {
+		p.tracker.Add(&ActiveCall{
+			UniqueID:   pc.UniqueID,
+			LogID:      logID,
+			ContactID:  spec.ContactID,
+			CampaignID: spec.CampaignID,
+			ProyectoID: proyecto.ID,
+			Trunk:      trunk,
+			Node:       spec.Node,
+			Telefono:   spec.Telefono,
+			StartTime:  time.Now(),
+			Slot:       slot,
+		})
+	}
+	p.quotas.Done(proyecto)
+
+	return pc, nil
+}
+
+// newCallLog arma el log de una llamada con los datos de la solicitud
+func newCallLog(spec CallSpec) *database.CallLog {
+	callLog := &database.CallLog{
+		ProyectoID: spec.Proyecto.ID,
+		Telefono:   spec.Telefono,
+	}
+	if spec.CampaignID > 0 {
+		campaignID := spec.CampaignID
+		callLog.CampaignID = &campaignID
+	}
+	if spec.ContactID > 0 {
+		contactID := spec.ContactID
+		callLog.ContactID = &contactID
+	}
+	if spec.ExternalRef != "" {
+		ref := spec.ExternalRef
+		callLog.ExternalRef = &ref
+	}
+	if spec.CallbackOf > 0 {
+		orig := spec.CallbackOf
+		callLog.CallbackOf = &orig
+	}
+	if len(spec.Variables) > 0 {
+		if data, err := json.Marshal(spec.Variables); err == nil {
+			vars := string(data)
+			callLog.Variables = &vars
+		}
+	}
+	return callLog
+}
+
+// logNoAudio registra la llamada descartada por falta de audio, sin marcarla
+func (p *PreDial) logNoAudio(spec CallSpec) {
+	callLog := newCallLog(spec)
+	callLog.Status = "FAILED"
+	logID, err := p.repo.CreateCallLog(callLog)
+	if err != nil {
+		log.Printf("[PreDial] Error registrando llamada sin audio a %s: %v", spec.Telefono, err)
+		return
+	}
+	disposition := DispositionNoAudio
+	p.repo.UpdateCallLog(logID, nil, &disposition, nil, false, "FAILED", 0)
+}
+
+// Abort deshace una llamada preparada que no se pudo marcar y deja el log con el status indicado
+func (p *PreDial) Abort(pc *PreparedCall, status string) {
+	if p.calls != nil {
+		p.calls.release(pc.UniqueID)
+	} else {
+		pc.slot.Release()
+	}
+	if pc.LogID > 0 {
+		p.repo.UpdateCallLog(pc.LogID, nil, nil, nil, false, status, 0)
+		p.repo.AddCallEvent(pc.LogID, database.CallEventHangup, status)
+	}
+}
+
+// Finish libera una llamada que terminó (slot de canal y tracking), para motores que
+// siguen el ciclo de vida del canal por su cuenta en lugar de los eventos AMI
+func (p *PreDial) Finish(uniqueID string) {
+	if p.calls != nil {
+		p.calls.release(uniqueID)
+	}
+}
+
+// MaxTrunkWeight es el peso máximo de una troncal en el override de una campaña
+const MaxTrunkWeight = 100
+
+// TrunkWeight es una troncal del override de una campaña con su peso en el reparto
+type TrunkWeight struct {
+	Nombre string
+	Peso   int
+}
+
+// ParseTrunkWeights interpreta un override de troncales "premium:3,backup:1" (peso 1 si se omite)
+func ParseTrunkWeights(spec string) ([]TrunkWeight, error) {
+	var trunks []TrunkWeight
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		nombre, peso := item, 1
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			n, err := strconv.Atoi(strings.TrimSpace(item[i+1:]))
+			if err != nil || n < 1 || n > MaxTrunkWeight {
+				return nil, fmt.Errorf("peso inválido en '%s' (1-%d)", item, MaxTrunkWeight)
+			}
+			nombre, peso = strings.TrimSpace(item[:i]), n
+		}
+		if nombre == "" {
+			return nil, fmt.Errorf("troncal sin nombre en '%s'", item)
+		}
+		trunks = append(trunks, TrunkWeight{Nombre: nombre, Peso: peso})
+	}
+	return trunks, nil
+}
+
+// selectTrunk elige la troncal de la llamada entre el override de la campaña, las troncales
+// asignadas al proyecto (tabla relacional) o la lista separada por comas de troncal_salida (legacy),
+// según la trunk_strategy del proyecto
+func (p *PreDial) selectTrunk(proyecto *database.Proyecto, override string) string {
+	var trunks []TrunkWeight
+	source := "Campaign"
+	if override != "" {
+		var err error
+		if trunks, err = ParseTrunkWeights(override); err != nil {
+			log.Printf("[PreDial] WARNING: Override de troncales inválido '%s' (%v), se usan las del proyecto %d", override, err, proyecto.ID)
+		}
+	}
+	if len(trunks) == 0 {
+		source = "Table"
+		if names, err := p.repo.GetTroncalesNamesByProyecto(proyecto.ID); err == nil {
+			for _, name := range names {
+				trunks = append(trunks, TrunkWeight{Nombre: name, Peso: 1})
+			}
+		}
+	}
+	if len(trunks) == 0 {
+		source = "Legacy"
+		for _, name := range strings.Split(proyecto.TroncalSalida, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				trunks = append(trunks, TrunkWeight{Nombre: name, Peso: 1})
+			}
+		}
+	}
+	if len(trunks) == 0 {
+		return ""
+	}
+
+	selected := p.trunks.pick(proyecto.TrunkStrategy, trunks)
+	if len(trunks) > 1 {
+		log.Printf("[PreDial] Load Balancing (%s, %s): Selected trunk '%s' from %v", source, proyecto.TrunkStrategy, selected, trunks)
+	}
+	return selected
+}
+
+// callerID resuelve el Caller ID: override de la llamada, Smart CID o el estático del proyecto.
+// Los Caller IDs en cuarentena se saltean; si no queda ninguno se usa el de la troncal.
+func (p *PreDial) callerID(spec CallSpec) string {
+	proyecto := spec.Proyecto
+	if spec.CallerID != "" {
+		if !p.blocked.has(spec.CallerID) {
+			log.Printf("[PreDial] Usando CID de override: Proyecto=%d, CID=%s", proyecto.ID, spec.CallerID)
+			return spec.CallerID
+		}
+		log.Printf("[PreDial] CID de override %s en cuarentena: Proyecto=%d", spec.CallerID, proyecto.ID)
+	}
+	if p.scidGen != nil && proyecto.SmartCIDActive {
+		for i := 0; i < smartCIDRetries; i++ {
+			generated := p.scidGen.GetCallerID(spec.Telefono, proyecto.CallerID, proyecto.SmartCIDActive)
+			if p.blocked.has(generated) {
+				continue
+			}
+			log.Printf("[PreDial] Smart CID: Proyecto=%d, Destino=%s, Original=%s, Generado=%s",
+				proyecto.ID, spec.Telefono, proyecto.CallerID, generated)
+			return generated
+		}
+	}
+	if p.blocked.has(proyecto.CallerID) {
+		log.Printf("[PreDial] WARNING: CID %s del proyecto %d en cuarentena, se usa el de la troncal", proyecto.CallerID, proyecto.ID)
+		return ""
+	}
+	return proyecto.CallerID
+}
@@ -0,0 +1,191 @@
+package dialer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// ErrQuotaExceeded se devuelve cuando el proyecto alcanzó su cuota diaria o de llamadas simultáneas
+var ErrQuotaExceeded = errors.New("cuota del proyecto excedida")
+
+// quotaRefresh es cada cuánto se relee de la BD el conteo diario (incluye las llamadas de otras instancias)
+const quotaRefresh = 30 * time.Second
+
+// QuotaStatus es el consumo de las cuotas de un proyecto
+type QuotaStatus struct {
+	ProyectoID    int       `json:"proyecto_id"`
+	MaxCallsDay   int       `json:"max_calls_day"` // 0 = sin límite
+	CallsToday    int       `json:"calls_today"`
+	MaxConcurrent int       `json:"max_concurrent"` // 0 = sin límite
+	Active        int       `json:"active"`
+	ResetAt       time.Time `json:"reset_at"` // Próxima medianoche en la zona del proyecto
+}
+
+// Remaining devuelve cuántas llamadas más admite el proyecto en este momento (-1 = sin límite)
+func (q *QuotaStatus) Remaining() int {
+	remaining := -1
+	if q.MaxCallsDay > 0 {
+		remaining = max(q.MaxCallsDay-q.CallsToday, 0)
+	}
+	if q.MaxConcurrent > 0 {
+		free := max(q.MaxConcurrent-q.Active, 0)
+		if remaining < 0 || free < remaining {
+			remaining = free
+		}
+	}
+	return remaining
+}
+
+// DailyExceeded indica si se agotó la cuota del día (no se libera hasta ResetAt)
+func (q *QuotaStatus) DailyExceeded() bool {
+	return q.MaxCallsDay > 0 && q.CallsToday >= q.MaxCallsDay
+}
+
+// ConcurrentExceeded indica si el proyecto tiene todas sus llamadas simultáneas en curso
+func (q *QuotaStatus) ConcurrentExceeded() bool {
+	return q.MaxConcurrent > 0 && q.Active >= q.MaxConcurrent
+}
+
+// Err devuelve ErrQuotaExceeded con el detalle de la cuota agotada, o nil si hay cupo
+func (q *QuotaStatus) Err() error {
+	if q.DailyExceeded() {
+		return fmt.Errorf("%w: %d/%d llamadas hoy", ErrQuotaExceeded, q.CallsToday, q.MaxCallsDay)
+	}
+	if q.ConcurrentExceeded() {
+		return fmt.Errorf("%w: %d/%d llamadas simultáneas", ErrQuotaExceeded, q.Active, q.MaxConcurrent)
+	}
+	return nil
+}
+
+type dailyCount struct {
+	day      time.Time
+	count    int
+	loadedAt time.Time
+}
+
+// Quotas aplica max_calls_day y max_concurrent de cada proyecto. Las simultáneas se cuentan en
+// el tracker; las diarias en el log, con un contador en memoria que se relee cada quotaRefresh.
+type Quotas struct {
+	repo    *database.Repository
+	tracker *ActiveCallTracker
+
+	mu      sync.Mutex
+	daily   map[int]*dailyCount // proyecto -> llamadas del día
+	pending map[int]int         // Reservas que aún no llegan al tracker
+}
+
+// NewQuotas crea el control de cuotas sobre el tracker de llamadas activas
+func NewQuotas(repo *database.Repository, tracker *ActiveCallTracker) *Quotas {
+	return &Quotas{
+		repo:    repo,
+		tracker: tracker,
+		daily:   make(map[int]*dailyCount),
+		pending: make(map[int]int),
+	}
+}
+
+// Status devuelve el consumo actual de las cuotas del proyecto
+func (q *Quotas) Status(proyecto *database.Proyecto) (*QuotaStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.statusLocked(proyecto, time.Now())
+}
+
+// Reserve verifica las cuotas y cuenta la llamada en el día. El llamador debe invocar Done cuando
+// la llamada quede en el tracker, o Cancel si no se creó. Si la BD no responde se permite la
+// llamada: la cuota no debe detener el marcador.
+func (q *Quotas) Reserve(proyecto *database.Proyecto) error {
+	if proyecto.MaxCallsDay <= 0 && proyecto.MaxConcurrent <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status, err := q.statusLocked(proyecto, time.Now())
+	if err != nil {
+		log.Printf("[Quotas] WARNING: proyecto %d sin conteo diario: %v", proyecto.ID, err)
+		return nil
+	}
+	if err := status.Err(); err != nil {
+		return err
+	}
+	if d := q.daily[proyecto.ID]; d != nil {
+		d.count++
+	}
+	q.pending[proyecto.ID]++
+	return nil
+}
+
+// Done libera la reserva tomada en Reserve (la llamada ya cuenta en el tracker)
+func (q *Quotas) Done(proyecto *database.Proyecto) {
+	if proyecto.MaxCallsDay <= 0 && proyecto.MaxConcurrent <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked(proyecto.ID)
+}
+
+// Cancel deshace una reserva cuya llamada finalmente no se creó
+func (q *Quotas) Cancel(proyecto *database.Proyecto) {
+	if proyecto.MaxCallsDay <= 0 && proyecto.MaxConcurrent <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.releaseLocked(proyecto.ID)
+	if d := q.daily[proyecto.ID]; d != nil && d.count > 0 {
+		d.count--
+	}
+}
+
+func (q *Quotas) releaseLocked(proyectoID int) {
+	if q.pending[proyectoID] <= 1 {
+		delete(q.pending, proyectoID)
+		return
+	}
+	q.pending[proyectoID]--
+}
+
+func (q *Quotas) statusLocked(proyecto *database.Proyecto, now time.Time) (*QuotaStatus, error) {
+	dayStart := projectDayStart(proyecto, now)
+	status := &QuotaStatus{
+		ProyectoID:    proyecto.ID,
+		MaxCallsDay:   proyecto.MaxCallsDay,
+		MaxConcurrent: proyecto.MaxConcurrent,
+		ResetAt:       dayStart.AddDate(0, 0, 1),
+	}
+	status.Active = q.pending[proyecto.ID]
+	if q.tracker != nil {
+		status.Active += q.tracker.CountProyecto(proyecto.ID)
+	}
+
+	d := q.daily[proyecto.ID]
+	if d == nil || !d.day.Equal(dayStart) || now.Sub(d.loadedAt) >= quotaRefresh {
+		n, err := q.repo.CountCallsSince(proyecto.ID, dayStart)
+		if err != nil {
+			return status, err
+		}
+		d = &dailyCount{day: dayStart, count: n, loadedAt: now}
+		q.daily[proyecto.ID] = d
+	}
+	status.CallsToday = d.count
+	return status, nil
+}
+
+// projectDayStart es la medianoche de hoy en la zona horaria del proyecto (la del servidor si no tiene)
+func projectDayStart(proyecto *database.Proyecto, now time.Time) time.Time {
+	loc := time.Local
+	if proyecto.Timezone != "" {
+		if l, err := time.LoadLocation(proyecto.Timezone); err == nil {
+			loc = l
+		}
+	}
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
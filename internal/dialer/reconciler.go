@@ -0,0 +1,183 @@
+package dialer
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+const (
+	// ReconcileInterval is how often the in-memory tracker is checked for stale calls
+	ReconcileInterval = 10 * time.Second
+	// reconcileDBInterval is how often the DB-wide pass runs (leader only)
+	reconcileDBInterval = 30 * time.Second
+
+	// Default thresholds, overridable in apicall_config (seconds)
+	defaultTrackerMaxAge = 60 * time.Second // orphan_tracker_max_age
+	defaultDialingMaxAge = 2 * time.Minute  // orphan_dialing_max_age
+	defaultContactMaxAge = 5 * time.Minute  // orphan_contact_max_age
+)
+
+// Reconciler is the single cleanup service for calls that never got a final state:
+//   - tracked calls older than orphan_tracker_max_age (their Hangup was lost): the channel slot is
+//     released and the log closed as NA if it is still DIALING
+//   - pool slots no tracked call owns (leaks) and counter drift, via CallManager.Audit
+//   - DIALING logs older than orphan_dialing_max_age: closed as COMPLETED/NA and their campaign
+//     contacts synced from the log
+//   - contacts stuck in dialing longer than orphan_contact_max_age: marked failed/NA
+//
+// The tracker is per instance; the DB-wide pass only runs on the leader.
+type Reconciler struct {
+	repo  *database.Repository
+	calls *CallManager
+
+	lastDBPass time.Time
+
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewReconciler creates the reconciler
+func NewReconciler(repo *database.Repository, calls *CallManager) *Reconciler {
+	return &Reconciler{
+		repo:     repo,
+		calls:    calls,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the reconciler worker
+func (c *Reconciler) Start() {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = true
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go c.run()
+	log.Println("[Reconciler] Started")
+}
+
+// Stop stops the reconciler
+func (c *Reconciler) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	c.mu.Unlock()
+
+	close(c.stopChan)
+	c.wg.Wait()
+	log.Println("[Reconciler] Stopped")
+}
+
+func (c *Reconciler) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.reconcile()
+		}
+	}
+}
+
+func (c *Reconciler) reconcile() {
+	c.cleanupStaleCalls()
+	c.calls.Audit()
+
+	if !leader.IsLeader() || time.Since(c.lastDBPass) < reconcileDBInterval {
+		return
+	}
+	c.lastDBPass = time.Now()
+	c.cleanupOrphanedCallLogs()
+	c.cleanupOrphanedContacts()
+}
+
+// threshold reads a max age in seconds from apicall_config (cached by the repository)
+func (c *Reconciler) threshold(key string, def time.Duration) time.Duration {
+	val, err := c.repo.GetConfig(key)
+	if err != nil || val == "" {
+		return def
+	}
+	secs, err := strconv.Atoi(val)
+	if err != nil || secs <= 0 {
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// cleanupStaleCalls removes calls from the tracker that are too old
+func (c *Reconciler) cleanupStaleCalls() {
+	staleCalls := c.calls.tracker.GetStale(c.threshold("orphan_tracker_max_age", defaultTrackerMaxAge))
+	for _, call := range staleCalls {
+		if c.calls.release(call.UniqueID) == nil {
+			continue // Released meanwhile by its own hangup
+		}
+
+		// Only calls still DIALING: FastAGI, ARI or the AMI handler may already own the result
+		if call.LogID > 0 {
+			closed, err := c.repo.UpdateDialingCallByID(call.LogID, "COMPLETED", "NA")
+			if err != nil {
+				log.Printf("[Reconciler] Error closing stale call %s: %v", call.UniqueID, err)
+			} else if closed && call.ContactID > 0 {
+				na := "NA"
+				c.repo.UpdateContactStatus(call.ContactID, "failed", &na)
+			}
+		}
+	}
+
+	if len(staleCalls) > 0 {
+		log.Printf("[Reconciler] Released %d stale calls from tracker", len(staleCalls))
+	}
+}
+
+// cleanupOrphanedCallLogs closes call logs stuck in DIALING and syncs their contacts
+func (c *Reconciler) cleanupOrphanedCallLogs() {
+	maxAge := c.threshold("orphan_dialing_max_age", defaultDialingMaxAge)
+	rows, err := c.repo.CloseStaleDialingCalls(maxAge)
+	if err != nil {
+		log.Printf("[Reconciler] Error cleaning orphaned call logs: %v", err)
+		return
+	}
+	if rows == 0 {
+		return
+	}
+	log.Printf("[Reconciler] Closed %d orphaned call logs (DIALING > %v)", rows, maxAge)
+
+	synced, err := c.repo.SyncClosedCallContacts()
+	if err != nil {
+		log.Printf("[Reconciler] Error syncing campaign contacts: %v", err)
+	} else if synced > 0 {
+		log.Printf("[Reconciler] Synced %d campaign contacts", synced)
+	}
+}
+
+// cleanupOrphanedContacts fails contacts stuck in dialing without a matching log
+func (c *Reconciler) cleanupOrphanedContacts() {
+	maxAge := c.threshold("orphan_contact_max_age", defaultContactMaxAge)
+	rows, err := c.repo.FailStaleDialingContacts(maxAge)
+	if err != nil {
+		log.Printf("[Reconciler] Error cleaning orphaned contacts: %v", err)
+		return
+	}
+	if rows > 0 {
+		log.Printf("[Reconciler] Cleaned %d orphaned contacts (dialing > %v)", rows, maxAge)
+	}
+}
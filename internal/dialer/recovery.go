@@ -0,0 +1,101 @@
+package dialer
+
+import (
+	"log"
+	"time"
+
+	"apicall/internal/ami"
+	"apicall/internal/database"
+)
+
+const (
+	// recoveryWindow es la antigüedad máxima de los logs en curso que se revisan al arrancar
+	// (cubre las transferencias largas, ver fastagi.bridge_timeout)
+	recoveryWindow = 2 * time.Hour
+	// recoveryGrace deja al Reconciler los logs DIALING más nuevos: pueden ser .call files
+	// que Asterisk aún no tomó y que todavía no aparecen como canal
+	recoveryGrace = 15 * time.Second
+	// recoveryTimeout limita la consulta de canales a cada nodo
+	recoveryTimeout = 10 * time.Second
+)
+
+// RecoverCalls reconstruye el estado en memoria tras un reinicio. Las llamadas de apicall que
+// siguen vivas en los nodos Asterisk vuelven al tracker con su slot del pool (CallManager.Adopt;
+// el Hangup las libera como a cualquier otra), y los logs DIALING cuyo canal ya no existe se cierran como
+// NA sin esperar al Reconciler. Debe correr antes de que el spooler y el Sweeper marquen.
+func RecoverCalls(repo *database.Repository, calls *CallManager, nodes []*Node) {
+	type liveCall struct {
+		node    string
+		channel ami.LiveChannel
+	}
+	live := make(map[int64]liveCall) // log id -> canal
+
+	// Solo se cierran logs si se pudo listar todos los nodos: el canal podría estar en el que falta
+	complete := true
+	for _, node := range nodes {
+		if !node.Client.IsConnected() {
+			complete = false
+			continue
+		}
+		channels, err := node.Client.ShowChannels(recoveryTimeout)
+		if err != nil {
+			log.Printf("[Recovery] WARNING: No se pudieron listar los canales de %s: %v", node.Name, err)
+			complete = false
+			continue
+		}
+		for _, ch := range channels {
+			if ch.LogID > 0 && ch.TrackingID != "" {
+				live[ch.LogID] = liveCall{node: node.Name, channel: ch}
+			}
+		}
+	}
+
+	logs, err := repo.GetInFlightCallLogs(recoveryWindow)
+	if err != nil {
+		log.Printf("[Recovery] Error consultando llamadas en curso: %v", err)
+		return
+	}
+
+	reattached := 0
+	var dead []int64
+	for _, cl := range logs {
+		lc, ok := live[cl.ID]
+		if !ok {
+			if cl.Status == "DIALING" {
+				dead = append(dead, cl.ID)
+			}
+			continue
+		}
+		if calls.tracker.Get(lc.channel.TrackingID) != nil {
+			continue
+		}
+		call := &ActiveCall{
+			UniqueID:   lc.channel.TrackingID,
+			LogID:      cl.ID,
+			ProyectoID: cl.ProyectoID,
+			Trunk:      cl.Troncal,
+			Node:       lc.node,
+			Telefono:   cl.Telefono,
+			StartTime:  time.Now(), // Desde la recuperación: el Reconciler no la da por vencida al instante
+		}
+		if cl.CampaignID != nil {
+			call.CampaignID = *cl.CampaignID
+		}
+		if cl.ContactID != nil {
+			call.ContactID = *cl.ContactID
+		}
+		calls.Adopt(call)
+		calls.AddAlias(lc.channel.UniqueID, call.UniqueID)
+		reattached++
+	}
+
+	var closed int64
+	if complete {
+		if closed, err = repo.CloseDialingCalls(dead, recoveryGrace); err != nil {
+			log.Printf("[Recovery] Error cerrando llamadas terminadas: %v", err)
+		}
+	} else if len(dead) > 0 {
+		log.Printf("[Recovery] %d logs DIALING sin canal quedan para el Reconciler (nodos sin listar)", len(dead))
+	}
+	log.Printf("[Recovery] %d llamadas en curso recuperadas, %d terminadas durante el reinicio cerradas como NA", reattached, closed)
+}
@@ -0,0 +1,169 @@
+package dialer
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/database"
+)
+
+// EngineSim finge los originates sin Asterisk (pruebas de carga, ver config.SimulationConfig)
+const EngineSim = "sim"
+
+// simOutcome es el resultado sorteado para una llamada simulada
+type simOutcome struct {
+	ring         time.Duration
+	talk         time.Duration // 0 = no contestó
+	status       string
+	disposition  string
+	interacciono bool
+	dtmf         string
+}
+
+// Simulator es el motor de simulación: usa el pipeline común de pre-marcación (cuotas,
+// pool de canales, log y tracking) y luego sortea timbrado, contestación, AMD, DTMF y
+// duración según las tasas configuradas, escribiendo el resultado como lo haría el IVR.
+type Simulator struct {
+	pre  *PreDial
+	repo *database.Repository
+	cfg  config.SimulationConfig
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSimulator crea el motor de simulación
+func NewSimulator(cfg config.SimulationConfig, repo *database.Repository, pre *PreDial) *Simulator {
+	return &Simulator{
+		pre:      pre,
+		repo:     repo,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Dial prepara la llamada y simula su ciclo de vida en segundo plano
+func (s *Simulator) Dial(req DialRequest) error {
+	pc, err := s.pre.Prepare(CallSpec{
+		Proyecto:    req.Project,
+		Telefono:    req.Destination,
+		ContactID:   req.ContactID,
+		CampaignID:  req.CampaignID,
+		Variables:   req.Variables,
+		CallerID:    req.CallerID,
+		ExternalRef: req.ExternalRef,
+		CallbackOf:  req.CallbackOf,
+		Troncales:   req.Troncales,
+		QueuedAt:    req.QueuedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go s.run(pc, req)
+	log.Printf("[Sim] Originate %s -> %s (log=%d)", pc.UniqueID, req.Destination, pc.LogID)
+	return nil
+}
+
+// Stop corta las llamadas simuladas en curso (quedan como FAILED) y espera a que se liberen
+func (s *Simulator) Stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+	s.wg.Wait()
+}
+
+func (s *Simulator) run(pc *PreparedCall, req DialRequest) {
+	defer s.wg.Done()
+	defer s.pre.Finish(pc.UniqueID)
+
+	out := s.outcome(req.Project, req.Timeout)
+	if !s.wait(out.ring) {
+		s.updateLog(pc, req, "FAILED", "FAIL", false, "", 0)
+		return
+	}
+	if out.talk > 0 {
+		uniqueid, answered := pc.UniqueID, "A"
+		if err := s.repo.UpdateCallLog(pc.LogID, nil, &answered, &uniqueid, false, "CONNECTED", 0); err != nil {
+			log.Printf("[Sim] Error actualizando log: %v", err)
+		}
+		s.repo.AddCallEvent(pc.LogID, database.CallEventAnswered, "simulada")
+		if !s.wait(out.talk) {
+			s.updateLog(pc, req, "COMPLETED", "AB", true, "", int(out.talk.Seconds()))
+			return
+		}
+	}
+	s.updateLog(pc, req, out.status, out.disposition, out.interacciono, out.dtmf, int(out.talk.Seconds()))
+}
+
+// outcome sortea el resultado: fallo, ocupado, contestada (humano o contestador) o no contesta
+func (s *Simulator) outcome(p *database.Proyecto, timeout time.Duration) simOutcome {
+	ringMin, ringMax := s.cfg.RingRange()
+	ring := ringMin + time.Duration(rand.Int63n(int64(ringMax-ringMin)+1))
+	if timeout > 0 && ring > timeout {
+		ring = timeout
+	}
+
+	r := rand.Float64()
+	switch {
+	case r < s.cfg.FailRate:
+		return simOutcome{ring: ringMin, status: "FAILED", disposition: "CONG"}
+	case r < s.cfg.FailRate+s.cfg.BusyRate:
+		return simOutcome{ring: ringMin, status: "COMPLETED", disposition: "B"}
+	case r >= s.cfg.FailRate+s.cfg.BusyRate+s.cfg.Answer():
+		return simOutcome{ring: timeout, status: "COMPLETED", disposition: "NA"}
+	}
+
+	// Contestada: duración exponencial alrededor de la media (acotada a 10 veces la media)
+	mean := s.cfg.TalkTime()
+	talk := min(time.Duration(rand.ExpFloat64()*float64(mean)), 10*mean) + time.Second
+	out := simOutcome{ring: ring, talk: talk, status: "COMPLETED", disposition: "N", interacciono: true}
+	switch {
+	case p.AMDActive && rand.Float64() < s.cfg.MachineRate:
+		out.disposition = "AM"
+	case rand.Float64() < s.cfg.DTMFRate:
+		out.dtmf = p.DTMFEsperado
+		if out.dtmf == "" {
+			out.dtmf = "1"
+		}
+		out.disposition = "XFER"
+	}
+	return out
+}
+
+// wait espera d o hasta que se detenga el simulador (false)
+func (s *Simulator) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopChan:
+		return false
+	}
+}
+
+// updateLog escribe el resultado final en el log y en el contacto de campaña
+func (s *Simulator) updateLog(pc *PreparedCall, req DialRequest, status, disposition string, interacciono bool, dtmf string, duracion int) {
+	var dtmfPtr *string
+	if dtmf != "" {
+		dtmfPtr = &dtmf
+	}
+	if err := s.repo.UpdateCallLog(pc.LogID, dtmfPtr, &disposition, nil, interacciono, status, duracion); err != nil {
+		log.Printf("[Sim] Error actualizando log: %v", err)
+	}
+	s.repo.AddCallEvent(pc.LogID, database.CallEventHangup, "simulada: "+disposition)
+
+	if req.ContactID > 0 {
+		contactStatus := "failed"
+		if disposition == "XFER" {
+			contactStatus = "completed"
+		}
+		if err := s.repo.UpdateContactStatus(req.ContactID, contactStatus, &disposition); err != nil {
+			log.Printf("[Sim] Error actualizando contacto %d: %v", req.ContactID, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package dialer
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// Estrategias de balanceo entre troncales (trunk_strategy del proyecto)
+const (
+	TrunkRandom    = "random"     // Al azar (por peso si la campaña define sus troncales)
+	TrunkWeighted  = "weighted"   // Proporcional a la capacidad de cada troncal
+	TrunkLeastUsed = "least_used" // La de menos canales activos en el Channel Pool
+	TrunkASR       = "asr"        // Relega a las troncales con peor ASR reciente
+)
+
+const (
+	// trunkStatsTTL es cada cuánto se recargan las capacidades y el ASR de las troncales
+	trunkStatsTTL = 30 * time.Second
+	// trunkASRWindow son las llamadas recientes que cuentan para el ASR
+	trunkASRWindow = time.Hour
+	// trunkASRMinCalls: con menos llamadas finalizadas la troncal no se relega (sin datos suficientes)
+	trunkASRMinCalls = 20
+	// trunkASRFloor es el peso mínimo de una troncal con mal ASR: sigue recibiendo algo de tráfico
+	// para que su ASR pueda recuperarse
+	trunkASRFloor = 0.05
+)
+
+// IsTrunkStrategy indica si s es una estrategia de balanceo válida (vacío = random)
+func IsTrunkStrategy(s string) bool {
+	switch s {
+	case "", TrunkRandom, TrunkWeighted, TrunkLeastUsed, TrunkASR:
+		return true
+	}
+	return false
+}
+
+// trunkBalancer elige una troncal entre las candidatas según la estrategia del proyecto
+type trunkBalancer struct {
+	repo *database.Repository
+	pool *ChannelPool
+
+	mu          sync.Mutex
+	capacidades map[string]int
+	asr         map[string]database.WallboardTrunk
+	loadedAt    time.Time
+}
+
+func newTrunkBalancer(repo *database.Repository, pool *ChannelPool) *trunkBalancer {
+	return &trunkBalancer{repo: repo, pool: pool}
+}
+
+// pick elige una troncal; el peso de cada candidata (override de la campaña, 1 si no) multiplica
+// al de la estrategia
+func (b *trunkBalancer) pick(strategy string, trunks []TrunkWeight) string {
+	if len(trunks) == 1 {
+		return trunks[0].Nombre
+	}
+	switch strategy {
+	case TrunkWeighted:
+		capacidades, _ := b.stats()
+		return weightedChoice(trunks, func(t TrunkWeight) float64 {
+			return float64(b.capacity(capacidades, t.Nombre))
+		})
+	case TrunkLeastUsed:
+		if b.pool != nil {
+			return b.leastUsed(trunks)
+		}
+	case TrunkASR:
+		_, asr := b.stats()
+		best := 0.0
+		for _, t := range trunks {
+			if s, ok := asr[t.Nombre]; ok && s.Attempted >= trunkASRMinCalls && s.ASR > best {
+				best = s.ASR
+			}
+		}
+		return weightedChoice(trunks, func(t TrunkWeight) float64 {
+			s, ok := asr[t.Nombre]
+			if !ok || s.Attempted < trunkASRMinCalls || best == 0 {
+				return 1 // Sin datos: como la mejor
+			}
+			if score := s.ASR / best; score > trunkASRFloor {
+				return score
+			}
+			return trunkASRFloor
+		})
+	}
+	return weightedChoice(trunks, func(TrunkWeight) float64 { return 1 })
+}
+
+// capacity es el peso de una troncal en la estrategia weighted
+func (b *trunkBalancer) capacity(capacidades map[string]int, trunk string) int {
+	if c := capacidades[trunk]; c > 0 {
+		return c
+	}
+	if b.pool != nil {
+		if max := b.pool.MaxPerTrunk(); max > 0 {
+			return max
+		}
+	}
+	return 1
+}
+
+// leastUsed elige la troncal con menos canales activos en proporción a su peso (empates al azar)
+func (b *trunkBalancer) leastUsed(trunks []TrunkWeight) string {
+	var best []string
+	bestLoad := 0.0
+	for _, t := range trunks {
+		load := float64(b.pool.ActiveForTrunk(t.Nombre)) / float64(t.Peso)
+		switch {
+		case len(best) == 0 || load < bestLoad:
+			best, bestLoad = []string{t.Nombre}, load
+		case load == bestLoad:
+			best = append(best, t.Nombre)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
+
+// stats devuelve las capacidades y el ASR de las troncales, recargados como mucho cada trunkStatsTTL.
+// Si la consulta falla se siguen usando los últimos valores.
+func (b *trunkBalancer) stats() (map[string]int, map[string]database.WallboardTrunk) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.loadedAt) < trunkStatsTTL {
+		return b.capacidades, b.asr
+	}
+	b.loadedAt = time.Now()
+
+	if capacidades, err := b.repo.GetTroncalCapacidades(); err != nil {
+		log.Printf("[PreDial] Error leyendo capacidad de troncales: %v", err)
+	} else {
+		b.capacidades = capacidades
+	}
+	if asr, err := b.repo.GetTrunkASR(time.Now().Add(-trunkASRWindow)); err != nil {
+		log.Printf("[PreDial] Error leyendo ASR de troncales: %v", err)
+	} else {
+		b.asr = asr
+	}
+	return b.capacidades, b.asr
+}
+
+// weightedChoice elige al azar en proporción a Peso * weight(t)
+func weightedChoice(trunks []TrunkWeight, weight func(TrunkWeight) float64) string {
+	weights := make([]float64, len(trunks))
+	total := 0.0
+	for i, t := range trunks {
+		weights[i] = float64(t.Peso) * weight(t)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return trunks[rand.Intn(len(trunks))].Nombre
+	}
+	n := rand.Float64() * total
+	for i, t := range trunks {
+		if n -= weights[i]; n < 0 {
+			return t.Nombre
+		}
+	}
+	return trunks[len(trunks)-1].Nombre
+}
@@ -0,0 +1,353 @@
+// Package eventbus publica los eventos de llamadas y campañas en un broker (Redis Streams, NATS o
+// RabbitMQ) para que otros sistemas los consuman a escala. Cada broker es un Publisher registrado con
+// Register; los clientes hablan el protocolo directamente, sin dependencias externas.
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Eventos publicados
+const (
+	EventCallFinished      = "call.finished" // Llamada con resultado final (data = call log)
+	EventCampaignStarted   = "campaign.started"
+	EventCampaignPaused    = "campaign.paused"
+	EventCampaignStopped   = "campaign.stopped"
+	EventCampaignExit      = "campaign.exit"      // Pausada por una regla de salida
+	EventCampaignCompleted = "campaign.completed" // data = resumen final
+)
+
+// Events son todos los eventos válidos
+var Events = []string{
+	EventCallFinished, EventCampaignStarted, EventCampaignPaused, EventCampaignStopped,
+	EventCampaignExit, EventCampaignCompleted,
+}
+
+const (
+	// DefaultTopic es el stream / subject / exchange si no se configura topic
+	DefaultTopic = "apicall.events"
+	// dialTimeout limita la conexión y cada operación con el broker
+	dialTimeout = 10 * time.Second
+	// maxBatch es cuántos eventos se envían juntos al broker
+	maxBatch = 100
+	// maxBackoff es la espera máxima entre reconexiones
+	maxBackoff = 30 * time.Second
+	// drainTimeout es cuánto se espera al detener para vaciar los eventos pendientes
+	drainTimeout = 5 * time.Second
+)
+
+// Event es el mensaje publicado (JSON)
+type Event struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	ProyectoID int         `json:"proyecto_id"`
+	CampaignID *int        `json:"campaign_id,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Data       interface{} `json:"data"`
+}
+
+// Message es un evento serializado listo para publicar
+type Message struct {
+	Event string // Nombre del evento (subject / routing key)
+	Body  []byte
+}
+
+// Publisher entrega lotes de mensajes a un broker. Publish devuelve error si algún mensaje no se
+// confirmó; el Bus cierra la conexión y reintenta el lote completo.
+type Publisher interface {
+	Publish(msgs []Message) error
+	Close() error
+}
+
+// Factory conecta con el broker
+type Factory func(cfg config.EventBusConfig) (Publisher, error)
+
+var factories = map[string]Factory{}
+
+// Register agrega un driver de broker (redis, nats y rabbitmq se registran en este paquete)
+func Register(driver string, f Factory) {
+	factories[driver] = f
+}
+
+// Bus publica eventos en segundo plano. nil = desactivado (Publish no hace nada).
+type Bus struct {
+	cfg      config.EventBusConfig
+	factory  Factory
+	events   map[string]bool // Eventos publicados (nil = todos)
+	repo     *database.Repository
+	queue    chan Message
+	dropped  int64
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// New crea el bus; devuelve nil si event_bus no está configurado
+func New(repo *database.Repository, cfg config.EventBusConfig) (*Bus, error) {
+	if cfg.Driver == "" {
+		return nil, nil
+	}
+	factory, ok := factories[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("event_bus.driver inválido: %s (%s)", cfg.Driver, strings.Join(drivers(), ", "))
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 10000
+	}
+
+	var events map[string]bool
+	for _, e := range strings.Split(cfg.Events, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e == "" {
+			continue
+		}
+		if !isEvent(e) {
+			return nil, fmt.Errorf("event_bus.events: evento inválido '%s' (válidos: %s)", e, strings.Join(Events, ", "))
+		}
+		if events == nil {
+			events = make(map[string]bool)
+		}
+		events[e] = true
+	}
+
+	return &Bus{
+		cfg:      cfg,
+		factory:  factory,
+		events:   events,
+		repo:     repo,
+		queue:    make(chan Message, cfg.Buffer),
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+func drivers() []string {
+	list := make([]string, 0, len(factories))
+	for d := range factories {
+		list = append(list, d)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func isEvent(e string) bool {
+	for _, valid := range Events {
+		if e == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Start inicia el envío y se engancha al cierre de llamadas del repositorio
+func (b *Bus) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running {
+		return
+	}
+	b.running = true
+	b.wg.Add(1)
+	go b.run()
+	if b.enabled(EventCallFinished) {
+		b.repo.OnCallFinished("eventbus", b.callsFinished)
+	}
+	log.Printf("[EventBus] Publicando eventos en %s (%s)", b.cfg.Driver, b.cfg.Topic)
+}
+
+// Stop deja de aceptar eventos e intenta entregar los pendientes durante drainTimeout
+func (b *Bus) Stop() {
+	b.mu.Lock()
+	if !b.running {
+		b.mu.Unlock()
+		return
+	}
+	b.running = false
+	b.mu.Unlock()
+
+	b.repo.OnCallFinished("eventbus", nil)
+	close(b.stopChan)
+	b.wg.Wait()
+	log.Println("[EventBus] Detenido")
+}
+
+func (b *Bus) enabled(event string) bool {
+	return b.events == nil || b.events[event]
+}
+
+// Publish encola un evento; no bloquea. Si el broker no responde y el buffer se llena el evento
+// se descarta (queda en el log).
+func (b *Bus) Publish(event string, proyectoID int, campaignID *int, data interface{}) {
+	if b == nil || !b.enabled(event) {
+		return
+	}
+	body, err := json.Marshal(Event{
+		ID:         uuid.New().String(),
+		Event:      event,
+		ProyectoID: proyectoID,
+		CampaignID: campaignID,
+		Timestamp:  time.Now(),
+		Data:       data,
+	})
+	if err != nil {
+		log.Printf("[EventBus] Error serializando %s: %v", event, err)
+		return
+	}
+
+	select {
+	case b.queue <- Message{Event: event, Body: body}:
+	default:
+		b.mu.Lock()
+		b.dropped++
+		dropped := b.dropped
+		b.mu.Unlock()
+		if dropped == 1 || dropped%1000 == 0 {
+			log.Printf("[EventBus] WARNING: Buffer lleno, %d eventos descartados", dropped)
+		}
+	}
+}
+
+// PublishCampaign publica un evento de campaña
+func (b *Bus) PublishCampaign(event string, c *database.Campaign, data interface{}) {
+	if b == nil || c == nil {
+		return
+	}
+	id := c.ID
+	b.Publish(event, c.ProyectoID, &id, data)
+}
+
+// callsFinished publica call.finished para cada llamada; se llama desde el batcher
+func (b *Bus) callsFinished(ids []int64) {
+	go func() {
+		calls, err := b.repo.GetCallLogsByIDs(ids)
+		if err != nil {
+			log.Printf("[EventBus] Error leyendo llamadas finalizadas: %v", err)
+			return
+		}
+		for i := range calls {
+			b.Publish(EventCallFinished, calls[i].ProyectoID, calls[i].CampaignID, &calls[i])
+		}
+	}()
+}
+
+func (b *Bus) run() {
+	defer b.wg.Done()
+
+	var pub Publisher
+	var batch []Message
+	backoff := time.Second
+	for {
+		if len(batch) == 0 {
+			select {
+			case msg := <-b.queue:
+				batch = append(batch, msg)
+			case <-b.stopChan:
+				b.drain(pub, batch)
+				return
+			}
+		}
+		batch = b.fill(batch)
+
+		if pub == nil {
+			p, err := b.factory(b.cfg)
+			if err != nil {
+				log.Printf("[EventBus] Error conectando a %s: %v (reintento en %s)", b.cfg.Driver, err, backoff)
+				if !b.wait(&backoff) {
+					b.drain(nil, batch)
+					return
+				}
+				continue
+			}
+			pub = p
+			log.Printf("[EventBus] Conectado a %s", b.cfg.Driver)
+		}
+
+		if err := pub.Publish(batch); err != nil {
+			log.Printf("[EventBus] Error publicando %d eventos: %v (reintento en %s)", len(batch), err, backoff)
+			pub.Close()
+			pub = nil
+			if !b.wait(&backoff) {
+				b.drain(nil, batch)
+				return
+			}
+			continue
+		}
+		batch = batch[:0]
+		backoff = time.Second
+	}
+}
+
+// fill completa el lote con los eventos ya encolados
+func (b *Bus) fill(batch []Message) []Message {
+	for len(batch) < maxBatch {
+		select {
+		case msg := <-b.queue:
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// wait espera el backoff antes de reintentar; false si el bus se está deteniendo
+func (b *Bus) wait(backoff *time.Duration) bool {
+	timer := time.NewTimer(*backoff)
+	defer timer.Stop()
+	if *backoff *= 2; *backoff > maxBackoff {
+		*backoff = maxBackoff
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-b.stopChan:
+		return false
+	}
+}
+
+// drain intenta entregar los eventos pendientes al detener (un intento por lote, hasta
+// drainTimeout) y cierra la conexión
+func (b *Bus) drain(pub Publisher, batch []Message) {
+	deadline := time.Now().Add(drainTimeout)
+	defer func() {
+		if pub != nil {
+			pub.Close()
+		}
+	}()
+
+	for {
+		batch = b.fill(batch)
+		if len(batch) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		if pub == nil {
+			p, err := b.factory(b.cfg)
+			if err != nil {
+				break
+			}
+			pub = p
+		}
+		if err := pub.Publish(batch); err != nil {
+			break
+		}
+		batch = batch[:0]
+	}
+	log.Printf("[EventBus] WARNING: %d eventos sin publicar al detener", len(batch)+len(b.queue))
+}
@@ -0,0 +1,137 @@
+package eventbus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"apicall/internal/config"
+)
+
+func init() {
+	Register("nats", newNATS)
+}
+
+// natsPublisher publica cada evento en el subject <topic>.<evento> (ej: apicall.events.call.finished)
+type natsPublisher struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	prefix string
+}
+
+// natsInfo es el INFO inicial del servidor (solo los campos usados)
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnect son las opciones del CONNECT
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// newNATS conecta a nats://[usuario:clave@ | token@]host:puerto (tls:// para TLS)
+func newNATS(cfg config.EventBusConfig) (Publisher, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, fmt.Errorf("event_bus.url debe ser nats://host:puerto o tls://host:puerto")
+	}
+	conn, err := dial(u, "4222", false)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("no se recibió INFO del servidor NATS")
+	}
+	var info natsInfo
+	json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &info)
+
+	// El servidor NATS negocia TLS después del INFO
+	if info.TLSRequired || u.Scheme == "tls" {
+		tconn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tconn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error en TLS con NATS: %w", err)
+		}
+		conn = tconn
+		r = bufio.NewReader(conn)
+	}
+
+	opts := natsConnect{Name: "apicall", Lang: "go", Version: "1.0", Protocol: 1}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts.User, opts.Pass = u.User.Username(), pass
+		} else {
+			opts.Token = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+
+	p := &natsPublisher{conn: conn, r: r, w: bufio.NewWriter(conn), prefix: cfg.Topic}
+	fmt.Fprintf(p.w, "CONNECT %s\r\n", connect)
+	if err := p.flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Publish envía los PUB y confirma con PING/PONG: si el servidor rechazó algo responde -ERR
+func (p *natsPublisher) Publish(msgs []Message) error {
+	p.conn.SetDeadline(time.Now().Add(dialTimeout))
+	for _, m := range msgs {
+		fmt.Fprintf(p.w, "PUB %s.%s %d\r\n", p.prefix, m.Event, len(m.Body))
+		p.w.Write(m.Body)
+		p.w.WriteString("\r\n")
+	}
+	return p.flush()
+}
+
+// flush envía lo pendiente seguido de PING y espera el PONG
+func (p *natsPublisher) flush() error {
+	p.w.WriteString("PING\r\n")
+	if err := p.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			p.w.WriteString("PONG\r\n")
+			if err := p.w.Flush(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(line[4:]))
+		}
+		// +OK e INFO (actualizaciones del cluster) se ignoran
+	}
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,168 @@
+package eventbus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/config"
+)
+
+// defaultMaxLen es el largo aproximado máximo del stream si no se configura max_len
+const defaultMaxLen = 100000
+
+func init() {
+	Register("redis", newRedis)
+}
+
+// redisPublisher agrega cada evento al stream con XADD (campos event y data)
+type redisPublisher struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	stream string
+	maxLen string
+}
+
+// newRedis conecta a redis://[usuario:clave@]host:puerto[/db] (rediss:// con TLS)
+func newRedis(cfg config.EventBusConfig) (Publisher, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("event_bus.url debe ser redis://host:puerto o rediss://host:puerto")
+	}
+	conn, err := dial(u, "6379", u.Scheme == "rediss")
+	if err != nil {
+		return nil, err
+	}
+
+	maxLen := cfg.MaxLen
+	if maxLen <= 0 {
+		maxLen = defaultMaxLen
+	}
+	p := &redisPublisher{
+		conn:   conn,
+		r:      bufio.NewReader(conn),
+		w:      bufio.NewWriter(conn),
+		stream: cfg.Topic,
+		maxLen: strconv.Itoa(maxLen),
+	}
+
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		args := []string{"AUTH", pass}
+		if user := u.User.Username(); user != "" && user != "default" {
+			args = []string{"AUTH", user, pass}
+		}
+		if err := p.command(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error de autenticación: %w", err)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if err := p.command("SELECT", db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error seleccionando la base %s: %w", db, err)
+		}
+	}
+	return p, nil
+}
+
+// command envía un comando y lee su respuesta
+func (p *redisPublisher) command(args ...string) error {
+	p.conn.SetDeadline(time.Now().Add(dialTimeout))
+	p.write(args...)
+	if err := p.w.Flush(); err != nil {
+		return err
+	}
+	return p.readReply()
+}
+
+// Publish envía los XADD en pipeline y lee una respuesta por mensaje
+func (p *redisPublisher) Publish(msgs []Message) error {
+	p.conn.SetDeadline(time.Now().Add(dialTimeout))
+	for _, m := range msgs {
+		p.write("XADD", p.stream, "MAXLEN", "~", p.maxLen, "*", "event", m.Event, "data", string(m.Body))
+	}
+	if err := p.w.Flush(); err != nil {
+		return err
+	}
+	for range msgs {
+		if err := p.readReply(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *redisPublisher) Close() error {
+	return p.conn.Close()
+}
+
+// write serializa un comando como arreglo RESP de bulk strings
+func (p *redisPublisher) write(args ...string) {
+	fmt.Fprintf(p.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(p.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+// readReply lee una respuesta RESP y devuelve el error del servidor (-ERR ...), si lo hubo
+func (p *redisPublisher) readReply() error {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("respuesta vacía de redis")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("respuesta inválida de redis: %q", line)
+		}
+		if n < 0 {
+			return nil // Nil bulk
+		}
+		_, err = io.CopyN(io.Discard, p.r, int64(n)+2)
+		return err
+	default:
+		return fmt.Errorf("respuesta inesperada de redis: %q", line)
+	}
+}
+
+// dial conecta al host de u (con defaultPort si no trae puerto), opcionalmente con TLS
+func dial(u *url.URL, defaultPort string, useTLS bool) (net.Conn, error) {
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	addr := net.JoinHostPort(host, port)
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if useTLS {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+		if err != nil {
+			return nil, fmt.Errorf("error conectando a %s: %w", addr, err)
+		}
+		return conn, nil
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error conectando a %s: %w", addr, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,157 @@
+package fastagi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/audio"
+	"apicall/internal/database"
+)
+
+// recordDir guarda las grabaciones en curso (MixMonitor); debe ser visible para Asterisk y apicall
+var recordDir = filepath.Join(audio.Dir, ".recordings")
+
+// maxRerecords limita las veces que el administrador puede regrabar en la misma llamada
+const maxRerecords = 3
+
+// recording son los datos de la grabación pedida desde la API (variables APICALL_RECORD_*).
+// Se leen al inicio: tras el cuelgue ya no se pueden consultar.
+type recording struct {
+	name       string
+	title      string
+	tags       []string
+	user       string
+	proyectoID int // Proyecto al que se asigna como audio principal (0 = ninguno)
+	maxSeconds int
+}
+
+// HandleRecording atiende la llamada de "llámame para grabar" (contexto apicall_record):
+// graba con MixMonitor hasta '#' o APICALL_RECORD_MAX segundos y ofrece el menú vm-review
+// (1 aceptar, 2 escuchar, 3 regrabar). Si cuelga, se guarda lo grabado.
+func (s *Session) HandleRecording() error {
+	rec := recording{name: audio.SanitizeName(s.recordVar("APICALL_RECORD_NAME"))}
+	if rec.name == "" {
+		s.Hangup()
+		return fmt.Errorf("grabación sin APICALL_RECORD_NAME")
+	}
+	rec.title = s.recordVar("APICALL_RECORD_TITLE")
+	rec.tags = audio.ParseTags(s.recordVar("APICALL_RECORD_TAGS"))
+	rec.user = s.recordVar("APICALL_RECORD_USER")
+	rec.proyectoID, _ = strconv.Atoi(s.recordVar("APICALL_RECORD_PROYECTO"))
+	rec.maxSeconds, _ = strconv.Atoi(s.recordVar("APICALL_RECORD_MAX"))
+	if rec.maxSeconds <= 0 {
+		rec.maxSeconds = 60
+	}
+
+	if err := os.MkdirAll(recordDir, 0775); err != nil {
+		return fmt.Errorf("error creando %s: %w", recordDir, err)
+	}
+	recPath := filepath.Join(recordDir, fmt.Sprintf("rec-%s.wav", strings.ReplaceAll(s.vars["agi_uniqueid"], ".", "-")))
+	defer os.Remove(recPath)
+
+	s.Verbose(fmt.Sprintf("Apicall: Grabacion de audio %s.wav (max %ds)", rec.name, rec.maxSeconds), 3)
+	recorded := false
+	for attempt := 0; attempt < maxRerecords && !recorded; attempt++ {
+		os.Remove(recPath)
+		if err := s.StreamFile("beep"); errors.Is(err, ErrHangup) {
+			break
+		}
+		if err := s.Exec("MixMonitor", recPath); err != nil {
+			return fmt.Errorf("error iniciando MixMonitor: %w", err)
+		}
+		// Termina con cualquier dígito (ej: '#'), al cumplirse el máximo o al colgar
+		_, err := s.WaitForDTMF(rec.maxSeconds)
+		if errors.Is(err, ErrHangup) || s.timedOut {
+			recorded = true
+			break
+		}
+		s.Exec("StopMixMonitor", "")
+		recorded = s.reviewRecording(recPath)
+	}
+	if !s.hungUp && !s.timedOut {
+		s.Hangup()
+	}
+
+	return s.saveRecording(recPath, rec)
+}
+
+// reviewRecording ofrece escuchar la grabación; devuelve false si se pidió regrabar
+func (s *Session) reviewRecording(recPath string) bool {
+	playback := strings.TrimSuffix(recPath, filepath.Ext(recPath))
+	for {
+		digit, err := s.GetData("vm-review", 5, 1)
+		if err != nil {
+			return true
+		}
+		switch digit {
+		case "2":
+			if err := s.StreamFile(playback); errors.Is(err, ErrHangup) {
+				return true
+			}
+		case "3":
+			return false
+		default:
+			// '1' o sin respuesta: se acepta
+			return true
+		}
+	}
+}
+
+// saveRecording convierte la grabación a <name>.wav en la biblioteca, registra sus metadatos y,
+// si se pidió, la asigna como audio principal del proyecto
+func (s *Session) saveRecording(recPath string, rec recording) error {
+	// Asterisk cierra el archivo de MixMonitor al terminar el canal o al detenerlo
+	var info os.FileInfo
+	for i := 0; i < 10; i++ {
+		var err error
+		if info, err = os.Stat(recPath); err == nil && info.Size() > 44 {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if info == nil || info.Size() <= 44 {
+		return fmt.Errorf("grabación %s vacía o inexistente", recPath)
+	}
+
+	filename := rec.name + ".wav"
+	finalPath := filepath.Join(audio.Dir, filename)
+	if err := audio.Convert(recPath, finalPath); err != nil {
+		return err
+	}
+
+	a := &database.Audio{Name: filename, Title: rec.title, Tags: rec.tags, UploadedBy: rec.user}
+	if fi, err := os.Stat(finalPath); err == nil {
+		a.Size = fi.Size()
+	}
+	if d, err := audio.Duration(finalPath); err == nil {
+		a.Duration = d
+	}
+	if err := s.repo.UpsertAudio(a); err != nil {
+		return err
+	}
+	log.Printf("[Session] Audio grabado por teléfono: %s (%.1fs, usuario %s)", filename, a.Duration, a.UploadedBy)
+
+	if rec.proyectoID > 0 {
+		if err := s.repo.SetProyectoAudio(rec.proyectoID, filename); err != nil {
+			return err
+		}
+		log.Printf("[Session] Proyecto %d usa ahora el audio %s", rec.proyectoID, filename)
+	}
+	return nil
+}
+
+// recordVar lee una variable de canal APICALL_RECORD_* (la API las envía escapadas)
+func (s *Session) recordVar(name string) string {
+	value, _ := s.GetVariable(name)
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"apicall/internal/config"
 	"apicall/internal/database"
@@ -14,18 +15,21 @@ import (
 
 // Server representa el servidor FastAGI
 type Server struct {
-	config *config.Config
-	repo   *database.Repository
-	mu     sync.Mutex
-	active map[string]*Session // Sesiones activas por uniqueid
+	config   *config.Config
+	repo     *database.Repository
+	mu       sync.Mutex
+	active   map[string]*Session // Sesiones activas por uniqueid
+	sessions int                 // Conexiones en curso (incluye las que aún no completan el handshake)
+	metrics  *sessionMetrics
 }
 
 // NewServer crea un nuevo servidor FastAGI
 func NewServer(cfg *config.Config, repo *database.Repository) *Server {
 	return &Server{
-		config: cfg,
-		repo:   repo,
-		active: make(map[string]*Session),
+		config:  cfg,
+		repo:    repo,
+		active:  make(map[string]*Session),
+		metrics: newSessionMetrics(),
 	}
 }
 
@@ -47,6 +51,13 @@ func (s *Server) Start() error {
 				continue
 			}
 
+			if !s.acquire() {
+				s.metrics.reject()
+				log.Printf("[FastAGI] WARN Límite de sesiones alcanzado, rechazando conexión de %s", conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+
 			go s.handleConnection(conn)
 		}
 	}()
@@ -55,8 +66,26 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// acquire reserva un cupo de sesión según fastagi.max_sessions
+func (s *Server) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions >= s.config.FastAGI.SessionLimit() {
+		return false
+	}
+	s.sessions++
+	return true
+}
+
+func (s *Server) release() {
+	s.mu.Lock()
+	s.sessions--
+	s.mu.Unlock()
+}
+
 // handleConnection maneja una conexión AGI entrante
 func (s *Server) handleConnection(conn net.Conn) {
+	defer s.release()
 	defer conn.Close()
 
 	// Protección contra Pánicos (Panic Recovery)
@@ -66,18 +95,23 @@ func (s *Server) handleConnection(conn net.Conn) {
 		}
 	}()
 
+	// Configuración vigente al momento de la llamada
+	s.mu.Lock()
+	cfg := s.config
+	s.mu.Unlock()
+
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
 
-	// Parsear variables AGI iniciales
+	// Parsear variables AGI iniciales (Asterisk las envía apenas conecta)
+	conn.SetDeadline(time.Now().Add(cfg.FastAGI.IdleDeadline()))
 	vars, err := parseAGIVariables(reader)
 	if err != nil {
 		log.Printf("[FastAGI] Error parseando variables: %v", err)
 		return
 	}
 
-	// Crear sesión
-	session := NewSession(conn, reader, writer, vars, s.config, s.repo)
+	session := NewSession(conn, reader, writer, vars, cfg, s.repo)
 
 	// Registrar sesión activa
 	uniqueid := vars["agi_uniqueid"]
@@ -93,10 +127,20 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 	log.Printf("[FastAGI] Nueva sesión: %s desde %s", uniqueid, vars["agi_callerid"])
 
-	// Ejecutar lógica de IVR
-	if err := session.HandleIVR(); err != nil {
+	// Ejecutar lógica de IVR (agi://host/record = llamada para grabar un audio)
+	start := time.Now()
+	if vars["agi_network_script"] == "record" {
+		err = session.HandleRecording()
+	} else {
+		err = session.HandleIVR()
+	}
+	if err != nil {
 		log.Printf("[FastAGI] Error en IVR: %v", err)
 	}
+	s.metrics.observe(time.Since(start), session.timedOut, err != nil)
+	if session.timedOut {
+		log.Printf("[FastAGI] WARN Sesión %s cortada por timeout tras %s", uniqueid, time.Since(start).Round(time.Second))
+	}
 }
 
 // parseAGIVariables lee las variables iniciales del protocolo AGI
@@ -124,6 +168,24 @@ func parseAGIVariables(reader *bufio.Reader) (map[string]string, error) {
 	return vars, nil
 }
 
+// SetConfig reemplaza la configuración usada por las nuevas sesiones.
+// Las sesiones en curso conservan la configuración con la que iniciaron.
+func (s *Server) SetConfig(cfg *config.Config) {
+	s.mu.Lock()
+	s.config = cfg
+	s.mu.Unlock()
+}
+
+// Stats devuelve las métricas de sesiones del servidor
+func (s *Server) Stats() SessionStats {
+	st := s.metrics.snapshot()
+	s.mu.Lock()
+	st.Active = s.sessions
+	st.MaxSessions = s.config.FastAGI.SessionLimit()
+	s.mu.Unlock()
+	return st
+}
+
 // GetActiveSessionCount devuelve el número de sesiones activas
 func (s *Server) GetActiveSessionCount() int {
 	s.mu.Lock()
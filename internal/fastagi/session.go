@@ -2,17 +2,24 @@ package fastagi
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"strconv"
 	"strings"
 	"time"
 
+	"apicall/internal/audio"
 	"apicall/internal/config"
 	"apicall/internal/database"
+	"apicall/internal/i18n"
 )
 
+// defaultAMDParams se usa si asterisk.amd_params no está definido en el YAML
+const defaultAMDParams = "1500|1000|500|3000|100|50|3|256"
+
 // Session representa una sesión AGI individual
 type Session struct {
 	conn       net.Conn
@@ -24,8 +31,18 @@ type Session struct {
 	logID      int64 // ID del registro en apicall_call_log
 	contactID  int64 // ID del contacto de campaña (0 si no aplica)
 	campaignID int   // ID de la campaña (0 si no aplica)
+	timedOut   bool  // Algún comando superó su deadline (la conexión queda inutilizable)
+	hungUp     bool  // Asterisk notificó HANGUP o respondió 511 (canal muerto)
+
+	// Paso actual del IVR, para registrar dónde colgó el destino
+	step      string
+	stepAudio string
+	stepStart time.Time
 }
 
+// ErrHangup indica que el canal fue colgado durante la sesión
+var ErrHangup = errors.New("canal colgado")
+
 // NewSession crea una nueva sesión AGI
 func NewSession(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer,
 	vars map[string]string, cfg *config.Config, repo *database.Repository) *Session {
@@ -124,9 +141,13 @@ func (s *Session) HandleIVR() error {
 		}
 
 		// Obtener contact_id si existe
+		var contactID *int64
 		contactIDStr, _ := s.GetVariable("APICALL_CONTACT_ID")
 		if contactIDStr != "" {
 			s.contactID, _ = strconv.ParseInt(contactIDStr, 10, 64)
+			if s.contactID > 0 {
+				contactID = &s.contactID
+			}
 		}
 
 		// Obtener caller_id usado (el efectivo del canal)
@@ -142,6 +163,7 @@ func (s *Session) HandleIVR() error {
 			Status:       "INITIATED_LEGACY",
 			Uniqueid:     uniqueid,
 			CampaignID:   campaignID,
+			ContactID:    contactID,
 			CallerIDUsed: callerIDUsed,
 		}
 
@@ -153,11 +175,16 @@ func (s *Session) HandleIVR() error {
 		}
 		s.logID = logID
 	}
+	s.event(database.CallEventAnswered, s.vars["agi_channel"])
 
 	// Responder la llamada
 	log.Printf("[Session] DEBUG: Antes de Answer() - Proyecto %d", proyecto.ID)
 	s.Verbose("Apicall: Respondiendo llamada...", 3)
+	s.setStep("answer", "")
 	if err := s.Answer(); err != nil {
+		if errors.Is(err, ErrHangup) {
+			return s.abandon(startTime, "")
+		}
 		log.Printf("[Session] ERROR: Answer() falló: %v", err)
 		s.updateLog("COMPLETED", "NA", false, "", int(time.Since(startTime).Seconds()), nil)
 		return err
@@ -171,14 +198,25 @@ func (s *Session) HandleIVR() error {
 		// initial_silence=1500ms (antes 2500), greeting=1000ms (antes 1500), 
 		// after_greeting_silence=500ms (antes 1000), total_analysis_time=3000ms (antes 5000), 
 		// min_word_length=100, between_words_silence=50, maximum_number_of_words=3, silence_threshold=256
-		amdParams := "1500|1000|500|3000|100|50|3|256"
+		amdParams := defaultAMDParams
+		if s.config != nil && s.config.Asterisk.AMDParams != "" {
+			amdParams = s.config.Asterisk.AMDParams
+		}
+		s.setStep("amd", "")
 		if err := s.Exec("AMD", amdParams); err != nil {
+			if errors.Is(err, ErrHangup) {
+				return s.abandon(startTime, "")
+			}
 			s.Verbose(fmt.Sprintf("Apicall Warning: Error ejecutando AMD: %v", err), 3)
 		} else {
 			// Obtener resultado
 			amdStatus, _ := s.GetVariable("AMDSTATUS")
 			amdCause, _ := s.GetVariable("AMDCAUSE")
+			if s.hungUp {
+				return s.abandon(startTime, "")
+			}
 			s.Verbose(fmt.Sprintf("Apicall: AMD Resultado: %s (Causa: %s)", amdStatus, amdCause), 3)
+			s.event(database.CallEventAMD, fmt.Sprintf("%s (%s)", amdStatus, amdCause))
 
 			if amdStatus == "MACHINE" {
 				// Es máquina, colgar
@@ -202,7 +240,17 @@ func (s *Session) HandleIVR() error {
 	log.Printf("[Session] DEBUG: Antes de StreamFile() - Path: %s", audioPath)
 	s.Verbose(fmt.Sprintf("Apicall: Reproduciendo archivo '%s'...", audioPath), 3)
 	
+	s.setStep("audio", proyecto.Audio)
+	// STREAM FILE no falla si el archivo no existe: se verifica antes para no cerrar la llamada como FAIL
+	if audio.Missing(s.config.Asterisk.SoundPath, proyecto.Audio) {
+		log.Printf("[Session] ALERTA: el audio '%s' del proyecto %d no existe, se cuelga (NO_AUDIO)", proyecto.Audio, proyecto.ID)
+		s.updateLog("FAILED", "NO_AUDIO", true, "", int(time.Since(startTime).Seconds()), nil)
+		return s.Hangup()
+	}
 	if err := s.StreamFile(audioPath); err != nil {
+		if errors.Is(err, ErrHangup) {
+			return s.abandon(startTime, "")
+		}
 		log.Printf("[Session] ERROR: StreamFile() falló: %v", err)
 		s.Verbose(fmt.Sprintf("Apicall Error: Fallo reproduccion: %v", err), 3)
 		s.updateLog("COMPLETED", "FAIL", true, "", int(time.Since(startTime).Seconds()), nil)
@@ -210,15 +258,32 @@ func (s *Session) HandleIVR() error {
 	}
 	log.Printf("[Session] DEBUG: StreamFile() exitoso")
 
+	// Con encuesta asignada el audio principal es la introducción y las preguntas reemplazan al DTMF
+	if proyecto.SurveyID > 0 {
+		survey, err := s.repo.GetSurvey(proyecto.SurveyID)
+		switch {
+		case err != nil:
+			log.Printf("[Session] WARN: encuesta %d no disponible, se sigue con el flujo DTMF: %v", proyecto.SurveyID, err)
+		case survey.ProyectoID != proyecto.ID || len(survey.Preguntas) == 0:
+			log.Printf("[Session] WARN: encuesta %d no aplicable al proyecto %d, se sigue con el flujo DTMF", survey.ID, proyecto.ID)
+		default:
+			return s.runSurvey(proyecto, survey, startTime)
+		}
+	}
+
 	// Lógica de reintentos para DTMF
 	maxAttempts := 2
-	invalidAudio := fmt.Sprintf("%s/opcion_invalida", s.config.Asterisk.SoundPath)
-	confirmAudio := fmt.Sprintf("%s/en_breve", s.config.Asterisk.SoundPath)
+	invalidAudio := fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, i18n.Prompt(proyecto.Locale, i18n.PromptInvalid))
+	confirmAudio := fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, i18n.Prompt(proyecto.Locale, i18n.PromptConfirm))
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		s.Verbose(fmt.Sprintf("Apicall: Esperando DTMF (Intento %d/%d, Timeout 10s)...", attempt, maxAttempts), 3)
 		
+		s.setStep("dtmf", "")
 		dtmf, err := s.WaitForDTMF(10) // 10 segundos timeout
+		if errors.Is(err, ErrHangup) {
+			return s.abandon(startTime, "")
+		}
 		
 		if err != nil {
 			// Timeout - no se recibió ningún DTMF
@@ -226,7 +291,10 @@ func (s *Session) HandleIVR() error {
 			
 			if attempt < maxAttempts {
 				// Reproducir audio de opción inválida y reintentar
-				s.StreamFile(invalidAudio)
+				s.setStep("invalid_audio", "opcion_invalida")
+				if err := s.StreamFile(invalidAudio); errors.Is(err, ErrHangup) {
+					return s.abandon(startTime, "")
+				}
 				continue
 			} else {
 				// Segundo intento fallido, colgar
@@ -239,14 +307,37 @@ func (s *Session) HandleIVR() error {
 		log.Printf("[Session] DTMF recibido: %s (esperado: %s)", dtmf, proyecto.DTMFEsperado)
 		s.Verbose(fmt.Sprintf("Apicall: DTMF Recibido: '%s' (Esperado: '%s')", dtmf, proyecto.DTMFEsperado), 3)
 
+		// Rama de rellamada ("marque 2 para que lo llamemos más tarde")
+		if proyecto.CallbackDTMF != "" && dtmf == proyecto.CallbackDTMF {
+			return s.requestCallback(proyecto, startTime, dtmf)
+		}
+
 		// Verificar si el DTMF es el esperado
 		if dtmf == proyecto.DTMFEsperado {
+			// Captura de varios dígitos (ej: código de confirmación) antes de transferir
+			if proyecto.CaptureDigits > 0 {
+				if err := s.captureDigits(proyecto); errors.Is(err, ErrHangup) {
+					return s.abandon(startTime, dtmf)
+				}
+			}
+
 			// DTMF correcto - reproducir confirmación y transferir
 			s.Verbose(fmt.Sprintf("Apicall: DTMF correcto. Reproduciendo confirmacion..."), 3)
-			s.StreamFile(confirmAudio)
+			s.setStep("confirm", "en_breve")
+			if err := s.StreamFile(confirmAudio); errors.Is(err, ErrHangup) {
+				return s.abandon(startTime, dtmf)
+			}
 			
+			if proyecto.TransferMode == database.TransferQueue || proyecto.TransferMode == database.TransferRingGroup {
+				return s.agentTransfer(proyecto, startTime, dtmf)
+			}
+
 			s.Verbose(fmt.Sprintf("Apicall: Transfiriendo a %s...", proyecto.NumeroDesborde), 3)
+			s.setStep("transfer", "")
 			if err := s.Transfer(proyecto); err != nil {
+				if errors.Is(err, ErrHangup) {
+					return s.abandon(startTime, dtmf)
+				}
 				s.updateLog("FAILED", "FAIL", true, dtmf, int(time.Since(startTime).Seconds()), nil)
 				return err
 			}
@@ -259,7 +350,10 @@ func (s *Session) HandleIVR() error {
 			
 			if attempt < maxAttempts {
 				// Reproducir audio de opción inválida y reintentar
-				s.StreamFile(invalidAudio)
+				s.setStep("invalid_audio", "opcion_invalida")
+				if err := s.StreamFile(invalidAudio); errors.Is(err, ErrHangup) {
+					return s.abandon(startTime, dtmf)
+				}
 				continue
 			} else {
 				// Segundo intento con DTMF incorrecto, colgar
@@ -283,11 +377,222 @@ func (s *Session) Transfer(proyecto *database.Proyecto) error {
 	s.SetVariable("APICALL_PREFIX", proyecto.PrefijoSalida)
 	s.SetVariable("APICALL_CALLERID", proyecto.CallerID)
 	s.SetVariable("APICALL_TRANSFER", proyecto.NumeroDesborde)
+	if s.hungUp {
+		return ErrHangup
+	}
+	s.event(database.CallEventTransfer, fmt.Sprintf("desborde %s vía %s", proyecto.NumeroDesborde, proyecto.TroncalSalida))
 
 	// El dialplan revisará APICALL_TRANSFER después del AGI y ejecutará el Dial
 	return nil
 }
 
+// Resultados de una transferencia a cola o grupo de timbrado (transfer_result del log)
+const (
+	TransferAnswered  = "AGENT_ANSWERED"
+	TransferAbandoned = "ABANDONED_IN_QUEUE"
+	TransferNoAgent   = "NO_AGENT"
+)
+
+// agentTransfer conecta la llamada a una cola (Queue) o a un grupo de timbrado (Dial) desde el
+// propio AGI y registra si la atendió un agente, si el destino colgó esperando o si nadie atendió.
+// Para colas, la detección de agente requiere setinterfacevar=yes en queues.conf (MEMBERINTERFACE).
+func (s *Session) agentTransfer(proyecto *database.Proyecto, startTime time.Time, dtmf string) error {
+	var app, args, statusVar string
+	if proyecto.TransferMode == database.TransferQueue {
+		app, statusVar = "Queue", "QUEUESTATUS"
+		args = fmt.Sprintf("%s,,,,%d", proyecto.TransferTarget, proyecto.TransferTimeout)
+	} else {
+		app, statusVar = "Dial", "DIALSTATUS"
+		args = fmt.Sprintf("%s,%d", strings.ReplaceAll(proyecto.TransferTarget, ",", "&"), proyecto.TransferTimeout)
+	}
+
+	s.Verbose(fmt.Sprintf("Apicall: Transfiriendo via %s a %s...", app, proyecto.TransferTarget), 3)
+	s.setStep(proyecto.TransferMode, "")
+	s.event(database.CallEventTransfer, fmt.Sprintf("%s %s", proyecto.TransferMode, proyecto.TransferTarget))
+	// Queue/Dial no retornan hasta que termina la conversación con el agente
+	_, err := s.execCommandTimeout(fmt.Sprintf("EXEC %s %s", app, args), s.config.FastAGI.BridgeDeadline())
+	if err != nil && !errors.Is(err, ErrHangup) {
+		log.Printf("[Session] ERROR: %s falló: %v", app, err)
+		s.updateLog("FAILED", "FAIL", true, dtmf, int(time.Since(startTime).Seconds()), nil)
+		return err
+	}
+
+	status, _ := s.GetVariable(statusVar)
+	answered := status == "ANSWER"
+	if app == "Queue" {
+		member, _ := s.GetVariable("MEMBERINTERFACE")
+		answered = member != ""
+	}
+
+	result := TransferNoAgent
+	switch {
+	case answered:
+		result = TransferAnswered
+	case s.hungUp:
+		result = TransferAbandoned
+	}
+
+	log.Printf("[Session] Transferencia %s: %s (%s=%s)", proyecto.TransferMode, result, statusVar, status)
+	s.event(database.CallEventTransfer, fmt.Sprintf("%s (%s=%s)", result, statusVar, status))
+	if s.logID > 0 {
+		if err := s.repo.SetCallTransferResult(s.logID, result, status); err != nil {
+			log.Printf("[Session] %v", err)
+		}
+	}
+
+	switch result {
+	case TransferAnswered:
+		s.updateLog("COMPLETED", "XFER", true, dtmf, int(time.Since(startTime).Seconds()), nil)
+		return nil
+	case TransferAbandoned:
+		return s.abandon(startTime, dtmf)
+	}
+
+	// Ningún agente atendió: audio de fallback y colgar
+	if proyecto.TransferFailAudio != "" {
+		s.StreamFile(fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, proyecto.TransferFailAudio))
+	}
+	s.updateLog("COMPLETED", "XFERFAIL", true, dtmf, int(time.Since(startTime).Seconds()), nil)
+	if s.hungUp {
+		return nil
+	}
+	return s.Hangup()
+}
+
+// requestCallback registra una rellamada. Con callback_audio se pide la hora preferida (HH, 0-23,
+// zona del proyecto); sin hora válida la ventana empieza callback_delay minutos después.
+// El scheduler de rellamadas marca el número dentro de la ventana.
+func (s *Session) requestCallback(proyecto *database.Proyecto, startTime time.Time, dtmf string) error {
+	now := time.Now()
+	windowStart := now.Add(time.Duration(proyecto.CallbackDelay) * time.Minute)
+
+	if proyecto.CallbackAudio != "" {
+		s.setStep("callback", proyecto.CallbackAudio)
+		// Si cuelga al pedir la hora se mantiene la rellamada con la ventana por defecto
+		hour, err := s.GetData(fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, proyecto.CallbackAudio), 5, 2)
+		if h, convErr := strconv.Atoi(hour); err == nil && convErr == nil && h >= 0 && h <= 23 {
+			windowStart = nextHour(now, h, proyecto.Timezone)
+		}
+	}
+
+	telefono, _ := s.GetVariable("APICALL_TELEFONO")
+	if telefono == "" {
+		telefono = s.vars["agi_callerid"]
+	}
+
+	if s.logID > 0 {
+		cb := &database.Callback{
+			ProyectoID:    proyecto.ID,
+			Telefono:      telefono,
+			OriginalLogID: s.logID,
+			WindowStart:   windowStart,
+			WindowEnd:     windowStart.Add(time.Duration(proyecto.CallbackWindow) * time.Minute),
+		}
+		if s.campaignID > 0 {
+			campaignID := s.campaignID
+			cb.CampaignID = &campaignID
+		}
+		if s.contactID > 0 {
+			contactID := s.contactID
+			cb.ContactID = &contactID
+		}
+		if err := s.repo.CreateCallback(cb); err != nil {
+			log.Printf("[Session] %v", err)
+		} else {
+			log.Printf("[Session] Rellamada %d registrada para %s (%s - %s)", cb.ID, telefono,
+				cb.WindowStart.Format(time.RFC3339), cb.WindowEnd.Format(time.RFC3339))
+		}
+	}
+
+	s.updateLog("COMPLETED", "CB", true, dtmf, int(time.Since(startTime).Seconds()), nil)
+	s.Verbose("=== Apicall: Sesion Terminada (rellamada) ===", 3)
+	return nil
+}
+
+// nextHour devuelve la próxima ocurrencia de hour:00 en la zona horaria indicada
+func nextHour(now time.Time, hour int, timezone string) time.Time {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	local := now.In(loc)
+	t := time.Date(local.Year(), local.Month(), local.Day(), hour, 0, 0, 0, loc)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// captureDigits solicita hasta proyecto.CaptureDigits dígitos (terminados en #) y los deja
+// en el log y en la variable de canal APICALL_CAPTURED para el dialplan.
+// Si no se marca nada se reintenta una vez tras el audio de opción inválida.
+func (s *Session) captureDigits(proyecto *database.Proyecto) error {
+	promptAudio := fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, proyecto.CaptureAudio)
+	invalidAudio := fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, i18n.Prompt(proyecto.Locale, i18n.PromptInvalid))
+
+	var digits string
+	for attempt := 1; attempt <= 2 && digits == ""; attempt++ {
+		if attempt > 1 {
+			s.setStep("invalid_audio", "opcion_invalida")
+			if err := s.StreamFile(invalidAudio); errors.Is(err, ErrHangup) {
+				return err
+			}
+		}
+
+		s.setStep("capture", proyecto.CaptureAudio)
+		d, err := s.GetData(promptAudio, proyecto.CaptureTimeout, proyecto.CaptureDigits)
+		if errors.Is(err, ErrHangup) {
+			return err
+		}
+		if err != nil {
+			s.Verbose(fmt.Sprintf("Apicall Warning: Error capturando digitos: %v", err), 3)
+			continue
+		}
+		digits = d
+	}
+
+	if digits == "" {
+		s.Verbose("Apicall: No se capturaron digitos", 3)
+		return nil
+	}
+
+	log.Printf("[Session] Dígitos capturados: %s", digits)
+	s.SetVariable("APICALL_CAPTURED", digits)
+	if s.logID > 0 {
+		if err := s.repo.SetCallCapturedDigits(s.logID, digits); err != nil {
+			log.Printf("[Session] %v", err)
+		}
+	}
+	return nil
+}
+
+// setStep registra el paso del IVR en curso (y el audio que se reproduce, si aplica)
+func (s *Session) setStep(step, audio string) {
+	s.step = step
+	s.stepAudio = audio
+	s.stepStart = time.Now()
+}
+
+// abandon cierra la sesión cuando el destino colgó: marca el log con el paso,
+// el audio y los segundos transcurridos en él, sin emitir más comandos AGI
+func (s *Session) abandon(startTime time.Time, dtmf string) error {
+	seconds := int(time.Since(s.stepStart).Seconds())
+	log.Printf("[Session] Llamada abandonada en paso '%s' (audio=%s, %ds)", s.step, s.stepAudio, seconds)
+
+	s.updateLog("COMPLETED", "AB", s.step != "answer", dtmf, int(time.Since(startTime).Seconds()), nil)
+	if s.logID > 0 {
+		if err := s.repo.MarkCallAbandoned(s.logID, s.step, s.stepAudio, seconds); err != nil {
+			log.Printf("[Session] %v", err)
+		}
+	}
+	return nil
+}
+
+// event agrega un evento al timeline de la llamada (detalle del endpoint /logs/{id})
+func (s *Session) event(evento, detalle string) {
+	s.repo.AddCallEvent(s.logID, evento, detalle)
+}
+
 // updateLog actualiza el registro de llamada y el estado del contacto si aplica
 func (s *Session) updateLog(status string, disposition string, interacciono bool, dtmf string, duracion int, uniqueid *string) {
 	if s.logID == 0 {
@@ -322,9 +627,9 @@ func (s *Session) updateLog(status string, disposition string, interacciono bool
 // mapCallStatusToContactStatus convierte la disposition de llamada al estado del contacto
 func mapCallStatusToContactStatus(disposition string) string {
 	switch disposition {
-	case "XFER", "A": // Transferred or Answered
+	case "XFER", "A", "CB", "SV": // Transferred, Answered, Callback requested or Survey answered
 		return "completed"
-	case "AM", "NA", "N", "B", "FAIL", "CONG", "NI", "DNC":
+	case "AM", "NA", "N", "B", "FAIL", "CONG", "NI", "DNC", "AB", "XFERFAIL", "NO_AUDIO":
 		return "failed"
 	default:
 		return "completed" // Fallback
@@ -333,23 +638,50 @@ func mapCallStatusToContactStatus(disposition string) string {
 
 // ===== Comandos AGI =====
 
-// execCommand ejecuta un comando AGI y devuelve la respuesta
+// execCommand ejecuta un comando AGI corto con fastagi.command_timeout
 func (s *Session) execCommand(cmd string) (string, error) {
+	return s.execCommandTimeout(cmd, s.config.FastAGI.CommandDeadline())
+}
+
+// execCommandTimeout ejecuta un comando AGI y devuelve la respuesta.
+// Si Asterisk no responde dentro del timeout la conexión se da por perdida.
+func (s *Session) execCommandTimeout(cmd string, timeout time.Duration) (string, error) {
+	if s.timedOut {
+		return "", fmt.Errorf("sesión cerrada por timeout")
+	}
+	// Asterisk acepta GET VARIABLE en canales muertos (necesario para leer QUEUESTATUS/DIALSTATUS)
+	if s.hungUp && !strings.HasPrefix(cmd, "GET VARIABLE ") {
+		return "", ErrHangup
+	}
+	s.conn.SetDeadline(time.Now().Add(timeout))
+
 	// Enviar comando
 	if _, err := s.writer.WriteString(cmd + "\n"); err != nil {
-		return "", err
+		return "", s.connError(cmd, err)
 	}
 	if err := s.writer.Flush(); err != nil {
-		return "", err
+		return "", s.connError(cmd, err)
 	}
 
-	// Leer respuesta
-	response, err := s.reader.ReadString('\n')
-	if err != nil {
-		return "", err
+	// Leer respuesta. Asterisk puede intercalar "HANGUP" antes de la respuesta al colgarse el canal.
+	var response string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return "", s.connError(cmd, err)
+		}
+		response = strings.TrimSpace(line)
+		if response != "HANGUP" {
+			break
+		}
+		s.hungUp = true
 	}
 
-	response = strings.TrimSpace(response)
+	// 511: comando no permitido sobre un canal muerto
+	if strings.HasPrefix(response, "511") {
+		s.hungUp = true
+		return "", ErrHangup
+	}
 
 	// Verificar error
 	if strings.HasPrefix(response, "520") {
@@ -359,6 +691,19 @@ func (s *Session) execCommand(cmd string) (string, error) {
 	return response, nil
 }
 
+// connError marca la sesión si el error fue un deadline vencido o un cierre de Asterisk
+func (s *Session) connError(cmd string, err error) error {
+	if errors.Is(err, io.EOF) {
+		s.hungUp = true
+		return ErrHangup
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		s.timedOut = true
+		return fmt.Errorf("timeout ejecutando '%s': %w", strings.SplitN(cmd, " ", 2)[0], err)
+	}
+	return err
+}
+
 // GetVariable obtiene el valor de una variable de canal
 func (s *Session) GetVariable(name string) (string, error) {
 	resp, err := s.execCommand(fmt.Sprintf("GET VARIABLE %s", name))
@@ -388,14 +733,23 @@ func (s *Session) StreamFile(file string) error {
 	// Remover extensión si existe
 	file = strings.TrimSuffix(file, ".wav")
 	file = strings.TrimSuffix(file, ".gsm")
+	s.event(database.CallEventAudio, s.soundName(file))
 
-	_, err := s.execCommand(fmt.Sprintf("STREAM FILE %s \"\"", file))
-	return err
+	resp, err := s.execCommandTimeout(fmt.Sprintf("STREAM FILE %s \"\"", file), s.config.FastAGI.MediaDeadline())
+	if err != nil {
+		return err
+	}
+	// result=-1 es fallo o cuelgue; solo es cuelgue si Asterisk lo notificó
+	if s.hungUp && strings.Contains(resp, "result=-1") {
+		return ErrHangup
+	}
+	return nil
 }
 
 // WaitForDTMF espera un dígito DTMF con timeout
 func (s *Session) WaitForDTMF(timeout int) (string, error) {
-	resp, err := s.execCommand(fmt.Sprintf("WAIT FOR DIGIT %d", timeout*1000))
+	resp, err := s.execCommandTimeout(fmt.Sprintf("WAIT FOR DIGIT %d", timeout*1000),
+		time.Duration(timeout)*time.Second+s.config.FastAGI.CommandDeadline())
 	if err != nil {
 		return "", err
 	}
@@ -414,6 +768,12 @@ func (s *Session) WaitForDTMF(timeout int) (string, error) {
 		return "", fmt.Errorf("código DTMF inválido: %s", digitStr)
 	}
 
+	// -1: fallo del canal (colgado)
+	if digitCode == -1 {
+		s.hungUp = true
+		return "", ErrHangup
+	}
+
 	if digitCode == 0 {
 		return "", fmt.Errorf("timeout esperando DTMF")
 	}
@@ -423,13 +783,55 @@ func (s *Session) WaitForDTMF(timeout int) (string, error) {
 	// *: 42
 	// #: 35
 	if (digitCode >= 48 && digitCode <= 57) || digitCode == 42 || digitCode == 35 {
-		return string(rune(digitCode)), nil
+		digit := string(rune(digitCode))
+		s.event(database.CallEventDTMF, digit)
+		return digit, nil
 	}
 
 	// Si recibimos algo fuera de rango, lo ignoramos o retornamos error
 	return "", fmt.Errorf("DTMF inválido (ASCII %d)", digitCode)
 }
 
+// GetData reproduce un audio y captura hasta maxDigits dígitos.
+// Asterisk termina la captura con '#' o tras timeout segundos sin marcar.
+func (s *Session) GetData(file string, timeout int, maxDigits int) (string, error) {
+	file = strings.TrimSuffix(file, ".wav")
+	file = strings.TrimSuffix(file, ".gsm")
+	s.event(database.CallEventAudio, s.soundName(file))
+
+	// El timeout de la conexión cubre el audio más un timeout por dígito
+	deadline := s.config.FastAGI.MediaDeadline() + time.Duration(timeout*maxDigits)*time.Second
+	resp, err := s.execCommandTimeout(fmt.Sprintf("GET DATA %s %d %d", file, timeout*1000, maxDigits), deadline)
+	if err != nil {
+		return "", err
+	}
+
+	// Parsear respuesta: 200 result=<dígitos> [(timeout)]
+	// Ejemplo: 200 result=123456
+	// Ejemplo: 200 result=12 (timeout)
+	// Ejemplo: 200 result=-1 (canal colgado)
+	idx := strings.Index(resp, "result=")
+	if idx < 0 {
+		return "", fmt.Errorf("respuesta inválida: %s", resp)
+	}
+	digits := strings.Fields(resp[idx+len("result="):])
+	if len(digits) == 0 || strings.HasPrefix(digits[0], "(") {
+		return "", nil
+	}
+	if digits[0] == "-1" {
+		s.hungUp = true
+		return "", ErrHangup
+	}
+	captured := strings.TrimSuffix(digits[0], "#")
+	s.event(database.CallEventDTMF, captured)
+	return captured, nil
+}
+
+// soundName quita sound_path del archivo para registrarlo como en el proyecto
+func (s *Session) soundName(file string) string {
+	return strings.TrimPrefix(file, strings.TrimSuffix(s.config.Asterisk.SoundPath, "/")+"/")
+}
+
 // SetVariable establece una variable de canal
 func (s *Session) SetVariable(name, value string) error {
 	_, err := s.execCommand(fmt.Sprintf("SET VARIABLE %s \"%s\"", name, value))
@@ -438,7 +840,7 @@ func (s *Session) SetVariable(name, value string) error {
 
 // Exec ejecuta una aplicación de Asterisk
 func (s *Session) Exec(app string, args string) error {
-	_, err := s.execCommand(fmt.Sprintf("EXEC %s %s", app, args))
+	_, err := s.execCommandTimeout(fmt.Sprintf("EXEC %s %s", app, args), s.config.FastAGI.MediaDeadline())
 	return err
 }
 
@@ -0,0 +1,91 @@
+package fastagi
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// durationBuckets son los límites (en segundos) del histograma de duración de sesiones
+var durationBuckets = []int{10, 30, 60, 120, 300}
+
+// SessionStats resume la actividad del servidor FastAGI
+type SessionStats struct {
+	Active        int            `json:"active"`
+	MaxSessions   int            `json:"max_sessions"`
+	Total         int64          `json:"total"`
+	Rejected      int64          `json:"rejected"`  // Conexiones rechazadas por max_sessions
+	TimedOut      int64          `json:"timed_out"` // Sesiones cortadas por deadline
+	Errors        int64          `json:"errors"`
+	AvgDurationMs int64          `json:"avg_duration_ms"`
+	MaxDurationMs int64          `json:"max_duration_ms"`
+	Durations     map[string]int `json:"durations"` // Histograma: "<=10s", "<=30s", ..., ">300s"
+}
+
+// sessionMetrics acumula métricas de sesiones terminadas
+type sessionMetrics struct {
+	mu       sync.Mutex
+	total    int64
+	rejected int64
+	timedOut int64
+	errors   int64
+	sum      time.Duration
+	max      time.Duration
+	buckets  []int
+}
+
+func newSessionMetrics() *sessionMetrics {
+	return &sessionMetrics{buckets: make([]int, len(durationBuckets)+1)}
+}
+
+func (m *sessionMetrics) reject() {
+	m.mu.Lock()
+	m.rejected++
+	m.mu.Unlock()
+}
+
+// observe registra una sesión terminada
+func (m *sessionMetrics) observe(d time.Duration, timedOut, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total++
+	m.sum += d
+	if d > m.max {
+		m.max = d
+	}
+	if timedOut {
+		m.timedOut++
+	}
+	if failed {
+		m.errors++
+	}
+
+	i := 0
+	for i < len(durationBuckets) && d > time.Duration(durationBuckets[i])*time.Second {
+		i++
+	}
+	m.buckets[i]++
+}
+
+func (m *sessionMetrics) snapshot() SessionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := SessionStats{
+		Total:         m.total,
+		Rejected:      m.rejected,
+		TimedOut:      m.timedOut,
+		Errors:        m.errors,
+		MaxDurationMs: m.max.Milliseconds(),
+		Durations:     make(map[string]int, len(m.buckets)),
+	}
+	if m.total > 0 {
+		st.AvgDurationMs = (m.sum / time.Duration(m.total)).Milliseconds()
+	}
+	for i, b := range durationBuckets {
+		st.Durations["<="+strconv.Itoa(b)+"s"] = m.buckets[i]
+	}
+	st.Durations[">"+strconv.Itoa(durationBuckets[len(durationBuckets)-1])+"s"] = m.buckets[len(durationBuckets)]
+	return st
+}
@@ -0,0 +1,105 @@
+package fastagi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/i18n"
+)
+
+// runSurvey reproduce las preguntas de la encuesta en orden y guarda cada respuesta en
+// apicall_survey_responses. Una pregunta sin respuesta válida tras sus intentos se omite.
+// Si el destino cuelga las respuestas ya dadas se conservan.
+func (s *Session) runSurvey(proyecto *database.Proyecto, survey *database.Survey, startTime time.Time) error {
+	invalidAudio := fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, i18n.Prompt(proyecto.Locale, i18n.PromptInvalid))
+	telefono, _ := s.GetVariable("APICALL_TELEFONO")
+	if telefono == "" {
+		telefono = s.vars["agi_callerid"]
+	}
+
+	s.Verbose(fmt.Sprintf("Apicall: Encuesta '%s' (%d preguntas)", survey.Nombre, len(survey.Preguntas)), 3)
+	answered := 0
+	for _, q := range survey.Preguntas {
+		timeout := q.Timeout
+		if timeout <= 0 {
+			timeout = 5
+		}
+		attempts := q.Intentos
+		if attempts <= 0 {
+			attempts = 2
+		}
+		step := fmt.Sprintf("survey_%d", q.Orden)
+
+		var answer string
+		for attempt := 1; attempt <= attempts && answer == ""; attempt++ {
+			if attempt > 1 {
+				s.setStep("invalid_audio", "opcion_invalida")
+				if err := s.StreamFile(invalidAudio); errors.Is(err, ErrHangup) {
+					return s.abandon(startTime, "")
+				}
+			}
+
+			s.setStep(step, q.Audio)
+			digit, err := s.GetData(fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, q.Audio), timeout, 1)
+			if errors.Is(err, ErrHangup) {
+				return s.abandon(startTime, "")
+			}
+			if err != nil {
+				s.Verbose(fmt.Sprintf("Apicall Warning: Error en pregunta %d: %v", q.Orden, err), 3)
+				continue
+			}
+			if digit != "" && (q.Opciones == "" || strings.Contains(q.Opciones, digit)) {
+				answer = digit
+			}
+		}
+
+		if answer == "" {
+			s.Verbose(fmt.Sprintf("Apicall: Pregunta %d sin respuesta valida", q.Orden), 3)
+			continue
+		}
+		answered++
+		log.Printf("[Session] Encuesta %d pregunta %d: %s", survey.ID, q.Orden, answer)
+
+		if s.logID > 0 {
+			resp := &database.SurveyResponse{
+				SurveyID:   survey.ID,
+				QuestionID: q.ID,
+				CallLogID:  s.logID,
+				ProyectoID: proyecto.ID,
+				Telefono:   telefono,
+				Respuesta:  answer,
+			}
+			if s.campaignID > 0 {
+				campaignID := s.campaignID
+				resp.CampaignID = &campaignID
+			}
+			if s.contactID > 0 {
+				contactID := s.contactID
+				resp.ContactID = &contactID
+			}
+			if err := s.repo.SaveSurveyResponse(resp); err != nil {
+				log.Printf("[Session] %v", err)
+			}
+		}
+	}
+
+	if survey.EndAudio != "" {
+		s.setStep("survey_end", survey.EndAudio)
+		if err := s.StreamFile(fmt.Sprintf("%s/%s", s.config.Asterisk.SoundPath, survey.EndAudio)); errors.Is(err, ErrHangup) {
+			return s.abandon(startTime, "")
+		}
+	}
+
+	// SV = encuesta respondida (al menos una pregunta); sin respuestas cuenta como no interesado
+	disposition := "SV"
+	if answered == 0 {
+		disposition = "N"
+	}
+	s.updateLog("COMPLETED", disposition, true, "", int(time.Since(startTime).Seconds()), nil)
+	s.Verbose("=== Apicall: Sesion Terminada (encuesta) ===", 3)
+	return nil
+}
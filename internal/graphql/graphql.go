@@ -0,0 +1,518 @@
+// Package graphql implementa el subconjunto de GraphQL que usa la API de lectura para dashboards:
+// consultas con argumentos, variables, alias y fragmentos, resueltas por resolvers de la raíz. Los
+// campos de cada objeto son los tags json de los structs que devuelven los resolvers, así el esquema
+// es el mismo de la API REST. No hay mutaciones, directivas ni introspección.
+package graphql
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// MaxDepth es la profundidad máxima de una consulta (campos anidados, con los fragmentos expandidos)
+	MaxDepth = 10
+	// MaxFields es la cantidad máxima de campos de una consulta con los fragmentos expandidos
+	MaxFields = 1000
+)
+
+// Resolver resuelve un campo de la raíz con sus argumentos (variables ya reemplazadas)
+type Resolver func(args map[string]interface{}) (interface{}, error)
+
+// Schema son los campos de la raíz (type Query)
+type Schema map[string]Resolver
+
+// Request es el cuerpo de una solicitud GraphQL sobre HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Error es un error de la consulta; Path indica el campo de la respuesta que no se pudo resolver
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response es el resultado de Execute. Sin Data la consulta no se ejecutó (error de sintaxis o de
+// validación); con Data, los campos que fallaron quedan en null y su error en Errors.
+type Response struct {
+	Data   *Object `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Object es un objeto de la respuesta que conserva el orden de los campos pedidos
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *Object) set(key string, v interface{}) {
+	if o.values == nil {
+		o.values = make(map[string]interface{})
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Execute parsea y ejecuta la consulta
+func (s Schema) Execute(req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return requestError(err)
+	}
+
+	var op *operation
+	for _, o := range doc.operations {
+		if req.OperationName == "" || o.name == req.OperationName {
+			if op != nil {
+				return requestError(fmt.Errorf("la consulta tiene varias operaciones: indique operationName"))
+			}
+			op = o
+		}
+	}
+	if op == nil {
+		return requestError(fmt.Errorf("operación \"%s\" no encontrada", req.OperationName))
+	}
+
+	vars := make(map[string]interface{})
+	for _, v := range op.vars {
+		val, ok := req.Variables[v.name]
+		if !ok && v.hasDef {
+			val, ok = v.def, true
+		}
+		if (!ok || val == nil) && v.nonNull {
+			return requestError(fmt.Errorf("falta la variable obligatoria $%s", v.name))
+		}
+		if ok {
+			vars[v.name] = val
+		}
+	}
+
+	depth, count, err := complexity(op.sel, doc.fragments)
+	if err != nil {
+		return requestError(err)
+	}
+	if depth > MaxDepth {
+		return requestError(fmt.Errorf("la consulta excede la profundidad máxima (%d)", MaxDepth))
+	}
+	if count > MaxFields {
+		return requestError(fmt.Errorf("la consulta excede el máximo de %d campos", MaxFields))
+	}
+
+	fields, err := collect(op.sel, doc.fragments)
+	if err != nil {
+		return requestError(err)
+	}
+	for _, f := range fields {
+		if _, ok := s[f.name]; !ok && f.name != "__typename" {
+			return requestError(fmt.Errorf("el campo \"%s\" no existe en Query", f.name))
+		}
+	}
+
+	resp := &Response{Data: &Object{}}
+	for _, f := range fields {
+		key := f.key()
+		if f.name == "__typename" {
+			resp.Data.set(key, "Query")
+			continue
+		}
+		val, err := s.resolve(f, doc.fragments, vars)
+		if err != nil {
+			resp.Data.set(key, nil)
+			resp.Errors = append(resp.Errors, Error{Message: err.Error(), Path: []interface{}{key}})
+			continue
+		}
+		resp.Data.set(key, val)
+	}
+	return resp
+}
+
+func requestError(err error) *Response {
+	return &Response{Errors: []Error{{Message: err.Error()}}}
+}
+
+func (s Schema) resolve(f *field, fragments map[string][]selection, vars map[string]interface{}) (interface{}, error) {
+	args := map[string]interface{}{}
+	if f.args != nil {
+		sub, err := substitute(f.args, vars)
+		if err != nil {
+			return nil, err
+		}
+		args = sub.(map[string]interface{})
+	}
+	val, err := s[f.name](args)
+	if err != nil {
+		return nil, err
+	}
+	return complete(reflect.ValueOf(val), f, fragments)
+}
+
+// substitute reemplaza las variables en los argumentos
+func substitute(v interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case varRef:
+		return vars[string(val)], nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			var err error
+			if out[i], err = substitute(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			var err error
+			if out[k], err = substitute(item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// complexity devuelve la profundidad y la cantidad de campos de la selección con los fragmentos
+// expandidos. Cada fragmento se mide una sola vez y la cuenta se satura en MaxFields+1, así una
+// consulta que se expande exponencialmente se rechaza sin recorrerla.
+func complexity(sels []selection, fragments map[string][]selection) (int, int, error) {
+	type cost struct{ depth, count int }
+	memo := make(map[string]cost)
+	visiting := make(map[string]bool)
+
+	var measure func(sels []selection) (cost, error)
+	measure = func(sels []selection) (cost, error) {
+		var c cost
+		for _, sel := range sels {
+			var sub cost
+			switch {
+			case sel.field != nil:
+				inner, err := measure(sel.field.sel)
+				if err != nil {
+					return c, err
+				}
+				sub = cost{depth: inner.depth + 1, count: inner.count + 1}
+			case sel.spread != "":
+				if m, ok := memo[sel.spread]; ok {
+					sub = m
+					break
+				}
+				frag, ok := fragments[sel.spread]
+				if !ok {
+					return c, fmt.Errorf("fragmento \"%s\" no definido", sel.spread)
+				}
+				if visiting[sel.spread] {
+					return c, fmt.Errorf("el fragmento \"%s\" se incluye a sí mismo", sel.spread)
+				}
+				visiting[sel.spread] = true
+				m, err := measure(frag)
+				delete(visiting, sel.spread)
+				if err != nil {
+					return c, err
+				}
+				memo[sel.spread] = m
+				sub = m
+			default:
+				inner, err := measure(sel.inline)
+				if err != nil {
+					return c, err
+				}
+				sub = inner
+			}
+			c.depth = max(c.depth, sub.depth)
+			c.count = min(c.count+sub.count, MaxFields+1)
+		}
+		return c, nil
+	}
+
+	c, err := measure(sels)
+	return c.depth, c.count, err
+}
+
+// collect aplana la selección: expande los fragmentos y une los campos con el mismo nombre de
+// respuesta (sus subselecciones se combinan sin repetir selecciones ya incluidas). Cada fragmento
+// se expande una vez por nivel: repetirlo no agrega campos.
+func collect(sels []selection, fragments map[string][]selection) ([]*field, error) {
+	var fields []*field
+	byKey := make(map[string]*field)
+	expanded := make(map[string]bool)
+	var walk func(sels []selection, visiting []string) error
+	walk = func(sels []selection, visiting []string) error {
+		for _, sel := range sels {
+			switch {
+			case sel.field != nil:
+				if prev, ok := byKey[sel.field.key()]; ok {
+					if prev.name != sel.field.name {
+						return fmt.Errorf("el alias \"%s\" se usa para campos distintos", sel.field.key())
+					}
+					prev.sel = mergeSelections(prev.sel, sel.field.sel)
+					continue
+				}
+				f := *sel.field
+				byKey[f.key()] = &f
+				fields = append(fields, &f)
+			case sel.spread != "":
+				frag, ok := fragments[sel.spread]
+				if !ok {
+					return fmt.Errorf("fragmento \"%s\" no definido", sel.spread)
+				}
+				for _, name := range visiting {
+					if name == sel.spread {
+						return fmt.Errorf("el fragmento \"%s\" se incluye a sí mismo", sel.spread)
+					}
+				}
+				if expanded[sel.spread] {
+					continue
+				}
+				expanded[sel.spread] = true
+				if err := walk(frag, append(visiting, sel.spread)); err != nil {
+					return err
+				}
+			default:
+				if err := walk(sel.inline, visiting); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(sels, nil); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// mergeSelections agrega a dst las selecciones de src que no estén ya (el mismo campo del documento,
+// el mismo fragmento o el mismo fragmento inline). dst no se modifica: puede ser del documento.
+func mergeSelections(dst, src []selection) []selection {
+	out := dst[:len(dst):len(dst)]
+	for _, sel := range src {
+		dup := false
+		for _, prev := range out {
+			if sameSelection(prev, sel) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, sel)
+		}
+	}
+	return out
+}
+
+func sameSelection(a, b selection) bool {
+	switch {
+	case a.field != nil || b.field != nil:
+		return a.field == b.field
+	case a.spread != "" || b.spread != "":
+		return a.spread == b.spread
+	default:
+		return len(a.inline) > 0 && len(b.inline) > 0 && &a.inline[0] == &b.inline[0]
+	}
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// complete arma el valor de la respuesta para el campo f: los objetos (structs y maps) solo con los
+// subcampos pedidos y las listas elemento por elemento. Los demás valores se devuelven tal cual.
+func complete(v reflect.Value, f *field, fragments map[string][]selection) (interface{}, error) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	leaf := v.Type().Implements(jsonMarshaler) || v.Type().Implements(textMarshaler) ||
+		reflect.PointerTo(v.Type()).Implements(jsonMarshaler) || reflect.PointerTo(v.Type()).Implements(textMarshaler)
+	switch {
+	case !leaf && (v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 || v.Kind() == reflect.Array):
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			item, err := complete(v.Index(i), f, fragments)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = item
+		}
+		return out, nil
+
+	case !leaf && v.Kind() == reflect.Struct:
+		if len(f.sel) == 0 {
+			return nil, fmt.Errorf("el campo \"%s\" requiere seleccionar subcampos", f.key())
+		}
+		index := jsonFields(v.Type())
+		return completeObject(f, fragments, func(name string) (reflect.Value, bool) {
+			idx, ok := index[name]
+			if !ok {
+				return reflect.Value{}, false
+			}
+			fv, err := v.FieldByIndexErr(idx)
+			if err != nil {
+				return reflect.Value{}, true // struct embebido nil
+			}
+			return fv, true
+		})
+
+	case !leaf && v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && len(f.sel) > 0:
+		return completeObject(f, fragments, func(name string) (reflect.Value, bool) {
+			return v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())), true
+		})
+	}
+
+	if len(f.sel) > 0 {
+		return nil, fmt.Errorf("el campo \"%s\" no tiene subcampos", f.key())
+	}
+	return v.Interface(), nil
+}
+
+func completeObject(f *field, fragments map[string][]selection, lookup func(name string) (reflect.Value, bool)) (interface{}, error) {
+	fields, err := collect(f.sel, fragments)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{}
+	for _, sub := range fields {
+		val, ok := lookup(sub.name)
+		if !ok {
+			return nil, fmt.Errorf("el campo \"%s\" no existe en \"%s\"", sub.name, f.key())
+		}
+		out, err := complete(val, sub, fragments)
+		if err != nil {
+			return nil, err
+		}
+		obj.set(sub.key(), out)
+	}
+	return obj, nil
+}
+
+var fieldCache sync.Map // reflect.Type -> map[string][]int
+
+// jsonFields devuelve el índice de cada campo del struct según su nombre en JSON (incluye los de
+// los structs embebidos, como hace encoding/json)
+func jsonFields(t reflect.Type) map[string][]int {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	index := make(map[string][]int)
+	var walk func(t reflect.Type, prefix []int, depth int)
+	walk = func(t reflect.Type, prefix []int, depth int) {
+		var embedded []reflect.StructField
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				embedded = append(embedded, sf)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			if _, ok := index[name]; !ok {
+				index[name] = append(append([]int{}, prefix...), i)
+			}
+		}
+		// Los campos propios tienen prioridad sobre los de los structs embebidos
+		if depth < 5 {
+			for _, sf := range embedded {
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				walk(ft, append(append([]int{}, prefix...), sf.Index...), depth+1)
+			}
+		}
+	}
+	walk(t, nil, 0)
+	fieldCache.Store(t, index)
+	return index
+}
+
+// Values convierte los argumentos en parámetros de query string (las listas separadas por coma),
+// para reutilizar el parseo de los endpoints REST
+func Values(args map[string]interface{}) url.Values {
+	q := url.Values{}
+	for k, v := range args {
+		if s, ok := scalarString(v); ok {
+			q.Set(k, s)
+			continue
+		}
+		if list, ok := v.([]interface{}); ok {
+			var items []string
+			for _, item := range list {
+				if s, ok := scalarString(item); ok {
+					items = append(items, s)
+				}
+			}
+			q.Set(k, strings.Join(items, ","))
+		}
+	}
+	return q
+}
+
+func scalarString(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case int:
+		return strconv.Itoa(val), true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	}
+	return "", false
+}
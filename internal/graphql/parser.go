@@ -0,0 +1,501 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+// lex separa la consulta en tokens (las comas y los comentarios # se ignoran, como en la especificación)
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "\ufeff"):
+			i += len("\ufeff")
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, token{tokPunct, "...", i})
+			i += 3
+		case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			toks = append(toks, token{tokName, src[start:i], start})
+		case c == '-' || c >= '0' && c <= '9':
+			start := i
+			kind := tokInt
+			i++
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				kind = tokFloat
+				i++
+				for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				kind = tokFloat
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+					i++
+				}
+			}
+			toks = append(toks, token{kind, src[start:i], start})
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return nil, fmt.Errorf("string sin cerrar en la posición %d", i)
+			}
+			toks = append(toks, token{tokString, src[i+3 : i+3+end], i})
+			i += 3 + end + 3
+		case c == '"':
+			s, n, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{tokString, s, i})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, fmt.Errorf("carácter inesperado \"%s\" en la posición %d", string(r), i)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// lexString lee el string entre comillas que empieza en start, con sus escapes; devuelve el valor y
+// los bytes consumidos
+func lexString(src string, start int) (string, int, error) {
+	var sb strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '"':
+			return sb.String(), i + 1 - start, nil
+		case '\n', '\r':
+			return "", 0, fmt.Errorf("string sin cerrar en la posición %d", start)
+		case '\\':
+			i++
+			if i >= len(src) {
+				return "", 0, fmt.Errorf("string sin cerrar en la posición %d", start)
+			}
+			switch src[i] {
+			case '"', '\\', '/':
+				sb.WriteByte(src[i])
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if i+4 >= len(src) {
+					return "", 0, fmt.Errorf("escape inválido en la posición %d", i)
+				}
+				code, err := strconv.ParseUint(src[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("escape inválido en la posición %d", i)
+				}
+				sb.WriteRune(rune(code))
+				i += 4
+			default:
+				return "", 0, fmt.Errorf("escape inválido en la posición %d", i)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("string sin cerrar en la posición %d", start)
+}
+
+// document es una consulta parseada: operaciones y fragmentos con nombre
+type document struct {
+	operations []*operation
+	fragments  map[string][]selection
+}
+
+type operation struct {
+	name string
+	vars []varDef
+	sel  []selection
+}
+
+type varDef struct {
+	name    string
+	nonNull bool
+	def     interface{}
+	hasDef  bool
+}
+
+// selection es un campo, un fragmento con nombre (spread) o un fragmento inline
+type selection struct {
+	field  *field
+	spread string
+	inline []selection
+}
+
+type field struct {
+	alias string
+	name  string
+	args  map[string]interface{}
+	sel   []selection
+}
+
+// key es el nombre del campo en la respuesta
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// varRef es una referencia a una variable ($nombre) dentro de los argumentos
+type varRef string
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func parse(src string) (*document, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	doc := &document{fragments: make(map[string][]selection)}
+	for p.peek().kind != tokEOF {
+		t := p.peek()
+		switch {
+		case t.kind == tokPunct && t.val == "{":
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{sel: sel})
+		case t.kind == tokName && t.val == "query":
+			p.next()
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == tokName && (t.val == "mutation" || t.val == "subscription"):
+			return nil, fmt.Errorf("solo se admiten consultas (query): la API GraphQL es de solo lectura")
+		case t.kind == tokName && t.val == "fragment":
+			p.next()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.keyword("on"); err != nil {
+				return nil, err
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[name]; dup {
+				return nil, fmt.Errorf("fragmento \"%s\" duplicado", name)
+			}
+			doc.fragments[name] = sel
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("la consulta no tiene operaciones")
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("fin inesperado de la consulta")
+	}
+	return fmt.Errorf("token inesperado \"%s\" en la posición %d", t.val, t.pos)
+}
+
+// punct consume el signo indicado si es el siguiente token
+func (p *parser) punct(val string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.val == val {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(val string) error {
+	if !p.punct(val) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	if t := p.peek(); t.kind == tokName {
+		p.i++
+		return t.val, nil
+	}
+	return "", p.unexpected()
+}
+
+func (p *parser) keyword(val string) error {
+	if t := p.peek(); t.kind == tokName && t.val == val {
+		p.i++
+		return nil
+	}
+	return p.unexpected()
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{}
+	if p.peek().kind == tokName {
+		op.name = p.next().val
+	}
+	if p.punct("(") {
+		for !p.punct(")") {
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			nonNull, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			v := varDef{name: name, nonNull: nonNull}
+			if p.punct("=") {
+				if v.def, err = p.value(true); err != nil {
+					return nil, err
+				}
+				v.hasDef = true
+			}
+			op.vars = append(op.vars, v)
+		}
+	}
+	if p.peek().kind == tokPunct && p.peek().val == "@" {
+		return nil, fmt.Errorf("las directivas no están soportadas")
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.sel = sel
+	return op, nil
+}
+
+// typeRef lee el tipo de una variable (Int, [String!]!, ...); solo importa si es obligatoria
+func (p *parser) typeRef() (bool, error) {
+	if p.punct("[") {
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	return p.punct("!"), nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.punct("}") {
+		if p.punct("...") {
+			if t := p.peek(); t.kind == tokName && t.val != "on" {
+				sels = append(sels, selection{spread: p.next().val})
+				continue
+			}
+			if p.peek().kind == tokName {
+				p.next() // on
+				if _, err := p.name(); err != nil {
+					return nil, err
+				}
+			}
+			inline, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, selection{inline: inline})
+			continue
+		}
+
+		f := &field{}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		f.name = name
+		if p.punct(":") {
+			f.alias = name
+			if f.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.punct("(") {
+			f.args = make(map[string]interface{})
+			for !p.punct(")") {
+				arg, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if f.args[arg], err = p.value(false); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if t := p.peek(); t.kind == tokPunct && t.val == "@" {
+			return nil, fmt.Errorf("las directivas no están soportadas")
+		}
+		if t := p.peek(); t.kind == tokPunct && t.val == "{" {
+			if f.sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		sels = append(sels, selection{field: f})
+	}
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("selección de campos vacía")
+	}
+	return sels, nil
+}
+
+// value lee un valor: escalares, enums (como string), listas, objetos y variables (salvo en defaults)
+func (p *parser) value(constant bool) (interface{}, error) {
+	if p.peek().kind == tokEOF {
+		return nil, p.unexpected()
+	}
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		n, err := strconv.Atoi(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("entero inválido \"%s\"", t.val)
+		}
+		return n, nil
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("número inválido \"%s\"", t.val)
+		}
+		return f, nil
+	case tokString:
+		return t.val, nil
+	case tokName:
+		switch t.val {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.val, nil
+	case tokPunct:
+		switch t.val {
+		case "$":
+			if constant {
+				return nil, fmt.Errorf("no se admiten variables en el valor por defecto")
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return varRef(name), nil
+		case "[":
+			list := []interface{}{}
+			for !p.punct("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			obj := map[string]interface{}{}
+			for !p.punct("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+	}
+	p.i--
+	return nil, p.unexpected()
+}
@@ -0,0 +1,195 @@
+// Package i18n resuelve el idioma de los prompts de sistema del IVR (por proyecto) y traduce los
+// mensajes de error de la API. Los mensajes se escriben en español en el código y funcionan como
+// clave del catálogo: un mensaje sin traducción se devuelve tal cual.
+package i18n
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Default es el idioma de los mensajes del código y de los prompts sin subcarpeta
+const Default = "es"
+
+// Locales son los idiomas soportados
+var Locales = []string{"es", "en"}
+
+// Prompts de sistema del IVR (archivos en sound_path, sin extensión)
+const (
+	PromptInvalid = "opcion_invalida" // Opción inválida / sin respuesta, antes de reintentar
+	PromptConfirm = "en_breve"        // Confirmación antes de transferir
+)
+
+// SystemPrompts son los prompts de sistema que usa el IVR
+var SystemPrompts = []string{PromptInvalid, PromptConfirm}
+
+// IsLocale indica si s es un idioma soportado (vacío = Default)
+func IsLocale(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, l := range Locales {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
+
+// Prompt devuelve la ruta (relativa a sound_path) del prompt de sistema en el idioma indicado.
+// El español queda en la raíz de sound_path como siempre; los demás idiomas van en una subcarpeta
+// con su código (ej: en/opcion_invalida).
+func Prompt(locale, name string) string {
+	if locale == "" || locale == Default {
+		return name
+	}
+	return locale + "/" + name
+}
+
+// pattern es una entrada del catálogo con verbos de formato (%s, %d, %v)
+type pattern struct {
+	format      string
+	re          *regexp.Regexp
+	translation string
+}
+
+// catalog es el catálogo compilado de un idioma
+type catalog struct {
+	exact    map[string]string
+	patterns []pattern
+}
+
+var catalogs = map[string]*catalog{}
+
+// register compila el catálogo de un idioma (se llama desde el init de cada archivo de mensajes)
+func register(locale string, messages map[string]string) {
+	c := &catalog{exact: make(map[string]string, len(messages))}
+	for msg, translation := range messages {
+		if !strings.Contains(msg, "%") {
+			c.exact[msg] = translation
+			continue
+		}
+		c.patterns = append(c.patterns, pattern{format: msg, re: compile(msg), translation: translation})
+	}
+	// Los formatos más largos (más específicos) se prueban primero
+	sort.Slice(c.patterns, func(i, j int) bool {
+		if len(c.patterns[i].format) != len(c.patterns[j].format) {
+			return len(c.patterns[i].format) > len(c.patterns[j].format)
+		}
+		return c.patterns[i].format < c.patterns[j].format
+	})
+	catalogs[locale] = c
+}
+
+// verbRe encuentra los verbos de formato de una entrada del catálogo
+var verbRe = regexp.MustCompile(`%[dsv]`)
+
+// compile convierte un formato ("prioridad debe estar entre 1 y %d") en una expresión anclada
+func compile(format string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range verbRe.FindAllStringIndex(format, -1) {
+		sb.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		if format[loc[1]-1] == 'd' {
+			sb.WriteString(`(-?\d+)`)
+		} else {
+			sb.WriteString(`(.+)`)
+		}
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(format[last:]))
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// T traduce un mensaje al idioma indicado. Los formatos del catálogo reciben los valores del
+// mensaje original en el mismo orden.
+func T(locale, msg string) string {
+	c := catalogs[locale]
+	if c == nil {
+		return msg
+	}
+	if t, ok := c.exact[msg]; ok {
+		return t
+	}
+	for _, p := range c.patterns {
+		m := p.re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		args := m[1:]
+		return verbRe.ReplaceAllStringFunc(p.translation, func(string) string {
+			if len(args) == 0 {
+				return ""
+			}
+			arg := args[0]
+			args = args[1:]
+			return arg
+		})
+	}
+	return msg
+}
+
+// FromRequest elige el idioma de la respuesta según Accept-Language; si no pide uno soportado
+// devuelve fallback
+func FromRequest(r *http.Request, fallback string) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(part)
+		if i := strings.IndexByte(tag, ';'); i >= 0 {
+			if strings.Contains(tag[i:], "q=0") && !strings.Contains(tag[i:], "q=0.") {
+				continue // q=0: no aceptable
+			}
+			tag = tag[:i]
+		}
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		tag = strings.ToLower(tag)
+		if tag != "" && tag != "*" && IsLocale(tag) {
+			return tag
+		}
+	}
+	if fallback == "" {
+		return Default
+	}
+	return fallback
+}
+
+// Writer traduce los errores en texto plano (http.Error) al idioma de la solicitud
+type Writer struct {
+	http.ResponseWriter
+	locale    string
+	translate bool
+}
+
+// NewWriter envuelve w; con el idioma por defecto no traduce nada
+func NewWriter(w http.ResponseWriter, locale string) http.ResponseWriter {
+	if locale == Default || catalogs[locale] == nil {
+		return w
+	}
+	return &Writer{ResponseWriter: w, locale: locale}
+}
+
+func (w *Writer) WriteHeader(code int) {
+	w.translate = code >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.translate {
+		return w.ResponseWriter.Write(p)
+	}
+	msg := strings.TrimSuffix(string(p), "\n")
+	if _, err := w.ResponseWriter.Write([]byte(T(w.locale, msg) + "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil // http.Error escribe el mensaje en una sola llamada
+}
+
+// Unwrap permite a http.ResponseController llegar al ResponseWriter original (Flush, Hijack)
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
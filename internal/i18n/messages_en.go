@@ -0,0 +1,355 @@
+package i18n
+
+func init() {
+	register("en", messagesEN)
+}
+
+// messagesEN traduce al inglés los mensajes de la API
+var messagesEN = map[string]string{
+	// Generales
+	"Método no permitido":            "Method not allowed",
+	"JSON inválido":                  "Invalid JSON",
+	"JSON inválido (se requiere id)": "Invalid JSON (id is required)",
+	"ID inválido":                    "Invalid ID",
+	"ID requerido":                   "ID is required",
+	"Error interno":                  "Internal error",
+	"Ruta no encontrada":             "Route not found",
+	"Error parseando form":           "Error parsing form",
+	"Error generando reporte":        "Error generating report",
+	"Error calculando estadísticas":  "Error computing statistics",
+
+	// Autenticación y permisos
+	"Acceso denegado": "Access denied",
+	"Acceso denegado: Se requiere rol de Admin":              "Access denied: Admin role required",
+	"Acceso denegado: Se requiere rol de Superadmin":         "Access denied: Superadmin role required",
+	"Acceso denegado: Se requiere rol de Supervisor o Admin": "Access denied: Supervisor or Admin role required",
+	"Credenciales inválidas":                                 "Invalid credentials",
+	"Cuenta bloqueada por intentos fallidos":                 "Account locked after failed attempts",
+	"Organización inactiva":                                  "Organization inactive",
+	"Contraseña actual incorrecta":                           "Current password is incorrect",
+	"Debe cambiar la contraseña antes de continuar":          "You must change your password before continuing",
+	"La nueva contraseña debe ser distinta de la actual":     "The new password must be different from the current one",
+	"password debe tener al menos 8 caracteres":              "password must be at least 8 characters long",
+	"Solo un superadmin puede crear superadmins":             "Only a superadmin can create superadmins",
+	"Solo un superadmin puede administrar superadmins":       "Only a superadmin can manage superadmins",
+	"Solo un superadmin puede administrar otros admins":      "Only a superadmin can manage other admins",
+	"IP no autorizada":                                       "IP not authorized",
+	"Error hasheando contraseña":                             "Error hashing password",
+	"Error generando token":                                  "Error generating token",
+	"Error generando secreto":                                "Error generating secret",
+	"Error actualizando contraseña":                          "Error updating password",
+	"Error verificando cuenta":                               "Error verifying account",
+	"Sesión cerrada":                                         "Session closed",
+	"Sesión no encontrada":                                   "Session not found",
+	"Error cerrando sesión":                                  "Error closing session",
+	"Error cerrando sesiones":                                "Error closing sessions",
+	"Error listando sesiones":                                "Error listing sessions",
+	"Error consultando sesión":                               "Error querying session",
+	"Error renovando sesión":                                 "Error refreshing session",
+	"user_id inválido":                                       "Invalid user_id",
+	"Verificación vencida, vuelva a iniciar sesión":          "Verification expired, please log in again",
+	"Código de verificación inválido":                        "Invalid verification code",
+	"Error verificando código":                               "Error verifying code",
+	"La autenticación en dos pasos ya está activa":           "Two-factor authentication is already enabled",
+	"La autenticación en dos pasos no está activa":           "Two-factor authentication is not enabled",
+	"No hay un alta de autenticación en dos pasos pendiente": "There is no pending two-factor authentication setup",
+	"Error generando código QR":                              "Error generating QR code",
+	"Error guardando secreto":                                "Error saving secret",
+	"Error activando autenticación en dos pasos":             "Error enabling two-factor authentication",
+	"Error desactivando autenticación en dos pasos":          "Error disabling two-factor authentication",
+	"Error guardando códigos de recuperación":                "Error saving recovery codes",
+
+	// Proveedores de identidad (LDAP / OIDC)
+	"Proveedor de identidad no disponible":                      "Identity provider unavailable",
+	"Usuario sin rol asignado en el proveedor de identidad":     "User has no role assigned in the identity provider",
+	"El usuario ya existe como usuario local":                   "The user already exists as a local user",
+	"Error sincronizando usuario":                               "Error synchronizing user",
+	"La contraseña se administra en el proveedor de identidad":  "The password is managed by the identity provider",
+	"Login OIDC no configurado":                                 "OIDC login is not configured",
+	"Login cancelado en el proveedor de identidad":              "Login cancelled at the identity provider",
+	"No se pudo validar el login con el proveedor de identidad": "Could not validate the login with the identity provider",
+
+	// API GraphQL
+	"API GraphQL deshabilitada (api.enable_graphql)": "GraphQL API disabled (api.enable_graphql)",
+	"query requerido":          "query is required",
+	"variables inválidas":      "Invalid variables",
+	"id requerido":             "id is required",
+	"Error listando contactos": "Error listing contacts",
+	"la consulta tiene varias operaciones: indique operationName":          "the query has several operations: specify operationName",
+	"solo se admiten consultas (query): la API GraphQL es de solo lectura": "only queries are supported: the GraphQL API is read-only",
+	"la consulta no tiene operaciones":                                     "the query has no operations",
+	"fin inesperado de la consulta":                                        "unexpected end of query",
+	"las directivas no están soportadas":                                   "directives are not supported",
+	"selección de campos vacía":                                            "empty selection set",
+	"no se admiten variables en el valor por defecto":                      "variables are not allowed in default values",
+	"operación \"%s\" no encontrada":                                       "operation \"%s\" not found",
+	"falta la variable obligatoria $%s":                                    "missing required variable $%s",
+	"el campo \"%s\" no existe en Query":                                   "field \"%s\" does not exist on Query",
+	"el campo \"%s\" no existe en \"%s\"":                                  "field \"%s\" does not exist on \"%s\"",
+	"el campo \"%s\" requiere seleccionar subcampos":                       "field \"%s\" requires a selection of subfields",
+	"el campo \"%s\" no tiene subcampos":                                   "field \"%s\" has no subfields",
+	"el alias \"%s\" se usa para campos distintos":                         "alias \"%s\" is used for different fields",
+	"fragmento \"%s\" no definido":                                         "fragment \"%s\" is not defined",
+	"fragmento \"%s\" duplicado":                                           "duplicate fragment \"%s\"",
+	"el fragmento \"%s\" se incluye a sí mismo":                            "fragment \"%s\" includes itself",
+	"la consulta excede la profundidad máxima (%d)":                        "the query exceeds the maximum depth (%d)",
+	"la consulta excede el máximo de %d campos":                            "the query exceeds the maximum of %d fields",
+	"token inesperado \"%s\" en la posición %d":                            "unexpected token \"%s\" at position %d",
+	"carácter inesperado \"%s\" en la posición %d":                         "unexpected character \"%s\" at position %d",
+	"string sin cerrar en la posición %d":                                  "unterminated string at position %d",
+	"escape inválido en la posición %d":                                    "invalid escape at position %d",
+	"entero inválido \"%s\"":                                               "invalid integer \"%s\"",
+	"número inválido \"%s\"":                                               "invalid number \"%s\"",
+
+	// Recursos no encontrados
+	"Proyecto no encontrado":                  "Project not found",
+	"Campaña no encontrada":                   "Campaign not found",
+	"Campaña origen no encontrada":            "Source campaign not found",
+	"Troncal no encontrada":                   "Trunk not found",
+	"Llamada no encontrada":                   "Call not found",
+	"Log no encontrado":                       "Log not found",
+	"Canal no encontrado":                     "Channel not found",
+	"Contacto no encontrado":                  "Contact not found",
+	"Archivo no encontrado":                   "File not found",
+	"Usuario no encontrado":                   "User not found",
+	"Organización no encontrada":              "Organization not found",
+	"Importación no encontrada":               "Import not found",
+	"La campaña no tiene origen de contactos": "The campaign has no contact source",
+
+	// Parámetros
+	"proyecto_id requerido":                                                  "proyecto_id is required",
+	"proyecto_id inválido":                                                   "Invalid proyecto_id",
+	"campaign_id requerido":                                                  "campaign_id is required",
+	"campaign_id inválido":                                                   "Invalid campaign_id",
+	"ID de campaña requerido":                                                "Campaign ID is required",
+	"ID de encuesta requerido":                                               "Survey ID is required",
+	"ID de llamada inválido":                                                 "Invalid call ID",
+	"ID de organización requerido":                                           "Organization ID is required",
+	"ID de proyecto requerido":                                               "Project ID is required",
+	"ID de troncal inválido":                                                 "Invalid trunk ID",
+	"troncal_id requerido":                                                   "troncal_id is required",
+	"troncal_id y numero son requeridos":                                     "troncal_id and numero are required",
+	"host requerido":                                                         "host is required",
+	"puerto inválido":                                                        "Invalid port",
+	"key es requerido":                                                       "key is required",
+	"calls es requerido":                                                     "calls is required",
+	"id y status requeridos":                                                 "id and status are required",
+	"nombre y proyecto_id son requeridos":                                    "nombre and proyecto_id are required",
+	"nombre y slug (a-z, 0-9, guiones) son requeridos":                       "nombre and slug (a-z, 0-9, hyphens) are required",
+	"proyecto_id y telefono requeridos":                                      "proyecto_id and telefono are required",
+	"proyecto_id y telefono son requeridos":                                  "proyecto_id and telefono are required",
+	"proyecto_id y audio son requeridos":                                     "proyecto_id and audio are required",
+	"proyecto_id, telefono y name son requeridos":                            "proyecto_id, telefono and name are required",
+	"campaign_id y action requeridos":                                        "campaign_id and action are required",
+	"campaign_id y action (requeue, exclude, include) requeridos":            "campaign_id and action (requeue, exclude, include) are required",
+	"campaign_id, nombre y dispositions son requeridos":                      "campaign_id, nombre and dispositions are required",
+	"Indique contact_ids, telefonos, estados o resultados":                   "Provide contact_ids, telefonos, estados or resultados",
+	"action inválida (start, pause, stop)":                                   "Invalid action (start, pause, stop)",
+	"capacidad no puede ser negativa":                                        "capacidad cannot be negative",
+	"dia_semana debe ser 0-6 (Domingo-Sábado)":                               "dia_semana must be 0-6 (Sunday-Saturday)",
+	"estado debe ser active o resolved":                                      "estado must be active or resolved",
+	"extension debe ser un canal, ej: SIP/101 o PJSIP/101":                   "extension must be a channel, e.g. SIP/101 or PJSIP/101",
+	"granularity debe ser day, week o month":                                 "granularity must be day, week or month",
+	"group_by debe ser day, campaign, troncal o proyecto":                    "group_by must be day, campaign, troncal or proyecto",
+	"group_by debe ser troncal o vacío":                                      "group_by must be troncal or empty",
+	"max_seconds no puede superar 300":                                       "max_seconds cannot exceed 300",
+	"mode debe ser tone o echo":                                              "mode must be tone or echo",
+	"numero, prefijo o caller_id inválidos":                                  "Invalid numero, prefijo or caller_id",
+	"ring_timeout debe estar entre 5 y 120 segundos":                         "ring_timeout must be between 5 and 120 seconds",
+	"ring_timeout debe estar entre 5 y 120 segundos y duration entre 1 y 60": "ring_timeout must be between 5 and 120 seconds and duration between 1 and 60",
+	"suppress_days inválido":                                                 "Invalid suppress_days",
+	"Idempotency-Key demasiado largo (máx 128)":                              "Idempotency-Key too long (max 128)",
+	"El nombre de una troncal no se puede cambiar (lo usan proyectos, campañas y logs)": "A trunk name cannot be changed (it is used by projects, campaigns and logs)",
+	"El proyecto no tiene troncal de salida":                                            "The project has no outbound trunk",
+
+	// Archivos y audios
+	"Archivo demasiado grande":    "File too large",
+	"No se recibió archivo":       "No file received",
+	"Nombre de archivo inválido":  "Invalid file name",
+	"Nombre de archivo requerido": "File name is required",
+	"Error leyendo archivo":       "Error reading file",
+	"Error guardando archivo":     "Error saving file",
+	"Error escribiendo archivo":   "Error writing file",
+	"Error eliminando archivo":    "Error deleting file",
+	"El audio está en uso":        "The audio is in use",
+	"Content-Type no soportado. Use: audio/webm, audio/ogg, audio/wav":                      "Unsupported Content-Type. Use: audio/webm, audio/ogg, audio/wav",
+	"Formato no soportado. Use: wav, gsm, ulaw, alaw, sln, mp3, ogg, flac, m4a, webm, opus": "Unsupported format. Use: wav, gsm, ulaw, alaw, sln, mp3, ogg, flac, m4a, webm, opus",
+	"Error actualizando audio del proyecto":                                                 "Error updating project audio",
+
+	// Llamadas y servicios
+	"Número en lista negra":                     "Number is blacklisted",
+	"Cola de llamadas llena, intente más tarde": "Call queue is full, try again later",
+	"Spooler no disponible, intente más tarde":  "Spooler unavailable, try again later",
+	"Error interno encolando llamada":           "Internal error queuing call",
+	"Error verificando idempotencia":            "Error checking idempotency",
+	"AMI no conectado":                          "AMI not connected",
+	"Nodos Asterisk no disponibles":             "Asterisk nodes unavailable",
+	"Channel Pool no disponible":                "Channel Pool unavailable",
+	"Supervisión no disponible":                 "Call supervision unavailable",
+	"Notificaciones no disponibles":             "Notifications unavailable",
+	"Métricas FastAGI no disponibles":           "FastAGI metrics unavailable",
+	"Recarga de configuración no disponible":    "Configuration reload unavailable",
+
+	// Errores de consulta
+	"Error actualizando configuración":         "Error updating configuration",
+	"Error creando importación":                "Error creating import",
+	"Error eliminando de blacklist":            "Error removing from blacklist",
+	"Error eliminando usuario":                 "Error deleting user",
+	"Error exportando respuestas":              "Error exporting responses",
+	"Error guardando origen de contactos":      "Error saving contact source",
+	"Error leyendo cuotas":                     "Error reading quotas",
+	"Error limpiando blacklist":                "Error clearing blacklist",
+	"Error listando alertas":                   "Error listing alerts",
+	"Error listando Caller IDs en cuarentena":  "Error listing quarantined caller IDs",
+	"Error listando campañas":                  "Error listing campaigns",
+	"Error listando configuraciones":           "Error listing settings",
+	"Error listando encuestas":                 "Error listing surveys",
+	"Error listando importaciones":             "Error listing imports",
+	"Error listando organizaciones":            "Error listing organizations",
+	"Error listando pasadas de retención":      "Error listing retention runs",
+	"Error listando proyectos de la troncal":   "Error listing the trunk's projects",
+	"Error listando proyectos":                 "Error listing projects",
+	"Error listando troncales del proyecto":    "Error listing the project's trunks",
+	"Error listando troncales":                 "Error listing trunks",
+	"Error listando usuarios":                  "Error listing users",
+	"Error obteniendo blacklist":               "Error getting blacklist",
+	"Error obteniendo canales de notificación": "Error getting notification channels",
+	"Error obteniendo disposiciones":           "Error getting dispositions",
+	"Error obteniendo llamadas del contacto":   "Error getting contact calls",
+	"Error obteniendo feriados":                "Error getting holidays",
+	"Error guardando feriado":                  "Error saving holiday",
+	"Error obteniendo estadísticas Smart CID":  "Error getting Smart CID stats",
+	"Error obteniendo zonas por prefijo":       "Error getting prefix time zones",
+	"Error guardando zonas por prefijo":        "Error saving prefix time zones",
+	"Error obteniendo eventos":                 "Error getting events",
+	"Error obteniendo logs":                    "Error getting logs",
+	"Error obteniendo origen de contactos":     "Error getting contact source",
+	"Error obteniendo reglas de blacklist":     "Error getting blacklist rules",
+	"Error obteniendo resumen":                 "Error getting summary",
+	"Error obteniendo schedules":               "Error getting schedules",
+
+	// Validaciones
+	"horario_local inválido (formato HH:MM-HH:MM, ej: 08:00-21:00)": "invalid horario_local (format HH:MM-HH:MM, e.g. 08:00-21:00)",
+	"prefijo inválido: %s (solo dígitos, máximo 16)":                "invalid prefijo: %s (digits only, 16 max)",
+	"timezone inválida para el prefijo %s: %s":                      "invalid timezone for prefijo %s: %s",
+	"descripcion excede 100 caracteres":                             "descripcion exceeds 100 characters",
+	"JSON inválido (se requiere una lista de prefijos)":             "Invalid JSON (a list of prefixes is required)",
+	"prefijo requerido":                                                             "prefijo is required",
+	"caller_id requerido":                                                           "caller_id is required",
+	"Caller ID %s no está en cuarentena":                                            "Caller ID %s is not quarantined",
+	"franja inválida %s (formato HH:MM-HH:MM)":                                      "invalid window %s (format HH:MM-HH:MM)",
+	"franja inválida %s: inicio y fin iguales":                                      "invalid window %s: start and end are equal",
+	"ventana_tz inválida (zona IANA, ej: America/Mexico_City)":                      "invalid ventana_tz (IANA zone, e.g. America/Mexico_City)",
+	"attestation debe ser A, B, C o vacío":                                          "attestation must be A, B, C or empty",
+	"callback_dtmf debe ser un único dígito":                                        "callback_dtmf must be a single digit",
+	"callback_dtmf no puede ser igual a dtmf_esperado":                              "callback_dtmf cannot be the same as dtmf_esperado",
+	"capture_audio requerido cuando capture_digits > 0":                             "capture_audio is required when capture_digits > 0",
+	"capture_digits debe estar entre 0 y 32":                                        "capture_digits must be between 0 and 32",
+	"costo_minuto no puede ser negativo":                                            "costo_minuto cannot be negative",
+	"dial_engine=ari no soporta AMD":                                                "dial_engine=ari does not support AMD",
+	"dial_engine=ari no soporta captura de dígitos":                                 "dial_engine=ari does not support digit capture",
+	"dial_engine=ari no soporta encuestas":                                          "dial_engine=ari does not support surveys",
+	"dial_engine=ari no soporta rellamadas":                                         "dial_engine=ari does not support callbacks",
+	"dial_engine=ari requiere la sección ari habilitada en la configuración":        "dial_engine=ari requires the ari section enabled in the configuration",
+	"dial_engine=ari solo soporta transferencias blind":                             "dial_engine=ari only supports blind transfers",
+	"dial_engine=sim requiere la sección simulation habilitada en la configuración": "dial_engine=sim requires the simulation section enabled in the configuration",
+	"exit_asr_window debe estar entre 0 y 10000 llamadas":                           "exit_asr_window must be between 0 and 10000 calls",
+	"exit_daily_minutes y exit_max_connects no pueden ser negativos":                "exit_daily_minutes and exit_max_connects cannot be negative",
+	"exit_dispositions excede 100 caracteres":                                       "exit_dispositions exceeds 100 characters",
+	"fecha inválida (YYYY-MM-DD)":                                                   "Invalid fecha (YYYY-MM-DD)",
+	"nombre excede 100 caracteres":                                                  "nombre exceeds 100 characters",
+	"exit_min_asr debe estar entre 0 y 100":                                         "exit_min_asr must be between 0 and 100",
+	"exit_max_abandon debe estar entre 0 y 100":                                     "exit_max_abandon must be between 0 and 100",
+	"exit_abandon_hours debe estar entre 0 y %d":                                    "exit_abandon_hours must be between 0 and %d",
+	"hours debe estar entre 1 y %d":                                                 "hours must be between 1 and %d",
+	"Error calculando la tasa de abandono":                                          "Error computing the abandon rate",
+	"from debe ser anterior a to":                                                   "from must be before to",
+	"from inválido (formato YYYY-MM-DD)":                                            "Invalid from (format YYYY-MM-DD)",
+	"to inválido (formato YYYY-MM-DD)":                                              "Invalid to (format YYYY-MM-DD)",
+	"cursor inválido":                                                               "Invalid cursor",
+	"from_date inválido (formato YYYY-MM-DD)":                                       "Invalid from_date (format YYYY-MM-DD)",
+	"to_date inválido (formato YYYY-MM-DD)":                                         "Invalid to_date (format YYYY-MM-DD)",
+	"incremento debe estar entre 1 y 3600 segundos":                                 "incremento must be between 1 and 3600 seconds",
+	"incremento_inicial debe estar entre 0 y 3600 segundos":                         "incremento_inicial must be between 0 and 3600 seconds",
+	"la encuesta requiere al menos una pregunta":                                    "the survey requires at least one question",
+	"locale inválido (es, en)":                                                      "Invalid locale (es, en)",
+	"max_calls_day y max_concurrent no pueden ser negativos":                        "max_calls_day and max_concurrent cannot be negative",
+	"max_number_attempts_day no puede ser negativo":                                 "max_number_attempts_day cannot be negative",
+	"no_repeat_minutes no puede ser negativo":                                       "no_repeat_minutes cannot be negative",
+	"ramp_start_cps no puede superar max_cps":                                       "ramp_start_cps cannot exceed max_cps",
+	"end_at debe ser posterior a start_at":                                          "end_at must be after start_at",
+	"día de recurrencia inválido '%s' (0=Domingo..6=Sábado)":                        "invalid recurrence day '%s' (0=Sunday..6=Saturday)",
+	"recur_time inválido '%s' (formato HH:MM)":                                      "invalid recur_time '%s' (format HH:MM)",
+	"recur_mode inválido (reset, clone)":                                            "invalid recur_mode (reset, clone)",
+	"estado de recurrencia inválido '%s' (%s)":                                      "invalid recurrence state '%s' (%s)",
+	"recur_dispositions excede 100 caracteres":                                      "recur_dispositions exceeds 100 characters",
+	"recur_max no puede ser negativo":                                               "recur_max cannot be negative",
+	"retention_days no puede ser negativo":                                          "retention_days cannot be negative",
+	"summary_emails excede 500 caracteres":                                          "summary_emails exceeds 500 characters",
+	"survey_id inválido":                                                            "Invalid survey_id",
+	"troncales excede 500 caracteres":                                               "troncales exceeds 500 characters",
+	"valor debe ser un dígito DTMF (0-9, * o #)":                                    "valor must be a DTMF digit (0-9, * or #)",
+	"valor debe ser una disposición (ej: NI, NA, B)":                                "valor must be a disposition (e.g. NI, NA, B)",
+
+	// Formatos
+	"%s no puede superar 500 caracteres":                              "%s cannot exceed 500 characters",
+	"%s solo aplica a contactos en estado %s":                         "%s only applies to contacts in state %s",
+	"El audio del proyecto no existe: %s":                             "The project audio does not exist: %s",
+	"Máximo %d llamadas por lote":                                     "At most %d calls per batch",
+	"Número ya llamado en los últimos %d minutos":                     "Number already called in the last %d minutes",
+	"Teléfono inválido: %v":                                           "Invalid phone number: %v",
+	"prioridad debe estar entre 1 y %d":                               "prioridad must be between 1 and %d",
+	"ring_timeout debe estar entre 0 y %d segundos":                   "ring_timeout must be between 0 and %d seconds",
+	"ring_timeout no puede superar %d segundos":                       "ring_timeout cannot exceed %d seconds",
+	"consecutivos debe estar entre 1 y %d":                            "consecutivos must be between 1 and %d",
+	"max_cps debe estar entre 0 y %d":                                 "max_cps must be between 0 and %d",
+	"ramp_minutes debe estar entre 0 y %d":                            "ramp_minutes must be between 0 and %d",
+	"ramp_start_cps debe estar entre 0 y %d":                          "ramp_start_cps must be between 0 and %d",
+	"la encuesta %d pertenece a otro proyecto":                        "survey %d belongs to another project",
+	"pais no soportado: %s":                                           "Unsupported pais: %s",
+	"pregunta %d: intentos debe estar entre 0 y 5":                    "question %d: intentos must be between 0 and 5",
+	"pregunta %d: opciones solo admite dígitos, * y #":                "question %d: opciones only accepts digits, * and #",
+	"pregunta %d: texto y audio son requeridos":                       "question %d: texto and audio are required",
+	"pregunta %d: timeout debe estar entre 0 y 30 segundos":           "question %d: timeout must be between 0 and 30 seconds",
+	"tipo debe ser %s o %s":                                           "tipo must be %s or %s",
+	"dial_engine inválido: %s (spool, ami, ari, sim o vacío)":         "Invalid dial_engine: %s (spool, ami, ari, sim or empty)",
+	"transfer_mode inválido: %s (blind, queue, ringgroup)":            "Invalid transfer_mode: %s (blind, queue, ringgroup)",
+	"transfer_target requerido para transfer_mode %s":                 "transfer_target is required for transfer_mode %s",
+	"troncal no encontrada: %s":                                       "trunk not found: %s",
+	"trunk_strategy inválida: %s (random, weighted, least_used, asr)": "Invalid trunk_strategy: %s (random, weighted, least_used, asr)",
+	"sip_headers: %s":                                                 "sip_headers: %s",
+	"summary_emails: %s":                                              "summary_emails: %s",
+	"troncales: %s":                                                   "troncales: %s",
+
+	// Errores con el detalle de la base de datos
+	"Error actualizando campaña: %v":             "Error updating campaign: %v",
+	"Error actualizando canal: %v":               "Error updating channel: %v",
+	"Error actualizando estado: %v":              "Error updating state: %v",
+	"Error actualizando organización: %v":        "Error updating organization: %v",
+	"Error actualizando proyecto: %v":            "Error updating project: %v",
+	"Error actualizando troncal: %v":             "Error updating trunk: %v",
+	"Error agregando a blacklist: %v":            "Error adding to blacklist: %v",
+	"Error aplicando el secreto en Asterisk: %v": "Error applying the secret in Asterisk: %v",
+	"Error convirtiendo audio: %v":               "Error converting audio: %v",
+	"Error creando campaña: %v":                  "Error creating campaign: %v",
+	"Error creando canal: %v":                    "Error creating channel: %v",
+	"Error creando organización: %v":             "Error creating organization: %v",
+	"Error creando proyecto: %v":                 "Error creating project: %v",
+	"Error creando regla: %v":                    "Error creating rule: %v",
+	"Error creando troncal: %v":                  "Error creating trunk: %v",
+	"Error creando usuario: %v":                  "Error creating user: %v",
+	"Error eliminando campaña: %v":               "Error deleting campaign: %v",
+	"Error eliminando encuesta: %v":              "Error deleting survey: %v",
+	"Error eliminando proyecto: %v":              "Error deleting project: %v",
+	"Error eliminando troncal: %v":               "Error deleting trunk: %v",
+	"Error guardando encuesta: %v":               "Error saving survey: %v",
+	"Error guardando schedules: %v":              "Error saving schedules: %v",
+	"Error importando: %v":                       "Error importing: %v",
+	"Error originando llamada de prueba: %v":     "Error originating test call: %v",
+	"Error originando llamada: %v":               "Error originating call: %v",
+	"Error originando supervisión: %v":           "Error originating supervision: %v",
+	"Error quitando troncal: %v":                 "Error removing trunk: %v",
+	"Error recargando configuración: %v":         "Error reloading configuration: %v",
+	"Error reciclando contactos: %v":             "Error recycling contacts: %v",
+	"Error verificando campañas activas: %v":     "Error checking active campaigns: %v",
+}
@@ -0,0 +1,315 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/phone"
+)
+
+// Mapping define qué columnas del archivo se usan al importar contactos.
+// Las columnas se referencian por nombre de encabezado o por índice (base 0).
+type Mapping struct {
+	PhoneColumn    string   `json:"phone_column,omitempty"`    // Columna del teléfono (vacío = primera columna)
+	NameColumn     string   `json:"name_column,omitempty"`     // Columna del nombre (opcional, se guarda como "nombre")
+	Fields         []string `json:"fields,omitempty"`          // Columnas adicionales a guardar en datos_adicionales
+	WindowColumn   string   `json:"window_column,omitempty"`   // Franja preferida "HH:MM-HH:MM" (opcional)
+	TimezoneColumn string   `json:"timezone_column,omitempty"` // Zona IANA de la franja (opcional, vacío = la del proyecto)
+}
+
+// Record es un contacto listo para insertar
+type Record struct {
+	Row           int // Número de fila en el archivo (base 1)
+	Telefono      string
+	Datos         map[string]string // Datos adicionales (nombre + campos mapeados)
+	VentanaInicio string            // Franja preferida "HH:MM:SS" (vacío = sin franja)
+	VentanaFin    string
+	VentanaTZ     string
+}
+
+// RowError describe una fila rechazada durante la validación
+type RowError struct {
+	Row    int    `json:"row"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// ParseFile detecta el formato (XLSX o CSV) y devuelve las filas del archivo
+func ParseFile(filename string, data []byte) ([][]string, error) {
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".xlsx") || bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return ParseXLSX(data)
+	}
+	return ParseCSV(data)
+}
+
+// ParseCSV parsea CSV detectando el separador (; , o tabulador)
+func ParseCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM de Excel
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	delim := ','
+	best := bytes.Count(firstLine, []byte(","))
+	if n := bytes.Count(firstLine, []byte(";")); n > best {
+		delim, best = ';', n
+	}
+	if n := bytes.Count(firstLine, []byte("\t")); n > best {
+		delim = '\t'
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delim
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parseando CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// Preview devuelve los encabezados detectados y algunas filas de muestra
+// (usado por la UI para construir el mapeo de columnas)
+func Preview(rows [][]string, sample int) (headers []string, data [][]string) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	start := 0
+	if looksLikeHeader(rows[0]) {
+		headers = rows[0]
+		start = 1
+	} else {
+		for i := range rows[0] {
+			headers = append(headers, strconv.Itoa(i))
+		}
+	}
+	end := start + sample
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return headers, rows[start:end]
+}
+
+// looksLikeHeader detecta una fila de encabezados (mismo criterio que el upload CSV original)
+func looksLikeHeader(row []string) bool {
+	for _, cell := range row {
+		c := strings.ToLower(cell)
+		if strings.Contains(c, "telefono") || strings.Contains(c, "teléfono") || strings.Contains(c, "phone") ||
+			strings.Contains(c, "celular") || strings.Contains(c, "numero") || strings.Contains(c, "número") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveColumn busca una columna por índice o por nombre de encabezado (sin distinguir mayúsculas)
+func resolveColumn(ref string, headers []string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if idx, err := strconv.Atoi(ref); err == nil {
+		return idx, nil
+	}
+	for i, h := range headers {
+		if strings.EqualFold(strings.TrimSpace(h), ref) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("columna %q no encontrada", ref)
+}
+
+// usesNames indica si el mapeo referencia columnas por nombre (requiere encabezado)
+func (m Mapping) usesNames() bool {
+	refs := append([]string{m.PhoneColumn, m.NameColumn, m.WindowColumn, m.TimezoneColumn}, m.Fields...)
+	for _, ref := range refs {
+		if ref == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimSpace(ref)); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanPhone limpia separadores comunes y valida el número (importaciones de proyectos sin país)
+func CleanPhone(raw string) (string, bool) {
+	tel := phone.Clean(raw)
+	if len(tel) < 7 || len(tel) > 20 {
+		return tel, false
+	}
+	for i, ch := range tel {
+		if ch == '+' && i == 0 {
+			continue
+		}
+		if ch < '0' || ch > '9' {
+			return tel, false
+		}
+	}
+	return tel, true
+}
+
+// BuildRecords aplica el mapeo a las filas y normaliza los teléfonos según el país del proyecto
+func BuildRecords(rows [][]string, m Mapping, country string) ([]Record, []RowError, error) {
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+
+	var headers []string
+	start := 0
+	if m.usesNames() || looksLikeHeader(rows[0]) {
+		headers = rows[0]
+		start = 1
+	}
+
+	phoneCol := 0
+	if m.PhoneColumn != "" {
+		idx, err := resolveColumn(m.PhoneColumn, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		phoneCol = idx
+	}
+
+	nameCol := -1
+	if m.NameColumn != "" {
+		idx, err := resolveColumn(m.NameColumn, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		nameCol = idx
+	}
+
+	windowCol, zoneCol := -1, -1
+	if m.WindowColumn != "" {
+		idx, err := resolveColumn(m.WindowColumn, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		windowCol = idx
+	}
+	if m.TimezoneColumn != "" {
+		idx, err := resolveColumn(m.TimezoneColumn, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		zoneCol = idx
+	}
+
+	type field struct {
+		key string
+		col int
+	}
+	var fields []field
+	for _, ref := range m.Fields {
+		if strings.TrimSpace(ref) == "" {
+			continue
+		}
+		idx, err := resolveColumn(ref, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := strings.TrimSpace(ref)
+		if idx < len(headers) && strings.TrimSpace(headers[idx]) != "" {
+			key = strings.TrimSpace(headers[idx])
+		}
+		fields = append(fields, field{key: key, col: idx})
+	}
+
+	cell := func(row []string, col int) string {
+		if col < 0 || col >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[col])
+	}
+
+	records := make([]Record, 0, len(rows)-start)
+	var rowErrors []RowError
+	for i := start; i < len(rows); i++ {
+		row := rows[i]
+		raw := cell(row, phoneCol)
+		if raw == "" {
+			continue // Filas vacías
+		}
+
+		var tel string
+		var err error
+		if country == "" {
+			var ok bool
+			if tel, ok = CleanPhone(raw); !ok {
+				rowErrors = append(rowErrors, RowError{Row: i + 1, Value: raw, Reason: "teléfono inválido"})
+				continue
+			}
+		} else {
+			if tel, err = phone.Normalize(raw, country); err != nil {
+				rowErrors = append(rowErrors, RowError{Row: i + 1, Value: raw, Reason: err.Error()})
+				continue
+			}
+		}
+
+		rec := Record{Row: i + 1, Telefono: tel}
+		if v := cell(row, windowCol); v != "" {
+			if rec.VentanaInicio, rec.VentanaFin, err = ParseWindow(v); err != nil {
+				rowErrors = append(rowErrors, RowError{Row: i + 1, Value: v, Reason: err.Error()})
+				continue
+			}
+			if z := cell(row, zoneCol); z != "" {
+				if _, err := time.LoadLocation(z); err != nil {
+					rowErrors = append(rowErrors, RowError{Row: i + 1, Value: z, Reason: "zona horaria inválida"})
+					continue
+				}
+				rec.VentanaTZ = z
+			}
+		}
+		if nameCol >= 0 || len(fields) > 0 {
+			rec.Datos = make(map[string]string)
+			if v := cell(row, nameCol); v != "" {
+				rec.Datos["nombre"] = v
+			}
+			for _, f := range fields {
+				if v := cell(row, f.col); v != "" {
+					rec.Datos[f.key] = v
+				}
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, rowErrors, nil
+}
+
+// ParseWindow interpreta una franja "HH:MM-HH:MM" (con segundos opcionales) y devuelve inicio y fin
+// "HH:MM:SS". Un fin menor que el inicio es una franja que cruza la medianoche (ej: 20:00-02:00).
+func ParseWindow(s string) (inicio, fin string, err error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return "", "", fmt.Errorf("franja inválida %q (formato HH:MM-HH:MM)", s)
+	}
+	if inicio, err = parseClock(from); err == nil {
+		fin, err = parseClock(to)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("franja inválida %q (formato HH:MM-HH:MM)", s)
+	}
+	if inicio == fin {
+		return "", "", fmt.Errorf("franja inválida %q: inicio y fin iguales", s)
+	}
+	return inicio, fin, nil
+}
+
+func parseClock(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("hora inválida: %s", s)
+}
@@ -0,0 +1,494 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sourceTimeout limita cada consulta HTTP al origen de contactos
+	sourceTimeout = 60 * time.Second
+	// maxSourcePageBytes es el tamaño máximo de una página de respuesta
+	maxSourcePageBytes = 50 << 20
+	// maxSourceRecords limita los registros traídos en una consulta (todas las páginas)
+	maxSourceRecords = 500000
+	// defaultSourcePages es el máximo de páginas cuando max_pages = 0
+	defaultSourcePages = 100
+	// minSourceInterval es el intervalo mínimo de consulta periódica
+	minSourceInterval = 5
+)
+
+// Paginación del origen de contactos
+const (
+	PaginationNone = "none" // Una sola consulta
+	PaginationPage = "page" // Parámetro de número de página hasta una página vacía
+	PaginationNext = "next" // URL siguiente en el cuerpo JSON (next_path) o en el header Link
+)
+
+var sourceClient = &http.Client{Timeout: sourceTimeout}
+
+// ValidateSource normaliza y valida la configuración del origen de contactos de una campaña
+func ValidateSource(s *database.ContactSource) error {
+	s.URL = strings.TrimSpace(s.URL)
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url debe ser una URL http o https")
+	}
+	if len(s.URL) > 1000 {
+		return fmt.Errorf("url excede 1000 caracteres")
+	}
+
+	s.Formato = strings.ToLower(strings.TrimSpace(s.Formato))
+	switch s.Formato {
+	case "":
+		s.Formato = "json"
+	case "json", "csv":
+	default:
+		return fmt.Errorf("formato debe ser json o csv")
+	}
+	if len(s.Headers) > 20 {
+		return fmt.Errorf("máximo 20 headers")
+	}
+	for k, v := range s.Headers {
+		if k == "" || strings.ContainsAny(k, "\r\n: ") || strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("header inválido '%s'", k)
+		}
+	}
+
+	s.PhoneColumn = strings.TrimSpace(s.PhoneColumn)
+	s.NameColumn = strings.TrimSpace(s.NameColumn)
+	s.Fields = strings.Join(splitFields(s.Fields), ",")
+	if s.Formato == "json" {
+		if s.PhoneColumn == "" {
+			return fmt.Errorf("phone_column requerido para formato json (ej: telefono o contacto.celular)")
+		}
+	} else if s.RecordsPath != "" || s.NextPath != "" {
+		return fmt.Errorf("records_path y next_path solo aplican al formato json")
+	}
+	if len(s.RecordsPath) > 100 || len(s.NextPath) > 100 || len(s.PhoneColumn) > 100 || len(s.NameColumn) > 100 || len(s.Fields) > 500 {
+		return fmt.Errorf("rutas y columnas exceden el largo máximo")
+	}
+
+	s.Paginacion = strings.ToLower(strings.TrimSpace(s.Paginacion))
+	switch s.Paginacion {
+	case "":
+		s.Paginacion = PaginationNone
+	case PaginationNone, PaginationNext:
+	case PaginationPage:
+		if s.PageParam == "" {
+			s.PageParam = "page"
+		}
+	default:
+		return fmt.Errorf("paginacion debe ser none, page o next")
+	}
+	if s.PageSize < 0 || s.MaxPages < 0 || s.MaxPages > 1000 {
+		return fmt.Errorf("page_size debe ser >= 0 y max_pages entre 0 y 1000")
+	}
+	if s.IntervalMinutes < 0 || (s.IntervalMinutes > 0 && s.IntervalMinutes < minSourceInterval) || s.IntervalMinutes > 10080 {
+		return fmt.Errorf("interval_minutes debe ser 0 (solo manual) o entre %d y 10080", minSourceInterval)
+	}
+	if s.SuppressDays < 0 {
+		return fmt.Errorf("suppress_days debe ser >= 0")
+	}
+	return nil
+}
+
+func splitFields(raw string) []string {
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// PullSource trae los contactos del origen y encola un import con ellos (mismo pipeline que el
+// upload: dedup, blacklist y supresiones). Devuelve nil si el origen no devolvió registros.
+// La consulta queda registrada en el origen (last_run_at, last_import_id, last_error).
+func PullSource(repo *database.Repository, src *database.ContactSource) (*database.ImportJob, error) {
+	job, err := pullSource(repo, src)
+
+	var importID *int64
+	lastError := ""
+	if job != nil {
+		importID = &job.ID
+	}
+	if err != nil {
+		lastError = err.Error()
+	}
+	if rerr := repo.SetContactSourceRun(src.CampaignID, time.Now(), importID, lastError); rerr != nil && err == nil {
+		err = rerr
+	}
+	return job, err
+}
+
+func pullSource(repo *database.Repository, src *database.ContactSource) (*database.ImportJob, error) {
+	rows, err := fetchSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) <= 1 && (src.Formato == "json" || looksLikeHeader(firstRow(rows))) {
+		return nil, nil // Solo encabezado: nada que importar
+	}
+
+	path, err := writeSourceCSV(rows)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := json.Marshal(Mapping{
+		PhoneColumn: src.PhoneColumn,
+		NameColumn:  src.NameColumn,
+		Fields:      splitFields(src.Fields),
+	})
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("error serializando mapeo: %w", err)
+	}
+	m := string(mapping)
+
+	host := src.URL
+	if u, err := url.Parse(src.URL); err == nil {
+		host = u.Host
+	}
+	job := &database.ImportJob{
+		CampaignID:     src.CampaignID,
+		Filename:       "source-" + host + ".csv",
+		FilePath:       path,
+		Mapping:        &m,
+		SuppressActive: src.SuppressActive,
+		SuppressDays:   src.SuppressDays,
+	}
+	if err := repo.CreateImportJob(job); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return job, nil
+}
+
+func firstRow(rows [][]string) []string {
+	if len(rows) == 0 {
+		return nil
+	}
+	return rows[0]
+}
+
+// writeSourceCSV guarda las filas traídas en UploadDir para que las procese el Worker
+func writeSourceCSV(rows [][]string) (string, error) {
+	if err := os.MkdirAll(UploadDir, 0755); err != nil {
+		return "", fmt.Errorf("error creando directorio de imports: %w", err)
+	}
+	dest := filepath.Join(UploadDir, uuid.New().String()+".csv")
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("error guardando contactos del origen: %w", err)
+	}
+	cw := csv.NewWriter(f)
+	cw.WriteAll(rows)
+	if err := cw.Error(); err != nil {
+		f.Close()
+		os.Remove(dest)
+		return "", fmt.Errorf("error guardando contactos del origen: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(dest)
+		return "", fmt.Errorf("error guardando contactos del origen: %w", err)
+	}
+	return dest, nil
+}
+
+// fetchSource recorre las páginas del origen y devuelve las filas (con encabezado para JSON)
+func fetchSource(src *database.ContactSource) ([][]string, error) {
+	maxPages := src.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultSourcePages
+	}
+	page := 1
+	target := src.URL
+	if src.Paginacion == PaginationPage {
+		target = pageURL(src, page)
+	}
+
+	var csvRows [][]string
+	var records []map[string]string
+	for n := 0; n < maxPages; n++ {
+		body, header, err := getSourcePage(target, src.Headers)
+		if err != nil {
+			return nil, err
+		}
+
+		var count int
+		var next string
+		if src.Formato == "csv" {
+			rows, err := ParseCSV(body)
+			if err != nil {
+				return nil, err
+			}
+			// Las páginas siguientes repiten el encabezado de la primera
+			if len(csvRows) > 0 && len(rows) > 0 && equalRows(rows[0], csvRows[0]) {
+				rows = rows[1:]
+			}
+			count = len(rows)
+			csvRows = append(csvRows, rows...)
+		} else {
+			recs, nextURL, err := parseJSONPage(body, src.RecordsPath, src.NextPath)
+			if err != nil {
+				return nil, fmt.Errorf("página %d: %w", n+1, err)
+			}
+			count = len(recs)
+			next = nextURL
+			records = append(records, recs...)
+		}
+		if len(csvRows)+len(records) > maxSourceRecords {
+			return nil, fmt.Errorf("el origen excede %d registros", maxSourceRecords)
+		}
+
+		switch src.Paginacion {
+		case PaginationPage:
+			if count == 0 || (src.PageSize > 0 && count < src.PageSize) {
+				return sourceRows(src, csvRows, records), nil
+			}
+			page++
+			target = pageURL(src, page)
+		case PaginationNext:
+			if next == "" {
+				next = linkNext(header.Get("Link"))
+			}
+			if next == "" || count == 0 {
+				return sourceRows(src, csvRows, records), nil
+			}
+			if target, err = resolveURL(target, next); err != nil {
+				return nil, err
+			}
+		default:
+			return sourceRows(src, csvRows, records), nil
+		}
+	}
+	return sourceRows(src, csvRows, records), nil
+}
+
+func sourceRows(src *database.ContactSource, csvRows [][]string, records []map[string]string) [][]string {
+	if src.Formato == "csv" {
+		return csvRows
+	}
+	return recordsToRows(records)
+}
+
+func getSourcePage(target string, headers map[string]string) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("url inválida: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, text/csv;q=0.9, */*;q=0.5")
+	req.Header.Set("User-Agent", "apicall-contact-source")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		// El error de url incluye la URL completa (puede llevar tokens): solo se conserva la causa
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, nil, fmt.Errorf("error consultando el origen: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSourcePageBytes+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error leyendo respuesta del origen: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(body) > 200 {
+			body = body[:200]
+		}
+		return nil, nil, fmt.Errorf("el origen respondió %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	if len(body) > maxSourcePageBytes {
+		return nil, nil, fmt.Errorf("la respuesta del origen excede %d MB", maxSourcePageBytes>>20)
+	}
+	return body, resp.Header, nil
+}
+
+// pageURL agrega los parámetros de página (y tamaño) a la URL del origen
+func pageURL(src *database.ContactSource, page int) string {
+	u, err := url.Parse(src.URL)
+	if err != nil {
+		return src.URL
+	}
+	q := u.Query()
+	q.Set(src.PageParam, strconv.Itoa(page))
+	if src.PageSizeParam != "" && src.PageSize > 0 {
+		q.Set(src.PageSizeParam, strconv.Itoa(src.PageSize))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// resolveURL resuelve la URL siguiente (puede ser relativa) contra la página actual
+func resolveURL(current, next string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("url siguiente inválida: %w", err)
+	}
+	u := base.ResolveReference(ref)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("url siguiente inválida: %s", next)
+	}
+	return u.String(), nil
+}
+
+// linkNext extrae la URL rel="next" de un header Link (RFC 8288)
+func linkNext(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segs := strings.Split(part, ";")
+		if len(segs) < 2 {
+			continue
+		}
+		for _, p := range segs[1:] {
+			p = strings.ReplaceAll(strings.TrimSpace(p), " ", "")
+			if strings.EqualFold(p, `rel="next"`) || strings.EqualFold(p, "rel=next") {
+				return strings.Trim(strings.TrimSpace(segs[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+func equalRows(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseJSONPage devuelve los registros aplanados de una página JSON y la URL siguiente (next_path)
+func parseJSONPage(body []byte, recordsPath, nextPath string) ([]map[string]string, string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // Los teléfonos numéricos no pasan por float64
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("JSON inválido: %w", err)
+	}
+
+	next := ""
+	if nextPath != "" {
+		if v, ok := lookupPath(doc, nextPath).(string); ok {
+			next = v
+		}
+	}
+
+	node := doc
+	if recordsPath != "" {
+		node = lookupPath(doc, recordsPath)
+	}
+	if node == nil {
+		return nil, next, nil // Sin registros (ej: última página con data: null)
+	}
+	items, ok := node.([]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("records_path '%s' no es un arreglo", recordsPath)
+	}
+
+	records := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("los registros deben ser objetos JSON")
+		}
+		rec := make(map[string]string)
+		flatten("", obj, rec)
+		records = append(records, rec)
+	}
+	return records, next, nil
+}
+
+// lookupPath recorre una ruta con puntos (ej: data.items) dentro de un documento JSON
+func lookupPath(doc interface{}, path string) interface{} {
+	node := doc
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = obj[key]
+	}
+	return node
+}
+
+// flatten aplana objetos anidados con claves con puntos (contacto.celular); los arreglos
+// se guardan como JSON
+func flatten(prefix string, obj map[string]interface{}, out map[string]string) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case nil:
+			out[key] = ""
+		case string:
+			out[key] = val
+		case json.Number:
+			out[key] = val.String()
+		case bool:
+			out[key] = strconv.FormatBool(val)
+		case map[string]interface{}:
+			flatten(key, val, out)
+		default:
+			data, _ := json.Marshal(val)
+			out[key] = string(data)
+		}
+	}
+}
+
+// recordsToRows convierte los registros en filas con encabezado (unión ordenada de las claves)
+func recordsToRows(records []map[string]string) [][]string {
+	seen := make(map[string]bool)
+	var headers []string
+	for _, rec := range records {
+		for k := range rec {
+			if !seen[k] {
+				seen[k] = true
+				headers = append(headers, k)
+			}
+		}
+	}
+	sort.Strings(headers)
+
+	rows := make([][]string, 0, len(records)+1)
+	rows = append(rows, headers)
+	for _, rec := range records {
+		row := make([]string, len(headers))
+		for i, h := range headers {
+			row[i] = rec[h]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+// SchedulerInterval es cada cuánto se buscan orígenes de contactos con consulta vencida
+const SchedulerInterval = time.Minute
+
+// SourceScheduler consulta periódicamente los orígenes HTTP de contactos (interval_minutes > 0)
+// y encola un import por cada consulta. Solo corre en el líder.
+type SourceScheduler struct {
+	repo     *database.Repository
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewSourceScheduler crea el programador de orígenes de contactos
+func NewSourceScheduler(repo *database.Repository) *SourceScheduler {
+	return &SourceScheduler{
+		repo:     repo,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el programador
+func (s *SourceScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+	s.wg.Add(1)
+	go s.run()
+	log.Println("[Importer] Programador de orígenes de contactos iniciado")
+}
+
+// Stop detiene el programador (la consulta en curso termina)
+func (s *SourceScheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	s.mu.Unlock()
+
+	close(s.stopChan)
+	s.wg.Wait()
+	log.Println("[Importer] Programador de orígenes de contactos detenido")
+}
+
+func (s *SourceScheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.dispatch()
+		}
+	}
+}
+
+func (s *SourceScheduler) dispatch() {
+	if !leader.IsLeader() {
+		return
+	}
+	sources, err := s.repo.GetDueContactSources()
+	if err != nil {
+		log.Printf("[Importer] %v", err)
+		return
+	}
+
+	for i := range sources {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		src := &sources[i]
+		// No se encola otra consulta mientras el import anterior siga en la cola
+		if src.LastImportID != nil {
+			if job, err := s.repo.GetImportJob(*src.LastImportID); err == nil && (job.Estado == "pending" || job.Estado == "running") {
+				continue
+			}
+		}
+
+		job, err := PullSource(s.repo, src)
+		switch {
+		case err != nil:
+			log.Printf("[Importer] ERROR origen de contactos de campaña %d: %v", src.CampaignID, err)
+		case job == nil:
+			log.Printf("[Importer] Origen de contactos de campaña %d sin registros", src.CampaignID)
+		default:
+			log.Printf("[Importer] Origen de contactos de campaña %d: import %d encolado", src.CampaignID, job.ID)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/leader"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// UploadDir es donde se guardan los archivos subidos hasta ser procesados
+	UploadDir = "/var/lib/apicall/imports"
+	// WorkerInterval es cada cuánto el worker busca imports pendientes
+	WorkerInterval = 2 * time.Second
+
+	// chunkSize es la cantidad de registros procesados por bloque (dedup + blacklist + insert)
+	chunkSize = 1000
+	// maxReportedErrors limita los errores de validación guardados por job
+	maxReportedErrors = 100
+)
+
+// StoreUpload guarda el archivo subido en UploadDir y devuelve su ruta
+func StoreUpload(filename string, src io.Reader) (string, error) {
+	if err := os.MkdirAll(UploadDir, 0755); err != nil {
+		return "", fmt.Errorf("error creando directorio de imports: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != ".xlsx" {
+		ext = ".csv"
+	}
+	dest := filepath.Join(UploadDir, uuid.New().String()+ext)
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("error guardando archivo: %w", err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return "", fmt.Errorf("error guardando archivo: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return "", fmt.Errorf("error guardando archivo: %w", err)
+	}
+	return dest, nil
+}
+
+// Worker procesa los jobs de importación pendientes en segundo plano
+type Worker struct {
+	repo     *database.Repository
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewWorker crea un nuevo worker de importación
+func NewWorker(repo *database.Repository) *Worker {
+	return &Worker{
+		repo:     repo,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el worker
+func (w *Worker) Start() {
+	w.mu.Lock()
+	if w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = true
+	w.wg.Add(1)
+	w.mu.Unlock()
+
+	// Jobs interrumpidos por un reinicio vuelven a la cola (solo la líder: en las demás
+	// instancias un job en running puede estar procesándose en la líder)
+	if leader.IsLeader() {
+		w.resetInterrupted()
+	}
+
+	go w.run()
+	log.Println("[Importer] Worker de importación iniciado")
+}
+
+// Stop detiene el worker (el job en curso termina su bloque actual)
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = false
+	w.mu.Unlock()
+
+	close(w.stopChan)
+	w.wg.Wait()
+	log.Println("[Importer] Worker de importación detenido")
+}
+
+// resetInterrupted devuelve a pending los jobs que quedaron en running
+func (w *Worker) resetInterrupted() {
+	if n, err := w.repo.ResetRunningImportJobs(); err != nil {
+		log.Printf("[Importer] Error reseteando jobs interrumpidos: %v", err)
+	} else if n > 0 {
+		log.Printf("[Importer] %d jobs interrumpidos devueltos a pending", n)
+	}
+}
+
+func (w *Worker) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(WorkerInterval)
+	defer ticker.Stop()
+
+	wasLeader := leader.IsLeader()
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+			// Solo la instancia líder procesa imports; al asumir retoma los que dejó la anterior
+			isLeader := leader.IsLeader()
+			if isLeader && !wasLeader {
+				w.resetInterrupted()
+			}
+			wasLeader = isLeader
+
+			// Procesar todos los pendientes antes de volver a esperar
+			for isLeader && leader.IsLeader() {
+				job, err := w.repo.ClaimNextImportJob()
+				if err != nil {
+					log.Printf("[Importer] Error obteniendo jobs: %v", err)
+					break
+				}
+				if job == nil {
+					break
+				}
+				w.process(job)
+
+				select {
+				case <-w.stopChan:
+					return
+				default:
+				}
+			}
+		}
+	}
+}
+
+// process ejecuta un job: parseo, mapeo y luego bloques de dedup + blacklist + insert
+func (w *Worker) process(job *database.ImportJob) {
+	log.Printf("[Importer] Procesando import %d (campaña %d, archivo %s)", job.ID, job.CampaignID, job.Filename)
+
+	campaign, err := w.repo.GetCampaign(job.CampaignID)
+	if err != nil {
+		w.fail(job, err)
+		return
+	}
+	proyecto, err := w.repo.GetProyecto(campaign.ProyectoID)
+	if err != nil {
+		w.fail(job, err)
+		return
+	}
+
+	data, err := os.ReadFile(job.FilePath)
+	if err != nil {
+		w.fail(job, fmt.Errorf("error leyendo archivo: %w", err))
+		return
+	}
+
+	var mapping Mapping
+	if job.Mapping != nil && *job.Mapping != "" {
+		if err := json.Unmarshal([]byte(*job.Mapping), &mapping); err != nil {
+			w.fail(job, fmt.Errorf("mapeo inválido: %w", err))
+			return
+		}
+	}
+
+	rows, err := ParseFile(job.Filename, data)
+	if err != nil {
+		w.fail(job, err)
+		return
+	}
+	records, rowErrors, err := BuildRecords(rows, mapping, proyecto.Pais)
+	if err != nil {
+		w.fail(job, err)
+		return
+	}
+	if len(rowErrors) > 0 {
+		if err := writeErrorReport(job.ID, rowErrors); err != nil {
+			log.Printf("[Importer] Error guardando reporte de errores del import %d: %v", job.ID, err)
+		}
+	}
+
+	job.TotalRows = len(records) + len(rowErrors)
+	job.ProcessedRows = len(rowErrors)
+	job.Invalid = len(rowErrors)
+	job.Errors = encodeErrors(rowErrors)
+	w.repo.UpdateImportJobProgress(job)
+
+	seen := make(map[string]bool, len(records))
+	var suppressed []Suppression
+	for start := 0; start < len(records); start += chunkSize {
+		end := start + chunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+		chunk := records[start:end]
+
+		skipped, err := w.importChunk(job, campaign.ProyectoID, chunk, seen)
+		if err != nil {
+			w.fail(job, err)
+			return
+		}
+		suppressed = append(suppressed, skipped...)
+
+		job.ProcessedRows += len(chunk)
+		if err := w.repo.UpdateImportJobProgress(job); err != nil {
+			log.Printf("[Importer] Error guardando progreso del import %d: %v", job.ID, err)
+		}
+	}
+	if len(suppressed) > 0 {
+		if err := writeSuppressionReport(job.ID, suppressed); err != nil {
+			log.Printf("[Importer] Error guardando reporte de supresión del import %d: %v", job.ID, err)
+		}
+	}
+
+	if err := w.repo.RefreshCampaignTotal(job.CampaignID); err != nil {
+		log.Printf("[Importer] Error actualizando total de campaña %d: %v", job.CampaignID, err)
+	}
+	if err := w.repo.FinishImportJob(job.ID, "completed", nil); err != nil {
+		log.Printf("[Importer] Error finalizando import %d: %v", job.ID, err)
+	}
+	os.Remove(job.FilePath)
+
+	log.Printf("[Importer] Import %d completado: campaña=%d insertados=%d duplicados=%d blacklist=%d inválidos=%d suprimidos=%d",
+		job.ID, job.CampaignID, job.Inserted, job.Duplicates, job.Blacklisted, job.Invalid, len(suppressed))
+}
+
+// importChunk deduplica (archivo + campaña), filtra blacklist y supresiones e inserta un bloque.
+// Acumula los contadores en job y devuelve los números suprimidos con su motivo.
+func (w *Worker) importChunk(job *database.ImportJob, proyectoID int, chunk []Record, seen map[string]bool) ([]Suppression, error) {
+	telefonos := make([]string, 0, len(chunk))
+	for _, rec := range chunk {
+		telefonos = append(telefonos, rec.Telefono)
+	}
+
+	existing, err := w.repo.GetExistingCampaignTelefonos(job.CampaignID, telefonos)
+	if err != nil {
+		return nil, err
+	}
+	blacklisted, err := w.repo.GetBlacklistedSet(proyectoID, telefonos)
+	if err != nil {
+		return nil, err
+	}
+	inActive := map[string]bool{}
+	if job.SuppressActive {
+		if inActive, err = w.repo.GetActiveCampaignTelefonos(proyectoID, job.CampaignID, telefonos); err != nil {
+			return nil, err
+		}
+	}
+	recent := map[string]bool{}
+	if job.SuppressDays > 0 {
+		since := time.Now().AddDate(0, 0, -job.SuppressDays)
+		if recent, err = w.repo.GetRecentlyCalledSet(proyectoID, since, telefonos); err != nil {
+			return nil, err
+		}
+	}
+
+	var suppressed []Suppression
+	contacts := make([]database.CampaignContact, 0, len(chunk))
+	for _, rec := range chunk {
+		if seen[rec.Telefono] || existing[rec.Telefono] {
+			job.Duplicates++
+			continue
+		}
+		seen[rec.Telefono] = true
+		if blacklisted[rec.Telefono] {
+			job.Blacklisted++
+			continue
+		}
+		if inActive[rec.Telefono] {
+			job.SuppressedActive++
+			suppressed = append(suppressed, Suppression{Telefono: rec.Telefono, Reason: SuppressedActiveCampaign})
+			continue
+		}
+		if recent[rec.Telefono] {
+			job.SuppressedRecent++
+			suppressed = append(suppressed, Suppression{Telefono: rec.Telefono, Reason: SuppressedRecentCall})
+			continue
+		}
+
+		c := database.CampaignContact{CampaignID: job.CampaignID, Telefono: rec.Telefono}
+		if len(rec.Datos) > 0 {
+			if data, err := json.Marshal(rec.Datos); err == nil {
+				datos := string(data)
+				c.DatosAdicionales = &datos
+			}
+		}
+		if rec.VentanaInicio != "" {
+			c.VentanaInicio, c.VentanaFin = &rec.VentanaInicio, &rec.VentanaFin
+			if rec.VentanaTZ != "" {
+				c.VentanaTZ = &rec.VentanaTZ
+			}
+		}
+		contacts = append(contacts, c)
+	}
+
+	inserted, err := w.repo.InsertCampaignContacts(job.CampaignID, contacts)
+	job.Inserted += inserted
+	return suppressed, err
+}
+
+func (w *Worker) fail(job *database.ImportJob, err error) {
+	msg := err.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	w.repo.UpdateImportJobProgress(job)
+	if err := w.repo.FinishImportJob(job.ID, "failed", &msg); err != nil {
+		log.Printf("[Importer] Error finalizando import %d: %v", job.ID, err)
+	}
+	os.Remove(job.FilePath)
+	log.Printf("[Importer] ERROR import %d (campaña %d): %s", job.ID, job.CampaignID, msg)
+}
+
+// ErrorReportPath devuelve la ruta del reporte CSV completo de errores de un import
+func ErrorReportPath(jobID int64) string {
+	return filepath.Join(UploadDir, "errors", fmt.Sprintf("import_%d.csv", jobID))
+}
+
+// writeErrorReport guarda todas las filas rechazadas (no solo las primeras 100) en CSV
+func writeErrorReport(jobID int64, errs []RowError) error {
+	path := ErrorReportPath(jobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"fila", "valor", "error"})
+	for _, e := range errs {
+		cw.Write([]string{strconv.Itoa(e.Row), e.Value, e.Reason})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Motivos de supresión del reporte
+const (
+	SuppressedActiveCampaign = "active_campaign" // Ya está en otra campaña activa del proyecto
+	SuppressedRecentCall     = "recent_call"     // El proyecto lo llamó en los últimos suppress_days días
+)
+
+// Suppression es un número omitido por las opciones de supresión del import
+type Suppression struct {
+	Telefono string
+	Reason   string
+}
+
+// SuppressionReportPath devuelve la ruta del reporte CSV de números suprimidos de un import
+func SuppressionReportPath(jobID int64) string {
+	return filepath.Join(UploadDir, "suppressed", fmt.Sprintf("import_%d.csv", jobID))
+}
+
+func writeSuppressionReport(jobID int64, list []Suppression) error {
+	path := SuppressionReportPath(jobID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"telefono", "motivo"})
+	for _, s := range list {
+		cw.Write([]string{s.Telefono, s.Reason})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func encodeErrors(errs []RowError) *string {
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) > maxReportedErrors {
+		errs = errs[:maxReportedErrors]
+	}
+	data, err := json.Marshal(errs)
+	if err != nil {
+		return nil
+	}
+	s := string(data)
+	return &s
+}
@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxXLSXColumns es el límite de columnas de Excel (A..XFD)
+const maxXLSXColumns = 16384
+
+// Estructuras mínimas del formato SpreadsheetML (solo lo necesario para leer valores)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxSST struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ParseXLSX lee la primera hoja de un archivo .xlsx y devuelve sus filas como texto
+func ParseXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("archivo XLSX inválido: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst xlsxSST
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, fmt.Errorf("error leyendo sharedStrings: %w", err)
+		}
+		shared = make([]string, len(sst.Items))
+		for i, si := range sst.Items {
+			shared[i] = si.String()
+		}
+	}
+
+	sheetPath := firstSheetPath(files)
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("hoja no encontrada en XLSX (%s)", sheetPath)
+	}
+
+	var sheet xlsxSheet
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, fmt.Errorf("error leyendo hoja: %w", err)
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var values []string
+		for i, c := range row.Cells {
+			col := columnIndex(c.Ref)
+			if col < 0 {
+				col = i
+			}
+			if col >= maxXLSXColumns {
+				return nil, fmt.Errorf("archivo XLSX inválido: columna fuera de rango (%s)", c.Ref)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(strings.TrimSpace(c.Value))
+				if err == nil && idx >= 0 && idx < len(shared) {
+					values[col] = shared[idx]
+				}
+			case "inlineStr":
+				values[col] = c.Inline.String()
+			case "str", "b", "e":
+				values[col] = c.Value
+			default:
+				values[col] = normalizeNumber(c.Value)
+			}
+		}
+		rows = append(rows, values)
+	}
+
+	return rows, nil
+}
+
+// firstSheetPath resuelve la ruta de la primera hoja vía workbook.xml y sus relaciones
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wbFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return fallback
+	}
+	var wb xlsxWorkbook
+	if err := decodeZipXML(wbFile, &wb); err != nil || len(wb.Sheets) == 0 {
+		return fallback
+	}
+
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback
+	}
+	var rels xlsxRels
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return fallback
+	}
+
+	for _, rel := range rels.Items {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, 512<<20)).Decode(v)
+}
+
+// columnIndex convierte una referencia de celda ("C12") en índice de columna base 0
+func columnIndex(ref string) int {
+	idx := 0
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		idx = idx*26 + int(ch-'A'+1)
+		n++
+		if idx > maxXLSXColumns {
+			// Fuera de rango: cortar antes de desbordar
+			return maxXLSXColumns
+		}
+	}
+	if n == 0 {
+		return -1
+	}
+	return idx - 1
+}
+
+// normalizeNumber evita notación científica en números largos (teléfonos guardados como número)
+func normalizeNumber(v string) string {
+	if !strings.ContainsAny(v, "eE") {
+		return v
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,171 @@
+// Package leader elige una instancia líder entre las que comparten la BD, con un lease que
+// la líder renueva periódicamente. Los workers que no deben correr en paralelo (sweeper,
+// limpiezas, carga de la cola del spooler) consultan IsLeader en cada pasada.
+package leader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+)
+
+// LeaseName es el lease que se disputan las instancias
+const LeaseName = "workers"
+
+// LeaseStore persiste el lease (implementado por database.Repository)
+type LeaseStore interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+}
+
+var (
+	holder = newHolder("")
+
+	mu      sync.Mutex
+	enabled bool      // Sin elección (ha.enabled=false) la instancia es siempre líder
+	until   time.Time // Hasta cuándo el lease es válido según el reloj local
+)
+
+// IsLeader indica si esta instancia debe correr los workers exclusivos
+func IsLeader() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return !enabled || time.Now().Before(until)
+}
+
+// ID identifica a este proceso: el instance_id (o hostname) más un sufijo aleatorio,
+// para que un reinicio no herede lo que cargó el proceso anterior
+func ID() string {
+	return holder
+}
+
+func newHolder(name string) string {
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	if name == "" {
+		name = "apicall"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", name, hex.EncodeToString(suffix))
+}
+
+// Elector mantiene el lease mientras la instancia corre
+type Elector struct {
+	store    LeaseStore
+	ttl      time.Duration
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewElector crea el elector; el instance_id de la config reemplaza al hostname en el ID
+func NewElector(store LeaseStore, cfg config.HAConfig) *Elector {
+	if cfg.InstanceID != "" {
+		holder = newHolder(cfg.InstanceID)
+	}
+	return &Elector{
+		store:    store,
+		ttl:      cfg.LeaseTTL(),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start activa la elección y hace el primer intento antes de volver, para que los
+// workers arranquen ya sabiendo si esta instancia es la líder
+func (e *Elector) Start() {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = true
+	e.wg.Add(1)
+	e.mu.Unlock()
+
+	mu.Lock()
+	enabled = true
+	mu.Unlock()
+
+	log.Printf("[Leader] Elección de líder iniciada (instancia %s, lease %v)", holder, e.ttl)
+	e.renew()
+	go e.run()
+}
+
+// Stop deja de renovar y libera el lease para que otra instancia lo tome sin esperar el vencimiento
+func (e *Elector) Stop() {
+	e.mu.Lock()
+	if !e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = false
+	e.mu.Unlock()
+
+	close(e.stopChan)
+	e.wg.Wait()
+
+	wasLeader := IsLeader()
+	mu.Lock()
+	until = time.Time{}
+	mu.Unlock()
+	if wasLeader {
+		if err := e.store.ReleaseLease(LeaseName, holder); err != nil {
+			log.Printf("[Leader] %v", err)
+		}
+	}
+	log.Println("[Leader] Elección de líder detenida")
+}
+
+func (e *Elector) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopChan:
+			return
+		case <-ticker.C:
+			e.renew()
+		}
+	}
+}
+
+// renew toma o renueva el lease. El plazo local se cuenta desde antes de la consulta,
+// así siempre vence antes que el de la BD y dos instancias nunca se creen líderes a la vez.
+func (e *Elector) renew() {
+	start := time.Now()
+	wasLeader := IsLeader()
+
+	ok, err := e.store.AcquireLease(LeaseName, holder, e.ttl)
+	if err != nil {
+		log.Printf("[Leader] %v", err)
+	}
+
+	mu.Lock()
+	if ok {
+		until = start.Add(e.ttl)
+	} else if err == nil {
+		until = time.Time{}
+	}
+	// Con error de BD se conserva el plazo anterior: si no se recupera a tiempo el lease vence solo
+	isLeader := time.Now().Before(until)
+	mu.Unlock()
+
+	switch {
+	case isLeader && !wasLeader:
+		log.Printf("[Leader] ✓ Instancia %s es la líder: corre sweeper, spooler y limpiezas", holder)
+	case !isLeader && wasLeader:
+		log.Printf("[Leader] Instancia %s dejó de ser líder: workers exclusivos en pausa", holder)
+	}
+}
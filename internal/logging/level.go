@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Niveles soportados (de más a menos verboso)
+const (
+	LevelDebug int32 = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var (
+	currentLevel atomic.Int32
+	installOnce  sync.Once
+)
+
+// levelWriter filtra las líneas del logger estándar según el nivel actual.
+// El código usa marcadores en el mensaje ("DEBUG", "WARNING", "ERROR"),
+// así que el nivel se infiere del contenido de cada línea.
+type levelWriter struct {
+	out io.Writer
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	if lineLevel(p) < currentLevel.Load() {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+func lineLevel(p []byte) int32 {
+	switch {
+	case bytes.Contains(p, []byte("DEBUG")):
+		return LevelDebug
+	case bytes.Contains(p, []byte("ERROR")), bytes.Contains(p, []byte("Error")),
+		bytes.Contains(p, []byte("PANIC")), bytes.Contains(p, []byte("CRITICO")):
+		return LevelError
+	case bytes.Contains(p, []byte("WARN")), bytes.Contains(p, []byte("Warning")):
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// ParseLevel convierte el nombre de nivel del YAML (debug, info, warn, error)
+func ParseLevel(name string) int32 {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// SetLevel aplica el nivel de log. Se puede llamar en caliente (recarga de config).
+func SetLevel(name string) {
+	installOnce.Do(func() {
+		log.SetOutput(&levelWriter{out: os.Stderr})
+	})
+	currentLevel.Store(ParseLevel(name))
+}
+
+// Level devuelve el nombre del nivel actual
+func Level() string {
+	switch currentLevel.Load() {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"apicall/internal/config"
+)
+
+// dialTimeout limita la conexión al servidor SMTP
+const dialTimeout = 15 * time.Second
+
+// maxRecipients es el máximo de destinatarios de una lista (summary_emails)
+const maxRecipients = 20
+
+// Mailer envía emails de texto plano por el servidor SMTP del YAML
+type Mailer struct {
+	cfg config.SMTPConfig
+}
+
+// New crea el mailer; nil si no hay servidor SMTP configurado
+func New(cfg config.SMTPConfig) *Mailer {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Mailer{cfg: cfg}
+}
+
+// ParseAddresses valida una lista de emails separados por coma y devuelve las direcciones
+func ParseAddresses(raw string) ([]string, error) {
+	addrs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		a, err := mail.ParseAddress(item)
+		if err != nil {
+			return nil, fmt.Errorf("email inválido '%s'", item)
+		}
+		if !seen[a.Address] {
+			seen[a.Address] = true
+			addrs = append(addrs, a.Address)
+		}
+	}
+	if len(addrs) > maxRecipients {
+		return nil, fmt.Errorf("máximo %d destinatarios", maxRecipients)
+	}
+	return addrs, nil
+}
+
+// Send envía un email de texto plano a los destinatarios
+func (m *Mailer) Send(to []string, subject, body string) error {
+	if len(to) == 0 {
+		return nil
+	}
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("smtp.from inválido: %w", err)
+	}
+
+	conn, err := m.dial()
+	if err != nil {
+		return fmt.Errorf("error conectando a %s: %w", m.cfg.Addr(), err)
+	}
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error iniciando SMTP: %w", err)
+	}
+	defer c.Close()
+
+	if !m.cfg.TLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+				return fmt.Errorf("error en STARTTLS: %w", err)
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("error de autenticación SMTP: %w", err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM rechazado: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("destinatario %s rechazado: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error en DATA: %w", err)
+	}
+	if _, err := w.Write(message(from.String(), to, subject, body)); err != nil {
+		w.Close()
+		return fmt.Errorf("error enviando el mensaje: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error enviando el mensaje: %w", err)
+	}
+	return c.Quit()
+}
+
+func (m *Mailer) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if m.cfg.TLS {
+		return tls.DialWithDialer(dialer, "tcp", m.cfg.Addr(), &tls.Config{ServerName: m.cfg.Host})
+	}
+	return dialer.Dial("tcp", m.cfg.Addr())
+}
+
+// message arma el mensaje con cabeceras MIME; el asunto va codificado (puede tener acentos)
+func message(from string, to []string, subject, body string) []byte {
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	sb.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(sb.String())
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"apicall/internal/database"
+)
+
+// telegramAPI es la API de bots de Telegram (variable para apuntar a un proxy)
+var telegramAPI = "https://api.telegram.org"
+
+// telegramToken es el formato del token de un bot: <id>:<secreto>
+var telegramToken = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]+$`)
+
+func init() {
+	Register("slack", newSlack)
+	Register("telegram", newTelegram)
+}
+
+// slack publica en un Incoming Webhook de Slack
+type slack struct {
+	url string
+}
+
+func newSlack(ch *database.NotificationChannel) (Sender, error) {
+	u, err := url.Parse(ch.WebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("webhook_url debe ser la URL https del Incoming Webhook de Slack")
+	}
+	if len(ch.WebhookURL) > 500 {
+		return nil, fmt.Errorf("webhook_url excede 500 caracteres")
+	}
+	return &slack{url: ch.WebhookURL}, nil
+}
+
+func (s *slack) Send(client *http.Client, text string) error {
+	return postJSON(client, s.url, map[string]string{"text": text})
+}
+
+// telegram envía con sendMessage de la API de bots
+type telegram struct {
+	token  string
+	chatID string
+}
+
+func newTelegram(ch *database.NotificationChannel) (Sender, error) {
+	if !telegramToken.MatchString(ch.BotToken) || len(ch.BotToken) > 100 {
+		return nil, fmt.Errorf("bot_token inválido (formato 123456:ABC...)")
+	}
+	if ch.ChatID == "" || len(ch.ChatID) > 50 {
+		return nil, fmt.Errorf("chat_id requerido (ej: -1001234567890 o @canal)")
+	}
+	return &telegram{token: ch.BotToken, chatID: ch.ChatID}, nil
+}
+
+func (t *telegram) Send(client *http.Client, text string) error {
+	return postJSON(client, telegramAPI+"/bot"+t.token+"/sendMessage", map[string]interface{}{
+		"chat_id":                  t.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+// postJSON envía payload como JSON; cualquier respuesta 2xx cuenta como entregada
+func postJSON(client *http.Client, target string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializando mensaje: %w", err)
+	}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// El error de url incluye la URL (con el token de Telegram): solo se conserva la causa
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("error enviando mensaje: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("respuesta %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package notify envía los eventos de campaña y las alertas a los canales de chat (Slack, Telegram)
+// configurados en cada proyecto. Cada tipo de canal es un Sender registrado con Register.
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// Eventos que se pueden suscribir en NotificationChannel.Eventos
+const (
+	EventCampaignStarted   = "campaign.started"
+	EventCampaignPaused    = "campaign.paused"
+	EventCampaignStopped   = "campaign.stopped"
+	EventCampaignExit      = "campaign.exit"      // Pausada por una regla de salida
+	EventCampaignCompleted = "campaign.completed" // Con el resumen final
+	EventAlert             = "alert"              // Alertas de troncales y campañas del proyecto
+)
+
+// Events son todos los eventos válidos
+var Events = []string{
+	EventCampaignStarted, EventCampaignPaused, EventCampaignStopped,
+	EventCampaignExit, EventCampaignCompleted, EventAlert,
+}
+
+// requestTimeout limita cada envío a Slack / Telegram
+const requestTimeout = 10 * time.Second
+
+// Sender entrega un mensaje de texto a un canal
+type Sender interface {
+	Send(client *http.Client, text string) error
+}
+
+// Factory crea el Sender de un canal y valida su configuración
+type Factory func(ch *database.NotificationChannel) (Sender, error)
+
+var factories = map[string]Factory{}
+
+// Register agrega un tipo de canal (slack y telegram se registran en este paquete)
+func Register(tipo string, f Factory) {
+	factories[tipo] = f
+}
+
+// Types devuelve los tipos de canal registrados
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Validate normaliza y valida un canal: tipo registrado, configuración y eventos
+func Validate(ch *database.NotificationChannel) error {
+	ch.Nombre = strings.TrimSpace(ch.Nombre)
+	if len(ch.Nombre) > 100 {
+		return fmt.Errorf("nombre excede 100 caracteres")
+	}
+	if _, err := newSender(ch); err != nil {
+		return err
+	}
+
+	var eventos []string
+	for _, e := range strings.Split(ch.Eventos, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e == "" {
+			continue
+		}
+		if !isEvent(e) {
+			return fmt.Errorf("evento inválido '%s' (válidos: %s)", e, strings.Join(Events, ", "))
+		}
+		eventos = append(eventos, e)
+	}
+	ch.Eventos = strings.Join(eventos, ",")
+	return nil
+}
+
+func isEvent(e string) bool {
+	for _, valid := range Events {
+		if e == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func newSender(ch *database.NotificationChannel) (Sender, error) {
+	f, ok := factories[ch.Tipo]
+	if !ok {
+		return nil, fmt.Errorf("tipo debe ser uno de: %s", strings.Join(Types(), ", "))
+	}
+	return f(ch)
+}
+
+// subscribed indica si el canal recibe el evento (sin eventos = todos)
+func subscribed(ch *database.NotificationChannel, event string) bool {
+	if ch.Eventos == "" {
+		return true
+	}
+	for _, e := range strings.Split(ch.Eventos, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher envía eventos a los canales activos del proyecto. nil = sin canales.
+type Dispatcher struct {
+	repo   *database.Repository
+	client *http.Client
+}
+
+// NewDispatcher crea el despachador de notificaciones
+func NewDispatcher(repo *database.Repository) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Notify envía text a los canales del proyecto suscritos a event. No bloquea: el envío corre en
+// una goroutine y los errores solo se registran en el log.
+func (d *Dispatcher) Notify(proyectoID int, event, text string) {
+	if d == nil {
+		return
+	}
+	go d.send(proyectoID, event, text)
+}
+
+func (d *Dispatcher) send(proyectoID int, event, text string) {
+	channels, err := d.repo.GetActiveNotificationChannels(proyectoID)
+	if err != nil {
+		log.Printf("[Notify] %v", err)
+		return
+	}
+	for i := range channels {
+		ch := &channels[i]
+		if !subscribed(ch, event) {
+			continue
+		}
+		if err := d.deliver(ch, text); err != nil {
+			log.Printf("[Notify] Error enviando %s al canal %d (%s) del proyecto %d: %v", event, ch.ID, ch.Tipo, proyectoID, err)
+		}
+	}
+}
+
+// Test envía un mensaje de prueba al canal y devuelve el error de entrega
+func (d *Dispatcher) Test(ch *database.NotificationChannel) error {
+	return d.deliver(ch, fmt.Sprintf("Mensaje de prueba de apicall: canal %s del proyecto %d", ch.Tipo, ch.ProyectoID))
+}
+
+func (d *Dispatcher) deliver(ch *database.NotificationChannel, text string) error {
+	sender, err := newSender(ch)
+	if err != nil {
+		return err
+	}
+	return sender.Send(d.client, text)
+}
@@ -0,0 +1,118 @@
+package phone
+
+import (
+	"fmt"
+	"strings"
+)
+
+// countryRule describe el plan de numeración de un país
+type countryRule struct {
+	Code        string // Código de país (sin +)
+	MinLen      int    // Longitud mínima del número nacional significativo
+	MaxLen      int    // Longitud máxima del número nacional significativo
+	TrunkPrefix string // Prefijo nacional a remover (p.ej. "0")
+}
+
+// rules contiene los países soportados (ISO 3166-1 alpha-2)
+var rules = map[string]countryRule{
+	"AR": {Code: "54", MinLen: 10, MaxLen: 11, TrunkPrefix: "0"},
+	"BO": {Code: "591", MinLen: 8, MaxLen: 8},
+	"BR": {Code: "55", MinLen: 10, MaxLen: 11, TrunkPrefix: "0"},
+	"CA": {Code: "1", MinLen: 10, MaxLen: 10},
+	"CL": {Code: "56", MinLen: 9, MaxLen: 9},
+	"CO": {Code: "57", MinLen: 10, MaxLen: 10},
+	"CR": {Code: "506", MinLen: 8, MaxLen: 8},
+	"DO": {Code: "1", MinLen: 10, MaxLen: 10},
+	"EC": {Code: "593", MinLen: 8, MaxLen: 9, TrunkPrefix: "0"},
+	"ES": {Code: "34", MinLen: 9, MaxLen: 9},
+	"GT": {Code: "502", MinLen: 8, MaxLen: 8},
+	"HN": {Code: "504", MinLen: 8, MaxLen: 8},
+	"MX": {Code: "52", MinLen: 10, MaxLen: 10},
+	"PA": {Code: "507", MinLen: 7, MaxLen: 8},
+	"PE": {Code: "51", MinLen: 8, MaxLen: 9, TrunkPrefix: "0"},
+	"PY": {Code: "595", MinLen: 9, MaxLen: 9, TrunkPrefix: "0"},
+	"SV": {Code: "503", MinLen: 8, MaxLen: 8},
+	"US": {Code: "1", MinLen: 10, MaxLen: 10},
+	"UY": {Code: "598", MinLen: 8, MaxLen: 8, TrunkPrefix: "0"},
+	"VE": {Code: "58", MinLen: 10, MaxLen: 10, TrunkPrefix: "0"},
+}
+
+// IsSupported indica si existe un plan de numeración para el país
+func IsSupported(country string) bool {
+	_, ok := rules[strings.ToUpper(strings.TrimSpace(country))]
+	return ok
+}
+
+// Clean elimina separadores comunes: espacios, guiones, paréntesis y puntos
+func Clean(raw string) string {
+	return strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "", "\t", "").Replace(strings.TrimSpace(raw))
+}
+
+// Normalize convierte un número al formato canónico E.164 sin "+" (p.ej. 573001234567).
+// Si country está vacío solo se limpian separadores (comportamiento legado, sin validar).
+func Normalize(raw, country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		return Clean(raw), nil
+	}
+
+	num := Clean(raw)
+	if num == "" {
+		return "", fmt.Errorf("número vacío")
+	}
+
+	international := false
+	switch {
+	case strings.HasPrefix(num, "+"):
+		num = num[1:]
+		international = true
+	case strings.HasPrefix(num, "00"):
+		num = num[2:]
+		international = true
+	}
+
+	for _, ch := range num {
+		if ch < '0' || ch > '9' {
+			return "", fmt.Errorf("caracteres inválidos en %q", raw)
+		}
+	}
+
+	rule, ok := rules[country]
+	if !ok {
+		return "", fmt.Errorf("país no soportado: %s", country)
+	}
+
+	if international {
+		// Número internacional de otro país: solo validar longitud E.164
+		if !strings.HasPrefix(num, rule.Code) {
+			if len(num) < 8 || len(num) > 15 {
+				return "", fmt.Errorf("longitud inválida (%d dígitos)", len(num))
+			}
+			return num, nil
+		}
+		national := num[len(rule.Code):]
+		if !rule.validLen(national) {
+			return "", fmt.Errorf("número inválido para %s: %s", country, raw)
+		}
+		return num, nil
+	}
+
+	// Ya incluye código de país (p.ej. 573001234567)
+	if strings.HasPrefix(num, rule.Code) && rule.validLen(num[len(rule.Code):]) {
+		return num, nil
+	}
+
+	// Número nacional: remover prefijo troncal y anteponer código de país
+	national := num
+	if rule.TrunkPrefix != "" && strings.HasPrefix(national, rule.TrunkPrefix) && !rule.validLen(national) {
+		national = strings.TrimPrefix(national, rule.TrunkPrefix)
+	}
+	if !rule.validLen(national) {
+		return "", fmt.Errorf("número inválido para %s: %s", country, raw)
+	}
+	return rule.Code + national, nil
+}
+
+func (r countryRule) validLen(national string) bool {
+	return len(national) >= r.MinLen && len(national) <= r.MaxLen
+}
@@ -6,13 +6,24 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"apicall/internal/config"
 	"apicall/internal/database"
+	"apicall/internal/secrets"
 )
 
+// syncMu serializa las sincronizaciones: dos cambios de troncal simultáneos no se pisan el archivo
+var syncMu sync.Mutex
+
 // SyncTroncales generates sip_apicall.conf from DB
 func SyncTroncales(repo *database.Repository) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	if !settings.AsteriskManaged() {
+		log.Println("[Provisioner] Sincronización de troncales omitida (provisioning.manage_asterisk=false)")
+		return nil
+	}
 	log.Println("[Provisioner] Sincronizando troncales...")
 	
 	troncales, err := repo.ListTroncales()
@@ -41,7 +52,11 @@ func SyncTroncales(repo *database.Repository) error {
 			sb.WriteString(fmt.Sprintf("defaultuser=%s\n", t.Usuario))
 		}
 		if t.Password != "" {
-			sb.WriteString(fmt.Sprintf("secret=%s\n", t.Password))
+			secret, err := secrets.Decrypt(t.Password)
+			if err != nil {
+				return fmt.Errorf("error descifrando secreto de troncal %s: %w", t.Nombre, err)
+			}
+			sb.WriteString(fmt.Sprintf("secret=%s\n", secret))
 		}
 		if t.Contexto != "" {
 			sb.WriteString(fmt.Sprintf("context=%s\n", t.Contexto))
@@ -54,80 +69,60 @@ func SyncTroncales(repo *database.Repository) error {
 		sb.WriteString("insecure=port,invite\n\n")
 	}
 	
-	destFile := "/etc/asterisk/sip_apicall.conf"
-	if err := os.WriteFile(destFile, []byte(sb.String()), 0644); err != nil {
-		return fmt.Errorf("error escribiendo %s: %w", destFile, err)
-	}
-	
+	plan := &Plan{}
+	planFile(plan, "/etc/asterisk/sip_apicall.conf", []byte(sb.String()))
+
 	// Ensure sip.conf includes it
-	if err := ensureInclude("/etc/asterisk/sip.conf", "sip_apicall.conf"); err != nil {
+	if err := planInclude(plan, "/etc/asterisk/sip.conf", "sip_apicall.conf", false); err != nil {
 		log.Printf("[Provisioner] Warning: No se pudo inyectar include en sip.conf: %v", err)
-		// Try to append if sip_custom.conf exists? Usually sip.conf is main. 
 		// If fails, user must include it manually.
 	}
-	
-	// Reload SIP
-	if err := exec.Command("asterisk", "-rx", "sip reload").Run(); err != nil {
-		 log.Printf("[Provisioner] Warning: Error recargando SIP: %v", err)
-	} else {
-		log.Println("[Provisioner] ✓ Troncales sincronizadas y SIP recargado.")
-	}
-	
-	return nil
-}
 
-func ensureInclude(filepath, include string) error {
-	contentBytes, err := os.ReadFile(filepath)
-	if err != nil {
-		return err
+	if plan.Empty() {
+		log.Println("[Provisioner] ✓ Troncales sin cambios.")
+		return nil
 	}
-	content := string(contentBytes)
-	if !strings.Contains(content, include) {
-		f, err := os.OpenFile(filepath, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		
-		stmt := fmt.Sprintf("\n#include %s\n", include)
-		if _, err := f.WriteString(stmt); err != nil {
-			return err
-		}
+	plan.add("Recargar SIP (sip reload)", func() error {
+		return exec.Command("asterisk", "-rx", "sip reload").Run()
+	})
+
+	plan.Log()
+	if settings.DryRun {
+		log.Println("[Provisioner] dry_run: troncales no aplicadas")
+		return nil
 	}
-	return nil
+	return plan.Apply()
 }
 
-// ConfigureAsterisk ensures Asterisk has the necessary configuration
-func ConfigureAsterisk(cfg *config.Config) {
-	log.Println("[Provisioner] Configurando Asterisk...")
+// planAsteriskConfig agrega los cambios de configuración de Asterisk (Manager, Módulos, Dialplan)
+// y la recarga si hubo alguno
+func planAsteriskConfig(plan *Plan, cfg *config.Config) {
+	before := len(plan.Steps)
 
 	// 1. Manager API (manager.d/apicall.conf)
-	if err := configureManager(cfg); err != nil {
-		log.Printf("[Provisioner] Error configurando Manager: %v", err)
-	}
+	planManager(plan, cfg)
 
 	// 2. Modules (modules.conf)
-	if err := configureModules(); err != nil {
+	if err := planModules(plan); err != nil {
 		log.Printf("[Provisioner] Error configurando Módulos: %v", err)
 	}
 
 	// 3. Dialplan (extensions_apicall.conf)
-	if err := configureDialplan(); err != nil {
+	if err := planDialplan(plan); err != nil {
 		log.Printf("[Provisioner] Error configurando Dialplan: %v", err)
 	}
-}
 
-func configureManager(cfg *config.Config) error {
-	dir := "/etc/asterisk/manager.d"
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		// If manager.d doesn't exist, we might need to append to manager.conf directly
-		// But modern Asterisk usually has it. Let's try creating it or fallback.
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("no existe manager.d y no se pudo crear: %w", err)
-		}
+	if len(plan.Steps) > before {
+		plan.add("Recargar Asterisk (core reload, module reload manager)", func() error {
+			if err := exec.Command("asterisk", "-rx", "core reload").Run(); err != nil {
+				return err
+			}
+			return exec.Command("asterisk", "-rx", "module reload manager").Run()
+		})
 	}
+}
 
-	path := "/etc/asterisk/manager.d/apicall.conf"
+func planManager(plan *Plan, cfg *config.Config) {
 	content := fmt.Sprintf(`; Generado automáticamente por Apicall
 [%s]
 secret=%s
@@ -137,69 +132,34 @@ read=all
 write=all
 `, cfg.AMI.Username, cfg.AMI.Secret)
 
-	// Check if content changed
-	existing, _ := os.ReadFile(path)
-	if string(existing) != content {
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return err
-		}
-		log.Println("[Provisioner] ✓ Usuario AMI configurado en manager.d/apicall.conf")
-		// Reload manager
-		// We execute asterisk reload command
-		// Just doing 'manager reload' might be safer
-        // But since we are provisioning, 'module reload manager' is fine.
-	}
-	return nil
+	// If manager.d doesn't exist it is created when applying
+	planFile(plan, "/etc/asterisk/manager.d/apicall.conf", []byte(content))
 }
 
-func configureModules() error {
+func planModules(plan *Plan) error {
 	path := "/etc/asterisk/modules.conf"
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return err // Might not exist on some installs?
 	}
 
+	// Ensure app_amd.so is loaded: enable it if noload'ed, append it if missing
 	strContent := string(content)
-	dirty := false
-
-	// Ensure app_amd.so is loaded
-	if !strings.Contains(strContent, "app_amd.so") {
-		// Add it to the end or before global [modules]? 
-        // Usually safe to append load => app_amd.so if we assume standard structure.
-        // Or ensure it is not noload'ed.
-        
-        // Simple strategy: Append if missing.
-        // Verify it's not noloaded
-        if !strings.Contains(strContent, "noload => app_amd.so") {
-             strContent += "\nload => app_amd.so\n"
-             dirty = true
-        }
-	} else {
-        // If it is noloaded, we should change it?
-        // Parsing modules.conf is complex. Let's assume standard behavior.
-        // If the user explicitly disabled it, maybe we shouldn't touch it?
-        // But the user asked for "full configuration".
-        if strings.Contains(strContent, "noload => app_amd.so") {
-            strContent = strings.Replace(strContent, "noload => app_amd.so", "load => app_amd.so", -1)
-            dirty = true
-        }
-    }
-
-	if dirty {
-		if err := os.WriteFile(path, []byte(strContent), 0644); err != nil {
-			return err
-		}
-		log.Println("[Provisioner] ✓ Módulo app_amd.so habilitado.")
+	if strings.Contains(strContent, "noload => app_amd.so") {
+		strContent = strings.Replace(strContent, "noload => app_amd.so", "load => app_amd.so", -1)
+	} else if !strings.Contains(strContent, "app_amd.so") {
+		strContent += "\nload => app_amd.so\n"
 	}
+
+	planFile(plan, path, []byte(strContent))
 	return nil
 }
 
-func configureDialplan() error {
+func planDialplan(plan *Plan) error {
 	const (
 		sourceFile = "/opt/apicall/configs/extensions_apicall.conf"
 		destFile   = "/etc/asterisk/extensions_apicall.conf"
 		customFile = "/etc/asterisk/extensions_custom.conf"
-		includeStr = "#include extensions_apicall.conf"
 	)
 
 	// 1. Leer archivo fuente
@@ -209,35 +169,12 @@ func configureDialplan() error {
 	}
 
 	// 2. Escribir o sobrescribir en /etc/asterisk
-	if err := os.WriteFile(destFile, content, 0644); err != nil {
-		return fmt.Errorf("no se pudo escribir %s: %w", destFile, err)
-	}
+	planFile(plan, destFile, content)
 
-	// 3. Verificar si extensions_custom.conf existe
-	customContentBytes, err := os.ReadFile(customFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-            // Create check if we should create it
-            // usually extensions.conf calls extensions_custom.conf
-            // Let's create it.
-			return os.WriteFile(customFile, []byte(includeStr+"\n"), 0644)
-		}
+	// 3. Incluirlo desde extensions_custom.conf (se crea si no existe:
+	// usually extensions.conf calls extensions_custom.conf)
+	if err := planInclude(plan, customFile, "extensions_apicall.conf", true); err != nil {
 		return fmt.Errorf("error leyendo %s: %w", customFile, err)
 	}
-
-	customContent := string(customContentBytes)
-	if !strings.Contains(customContent, "extensions_apicall.conf") {
-		f, err := os.OpenFile(customFile, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("error abriendo %s: %w", customFile, err)
-		}
-		defer f.Close()
-
-		if _, err := f.WriteString("\n" + includeStr + "\n"); err != nil {
-			return fmt.Errorf("error escribiendo en %s: %w", customFile, err)
-		}
-		log.Println("[Provisioner] ✓ Dialplan incluido en extensions_custom.conf")
-	}
-
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"apicall/internal/config"
@@ -14,146 +15,164 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 )
 
-// EnsureInfrastructure ensures DB and Asterisk are installed and running
+// Paquetes a instalar por familia de OS
+var (
+	asteriskPackages = map[sysadmin.OSType][]string{
+		sysadmin.Debian: {"asterisk", "asterisk-core-sounds-es", "asterisk-moh-opsound-wav"}, // Basic Asterisk + Sounds + MOH
+		// Assumption: EPEL or repo is enabled. Sounds might vary in naming convention.
+		sysadmin.RHEL: {"asterisk", "asterisk-sounds-core-es-wav"},
+		sysadmin.Suse: {"asterisk"},
+	}
+	mariadbPackages = map[sysadmin.OSType][]string{
+		sysadmin.Debian: {"mariadb-server"},
+		sysadmin.RHEL:   {"mariadb-server"},
+		sysadmin.Suse:   {"mariadb"},
+	}
+)
+
+// EnsureInfrastructure ensures DB and Asterisk are installed and running,
+// according to the provisioning flags. The plan is logged before touching anything.
 func EnsureInfrastructure(cfg *config.Config) {
-	// 1. Install/Ensure Asterisk
-	installAsterisk()
-	
-	// 2. Configure Asterisk (Manager, Modules, Dialplan)
-	ConfigureAsterisk(cfg)
-	
-	// Reload Asterisk to apply changes
-	exec.Command("asterisk", "-rx", "core reload").Run()
-	exec.Command("asterisk", "-rx", "module reload manager").Run()
+	Configure(cfg.Provisioning)
+	if !cfg.Provisioning.IsEnabled() {
+		log.Println("[Provisioner] Aprovisionamiento deshabilitado (provisioning.enabled=false)")
+		return
+	}
 
-	// 3. Ensure DB (Install MariaDB + Bootstrap + Migrations)
-	EnsureDB(cfg)
+	plan := BuildPlan(cfg)
+	plan.Log()
+	if cfg.Provisioning.DryRun {
+		log.Println("[Provisioner] dry_run: no se aplicó ningún cambio")
+		return
+	}
+	plan.Apply()
 }
 
-// EnsureDB ensures the specific DB exists, installing MariaDB if necessary
-func EnsureDB(cfg *config.Config) {
-    // 1. Try to connect normally first
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
-		cfg.Database.Username, cfg.Database.Password,
-		cfg.Database.Host, cfg.Database.Port, cfg.Database.Database)
+// BuildPlan inspecciona el servidor y devuelve los cambios que el aprovisionamiento aplicaría
+func BuildPlan(cfg *config.Config) *Plan {
+	plan := &Plan{}
+	if !cfg.Provisioning.IsEnabled() {
+		return plan
+	}
 
-	db, err := sql.Open("mysql", dsn)
-	if err == nil {
-		if err := db.Ping(); err == nil {
-			// Connection OK, verify schema (migrations) and return
-			log.Println("[Provisioner] Conexión DB exitosa. Verificando esquema...")
-			if err := RunMigrations(db, "/opt/apicall/migrations"); err != nil {
-				log.Printf("[Provisioner] Warning: Error corriendo migraciones: %v", err)
-			}
-			db.Close()
-			return
+	// 1. Install/Ensure Asterisk + Configure (Manager, Modules, Dialplan)
+	if cfg.Provisioning.AsteriskManaged() {
+		if planService(plan, "asterisk", "asterisk", asteriskPackages) {
+			// Recién instalado: los archivos se evalúan después de la instalación
+			plan.add("Configurar Asterisk (manager.d, modules.conf, dialplan, prompts) tras la instalación", func() error {
+				sub := &Plan{}
+				planAsteriskConfig(sub, cfg)
+				planPrompts(sub, cfg.Asterisk.SoundPath)
+				sub.Apply()
+				return nil
+			})
+		} else {
+			planAsteriskConfig(plan, cfg)
+			planPrompts(plan, cfg.Asterisk.SoundPath)
 		}
+	} else {
+		log.Println("[Provisioner] Asterisk no gestionado (provisioning.manage_asterisk=false)")
 	}
-	db.Close()
 
-	log.Println("[Provisioner] No se pudo conectar a la BD. Iniciando protocolo de aprovisionamiento...")
-
-    // Only attempt auto-install if localhost
-	if cfg.Database.Host != "127.0.0.1" && cfg.Database.Host != "localhost" {
-		log.Println("[Provisioner] BD Remota no accesible. Omitiendo instalación local.")
-		return
-	}
+	// 2. Ensure DB (Install MariaDB + Bootstrap + Migrations)
+	planDB(plan, cfg)
+	return plan
+}
 
-	// 2. Install/Check MariaDB Service
-	installMariaDB()
+// planDB agrega las migraciones si la BD responde, o la instalación y el bootstrap si no
+func planDB(plan *Plan, cfg *config.Config) {
+	const migrationsPath = "/opt/apicall/migrations"
 
-    // 3. Bootstrap DB (Create DB and User)
-    bootstrapDB(cfg)
-}
+	// 1. Try to connect normally first
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+		cfg.Database.Username, cfg.Database.Password,
+		cfg.Database.Host, cfg.Database.Port, cfg.Database.Database)
 
-func installAsterisk() {
-	_, err := exec.LookPath("asterisk")
+	db, err := sql.Open("mysql", dsn)
 	if err == nil {
-		log.Println("[Provisioner] Asterisk detectado.")
-		// Ensure service is running
-		if err := exec.Command("systemctl", "is-active", "asterisk").Run(); err != nil {
-             log.Println("[Provisioner] Servicio asterisk no activo. Intentando iniciar...")
-             exec.Command("systemctl", "start", "asterisk").Run()
-        }
+		err = db.Ping()
+		db.Close()
+	}
+	if err == nil {
+		// Connection OK, verify schema (migrations)
+		plan.add(fmt.Sprintf("Ejecutar migraciones de %s", migrationsPath), func() error {
+			db, err := sql.Open("mysql", dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return RunMigrations(db, migrationsPath)
+		})
 		return
 	}
 
-	log.Println("[Provisioner] Asterisk no detectado. Iniciando instalación...")
-	osType := sysadmin.DetectOS()
-	var cmd *exec.Cmd
-
-	switch osType {
-	case sysadmin.Debian:
-		exec.Command("apt-get", "update").Run()
-		// Basic Asterisk + Sounds + MOH
-		cmd = exec.Command("apt-get", "install", "-y", "asterisk", "asterisk-core-sounds-es", "asterisk-moh-opsound-wav")
-	case sysadmin.RHEL:
-		// Assumption: EPEL or repo is enabled. RHEL often needs 'asterisk' package.
-		// Sounds might vary in naming convention.
-		cmd = exec.Command("yum", "install", "-y", "asterisk", "asterisk-sounds-core-es-wav")
-	case sysadmin.Suse:
-		cmd = exec.Command("zypper", "--non-interactive", "install", "asterisk")
-	default:
-		log.Println("[Provisioner] OS no soportado para auto-instalación de Asterisk. Instale manualmente.")
+	log.Println("[Provisioner] No se pudo conectar a la BD.")
+	if !cfg.Provisioning.DBManaged() {
+		log.Println("[Provisioner] MariaDB no gestionada (provisioning.manage_db=false). Omitiendo instalación.")
 		return
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Printf("[Provisioner] Error instalando Asterisk: %v", err)
+	// Only attempt auto-install if localhost
+	if cfg.Database.Host != "127.0.0.1" && cfg.Database.Host != "localhost" {
+		log.Println("[Provisioner] BD Remota no accesible. Omitiendo instalación local.")
 		return
 	}
 
-	// Enable and Start
-	exec.Command("systemctl", "enable", "--now", "asterisk").Run()
-	log.Println("[Provisioner] Asterisk instalado y arrancado.")
-	time.Sleep(5 * time.Second) // Allow startup
+	// 2. Install/Check MariaDB Service
+	planService(plan, "mysql", "mariadb", mariadbPackages)
+
+	// 3. Bootstrap DB (Create DB and User) + Migrations
+	plan.add(fmt.Sprintf("Crear BD %s y usuario %s (bootstrap como root) y ejecutar migraciones",
+		cfg.Database.Database, cfg.Database.Username), func() error {
+		bootstrapDB(cfg)
+		return nil
+	})
 }
 
-func installMariaDB() {
-	// Check if mysql command exists
-	_, err := exec.LookPath("mysql")
-	if err == nil {
-        // Check service status
-        if err := exec.Command("systemctl", "is-active", "mariadb").Run(); err != nil {
-             log.Println("[Provisioner] Servicio mariadb no activo. Intentando iniciar...")
-             exec.Command("systemctl", "start", "mariadb").Run()
-        }
-		return
+// planService agrega el arranque de un servicio detenido, o su instalación si el binario no existe.
+// Devuelve true si se planificó la instalación.
+func planService(plan *Plan, binary, service string, packages map[sysadmin.OSType][]string) bool {
+	if _, err := exec.LookPath(binary); err == nil {
+		log.Printf("[Provisioner] %s detectado.", service)
+		if err := exec.Command("systemctl", "is-active", service).Run(); err != nil {
+			plan.add(fmt.Sprintf("Iniciar servicio %s (systemctl start %s)", service, service), func() error {
+				return exec.Command("systemctl", "start", service).Run()
+			})
+		}
+		return false
 	}
 
-	log.Println("[Provisioner] MariaDB no detectado. Instalando...")
-	
 	osType := sysadmin.DetectOS()
-	var cmd *exec.Cmd
-
+	var args []string
 	switch osType {
 	case sysadmin.Debian:
-		exec.Command("apt-get", "update").Run()
-		cmd = exec.Command("apt-get", "install", "-y", "mariadb-server")
+		args = append([]string{"apt-get", "install", "-y"}, packages[osType]...)
 	case sysadmin.RHEL:
-		cmd = exec.Command("yum", "install", "-y", "mariadb-server")
+		args = append([]string{"yum", "install", "-y"}, packages[osType]...)
 	case sysadmin.Suse:
-		// Try zypper
-		cmd = exec.Command("zypper", "--non-interactive", "install", "mariadb")
+		args = append([]string{"zypper", "--non-interactive", "install"}, packages[osType]...)
 	default:
-		log.Println("[Provisioner] OS no soportado para auto-instalación. Instale MariaDB manualmente.")
-		return
+		log.Printf("[Provisioner] %s no detectado y OS no soportado para auto-instalación. Instale manualmente.", service)
+		return false
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		log.Printf("[Provisioner] Error instalando MariaDB: %v", err)
-		return
-	}
+	plan.add(fmt.Sprintf("Instalar %s (%s) y habilitar el servicio", service, strings.Join(args, " ")), func() error {
+		if osType == sysadmin.Debian {
+			exec.Command("apt-get", "update").Run()
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
 
-	// Start service
-	exec.Command("systemctl", "enable", "--now", "mariadb").Run()
-	log.Println("[Provisioner] MariaDB instalado y arrancado.")
-    // Wait for startup
-    time.Sleep(5 * time.Second)
+		// Enable and Start
+		exec.Command("systemctl", "enable", "--now", service).Run()
+		time.Sleep(5 * time.Second) // Allow startup
+		return nil
+	})
+	return true
 }
 
 func bootstrapDB(cfg *config.Config) {
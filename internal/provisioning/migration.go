@@ -2,15 +2,19 @@ package provisioning
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
-// RunMigrations executes SQL migration files in order
+// RunMigrations executes SQL migration files in order. Los archivos aplicados quedan en
+// apicall_schema_migrations y no se vuelven a ejecutar en los siguientes arranques.
 func RunMigrations(db *sql.DB, migrationsPath string) error {
 	log.Printf("[Provisioner] Buscando migraciones en %s", migrationsPath)
 
@@ -28,29 +32,131 @@ func RunMigrations(db *sql.DB, migrationsPath string) error {
 
 	sort.Strings(sqlFiles)
 
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS apicall_schema_migrations (
+		filename VARCHAR(255) NOT NULL PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`); err != nil {
+		return fmt.Errorf("error creando tabla de migraciones: %w", err)
+	}
+	applied := map[string]bool{}
+	rows, err := db.Query(`SELECT filename FROM apicall_schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("error consultando migraciones aplicadas: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[name] = true
+	}
+	rows.Close()
+
 	for _, filename := range sqlFiles {
+		if applied[filename] {
+			continue
+		}
 		log.Printf("[Provisioner] Ejecutando migración: %s", filename)
 		content, err := os.ReadFile(filepath.Join(migrationsPath, filename))
 		if err != nil {
 			return fmt.Errorf("error leyendo archivo %s: %w", filename, err)
 		}
 
-		queries := strings.Split(string(content), ";")
+		queries := splitStatements(string(content))
 		for _, q := range queries {
 			q = strings.TrimSpace(q)
 			if q == "" {
 				continue
 			}
 			if _, err := db.Exec(q); err != nil {
-				// Ignore "already exists" errors for idempotency if simple
-				// But ideally better migration logic checks existence.
-				// For now, let's assume valid SQL or ignore specific errors casually:
-				if strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "Duplicate column") {
-					continue 
+				// Instalaciones anteriores a apicall_schema_migrations vuelven a pasar por todos los
+				// archivos una vez: se toleran los objetos que ya existen
+				if alreadyApplied(err) {
+					continue
 				}
 				return fmt.Errorf("error ejecutando query en %s: %w", filename, err)
 			}
 		}
+		if _, err := db.Exec(`INSERT IGNORE INTO apicall_schema_migrations (filename) VALUES (?)`, filename); err != nil {
+			return fmt.Errorf("error registrando migración %s: %w", filename, err)
+		}
 	}
 	return nil
 }
+
+// alreadyApplied indica si el error de una sentencia se debe a que el objeto ya existe
+// (tabla, columna, índice o foreign key creados por una ejecución anterior)
+func alreadyApplied(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1050, // Table already exists
+			1060, // Duplicate column name
+			1061, // Duplicate key name
+			1826: // Duplicate foreign key constraint name (MySQL)
+			return true
+		}
+	}
+	msg := err.Error()
+	// MariaDB informa la foreign key duplicada como errno 121 al recrear la tabla
+	return strings.Contains(msg, "already exists") || strings.Contains(msg, "Duplicate column") ||
+		strings.Contains(msg, "Duplicate key name") || strings.Contains(msg, "errno: 121")
+}
+
+// splitStatements separa un archivo SQL en sentencias por ";". Los ";" dentro de literales
+// ('...', "...", `...`) y de comentarios (--, #, /* */) no cortan la sentencia; los comentarios
+// se descartan para que un bloque solo de comentarios no se envíe como consulta vacía.
+func splitStatements(content string) []string {
+	var statements []string
+	var b strings.Builder
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Literal: hasta la comilla de cierre (\x y comillas duplicadas son escapes)
+			b.WriteByte(c)
+			for i++; i < len(content); i++ {
+				b.WriteByte(content[i])
+				if content[i] == '\\' && c != '`' && i+1 < len(content) {
+					i++
+					b.WriteByte(content[i])
+					continue
+				}
+				if content[i] == c {
+					if i+1 < len(content) && content[i+1] == c {
+						i++
+						b.WriteByte(content[i])
+						continue
+					}
+					break
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(content[i:], "--") &&
+			(i+2 == len(content) || content[i+2] == ' ' || content[i+2] == '\t' || content[i+2] == '\n' || content[i+2] == '\r')):
+			// Comentario de línea: se conserva el salto de línea
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			if i < len(content) {
+				b.WriteByte('\n')
+			}
+		case c == '/' && strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				i = len(content)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == ';':
+			statements = append(statements, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	statements = append(statements, b.String())
+	return statements
+}
@@ -0,0 +1,122 @@
+package provisioning
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"apicall/internal/config"
+)
+
+// settings son los flags de aprovisionamiento vigentes (Configure). El valor cero equivale a todo habilitado.
+var settings config.ProvisioningConfig
+
+// Configure fija los flags de aprovisionamiento usados también por SyncTroncales
+func Configure(p config.ProvisioningConfig) {
+	settings = p
+}
+
+// Step es un cambio que el aprovisionamiento aplicaría sobre el servidor
+type Step struct {
+	Description string
+	apply       func() error
+}
+
+// Plan lista los cambios detectados antes de tocar nada
+type Plan struct {
+	Steps []Step
+}
+
+func (p *Plan) add(description string, apply func() error) {
+	p.Steps = append(p.Steps, Step{Description: description, apply: apply})
+}
+
+// Empty indica que no hay cambios pendientes
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// String devuelve el plan numerado, un paso por línea
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "Sin cambios pendientes\n"
+	}
+	var sb strings.Builder
+	for i, step := range p.Steps {
+		fmt.Fprintf(&sb, "%2d. %s\n", i+1, step.Description)
+	}
+	return sb.String()
+}
+
+// Log escribe el plan en el log
+func (p *Plan) Log() {
+	if p.Empty() {
+		log.Println("[Provisioner] Plan: sin cambios pendientes")
+		return
+	}
+	log.Printf("[Provisioner] Plan de aprovisionamiento (%d cambios):", len(p.Steps))
+	for _, line := range strings.Split(strings.TrimRight(p.String(), "\n"), "\n") {
+		log.Printf("[Provisioner]   %s", line)
+	}
+}
+
+// Apply ejecuta los pasos en orden. Un paso fallido se registra y no detiene los siguientes;
+// devuelve el primer error.
+func (p *Plan) Apply() error {
+	var first error
+	for _, step := range p.Steps {
+		if err := step.apply(); err != nil {
+			log.Printf("[Provisioner] Error en '%s': %v", step.Description, err)
+			if first == nil {
+				first = fmt.Errorf("%s: %w", step.Description, err)
+			}
+			continue
+		}
+		log.Printf("[Provisioner] ✓ %s", step.Description)
+	}
+	return first
+}
+
+// planFile agrega la escritura de path si su contenido difiere del deseado
+func planFile(plan *Plan, path string, content []byte) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, content) {
+		return
+	}
+	action := "Modificar"
+	if os.IsNotExist(err) {
+		action = "Crear"
+	}
+	plan.add(fmt.Sprintf("%s %s", action, path), func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// Archivo temporal + rename: una recarga de Asterisk nunca lee el archivo a medio escribir
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, content, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	})
+}
+
+// planInclude agrega un #include al final de path si aún no lo referencia.
+// Con create el archivo se crea si no existe.
+func planInclude(plan *Plan, path, include string, create bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !(create && os.IsNotExist(err)) {
+		return err
+	}
+	if bytes.Contains(content, []byte(include)) {
+		return nil
+	}
+	stmt := fmt.Sprintf("#include %s\n", include)
+	if len(content) > 0 {
+		stmt = "\n" + stmt
+	}
+	planFile(plan, path, append(content, stmt...))
+	return nil
+}
@@ -0,0 +1,117 @@
+package provisioning
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"apicall/internal/audio"
+	"apicall/internal/database"
+	"apicall/internal/i18n"
+)
+
+// promptsDir guarda packs de prompts propios por idioma (ej: /opt/apicall/prompts/en/opcion_invalida.wav).
+// Tienen prioridad sobre el pack por defecto.
+const promptsDir = "/opt/apicall/prompts"
+
+// coreSoundDirs son las ubicaciones de los sonidos de Asterisk según la distribución
+var coreSoundDirs = []string{"/var/lib/asterisk/sounds", "/usr/share/asterisk/sounds"}
+
+// corePrompts arma el pack por defecto de cada idioma con los sonidos de Asterisk
+// (asterisk-core-sounds-<idioma>): el primero que exista de cada prompt de sistema
+var corePrompts = map[string][]string{
+	i18n.PromptInvalid: {"option-is-invalid"},
+	i18n.PromptConfirm: {"one-moment-please", "pls-hold-while-try"},
+}
+
+// planPrompts agrega la instalación de los prompts de sistema que faltan en sound_path, para cada idioma.
+// Un prompt existente nunca se reemplaza (puede ser una grabación propia).
+func planPrompts(plan *Plan, soundPath string) {
+	if soundPath == "" {
+		return
+	}
+	for _, locale := range i18n.Locales {
+		for _, name := range i18n.SystemPrompts {
+			ref := i18n.Prompt(locale, name)
+			if matches, _ := filepath.Glob(filepath.Join(soundPath, ref) + ".*"); len(matches) > 0 {
+				continue
+			}
+			files := promptSource(locale, name)
+			if len(files) == 0 {
+				log.Printf("[Provisioner] Warning: Sin pack para el prompt %s (%s): grabarlo en %s",
+					name, locale, filepath.Join(soundPath, ref))
+				continue
+			}
+			for _, src := range files {
+				content, err := os.ReadFile(src)
+				if err != nil {
+					log.Printf("[Provisioner] Warning: No se pudo leer %s: %v", src, err)
+					continue
+				}
+				planFile(plan, filepath.Join(soundPath, ref+filepath.Ext(src)), content)
+			}
+		}
+	}
+}
+
+// promptSource devuelve los archivos (uno por formato) del pack que provee el prompt en ese idioma
+func promptSource(locale, name string) []string {
+	patterns := []string{filepath.Join(promptsDir, locale, name+".*")}
+	for _, core := range corePrompts[name] {
+		for _, dir := range coreSoundDirs {
+			patterns = append(patterns, filepath.Join(dir, locale, core+".*"))
+			if locale == "en" {
+				patterns = append(patterns, filepath.Join(dir, core+".*")) // Instalaciones antiguas: inglés en la raíz
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		var files []string
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+				files = append(files, m)
+			}
+		}
+		if len(files) > 0 {
+			return files
+		}
+	}
+	return nil
+}
+
+// MissingPrompts devuelve los prompts de sistema (relativos a soundPath) que faltan para los idiomas indicados.
+// Si soundPath no es accesible desde este nodo no se puede comprobar y no informa ninguno.
+func MissingPrompts(soundPath string, locales []string) []string {
+	var missing []string
+	for _, locale := range locales {
+		for _, name := range i18n.SystemPrompts {
+			if ref := i18n.Prompt(locale, name); audio.Missing(soundPath, ref) {
+				missing = append(missing, ref)
+			}
+		}
+	}
+	return missing
+}
+
+// VerifyPrompts devuelve los prompts de sistema que faltan para el idioma por defecto y los que usan los proyectos
+func VerifyPrompts(repo *database.Repository, soundPath string) ([]string, error) {
+	locales, err := repo.ListProyectoLocales()
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{i18n.Default: true}
+	for _, l := range locales {
+		if l == "" {
+			l = i18n.Default
+		}
+		inUse[l] = true
+	}
+	sorted := make([]string, 0, len(inUse))
+	for l := range inUse {
+		sorted = append(sorted, l)
+	}
+	sort.Strings(sorted)
+	return MissingPrompts(soundPath, sorted), nil
+}
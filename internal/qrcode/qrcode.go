@@ -0,0 +1,461 @@
+// Package qrcode genera códigos QR (modo byte, corrección de errores M) para textos cortos como las
+// URL otpauth:// de la autenticación en dos pasos. Soporta las versiones 1 a 10 (hasta 213 bytes).
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong indica que el texto no entra en la versión más grande soportada
+var ErrTooLong = errors.New("texto demasiado largo para el código QR")
+
+// ecBlocks describe los bloques de corrección de errores M de una versión
+type ecBlocks struct {
+	ec     int    // Codewords de corrección por bloque
+	blocks [2]int // Cantidad de bloques cortos y largos
+	data   int    // Codewords de datos de un bloque corto (los largos tienen uno más)
+}
+
+// versions son los bloques del nivel M de las versiones 1..10
+var versions = []ecBlocks{
+	{10, [2]int{1, 0}, 16},
+	{16, [2]int{1, 0}, 28},
+	{26, [2]int{1, 0}, 44},
+	{18, [2]int{2, 0}, 32},
+	{24, [2]int{2, 0}, 43},
+	{16, [2]int{4, 0}, 27},
+	{18, [2]int{4, 0}, 31},
+	{22, [2]int{2, 2}, 38},
+	{22, [2]int{3, 2}, 36},
+	{26, [2]int{4, 1}, 43},
+}
+
+// alignment son los centros de los patrones de alineación de cada versión
+var alignment = [][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// formatM son los bits de formato del nivel M
+const formatM = 0
+
+// Code es un código QR: Modules[fila][columna] es true para los módulos oscuros
+type Code struct {
+	Version int
+	Size    int
+	Modules [][]bool
+
+	function [][]bool // Módulos de patrones fijos (no llevan datos ni máscara)
+}
+
+// Encode codifica data en la versión más chica que lo admite, con la máscara de menor penalización
+func Encode(data string) (*Code, error) {
+	version := 0
+	for v := 1; v <= len(versions); v++ {
+		if len(data) <= capacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+	codewords := interleave(version, dataCodewords(version, []byte(data)))
+
+	var best *Code
+	bestPenalty := 0
+	for mask := 0; mask < 8; mask++ {
+		c := newCode(version)
+		c.drawCodewords(codewords)
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); best == nil || p < bestPenalty {
+			best, bestPenalty = c, p
+		}
+	}
+	return best, nil
+}
+
+// capacity devuelve los bytes que admite una versión
+func capacity(version int) int {
+	b := versions[version-1]
+	dataCodewords := b.data*(b.blocks[0]+b.blocks[1]) + b.blocks[1]
+	return (dataCodewords*8 - 4 - countBits(version)) / 8
+}
+
+// countBits es el largo del contador de caracteres del modo byte
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// dataCodewords arma los codewords de datos: modo, largo, datos, terminador y relleno
+func dataCodewords(version int, data []byte) []byte {
+	b := versions[version-1]
+	total := b.data*(b.blocks[0]+b.blocks[1]) + b.blocks[1]
+
+	var bits []bool
+	put := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 == 1)
+		}
+	}
+	put(0x4, 4) // Modo byte
+	put(len(data), countBits(version))
+	for _, d := range data {
+		put(int(d), 8)
+	}
+	for i := 0; i < 4 && len(bits) < total*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	out := make([]byte, 0, total)
+	for i := 0; i < len(bits); i += 8 {
+		var v byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				v |= 1 << (7 - j)
+			}
+		}
+		out = append(out, v)
+	}
+	for pad := byte(0xEC); len(out) < total; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// interleave divide los datos en bloques, agrega la corrección de cada uno y los intercala
+func interleave(version int, data []byte) []byte {
+	b := versions[version-1]
+	divisor := rsDivisor(b.ec)
+
+	var blocks, ecc [][]byte
+	pos := 0
+	for i := 0; i < b.blocks[0]+b.blocks[1]; i++ {
+		n := b.data
+		if i >= b.blocks[0] {
+			n++
+		}
+		block := data[pos : pos+n]
+		pos += n
+		blocks = append(blocks, block)
+		ecc = append(ecc, rsRemainder(block, divisor))
+	}
+
+	var out []byte
+	for i := 0; i <= b.data; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < b.ec; i++ {
+		for _, e := range ecc {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplica en GF(256) con el polinomio 0x11D
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor calcula el polinomio generador Reed-Solomon de grado degree
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder calcula los codewords de corrección de un bloque
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, d := range data {
+		factor := d ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// newCode crea la matriz con los patrones fijos de la versión
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size, Modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range c.Modules {
+		c.Modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+
+	// Patrones de sincronización
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	// Patrones de posición (con su separador)
+	for _, p := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := p[0]+dx, p[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					c.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	// Patrones de alineación (salvo los que se superponen a los de posición)
+	pos := alignment[version-1]
+	for i, y := range pos {
+		for j, x := range pos {
+			if i == 0 && j == 0 || i == 0 && j == len(pos)-1 || i == len(pos)-1 && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// Reserva del formato (se dibuja con la máscara elegida) y versión
+	c.drawFormat(0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			c.set(a, b, bits>>i&1 == 1)
+			c.set(b, a, bits>>i&1 == 1)
+		}
+	}
+	return c
+}
+
+// set dibuja un módulo de patrón fijo en la columna x, fila y
+func (c *Code) set(x, y int, dark bool) {
+	c.Modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+// drawFormat dibuja las dos copias de la información de formato (nivel M y máscara)
+func (c *Code) drawFormat(mask int) {
+	data := formatM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // Módulo oscuro fijo
+}
+
+// drawCodewords ubica los datos en zigzag, de a dos columnas desde la esquina inferior derecha
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // La columna 6 es de sincronización
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.Modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask invierte los módulos de datos según el patrón de máscara
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.Modules[y][x] = !c.Modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike son las secuencias 1:1:3:1:1 con cuatro módulos claros a un lado (regla 3)
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty evalúa las cuatro reglas de penalización de la norma para elegir la máscara
+func (c *Code) penalty() int {
+	n := c.Size
+	at := func(row, col int, transpose bool) bool {
+		if transpose {
+			return c.Modules[col][row]
+		}
+		return c.Modules[row][col]
+	}
+
+	total, dark := 0, 0
+	for _, transpose := range []bool{false, true} {
+		for i := 0; i < n; i++ {
+			// Regla 1: cinco o más módulos iguales seguidos
+			run := 1
+			for j := 1; j <= n; j++ {
+				if j < n && at(i, j, transpose) == at(i, j-1, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					total += run - 2
+				}
+				run = 1
+			}
+			// Regla 3: patrones parecidos a los de posición
+			for j := 0; j+11 <= n; j++ {
+				for _, p := range finderLike {
+					match := true
+					for k, v := range p {
+						if at(i, j+k, transpose) != v {
+							match = false
+							break
+						}
+					}
+					if match {
+						total += 40
+					}
+				}
+			}
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.Modules[y][x] {
+				dark++
+			}
+			// Regla 2: bloques de 2x2 del mismo color
+			if x+1 < n && y+1 < n {
+				v := c.Modules[y][x]
+				if c.Modules[y][x+1] == v && c.Modules[y+1][x] == v && c.Modules[y+1][x+1] == v {
+					total += 3
+				}
+			}
+		}
+	}
+	// Regla 4: proporción de módulos oscuros lejos del 50%
+	percent := dark * 100 / (n * n)
+	total += abs(percent-50) / 5 * 10
+	return total
+}
+
+// PNG dibuja el código con scale píxeles por módulo y el margen de cuatro módulos que pide la norma
+func (c *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	const quiet = 4
+	side := (c.Size + 2*quiet) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quiet)*scale+dx, (y+quiet)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
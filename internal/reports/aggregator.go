@@ -0,0 +1,141 @@
+package reports
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+const (
+	// AggregatorInterval es cada cuánto se actualizan los rollups horarios
+	AggregatorInterval = 5 * time.Minute
+
+	// lookback son las horas que se recalculan en cada pasada: las llamadas
+	// recientes todavía reciben su disposition final a través del batcher
+	lookback = 3 * time.Hour
+
+	// chunk limita cuánto historial se agrega por consulta al hacer el backfill inicial
+	chunk = 24 * time.Hour
+)
+
+// Aggregator mantiene apicall_call_rollup_hourly (llamadas por hora, proyecto,
+// campaña y disposition) para que los reportes históricos no recorran el log.
+type Aggregator struct {
+	repo     *database.Repository
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewAggregator crea un nuevo agregador de rollups
+func NewAggregator(repo *database.Repository) *Aggregator {
+	return &Aggregator{
+		repo:     repo,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el agregador
+func (a *Aggregator) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running {
+		return
+	}
+	a.running = true
+	a.wg.Add(1)
+	go a.run()
+	log.Println("[Reports] Agregador de rollups iniciado")
+}
+
+// Stop detiene el agregador
+func (a *Aggregator) Stop() {
+	a.mu.Lock()
+	if !a.running {
+		a.mu.Unlock()
+		return
+	}
+	a.running = false
+	a.mu.Unlock()
+
+	close(a.stopChan)
+	a.wg.Wait()
+	log.Println("[Reports] Agregador de rollups detenido")
+}
+
+func (a *Aggregator) run() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(AggregatorInterval)
+	defer ticker.Stop()
+
+	a.dispatch()
+	for {
+		select {
+		case <-a.stopChan:
+			return
+		case <-ticker.C:
+			a.dispatch()
+		}
+	}
+}
+
+// dispatch recalcula desde el watermark (menos lookback) hasta la hora actual inclusive
+func (a *Aggregator) dispatch() {
+	if !leader.IsLeader() {
+		return
+	}
+	now := time.Now()
+	end := now.Truncate(time.Hour).Add(time.Hour)
+
+	from, err := a.start(now)
+	if err != nil {
+		log.Printf("[Reports] %v", err)
+		return
+	}
+	if from == nil {
+		return // Sin logs todavía
+	}
+
+	for start := *from; start.Before(end); start = start.Add(chunk) {
+		select {
+		case <-a.stopChan:
+			return
+		default:
+		}
+
+		stop := start.Add(chunk)
+		if stop.After(end) {
+			stop = end
+		}
+		if _, err := a.repo.RefreshCallRollups(start, stop); err != nil {
+			log.Printf("[Reports] %v", err)
+			return
+		}
+	}
+}
+
+// start es la primera hora a recalcular: el watermark menos lookback, o el log más antiguo en el primer arranque
+func (a *Aggregator) start(now time.Time) (*time.Time, error) {
+	watermark, err := a.repo.GetRollupWatermark()
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		from := watermark.Add(-lookback).Truncate(time.Hour)
+		return &from, nil
+	}
+
+	first, err := a.repo.GetFirstCallLogTime()
+	if err != nil || first == nil {
+		return nil, err
+	}
+	from := first.Truncate(time.Hour)
+	log.Printf("[Reports] Backfill de rollups desde %s", from.Format("2006-01-02 15:04"))
+	return &from, nil
+}
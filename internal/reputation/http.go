@@ -0,0 +1,123 @@
+package reputation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"apicall/internal/config"
+)
+
+func init() {
+	Register("http", newHTTP)
+}
+
+// httpProvider consulta una API JSON genérica: GET a la URL con {number} reemplazado y la etiqueta y
+// el puntaje tomados de los campos configurados de la respuesta
+type httpProvider struct {
+	url        string
+	apiKey     string
+	labelField []string
+	scoreField []string
+}
+
+func newHTTP(cfg config.ReputationConfig) (Provider, error) {
+	u, err := url.Parse(strings.ReplaceAll(cfg.URL, "{number}", "0"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url debe ser http(s) e incluir {number}")
+	}
+	label, score := cfg.LabelField, cfg.ScoreField
+	if label == "" {
+		label = "label"
+	}
+	if score == "" {
+		score = "score"
+	}
+	return &httpProvider{
+		url:        cfg.URL,
+		apiKey:     cfg.APIKey,
+		labelField: strings.Split(label, "."),
+		scoreField: strings.Split(score, "."),
+	}, nil
+}
+
+func (h *httpProvider) Lookup(client *http.Client, number string) (*Result, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(h.url, "{number}", url.QueryEscape(number)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error armando consulta: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// El error de url incluye la URL (con posibles credenciales): solo se conserva la causa
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("error consultando reputación: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo respuesta: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("respuesta %d: %s", resp.StatusCode, truncate(bytes.TrimSpace(body), 200))
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("respuesta no es JSON: %w", err)
+	}
+	res := &Result{}
+	if v, ok := field(data, h.labelField); ok {
+		switch l := v.(type) {
+		case string:
+			res.Label = l
+		case bool:
+			res.Label = strconv.FormatBool(l) // ej: {"spam": true}
+		default:
+			res.Label = fmt.Sprint(l)
+		}
+	}
+	if v, ok := field(data, h.scoreField); ok {
+		switch n := v.(type) {
+		case float64:
+			res.Score = &n
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				res.Score = &f
+			}
+		}
+	}
+	return res, nil
+}
+
+// field recorre la ruta de campos (a.b.c) en un objeto JSON
+func field(data interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if data, ok = obj[key]; !ok || data == nil {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return strings.ToValidUTF8(string(b[:n]), "") + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,189 @@
+// Package reputation consulta periódicamente en una API de reputación cómo se etiquetan los Caller IDs
+// presentados (spam, fraude, limpio). Cada API es un Provider registrado con Register; el resultado de
+// la última consulta de cada número queda en apicall_cid_reputation.
+package reputation
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+const (
+	// DefaultDays son los días entre consultas de un mismo Caller ID si reputation.days no se define
+	DefaultDays = 7
+	// DefaultMaxLookups son las consultas por pasada si reputation.max_lookups no se define
+	DefaultMaxLookups = 200
+
+	// checkInterval es cada cuánto se buscan Caller IDs sin consultar o con la consulta vencida
+	checkInterval = time.Hour
+	// requestTimeout limita cada consulta a la API
+	requestTimeout = 15 * time.Second
+)
+
+// Result es la etiqueta que el proveedor asigna a un número
+type Result struct {
+	Label string
+	Score *float64 // nil = el proveedor no informa puntaje
+}
+
+// Provider consulta la reputación de un número
+type Provider interface {
+	Lookup(client *http.Client, number string) (*Result, error)
+}
+
+// Factory crea el Provider a partir de la configuración
+type Factory func(cfg config.ReputationConfig) (Provider, error)
+
+var factories = map[string]Factory{}
+
+// Register agrega un proveedor (http se registra en este paquete)
+func Register(name string, f Factory) {
+	factories[name] = f
+}
+
+// Checker consulta la reputación de los Caller IDs presentados en los últimos días. Cada número se
+// vuelve a consultar cuando su resultado tiene más de reputation.days días.
+type Checker struct {
+	repo     *database.Repository
+	cfg      config.ReputationConfig
+	provider Provider
+	client   *http.Client
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// New crea el checker del proveedor configurado (nil si reputation.provider está vacío)
+func New(repo *database.Repository, cfg config.ReputationConfig) (*Checker, error) {
+	if cfg.Provider == "" {
+		return nil, nil
+	}
+	f, ok := factories[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("reputation.provider desconocido: %s", cfg.Provider)
+	}
+	provider, err := f(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("reputation: %w", err)
+	}
+	return &Checker{
+		repo:     repo,
+		cfg:      cfg,
+		provider: provider,
+		client:   &http.Client{Timeout: requestTimeout},
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start inicia el checker
+func (c *Checker) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.running {
+		return
+	}
+	c.running = true
+	c.wg.Add(1)
+	go c.run()
+	log.Printf("[Reputation] Consultas de reputación iniciadas (%s, cada %d días)", c.cfg.Provider, c.days())
+}
+
+// Stop detiene el checker
+func (c *Checker) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	c.mu.Unlock()
+
+	close(c.stopChan)
+	c.wg.Wait()
+	log.Println("[Reputation] Consultas de reputación detenidas")
+}
+
+func (c *Checker) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.check()
+		}
+	}
+}
+
+func (c *Checker) days() int {
+	if c.cfg.Days <= 0 {
+		return DefaultDays
+	}
+	return c.cfg.Days
+}
+
+func (c *Checker) stopped() bool {
+	select {
+	case <-c.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// check consulta los Caller IDs presentados en los últimos reputation.days días cuya reputación no
+// se consultó en ese período (como mucho max_lookups por pasada, los más antiguos primero)
+func (c *Checker) check() {
+	if !leader.IsLeader() {
+		return
+	}
+	limit := c.cfg.MaxLookups
+	if limit <= 0 {
+		limit = DefaultMaxLookups
+	}
+	cutoff := time.Now().AddDate(0, 0, -c.days())
+	cids, err := c.repo.GetCIDsToCheck(cutoff, cutoff, limit)
+	if err != nil {
+		log.Printf("[Reputation] %v", err)
+		return
+	}
+
+	var failed int
+	for _, cid := range cids {
+		if c.stopped() {
+			return
+		}
+		rep := &database.CIDReputation{
+			CallerID:  cid,
+			Provider:  c.cfg.Provider,
+			CheckedAt: time.Now(),
+		}
+		res, err := c.provider.Lookup(c.client, cid)
+		if err != nil {
+			failed++
+			rep.Error = err.Error()
+		} else {
+			rep.Label, rep.Score = res.Label, res.Score
+		}
+		if err := c.repo.SaveCIDReputation(rep); err != nil {
+			log.Printf("[Reputation] %v", err)
+			return
+		}
+	}
+	if len(cids) > 0 {
+		log.Printf("[Reputation] %d Caller IDs consultados (%d con error)", len(cids), failed)
+	}
+}
@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"apicall/internal/database"
+)
+
+// archive es un CSV comprimido que recibe los registros antes de purgarlos
+type archive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	csv  *csv.Writer
+	rows int
+}
+
+// newArchive crea <dir>/<proyecto_id>/<name>_<timestamp>.csv.gz con la cabecera indicada
+func newArchive(dir string, proyectoID int, name string, header []string) (*archive, error) {
+	projectDir := filepath.Join(dir, strconv.Itoa(proyectoID))
+	if err := os.MkdirAll(projectDir, 0750); err != nil {
+		return nil, fmt.Errorf("error creando directorio de archivo: %w", err)
+	}
+
+	path := filepath.Join(projectDir, fmt.Sprintf("%s_%s.csv.gz", name, time.Now().Format("20060102T150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creando archivo %s: %w", path, err)
+	}
+
+	a := &archive{path: path, file: f, gz: gzip.NewWriter(f)}
+	a.csv = csv.NewWriter(a.gz)
+	if err := a.csv.Write(header); err != nil {
+		a.abort()
+		return nil, fmt.Errorf("error escribiendo cabecera: %w", err)
+	}
+	return a, nil
+}
+
+// write agrega filas y las lleva a disco: solo después se eliminan de la base de datos
+func (a *archive) write(records [][]string) error {
+	if err := a.csv.WriteAll(records); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", a.path, err)
+	}
+	if err := a.gz.Flush(); err != nil {
+		return fmt.Errorf("error comprimiendo %s: %w", a.path, err)
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("error sincronizando %s: %w", a.path, err)
+	}
+	a.rows += len(records)
+	return nil
+}
+
+// close cierra el archivo; si no recibió filas lo elimina y devuelve ""
+func (a *archive) close() (string, error) {
+	a.csv.Flush()
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return "", fmt.Errorf("error cerrando %s: %w", a.path, err)
+	}
+	if err := a.file.Close(); err != nil {
+		return "", fmt.Errorf("error cerrando %s: %w", a.path, err)
+	}
+	if a.rows == 0 {
+		os.Remove(a.path)
+		return "", nil
+	}
+	return a.path, nil
+}
+
+func (a *archive) abort() {
+	a.gz.Close()
+	a.file.Close()
+	os.Remove(a.path)
+}
+
+// uploadS3 copia el archivo a s3URI/<proyecto_id>/ con el aws CLI y borra la copia local
+func uploadS3(path, s3URI string, proyectoID int) (string, error) {
+	dest := fmt.Sprintf("%s/%d/%s", s3URI, proyectoID, filepath.Base(path))
+	out, err := exec.Command("aws", "s3", "cp", "--only-show-errors", path, dest).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error subiendo %s a S3: %v (%s)", path, err, string(out))
+	}
+	os.Remove(path)
+	return dest, nil
+}
+
+var callLogHeader = []string{
+	"id", "proyecto_id", "campaign_id", "telefono", "status", "disposition", "dtmf_marcado", "dtmf_capturado",
+	"interacciono", "duracion", "uniqueid", "caller_id_used", "troncal", "external_ref", "variables", "created_at",
+}
+
+func callLogRecord(l database.CallLog) []string {
+	return []string{
+		strconv.FormatInt(l.ID, 10), strconv.Itoa(l.ProyectoID), intPtr(l.CampaignID), l.Telefono, l.Status,
+		l.Disposition, l.DTMFMarcado, strPtr(l.DTMFCapturado), strconv.FormatBool(l.Interacciono),
+		strconv.Itoa(l.Duracion), l.Uniqueid, l.CallerIDUsed, l.Troncal, strPtr(l.ExternalRef), strPtr(l.Variables),
+		l.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+var contactHeader = []string{
+	"id", "campaign_id", "telefono", "estado", "resultado", "intentos", "ultimo_intento", "datos_adicionales", "created_at",
+}
+
+func contactRecord(c database.CampaignContact) []string {
+	ultimo := ""
+	if c.UltimoIntento != nil {
+		ultimo = c.UltimoIntento.Format(time.RFC3339)
+	}
+	return []string{
+		strconv.FormatInt(c.ID, 10), strconv.Itoa(c.CampaignID), c.Telefono, c.Estado, strPtr(c.Resultado),
+		strconv.Itoa(c.Intentos), ultimo, strPtr(c.DatosAdicionales), c.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func strPtr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func intPtr(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
@@ -0,0 +1,336 @@
+package retention
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"apicall/internal/config"
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+// batchSize es cuántos registros se archivan y eliminan por consulta
+const batchSize = 1000
+
+// Worker purga (y opcionalmente archiva) los logs, contactos y grabaciones
+// anteriores a retention_days de cada proyecto. Cada pasada por proyecto
+// queda registrada en apicall_retention_runs.
+type Worker struct {
+	repo     *database.Repository
+	cfg      config.RetentionConfig
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewWorker crea un nuevo worker de retención
+func NewWorker(repo *database.Repository, cfg config.RetentionConfig) *Worker {
+	return &Worker{
+		repo:     repo,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el worker
+func (w *Worker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.running {
+		return
+	}
+	w.running = true
+	w.wg.Add(1)
+	go w.run()
+	if w.cfg.DryRun {
+		log.Println("[Retention] Worker de retención iniciado (dry-run: no se elimina nada)")
+	} else {
+		log.Println("[Retention] Worker de retención iniciado")
+	}
+}
+
+// Stop detiene el worker
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = false
+	w.mu.Unlock()
+
+	close(w.stopChan)
+	w.wg.Wait()
+	log.Println("[Retention] Worker de retención detenido")
+}
+
+func (w *Worker) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.RunInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+			w.dispatch()
+		}
+	}
+}
+
+func (w *Worker) stopped() bool {
+	select {
+	case <-w.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch aplica la retención a cada proyecto con retention_days > 0
+func (w *Worker) dispatch() {
+	if !leader.IsLeader() {
+		return
+	}
+	proyectos, err := w.repo.ListProyectos()
+	if err != nil {
+		log.Printf("[Retention] %v", err)
+		return
+	}
+
+	for _, p := range proyectos {
+		if p.RetentionDays <= 0 {
+			continue
+		}
+		if w.stopped() {
+			return
+		}
+		w.purgeProyecto(p)
+	}
+}
+
+func (w *Worker) purgeProyecto(p database.Proyecto) {
+	run := &database.RetentionRun{
+		ProyectoID: p.ID,
+		DryRun:     w.cfg.DryRun,
+		Cutoff:     time.Now().AddDate(0, 0, -p.RetentionDays),
+		StartedAt:  time.Now(),
+	}
+
+	var files []string
+	var errs []string
+	if w.cfg.DryRun {
+		w.count(run, &errs)
+	} else {
+		files = append(files, w.purgeCallLogs(run, &errs)...)
+		files = append(files, w.purgeContacts(run, &errs)...)
+	}
+	run.Recordings = w.purgeRecordings(p.ID, run.Cutoff, &errs)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Archivos = strings.Join(files, ",")
+	run.Error = strings.Join(errs, "; ")
+	if len(run.Error) > 500 {
+		run.Error = run.Error[:500]
+	}
+
+	if run.CallLogs+run.Contacts+run.Recordings > 0 || run.Error != "" {
+		verb := "eliminados"
+		if run.DryRun {
+			verb = "a eliminar (dry-run)"
+		}
+		log.Printf("[Retention] Proyecto %d (%d días): %d logs, %d contactos, %d grabaciones %s",
+			p.ID, p.RetentionDays, run.CallLogs, run.Contacts, run.Recordings, verb)
+	}
+	if err := w.repo.CreateRetentionRun(run); err != nil {
+		log.Printf("[Retention] %v", err)
+	}
+}
+
+// count llena el reporte sin eliminar nada
+func (w *Worker) count(run *database.RetentionRun, errs *[]string) {
+	var err error
+	if run.CallLogs, err = w.repo.CountExpiredCallLogs(run.ProyectoID, run.Cutoff); err != nil {
+		*errs = append(*errs, err.Error())
+	}
+	if run.Contacts, err = w.repo.CountExpiredContacts(run.ProyectoID, run.Cutoff); err != nil {
+		*errs = append(*errs, err.Error())
+	}
+}
+
+// purgeCallLogs archiva y elimina los logs vencidos por lotes
+func (w *Worker) purgeCallLogs(run *database.RetentionRun, errs *[]string) []string {
+	var arc *archive
+	if w.cfg.ArchiveDir != "" {
+		var err error
+		if arc, err = newArchive(w.cfg.ArchiveDir, run.ProyectoID, "call_log", callLogHeader); err != nil {
+			*errs = append(*errs, err.Error())
+			return nil // Sin archivo no se purga
+		}
+	}
+
+	for !w.stopped() {
+		logs, err := w.repo.GetExpiredCallLogs(run.ProyectoID, run.Cutoff, batchSize)
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			break
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		ids := make([]int64, len(logs))
+		records := make([][]string, len(logs))
+		for i, l := range logs {
+			ids[i] = l.ID
+			records[i] = callLogRecord(l)
+		}
+		if arc != nil {
+			if err := arc.write(records); err != nil {
+				*errs = append(*errs, err.Error())
+				break
+			}
+		}
+		n, err := w.repo.DeleteCallLogs(ids)
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			break
+		}
+		if n == 0 {
+			break
+		}
+		run.CallLogs += int(n)
+	}
+
+	return w.finishArchive(arc, run.ProyectoID, errs)
+}
+
+// purgeContacts archiva y elimina los contactos vencidos por lotes
+func (w *Worker) purgeContacts(run *database.RetentionRun, errs *[]string) []string {
+	var arc *archive
+	if w.cfg.ArchiveDir != "" {
+		var err error
+		if arc, err = newArchive(w.cfg.ArchiveDir, run.ProyectoID, "contacts", contactHeader); err != nil {
+			*errs = append(*errs, err.Error())
+			return nil
+		}
+	}
+
+	for !w.stopped() {
+		contacts, err := w.repo.GetExpiredContacts(run.ProyectoID, run.Cutoff, batchSize)
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			break
+		}
+		if len(contacts) == 0 {
+			break
+		}
+
+		ids := make([]int64, len(contacts))
+		records := make([][]string, len(contacts))
+		for i, c := range contacts {
+			ids[i] = c.ID
+			records[i] = contactRecord(c)
+		}
+		if arc != nil {
+			if err := arc.write(records); err != nil {
+				*errs = append(*errs, err.Error())
+				break
+			}
+		}
+		n, err := w.repo.DeleteCampaignContacts(ids)
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			break
+		}
+		if n == 0 {
+			break
+		}
+		run.Contacts += int(n)
+	}
+
+	return w.finishArchive(arc, run.ProyectoID, errs)
+}
+
+// finishArchive cierra el archivo y lo sube a S3 si está configurado
+func (w *Worker) finishArchive(arc *archive, proyectoID int, errs *[]string) []string {
+	if arc == nil {
+		return nil
+	}
+	path, err := arc.close()
+	if err != nil {
+		*errs = append(*errs, err.Error())
+		return nil
+	}
+	if path == "" {
+		return nil
+	}
+	if w.cfg.S3URI != "" {
+		dest, err := uploadS3(path, strings.TrimSuffix(w.cfg.S3URI, "/"), proyectoID)
+		if err != nil {
+			*errs = append(*errs, err.Error()) // La copia local se conserva
+			return []string{path}
+		}
+		return []string{dest}
+	}
+	return []string{path}
+}
+
+// purgeRecordings elimina las grabaciones de <recordings_path>/<proyecto_id>/ modificadas antes de cutoff.
+// Con archive_dir se mueven a <archive_dir>/<proyecto_id>/recordings/ en lugar de eliminarse.
+func (w *Worker) purgeRecordings(proyectoID int, cutoff time.Time, errs *[]string) int {
+	if w.cfg.RecordingsPath == "" {
+		return 0
+	}
+	dir := filepath.Join(w.cfg.RecordingsPath, strconv.Itoa(proyectoID))
+
+	archiveDir := ""
+	if w.cfg.ArchiveDir != "" && !w.cfg.DryRun {
+		archiveDir = filepath.Join(w.cfg.ArchiveDir, strconv.Itoa(proyectoID), "recordings")
+		if err := os.MkdirAll(archiveDir, 0750); err != nil {
+			*errs = append(*errs, "error creando directorio de grabaciones archivadas: "+err.Error())
+			return 0
+		}
+	}
+
+	removed := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if w.cfg.DryRun {
+			removed++
+			return nil
+		}
+		if archiveDir != "" {
+			rel, _ := filepath.Rel(dir, path)
+			if err := os.Rename(path, filepath.Join(archiveDir, strings.ReplaceAll(rel, string(filepath.Separator), "_"))); err != nil {
+				return err
+			}
+		} else if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		*errs = append(*errs, "error purgando grabaciones: "+err.Error())
+	}
+	return removed
+}
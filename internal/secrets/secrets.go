@@ -0,0 +1,139 @@
+// Package secrets cifra en reposo las credenciales guardadas en la BD (secretos SIP de las troncales)
+// con AES-256-GCM. Los valores cifrados llevan el prefijo "enc:v1:"; los que no lo tienen son texto
+// plano de versiones anteriores y se devuelven tal cual, así la migración puede hacerse en caliente.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"apicall/internal/config"
+)
+
+// prefix marca los valores cifrados (la versión permite cambiar el esquema sin ambigüedad)
+const prefix = "enc:v1:"
+
+var (
+	mu   sync.RWMutex
+	aead cipher.AEAD // nil = sin clave configurada (los secretos se guardan en texto plano)
+)
+
+// Configure carga la clave de security.secrets_key o security.secrets_key_file (32 bytes en base64 o
+// hex). Sin clave el cifrado queda desactivado.
+func Configure(cfg config.SecurityConfig) error {
+	raw := strings.TrimSpace(cfg.SecretsKey)
+	if raw == "" && cfg.SecretsKeyFile != "" {
+		data, err := os.ReadFile(cfg.SecretsKeyFile)
+		if err != nil {
+			return fmt.Errorf("error leyendo security.secrets_key_file: %w", err)
+		}
+		raw = strings.TrimSpace(string(data))
+	}
+	if raw == "" {
+		mu.Lock()
+		aead = nil
+		mu.Unlock()
+		return nil
+	}
+
+	key, err := parseKey(raw)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	aead = gcm
+	mu.Unlock()
+	return nil
+}
+
+// parseKey acepta la clave de 32 bytes en hex (64 caracteres) o en base64
+func parseKey(raw string) ([]byte, error) {
+	if len(raw) == 64 {
+		if key, err := hex.DecodeString(raw); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("la clave de cifrado debe ser de 32 bytes en base64 o hex (openssl rand -base64 32)")
+	}
+	return key, nil
+}
+
+// Enabled indica si hay una clave de cifrado configurada
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+// IsEncrypted indica si el valor ya está cifrado
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt cifra un secreto para guardarlo. Los valores vacíos o ya cifrados con la clave actual se
+// devuelven sin cambios, y sin clave configurada se guarda el texto plano. Un valor que solo empieza
+// por "enc:v1:" pero no descifra es texto del usuario y se cifra como cualquier otro.
+func Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return plain, nil
+	}
+	mu.RLock()
+	gcm := aead
+	mu.RUnlock()
+	if gcm == nil {
+		if IsEncrypted(plain) {
+			return "", fmt.Errorf("el secreto no puede empezar por %q sin clave configurada (security.secrets_key)", prefix)
+		}
+		return plain, nil
+	}
+	if IsEncrypted(plain) {
+		if _, err := Decrypt(plain); err == nil {
+			return plain, nil
+		}
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt devuelve el secreto en claro (los valores en texto plano se devuelven tal cual)
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	mu.RLock()
+	gcm := aead
+	mu.RUnlock()
+	if gcm == nil {
+		return "", fmt.Errorf("secreto cifrado sin clave configurada (security.secrets_key)")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("secreto cifrado inválido")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("no se pudo descifrar el secreto (¿clave distinta?)")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,316 @@
+// Package sftp implementa el subconjunto del protocolo SFTP v3 que necesita el spooler:
+// escribir archivos, renombrarlos, borrarlos y crear directorios sobre una conexión SSH.
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Tipos de paquete (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpWrite   = 6
+	fxpRemove  = 13
+	fxpMkdir   = 14
+	fxpRename  = 18
+	fxpStatus  = 101
+	fxpHandle  = 102
+)
+
+// Flags de OPEN y ATTRS
+const (
+	fxfWrite  = 0x02
+	fxfCreat  = 0x08
+	fxfTrunc  = 0x10
+	attrPerms = 0x04
+)
+
+const (
+	protocolVersion = 3
+	maxWriteChunk   = 32 * 1024 // Tamaño de WRITE que todos los servidores aceptan
+)
+
+// ErrClosed se devuelve cuando la sesión SFTP terminó (el llamador debe reconectar)
+var ErrClosed = errors.New("sesión SFTP cerrada")
+
+// StatusError es un SSH_FXP_STATUS distinto de OK
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftp status %d: %s", e.Code, e.Message)
+}
+
+type response struct {
+	typ  byte
+	data []byte
+}
+
+// Client es una sesión SFTP. Es seguro para uso concurrente: las peticiones se
+// envían en paralelo y las respuestas se asocian por ID.
+type Client struct {
+	session *ssh.Session
+	w       io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]chan response
+	err     error // Motivo del cierre (nil = activa)
+}
+
+// NewClient abre el subsistema sftp sobre una conexión SSH y negocia la versión
+func NewClient(conn *ssh.Client) (*Client, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo sesión SSH: %w", err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("subsistema sftp no disponible: %w", err)
+	}
+
+	c := &Client{session: session, w: w, pending: make(map[uint32]chan response)}
+
+	// INIT / VERSION (sin ID de petición)
+	if err := c.writePacket(fxpInit, appendUint32(nil, protocolVersion)); err != nil {
+		session.Close()
+		return nil, err
+	}
+	typ, data, err := readPacket(r)
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("error negociando sftp: %w", err)
+	}
+	if typ != fxpVersion || len(data) < 4 {
+		session.Close()
+		return nil, fmt.Errorf("respuesta inesperada al INIT sftp: %d", typ)
+	}
+
+	go c.readLoop(r)
+	return c, nil
+}
+
+// Close cierra la sesión SFTP (la conexión SSH queda a cargo del llamador)
+func (c *Client) Close() error {
+	c.fail(ErrClosed)
+	return c.session.Close()
+}
+
+// Err devuelve el motivo por el que la sesión terminó, o nil si sigue activa
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// WriteFile crea (o trunca) path con el contenido indicado
+func (c *Client) WriteFile(path string, data []byte, perm uint32) error {
+	payload := appendString(nil, path)
+	payload = appendUint32(payload, fxfWrite|fxfCreat|fxfTrunc)
+	payload = appendUint32(payload, attrPerms)
+	payload = appendUint32(payload, perm)
+
+	resp, err := c.request(fxpOpen, payload)
+	if err != nil {
+		return err
+	}
+	if resp.typ != fxpHandle {
+		return statusOrUnexpected(resp)
+	}
+	handle, _, ok := readString(resp.data)
+	if !ok {
+		return fmt.Errorf("handle sftp inválido")
+	}
+
+	var writeErr error
+	for offset := 0; offset < len(data); {
+		end := min(offset+maxWriteChunk, len(data))
+		req := appendString(nil, string(handle))
+		req = binary.BigEndian.AppendUint64(req, uint64(offset))
+		req = appendString(req, string(data[offset:end]))
+		if writeErr = c.expectOK(fxpWrite, req); writeErr != nil {
+			break
+		}
+		offset = end
+	}
+
+	closeErr := c.expectOK(fxpClose, appendString(nil, string(handle)))
+	if writeErr != nil {
+		return writeErr
+	}
+	return closeErr
+}
+
+// Rename renombra oldPath a newPath (en el mismo filesystem es atómico)
+func (c *Client) Rename(oldPath, newPath string) error {
+	return c.expectOK(fxpRename, appendString(appendString(nil, oldPath), newPath))
+}
+
+// Remove elimina un archivo
+func (c *Client) Remove(path string) error {
+	return c.expectOK(fxpRemove, appendString(nil, path))
+}
+
+// Mkdir crea un directorio (falla si ya existe)
+func (c *Client) Mkdir(path string, perm uint32) error {
+	payload := appendString(nil, path)
+	payload = appendUint32(payload, attrPerms)
+	payload = appendUint32(payload, perm)
+	return c.expectOK(fxpMkdir, payload)
+}
+
+func (c *Client) expectOK(typ byte, payload []byte) error {
+	resp, err := c.request(typ, payload)
+	if err != nil {
+		return err
+	}
+	return statusOrUnexpected(resp)
+}
+
+// request envía una petición con ID y espera su respuesta
+func (c *Client) request(typ byte, payload []byte) (response, error) {
+	ch := make(chan response, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return response{}, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.writePacket(typ, append(appendUint32(nil, id), payload...)); err != nil {
+		c.fail(err)
+		return response{}, err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return response{}, c.Err()
+	}
+	return resp, nil
+}
+
+func (c *Client) writePacket(typ byte, payload []byte) error {
+	buf := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)+1))
+	buf[4] = typ
+	buf = append(buf, payload...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.w.Write(buf)
+	return err
+}
+
+// readLoop entrega cada respuesta a la petición que la espera
+func (c *Client) readLoop(r io.Reader) {
+	for {
+		typ, data, err := readPacket(r)
+		if err != nil {
+			c.fail(fmt.Errorf("%w: %v", ErrClosed, err))
+			return
+		}
+		if len(data) < 4 {
+			continue
+		}
+		id := binary.BigEndian.Uint32(data)
+
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		if ch != nil {
+			ch <- response{typ: typ, data: data[4:]}
+		}
+	}
+}
+
+// fail cierra la sesión lógica y libera a todas las peticiones en espera
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length == 0 || length > 256*1024 {
+		return 0, nil, fmt.Errorf("paquete sftp inválido (%d bytes)", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[4], data, nil
+}
+
+func statusOrUnexpected(resp response) error {
+	if resp.typ != fxpStatus {
+		return fmt.Errorf("respuesta sftp inesperada: %d", resp.typ)
+	}
+	if len(resp.data) < 4 {
+		return fmt.Errorf("status sftp inválido")
+	}
+	code := binary.BigEndian.Uint32(resp.data)
+	if code == 0 {
+		return nil
+	}
+	msg, _, _ := readString(resp.data[4:])
+	return &StatusError{Code: code, Message: string(msg)}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func readString(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,400 @@
+package sso
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"apicall/internal/config"
+)
+
+// ldapTimeout limita cada login contra el directorio (conexión, binds y búsqueda)
+const ldapTimeout = 10 * time.Second
+
+// Etiquetas BER de las operaciones LDAP usadas (RFC 4511)
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0A
+	berBoolean     = 0x01
+	berSequence    = 0x30
+
+	ldapBindRequest     = 0x60
+	ldapBindResponse    = 0x61
+	ldapUnbindRequest   = 0x42
+	ldapSearchRequest   = 0x63
+	ldapSearchEntry     = 0x64
+	ldapSearchDone      = 0x65
+	ldapSearchReference = 0x73
+
+	filterAnd      = 0xA0
+	filterEquality = 0xA3
+	authSimple     = 0x80
+
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+)
+
+// LDAP valida las contraseñas con un bind contra el directorio: busca el DN del usuario con la cuenta
+// de servicio y luego hace bind con ese DN y la contraseña ingresada
+type LDAP struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAP crea el backend LDAP (nil si no está configurado). La URL ya viene validada por config.
+func NewLDAP(cfg config.LDAPConfig) *LDAP {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.UserAttribute == "" {
+		cfg.UserAttribute = "uid"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "cn"
+	}
+	return &LDAP{cfg: cfg}
+}
+
+// Name identifica el backend
+func (l *LDAP) Name() string {
+	return SourceLDAP
+}
+
+// Authenticate valida usuario y contraseña y devuelve su nombre y grupos
+func (l *LDAP) Authenticate(username, password string) (*Identity, error) {
+	// Un bind con contraseña vacía es anónimo y el servidor lo acepta
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	c, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	if code, msg, err := c.bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+		return nil, err
+	} else if code != resultSuccess {
+		return nil, fmt.Errorf("bind de la cuenta de servicio rechazado (%d): %s", code, msg)
+	}
+
+	dn, attrs, err := c.findUser(l.cfg, username)
+	if err != nil {
+		return nil, err
+	}
+	if dn == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	code, msg, err := c.bind(dn, password)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case resultSuccess:
+	case resultInvalidCredentials:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("bind de %s rechazado (%d): %s", dn, code, msg)
+	}
+
+	id := &Identity{Source: SourceLDAP, Username: username, Groups: attrs[strings.ToLower(l.cfg.GroupAttribute)]}
+	if names := attrs[strings.ToLower(l.cfg.NameAttribute)]; len(names) > 0 {
+		id.FullName = names[0]
+	}
+	return id, nil
+}
+
+// ldapConn es una conexión al directorio
+type ldapConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	msgID int
+}
+
+func (l *LDAP) dial() (*ldapConn, error) {
+	u, _ := url.Parse(l.cfg.URL)
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "ldaps" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+	}
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if u.Scheme == "ldaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: l.cfg.InsecureSkipVerify,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error conectando a LDAP %s: %w", host, err)
+	}
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+	return &ldapConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *ldapConn) close() {
+	c.msgID++
+	c.conn.Write(berTLV(berSequence, berInt(berInteger, c.msgID), berTLV(ldapUnbindRequest)))
+	c.conn.Close()
+}
+
+// send envía una operación en un LDAPMessage con el siguiente messageID
+func (c *ldapConn) send(op []byte) error {
+	c.msgID++
+	_, err := c.conn.Write(berTLV(berSequence, berInt(berInteger, c.msgID), op))
+	return err
+}
+
+// bind hace un bind simple; devuelve el código de resultado y el mensaje de diagnóstico
+func (c *ldapConn) bind(dn, password string) (int, string, error) {
+	err := c.send(berTLV(ldapBindRequest,
+		berInt(berInteger, 3),
+		berTLV(berOctetString, []byte(dn)),
+		berTLV(authSimple, []byte(password)),
+	))
+	if err != nil {
+		return 0, "", fmt.Errorf("error enviando bind LDAP: %w", err)
+	}
+	tag, op, err := c.read()
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != ldapBindResponse {
+		return 0, "", fmt.Errorf("respuesta LDAP inesperada 0x%02x al bind", tag)
+	}
+	return ldapResult(op)
+}
+
+// findUser busca al usuario bajo base_dn; devuelve su DN (vacío si no existe o es ambiguo) y sus atributos
+func (c *ldapConn) findUser(cfg config.LDAPConfig, username string) (string, map[string][]string, error) {
+	filter := berTLV(filterEquality, berTLV(berOctetString, []byte(cfg.UserAttribute)), berTLV(berOctetString, []byte(username)))
+	if cfg.ObjectClass != "" {
+		filter = berTLV(filterAnd,
+			berTLV(filterEquality, berTLV(berOctetString, []byte("objectClass")), berTLV(berOctetString, []byte(cfg.ObjectClass))),
+			filter,
+		)
+	}
+	err := c.send(berTLV(ldapSearchRequest,
+		berTLV(berOctetString, []byte(cfg.BaseDN)),
+		berInt(berEnumerated, 2), // wholeSubtree
+		berInt(berEnumerated, 0), // neverDerefAliases
+		berInt(berInteger, 2),    // sizeLimit: con dos resultados el usuario es ambiguo
+		berInt(berInteger, int(ldapTimeout/time.Second)),
+		berTLV(berBoolean, []byte{0}),
+		filter,
+		berTLV(berSequence,
+			berTLV(berOctetString, []byte(cfg.GroupAttribute)),
+			berTLV(berOctetString, []byte(cfg.NameAttribute)),
+		),
+	))
+	if err != nil {
+		return "", nil, fmt.Errorf("error enviando búsqueda LDAP: %w", err)
+	}
+
+	var dn string
+	var attrs map[string][]string
+	entries := 0
+	for {
+		tag, op, err := c.read()
+		if err != nil {
+			return "", nil, err
+		}
+		switch tag {
+		case ldapSearchEntry:
+			entries++
+			if dn, attrs, err = parseEntry(op); err != nil {
+				return "", nil, err
+			}
+		case ldapSearchReference:
+		case ldapSearchDone:
+			code, msg, err := ldapResult(op)
+			if err != nil {
+				return "", nil, err
+			}
+			// 4 = sizeLimitExceeded: más de un usuario con ese nombre
+			if code != resultSuccess && code != 4 {
+				return "", nil, fmt.Errorf("búsqueda LDAP rechazada (%d): %s", code, msg)
+			}
+			if entries != 1 {
+				return "", nil, nil
+			}
+			return dn, attrs, nil
+		default:
+			return "", nil, fmt.Errorf("respuesta LDAP inesperada 0x%02x a la búsqueda", tag)
+		}
+	}
+}
+
+// read lee un LDAPMessage y devuelve la etiqueta y el contenido de su operación
+func (c *ldapConn) read() (byte, []byte, error) {
+	tag, msg, err := readTLV(c.r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error leyendo respuesta LDAP: %w", err)
+	}
+	if tag != berSequence {
+		return 0, nil, fmt.Errorf("mensaje LDAP inválido")
+	}
+	fields, err := berChildren(msg)
+	if err != nil || len(fields) < 2 {
+		return 0, nil, fmt.Errorf("mensaje LDAP inválido")
+	}
+	return fields[1].tag, fields[1].value, nil
+}
+
+// ldapResult interpreta un LDAPResult (resultCode, matchedDN, diagnosticMessage)
+func ldapResult(op []byte) (int, string, error) {
+	fields, err := berChildren(op)
+	if err != nil || len(fields) < 3 {
+		return 0, "", fmt.Errorf("resultado LDAP inválido")
+	}
+	return berToInt(fields[0].value), string(fields[2].value), nil
+}
+
+// parseEntry interpreta un SearchResultEntry (objectName y atributos)
+func parseEntry(op []byte) (string, map[string][]string, error) {
+	fields, err := berChildren(op)
+	if err != nil || len(fields) < 2 {
+		return "", nil, fmt.Errorf("entrada LDAP inválida")
+	}
+	attrs := make(map[string][]string)
+	list, err := berChildren(fields[1].value)
+	if err != nil {
+		return "", nil, fmt.Errorf("entrada LDAP inválida")
+	}
+	for _, a := range list {
+		parts, err := berChildren(a.value)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+		// Los nombres de atributo no distinguen mayúsculas (memberOf, memberof)
+		name := strings.ToLower(string(parts[0].value))
+		vals, _ := berChildren(parts[1].value)
+		for _, v := range vals {
+			attrs[name] = append(attrs[name], string(v.value))
+		}
+	}
+	return string(fields[0].value), attrs, nil
+}
+
+// berField es un elemento BER ya leído
+type berField struct {
+	tag   byte
+	value []byte
+}
+
+// berTLV codifica un elemento con la etiqueta y la concatenación de los contenidos
+func berTLV(tag byte, contents ...[]byte) []byte {
+	var value []byte
+	for _, c := range contents {
+		value = append(value, c...)
+	}
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xFFFF:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// berInt codifica un entero (INTEGER o ENUMERATED) no negativo
+func berInt(tag byte, n int) []byte {
+	b := []byte{byte(n)}
+	for n >>= 8; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return berTLV(tag, b)
+}
+
+func berToInt(b []byte) int {
+	n := 0
+	for _, v := range b {
+		n = n<<8 | int(v)
+	}
+	return n
+}
+
+// readTLV lee un elemento BER completo del stream
+func readTLV(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7F)
+		if n == 0 || n > 4 {
+			return 0, nil, errors.New("largo BER no soportado")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return 0, nil, err
+	}
+	return tag, value, nil
+}
+
+// berChildren separa el contenido de un elemento construido en sus elementos
+func berChildren(b []byte) ([]berField, error) {
+	var fields []berField
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("elemento BER truncado")
+		}
+		tag, length, header := b[0], int(b[1]), 2
+		if b[1]&0x80 != 0 {
+			n := int(b[1] & 0x7F)
+			if n == 0 || n > 4 || len(b) < 2+n {
+				return nil, errors.New("largo BER no soportado")
+			}
+			length = 0
+			for _, v := range b[2 : 2+n] {
+				length = length<<8 | int(v)
+			}
+			header += n
+		}
+		if len(b) < header+length {
+			return nil, errors.New("elemento BER truncado")
+		}
+		fields = append(fields, berField{tag: tag, value: b[header : header+length]})
+		b = b[header+length:]
+	}
+	return fields, nil
+}
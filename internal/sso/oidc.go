@@ -0,0 +1,260 @@
+package sso
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"apicall/internal/auth"
+	"apicall/internal/config"
+)
+
+const (
+	// oidcTimeout limita cada consulta al proveedor
+	oidcTimeout = 10 * time.Second
+	// stateTTL es el tiempo para completar el login en el proveedor
+	stateTTL = 10 * time.Minute
+	// stateAudience marca el state firmado del login OIDC (no sirve como token de la API)
+	stateAudience = "apicall-oidc"
+)
+
+// OIDC implementa el flujo authorization code de OpenID Connect. El state va firmado (no se guarda
+// nada entre el redirect y el callback, así funciona con varias instancias detrás de un balanceador).
+type OIDC struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+// oidcDiscovery es el documento .well-known/openid-configuration (solo los campos usados)
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// oidcState es el contenido del state firmado
+type oidcState struct {
+	Nonce string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDC crea el proveedor OIDC (nil si no está configurado)
+func NewOIDC(cfg config.OIDCConfig) *OIDC {
+	if !cfg.Enabled() {
+		return nil
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if cfg.Scopes == "" {
+		cfg.Scopes = "openid profile email"
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return &OIDC{cfg: cfg, client: &http.Client{Timeout: oidcTimeout}}
+}
+
+// discover lee la configuración del proveedor (se reintenta hasta que responda y luego queda en memoria)
+func (o *OIDC) discover() (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := o.getJSON(o.cfg.Issuer+"/.well-known/openid-configuration", "", &d); err != nil {
+		return nil, fmt.Errorf("error leyendo la configuración OIDC de %s: %w", o.cfg.Issuer, err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, fmt.Errorf("la configuración OIDC de %s no tiene authorization_endpoint o token_endpoint", o.cfg.Issuer)
+	}
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// AuthURL devuelve la URL del proveedor a la que se redirige el navegador para iniciar sesión
+func (o *OIDC) AuthURL() (string, error) {
+	d, err := o.discover()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(b)
+	state, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &oidcState{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{stateAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(stateTTL)),
+		},
+	}).SignedString(auth.SecretKey)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.cfg.ClientID)
+	q.Set("redirect_uri", o.cfg.RedirectURL)
+	q.Set("scope", o.cfg.Scopes)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange completa el login: valida el state, canjea el código por los tokens y arma la identidad con
+// los claims del id_token y de userinfo. El id_token llega directo del proveedor por HTTPS, así que
+// se validan issuer, audiencia, vencimiento y nonce sin verificar la firma (OIDC Core 3.1.3.7).
+func (o *OIDC) Exchange(code, state string) (*Identity, error) {
+	st := &oidcState{}
+	token, err := jwt.ParseWithClaims(state, st, func(token *jwt.Token) (interface{}, error) {
+		return auth.SecretKey, nil
+	}, jwt.WithAudience(stateAudience))
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("state inválido o vencido")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("el proveedor no devolvió el código de autorización")
+	}
+	d, err := o.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.cfg.RedirectURL)
+	form.Set("client_id", o.cfg.ClientID)
+	form.Set("client_secret", o.cfg.ClientSecret)
+	resp, err := o.client.PostForm(d.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("error canjeando el código OIDC: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("el proveedor rechazó el código (HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return nil, fmt.Errorf("respuesta de token OIDC sin id_token")
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokens.IDToken, claims); err != nil {
+		return nil, fmt.Errorf("id_token inválido: %w", err)
+	}
+	if err := o.checkIDToken(d, claims, st.Nonce); err != nil {
+		return nil, err
+	}
+	// userinfo completa los claims que el proveedor no pone en el id_token
+	if d.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		var info map[string]interface{}
+		if err := o.getJSON(d.UserinfoEndpoint, tokens.AccessToken, &info); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	id := &Identity{Source: SourceOIDC, Groups: claimStrings(claims[o.cfg.GroupsClaim])}
+	id.Username, _ = claims[o.cfg.UsernameClaim].(string)
+	id.FullName, _ = claims["name"].(string)
+	if id.Username == "" {
+		return nil, fmt.Errorf("el id_token no tiene el claim %s", o.cfg.UsernameClaim)
+	}
+	return id, nil
+}
+
+// checkIDToken valida issuer, audiencia, vencimiento y nonce del id_token
+func (o *OIDC) checkIDToken(d *oidcDiscovery, claims jwt.MapClaims, nonce string) error {
+	issuer := d.Issuer
+	if issuer == "" {
+		issuer = o.cfg.Issuer
+	}
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return fmt.Errorf("id_token de otro issuer: %s", iss)
+	}
+	aud, _ := claims.GetAudience()
+	found := false
+	for _, a := range aud {
+		found = found || a == o.cfg.ClientID
+	}
+	if !found {
+		return fmt.Errorf("id_token emitido para otro cliente")
+	}
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil || exp.Before(time.Now()) {
+		return fmt.Errorf("id_token vencido")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return fmt.Errorf("nonce del id_token inválido")
+	}
+	return nil
+}
+
+// getJSON hace un GET (con bearer si se indica) y decodifica la respuesta
+func (o *OIDC) getJSON(u, bearer string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// claimStrings interpreta un claim de grupos: lista de textos o un texto separado por comas
+func claimStrings(v interface{}) []string {
+	var out []string
+	switch t := v.(type) {
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, strings.TrimPrefix(s, "/")) // Keycloak con ruta completa: /apicall-admins
+			}
+		}
+	case string:
+		for _, s := range strings.Split(t, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, strings.TrimPrefix(s, "/"))
+			}
+		}
+	}
+	return out
+}
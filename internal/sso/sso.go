@@ -0,0 +1,76 @@
+// Package sso autentica operadores contra proveedores de identidad externos (LDAP/Active Directory y
+// OpenID Connect). Los usuarios se crean o actualizan en la tabla users en cada login, con el rol que
+// corresponde a sus grupos; las sesiones, el bloqueo y la autorización siguen siendo los de apicall.
+package sso
+
+import (
+	"errors"
+	"strings"
+
+	"apicall/internal/config"
+)
+
+// Orígenes de los usuarios (users.auth_source)
+const (
+	SourceLocal = "local"
+	SourceLDAP  = "ldap"
+	SourceOIDC  = "oidc"
+)
+
+// ErrInvalidCredentials indica usuario inexistente o contraseña incorrecta en el proveedor
+var ErrInvalidCredentials = errors.New("credenciales inválidas")
+
+// Identity es el usuario autenticado por el proveedor
+type Identity struct {
+	Source   string
+	Username string
+	FullName string
+	Groups   []string
+}
+
+// PasswordBackend valida usuario y contraseña contra un proveedor externo (LDAP)
+type PasswordBackend interface {
+	Name() string
+	Authenticate(username, password string) (*Identity, error)
+}
+
+// rolePriority ordena los roles de menor a mayor privilegio
+var rolePriority = map[string]int{"viewer": 1, "supervisor": 2, "admin": 3, "superadmin": 4}
+
+// MapRole devuelve el rol de más privilegios entre los grupos mapeados, o el rol por defecto
+// (vacío = sin acceso). Un grupo coincide por su nombre completo (DN) o por su primer componente
+// (cn=apicall-admins,ou=groups,... coincide con "apicall-admins"), sin distinguir mayúsculas.
+func MapRole(groups []string, m config.RoleMapping) string {
+	role := ""
+	for _, g := range groups {
+		for _, name := range groupNames(g) {
+			for key, r := range m.Roles {
+				if strings.EqualFold(key, name) && rolePriority[r] > rolePriority[role] {
+					role = r
+				}
+			}
+		}
+	}
+	if role == "" {
+		return m.DefaultRole
+	}
+	return role
+}
+
+// groupNames devuelve el grupo y, si es un DN, el valor de su primer componente
+func groupNames(group string) []string {
+	names := []string{group}
+	first := strings.SplitN(group, ",", 2)[0]
+	if i := strings.Index(first, "="); i > 0 && first != group {
+		names = append(names, strings.TrimSpace(first[i+1:]))
+	}
+	return names
+}
+
+// TenantID devuelve la organización de los usuarios creados por el proveedor
+func TenantID(m config.RoleMapping) int {
+	if m.TenantID == 0 {
+		return 1
+	}
+	return m.TenantID
+}
@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"apicall/internal/database"
+	"apicall/internal/leader"
+)
+
+const (
+	// NotifierInterval es cada cuánto se buscan resultados pendientes de envío
+	NotifierInterval = 2 * time.Second
+	// MaxAttempts es la cantidad máxima de intentos de entrega por contacto
+	MaxAttempts = 5
+
+	batchSize      = 100
+	requestTimeout = 10 * time.Second
+)
+
+// ContactResultPayload es el cuerpo enviado al result_url de la campaña
+type ContactResultPayload struct {
+	Event            string          `json:"event"` // contact.result
+	CampaignID       int             `json:"campaign_id"`
+	ProyectoID       int             `json:"proyecto_id"`
+	ContactID        int64           `json:"contact_id"`
+	Telefono         string          `json:"telefono"`
+	Estado           string          `json:"estado"`
+	Resultado        string          `json:"resultado"`
+	Intentos         int             `json:"intentos"`
+	UltimoIntento    *time.Time      `json:"ultimo_intento"`
+	DatosAdicionales json.RawMessage `json:"datos_adicionales,omitempty"`
+	Call             *CallPayload    `json:"call,omitempty"`
+}
+
+// CallPayload resume la última llamada del contacto
+type CallPayload struct {
+	ID          int64     `json:"id"`
+	Uniqueid    string    `json:"uniqueid"`
+	Status      string    `json:"status"`
+	Disposition string    `json:"disposition"`
+	DTMF        string    `json:"dtmf"`
+	Capturado   string    `json:"dtmf_capturado,omitempty"`
+	Duracion    int       `json:"duracion"`
+	CallerID    string    `json:"caller_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ValidateURL valida un result_url (vacío = desactivado)
+func ValidateURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("result_url debe ser una URL http(s) válida")
+	}
+	if len(raw) > 500 {
+		return fmt.Errorf("result_url excede 500 caracteres")
+	}
+	return nil
+}
+
+// Notifier envía el resultado final de cada contacto al result_url de su campaña
+type Notifier struct {
+	repo     *database.Repository
+	client   *http.Client
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewNotifier crea un nuevo notificador de resultados
+func NewNotifier(repo *database.Repository) *Notifier {
+	return &Notifier{
+		repo:     repo,
+		client:   &http.Client{Timeout: requestTimeout},
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start inicia el notificador
+func (n *Notifier) Start() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.running {
+		return
+	}
+	n.running = true
+	n.wg.Add(1)
+	go n.run()
+	log.Println("[Webhook] Notificador de resultados iniciado")
+}
+
+// Stop detiene el notificador
+func (n *Notifier) Stop() {
+	n.mu.Lock()
+	if !n.running {
+		n.mu.Unlock()
+		return
+	}
+	n.running = false
+	n.mu.Unlock()
+
+	close(n.stopChan)
+	n.wg.Wait()
+	log.Println("[Webhook] Notificador de resultados detenido")
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(NotifierInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stopChan:
+			return
+		case <-ticker.C:
+			n.dispatch()
+		}
+	}
+}
+
+// dispatch envía un lote de resultados pendientes
+func (n *Notifier) dispatch() {
+	// Los resultados pendientes no se reservan: en HA solo la líder los envía
+	if !leader.IsLeader() {
+		return
+	}
+	results, err := n.repo.GetPendingContactResults(MaxAttempts, batchSize)
+	if err != nil {
+		log.Printf("[Webhook] Error obteniendo resultados pendientes: %v", err)
+		return
+	}
+
+	for _, res := range results {
+		select {
+		case <-n.stopChan:
+			return
+		default:
+		}
+
+		if err := n.send(res); err != nil {
+			attempt := res.NotifyAttempts + 1
+			if attempt >= MaxAttempts {
+				log.Printf("[Webhook] ERROR contacto %d (campaña %d): %v - se abandona tras %d intentos", res.Contact.ID, res.Contact.CampaignID, err, attempt)
+			} else {
+				log.Printf("[Webhook] WARN contacto %d (campaña %d): %v - reintento %d/%d", res.Contact.ID, res.Contact.CampaignID, err, attempt, MaxAttempts)
+			}
+			n.repo.DeferContactNotification(res.Contact.ID, backoff(attempt))
+			continue
+		}
+
+		if err := n.repo.MarkContactNotified(res.Contact.ID); err != nil {
+			log.Printf("[Webhook] Error marcando contacto %d como notificado: %v", res.Contact.ID, err)
+		}
+	}
+}
+
+// send hace el POST del resultado; cualquier respuesta 2xx cuenta como entregada
+func (n *Notifier) send(res database.ContactResult) error {
+	payload := buildPayload(res)
+	if lastCall, err := n.repo.GetLastCallLogForContact(res.Contact.CampaignID, res.Contact.Telefono); err != nil {
+		return err
+	} else if lastCall != nil {
+		payload.Call = &CallPayload{
+			ID:          lastCall.ID,
+			Uniqueid:    lastCall.Uniqueid,
+			Status:      lastCall.Status,
+			Disposition: lastCall.Disposition,
+			DTMF:        lastCall.DTMFMarcado,
+			Duracion:    lastCall.Duracion,
+			CallerID:    lastCall.CallerIDUsed,
+			CreatedAt:   lastCall.CreatedAt,
+		}
+		if lastCall.DTMFCapturado != nil {
+			payload.Call.Capturado = *lastCall.DTMFCapturado
+		}
+	}
+
+	return post(n.client, res.ResultURL, payload)
+}
+
+// post envía payload como JSON; cualquier respuesta 2xx cuenta como entregada
+func post(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializando payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "apicall-webhook/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error enviando webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("result_url respondió %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CampaignExitPayload se envía al result_url cuando una regla de salida pausa la campaña
+type CampaignExitPayload struct {
+	Event      string    `json:"event"` // campaign.exit
+	CampaignID int       `json:"campaign_id"`
+	ProyectoID int       `json:"proyecto_id"`
+	Nombre     string    `json:"nombre"`
+	Rule       string    `json:"rule"` // min_asr, daily_minutes, max_connects, max_abandon
+	Reason     string    `json:"reason"`
+	Estado     string    `json:"estado"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// SendCampaignExit notifica la salida de una campaña, reintentando con el backoff de los resultados
+// (hasta MaxAttempts). Bloquea hasta entregar o agotar los intentos: llamarla en una goroutine.
+func SendCampaignExit(url string, payload *CampaignExitPayload) {
+	sendWithRetry(url, payload.Event, payload.CampaignID, payload)
+}
+
+// CampaignSummaryPayload se envía al result_url cuando la campaña termina (estado completed)
+type CampaignSummaryPayload struct {
+	Event      string                    `json:"event"` // campaign.summary
+	CampaignID int                       `json:"campaign_id"`
+	ProyectoID int                       `json:"proyecto_id"`
+	Nombre     string                    `json:"nombre"`
+	Summary    *database.CampaignSummary `json:"summary"`
+	Timestamp  time.Time                 `json:"timestamp"`
+}
+
+// SendCampaignSummary entrega el resumen final de la campaña con los mismos reintentos que SendCampaignExit
+func SendCampaignSummary(url string, payload *CampaignSummaryPayload) {
+	sendWithRetry(url, payload.Event, payload.CampaignID, payload)
+}
+
+// sendWithRetry envía un evento de campaña reintentando con backoff hasta MaxAttempts
+func sendWithRetry(url, event string, campaignID int, payload interface{}) {
+	client := &http.Client{Timeout: requestTimeout}
+	for attempt := 1; ; attempt++ {
+		err := post(client, url, payload)
+		if err == nil {
+			return
+		}
+		if attempt >= MaxAttempts {
+			log.Printf("[Webhook] ERROR %s campaña %d: %v - se abandona tras %d intentos", event, campaignID, err, attempt)
+			return
+		}
+		log.Printf("[Webhook] WARN %s campaña %d: %v - reintento %d/%d", event, campaignID, err, attempt, MaxAttempts)
+		time.Sleep(backoff(attempt))
+	}
+}
+
+func buildPayload(res database.ContactResult) *ContactResultPayload {
+	c := res.Contact
+	payload := &ContactResultPayload{
+		Event:         "contact.result",
+		CampaignID:    c.CampaignID,
+		ProyectoID:    res.ProyectoID,
+		ContactID:     c.ID,
+		Telefono:      c.Telefono,
+		Estado:        c.Estado,
+		Intentos:      c.Intentos,
+		UltimoIntento: c.UltimoIntento,
+	}
+	if c.Resultado != nil {
+		payload.Resultado = *c.Resultado
+	}
+	if c.DatosAdicionales != nil && json.Valid([]byte(*c.DatosAdicionales)) {
+		payload.DatosAdicionales = json.RawMessage(*c.DatosAdicionales)
+	}
+	return payload
+}
+
+// backoff devuelve la espera antes del siguiente intento: 30s, 2m, 8m, 32m...
+func backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt; i++ {
+		d *= 4
+	}
+	return d
+}
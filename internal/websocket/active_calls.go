@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ActiveCallsInterval is how often the active call map is broadcast
+const ActiveCallsInterval = 2 * time.Second
+
+// ActiveCallCounter is the source of the active call map (dialer.ActiveCallTracker)
+type ActiveCallCounter interface {
+	Count() int
+	CountByCampaign() map[int]int
+	CountByTrunk() map[string]int
+}
+
+// ActiveCallsSnapshot is the payload of EventActiveCalls: calls in flight per campaign and trunk
+type ActiveCallsSnapshot struct {
+	Total      int            `json:"total"`
+	ByCampaign map[int]int    `json:"by_campaign"` // Calls without campaign (API) only count in total
+	ByTrunk    map[string]int `json:"by_trunk"`
+}
+
+// ActiveCallsBroadcaster periodically sends the active call map to the WebSocket clients
+type ActiveCallsBroadcaster struct {
+	counter  ActiveCallCounter
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewActiveCallsBroadcaster creates the broadcaster for the given tracker
+func NewActiveCallsBroadcaster(counter ActiveCallCounter) *ActiveCallsBroadcaster {
+	return &ActiveCallsBroadcaster{
+		counter:  counter,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the periodic broadcast
+func (b *ActiveCallsBroadcaster) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running {
+		return
+	}
+	b.running = true
+	b.wg.Add(1)
+	go b.run()
+	log.Printf("[WebSocket] Active calls broadcast started (every %v)", ActiveCallsInterval)
+}
+
+// Stop ends the periodic broadcast
+func (b *ActiveCallsBroadcaster) Stop() {
+	b.mu.Lock()
+	if !b.running {
+		b.mu.Unlock()
+		return
+	}
+	b.running = false
+	b.mu.Unlock()
+
+	close(b.stopChan)
+	b.wg.Wait()
+	log.Println("[WebSocket] Active calls broadcast stopped")
+}
+
+func (b *ActiveCallsBroadcaster) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(ActiveCallsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case <-ticker.C:
+			// Nothing to do until the hub is up and someone is listening
+			if GlobalHub == nil || GlobalHub.ClientCount() == 0 {
+				continue
+			}
+			GlobalHub.Broadcast(EventActiveCalls, b.Snapshot())
+		}
+	}
+}
+
+// Snapshot returns the current active call map
+func (b *ActiveCallsBroadcaster) Snapshot() ActiveCallsSnapshot {
+	return ActiveCallsSnapshot{
+		Total:      b.counter.Count(),
+		ByCampaign: b.counter.CountByCampaign(),
+		ByTrunk:    b.counter.CountByTrunk(),
+	}
+}
@@ -28,6 +28,8 @@ const (
 	EventCallEnd      EventType = "call_end"
 	EventStatsUpdate  EventType = "stats_update"
 	EventProjectStats EventType = "project_stats"
+	EventCampaignExit EventType = "campaign_exit"
+	EventActiveCalls  EventType = "active_calls"
 )
 
 // Message represents a WebSocket message
@@ -141,6 +143,14 @@ func BroadcastStats(stats interface{}) {
 	GlobalHub.Broadcast(EventStatsUpdate, stats)
 }
 
+// BroadcastCampaignExit avisa que una regla de salida pausó una campaña
+func BroadcastCampaignExit(data interface{}) {
+	if GlobalHub == nil {
+		return
+	}
+	GlobalHub.Broadcast(EventCampaignExit, data)
+}
+
 // HandleWebSocket handles WebSocket upgrade requests
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
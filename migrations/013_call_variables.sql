@@ -0,0 +1,4 @@
+-- Migración 013: Variables del integrador por llamada
+-- Guarda las variables de canal enviadas en /api/v1/call (JSON) para correlación externa
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS variables TEXT NULL DEFAULT NULL;
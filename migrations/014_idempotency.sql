@@ -0,0 +1,21 @@
+-- Migración 014: Idempotencia y anti-repetición en /api/v1/call
+-- Evita llamadas duplicadas por reintentos del cliente (Idempotency-Key / external_ref)
+
+CREATE TABLE IF NOT EXISTS apicall_idempotency_keys (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    idem_key VARCHAR(128) NOT NULL,
+    telefono VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_proyecto_key (proyecto_id, idem_key),
+    INDEX idx_created (created_at),
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Referencia externa guardada con el log de la llamada
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS external_ref VARCHAR(128) NULL DEFAULT NULL;
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_external_ref (external_ref);
+
+-- Minutos durante los cuales no se repite una llamada al mismo número (0 = sin restricción)
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS no_repeat_minutes INT DEFAULT 0;
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_proyecto_telefono (proyecto_id, telefono, created_at);
@@ -0,0 +1,25 @@
+-- Migración 015: Jobs de importación de contactos
+-- Los archivos subidos se guardan en disco y un worker los procesa por bloques
+
+CREATE TABLE IF NOT EXISTS apicall_import_jobs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    campaign_id INT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    file_path VARCHAR(512) NOT NULL,
+    mapping TEXT NULL COMMENT 'Mapeo de columnas (JSON)',
+    estado ENUM('pending', 'running', 'completed', 'failed') DEFAULT 'pending',
+    total_rows INT DEFAULT 0,
+    processed_rows INT DEFAULT 0,
+    inserted INT DEFAULT 0,
+    duplicates INT DEFAULT 0,
+    blacklisted INT DEFAULT 0,
+    invalid INT DEFAULT 0,
+    errors TEXT NULL COMMENT 'Errores de validación (JSON, máx 100)',
+    error_message VARCHAR(500) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME NULL,
+    finished_at DATETIME NULL,
+    FOREIGN KEY (campaign_id) REFERENCES apicall_campaigns(id) ON DELETE CASCADE,
+    INDEX idx_campaign (campaign_id),
+    INDEX idx_estado (estado)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+-- Migración 016: País por proyecto para normalización de números
+-- Los números se guardan en formato E.164 sin "+" (ej: 573001234567)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS pais VARCHAR(2) DEFAULT '' COMMENT 'ISO 3166-1 alpha-2 (vacío = sin normalizar)';
@@ -0,0 +1,10 @@
+-- Migración 017: Webhook de resultados por campaña
+-- Cuando result_url está definido, el resultado final de cada contacto se envía por POST
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS result_url VARCHAR(500) DEFAULT '' COMMENT 'URL que recibe el resultado de cada contacto (vacío = desactivado)';
+
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS notified_at DATETIME NULL COMMENT 'Resultado entregado al result_url';
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS notify_attempts INT DEFAULT 0;
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS notify_next_at DATETIME NULL COMMENT 'Próximo reintento de entrega';
+
+ALTER TABLE apicall_campaign_contacts ADD INDEX IF NOT EXISTS idx_estado_notified (estado, notified_at);
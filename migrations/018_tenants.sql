@@ -0,0 +1,32 @@
+-- Migración 018: Modelo multi-tenant (organizaciones)
+-- Usuarios, proyectos, troncales y campañas pertenecen a una organización.
+-- Logs, blacklist y contactos se acotan a través de su proyecto o campaña.
+-- Los datos existentes quedan en la organización por defecto (id 1).
+
+CREATE TABLE IF NOT EXISTS apicall_tenants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    nombre VARCHAR(100) NOT NULL,
+    slug VARCHAR(50) NOT NULL UNIQUE,
+    activo BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT IGNORE INTO apicall_tenants (id, nombre, slug) VALUES (1, 'Default', 'default');
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1 AFTER id;
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1;
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1;
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS tenant_id INT NOT NULL DEFAULT 1;
+
+ALTER TABLE users ADD INDEX IF NOT EXISTS idx_tenant (tenant_id);
+ALTER TABLE apicall_proyectos ADD INDEX IF NOT EXISTS idx_tenant (tenant_id);
+ALTER TABLE apicall_troncales ADD INDEX IF NOT EXISTS idx_tenant (tenant_id);
+ALTER TABLE apicall_campaigns ADD INDEX IF NOT EXISTS idx_tenant (tenant_id);
+
+-- superadmin: operador de la plataforma, ve todas las organizaciones
+ALTER TABLE users MODIFY role ENUM('superadmin', 'admin', 'supervisor', 'viewer') DEFAULT 'viewer';
+
+-- El admin inicial pasa a superadmin solo si todavía no existe ninguno
+UPDATE users SET role = 'superadmin'
+WHERE username = 'admin' AND role = 'admin'
+  AND NOT EXISTS (SELECT 1 FROM (SELECT id FROM users WHERE role = 'superadmin') s);
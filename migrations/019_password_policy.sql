@@ -0,0 +1,6 @@
+-- Migración 019: Política de contraseñas y bloqueo de cuentas
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_at DATETIME NULL COMMENT 'Bloqueo por intentos fallidos (NULL = desbloqueado)';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at DATETIME NULL;
@@ -0,0 +1,5 @@
+-- Migración 020: Marcador de abandono (el destino colgó durante el IVR)
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS abandon_step VARCHAR(50) NULL COMMENT 'Paso del IVR en el que colgó (answer, amd, audio, dtmf, ...)';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS abandon_audio VARCHAR(255) NULL COMMENT 'Audio que se reproducía al colgar';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS abandon_seconds INT NULL COMMENT 'Segundos transcurridos dentro del paso';
@@ -0,0 +1,7 @@
+-- Migración 021: Captura de varios dígitos (ej: código de confirmación terminado en #)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS capture_digits INT DEFAULT 0 COMMENT 'Máximo de dígitos a capturar tras el DTMF esperado (0 = desactivado)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS capture_audio VARCHAR(255) DEFAULT '' COMMENT 'Audio que solicita los dígitos';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS capture_timeout INT DEFAULT 5 COMMENT 'Timeout entre dígitos en segundos';
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS dtmf_capturado VARCHAR(32) NULL COMMENT 'Dígitos capturados (sin el terminador #)';
@@ -0,0 +1,9 @@
+-- Migración 022: Transferencia a cola (Queue) o grupo de timbrado con resultado en el log
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS transfer_mode VARCHAR(20) DEFAULT 'blind' COMMENT 'blind, queue, ringgroup';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS transfer_target VARCHAR(255) DEFAULT '' COMMENT 'Nombre de la cola o endpoints del grupo (PJSIP/101&PJSIP/102)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS transfer_timeout INT DEFAULT 30 COMMENT 'Segundos esperando un agente';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS transfer_fail_audio VARCHAR(255) DEFAULT '' COMMENT 'Audio si ningún agente atiende';
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS transfer_result VARCHAR(30) NULL COMMENT 'AGENT_ANSWERED, ABANDONED_IN_QUEUE, NO_AGENT';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS transfer_status VARCHAR(30) NULL COMMENT 'QUEUESTATUS / DIALSTATUS de Asterisk';
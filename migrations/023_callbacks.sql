@@ -0,0 +1,25 @@
+-- Migración 023: Solicitudes de rellamada ("marque 2 para que lo llamemos más tarde")
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS callback_dtmf VARCHAR(1) DEFAULT '' COMMENT 'Dígito que solicita rellamada (vacío = desactivado)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS callback_audio VARCHAR(255) DEFAULT '' COMMENT 'Audio que pide la hora preferida (HH, opcional)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS callback_delay INT DEFAULT 60 COMMENT 'Minutos hasta la rellamada si no se indica hora';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS callback_window INT DEFAULT 60 COMMENT 'Duración en minutos de la ventana de rellamada';
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS callback_of BIGINT NULL COMMENT 'Log de la llamada original que pidió la rellamada';
+
+CREATE TABLE IF NOT EXISTS apicall_callbacks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    campaign_id INT NULL,
+    contact_id BIGINT NULL,
+    telefono VARCHAR(20) NOT NULL,
+    original_log_id BIGINT NOT NULL,
+    window_start DATETIME NOT NULL,
+    window_end DATETIME NOT NULL,
+    estado ENUM('pending', 'dialed', 'expired', 'skipped') DEFAULT 'pending',
+    dialed_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE,
+    INDEX idx_estado_window (estado, window_start),
+    INDEX idx_original_log (original_log_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,18 @@
+-- Migración 024: Cola persistente del spooler
+-- Cada llamada aceptada por la API se guarda aquí hasta generar su .call, y se retoma al reiniciar
+
+CREATE TABLE IF NOT EXISTS apicall_spool_queue (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    telefono VARCHAR(20) NOT NULL,
+    contact_id BIGINT DEFAULT 0,
+    campaign_id INT DEFAULT 0,
+    variables TEXT NULL COMMENT 'Variables de canal del integrador (JSON)',
+    caller_id VARCHAR(32) DEFAULT '',
+    external_ref VARCHAR(128) DEFAULT '',
+    callback_of BIGINT DEFAULT 0,
+    loaded TINYINT(1) DEFAULT 0 COMMENT 'Cargada en el buffer en memoria del proceso actual',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE,
+    INDEX idx_loaded (loaded, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
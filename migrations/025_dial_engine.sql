@@ -0,0 +1,4 @@
+-- Migración 025: Motor de marcación por proyecto
+-- Vacío = automático (API y rellamadas por spool, campañas por AMI)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS dial_engine VARCHAR(10) DEFAULT '' COMMENT 'spool, ami o vacío (automático)';
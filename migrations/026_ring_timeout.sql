@@ -0,0 +1,5 @@
+-- Migración 026: Tiempo de timbrado configurable (WaitTime del .call / Timeout del Originate)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS ring_timeout INT DEFAULT 45 COMMENT 'Segundos de timbrado antes de dar la llamada por no contestada';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS ring_timeout INT DEFAULT 0 COMMENT 'Override por campaña (0 = el del proyecto)';
+ALTER TABLE apicall_spool_queue ADD COLUMN IF NOT EXISTS ring_timeout INT DEFAULT 0 COMMENT 'Override de la llamada encolada (0 = el del proyecto)';
@@ -0,0 +1,3 @@
+-- Migración 027: Prioridad de campañas (peso en el reparto de canales del Sweeper)
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS prioridad INT DEFAULT 1 COMMENT 'Peso 1-100 en el reparto de slots entre campañas activas';
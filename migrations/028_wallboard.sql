@@ -0,0 +1,4 @@
+-- Migración 028: Troncal en el log de llamadas e índice para el wallboard (ASR por troncal, histograma por hora)
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS troncal VARCHAR(100) NULL COMMENT 'Troncal por la que salió la llamada';
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_created_troncal (created_at, troncal);
@@ -0,0 +1,15 @@
+-- Migración 029: Rollups horarios del log de llamadas para reportes históricos
+-- Mantenidos por el agregador en segundo plano (internal/reports)
+
+CREATE TABLE IF NOT EXISTS apicall_call_rollup_hourly (
+    hora DATETIME NOT NULL COMMENT 'Inicio de la hora (hora del servidor)',
+    proyecto_id INT NOT NULL,
+    campaign_id INT NOT NULL DEFAULT 0 COMMENT '0 = llamadas sin campaña',
+    disposition VARCHAR(20) NOT NULL DEFAULT '',
+    llamadas INT NOT NULL DEFAULT 0,
+    con_dtmf INT NOT NULL DEFAULT 0 COMMENT 'Llamadas en las que se marcó DTMF',
+    duracion_total BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (hora, proyecto_id, campaign_id, disposition),
+    INDEX idx_proyecto_hora (proyecto_id, hora),
+    INDEX idx_campaign_hora (campaign_id, hora)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
@@ -0,0 +1,19 @@
+-- Migración 030: Retención de datos por proyecto (purga / archivado de logs, contactos y grabaciones)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS retention_days INT DEFAULT 0 COMMENT 'Días a conservar logs, contactos y grabaciones (0 = sin límite)';
+
+CREATE TABLE IF NOT EXISTS apicall_retention_runs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    dry_run BOOLEAN DEFAULT FALSE,
+    cutoff DATETIME NOT NULL COMMENT 'Se eliminó lo anterior a esta fecha',
+    call_logs INT DEFAULT 0,
+    contacts INT DEFAULT 0,
+    recordings INT DEFAULT 0,
+    archivos TEXT NULL COMMENT 'Archivos generados, separados por coma',
+    error VARCHAR(500) NULL,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NULL,
+    INDEX idx_proyecto (proyecto_id),
+    INDEX idx_started (started_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
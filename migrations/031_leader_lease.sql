@@ -0,0 +1,11 @@
+-- Migración 031: Elección de líder entre instancias que comparten la BD (ha.enabled)
+-- Solo el holder con el lease vigente barre campañas y carga la cola del spooler
+
+CREATE TABLE IF NOT EXISTS apicall_leader_lease (
+    name VARCHAR(64) PRIMARY KEY,
+    holder VARCHAR(128) NOT NULL COMMENT 'Instancia que tiene el lease',
+    expires_at DATETIME(3) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE apicall_spool_queue ADD COLUMN IF NOT EXISTS loaded_by VARCHAR(128) NULL COMMENT 'Instancia que cargó la llamada en su buffer';
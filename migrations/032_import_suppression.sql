@@ -0,0 +1,6 @@
+-- Migración 032: Supresión de contactos al importar (otras campañas activas y control de fatiga)
+
+ALTER TABLE apicall_import_jobs ADD COLUMN IF NOT EXISTS suppress_active BOOLEAN DEFAULT FALSE COMMENT 'Omitir números presentes en otra campaña activa del proyecto';
+ALTER TABLE apicall_import_jobs ADD COLUMN IF NOT EXISTS suppress_days INT DEFAULT 0 COMMENT 'Omitir números llamados en los últimos N días (0 = no)';
+ALTER TABLE apicall_import_jobs ADD COLUMN IF NOT EXISTS suppressed_active INT DEFAULT 0;
+ALTER TABLE apicall_import_jobs ADD COLUMN IF NOT EXISTS suppressed_recent INT DEFAULT 0
@@ -0,0 +1,44 @@
+-- Migración 033: Encuestas IVR (preguntas de un dígito) y sus respuestas por llamada
+
+CREATE TABLE IF NOT EXISTS apicall_surveys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    nombre VARCHAR(100) NOT NULL,
+    end_audio VARCHAR(255) DEFAULT '' COMMENT 'Audio al terminar la encuesta (opcional)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE,
+    INDEX idx_proyecto (proyecto_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS apicall_survey_questions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    survey_id INT NOT NULL,
+    orden INT NOT NULL,
+    texto VARCHAR(255) NOT NULL COMMENT 'Enunciado, usado como columna del export',
+    audio VARCHAR(255) NOT NULL,
+    opciones VARCHAR(12) DEFAULT '' COMMENT 'Dígitos válidos (vacío = cualquiera)',
+    timeout INT DEFAULT 5 COMMENT 'Segundos esperando la respuesta',
+    intentos INT DEFAULT 2,
+    FOREIGN KEY (survey_id) REFERENCES apicall_surveys(id) ON DELETE CASCADE,
+    INDEX idx_survey_orden (survey_id, orden)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS apicall_survey_responses (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    survey_id INT NOT NULL,
+    question_id INT NOT NULL,
+    call_log_id BIGINT NOT NULL,
+    proyecto_id INT NOT NULL,
+    campaign_id INT NULL,
+    contact_id BIGINT NULL,
+    telefono VARCHAR(20) NOT NULL,
+    respuesta VARCHAR(8) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (call_log_id) REFERENCES apicall_call_log(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_call_question (call_log_id, question_id),
+    INDEX idx_campaign (campaign_id, survey_id),
+    INDEX idx_survey_created (survey_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS survey_id INT DEFAULT 0 COMMENT 'Encuesta que se ejecuta tras el audio principal (0 = flujo DTMF normal)'
@@ -0,0 +1,14 @@
+-- Migración 034: Biblioteca de audios (metadatos de los archivos en sound_path)
+
+CREATE TABLE IF NOT EXISTS apicall_audios (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL COMMENT 'Archivo en /var/lib/asterisk/sounds/apicall',
+    title VARCHAR(150) DEFAULT '' COMMENT 'Nombre descriptivo',
+    duration DECIMAL(8,2) DEFAULT 0 COMMENT 'Segundos (soxi / ffprobe)',
+    size BIGINT DEFAULT 0,
+    tags VARCHAR(500) DEFAULT '' COMMENT 'Etiquetas separadas por coma',
+    uploaded_by VARCHAR(50) DEFAULT '' COMMENT 'Usuario que lo subió (vacío = previo a la biblioteca)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
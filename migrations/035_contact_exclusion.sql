@@ -0,0 +1,4 @@
+-- Migración 035: Exclusión manual de contactos de campaña
+-- excluded = pendiente retirado a mano (el sweeper no lo marca), se puede reincorporar
+
+ALTER TABLE apicall_campaign_contacts MODIFY COLUMN estado ENUM('pending', 'dialing', 'completed', 'failed', 'skipped', 'excluded') DEFAULT 'pending'
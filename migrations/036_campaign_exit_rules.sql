@@ -0,0 +1,8 @@
+-- Migración 036: Reglas de salida automática de campañas (evaluadas por el Sweeper)
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_min_asr DECIMAL(5,2) DEFAULT 0 COMMENT 'Pausar si el % de contestadas cae por debajo (0 = desactivada)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_asr_window INT DEFAULT 0 COMMENT 'Últimas N llamadas para el ASR (0 = 500)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_daily_minutes INT DEFAULT 0 COMMENT 'Presupuesto diario de minutos (0 = sin límite)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_max_connects INT DEFAULT 0 COMMENT 'Pausar tras N conexiones (0 = sin límite)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_dispositions VARCHAR(100) DEFAULT '' COMMENT 'Dispositions que cuentan como conexión, ej: A,XFER (vacío = contestadas por humano)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_reason VARCHAR(255) DEFAULT '' COMMENT 'Regla que pausó la campaña (se limpia al reanudar)'
@@ -0,0 +1,7 @@
+-- Migración 037: Tarifas por troncal y costo estimado por llamada (conciliación con facturas del carrier)
+
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS costo_minuto DECIMAL(10,4) NOT NULL DEFAULT 0 COMMENT 'Tarifa por minuto del carrier';
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS incremento_inicial INT NOT NULL DEFAULT 60 COMMENT 'Segundos mínimos facturados (ej: 60 en 60/60, 30 en 30/6)';
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS incremento INT NOT NULL DEFAULT 60 COMMENT 'Incremento de facturación en segundos tras el inicial';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS segundos_facturados INT NULL COMMENT 'Duración redondeada según la tarifa de la troncal';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS costo DECIMAL(12,4) NULL COMMENT 'Costo estimado con la tarifa vigente al finalizar la llamada'
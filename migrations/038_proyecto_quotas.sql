@@ -0,0 +1,5 @@
+-- Migración 038: Cuotas por proyecto (llamadas por día y simultáneas), aplicadas en la API, el Spooler y el Sweeper
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS max_calls_day INT DEFAULT 0 COMMENT 'Máximo de llamadas por día en la zona del proyecto (0 = sin límite)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS max_concurrent INT DEFAULT 0 COMMENT 'Máximo de llamadas simultáneas (0 = sin límite)';
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_proyecto_created (proyecto_id, created_at)
@@ -0,0 +1,3 @@
+-- Migración 039: Índice para reclamar contactos pendientes por campaña (FOR UPDATE SKIP LOCKED en orden de id)
+
+ALTER TABLE apicall_campaign_contacts ADD INDEX IF NOT EXISTS idx_campaign_estado (campaign_id, estado, id)
@@ -0,0 +1,3 @@
+-- Migración 040: Índice por uniqueid de Asterisk (los eventos AMI buscan la llamada por coincidencia exacta, sin LIKE)
+
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_uniqueid (uniqueid)
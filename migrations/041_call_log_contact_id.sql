@@ -0,0 +1,4 @@
+-- Migración 041: Contacto de campaña en el log de llamadas (el batcher y el orphan cleaner sincronizan por id, no por teléfono)
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS contact_id BIGINT NULL COMMENT 'Contacto de campaña que originó la llamada';
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_contact (contact_id)
@@ -0,0 +1,4 @@
+-- Migración 042: Troncales por campaña (override de las del proyecto, con peso en el reparto)
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS troncales VARCHAR(500) NULL COMMENT 'Override de troncales: nombre[:peso],... (vacío = las del proyecto)';
+ALTER TABLE apicall_spool_queue ADD COLUMN IF NOT EXISTS troncales VARCHAR(500) NULL COMMENT 'Override de troncales de la llamada encolada (vacío = las del proyecto)';
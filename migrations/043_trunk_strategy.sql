@@ -0,0 +1,4 @@
+-- Migración 043: Estrategia de balanceo entre troncales por proyecto y capacidad de cada troncal
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS trunk_strategy VARCHAR(20) DEFAULT 'random' COMMENT 'random, weighted, least_used o asr';
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS capacidad INT NOT NULL DEFAULT 0 COMMENT 'Canales contratados con el carrier (peso en la estrategia weighted, 0 = el límite por troncal del pool)';
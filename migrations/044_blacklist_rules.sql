@@ -0,0 +1,14 @@
+-- Migración 044: Reglas de blacklist automática por proyecto (disposition repetida o DTMF de baja)
+
+CREATE TABLE IF NOT EXISTS apicall_blacklist_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    tipo VARCHAR(20) NOT NULL COMMENT 'disposition o dtmf',
+    valor VARCHAR(20) NOT NULL COMMENT 'Disposition (ej: NI) o dígito (ej: 9)',
+    consecutivos INT NOT NULL DEFAULT 1 COMMENT 'Últimas llamadas finalizadas del número que deben cumplirla',
+    dnc BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Baja voluntaria: además descarta el número en las campañas del proyecto',
+    activo BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE,
+    INDEX idx_proyecto (proyecto_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
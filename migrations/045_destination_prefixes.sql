@@ -0,0 +1,4 @@
+-- Migración 045: Reglas de destino por prefijo en cada proyecto (permitidos / bloqueados)
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS prefijos_permitidos VARCHAR(500) NOT NULL DEFAULT '' COMMENT 'Prefijos del número normalizado separados por coma (vacío = todos)';
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS prefijos_bloqueados VARCHAR(500) NOT NULL DEFAULT '' COMMENT 'Prefijos del número normalizado que no se marcan, separados por coma';
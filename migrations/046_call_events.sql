@@ -0,0 +1,11 @@
+-- Migración 046: Eventos de cada llamada para el timeline del detalle (AGI / AMI)
+
+CREATE TABLE IF NOT EXISTS apicall_call_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    log_id BIGINT NOT NULL,
+    evento VARCHAR(30) NOT NULL COMMENT 'queued, originated, answered, amd, audio, dtmf, transfer o hangup',
+    detalle VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Dato del evento (troncal, resultado AMD, audio, dígito, causa...)',
+    created_at DATETIME(3) NOT NULL COMMENT 'Momento del evento (milisegundos para ordenar el timeline)',
+    FOREIGN KEY (log_id) REFERENCES apicall_call_log(id) ON DELETE CASCADE,
+    INDEX idx_log (log_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
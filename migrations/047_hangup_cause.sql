@@ -0,0 +1,4 @@
+-- Migración 047: Causa de cuelgue de Asterisk (Q.850) en el log de llamadas
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS hangup_cause INT NULL COMMENT 'Cause del evento Hangup (16 = Normal Clearing, 17 = Busy, 34 = Congestion...)';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS hangup_cause_txt VARCHAR(100) NULL COMMENT 'Cause-txt del evento Hangup';
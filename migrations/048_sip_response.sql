@@ -0,0 +1,4 @@
+-- Migración 048: Respuesta SIP final de la troncal en el log de llamadas (requiere storesipcause=yes en sip.conf)
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS sip_code SMALLINT NULL COMMENT 'Última respuesta SIP final de la troncal (200, 403, 404, 486, 503...)';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS sip_reason VARCHAR(100) NULL COMMENT 'Texto de la respuesta SIP (ej: Busy Here)';
@@ -0,0 +1,5 @@
+-- Migración 049: Resumen final de la campaña (al completarse) y destinatarios por email
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS summary_emails VARCHAR(500) NOT NULL DEFAULT '' COMMENT 'Destinatarios del resumen final separados por coma (requiere smtp en el YAML)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS summary TEXT NULL COMMENT 'Resumen final (JSON) generado al pasar a completed';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS summary_at DATETIME NULL COMMENT 'Momento en que se generó el resumen';
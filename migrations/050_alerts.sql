@@ -0,0 +1,15 @@
+-- Migración 050: Alertas operativas (troncal caída, BD inaccesible, ASR bajo, cola saturada)
+
+CREATE TABLE IF NOT EXISTS apicall_alerts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 0 COMMENT 'Organización afectada (0 = alerta del sistema, solo superadmin)',
+    tipo VARCHAR(30) NOT NULL COMMENT 'trunk_down, db_unreachable, low_answer_rate o spool_saturation',
+    clave VARCHAR(100) NOT NULL COMMENT 'Objeto afectado (troncal, campaña, instancia), una alerta activa por tipo y clave',
+    mensaje VARCHAR(500) NOT NULL,
+    estado VARCHAR(20) NOT NULL DEFAULT 'active' COMMENT 'active o resolved',
+    notificada BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Se envió el email al abrirse',
+    created_at DATETIME NOT NULL,
+    resolved_at DATETIME NULL,
+    INDEX idx_estado (estado, tipo, clave),
+    INDEX idx_tenant (tenant_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
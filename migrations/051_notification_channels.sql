@@ -0,0 +1,16 @@
+-- Migración 051: Canales de notificación por proyecto (Slack, Telegram) para eventos de campaña y alertas
+
+CREATE TABLE IF NOT EXISTS apicall_notification_channels (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    proyecto_id INT NOT NULL,
+    tipo VARCHAR(20) NOT NULL COMMENT 'slack o telegram',
+    nombre VARCHAR(100) NOT NULL DEFAULT '',
+    webhook_url VARCHAR(500) NOT NULL DEFAULT '' COMMENT 'Slack: URL del Incoming Webhook',
+    bot_token VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'Telegram: token del bot',
+    chat_id VARCHAR(50) NOT NULL DEFAULT '' COMMENT 'Telegram: chat, grupo o canal destino',
+    eventos VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Eventos separados por coma (vacío = todos)',
+    activo BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (proyecto_id) REFERENCES apicall_proyectos(id) ON DELETE CASCADE,
+    INDEX idx_proyecto (proyecto_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
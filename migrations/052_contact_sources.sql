@@ -0,0 +1,27 @@
+-- Migración 052: Origen HTTP de contactos por campaña (API de un CRM que se consulta periódicamente)
+
+CREATE TABLE IF NOT EXISTS apicall_contact_sources (
+    campaign_id INT PRIMARY KEY,
+    url VARCHAR(1000) NOT NULL,
+    formato VARCHAR(10) NOT NULL DEFAULT 'json' COMMENT 'json o csv',
+    headers TEXT NULL COMMENT 'Headers HTTP de la consulta (objeto JSON), ej: Authorization',
+    records_path VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'JSON: ruta al arreglo de registros (ej: data.items, vacío = raíz)',
+    phone_column VARCHAR(100) NOT NULL DEFAULT '',
+    name_column VARCHAR(100) NOT NULL DEFAULT '',
+    fields VARCHAR(500) NOT NULL DEFAULT '' COMMENT 'Columnas adicionales separadas por coma',
+    paginacion VARCHAR(10) NOT NULL DEFAULT 'none' COMMENT 'none, page o next',
+    page_param VARCHAR(50) NOT NULL DEFAULT '' COMMENT 'page: parámetro del número de página (vacío = page)',
+    page_size_param VARCHAR(50) NOT NULL DEFAULT '' COMMENT 'page: parámetro del tamaño de página (opcional)',
+    page_size INT NOT NULL DEFAULT 0,
+    next_path VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'next: ruta JSON de la URL siguiente (vacío = header Link)',
+    max_pages INT NOT NULL DEFAULT 0 COMMENT '0 = 100',
+    interval_minutes INT NOT NULL DEFAULT 0 COMMENT 'Cada cuánto se trae la lista (0 = solo manual)',
+    suppress_active BOOLEAN NOT NULL DEFAULT FALSE,
+    suppress_days INT NOT NULL DEFAULT 0,
+    activo BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at DATETIME NULL,
+    last_import_id BIGINT NULL,
+    last_error VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (campaign_id) REFERENCES apicall_campaigns(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+-- Migración 053: CPS por campaña y rampa de arranque (warm-up) para no generar picos de tráfico en el carrier
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS max_cps INT NOT NULL DEFAULT 0 COMMENT 'CPS objetivo de la campaña (0 = sin tope propio)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS ramp_minutes INT NOT NULL DEFAULT 0 COMMENT 'Warm-up: minutos hasta llegar al CPS objetivo (0 = sin rampa)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS ramp_start_cps INT NOT NULL DEFAULT 0 COMMENT 'CPS inicial de la rampa (0 = 1)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS ramp_started_at DATETIME NULL COMMENT 'Inicio de la rampa en curso (lo registra el Sweeper al empezar a marcar)';
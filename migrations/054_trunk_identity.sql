@@ -0,0 +1,7 @@
+-- Migración 054: Identidad SIP por troncal (P-Asserted-Identity, headers propios) y atestación STIR/SHAKEN
+
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS pai BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Envía P-Asserted-Identity con el Caller ID de la llamada';
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS sip_headers TEXT NULL COMMENT 'Headers SIP adicionales, uno por línea "Nombre: valor" (SIPAddHeader)';
+ALTER TABLE apicall_troncales ADD COLUMN IF NOT EXISTS attestation CHAR(1) NOT NULL DEFAULT '' COMMENT 'Nivel de atestación STIR/SHAKEN con el que firma el carrier (A, B o C)';
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS attestation CHAR(1) NULL COMMENT 'Atestación STIR/SHAKEN de la troncal al marcar';
@@ -0,0 +1,3 @@
+-- Migración 055: Idioma de los prompts de sistema del IVR por proyecto
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS locale VARCHAR(10) NOT NULL DEFAULT 'es' COMMENT 'es = prompts en la raíz de sound_path, otro idioma = subcarpeta con su código (ej: en/opcion_invalida)';
@@ -0,0 +1,5 @@
+-- Migración 056: inicio y fin programados de campañas (además de los horarios semanales)
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS start_at DATETIME NULL COMMENT 'Inicio automático: la campaña pasa a active (NULL = solo manual)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS end_at DATETIME NULL COMMENT 'Fin automático: la campaña pasa a completed (NULL = hasta agotar contactos)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS auto_started_at DATETIME NULL COMMENT 'Último inicio automático aplicado (cambiar start_at lo vuelve a programar)';
@@ -0,0 +1,10 @@
+-- Migración 057: campañas recurrentes (ej: cada lunes se vuelven a marcar los contactos pendientes o fallidos)
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_days VARCHAR(20) NOT NULL DEFAULT '' COMMENT 'Días de la recurrencia, 0=Domingo..6=Sábado separados por coma (vacío = no recurrente)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_time VARCHAR(5) NOT NULL DEFAULT '' COMMENT 'Hora HH:MM de la recurrencia, en la zona horaria del proyecto';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_mode VARCHAR(10) NOT NULL DEFAULT '' COMMENT 'reset = reencola en la misma campaña, clone = crea una campaña nueva con los contactos';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_estados VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'Estados de contacto que se vuelven a marcar (vacío = pending,failed)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_dispositions VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'Filtro opcional por resultado, ej: NA,BUSY (PENDING = sin resultado)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_max INT NOT NULL DEFAULT 0 COMMENT 'Recurrencias máximas (0 = sin límite)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_count INT NOT NULL DEFAULT 0 COMMENT 'Recurrencias aplicadas';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS recur_last_at DATETIME NULL COMMENT 'Última recurrencia aplicada (o alta de la recurrencia)';
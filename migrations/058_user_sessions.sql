@@ -0,0 +1,16 @@
+-- Migración 058: sesiones de usuario (cada token lleva el ID de su sesión, revocar la sesión invalida el token)
+
+CREATE TABLE IF NOT EXISTS apicall_user_sessions (
+    id CHAR(32) PRIMARY KEY COMMENT 'ID de la sesión (jti del token)',
+    user_id INT NOT NULL,
+    tenant_id INT NOT NULL DEFAULT 0,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL COMMENT 'Vencimiento del último token emitido (se extiende al renovarlo)',
+    revoked_at DATETIME NULL COMMENT 'Logout, cambio de contraseña o cierre forzado por un admin',
+    INDEX idx_user (user_id, revoked_at),
+    INDEX idx_revoked (revoked_at, expires_at),
+    INDEX idx_tenant (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
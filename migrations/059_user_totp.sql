@@ -0,0 +1,6 @@
+-- Migración 059: autenticación en dos pasos (TOTP) con códigos de recuperación
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) NOT NULL DEFAULT '' COMMENT 'Secreto TOTP en base32 (pendiente de confirmar mientras totp_enabled = FALSE)';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'El login pide el código de la app autenticadora';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0 COMMENT 'Último período TOTP usado (un código no se acepta dos veces)';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_recovery TEXT NULL COMMENT 'Hashes SHA-256 de los códigos de recuperación sin usar, separados por coma';
@@ -0,0 +1,3 @@
+-- Migración 060: origen de los usuarios (locales o creados por LDAP / OIDC en su primer login)
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_source VARCHAR(10) NOT NULL DEFAULT 'local' COMMENT 'local, ldap u oidc (los externos no tienen contraseña local)';
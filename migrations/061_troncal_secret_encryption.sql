@@ -0,0 +1,4 @@
+-- Migración 061: secretos SIP de las troncales cifrados en reposo (AES-256-GCM, "enc:v1:<base64>")
+-- El cifrado de las filas existentes lo hace apicall al arrancar con security.secrets_key configurada.
+
+ALTER TABLE apicall_troncales MODIFY password VARCHAR(512) COMMENT 'Secreto SIP (cifrado si security.secrets_key está configurada)';
@@ -0,0 +1,6 @@
+-- Migración 062: Índices para la búsqueda de llamadas por teléfono y disposición (GET /api/v1/logs)
+-- idx_telefono_created reemplaza a idx_telefono (mismo prefijo) y permite ordenar por fecha sin filesort.
+
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_telefono_created (telefono, created_at);
+ALTER TABLE apicall_call_log DROP INDEX IF EXISTS idx_telefono;
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_proyecto_disposition (proyecto_id, disposition, created_at);
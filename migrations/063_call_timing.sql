@@ -0,0 +1,4 @@
+-- Migración 063: Tiempo de timbrado y de conversación de cada llamada (eventos AMI Newchannel/Newstate/Hangup o ARI)
+
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS segundos_timbrado INT NULL COMMENT 'Segundos desde el originate hasta la respuesta (o el cuelgue si no contestó)';
+ALTER TABLE apicall_call_log ADD COLUMN IF NOT EXISTS segundos_conversacion INT NULL COMMENT 'Segundos desde la respuesta hasta el cuelgue (0 si no contestó)';
@@ -0,0 +1,5 @@
+-- Migración 064: Timbrado y conversación en los rollups horarios (solo llamadas con tiempos medidos)
+
+ALTER TABLE apicall_call_rollup_hourly ADD COLUMN IF NOT EXISTS con_tiempos INT NOT NULL DEFAULT 0 COMMENT 'Llamadas con segundos_timbrado medido';
+ALTER TABLE apicall_call_rollup_hourly ADD COLUMN IF NOT EXISTS timbrado_total BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE apicall_call_rollup_hourly ADD COLUMN IF NOT EXISTS conversacion_total BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Migración 065: Máximo de intentos por número y día sumando todos los proyectos, aplicado en la API, el Spooler y el Sweeper.
+-- El límite global va en apicall_config (max_number_attempts_day), el conteo usa idx_telefono_created.
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS max_number_attempts_day INT DEFAULT 0 COMMENT 'Intentos por número y día en todos los proyectos (0 = solo el límite global)';
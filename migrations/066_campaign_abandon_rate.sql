@@ -0,0 +1,5 @@
+-- Migración 066: Tasa de abandono por campaña (contestadas por humano sin agente) y regla de salida que la limita
+
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_max_abandon DECIMAL(5,2) DEFAULT 0 COMMENT 'Pausar si el % de abandono supera este valor (0 = desactivada)';
+ALTER TABLE apicall_campaigns ADD COLUMN IF NOT EXISTS exit_abandon_hours INT DEFAULT 0 COMMENT 'Ventana deslizante en horas para la tasa de abandono (0 = 24)';
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_campaign_created (campaign_id, created_at)
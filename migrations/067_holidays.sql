@@ -0,0 +1,13 @@
+-- Migración 067: Calendario de feriados (por organización o por proyecto): las campañas no marcan esos días
+
+CREATE TABLE IF NOT EXISTS apicall_holidays (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    proyecto_id INT NOT NULL DEFAULT 0 COMMENT '0 = todos los proyectos de la organización',
+    fecha DATE NOT NULL,
+    nombre VARCHAR(100) NOT NULL DEFAULT '',
+    anual BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Se repite cada año el mismo día y mes',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY unique_holiday (tenant_id, proyecto_id, fecha),
+    INDEX idx_fecha (fecha)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+-- Migración 068: Franja horaria preferida por contacto. El Sweeper solo marca al contacto dentro de su franja
+-- (hora local de ventana_tz, o del proyecto si está vacía) y mientras tanto sigue con los demás.
+
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS ventana_inicio TIME NULL COMMENT 'Inicio de la franja preferida (NULL = sin franja)';
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS ventana_fin TIME NULL COMMENT 'Fin de la franja (exclusivo, menor que el inicio = cruza la medianoche)';
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS ventana_tz VARCHAR(64) NULL COMMENT 'Zona horaria IANA de la franja (NULL = la del proyecto)'
@@ -0,0 +1,39 @@
+-- Migración 069: Zona horaria por prefijo del número (ladas de México, códigos de área de EE.UU.) y horario
+-- local de destino por proyecto. El Sweeper asigna a cada contacto la zona de su prefijo más largo
+-- (zona_local, vacía = la del proyecto) y no lo marca fuera de horario_local aunque la campaña esté en horario.
+
+CREATE TABLE IF NOT EXISTS apicall_prefix_timezones (
+    prefijo VARCHAR(16) NOT NULL PRIMARY KEY COMMENT 'Prefijo E.164 sin + (ej: 52664, 1212)',
+    timezone VARCHAR(64) NOT NULL COMMENT 'Zona IANA (ej: America/Tijuana)',
+    descripcion VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE apicall_proyectos ADD COLUMN IF NOT EXISTS horario_local VARCHAR(17) DEFAULT '' COMMENT 'Horario local del destino HH:MM:SS-HH:MM:SS (vacío = sin restricción)';
+ALTER TABLE apicall_campaign_contacts ADD COLUMN IF NOT EXISTS zona_local VARCHAR(64) NULL COMMENT 'Zona del prefijo del número (vacío = la del proyecto, NULL = sin asignar)';
+
+-- México: Centro por defecto y las ladas de los estados con otra zona
+INSERT INTO apicall_prefix_timezones (prefijo, timezone, descripcion) VALUES
+    ('52', 'America/Mexico_City', 'México (Centro)'),
+    ('52664', 'America/Tijuana', 'Tijuana, BC'),
+    ('52665', 'America/Tijuana', 'Tecate, BC'),
+    ('52661', 'America/Tijuana', 'Rosarito, BC'),
+    ('52646', 'America/Tijuana', 'Ensenada, BC'),
+    ('52686', 'America/Tijuana', 'Mexicali, BC'),
+    ('52662', 'America/Hermosillo', 'Hermosillo, Son'),
+    ('52644', 'America/Hermosillo', 'Ciudad Obregón, Son'),
+    ('52631', 'America/Hermosillo', 'Nogales, Son'),
+    ('52642', 'America/Hermosillo', 'Navojoa, Son'),
+    ('52622', 'America/Hermosillo', 'Guaymas, Son'),
+    ('52653', 'America/Hermosillo', 'San Luis Río Colorado, Son'),
+    ('52667', 'America/Mazatlan', 'Culiacán, Sin'),
+    ('52668', 'America/Mazatlan', 'Los Mochis, Sin'),
+    ('52669', 'America/Mazatlan', 'Mazatlán, Sin'),
+    ('52311', 'America/Mazatlan', 'Tepic, Nay'),
+    ('52612', 'America/Mazatlan', 'La Paz, BCS'),
+    ('52624', 'America/Mazatlan', 'Los Cabos, BCS'),
+    ('52998', 'America/Cancun', 'Cancún, QRoo'),
+    ('52984', 'America/Cancun', 'Playa del Carmen, QRoo'),
+    ('52983', 'America/Cancun', 'Chetumal, QRoo'),
+    ('52987', 'America/Cancun', 'Cozumel, QRoo')
+ON DUPLICATE KEY UPDATE prefijo = prefijo
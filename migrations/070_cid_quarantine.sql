@@ -0,0 +1,15 @@
+-- Migración 070: Cuarentena de Caller IDs. El monitor de alertas retira de la rotación los Caller IDs cuya
+-- tasa de contestación colapsa (probable marca de spam) hasta que un operador los libera.
+
+CREATE TABLE IF NOT EXISTS apicall_cid_quarantine (
+    caller_id VARCHAR(20) NOT NULL PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    proyecto_id INT NOT NULL DEFAULT 0 COMMENT 'Proyecto en el que se detectó el colapso',
+    llamadas INT NOT NULL DEFAULT 0 COMMENT 'Llamadas finalizadas en la ventana evaluada',
+    answer_rate DECIMAL(5,2) NOT NULL DEFAULT 0 COMMENT '% de contestadas en la ventana',
+    motivo VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tenant (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE apicall_call_log ADD INDEX IF NOT EXISTS idx_created_cid (created_at, caller_id_used)
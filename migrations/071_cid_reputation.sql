@@ -0,0 +1,12 @@
+-- Migración 071: Reputación de Caller IDs. Resultado de la última consulta a la API de reputación
+-- configurada en reputation (cómo etiquetan los operadores / apps cada número presentado).
+
+CREATE TABLE IF NOT EXISTS apicall_cid_reputation (
+    caller_id VARCHAR(20) NOT NULL PRIMARY KEY,
+    provider VARCHAR(30) NOT NULL DEFAULT '',
+    label VARCHAR(100) NOT NULL DEFAULT '' COMMENT 'Etiqueta devuelta por el proveedor (ej: spam, scam, clean)',
+    score DECIMAL(7,2) NULL COMMENT 'Puntaje de riesgo del proveedor (NULL = no informado)',
+    error VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'Error de la última consulta (vacío = consulta exitosa)',
+    checked_at DATETIME NOT NULL,
+    INDEX idx_checked (checked_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
@@ -0,0 +1,168 @@
+#!/bin/bash
+#
+# Prueba end-to-end de una campaña contra Asterisk y MariaDB reales (Docker).
+#
+# Levanta el entorno de docker-compose.yml, aplica las migraciones, arranca apicall en
+# modo container (Originate por AMI) y corre una campaña de 4 contactos por la troncal
+# "loopback", cuyo dialplan simula al abonado según el número:
+#   3001xxxx contesta y marca 1 -> XFER, contacto completed
+#   3002xxxx contesta sin marcar -> N
+#   3003xxxx ocupado             -> contacto failed
+#   3004xxxx congestión          -> contacto failed
+#
+# Uso: ./test/e2e/run.sh [--keep]   (--keep deja los contenedores arriba para depurar)
+# Requiere docker compose, go, curl, python3 y permisos de escritura en /var/lib/apicall.
+
+set -euo pipefail
+
+E2E_DIR="$(cd "$(dirname "$0")" && pwd)"
+ROOT_DIR="$(cd "$E2E_DIR/../.." && pwd)"
+API_URL="http://127.0.0.1:8080"
+PROYECTO_ID=9901
+TIMEOUT=180
+
+KEEP=false
+[ "${1:-}" = "--keep" ] && KEEP=true
+
+COMPOSE="docker compose -f $E2E_DIR/docker-compose.yml -p apicall-e2e"
+WORK_DIR="$(mktemp -d)"
+APICALL_PID=""
+FAILED=0
+
+cleanup() {
+    [ -n "$APICALL_PID" ] && kill "$APICALL_PID" 2>/dev/null || true
+    if [ "$KEEP" = false ]; then
+        $COMPOSE down -v >/dev/null 2>&1 || true
+        rm -rf "$E2E_DIR/sounds"
+    fi
+    rm -rf "$WORK_DIR"
+}
+trap cleanup EXIT
+
+parse_json() {
+    python3 -c "import sys, json; print(json.load(sys.stdin)$1)"
+}
+
+sql() {
+    $COMPOSE exec -T mariadb mariadb -N -uroot -pe2e_root apicall_db -e "$1"
+}
+
+check() {
+    local desc="$1" expected="$2" actual="$3"
+    if [ "$expected" = "$actual" ]; then
+        echo "  ✓ $desc: $actual"
+    else
+        echo "  ✗ $desc: esperado '$expected', obtenido '$actual'"
+        FAILED=1
+    fi
+}
+
+# 1. Audios del proyecto (silencio de 1s, 8kHz mono)
+echo "Generando audios..."
+mkdir -p "$E2E_DIR/sounds"
+for name in apicall_e2e opcion_invalida en_breve; do
+    python3 - "$E2E_DIR/sounds/$name.wav" <<'EOF'
+import sys, wave
+with wave.open(sys.argv[1], "wb") as w:
+    w.setnchannels(1)
+    w.setsampwidth(2)
+    w.setframerate(8000)
+    w.writeframes(b"\x00\x00" * 8000)
+EOF
+done
+
+# 2. Entorno
+echo "Levantando MariaDB y Asterisk..."
+$COMPOSE up -d
+for i in $(seq 1 60); do
+    if $COMPOSE exec -T mariadb healthcheck.sh --connect --innodb_initialized >/dev/null 2>&1; then
+        break
+    fi
+    [ "$i" = 60 ] && { echo "MariaDB no respondió"; exit 1; }
+    sleep 2
+done
+
+echo "Aplicando migraciones..."
+for f in "$ROOT_DIR"/migrations/*.sql; do
+    $COMPOSE exec -T mariadb mariadb -uroot -pe2e_root apicall_db < "$f" >/dev/null
+done
+
+# 3. apicall
+echo "Compilando y arrancando apicall..."
+(cd "$ROOT_DIR" && go build -o "$WORK_DIR/apicall" ./cmd/apicall)
+APICALL_CONFIG="$E2E_DIR/apicall.yaml" "$WORK_DIR/apicall" start > "$WORK_DIR/apicall.log" 2>&1 &
+APICALL_PID=$!
+for i in $(seq 1 30); do
+    curl -s -o /dev/null "$API_URL/api/v1/login" && break
+    [ "$i" = 30 ] && { echo "apicall no arrancó"; cat "$WORK_DIR/apicall.log"; exit 1; }
+    sleep 1
+done
+
+TOKEN=$(curl -s -X POST "$API_URL/api/v1/login" -H "Content-Type: application/json" \
+    -d '{"username": "admin", "password": "admin123"}' | parse_json "['token']")
+api() {
+    curl -sf -H "Authorization: Bearer $TOKEN" "$@"
+}
+
+# 4. Troncal, proyecto y campaña
+echo "Creando troncal, proyecto y campaña..."
+api -X POST "$API_URL/api/v1/troncales" -H "Content-Type: application/json" \
+    -d '{"nombre": "loopback", "host": "127.0.0.1", "puerto": 5060, "contexto": "loopback_in", "activo": true}' >/dev/null
+
+api -X POST "$API_URL/api/v1/proyectos" -H "Content-Type: application/json" -d "{
+    \"id\": $PROYECTO_ID, \"nombre\": \"E2E\", \"caller_id\": \"5550000\", \"audio\": \"apicall_e2e\",
+    \"dtmf_esperado\": \"1\", \"numero_desborde\": \"30050001\", \"troncal_salida\": \"loopback\",
+    \"dial_engine\": \"ami\"
+}" >/dev/null
+
+CAMPAIGN_ID=$(api -X POST "$API_URL/api/v1/campaigns" -H "Content-Type: application/json" \
+    -d "{\"nombre\": \"E2E\", \"proyecto_id\": $PROYECTO_ID}" | parse_json "['id']")
+
+# Horario abierto todos los días para que el Sweeper no espere la ventana
+SCHEDULES=$(python3 -c 'import json; print(json.dumps([{"dia_semana": d, "hora_inicio": "00:00:00", "hora_fin": "23:59:59", "activo": True} for d in range(7)]))')
+api -X POST "$API_URL/api/v1/campaigns/schedules?campaign_id=$CAMPAIGN_ID" \
+    -H "Content-Type: application/json" -d "$SCHEDULES" >/dev/null
+
+printf 'telefono\n30010001\n30020001\n30030001\n30040001\n' > "$WORK_DIR/contacts.csv"
+IMPORT_ID=$(api -X POST "$API_URL/api/v1/campaigns/upload?campaign_id=$CAMPAIGN_ID" \
+    -F "file=@$WORK_DIR/contacts.csv" | parse_json "['import_id']")
+for i in $(seq 1 30); do
+    ESTADO=$(api "$API_URL/api/v1/imports/$IMPORT_ID" | parse_json "['estado']")
+    [ "$ESTADO" = "completed" ] && break
+    [ "$ESTADO" = "failed" ] || [ "$i" = 30 ] && { echo "Importación $IMPORT_ID: $ESTADO"; exit 1; }
+    sleep 1
+done
+
+# 5. Campaña
+echo "Iniciando campaña $CAMPAIGN_ID..."
+api -X POST "$API_URL/api/v1/campaigns/action" -H "Content-Type: application/json" \
+    -d "{\"campaign_id\": $CAMPAIGN_ID, \"action\": \"start\"}" >/dev/null
+
+for i in $(seq 1 $TIMEOUT); do
+    OPEN=$(sql "SELECT COUNT(*) FROM apicall_campaign_contacts WHERE campaign_id = $CAMPAIGN_ID AND estado IN ('pending', 'dialing')")
+    [ "$OPEN" = 0 ] && break
+    [ "$i" = $TIMEOUT ] && { echo "Quedan $OPEN contactos sin resolver tras ${TIMEOUT}s"; FAILED=1; }
+    sleep 1
+done
+
+# 6. Verificación
+echo "Verificando resultados..."
+contact() {
+    sql "SELECT estado FROM apicall_campaign_contacts WHERE campaign_id = $CAMPAIGN_ID AND telefono = '$1'"
+}
+disposition() {
+    sql "SELECT disposition FROM apicall_call_log WHERE campaign_id = $CAMPAIGN_ID AND telefono = '$1' ORDER BY id DESC LIMIT 1"
+}
+check "30010001 disposition" "XFER" "$(disposition 30010001)"
+check "30010001 contacto" "completed" "$(contact 30010001)"
+check "30020001 disposition" "N" "$(disposition 30020001)"
+check "30030001 contacto" "failed" "$(contact 30030001)"
+check "30040001 contacto" "failed" "$(contact 30040001)"
+check "logs con contact_id" "4" "$(sql "SELECT COUNT(*) FROM apicall_call_log WHERE campaign_id = $CAMPAIGN_ID AND contact_id IS NOT NULL")"
+
+if [ "$FAILED" != 0 ]; then
+    echo "E2E FALLIDO. Log de apicall:"
+    tail -n 100 "$WORK_DIR/apicall.log"
+    exit 1
+fi
+echo "E2E OK"